@@ -0,0 +1,255 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/limpdev/gander/internal/logfile"
+	"github.com/limpdev/gander/internal/models"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// Like the audit log, the destination is kept open across config reloads as
+// long as it stays the same
+var (
+	accessLogMu          sync.Mutex
+	accessLogWriter      io.WriteCloser
+	accessLogDestination logDestination
+)
+
+type logDestination struct {
+	path       string
+	maxSize    int
+	maxBackups int
+	enabled    bool
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func configureAccessLog(config *models.AccessLogConfig) error {
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	destination := logDestination{config.Path, config.MaxSize, config.MaxBackups, config.Format != ""}
+	if destination == accessLogDestination {
+		return nil
+	}
+
+	var writer io.WriteCloser
+	if config.Path != "" {
+		file, err := logfile.Open(config.Path, config.MaxSize, config.MaxBackups)
+		if err != nil {
+			return fmt.Errorf("opening access log: %v", err)
+		}
+		writer = file
+	} else if config.Format != "" {
+		writer = nopWriteCloser{os.Stdout}
+	}
+
+	if accessLogWriter != nil {
+		accessLogWriter.Close()
+	}
+
+	accessLogWriter = writer
+	accessLogDestination = destination
+
+	return nil
+}
+
+func writeAccessLogLine(line []byte) {
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	if accessLogWriter == nil {
+		return
+	}
+
+	if _, err := accessLogWriter.Write(line); err != nil {
+		slog.Error("Could not write to access log", "error", err)
+	}
+}
+
+type loggedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *loggedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *loggedResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Allows http.ResponseController to reach the flusher of the original writer
+func (w *loggedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Gives every request an ID which gets sent back in the X-Request-ID header
+// and logs it once it has been handled, in the configured format
+func (a *Application) logRequests(handler http.Handler) http.Handler {
+	config := &a.Config.Server.AccessLog
+	if config.Format == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := a.requestID(r)
+		w.Header().Set(requestIDHeader, requestID)
+
+		if a.isExcludedFromAccessLog(r.URL.Path) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		logged := &loggedResponseWriter{ResponseWriter: w}
+		handler.ServeHTTP(logged, r)
+		if logged.status == 0 {
+			logged.status = http.StatusOK
+		}
+
+		writeAccessLogLine(a.formatAccessLogLine(r, logged, requestID, start))
+	})
+}
+
+// Behind a reverse proxy the ID it assigned gets reused so that the logs of
+// both can be matched up
+func (a *Application) requestID(r *http.Request) string {
+	if a.Config.Server.Proxied {
+		if id := r.Header.Get(requestIDHeader); id != "" && len(id) <= 128 {
+			return id
+		}
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func (a *Application) isExcludedFromAccessLog(path string) bool {
+	config := &a.Config.Server.AccessLog
+
+	if config.ExcludeStatic &&
+		(strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/assets/") || path == "/manifest.json") {
+		return true
+	}
+
+	for _, prefix := range config.ExcludePaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *Application) formatAccessLogLine(r *http.Request, w *loggedResponseWriter, requestID string, start time.Time) []byte {
+	ip := a.addressOfRequest(r)
+
+	if a.Config.Server.AccessLog.Format == models.AccessLogFormatJSON {
+		line, _ := json.Marshal(struct {
+			Time       time.Time `json:"time"`
+			RequestID  string    `json:"request_id"`
+			IP         string    `json:"ip"`
+			Method     string    `json:"method"`
+			URI        string    `json:"uri"`
+			Proto      string    `json:"proto"`
+			Status     int       `json:"status"`
+			Bytes      int64     `json:"bytes"`
+			DurationMS float64   `json:"duration_ms"`
+			Referer    string    `json:"referer,omitempty"`
+			UserAgent  string    `json:"user_agent,omitempty"`
+		}{
+			Time:       start.UTC(),
+			RequestID:  requestID,
+			IP:         ip,
+			Method:     r.Method,
+			URI:        loggedRequestURI(r.RequestURI),
+			Proto:      r.Proto,
+			Status:     w.status,
+			Bytes:      w.bytes,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		})
+		return append(line, '\n')
+	}
+
+	// https://httpd.apache.org/docs/current/logs.html#common
+	line := fmt.Sprintf(
+		"%s - - [%s] \"%s %s %s\" %d %s",
+		ip, start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, quoteLogValue(loggedRequestURI(r.RequestURI)), r.Proto,
+		w.status, formatLogBytes(w.bytes),
+	)
+
+	if a.Config.Server.AccessLog.Format == models.AccessLogFormatCombined {
+		line += fmt.Sprintf(" \"%s\" \"%s\"", quoteLogValue(r.Referer()), quoteLogValue(r.UserAgent()))
+	}
+
+	return []byte(line + "\n")
+}
+
+func formatLogBytes(bytes int64) string {
+	if bytes == 0 {
+		return "-"
+	}
+
+	return fmt.Sprint(bytes)
+}
+
+// Escapes quotes and control characters so that values sent by the client
+// can't break up or forge log lines
+func quoteLogValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	quoted := fmt.Sprintf("%q", value)
+	return quoted[1 : len(quoted)-1]
+}
+
+// Snapshot and webhook requests can carry their token in the query string,
+// which gets left out so that having access to the logs doesn't give access to
+// what the token does
+func loggedRequestURI(uri string) string {
+	path, query, found := strings.Cut(uri, "?")
+	if !found {
+		return uri
+	}
+
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil && unescaped == "token" {
+			params[i] = key + "=<redacted>"
+		}
+	}
+
+	return path + "?" + strings.Join(params, "&")
+}
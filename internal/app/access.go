@@ -0,0 +1,99 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/limpdev/gander/internal/models"
+)
+
+// Wraps endpoints meant for managing the instance rather than viewing the
+// dashboard, which are only available to users with the admin role. Without
+// authentication there are no roles and everyone has access.
+func (a *Application) adminOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, authorized := a.authenticatedUsername(w, r)
+		if !authorized {
+			a.respondUnauthorized(w, r, showUnauthorizedJSON)
+			return
+		}
+
+		allowed := !a.RequiresAuth || a.Config.Auth.Users[username].IsAdmin()
+		a.audit(r, auditEventAdminRequest, username, map[string]any{
+			"method":  r.Method,
+			"path":    r.URL.Path,
+			"allowed": allowed,
+		})
+
+		if !allowed {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "Forbidden"}`))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (a *Application) isUserAllowed(username string, allowedUsers, allowedGroups []string) bool {
+	if !a.RequiresAuth {
+		return true
+	}
+
+	return models.IsUserAllowed(username, a.Config.Auth.Users[username], allowedUsers, allowedGroups)
+}
+
+func (a *Application) canAccessPage(username string, page *models.Page) bool {
+	return a.isUserAllowed(username, page.AllowedUsers, page.AllowedGroups)
+}
+
+// A widget is only accessible if its page and every container it's within are
+// accessible as well
+func (a *Application) canAccessWidget(username string, widget models.Widget) bool {
+	page, exists := a.pageByWidgetID[widget.GetID()]
+	if !exists || !a.canAccessPage(username, page) {
+		return false
+	}
+
+	for current := widget; current != nil; current = a.parentByWidgetID[current.GetID()] {
+		restricted, ok := current.(models.AccessRestrictedWidget)
+		if ok && !a.isUserAllowed(username, restricted.GetAllowedUsers(), restricted.GetAllowedGroups()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *Application) accessiblePages(username string, host *models.HostConfig) []*models.Page {
+	pages := make([]*models.Page, 0, len(a.Config.Pages))
+
+	for i := range a.Config.Pages {
+		if a.canAccessPage(username, &a.Config.Pages[i]) && isPageShownOnHost(host, &a.Config.Pages[i]) {
+			pages = append(pages, &a.Config.Pages[i])
+		}
+	}
+
+	return pages
+}
+
+// Used when visiting the root, which is the first page the user can access
+// on the host rather than always being the first page
+func (a *Application) firstAccessiblePage(username string, host *models.HostConfig) *models.Page {
+	for i := range a.Config.Pages {
+		if a.canAccessPage(username, &a.Config.Pages[i]) && isPageShownOnHost(host, &a.Config.Pages[i]) {
+			return &a.Config.Pages[i]
+		}
+	}
+
+	return nil
+}
+
+// Called from templates to only list the pages and render the widgets that the
+// user making the request can access and that are shown on the host
+func (d templateData) AccessiblePages() []*models.Page {
+	return d.App.accessiblePages(d.Request.Username, d.Request.Host)
+}
+
+func (d templateData) CanAccessWidget(widget models.Widget) bool {
+	return d.App.canAccessWidget(d.Request.Username, widget)
+}
@@ -0,0 +1,27 @@
+//go:build !windows && !plan9
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+)
+
+// The address is either local for the syslog daemon of this machine or a URL
+// such as udp://logs.example.com:514
+func openAuditSyslog(address string) (io.WriteCloser, error) {
+	const priority = syslog.LOG_INFO | syslog.LOG_AUTH
+
+	if address == "local" {
+		return syslog.New(priority, "gander")
+	}
+
+	parsed, err := url.Parse(address)
+	if err != nil || (parsed.Scheme != "udp" && parsed.Scheme != "tcp") || parsed.Host == "" {
+		return nil, fmt.Errorf("syslog must be either local or an address such as udp://host:514")
+	}
+
+	return syslog.Dial(parsed.Scheme, parsed.Host, priority, "gander")
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/limpdev/gander/internal/logfile"
+	"github.com/limpdev/gander/internal/models"
+)
+
+const (
+	auditEventLoginSuccess    = "login.success"
+	auditEventLoginFailure    = "login.failure"
+	auditEventLoginLockout    = "login.lockout"
+	auditEventLogout          = "logout"
+	auditEventSessionsRevoked = "sessions.revoked"
+	auditEventConfigLoaded    = "config.loaded"
+	auditEventConfigReloaded  = "config.reloaded"
+	auditEventConfigFailed    = "config.failed"
+	auditEventThemeChanged    = "theme.changed"
+	auditEventLayoutChanged   = "layout.changed"
+	auditEventAdminRequest    = "admin.request"
+)
+
+// The audit log outlives applications since it's configured once per config
+// rather than once per application, and config reloads have to be recorded
+// before the new application exists
+var (
+	auditLogMu     sync.Mutex
+	auditLogWriter io.WriteCloser
+	auditLogConfig models.AuditLogConfig
+)
+
+type auditEvent struct {
+	Time   time.Time      `json:"time"`
+	Event  string         `json:"event"`
+	User   string         `json:"user,omitempty"`
+	IP     string         `json:"ip,omitempty"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// Opens the destination of the audit log, reusing the current one if the
+// config didn't change it
+func configureAuditLog(config models.AuditLogConfig) error {
+	auditLogMu.Lock()
+	defer auditLogMu.Unlock()
+
+	if auditLogWriter != nil && config == auditLogConfig {
+		return nil
+	}
+
+	var writer io.WriteCloser
+	var err error
+
+	switch {
+	case config.Syslog != "":
+		writer, err = openAuditSyslog(config.Syslog)
+	case config.Path != "":
+		writer, err = logfile.Open(config.Path, config.MaxSize, config.MaxBackups)
+	}
+
+	if err != nil {
+		return fmt.Errorf("opening audit log: %v", err)
+	}
+
+	if auditLogWriter != nil {
+		auditLogWriter.Close()
+	}
+
+	auditLogWriter = writer
+	auditLogConfig = config
+
+	return nil
+}
+
+func writeAuditEvent(event auditEvent) {
+	auditLogMu.Lock()
+	defer auditLogMu.Unlock()
+
+	if auditLogWriter == nil {
+		return
+	}
+
+	event.Time = time.Now().UTC()
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	if _, err := auditLogWriter.Write(append(encoded, '\n')); err != nil {
+		slog.Error("Could not write to audit log", "error", err)
+	}
+}
+
+// Records an event caused by a request, fields can be nil
+func (a *Application) audit(r *http.Request, event, username string, fields map[string]any) {
+	writeAuditEvent(auditEvent{
+		Event:  event,
+		User:   username,
+		IP:     a.addressOfRequest(r),
+		Fields: fields,
+	})
+}
@@ -23,12 +23,27 @@ const (
 	IntentMountpointInfo
 	IntentSecretMake
 	IntentPasswordHash
+	IntentFeedsImportOPML
+	IntentFeedsExportOPML
+	IntentConfigImport
 )
 
 type Options struct {
-	Intent     Intent
-	ConfigPath string
-	Args       []string
+	Intent        Intent
+	ConfigPath    string
+	Args          []string
+	ResolveVars   bool
+	RedactSecrets bool
+	Strict        bool
+	Profile       string
+	Template      bool
+	AllowExec     string
+	HashAlgo      string
+	HashCost      int
+	ImportFrom    string
+	// Whether diagnose should update the widgets of the config instead of
+	// checking network connectivity
+	DiagnoseWidgets bool
 }
 
 func ParseCliOptions() (*Options, error) {
@@ -46,14 +61,27 @@ func ParseCliOptions() (*Options, error) {
 		flags.PrintDefaults()
 		fmt.Println("\nCommands:")
 		fmt.Println(" config:validate Validate the config file")
+		fmt.Println("   --strict Also fail on unknown properties")
 		fmt.Println(" config:print Print the parsed config file with embedded includes")
-		fmt.Println(" password:hash <pwd> Hash a password")
+		fmt.Println("   --resolve-vars Replace variables such as ${ENV_VAR} with their values")
+		fmt.Println("   --redact-secrets Hide passwords, tokens and values that come from variables")
+		fmt.Println(" config:import --from <source> <file> Print a config converted from another dashboard")
+		fmt.Println("   --from Either homer, dashy or heimdall")
+		fmt.Println(" password:hash [flags] <pwd> Hash a password")
+		fmt.Println("   --algo Either bcrypt or argon2id (default bcrypt)")
+		fmt.Println("   --cost The bcrypt cost or the number of argon2id iterations")
 		fmt.Println(" secret:make Generate a random secret key")
+		fmt.Println(" feeds:import-opml <file> Print rss widgets with the feeds of an OPML file")
+		fmt.Println(" feeds:export-opml Print the feeds of the config as OPML")
 		fmt.Println(" sensors:print List all sensors")
 		fmt.Println(" mountpoint:info Print information about a given mountpoint path")
 		fmt.Println(" diagnose Run diagnostic checks")
+		fmt.Println("   --widgets Update every widget of the config once and report how long each one took")
 	}
-	configPath := flags.String("config", "gander.yml", "Set config path")
+	configPath := flags.String("config", "gander.yml", "Set config path, or a directory of configs to serve as separate dashboards")
+	profile := flags.String("profile", "", "Set the active config profiles, comma separated")
+	useTemplate := flags.Bool("template", false, "Process config files as Go templates before parsing them")
+	allowExec := flags.String("allow-exec", "", "Set the commands that ${exec:...} config variables can run, comma separated")
 	err := flags.Parse(os.Args[1:])
 	if err != nil {
 		return nil, err
@@ -61,6 +89,59 @@ func ParseCliOptions() (*Options, error) {
 	var intent Intent
 	args = flags.Args()
 	unknownCommandErr := fmt.Errorf("unknown command: %s", strings.Join(args, " "))
+	var resolveVars, redactSecrets, strict, diagnoseWidgets bool
+	var hashAlgo, importFrom string
+	var hashCost int
+	if len(args) > 2 && args[0] == "password:hash" {
+		commandFlags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+		commandFlags.StringVar(&hashAlgo, "algo", "", "Either bcrypt or argon2id")
+		commandFlags.IntVar(&hashCost, "cost", 0, "The bcrypt cost or the number of argon2id iterations")
+		if err := commandFlags.Parse(args[1:]); err != nil {
+			return nil, err
+		}
+		if commandFlags.NArg() != 1 {
+			return nil, unknownCommandErr
+		}
+		args = []string{args[0], commandFlags.Arg(0)}
+	}
+	if len(args) > 1 && (args[0] == "config:print" || args[0] == "config:validate") {
+		commandFlags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+		if args[0] == "config:print" {
+			commandFlags.BoolVar(&resolveVars, "resolve-vars", false, "Replace variables with their values")
+			commandFlags.BoolVar(&redactSecrets, "redact-secrets", false, "Hide sensitive values")
+		} else {
+			commandFlags.BoolVar(&strict, "strict", false, "Fail on unknown properties")
+		}
+		if err := commandFlags.Parse(args[1:]); err != nil {
+			return nil, err
+		}
+		if commandFlags.NArg() > 0 {
+			return nil, unknownCommandErr
+		}
+		args = args[:1]
+	}
+	if len(args) > 1 && args[0] == "config:import" {
+		commandFlags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+		commandFlags.StringVar(&importFrom, "from", "", "Either homer, dashy or heimdall")
+		if err := commandFlags.Parse(args[1:]); err != nil {
+			return nil, err
+		}
+		if commandFlags.NArg() != 1 || importFrom == "" {
+			return nil, unknownCommandErr
+		}
+		args = []string{args[0], commandFlags.Arg(0)}
+	}
+	if len(args) > 1 && args[0] == "diagnose" {
+		commandFlags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+		commandFlags.BoolVar(&diagnoseWidgets, "widgets", false, "Report how long each widget takes to update")
+		if err := commandFlags.Parse(args[1:]); err != nil {
+			return nil, err
+		}
+		if commandFlags.NArg() > 0 {
+			return nil, unknownCommandErr
+		}
+		args = args[:1]
+	}
 	if len(args) == 0 {
 		intent = IntentServe
 	} else if len(args) == 1 {
@@ -74,12 +155,18 @@ func ParseCliOptions() (*Options, error) {
 			intent = IntentDiagnose
 		} else if args[0] == "secret:make" {
 			intent = IntentSecretMake
+		} else if args[0] == "feeds:export-opml" {
+			intent = IntentFeedsExportOPML
 		} else {
 			return nil, unknownCommandErr
 		}
 	} else if len(args) == 2 {
 		if args[0] == "password:hash" {
 			intent = IntentPasswordHash
+		} else if args[0] == "feeds:import-opml" {
+			intent = IntentFeedsImportOPML
+		} else if args[0] == "config:import" {
+			intent = IntentConfigImport
 		} else {
 			return nil, unknownCommandErr
 		}
@@ -93,9 +180,20 @@ func ParseCliOptions() (*Options, error) {
 		return nil, unknownCommandErr
 	}
 	return &Options{
-		Intent:     intent,
-		ConfigPath: *configPath,
-		Args:       args,
+		Intent:        intent,
+		ConfigPath:    *configPath,
+		Args:          args,
+		ResolveVars:   resolveVars,
+		RedactSecrets: redactSecrets,
+		Strict:        strict,
+		Profile:       *profile,
+		Template:      *useTemplate,
+		AllowExec:     *allowExec,
+		HashAlgo:      hashAlgo,
+		HashCost:      hashCost,
+		ImportFrom:    importFrom,
+
+		DiagnoseWidgets: diagnoseWidgets,
 	}, nil
 }
 func CliSensorsPrint() int {
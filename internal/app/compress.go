@@ -0,0 +1,274 @@
+package app
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const defaultCompressionMinSize = 1024
+
+var defaultCompressedContentTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/javascript",
+	"application/javascript",
+	"application/json",
+	"application/manifest+json",
+	"image/svg+xml",
+}
+
+// Both gzip.Writer and brotli.Writer
+type compressor interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(io.Writer)
+}
+
+// In order of preference for when the client accepts more than one equally
+var compressionEncodings = []string{"br", "gzip"}
+
+var compressorPools = map[string]*sync.Pool{
+	"br": {
+		New: func() any {
+			// the higher levels are meant for compressing ahead of time and
+			// are too slow for responses that get generated on each request
+			return brotli.NewWriterLevel(io.Discard, 5)
+		},
+	},
+	"gzip": {
+		New: func() any {
+			writer, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+			return writer
+		},
+	},
+}
+
+// Compresses responses with brotli or gzip, whichever the client prefers out of
+// the ones it accepts, as long as the content type is one of the compressible
+// ones and the body is at least minSize bytes
+func (a *Application) compressResponses(handler http.Handler) http.Handler {
+	config := &a.Config.Server.Compression
+	if config.Disable {
+		return handler
+	}
+
+	minSize := config.MinSize
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+
+	contentTypes := config.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultCompressedContentTypes
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		encoding := acceptedEncoding(r)
+		if encoding == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		compressed := &compressedResponseWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        minSize,
+			contentTypes:   contentTypes,
+		}
+		defer compressed.close()
+
+		handler.ServeHTTP(compressed, r)
+	})
+}
+
+// Returns the supported encoding with the highest quality value in the
+// Accept-Encoding header of the request, or an empty string if there's none
+func acceptedEncoding(r *http.Request) string {
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+
+	for encoding := range strings.SplitSeq(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if name == "*" {
+			wildcard = quality
+		} else if name != "" {
+			qualities[name] = quality
+		}
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range compressionEncodings {
+		quality, listed := qualities[encoding]
+		if !listed {
+			quality = wildcard
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
+
+// Holds on to the beginning of the body until there's enough of it to decide
+// whether it's worth compressing, at which point the headers get written
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	encoding     string
+	minSize      int
+	contentTypes []string
+
+	status     int
+	buffer     []byte
+	decided    bool
+	compressor compressor
+}
+
+func (w *compressedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	// informational responses are sent straight away and can be followed by another
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		w.status = 0
+	}
+}
+
+func (w *compressedResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.decided {
+		w.buffer = append(w.buffer, p...)
+		if len(w.buffer) < w.minSize {
+			return len(p), nil
+		}
+
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	if w.compressor != nil {
+		return w.compressor.Write(p)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressedResponseWriter) shouldCompress() bool {
+	header := w.Header()
+
+	if len(w.buffer) < w.minSize || header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	if w.status != http.StatusOK && w.status < 400 {
+		return false
+	}
+
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", http.DetectContentType(w.buffer))
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && slices.Contains(w.contentTypes, mediaType)
+}
+
+func (w *compressedResponseWriter) decide() error {
+	w.decided = true
+
+	if w.shouldCompress() {
+		header := w.Header()
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+
+		w.compressor = compressorPools[w.encoding].Get().(compressor)
+		w.compressor.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buffered := w.buffer
+	w.buffer = nil
+
+	if len(buffered) == 0 {
+		return nil
+	}
+
+	var err error
+	if w.compressor != nil {
+		_, err = w.compressor.Write(buffered)
+	} else {
+		_, err = w.ResponseWriter.Write(buffered)
+	}
+
+	return err
+}
+
+// Streamed responses can't wait for the buffer to fill up
+func (w *compressedResponseWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide()
+	}
+
+	if w.compressor != nil {
+		w.compressor.Flush()
+	}
+
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressedResponseWriter) close() {
+	if !w.decided && w.status != 0 {
+		w.decide()
+	}
+
+	if w.compressor != nil {
+		w.compressor.Close()
+		w.compressor.Reset(io.Discard)
+		compressorPools[w.encoding].Put(w.compressor)
+		w.compressor = nil
+	}
+}
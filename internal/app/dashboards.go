@@ -0,0 +1,355 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
+)
+
+// A directory of configs gets served as independent dashboards that share the
+// process, each with its own pages, theme and users. Dashboards are served
+// under the hostnames they list, or otherwise under their base-url, which
+// defaults to the name of their file. What applies to the whole process, such
+// as where to listen and logging, comes from the first dashboard.
+type dashboardServer struct {
+	mu         sync.RWMutex
+	dashboards []*dashboard
+}
+
+type dashboard struct {
+	name       string
+	configPath string
+	// The first dashboard is the one whose config applies to the whole process
+	first bool
+	// Nil when the files of the config aren't being watched
+	reloads *reloadRequests
+
+	app            *Application
+	handler        http.Handler
+	stop           context.CancelFunc
+	previousConfig *models.Config
+}
+
+func serveDashboards(dir string) error {
+	var paths []string
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+	if len(paths) == 0 {
+		return fmt.Errorf("no configs found in %s", dir)
+	}
+
+	server := &dashboardServer{}
+	var watched []*reloadRequests
+	onErr := func(err error) {
+		slog.Error("Error watching config files", "error", err)
+	}
+
+	for i, path := range paths {
+		d := &dashboard{
+			name:       strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+			configPath: path,
+			first:      i == 0,
+			reloads:    newReloadRequests(),
+		}
+		server.dashboards = append(server.dashboards, d)
+
+		contents, includes, sourceMap, err := loader.ParseYAMLIncludes(path)
+		if err != nil {
+			return fmt.Errorf("parsing config of dashboard %s: %w", d.name, err)
+		}
+
+		onChange := func(newContents []byte, sourceMap *loader.SourceMap) {
+			if err := server.apply(d, newContents, sourceMap); err != nil {
+				slog.Error("Config of dashboard has errors", "dashboard", d.name, "error", err)
+				writeAuditEvent(auditEvent{Event: auditEventConfigFailed, Fields: map[string]any{
+					"dashboard": d.name,
+					"error":     err.Error(),
+				}})
+			}
+		}
+
+		stopWatching, err := loader.ConfigFilesWatcher(path, contents, sourceMap, includes, onChange, onErr, d.reloads.ch)
+		if err == nil {
+			defer stopWatching()
+			watched = append(watched, d.reloads)
+		} else {
+			d.reloads = nil
+			slog.Warn("Error starting file watcher, config file changes will require a manual restart", "dashboard", d.name, "error", err)
+			onChange(contents, sourceMap)
+		}
+
+		// like with a single config, there's nothing to fall back to on startup
+		if d.app == nil {
+			return fmt.Errorf("dashboard %s could not be loaded", d.name)
+		}
+	}
+
+	if len(watched) > 0 {
+		defer reloadOnSIGHUP(watched...)()
+	}
+
+	first := server.dashboards[0].app
+	address := fmt.Sprintf("%s:%d", first.Config.Server.Host, first.Config.Server.Port)
+	listener, err := first.listen(address)
+	if err != nil {
+		return fmt.Errorf("starting server: %w", err)
+	}
+
+	for _, d := range server.dashboards {
+		slog.Info("Serving dashboard",
+			"dashboard", d.name,
+			"base-url", d.app.Config.Server.BaseURL,
+			"hostnames", strings.Join(d.app.Config.Server.Hostnames, ","),
+		)
+	}
+	slog.Info("Starting server", "address", listener.Addr().String(), "dashboards", len(server.dashboards))
+
+	if err := http.Serve(listener, server); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("starting server: %w", err)
+	}
+
+	return nil
+}
+
+// Creates the application of the dashboard from its config and puts it in
+// place of the previous one, if there was one
+func (s *dashboardServer) apply(d *dashboard, contents []byte, sourceMap *loader.SourceMap) error {
+	config, err := d.reloads.parse(contents)
+	if err != nil {
+		return sourceMap.TranslateError(err)
+	}
+
+	if config.Server.BaseURL == "" && len(config.Server.Hostnames) == 0 {
+		config.Server.BaseURL = "/" + d.name
+	}
+	if config.Server.BaseURL != "" && !strings.HasPrefix(config.Server.BaseURL, "/") {
+		return errors.New("server.base-url has to be a path when serving multiple dashboards")
+	}
+	config.Server.BaseURL = strings.TrimRight(config.Server.BaseURL, "/")
+	for i := range config.Server.Hostnames {
+		config.Server.Hostnames[i] = strings.ToLower(config.Server.Hostnames[i])
+	}
+	if err := s.checkConflicts(d, config); err != nil {
+		return err
+	}
+
+	if d.first {
+		if err := configureProcess(config); err != nil {
+			slog.Error("Failed to set up", "error", err)
+		}
+	} else {
+		s.mu.RLock()
+		first := s.dashboards[0].app
+		s.mu.RUnlock()
+		warnAboutProcessWideConfig(d, &first.Config, config)
+	}
+
+	if d.previousConfig != nil {
+		if reused := carryOverUnchangedWidgets(d.previousConfig, config); reused > 0 {
+			slog.Info("Kept the state of unchanged widgets", "dashboard", d.name, "count", reused)
+		}
+	}
+
+	app, err := newApplication(config, d.first, d.configPath)
+	if err != nil {
+		return fmt.Errorf("creating application: %w", err)
+	}
+	app.configPath, app.configContents = d.configPath, contents
+	app.reloads = d.reloads
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.runInBackground(ctx)
+
+	s.mu.Lock()
+	reloaded, stopPrevious := d.app != nil, d.stop
+	d.app, d.handler, d.stop = app, app.handler(), cancel
+	d.previousConfig = &app.Config
+	s.mu.Unlock()
+
+	if stopPrevious != nil {
+		stopPrevious()
+	}
+
+	if reloaded {
+		slog.Info("Reloaded config of dashboard", "dashboard", d.name)
+	}
+	writeAuditEvent(auditEvent{
+		Event:  common.Ternary(reloaded, auditEventConfigReloaded, auditEventConfigLoaded),
+		Fields: map[string]any{"dashboard": d.name},
+	})
+
+	return nil
+}
+
+// Dashboards can't be reachable through the same place or keep their state in
+// the same place
+func (s *dashboardServer) checkConflicts(d *dashboard, config *models.Config) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, other := range s.dashboards {
+		if other == d || other.app == nil {
+			continue
+		}
+		otherServer := &other.app.Config.Server
+
+		if config.Server.DataPath != "" && filepath.Clean(config.Server.DataPath) == filepath.Clean(otherServer.DataPath) {
+			return fmt.Errorf("server.data-path is the same as the one of dashboard %s", other.name)
+		}
+		for _, hostname := range config.Server.Hostnames {
+			if slices.Contains(otherServer.Hostnames, hostname) {
+				return fmt.Errorf("hostname %s is already used by dashboard %s", hostname, other.name)
+			}
+		}
+		if len(config.Server.Hostnames) == 0 && len(otherServer.Hostnames) == 0 && config.Server.BaseURL == otherServer.BaseURL {
+			return fmt.Errorf("server.base-url %s is already used by dashboard %s", config.Server.BaseURL, other.name)
+		}
+	}
+
+	return nil
+}
+
+// Settings that differ from the ones of the first dashboard would otherwise be
+// silently ignored
+func warnAboutProcessWideConfig(d *dashboard, first, config *models.Config) {
+	var ignored []string
+	if config.Server.Host != first.Server.Host ||
+		config.Server.Port != 8080 && config.Server.Port != first.Server.Port ||
+		config.Server.SocketPath != first.Server.SocketPath ||
+		config.Server.SocketMode != first.Server.SocketMode {
+		ignored = append(ignored, "where to listen")
+	}
+	if config.Server.LogLevel != first.Server.LogLevel ||
+		config.Server.LogFormat != first.Server.LogFormat ||
+		config.Server.LogFile != first.Server.LogFile {
+		ignored = append(ignored, "logging")
+	}
+	if config.Server.AuditLog != first.Server.AuditLog ||
+		config.Server.AccessLog.Format != first.Server.AccessLog.Format ||
+		config.Server.AccessLog.Path != first.Server.AccessLog.Path {
+		ignored = append(ignored, "audit and access logs")
+	}
+	if config.Server.MaxConcurrentUpdates != first.Server.MaxConcurrentUpdates {
+		ignored = append(ignored, "max-concurrent-updates")
+	}
+	if !slices.Equal(config.Server.AllowedHosts, first.Server.AllowedHosts) ||
+		!slices.Equal(config.Server.BlockedHosts, first.Server.BlockedHosts) {
+		ignored = append(ignored, "allowed-hosts and blocked-hosts")
+	}
+
+	if len(ignored) > 0 {
+		slog.Warn(
+			"Only the first dashboard configures the whole process, some settings are ignored",
+			"dashboard", d.name,
+			"ignored", strings.Join(ignored, ", "),
+		)
+	}
+}
+
+func (s *dashboardServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d := s.dashboardOfRequest(r)
+	if d == nil {
+		switch r.URL.Path {
+		case "/api/healthz":
+			w.WriteHeader(http.StatusOK)
+		case "/":
+			if home := s.defaultDashboard(); home != nil {
+				http.Redirect(w, r, home.app.Config.Server.BaseURL+"/", http.StatusTemporaryRedirect)
+				return
+			}
+			http.NotFound(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	s.mu.RLock()
+	baseURL, handler := d.app.Config.Server.BaseURL, d.handler
+	s.mu.RUnlock()
+
+	if baseURL == "" {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if r.URL.Path == baseURL {
+		http.Redirect(w, r, baseURL+"/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	http.StripPrefix(baseURL, handler).ServeHTTP(w, r)
+}
+
+// Dashboards that list the hostname of the request take precedence over the
+// ones whose base-url the path is within, the longest one winning
+func (s *dashboardServer) dashboardOfRequest(r *http.Request) *dashboard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(host)
+
+	var found *dashboard
+	for _, d := range s.dashboards {
+		if d.app == nil {
+			continue
+		}
+		server := &d.app.Config.Server
+
+		if slices.Contains(server.Hostnames, host) {
+			if found == nil || len(found.app.Config.Server.Hostnames) == 0 || len(server.BaseURL) > len(found.app.Config.Server.BaseURL) {
+				if server.BaseURL == "" || r.URL.Path == server.BaseURL || strings.HasPrefix(r.URL.Path, server.BaseURL+"/") {
+					found = d
+				}
+			}
+			continue
+		}
+
+		if len(server.Hostnames) > 0 || (found != nil && len(found.app.Config.Server.Hostnames) > 0) {
+			continue
+		}
+		if r.URL.Path != server.BaseURL && !strings.HasPrefix(r.URL.Path, server.BaseURL+"/") {
+			continue
+		}
+		if found == nil || len(server.BaseURL) > len(found.app.Config.Server.BaseURL) {
+			found = d
+		}
+	}
+
+	return found
+}
+
+// Where requests to the root go when no dashboard is served from it, which is
+// the first dashboard that isn't limited to hostnames
+func (s *dashboardServer) defaultDashboard() *dashboard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, d := range s.dashboards {
+		if d.app != nil && len(d.app.Config.Server.Hostnames) == 0 {
+			return d
+		}
+	}
+
+	return nil
+}
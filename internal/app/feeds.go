@@ -0,0 +1,140 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/limpdev/gander/internal/opml"
+	"gopkg.in/yaml.v3"
+)
+
+type importedRSSFeed struct {
+	URL   string `yaml:"url"`
+	Title string `yaml:"title,omitempty"`
+}
+
+type importedRSSWidget struct {
+	Type  string            `yaml:"type"`
+	Title string            `yaml:"title,omitempty"`
+	Feeds []importedRSSFeed `yaml:"feeds"`
+}
+
+// Prints an rss widget for each category of the OPML file, ready to be
+// pasted within the widgets of a column
+func cliImportOPML(path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Could not open OPML file: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	feeds, err := opml.Parse(file)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if len(feeds) == 0 {
+		fmt.Println("The OPML file doesn't contain any feeds")
+		return 1
+	}
+
+	var widgets []*importedRSSWidget
+	widgetByCategory := make(map[string]*importedRSSWidget)
+	for _, feed := range feeds {
+		widget, exists := widgetByCategory[feed.Category]
+		if !exists {
+			widget = &importedRSSWidget{Type: "rss", Title: feed.Category}
+			widgetByCategory[feed.Category] = widget
+			widgets = append(widgets, widget)
+		}
+
+		widget.Feeds = append(widget.Feeds, importedRSSFeed{URL: feed.URL, Title: feed.Title})
+	}
+
+	var output bytes.Buffer
+	encoder := yaml.NewEncoder(&output)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(widgets); err != nil {
+		fmt.Printf("Could not encode widgets: %v\n", err)
+		return 1
+	}
+
+	fmt.Print(output.String())
+	return 0
+}
+
+// Writes the feeds of every widget in the config to stdout as OPML, each
+// widget being a category named after its title
+func cliExportOPML(configPath string) int {
+	contents, _, sourceMap, err := loader.ParseYAMLIncludes(configPath)
+	if err != nil {
+		fmt.Printf("Could not parse config file: %v\n", err)
+		return 1
+	}
+
+	config, err := loader.NewConfigFromYAML(contents)
+	if err != nil {
+		fmt.Printf("Config file is invalid: %v\n", sourceMap.TranslateError(err))
+		return 1
+	}
+
+	var feeds []opml.Feed
+	seen := make(map[string]struct{})
+	var collect func(widget models.Widget)
+	collect = func(widget models.Widget) {
+		if container, ok := widget.(models.ContainerWidget); ok {
+			for _, child := range container.GetWidgets() {
+				collect(child)
+			}
+		}
+
+		feedWidget, ok := widget.(models.FeedWidget)
+		if !ok {
+			return
+		}
+
+		var category string
+		if titled, ok := widget.(models.TitledWidget); ok {
+			category = titled.GetTitle()
+		}
+
+		for _, feed := range feedWidget.GetFeeds() {
+			if _, exists := seen[feed.URL]; exists {
+				continue
+			}
+
+			seen[feed.URL] = struct{}{}
+			feeds = append(feeds, opml.Feed{Title: feed.Title, URL: feed.URL, Category: category})
+		}
+	}
+
+	for p := range config.Pages {
+		page := &config.Pages[p]
+		for _, widget := range page.HeadWidgets {
+			collect(widget)
+		}
+
+		for c := range page.Columns {
+			for _, widget := range page.Columns[c].Widgets {
+				collect(widget)
+			}
+		}
+	}
+
+	title := config.Branding.AppName
+	if title == "" {
+		title = "Glance"
+	}
+
+	if err := opml.Write(os.Stdout, title+" feeds", feeds); err != nil {
+		fmt.Printf("Could not write OPML: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
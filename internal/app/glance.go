@@ -2,25 +2,31 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"math"
 	mathrand "math/rand/v2"
 	"net/http"
+	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/limpdev/gander/internal/auth"
 	"github.com/limpdev/gander/internal/common"
 	"github.com/limpdev/gander/internal/models"
 	"github.com/limpdev/gander/internal/web"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -32,20 +38,53 @@ var (
 
 const STATIC_ASSETS_CACHE_DURATION = 24 * time.Hour
 
+// How long a widget has to be left alone after being refreshed before it can
+// be refreshed again, so that the button can't be used to hammer its sources
+const widgetRefreshCooldown = 10 * time.Second
+
 var reservedPageSlugs = []string{"login", "logout"}
 
 type Application struct {
-	Version                string
-	CreatedAt              time.Time
-	Config                 models.Config
+	Version   string
+	CreatedAt time.Time
+	Config    models.Config
+	// The main config file and what it resolved to when loaded, which is
+	// only known when running from one, and how to ask for it to be reloaded,
+	// which can only happen while its files are being watched
+	configPath             string
+	configContents         []byte
+	reloads                *reloadRequests
+	processWide            bool
 	parsedManifest         []byte
+	hostByName             map[string]*models.HostConfig
+	hostManifests          map[*models.HostConfig][]byte
+	assetVersions          map[string]string
 	slugToPage             map[string]*models.Page
 	widgetByID             map[uint64]models.Widget
+	pageByWidgetID         map[uint64]*models.Page
+	parentByWidgetID       map[uint64]models.Widget
+	webhookWidgetByName    map[string]models.WebhookWidget
+	widgetRefreshesMu      sync.Mutex
+	widgetRefreshes        map[uint64]time.Time
+	snapshotSlots          chan struct{}
+	snapshotLoginsMu       sync.Mutex
+	snapshotLogins         map[string]snapshotLogin
 	RequiresAuth           bool
 	authSecretKey          []byte
+	sessionLifetime        auth.SessionLifetime
+	state                  *stateStore
+	sessionsMu             sync.Mutex
+	sessions               sessionsState
+	userThemesMu           sync.Mutex
+	userThemes             userThemesState
+	userPreferencesMu      sync.Mutex
+	userPreferences        userPreferencesState
 	usernameHashToUsername map[string]string
-	authAttemptsMu         sync.Mutex
-	failedAuthAttempts     map[string]*auth.FailedAuthAttempt
+	loginAttemptsMu        sync.Mutex
+	loginLimiter           *auth.LoginLimiter
+	notificationTargets    []*notificationTarget
+	themeCoordinatesWidget models.Widget
+	cachedThemeCoordinates atomic.Pointer[[2]float64]
 }
 type doWhenUnauthorized int
 
@@ -55,18 +94,58 @@ const (
 )
 
 func NewApplication(c *models.Config) (*Application, error) {
+	return newApplication(c, true, "")
+}
+
+// Applications that aren't processWide leave what's shared by the whole
+// process, such as template overrides, to the one that is. Those with the same
+// stateScope share their state when it's kept in memory.
+func newApplication(c *models.Config, processWide bool, stateScope string) (*Application, error) {
 	app := &Application{
-		Version:    BuildVersion,
-		CreatedAt:  time.Now(),
-		Config:     *c,
-		slugToPage: make(map[string]*models.Page),
-		widgetByID: make(map[uint64]models.Widget),
+		processWide:         processWide,
+		Version:             BuildVersion,
+		CreatedAt:           time.Now(),
+		Config:              *c,
+		slugToPage:          make(map[string]*models.Page),
+		widgetByID:          make(map[uint64]models.Widget),
+		pageByWidgetID:      make(map[uint64]*models.Page),
+		parentByWidgetID:    make(map[uint64]models.Widget),
+		webhookWidgetByName: make(map[string]models.WebhookWidget),
+		widgetRefreshes:     make(map[uint64]time.Time),
+		snapshotSlots:       make(chan struct{}, maxConcurrentSnapshots),
+		snapshotLogins:      make(map[string]snapshotLogin),
 	}
 	config := &app.Config
+	state, err := newStateStore(config.Server.DataPath, stateScope)
+	if err != nil {
+		return nil, err
+	}
+	app.state = state
+	//
+	// Init template overrides
+	//
+	if processWide {
+		overridden, err := common.LoadTemplateOverrides(app.templateOverridesDir())
+		if err != nil {
+			return nil, fmt.Errorf("loading template overrides: %v", err)
+		}
+		if overridden > 0 {
+			slog.Info("Overriding templates", "count", overridden)
+		}
+	}
 	//
 	// Init auth
 	//
 	if len(config.Auth.Users) > 0 {
+		if err := app.loadSessionsState(); err != nil {
+			return nil, fmt.Errorf("loading sessions: %v", err)
+		}
+		if err := app.loadUserThemes(); err != nil {
+			return nil, fmt.Errorf("loading themes of users: %v", err)
+		}
+		if err := app.loadUserPreferences(); err != nil {
+			return nil, fmt.Errorf("loading preferences of users: %v", err)
+		}
 		secretBytes, err := base64.StdEncoding.DecodeString(config.Auth.SecretKey)
 		if err != nil {
 			return nil, fmt.Errorf("decoding secret-key: %v", err)
@@ -75,7 +154,9 @@ func NewApplication(c *models.Config) (*Application, error) {
 			return nil, fmt.Errorf("secret-key must be exactly %d bytes", auth.AUTH_SECRET_KEY_LENGTH)
 		}
 		app.usernameHashToUsername = make(map[string]string)
-		app.failedAuthAttempts = make(map[string]*auth.FailedAuthAttempt)
+		if err := app.loadLoginLimiter(); err != nil {
+			return nil, fmt.Errorf("loading failed login attempts: %v", err)
+		}
 		app.RequiresAuth = true
 		for username := range config.Auth.Users {
 			user := config.Auth.Users[username]
@@ -88,7 +169,7 @@ func NewApplication(c *models.Config) (*Application, error) {
 				user.PasswordHash = []byte(user.PasswordHashString)
 				user.PasswordHashString = ""
 			} else {
-				hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+				hashedPassword, err := auth.HashPassword([]byte(user.Password), config.Auth.PasswordHashing.Algo, config.Auth.PasswordHashing.Cost)
 				if err != nil {
 					return nil, fmt.Errorf("hashing password for user %s: %v", username, err)
 				}
@@ -97,11 +178,24 @@ func NewApplication(c *models.Config) (*Application, error) {
 			}
 		}
 		app.authSecretKey = secretBytes
+		app.sessionLifetime = auth.DefaultSessionLifetime
+		if config.Auth.SessionDuration > 0 {
+			app.sessionLifetime.Duration = time.Duration(config.Auth.SessionDuration)
+			// renew once half of the session has passed unless configured otherwise
+			app.sessionLifetime.RegenerateBefore = app.sessionLifetime.Duration / 2
+		}
+		if config.Auth.RenewSessionBefore > 0 {
+			app.sessionLifetime.RegenerateBefore = time.Duration(config.Auth.RenewSessionBefore)
+		}
+		app.sessionLifetime.IdleTimeout = time.Duration(config.Auth.IdleTimeout)
+		app.sessionLifetime.MaxDuration = time.Duration(config.Auth.MaxSessionDuration)
 	}
+	config.Server.BaseURL = strings.TrimRight(config.Server.BaseURL, "/")
 	//
 	// Init themes
 	//
-	if !config.Theme.DisablePicker {
+	// theme.auto defaults to the built-in presets even when they can't be picked
+	if !config.Theme.DisablePicker || config.Theme.Auto != nil {
 		themeKeys := make([]string, 0, 2)
 		themeProps := make([]*models.ThemeProperties, 0, 2)
 		defaultDarkTheme, ok := config.Theme.Presets.Get("default-dark")
@@ -125,21 +219,50 @@ func NewApplication(c *models.Config) (*Application, error) {
 		config.Theme.Presets = *themePresets.Merge(&config.Theme.Presets)
 		for key, properties := range config.Theme.Presets.Items() {
 			properties.Key = key
+			properties.BackgroundImage = app.resolveUserDefinedAssetPath(properties.BackgroundImage)
 			if err := properties.Initialize(); err != nil {
 				return nil, fmt.Errorf("initializing preset theme %s: %v", key, err)
 			}
 		}
 	}
 	config.Theme.Key = "default"
+	config.Theme.BackgroundImage = app.resolveUserDefinedAssetPath(config.Theme.BackgroundImage)
 	if err := config.Theme.Initialize(); err != nil {
 		return nil, fmt.Errorf("initializing default theme: %v", err)
 	}
+	if config.Theme.Auto != nil {
+		if err := config.Theme.Auto.Initialize(&config.Theme.ThemeProperties, &config.Theme.Presets); err != nil {
+			return nil, fmt.Errorf("initializing auto theme: %v", err)
+		}
+	}
 	//
 	// Init pages
 	//
 	app.slugToPage[""] = &config.Pages[0]
+	if processWide {
+		models.SetMaxConcurrentUpdates(common.Ternary(
+			config.Server.MaxConcurrentUpdates == 0,
+			models.DefaultMaxConcurrentUpdates,
+			config.Server.MaxConcurrentUpdates,
+		))
+	}
 	providers := &models.WidgetProviders{
-		AssetResolver: app.StaticAssetPath,
+		AssetResolver:         app.StaticAssetPath,
+		UpdateSchedule:        config.Server.UpdateSchedule,
+		DefaultProxy:          &config.Server.DefaultProxy,
+		MaxResponseSize:       config.Server.MaxResponseSize,
+		AllowPrivateAddresses: config.Server.AllowPrivateAddresses,
+		DataSources:           models.NewDataSources(config.DataSources),
+		RequiresAuth:          app.RequiresAuth,
+		State:                 app.state,
+	}
+	if len(config.Notifications) > 0 {
+		targets, err := newNotificationTargets(config.Notifications)
+		if err != nil {
+			return nil, err
+		}
+		app.notificationTargets = targets
+		providers.Notify = app.notify
 	}
 	for p := range config.Pages {
 		page := &config.Pages[p]
@@ -159,7 +282,7 @@ func NewApplication(c *models.Config) (*Application, error) {
 		}
 		for i := range page.HeadWidgets {
 			widget := page.HeadWidgets[i]
-			app.widgetByID[widget.GetID()] = widget
+			app.registerWidget(widget, page, nil)
 			widget.SetProviders(providers)
 		}
 		for c := range page.Columns {
@@ -169,13 +292,35 @@ func NewApplication(c *models.Config) (*Application, error) {
 			}
 			for w := range column.Widgets {
 				widget := column.Widgets[w]
-				app.widgetByID[widget.GetID()] = widget
+				app.registerWidget(widget, page, nil)
 				widget.SetProviders(providers)
 			}
 		}
 	}
-	config.Server.BaseURL = strings.TrimRight(config.Server.BaseURL, "/")
-	config.Theme.CustomCSSFile = app.resolveUserDefinedAssetPath(config.Theme.CustomCSSFile)
+	for _, id := range slices.Sorted(maps.Keys(app.widgetByID)) {
+		webhook, ok := app.widgetByID[id].(models.WebhookWidget)
+		if !ok {
+			continue
+		}
+		name := webhook.GetWebhookName()
+		if _, exists := app.webhookWidgetByName[name]; exists {
+			return nil, fmt.Errorf("webhook name \"%s\" is used by more than one widget", name)
+		}
+		app.webhookWidgetByName[name] = webhook
+	}
+	if config.Theme.Auto != nil && config.Theme.Auto.Mode == models.ThemeAutoModeSun {
+		app.themeCoordinatesWidget = findCoordinatesWidget(config.Pages)
+		if app.themeCoordinatesWidget == nil {
+			return nil, errors.New("theme auto mode sun requires a weather widget to know where the sun is")
+		}
+	}
+	if config.Theme.CustomCSSFile != "" {
+		config.Theme.CustomCSSFile = app.resolveUserDefinedAssetPath(config.Theme.CustomCSSFile)
+		// files hosted elsewhere can't be fingerprinted so they're refetched after every reload
+		if !strings.Contains(config.Theme.CustomCSSFile, "?v=") {
+			config.Theme.CustomCSSFile += "?v=" + strconv.FormatInt(app.CreatedAt.Unix(), 10)
+		}
+	}
 	config.Branding.LogoURL = app.resolveUserDefinedAssetPath(config.Branding.LogoURL)
 	config.Branding.FaviconURL = common.Ternary(
 		config.Branding.FaviconURL == "",
@@ -192,6 +337,8 @@ func NewApplication(c *models.Config) (*Application, error) {
 	}
 	if config.Branding.AppIconURL == "" {
 		config.Branding.AppIconURL = app.StaticAssetPath("app-icon.png")
+	} else {
+		config.Branding.AppIconURL = app.resolveUserDefinedAssetPath(config.Branding.AppIconURL)
 	}
 	if config.Branding.AppBackgroundColor == "" {
 		config.Branding.AppBackgroundColor = config.Theme.BackgroundColorAsHex
@@ -201,17 +348,57 @@ func NewApplication(c *models.Config) (*Application, error) {
 		return nil, fmt.Errorf("parsing manifest.json: %v", err)
 	}
 	app.parsedManifest = []byte(manifest)
+	if err := app.initHosts(); err != nil {
+		return nil, err
+	}
+	// the manifests of the hosts share the URL of the global one
+	allManifests := slices.Clone(app.parsedManifest)
+	for _, name := range slices.Sorted(maps.Keys(app.hostByName)) {
+		allManifests = append(allManifests, app.hostManifests[app.hostByName[name]]...)
+	}
+	app.assetVersions = map[string]string{"manifest.json": web.ContentHash(allManifests)}
 	return app, nil
 }
+func (a *Application) registerWidget(widget models.Widget, page *models.Page, parent models.Widget) {
+	a.widgetByID[widget.GetID()] = widget
+	a.pageByWidgetID[widget.GetID()] = page
+	if parent != nil {
+		a.parentByWidgetID[widget.GetID()] = parent
+	}
+	if container, ok := widget.(models.ContainerWidget); ok {
+		for _, child := range container.GetWidgets() {
+			a.registerWidget(child, page, widget)
+		}
+	}
+}
+
+// Files within the assets path get the hash of their contents appended so that
+// browsers only fetch them again once they've actually changed
 func (a *Application) resolveUserDefinedAssetPath(path string) string {
 	if strings.HasPrefix(path, "/assets/") {
-		return a.Config.Server.BaseURL + path
+		resolved := a.Config.Server.BaseURL + path
+		if contents, err := a.readUserDefinedAsset(path); err == nil {
+			resolved += "?v=" + web.ContentHash(contents)
+		}
+		return resolved
 	}
 	return path
 }
 
+func (a *Application) readUserDefinedAsset(path string) ([]byte, error) {
+	relative := filepath.FromSlash(strings.TrimPrefix(path, "/assets/"))
+	if a.Config.Server.AssetsPath == "" || !filepath.IsLocal(relative) {
+		return nil, fs.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(a.Config.Server.AssetsPath, relative))
+}
+
 type templateRequestData struct {
-	Theme *models.ThemeProperties
+	Theme       requestTheme
+	Username    string
+	Host        *models.HostConfig
+	CSPNonce    string
+	Preferences widgetPreferences
 }
 type templateData struct {
 	App     *Application
@@ -220,17 +407,9 @@ type templateData struct {
 }
 
 func (a *Application) populateTemplateRequestData(data *templateRequestData, r *http.Request) {
-	theme := &a.Config.Theme.ThemeProperties
-	if !a.Config.Theme.DisablePicker {
-		selectedTheme, err := r.Cookie("theme")
-		if err == nil {
-			preset, exists := a.Config.Theme.Presets.Get(selectedTheme.Value)
-			if exists {
-				theme = preset
-			}
-		}
-	}
-	data.Theme = theme
+	data.Theme = a.resolveTheme(a.selectedThemeKey(r, data.Username))
+	data.CSPNonce = cspNonceOfRequest(r)
+	data.Host = a.hostOfRequest(r)
 }
 func (a *Application) handlePageRequest(w http.ResponseWriter, r *http.Request) {
 	page, exists := a.slugToPage[r.PathValue("page")]
@@ -238,16 +417,28 @@ func (a *Application) handlePageRequest(w http.ResponseWriter, r *http.Request)
 		a.handleNotFound(w, r)
 		return
 	}
-	if a.handleUnauthorizedResponse(w, r, redirectToLogin) {
+	username, authorized := a.authenticatedUsername(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, redirectToLogin)
+		return
+	}
+	host := a.hostOfRequest(r)
+	if r.PathValue("page") == "" {
+		page = a.firstAccessiblePage(username, host)
+	}
+	if page == nil || !a.canAccessPage(username, page) || !isPageShownOnHost(host, page) {
+		a.handleNotFound(w, r)
 		return
 	}
 	data := templateData{
 		Page: page,
 		App:  a,
 	}
+	data.Request.Username = username
 	a.populateTemplateRequestData(&data.Request, r)
+	data.Request.Preferences = a.widgetPreferencesOfPage(r, username, page)
 	var responseBytes bytes.Buffer
-	err := pageTemplate.Execute(&responseBytes, data)
+	err := common.OverriddenTemplate(pageTemplate).Execute(&responseBytes, data)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
@@ -261,19 +452,29 @@ func (a *Application) handlePageContentRequest(w http.ResponseWriter, r *http.Re
 		a.handleNotFound(w, r)
 		return
 	}
-	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+	username, authorized := a.authenticatedUsername(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, showUnauthorizedJSON)
+		return
+	}
+	host := a.hostOfRequest(r)
+	if !a.canAccessPage(username, page) || !isPageShownOnHost(host, page) {
+		a.handleNotFound(w, r)
 		return
 	}
 	pageData := templateData{
-		Page: page,
+		App:     a,
+		Page:    page,
+		Request: templateRequestData{Username: username, Host: host},
 	}
 	var err error
 	var responseBytes bytes.Buffer
 	func() {
 		page.Mu.Lock()
 		defer page.Mu.Unlock()
-		page.UpdateOutdatedWidgets()
-		err = pageContentTemplate.Execute(&responseBytes, pageData)
+		// widgets get updated in the background, the ones that are outdated
+		// show their last known content until they're done
+		err = common.OverriddenTemplate(pageContentTemplate).Execute(&responseBytes, pageData)
 	}()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -311,38 +512,305 @@ func (a *Application) handleNotFound(w http.ResponseWriter, _ *http.Request) {
 	w.Write([]byte("Page not found"))
 }
 func (a *Application) handleWidgetRequest(w http.ResponseWriter, r *http.Request) {
-	// TODO: this requires a rework of the widget update logic so that rather
-	// than locking the entire page we lock individual widgets
-	w.WriteHeader(http.StatusNotImplemented)
-	// widgetValue := r.PathValue("widget")
-	// widgetID, err := strconv.ParseUint(widgetValue, 10, 64)
-	// if err != nil {
-	// a.handleNotFound(w, r)
-	// return
-	// }
-	// widget, exists := a.widgetByID[widgetID]
-	// if !exists {
-	// a.handleNotFound(w, r)
-	// return
-	// }
-	// widget.handleRequest(w, r)
+	widgetID, err := strconv.ParseUint(r.PathValue("widget"), 10, 64)
+	if err != nil {
+		a.handleNotFound(w, r)
+		return
+	}
+	widget, exists := a.widgetByID[widgetID]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+	username, authorized := a.authenticatedUsername(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, showUnauthorizedJSON)
+		return
+	}
+	if !a.canAccessWidget(username, widget) {
+		a.handleNotFound(w, r)
+		return
+	}
+	r = models.WithWidgetRequestUser(r, username, a.Config.Auth.Users[username])
+	if streaming, ok := widget.(models.StreamingWidget); ok && streaming.IsStreamingRequest(r) {
+		widget.HandleRequest(w, r)
+		return
+	}
+	models.HandleWidgetRequest(w, r, widget)
+}
+func (a *Application) handleWebhookRequest(w http.ResponseWriter, r *http.Request) {
+	widget, exists := a.webhookWidgetByName[r.PathValue("name")]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+	widget.HandleWebhook(w, r)
+}
+func (a *Application) handleWidgetRefreshRequest(w http.ResponseWriter, r *http.Request) {
+	widgetID, err := strconv.ParseUint(r.PathValue("widget"), 10, 64)
+	if err != nil {
+		a.handleNotFound(w, r)
+		return
+	}
+	widget, exists := a.widgetByID[widgetID]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+	username, authorized := a.authenticatedUsername(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, showUnauthorizedJSON)
+		return
+	}
+	if !a.canAccessWidget(username, widget) {
+		a.handleNotFound(w, r)
+		return
+	}
+	if refreshable, ok := widget.(models.RefreshableWidget); !ok || !refreshable.CanRefresh() {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if retryIn, allowed := a.claimWidgetRefresh(widgetID, time.Now()); !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryIn.Seconds())))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	// refreshes wait for a slot like any other update, nobody is left to
+	// respond to if the client goes away in the meantime
+	if err := models.UpdateWidgetWithinLimit(r.Context(), widget); err != nil {
+		return
+	}
+	a.writeRenderedWidget(w, widget)
+}
+
+// Refreshes are counted from when they were asked for rather than when they
+// finished, so that a slow widget can't be refreshed again while it updates
+func (a *Application) claimWidgetRefresh(widgetID uint64, now time.Time) (time.Duration, bool) {
+	a.widgetRefreshesMu.Lock()
+	defer a.widgetRefreshesMu.Unlock()
+
+	for id, refreshedAt := range a.widgetRefreshes {
+		if now.Sub(refreshedAt) >= widgetRefreshCooldown {
+			delete(a.widgetRefreshes, id)
+		}
+	}
+
+	if refreshedAt, exists := a.widgetRefreshes[widgetID]; exists {
+		return widgetRefreshCooldown - now.Sub(refreshedAt), false
+	}
+
+	a.widgetRefreshes[widgetID] = now
+	return 0, true
+}
+
+// Responds with the widget's current content without updating it, used to
+// replace widgets that were still updating when the page got loaded
+func (a *Application) handleWidgetContentRequest(w http.ResponseWriter, r *http.Request) {
+	widgetID, err := strconv.ParseUint(r.PathValue("widget"), 10, 64)
+	if err != nil {
+		a.handleNotFound(w, r)
+		return
+	}
+	widget, exists := a.widgetByID[widgetID]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+	username, authorized := a.authenticatedUsername(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, showUnauthorizedJSON)
+		return
+	}
+	if !a.canAccessWidget(username, widget) {
+		a.handleNotFound(w, r)
+		return
+	}
+	a.writeRenderedWidget(w, widget)
+}
+
+func (a *Application) writeRenderedWidget(w http.ResponseWriter, widget models.Widget) {
+	page := a.pageByWidgetID[widget.GetID()]
+	page.Mu.Lock()
+	defer page.Mu.Unlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(widget.Render()))
+}
+
+type widgetErrorResponse struct {
+	ID         uint64     `json:"id"`
+	Type       string     `json:"type"`
+	Page       string     `json:"page"`
+	Error      string     `json:"error,omitempty"`
+	Notice     string     `json:"notice,omitempty"`
+	LastUpdate *time.Time `json:"last_update"`
+}
+
+func (a *Application) handleWidgetErrorsRequest(w http.ResponseWriter, r *http.Request) {
+	username, authorized := a.authenticatedUsername(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, showUnauthorizedJSON)
+		return
+	}
+	failing := make([]widgetErrorResponse, 0)
+	var collect func(widget models.Widget, page *models.Page)
+	collect = func(widget models.Widget, page *models.Page) {
+		if !a.canAccessWidget(username, widget) {
+			return
+		}
+		if container, ok := widget.(models.ContainerWidget); ok {
+			for _, child := range container.GetWidgets() {
+				collect(child, page)
+			}
+		}
+		// waits for widgets that are updating to be done
+		if locked, ok := widget.(models.LockedWidget); ok {
+			lock := locked.GetUpdateLock()
+			lock.RLock()
+			defer lock.RUnlock()
+		}
+		status, ok := widget.(models.WidgetStatusReporter)
+		if !ok || (status.GetError() == nil && status.GetNotice() == nil) {
+			return
+		}
+		entry := widgetErrorResponse{
+			ID:   widget.GetID(),
+			Type: widget.GetType(),
+			Page: page.Slug,
+		}
+		if err := status.GetError(); err != nil {
+			entry.Error = err.Error()
+		}
+		if notice := status.GetNotice(); notice != nil {
+			entry.Notice = notice.Error()
+		}
+		if lastUpdate := status.GetLastUpdate(); !lastUpdate.IsZero() {
+			entry.LastUpdate = &lastUpdate
+		}
+		failing = append(failing, entry)
+	}
+	for p := range a.Config.Pages {
+		page := &a.Config.Pages[p]
+		// the page is only locked while getting its widgets, so that waiting on
+		// one that's updating doesn't hold up the rendering of the page
+		page.Mu.Lock()
+		widgets := slices.Clone(page.HeadWidgets)
+		for c := range page.Columns {
+			widgets = append(widgets, page.Columns[c].Widgets...)
+		}
+		page.Mu.Unlock()
+		for _, widget := range widgets {
+			collect(widget, page)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(failing)
 }
 func (a *Application) StaticAssetPath(asset string) string {
 	return a.Config.Server.BaseURL + "/static/" + web.StaticFSHash + "/" + asset
 }
 func (a *Application) VersionedAssetPath(asset string) string {
-	return a.Config.Server.BaseURL + asset +
-		"?v=" + strconv.FormatInt(a.CreatedAt.Unix(), 10)
+	version, exists := a.assetVersions[asset]
+	if !exists {
+		version = strconv.FormatInt(a.CreatedAt.Unix(), 10)
+	}
+	return a.Config.Server.BaseURL + "/" + asset + "?v=" + version
+}
+
+// Requests made through a fingerprinted URL can be cached forever since the
+// URL changes along with the contents
+func versionedCacheControl(r *http.Request, unversionedDuration time.Duration) string {
+	if r.URL.Query().Has("v") {
+		return common.ImmutableCacheControl
+	}
+	return common.CacheControlForDuration(unversionedDuration)
 }
+
 func (a *Application) server() (func() error, func() error) {
+	server := http.Server{
+		Addr:    fmt.Sprintf("%s:%d", a.Config.Server.Host, a.Config.Server.Port),
+		Handler: a.handler(),
+	}
+	start := func() error {
+		listener, err := a.listen(server.Addr)
+		if err != nil {
+			return err
+		}
+		// widgets only get updated for as long as the server is running
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		a.runInBackground(ctx)
+		slog.Info("Starting server",
+			"address", listener.Addr().String(),
+			"base-url", a.Config.Server.BaseURL,
+			"assets-path", a.absAssetsPath(),
+		)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	}
+	stop := func() error {
+		return server.Close()
+	}
+	return start, stop
+}
+
+// Keeps the widgets up to date and watches the template overrides until the
+// context is done
+func (a *Application) runInBackground(ctx context.Context) {
+	a.updateWidgetsInBackground(ctx)
+	if a.processWide {
+		a.watchTemplateOverrides(ctx)
+	}
+}
+
+func (a *Application) absAssetsPath() string {
+	if a.Config.Server.AssetsPath == "" {
+		return ""
+	}
+	absAssetsPath, _ := filepath.Abs(a.Config.Server.AssetsPath)
+	return absAssetsPath
+}
+
+func (a *Application) handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /{$}", a.handlePageRequest)
 	mux.HandleFunc("GET /{page}", a.handlePageRequest)
 	mux.HandleFunc("GET /api/pages/{page}/content/{$}", a.handlePageContentRequest)
-	if !a.Config.Theme.DisablePicker {
+	mux.HandleFunc("GET /api/pages/{page}", a.handlePageAPIRequest)
+	mux.HandleFunc("PUT /api/pages/{page}/preferences", a.handlePagePreferencesRequest)
+	// changing the config is never left open to anyone
+	if a.RequiresAuth {
+		mux.HandleFunc("POST /api/pages/{page}/layout", a.adminOnly(a.handlePageLayoutRequest))
+		mux.HandleFunc("POST /api/reload", a.adminOnly(a.handleReloadRequest))
+	}
+	if !a.Config.Theme.DisablePicker || a.Config.Theme.Auto != nil {
 		mux.HandleFunc("POST /api/set-theme/{key}", a.handleThemeChangeRequest)
 	}
+	if !a.Config.Theme.DisablePicker {
+		mux.HandleFunc("POST /api/theme/preview", a.handleThemePreviewRequest)
+	}
+	mux.HandleFunc("GET /api/widgets/errors", a.adminOnly(a.handleWidgetErrorsRequest))
+	mux.HandleFunc("GET /api/diagnostics/widgets", a.adminOnly(a.handleWidgetDiagnosticsRequest))
+	mux.HandleFunc("POST /api/widgets/{widget}/refresh", a.handleWidgetRefreshRequest)
+	mux.HandleFunc("GET /api/widgets/{widget}/content", a.handleWidgetContentRequest)
 	mux.HandleFunc("/api/widgets/{widget}/{path...}", a.handleWidgetRequest)
+	// webhooks are called by scripts rather than logged in users, the widget
+	// that receives them checks their token instead
+	if len(a.webhookWidgetByName) > 0 {
+		mux.HandleFunc("POST /api/webhooks/{name}", a.handleWebhookRequest)
+	}
+	// snapshots can also be requested by scripts holding their token, which
+	// the handler checks when there's no session
+	if a.Config.Server.Snapshots.Enabled {
+		mux.HandleFunc("GET /api/pages/{page}/snapshot.png", a.handlePageSnapshotRequest)
+		if a.RequiresAuth {
+			mux.HandleFunc("GET "+snapshotLoginPath, a.handleSnapshotLoginRequest)
+		}
+	}
+	if a.Config.Server.IconProxy.Enabled {
+		mux.HandleFunc("GET "+iconProxyPath, a.handleIconProxyRequest)
+	}
 	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
@@ -350,54 +818,37 @@ func (a *Application) server() (func() error, func() error) {
 		mux.HandleFunc("GET /login", a.handleLoginPageRequest)
 		mux.HandleFunc("GET /logout", a.handleLogoutRequest)
 		mux.HandleFunc("POST /api/authenticate", a.handleAuthenticationAttempt)
+		mux.HandleFunc("POST /api/sessions/revoke", a.handleRevokeOwnSessionsRequest)
+		mux.HandleFunc("POST /api/users/{user}/sessions/revoke", a.adminOnly(a.handleRevokeUserSessionsRequest))
 	}
+	// the hash of all static files is part of their path, so it changes along
+	// with any of them
 	mux.Handle(
 		fmt.Sprintf("GET /static/%s/{path...}", web.StaticFSHash),
 		http.StripPrefix(
 			"/static/"+web.StaticFSHash,
-			common.FileServerWithCache(http.FS(web.StaticFS), STATIC_ASSETS_CACHE_DURATION),
+			common.FileServerWithCache(http.FS(web.StaticFS), func(*http.Request) string {
+				return common.ImmutableCacheControl
+			}),
 		),
 	)
-	assetCacheControlValue := fmt.Sprintf(
-		"public, max-age=%d",
-		int(STATIC_ASSETS_CACHE_DURATION.Seconds()),
-	)
 	mux.HandleFunc(fmt.Sprintf("GET /static/%s/css/bundle.css", web.StaticFSHash), func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Cache-Control", assetCacheControlValue)
+		w.Header().Add("Cache-Control", common.ImmutableCacheControl)
 		w.Header().Add("Content-Type", "text/css; charset=utf-8")
 		w.Write(web.BundledCSSContents)
 	})
 	mux.HandleFunc("GET /manifest.json", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Cache-Control", assetCacheControlValue)
+		w.Header().Add("Cache-Control", versionedCacheControl(r, STATIC_ASSETS_CACHE_DURATION))
 		w.Header().Add("Content-Type", "application/json")
-		w.Write(a.parsedManifest)
+		w.Write(a.manifestOfRequest(r))
 	})
-	var absAssetsPath string
 	if a.Config.Server.AssetsPath != "" {
-		absAssetsPath, _ = filepath.Abs(a.Config.Server.AssetsPath)
-		assetsFS := common.FileServerWithCache(http.Dir(a.Config.Server.AssetsPath), 2*time.Hour)
+		assetsFS := common.FileServerWithCache(http.Dir(a.Config.Server.AssetsPath), func(r *http.Request) string {
+			return versionedCacheControl(r, 2*time.Hour)
+		})
 		mux.Handle("/assets/{path...}", http.StripPrefix("/assets/", assetsFS))
 	}
-	server := http.Server{
-		Addr:    fmt.Sprintf("%s:%d", a.Config.Server.Host, a.Config.Server.Port),
-		Handler: mux,
-	}
-	start := func() error {
-		log.Printf("Starting server on %s:%d (base-url: \"%s\", assets-path: \"%s\")\n",
-			a.Config.Server.Host,
-			a.Config.Server.Port,
-			a.Config.Server.BaseURL,
-			absAssetsPath,
-		)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			return err
-		}
-		return nil
-	}
-	stop := func() error {
-		return server.Close()
-	}
-	return start, stop
+	return a.logRequests(a.setSecurityHeaders(a.compressResponses(mux)))
 }
 
 // Auth methods moved from auth package
@@ -414,38 +865,6 @@ func (a *Application) handleAuthenticationAttempt(w http.ResponseWriter, r *http
 	// r is now a pointer, so this works correctly
 	ip := a.addressOfRequest(r)
 
-	a.authAttemptsMu.Lock()
-	exceededRateLimit, retryAfter := func() (bool, int) {
-		attempt, exists := a.failedAuthAttempts[ip]
-		if !exists {
-			a.failedAuthAttempts[ip] = &auth.FailedAuthAttempt{
-				Attempts: 1,
-				First:    time.Now(),
-			}
-			return false, 0
-		}
-		elapsed := time.Since(attempt.First)
-		if elapsed < auth.AUTH_RATE_LIMIT_WINDOW && attempt.Attempts >= auth.AUTH_RATE_LIMIT_MAX_ATTEMPTS {
-			return true, max(1, int(auth.AUTH_RATE_LIMIT_WINDOW.Seconds()-elapsed.Seconds()))
-		}
-		attempt.Attempts++
-		return false, 0
-	}()
-	if exceededRateLimit {
-		a.authAttemptsMu.Unlock()
-		time.Sleep(waitOnFailure)
-		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
-		w.WriteHeader(http.StatusTooManyRequests)
-		return
-	} else {
-		// Clean up old failed attempts
-		for ipOfAttempt := range a.failedAuthAttempts {
-			if time.Since(a.failedAuthAttempts[ipOfAttempt].First) > auth.AUTH_RATE_LIMIT_WINDOW {
-				delete(a.failedAuthAttempts, ipOfAttempt)
-			}
-		}
-		a.authAttemptsMu.Unlock()
-	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -461,79 +880,99 @@ func (a *Application) handleAuthenticationAttempt(w http.ResponseWriter, r *http
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	logAuthFailure := func() {
-		log.Printf(
-			"Failed login attempt for user '%s' from %s",
-			creds.Username, ip,
-		)
+	// usernames that don't exist only count towards the limit of the IP so
+	// that they can't be used to fill up the state with junk
+	limiterKeys := []string{auth.IPLimiterKey(ip)}
+	u, exists := a.Config.Auth.Users[creds.Username]
+	if exists {
+		limiterKeys = append(limiterKeys, auth.UserLimiterKey(creds.Username))
 	}
-	if len(creds.Username) == 0 || len(creds.Password) == 0 {
+	if lockedOutFor, lockedOut := a.loginLimiter.LockedOutFor(time.Now(), limiterKeys...); lockedOut {
 		time.Sleep(waitOnFailure)
-		w.WriteHeader(http.StatusUnauthorized)
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(lockedOutFor.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
 		return
 	}
-	if len(creds.Username) > 50 || len(creds.Password) > 100 {
-		logAuthFailure()
+	authFailed := func(logFailure bool) {
+		if logFailure {
+			slog.Warn("Failed login attempt", "user", creds.Username, "ip", ip)
+		}
+		a.audit(r, auditEventLoginFailure, creds.Username, nil)
+		a.notifyLockouts(a.loginLimiter.RecordFailure(time.Now(), limiterKeys...))
+		a.saveLoginAttempts()
 		time.Sleep(waitOnFailure)
 		w.WriteHeader(http.StatusUnauthorized)
+	}
+	if len(creds.Username) == 0 || len(creds.Password) == 0 {
+		authFailed(false)
 		return
 	}
-	u, exists := a.Config.Auth.Users[creds.Username]
-	if !exists {
-		logAuthFailure()
-		time.Sleep(waitOnFailure)
-		w.WriteHeader(http.StatusUnauthorized)
+	if len(creds.Username) > 50 || len(creds.Password) > 100 || !exists {
+		authFailed(true)
 		return
 	}
-	if err := bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(creds.Password)); err != nil {
-		logAuthFailure()
-		time.Sleep(waitOnFailure)
-		w.WriteHeader(http.StatusUnauthorized)
+	if err := auth.VerifyPassword(u.PasswordHash, []byte(creds.Password)); err != nil {
+		if !errors.Is(err, auth.ErrPasswordMismatch) {
+			slog.Error("Could not verify password", "user", creds.Username, "error", err)
+		}
+		authFailed(true)
 		return
 	}
-	token, err := auth.GenerateSessionToken(creds.Username, a.authSecretKey, time.Now())
+	now := time.Now()
+	token, err := a.sessionLifetime.GenerateToken(creds.Username, a.authSecretKey, now, now, a.sessionGeneration(creds.Username))
 	if err != nil {
-		log.Printf("Could not compute session token during login attempt: %v", err)
+		slog.Error("Could not compute session token during login attempt", "error", err)
 		time.Sleep(waitOnFailure)
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	a.setAuthSessionCookie(w, r, token, time.Now().Add(auth.AUTH_TOKEN_VALID_PERIOD))
-	a.authAttemptsMu.Lock()
-	delete(a.failedAuthAttempts, ip)
-	a.authAttemptsMu.Unlock()
+	a.setAuthSessionCookie(w, r, token, a.sessionLifetime.Expiry(now, now))
+	a.loginLimiter.RecordSuccess(limiterKeys...)
+	a.saveLoginAttempts()
+	a.audit(r, auditEventLoginSuccess, creds.Username, nil)
 	w.WriteHeader(http.StatusOK)
 }
 
 func (a *Application) isAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	_, authorized := a.authenticatedUsername(w, r)
+	return authorized
+}
+
+// Returns the username of the user the request was made by, which is empty
+// when authentication isn't enabled
+func (a *Application) authenticatedUsername(w http.ResponseWriter, r *http.Request) (string, bool) {
 	if !a.RequiresAuth {
-		return true
+		return "", true
 	}
 	token, err := r.Cookie(auth.AUTH_SESSION_COOKIE_NAME)
 	if err != nil || token.Value == "" {
-		return false
+		return "", false
 	}
-	usernameHash, shouldRegenerate, err := auth.VerifySessionToken(token.Value, a.authSecretKey, time.Now())
+	now := time.Now()
+	session, shouldRegenerate, err := a.sessionLifetime.VerifyToken(token.Value, a.authSecretKey, now)
 	if err != nil {
-		return false
+		return "", false
 	}
-	username, exists := a.usernameHashToUsername[string(usernameHash)]
+	username, exists := a.usernameHashToUsername[string(session.UsernameHash)]
 	if !exists {
-		return false
+		return "", false
 	}
 	_, exists = a.Config.Auth.Users[username]
 	if !exists {
-		return false
+		return "", false
+	}
+	if session.Generation != a.sessionGeneration(username) {
+		return "", false
 	}
 	if shouldRegenerate {
-		newToken, err := auth.GenerateSessionToken(username, a.authSecretKey, time.Now())
+		newToken, err := a.sessionLifetime.GenerateToken(username, a.authSecretKey, now, session.LoggedInAt, session.Generation)
 		if err != nil {
-			log.Printf("Could not compute session token during regeneration: %v", err)
-			return false
+			slog.Error("Could not compute session token during regeneration", "error", err)
+			return "", false
 		}
-		a.setAuthSessionCookie(w, r, newToken, time.Now().Add(auth.AUTH_TOKEN_VALID_PERIOD))
+		a.setAuthSessionCookie(w, r, newToken, a.sessionLifetime.Expiry(now, session.LoggedInAt))
 	}
-	return true
+	return username, true
 }
 
 // Handles sending the appropriate response for an unauthorized request and returns true if the request was unauthorized
@@ -541,6 +980,11 @@ func (a *Application) handleUnauthorizedResponse(w http.ResponseWriter, r *http.
 	if a.isAuthorized(w, r) {
 		return false
 	}
+	a.respondUnauthorized(w, r, fallback)
+	return true
+}
+
+func (a *Application) respondUnauthorized(w http.ResponseWriter, r *http.Request, fallback doWhenUnauthorized) {
 	switch fallback {
 	case redirectToLogin:
 		http.Redirect(w, r, a.Config.Server.BaseURL+"/login", http.StatusSeeOther)
@@ -549,12 +993,14 @@ func (a *Application) handleUnauthorizedResponse(w http.ResponseWriter, r *http.
 		// CORRECTION: Added backticks/quotes to make this a valid string literal
 		w.Write([]byte(`{"error": "Unauthorized"}`))
 	}
-	return true
 }
 
 // Maybe this should be a POST request instead?
 // CORRECTION: r must be *http.Request
 func (a *Application) handleLogoutRequest(w http.ResponseWriter, r *http.Request) {
+	if username, authorized := a.authenticatedUsername(w, r); authorized {
+		a.audit(r, auditEventLogout, username, nil)
+	}
 	// CORRECTION: Added * operator (-1 * time.Hour)
 	a.setAuthSessionCookie(w, r, "", time.Now().Add(-1*time.Hour))
 	http.Redirect(w, r, a.Config.Server.BaseURL+"/login", http.StatusSeeOther)
@@ -582,7 +1028,7 @@ func (a *Application) handleLoginPageRequest(w http.ResponseWriter, r *http.Requ
 	}
 	a.populateTemplateRequestData(&data.Request, r)
 	var responseBytes bytes.Buffer
-	err := loginPageTemplate.Execute(&responseBytes, data)
+	err := common.OverriddenTemplate(loginPageTemplate).Execute(&responseBytes, data)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
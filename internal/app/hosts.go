@@ -0,0 +1,123 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+)
+
+// Fills in the branding of the hosts from the global one and renders a manifest
+// for each since the app name and icon can differ
+func (a *Application) initHosts() error {
+	config := &a.Config
+	a.hostByName = make(map[string]*models.HostConfig, len(config.Server.Hosts))
+	a.hostManifests = make(map[*models.HostConfig][]byte, len(config.Server.Hosts))
+
+	for name, host := range config.Server.Hosts {
+		if host == nil {
+			host = &models.HostConfig{}
+			config.Server.Hosts[name] = host
+		}
+
+		a.resolveHostBranding(&host.Branding)
+
+		manifest, err := common.ExecuteTemplateToString(
+			manifestTemplate,
+			templateData{App: a, Request: templateRequestData{Host: host}},
+		)
+		if err != nil {
+			return fmt.Errorf("parsing manifest.json of host %s: %v", name, err)
+		}
+
+		a.hostManifests[host] = []byte(manifest)
+		a.hostByName[strings.ToLower(name)] = host
+	}
+
+	return nil
+}
+
+func (a *Application) resolveHostBranding(branding *models.BrandingConfig) {
+	global := &a.Config.Branding
+
+	fill := func(value *string, globalValue string) {
+		if *value == "" {
+			*value = globalValue
+		} else {
+			*value = a.resolveUserDefinedAssetPath(*value)
+		}
+	}
+
+	// the logo is either an image or text, so it's taken as a whole
+	if branding.LogoURL == "" && branding.LogoText == "" {
+		branding.LogoURL, branding.LogoText = global.LogoURL, global.LogoText
+	} else {
+		branding.LogoURL = a.resolveUserDefinedAssetPath(branding.LogoURL)
+	}
+	fill(&branding.FaviconURL, global.FaviconURL)
+	fill(&branding.AppIconURL, global.AppIconURL)
+	branding.FaviconType = common.Ternary(
+		strings.HasSuffix(branding.FaviconURL, ".svg"),
+		"image/svg+xml",
+		"image/png",
+	)
+
+	if branding.CustomFooter == "" {
+		branding.CustomFooter = global.CustomFooter
+	}
+	if branding.AppName == "" {
+		branding.AppName = global.AppName
+	}
+	if branding.AppBackgroundColor == "" {
+		branding.AppBackgroundColor = global.AppBackgroundColor
+	}
+	branding.HideFooter = branding.HideFooter || global.HideFooter
+}
+
+// Matched using the Host header, or X-Forwarded-Host when behind a reverse
+// proxy, nil if the request wasn't made through any of the hosts
+func (a *Application) hostOfRequest(r *http.Request) *models.HostConfig {
+	if len(a.hostByName) == 0 {
+		return nil
+	}
+
+	host := r.Host
+	if a.Config.Server.Proxied {
+		if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+			host, _, _ = strings.Cut(forwarded, ",")
+			host = strings.TrimSpace(host)
+		}
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	return a.hostByName[strings.ToLower(host)]
+}
+
+// Hosts without pages of their own show all of them
+func isPageShownOnHost(host *models.HostConfig, page *models.Page) bool {
+	return host == nil || len(host.Pages) == 0 || slices.Contains(host.Pages, page.Slug)
+}
+
+func (a *Application) manifestOfRequest(r *http.Request) []byte {
+	if host := a.hostOfRequest(r); host != nil {
+		return a.hostManifests[host]
+	}
+
+	return a.parsedManifest
+}
+
+// Called from templates in place of the global branding so that requests made
+// through one of the hosts get its branding instead
+func (d templateData) Branding() *models.BrandingConfig {
+	if d.Request.Host != nil {
+		return &d.Request.Host.Branding
+	}
+
+	return &d.App.Config.Branding
+}
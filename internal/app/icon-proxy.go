@@ -0,0 +1,392 @@
+package app
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/limpdev/gander/internal/web"
+)
+
+const (
+	iconProxyPath           = "/proxy/icon"
+	iconProxyTimeout        = 10 * time.Second
+	defaultIconCacheTTL     = 7 * 24 * time.Hour
+	defaultMaxIconImageSize = 1024 // kilobytes
+	defaultMaxIconCacheSize = 100  // megabytes
+)
+
+// The cache is kept across config reloads as long as its location and size
+// stay the same. URLs are signed so that the proxy can only be used to load
+// the images that the server itself linked to, the key changing with every
+// restart only means that browsers load them through the new URLs once.
+var (
+	iconProxyMu            sync.Mutex
+	iconProxyCache         *iconCache
+	iconProxyCacheSettings iconCacheSettings
+	iconProxyAllowPrivate  bool
+	iconProxyKey           = func() []byte {
+		key := make([]byte, 32)
+		rand.Read(key)
+		return key
+	}()
+)
+
+type iconCacheSettings struct {
+	dir     string
+	maxSize int64
+}
+
+func configureIconProxy(config *models.Config) error {
+	iconProxyMu.Lock()
+	defer iconProxyMu.Unlock()
+
+	if !config.Server.IconProxy.Enabled {
+		web.SetImageProxy(nil)
+		iconProxyCache = nil
+		iconProxyCacheSettings = iconCacheSettings{}
+		return nil
+	}
+
+	settings := iconCacheSettings{
+		maxSize: int64(common.Ternary(config.Server.IconProxy.MaxCacheSize > 0, config.Server.IconProxy.MaxCacheSize, defaultMaxIconCacheSize)) * 1024 * 1024,
+	}
+
+	if config.Server.DataPath != "" {
+		settings.dir = filepath.Join(config.Server.DataPath, "icons")
+		if err := os.MkdirAll(settings.dir, 0o700); err != nil {
+			return fmt.Errorf("creating icon cache directory: %v", err)
+		}
+	}
+
+	if iconProxyCache == nil || settings != iconProxyCacheSettings {
+		iconProxyCache = newIconCache(settings.dir, settings.maxSize)
+		iconProxyCacheSettings = settings
+	}
+	iconProxyAllowPrivate = config.Server.AllowPrivateAddresses
+
+	baseURL := strings.TrimRight(config.Server.BaseURL, "/")
+	web.SetImageProxy(func(rawURL string) string {
+		return baseURL + iconProxyPath + "?url=" + url.QueryEscape(rawURL) + "&sig=" + signIconURL(rawURL)
+	})
+
+	return nil
+}
+
+func signIconURL(rawURL string) string {
+	mac := hmac.New(sha256.New, iconProxyKey)
+	mac.Write([]byte(rawURL))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (a *Application) handleIconProxyRequest(w http.ResponseWriter, r *http.Request) {
+	rawURL := r.URL.Query().Get("url")
+	if !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(signIconURL(rawURL))) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	iconProxyMu.Lock()
+	cache, allowPrivate := iconProxyCache, iconProxyAllowPrivate
+	iconProxyMu.Unlock()
+
+	if cache == nil {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	config := &a.Config.Server.IconProxy
+	ttl := common.Ternary(config.CacheTTL > 0, time.Duration(config.CacheTTL), defaultIconCacheTTL)
+	maxImageSize := int64(common.Ternary(config.MaxImageSize > 0, config.MaxImageSize, defaultMaxIconImageSize)) * 1024
+
+	icon, fresh := cache.get(rawURL, ttl)
+	if !fresh {
+		fetched, err := fetchIcon(rawURL, maxImageSize, allowPrivate)
+		if err == nil {
+			cache.put(rawURL, fetched)
+			icon = fetched
+		} else if icon == nil {
+			slog.Debug("Could not fetch icon", "url", rawURL, "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		} else {
+			// an outdated icon is better than none when the source can't be reached
+			slog.Debug("Could not refresh icon, serving cached copy", "url", rawURL, "error", err)
+		}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", icon.contentType)
+	header.Set("Cache-Control", common.CacheControlForDuration(ttl))
+	header.Set("X-Content-Type-Options", "nosniff")
+	// SVGs can contain scripts, which shouldn't run if the image gets opened directly
+	header.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Write(icon.body)
+}
+
+func fetchIcon(rawURL string, maxSize int64, allowPrivate bool) (*cachedIcon, error) {
+	request, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", fetch.UserAgent)
+
+	// thumbnails come from feeds, which can link to anything
+	client := fetch.NewClient(iconProxyTimeout, false)
+	if !allowPrivate {
+		client = fetch.WithoutPrivateAddresses(client)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	if response.ContentLength > maxSize {
+		return nil, fmt.Errorf("image is larger than %d bytes", maxSize)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("image is larger than %d bytes", maxSize)
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("content type %q is not an image", contentType)
+	}
+
+	return &cachedIcon{contentType: contentType, body: body, fetchedAt: time.Now()}, nil
+}
+
+type cachedIcon struct {
+	contentType string
+	// Nil for icons that were saved to the cache directory before a restart
+	// and haven't been loaded from it since
+	body      []byte
+	size      int64
+	fetchedAt time.Time
+}
+
+// Icons are kept up to maxSize bytes, dropping the ones fetched the longest ago
+// first. When dir is set they're also written to it, with the content type on
+// the first line, so that they survive restarts. The icons in it count towards
+// the same limit and get deleted along with the ones in memory.
+type iconCache struct {
+	mu      sync.Mutex
+	dir     string
+	maxSize int64
+	size    int64
+	icons   map[string]*cachedIcon
+}
+
+func newIconCache(dir string, maxSize int64) *iconCache {
+	c := &iconCache{
+		dir:     dir,
+		maxSize: maxSize,
+		icons:   make(map[string]*cachedIcon),
+	}
+
+	if dir == "" {
+		return c
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Warn("Could not read icon cache directory", "error", err)
+		return c
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		// left behind by a write that didn't finish
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			c.removeFromDisk(entry.Name())
+			continue
+		}
+
+		c.icons[entry.Name()] = &cachedIcon{size: info.Size(), fetchedAt: info.ModTime()}
+		c.size += info.Size()
+	}
+
+	c.evict(0)
+
+	return c
+}
+
+func iconCacheKey(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(sum[:])
+}
+
+// Also returns outdated icons, fresh is only true if it's younger than ttl
+func (c *iconCache) get(rawURL string, ttl time.Duration) (icon *cachedIcon, fresh bool) {
+	key := iconCacheKey(rawURL)
+
+	c.mu.Lock()
+	icon = c.icons[key]
+	c.mu.Unlock()
+
+	if icon != nil && icon.body == nil {
+		loaded := c.readFromDisk(key)
+
+		c.mu.Lock()
+		// unless it got replaced while being read
+		if c.icons[key] == icon {
+			if loaded == nil {
+				c.remove(key)
+			} else {
+				c.add(key, loaded)
+			}
+		}
+		c.mu.Unlock()
+
+		icon = loaded
+	}
+
+	if icon == nil {
+		return nil, false
+	}
+
+	return icon, time.Since(icon.fetchedAt) < ttl
+}
+
+func (c *iconCache) put(rawURL string, icon *cachedIcon) {
+	key := iconCacheKey(rawURL)
+	icon.size = int64(len(icon.body))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.add(key, icon) || c.dir == "" {
+		return
+	}
+
+	// written while holding the lock so that the icon can't get evicted, and
+	// its file deleted, before the file exists
+	contents := append([]byte(icon.contentType+"\n"), icon.body...)
+	path := filepath.Join(c.dir, key)
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, contents, 0o600); err != nil {
+		slog.Warn("Could not write icon to cache", "error", err)
+		return
+	}
+
+	if err := os.Rename(temporaryPath, path); err != nil {
+		slog.Warn("Could not write icon to cache", "error", err)
+	}
+}
+
+func (c *iconCache) readFromDisk(key string) *cachedIcon {
+	path := filepath.Join(c.dir, key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	contentType, body, found := bytes.Cut(contents, []byte("\n"))
+	if !found {
+		c.removeFromDisk(key)
+		return nil
+	}
+
+	return &cachedIcon{contentType: string(contentType), body: body, size: info.Size(), fetchedAt: info.ModTime()}
+}
+
+func (c *iconCache) removeFromDisk(name string) {
+	if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Could not remove cached icon", "error", err)
+	}
+}
+
+// Must be called with the lock held. Returns false when the icon is too large
+// to be cached, in which case any previous version of it is removed.
+func (c *iconCache) add(key string, icon *cachedIcon) bool {
+	if previous, exists := c.icons[key]; exists {
+		c.size -= previous.size
+		delete(c.icons, key)
+	}
+
+	if icon.size > c.maxSize {
+		if c.dir != "" {
+			c.removeFromDisk(key)
+		}
+		return false
+	}
+
+	c.evict(icon.size)
+	c.icons[key] = icon
+	c.size += icon.size
+
+	return true
+}
+
+// Must be called with the lock held. Removes the icons fetched the longest ago
+// until there's room for the given number of bytes.
+func (c *iconCache) evict(room int64) {
+	for c.size+room > c.maxSize && len(c.icons) > 0 {
+		var oldestKey string
+		var oldest *cachedIcon
+		for key, icon := range c.icons {
+			if oldest == nil || icon.fetchedAt.Before(oldest.fetchedAt) {
+				oldestKey, oldest = key, icon
+			}
+		}
+		c.remove(oldestKey)
+	}
+}
+
+// Must be called with the lock held
+func (c *iconCache) remove(key string) {
+	icon, exists := c.icons[key]
+	if !exists {
+		return
+	}
+
+	c.size -= icon.size
+	delete(c.icons, key)
+
+	if c.dir != "" {
+		c.removeFromDisk(key)
+	}
+}
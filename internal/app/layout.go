@@ -0,0 +1,146 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
+)
+
+const maxLayoutBodySize = 64 * 1024
+
+// Requests are handled by whichever application is current, which changes
+// once the written config gets reloaded, so this is shared between them
+var layoutMu sync.Mutex
+
+// The widgets of each column of a page in the order they should be in,
+// identified by their IDs
+type layoutRequest struct {
+	Columns [][]uint64 `json:"columns"`
+}
+
+type layoutResponse struct {
+	Diff    string `json:"diff"`
+	Applied bool   `json:"applied"`
+}
+
+// Rearranges the widgets of a page by moving them around within the config
+// files they're defined in, after which the config gets reloaded as it would
+// when edited by hand. With dry-run only the diff of the changes is returned.
+func (a *Application) handlePageLayoutRequest(w http.ResponseWriter, r *http.Request) {
+	page, exists := a.slugToPage[r.PathValue("page")]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if a.configPath == "" {
+		http.Error(w, "the config can't be changed while running this way", http.StatusNotImplemented)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLayoutBodySize))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	var received layoutRequest
+	if err := json.Unmarshal(body, &received); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	current, desired, err := layoutSourceLines(page, received.Columns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	layoutMu.Lock()
+	defer layoutMu.Unlock()
+
+	changes, err := loader.RearrangeWidgets(a.configPath, a.configContents, current, desired)
+	if errors.Is(err, loader.ErrConfigChanged) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	response := layoutResponse{Diff: loader.UnifiedDiff(a.configPath, changes)}
+
+	if r.URL.Query().Get("dry-run") != "true" && len(changes) > 0 {
+		for _, change := range changes {
+			if err := change.Write(); err != nil {
+				slog.Error("Could not write config file", "path", change.Path, "error", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		username, _ := a.authenticatedUsername(w, r)
+		a.audit(r, auditEventLayoutChanged, username, map[string]any{"page": page.Slug})
+		response.Applied = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Translates the IDs of the widgets to the lines of the config they start on,
+// every widget of the columns of the page having to be placed exactly once
+func layoutSourceLines(page *models.Page, columns [][]uint64) ([][]int, [][]int, error) {
+	if len(columns) != len(page.Columns) {
+		return nil, nil, errors.New("the number of columns doesn't match the page")
+	}
+
+	lineOfID := make(map[uint64]int)
+	current := make([][]int, len(page.Columns))
+
+	for c := range page.Columns {
+		current[c] = make([]int, 0, len(page.Columns[c].Widgets))
+
+		for _, widget := range page.Columns[c].Widgets {
+			located, ok := widget.(models.LocatedWidget)
+			if !ok || located.GetSourceLine() == 0 {
+				return nil, nil, errors.New("the widgets of the page can't be located within the config")
+			}
+
+			lineOfID[widget.GetID()] = located.GetSourceLine()
+			current[c] = append(current[c], located.GetSourceLine())
+		}
+	}
+
+	placed := make(map[uint64]bool)
+	desired := make([][]int, len(columns))
+
+	for c := range columns {
+		desired[c] = make([]int, 0, len(columns[c]))
+
+		for _, id := range columns[c] {
+			line, exists := lineOfID[id]
+			if !exists || placed[id] {
+				return nil, nil, errors.New("widgets can only be placed once within the page they're on")
+			}
+
+			placed[id] = true
+			desired[c] = append(desired[c], line)
+		}
+	}
+
+	if len(placed) != len(lineOfID) {
+		return nil, nil, errors.New("all of the widgets of the page have to be placed")
+	}
+
+	return current, desired, nil
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/limpdev/gander/internal/logfile"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var (
+	loggerMu          sync.Mutex
+	loggerFile        *logfile.RotatingFile
+	loggerDestination string
+)
+
+// Replaces the default logger, which everything logs through including code
+// that still uses the log package, with one that has the configured level,
+// format and destination
+func configureLogger(config *models.Config) error {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+
+	options := &slog.HandlerOptions{}
+	if config.Server.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(config.Server.LogLevel)); err != nil {
+			return err
+		}
+		options.Level = level
+	}
+
+	file, previousFile := loggerFile, (*logfile.RotatingFile)(nil)
+	if config.Server.LogFile != loggerDestination {
+		file, previousFile = nil, loggerFile
+		if config.Server.LogFile != "" {
+			var err error
+			if file, err = logfile.Open(config.Server.LogFile, 0, 0); err != nil {
+				return fmt.Errorf("opening log file: %v", err)
+			}
+		}
+	}
+
+	var output io.Writer = os.Stderr
+	if file != nil {
+		output = file
+	}
+
+	var handler slog.Handler
+	if config.Server.LogFormat == models.LogFormatJSON {
+		handler = slog.NewJSONHandler(output, options)
+	} else {
+		handler = slog.NewTextHandler(output, options)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	// only closed once nothing logs to it anymore
+	if previousFile != nil {
+		previousFile.Close()
+	}
+	loggerFile = file
+	loggerDestination = config.Server.LogFile
+
+	return nil
+}
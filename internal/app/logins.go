@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/auth"
+	"github.com/limpdev/gander/internal/fetch"
+)
+
+const loginAttemptsStateName = "login-attempts"
+
+var lockoutWebhookClient = fetch.NewClient(10*time.Second, false)
+
+// Failed login attempts are persisted so that restarting the server or
+// reloading the config doesn't hand out a fresh set of attempts
+func (a *Application) loadLoginLimiter() error {
+	limits := auth.DefaultLoginLimits
+	config := &a.Config.Auth.RateLimit
+
+	if config.Window > 0 {
+		limits.Window = time.Duration(config.Window)
+	}
+	if config.MaxAttemptsPerIP > 0 {
+		limits.MaxAttemptsPerIP = config.MaxAttemptsPerIP
+	}
+	if config.MaxAttemptsPerUser > 0 {
+		limits.MaxAttemptsPerUser = config.MaxAttemptsPerUser
+	}
+	if config.Lockout > 0 {
+		limits.Lockout = time.Duration(config.Lockout)
+	}
+	if config.MaxLockout > 0 {
+		limits.MaxLockout = time.Duration(config.MaxLockout)
+	}
+
+	var attempts map[string]*auth.FailedAuthAttempts
+	if err := a.state.load(loginAttemptsStateName, &attempts); err != nil {
+		return err
+	}
+
+	a.loginLimiter = auth.NewLoginLimiter(limits, attempts)
+	return nil
+}
+
+func (a *Application) saveLoginAttempts() {
+	a.loginAttemptsMu.Lock()
+	defer a.loginAttemptsMu.Unlock()
+
+	if err := a.state.save(loginAttemptsStateName, a.loginLimiter.Snapshot()); err != nil {
+		slog.Error("Could not save failed login attempts", "error", err)
+	}
+}
+
+func (a *Application) notifyLockouts(lockouts []auth.Lockout) {
+	for _, lockout := range lockouts {
+		kind, value, _ := strings.Cut(lockout.Key, ":")
+		slog.Warn(
+			"Locked out after too many failed login attempts",
+			kind, value, "attempts", lockout.Attempts, "until", lockout.Until.Format(time.RFC3339),
+		)
+
+		event := auditEvent{
+			Event: auditEventLoginLockout,
+			Fields: map[string]any{
+				"attempts": lockout.Attempts,
+				"until":    lockout.Until.UTC(),
+			},
+		}
+		if kind == "user" {
+			event.User = value
+		} else {
+			event.IP = value
+		}
+		writeAuditEvent(event)
+
+		if a.Config.Auth.RateLimit.Webhook != "" {
+			go a.sendLockoutWebhook(kind, value, lockout)
+		}
+	}
+}
+
+func (a *Application) sendLockoutWebhook(kind, value string, lockout auth.Lockout) {
+	body, err := json.Marshal(map[string]any{
+		"event":    "login-lockout",
+		"type":     kind,
+		"value":    value,
+		"attempts": lockout.Attempts,
+		"until":    lockout.Until.Format(time.RFC3339),
+	})
+	if err != nil {
+		return
+	}
+
+	request, err := http.NewRequest("POST", a.Config.Auth.RateLimit.Webhook, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Could not send lockout webhook", "error", err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := lockoutWebhookClient.Do(request)
+	if err != nil {
+		slog.Error("Could not send lockout webhook", "error", err)
+		return
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		slog.Error("Lockout webhook responded with unexpected status code", "status", response.StatusCode)
+	}
+}
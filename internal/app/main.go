@@ -1,16 +1,20 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 
 	"github.com/limpdev/gander/internal/auth"
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
 	"github.com/limpdev/gander/internal/web"
-	"golang.org/x/crypto/bcrypt"
+	_ "github.com/limpdev/gander/internal/widgets"
 )
 
 var BuildVersion = "LIMP"
@@ -21,6 +25,9 @@ func Main() int {
 		fmt.Println(err)
 		return 1
 	}
+	loader.SetActiveProfiles(options.Profile)
+	loader.SetConfigTemplating(options.Template)
+	loader.SetAllowedExecCommands(options.AllowExec)
 	switch options.Intent {
 	case IntentVersionPrint:
 		fmt.Println(BuildVersion)
@@ -34,27 +41,63 @@ func Main() int {
 			return 1
 		}
 	case IntentConfigValidate:
-		contents, _, err := loader.ParseYAMLIncludes(options.ConfigPath)
+		contents, _, sourceMap, err := loader.ParseYAMLIncludes(options.ConfigPath)
 		if err != nil {
 			fmt.Printf("Could not parse config file: %v\n", err)
 			return 1
 		}
+		// unknown properties are checked first since a typo is often the
+		// reason for the errors that would otherwise get reported
+		if options.Strict {
+			resolved, err := loader.ParseConfigVariables(contents)
+			if err == nil {
+				err = loader.CheckUnknownConfigKeys(resolved)
+			}
+			if err != nil {
+				fmt.Printf("Config file is invalid: %v\n", sourceMap.TranslateError(err))
+				return 1
+			}
+		}
 		if _, err := loader.NewConfigFromYAML(contents); err != nil {
-			fmt.Printf("Config file is invalid: %v\n", err)
+			fmt.Printf("Config file is invalid: %v\n", sourceMap.TranslateError(err))
 			return 1
 		}
 	case IntentConfigPrint:
-		contents, _, err := loader.ParseYAMLIncludes(options.ConfigPath)
+		contents, _, _, err := loader.ParseYAMLIncludes(options.ConfigPath)
 		if err != nil {
 			fmt.Printf("Could not parse config file: %v\n", err)
 			return 1
 		}
+		contents, err = loader.PrepareConfigForPrint(contents, options.ResolveVars, options.RedactSecrets)
+		if err != nil {
+			fmt.Printf("Could not prepare config file for printing: %v\n", err)
+			return 1
+		}
 		fmt.Println(string(contents))
+	case IntentConfigImport:
+		contents, err := os.ReadFile(options.Args[1])
+		if err != nil {
+			fmt.Printf("Could not read file: %v\n", err)
+			return 1
+		}
+		converted, err := loader.ImportConfig(options.ImportFrom, contents)
+		if err != nil {
+			fmt.Printf("Could not import config: %v\n", err)
+			return 1
+		}
+		fmt.Print(string(converted))
+	case IntentFeedsImportOPML:
+		return cliImportOPML(options.Args[1])
+	case IntentFeedsExportOPML:
+		return cliExportOPML(options.ConfigPath)
 	case IntentSensorsPrint:
 		return int(CliSensorsPrint())
 	case IntentMountpointInfo:
 		return CliMountpointInfo(options.Args[1])
 	case IntentDiagnose:
+		if options.DiagnoseWidgets {
+			return runWidgetDiagnostic(options.ConfigPath)
+		}
 		runDiagnostic()
 		return 0
 	case IntentSecretMake:
@@ -74,7 +117,9 @@ func Main() int {
 			fmt.Println("Password must be at least 6 characters long")
 			return 1
 		}
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		algo := common.Ternary(options.HashAlgo == "", auth.PasswordHashAlgoBcrypt, options.HashAlgo)
+		cost := common.Ternary(options.HashCost == 0, auth.DefaultPasswordHashCost(algo), options.HashCost)
+		hashedPassword, err := auth.HashPassword([]byte(password), algo, cost)
 		if err != nil {
 			fmt.Printf("Failed to hash password: %v\n", err)
 			return 1
@@ -83,69 +128,119 @@ func Main() int {
 	}
 	return 0
 }
+
+// Sets up the parts of the config that apply to the whole process rather than
+// to a single application
+func configureProcess(config *models.Config) error {
+	var errs []error
+	if err := configureLogger(config); err != nil {
+		errs = append(errs, fmt.Errorf("logging: %w", err))
+	}
+	if err := configureAuditLog(config.Server.AuditLog); err != nil {
+		errs = append(errs, fmt.Errorf("audit log: %w", err))
+	}
+	if err := configureAccessLog(&config.Server.AccessLog); err != nil {
+		errs = append(errs, fmt.Errorf("access log: %w", err))
+	}
+	if err := configureIconProxy(config); err != nil {
+		errs = append(errs, fmt.Errorf("icon proxy: %w", err))
+	}
+	if policy, err := fetch.NewHostPolicy(config.Server.AllowedHosts, config.Server.BlockedHosts); err != nil {
+		errs = append(errs, fmt.Errorf("hosts: %w", err))
+	} else {
+		fetch.SetHostPolicy(policy)
+	}
+	return errors.Join(errs...)
+}
+
 func serveApp(configPath string) error {
+	if info, err := os.Stat(configPath); err == nil && info.IsDir() {
+		return serveDashboards(configPath)
+	}
 	// TODO: refactor if this gets any more complex, the current implementation is
 	// difficult to reason about due to all of the callbacks and simultaneous operations,
 	// use a single goroutine and a channel to initiate synchronous changes to the server
 	exitChannel := make(chan struct{})
 	hadValidConfigOnStartup := false
 	var stopServer func() error
-	onChange := func(newContents []byte) {
+	var previousConfig *models.Config
+	reloads := newReloadRequests()
+	onChange := func(newContents []byte, sourceMap *loader.SourceMap) {
 		if stopServer != nil {
-			log.Println("Config file changed, reloading...")
+			slog.Info("Config file changed, reloading...")
 		}
-		config, err := loader.NewConfigFromYAML(newContents)
+		config, err := reloads.parse(newContents)
 		if err != nil {
-			log.Printf("Config has errors: %v", err)
+			err = sourceMap.TranslateError(err)
+			slog.Error("Config has errors", "error", err)
+			writeAuditEvent(auditEvent{Event: auditEventConfigFailed, Fields: map[string]any{"error": err.Error()}})
 			if !hadValidConfigOnStartup {
 				close(exitChannel)
 			}
 			return
 		}
+		if err := configureProcess(config); err != nil {
+			slog.Error("Failed to set up", "error", err)
+		}
+		if previousConfig != nil {
+			if reused := carryOverUnchangedWidgets(previousConfig, config); reused > 0 {
+				slog.Info("Kept the state of unchanged widgets", "count", reused)
+			}
+		}
 		app, err := NewApplication(config)
 		if err != nil {
-			log.Printf("Failed to create application: %v", err)
+			slog.Error("Failed to create application", "error", err)
 			if !hadValidConfigOnStartup {
 				close(exitChannel)
 			}
 			return
 		}
+		app.configPath, app.configContents = configPath, newContents
+		app.reloads = reloads
+		writeAuditEvent(auditEvent{Event: common.Ternary(hadValidConfigOnStartup, auditEventConfigReloaded, auditEventConfigLoaded)})
 		if !hadValidConfigOnStartup {
 			hadValidConfigOnStartup = true
 		}
+		previousConfig = &app.Config
 		if stopServer != nil {
 			if err := stopServer(); err != nil {
-				log.Printf("Error while trying to stop server: %v", err)
+				slog.Error("Error while trying to stop server", "error", err)
 			}
 		}
 		go func() {
 			var startServer func() error
 			startServer, stopServer = app.server()
 			if err := startServer(); err != nil {
-				log.Printf("Failed to start server: %v", err)
+				slog.Error("Failed to start server", "error", err)
 			}
 		}()
 	}
 	onErr := func(err error) {
-		log.Printf("Error watching config files: %v", err)
+		slog.Error("Error watching config files", "error", err)
 	}
-	configContents, configIncludes, err := loader.ParseYAMLIncludes(configPath)
+	configContents, configIncludes, configSourceMap, err := loader.ParseYAMLIncludes(configPath)
 	if err != nil {
 		return fmt.Errorf("parsing config: %w", err)
 	}
-	stopWatching, err := loader.ConfigFilesWatcher(configPath, configContents, configIncludes, onChange, onErr)
+	stopWatching, err := loader.ConfigFilesWatcher(configPath, configContents, configSourceMap, configIncludes, onChange, onErr, reloads.ch)
 	if err == nil {
 		defer stopWatching()
+		defer reloadOnSIGHUP(reloads)()
 	} else {
-		log.Printf("Error starting file watcher, config file changes will require a manual restart. (%v)", err)
+		slog.Warn("Error starting file watcher, config file changes will require a manual restart", "error", err)
 		config, err := loader.NewConfigFromYAML(configContents)
 		if err != nil {
-			return fmt.Errorf("validating config file: %w", err)
+			return fmt.Errorf("validating config file: %w", configSourceMap.TranslateError(err))
+		}
+		if err := configureProcess(config); err != nil {
+			return err
 		}
+		writeAuditEvent(auditEvent{Event: auditEventConfigLoaded})
 		app, err := NewApplication(config)
 		if err != nil {
 			return fmt.Errorf("creating application: %w", err)
 		}
+		app.configPath, app.configContents = configPath, configContents
 		startServer, _ := app.server()
 		if err := startServer(); err != nil {
 			return fmt.Errorf("starting server: %w", err)
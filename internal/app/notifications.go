@@ -0,0 +1,196 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var notificationClient = fetch.NewClient(10*time.Second, false)
+
+type notificationTarget struct {
+	config  *models.NotificationConfig
+	title   *template.Template
+	message *template.Template
+	body    *template.Template
+}
+
+func newNotificationTargets(configs []models.NotificationConfig) ([]*notificationTarget, error) {
+	targets := make([]*notificationTarget, 0, len(configs))
+
+	parse := func(name, text, fallback string) (*template.Template, error) {
+		if text == "" {
+			text = fallback
+		}
+		return template.New(name).Parse(text)
+	}
+
+	for i := range configs {
+		config := &configs[i]
+		target := &notificationTarget{config: config}
+
+		var err error
+		if target.title, err = parse("title", config.Title, "{{ .Title }}"); err != nil {
+			return nil, fmt.Errorf("notification %d: parsing title template: %v", i+1, err)
+		}
+		if target.message, err = parse("message", config.Message, "{{ .Message }}"); err != nil {
+			return nil, fmt.Errorf("notification %d: parsing message template: %v", i+1, err)
+		}
+		if config.Body != "" {
+			if target.body, err = template.New("body").Parse(config.Body); err != nil {
+				return nil, fmt.Errorf("notification %d: parsing body template: %v", i+1, err)
+			}
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+func (t *notificationTarget) wants(event *models.WidgetEvent) bool {
+	if len(t.config.Events) > 0 && !slices.Contains(t.config.Events, event.Type) {
+		return false
+	}
+
+	return len(t.config.WidgetTypes) == 0 || slices.Contains(t.config.WidgetTypes, event.WidgetType)
+}
+
+// Gets called by widgets while they're updating, so sending happens in the
+// background
+func (a *Application) notify(event models.WidgetEvent) {
+	for _, target := range a.notificationTargets {
+		if target.wants(&event) {
+			go target.send(event)
+		}
+	}
+}
+
+func (t *notificationTarget) send(event models.WidgetEvent) {
+	request, err := t.request(&event)
+	if err != nil {
+		slog.Error("Could not create notification", "type", t.config.Type, "event", event.Type, "error", err)
+		return
+	}
+
+	for name, value := range t.config.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := notificationClient.Do(request)
+	if err != nil {
+		slog.Error("Could not send notification", "type", t.config.Type, "event", event.Type, "error", err)
+		return
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		slog.Error("Notification was rejected", "type", t.config.Type, "event", event.Type, "status", response.StatusCode)
+	}
+}
+
+func (t *notificationTarget) request(event *models.WidgetEvent) (*http.Request, error) {
+	execute := func(tmpl *template.Template) (string, error) {
+		var buffer bytes.Buffer
+		err := tmpl.Execute(&buffer, event)
+		return buffer.String(), err
+	}
+
+	title, err := execute(t.title)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := execute(t.message)
+	if err != nil {
+		return nil, err
+	}
+
+	postJSON := func(url string, payload any) (*http.Request, error) {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		return request, nil
+	}
+
+	switch t.config.Type {
+	case models.NotificationTypeNtfy:
+		// https://docs.ntfy.sh/publish/
+		request, err := http.NewRequest(http.MethodPost, t.config.URL, strings.NewReader(message))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Title", title)
+		if event.URL != "" {
+			request.Header.Set("Click", event.URL)
+		}
+		if t.config.Token != "" {
+			request.Header.Set("Authorization", "Bearer "+t.config.Token)
+		}
+		return request, nil
+
+	case models.NotificationTypeGotify:
+		// https://gotify.net/api-docs#/message/createMessage
+		payload := map[string]any{"title": title, "message": message}
+		if event.URL != "" {
+			payload["extras"] = map[string]any{
+				"client::notification": map[string]any{"click": map[string]string{"url": event.URL}},
+			}
+		}
+		request, err := postJSON(strings.TrimRight(t.config.URL, "/")+"/message", payload)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("X-Gotify-Key", t.config.Token)
+		return request, nil
+
+	case models.NotificationTypeDiscord:
+		// https://discord.com/developers/docs/resources/webhook#execute-webhook
+		return postJSON(t.config.URL, map[string]any{
+			"embeds": []map[string]string{{"title": title, "description": message, "url": event.URL}},
+		})
+
+	case models.NotificationTypeSlack:
+		// https://api.slack.com/messaging/webhooks
+		text := "*" + title + "*"
+		if event.URL != "" {
+			text = "*<" + event.URL + "|" + title + ">*"
+		}
+		return postJSON(t.config.URL, map[string]string{"text": text + "\n" + message})
+	}
+
+	if t.body == nil {
+		return postJSON(t.config.URL, struct {
+			*models.WidgetEvent
+			Title   string `json:"title"`
+			Message string `json:"message"`
+		}{event, title, message})
+	}
+
+	body, err := execute(t.body)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, t.config.URL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return request, nil
+}
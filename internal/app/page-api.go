@@ -0,0 +1,155 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/limpdev/gander/internal/models"
+)
+
+// The structure of a page and the state of its widgets, for frontends other
+// than the web one that don't want to parse HTML
+type pageResponse struct {
+	Title       string               `json:"title"`
+	Slug        string               `json:"slug"`
+	HeadWidgets []widgetResponse     `json:"head_widgets"`
+	Columns     []pageColumnResponse `json:"columns"`
+}
+
+type pageColumnResponse struct {
+	Size    string           `json:"size"`
+	Name    string           `json:"name,omitempty"`
+	Widgets []widgetResponse `json:"widgets"`
+}
+
+type widgetResponse struct {
+	ID         uint64           `json:"id"`
+	Type       string           `json:"type"`
+	Title      string           `json:"title,omitempty"`
+	TitleURL   string           `json:"title_url,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Notice     string           `json:"notice,omitempty"`
+	LastUpdate *time.Time       `json:"last_update,omitempty"`
+	Updating   bool             `json:"updating,omitempty"`
+	Data       json.RawMessage  `json:"data,omitempty"`
+	Widgets    []widgetResponse `json:"widgets,omitempty"`
+}
+
+func (a *Application) handlePageAPIRequest(w http.ResponseWriter, r *http.Request) {
+	page, exists := a.slugToPage[r.PathValue("page")]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+	username, authorized := a.authenticatedUsername(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, showUnauthorizedJSON)
+		return
+	}
+	if !a.canAccessPage(username, page) {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	response := pageResponse{
+		Title:       page.Title,
+		Slug:        page.Slug,
+		HeadWidgets: make([]widgetResponse, 0, len(page.HeadWidgets)),
+		Columns:     make([]pageColumnResponse, 0, len(page.Columns)),
+	}
+
+	func() {
+		page.Mu.Lock()
+		defer page.Mu.Unlock()
+
+		response.HeadWidgets = a.widgetResponses(username, page.HeadWidgets)
+		for c := range page.Columns {
+			column := &page.Columns[c]
+			response.Columns = append(response.Columns, pageColumnResponse{
+				Size:    column.Size,
+				Name:    column.Name,
+				Widgets: a.widgetResponses(username, column.Widgets),
+			})
+		}
+	}()
+
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(encoded)
+}
+
+// Leaves out the widgets that the user can't access
+func (a *Application) widgetResponses(username string, widgets models.Widgets) []widgetResponse {
+	responses := make([]widgetResponse, 0, len(widgets))
+
+	for _, widget := range widgets {
+		if !a.canAccessWidget(username, widget) {
+			continue
+		}
+
+		responses = append(responses, a.widgetResponse(username, widget))
+	}
+
+	return responses
+}
+
+// The state of widgets that are in the middle of updating is left out since
+// it could be incomplete
+func (a *Application) widgetResponse(username string, widget models.Widget) widgetResponse {
+	response := widgetResponse{
+		ID:   widget.GetID(),
+		Type: widget.GetType(),
+	}
+
+	if container, ok := widget.(models.ContainerWidget); ok {
+		response.Widgets = a.widgetResponses(username, container.GetWidgets())
+	}
+
+	if locked, ok := widget.(models.LockedWidget); ok {
+		lock := locked.GetUpdateLock()
+		if !lock.TryRLock() {
+			response.Updating = true
+			return response
+		}
+		defer lock.RUnlock()
+	}
+
+	// some widgets get their title from what they fetch
+	if titled, ok := widget.(models.TitledWidget); ok {
+		response.Title = titled.GetTitle()
+		response.TitleURL = titled.GetTitleURL()
+	}
+
+	if status, ok := widget.(models.WidgetStatusReporter); ok {
+		if err := status.GetError(); err != nil {
+			response.Error = err.Error()
+		}
+		if notice := status.GetNotice(); notice != nil {
+			response.Notice = notice.Error()
+		}
+		if lastUpdate := status.GetLastUpdate(); !lastUpdate.IsZero() {
+			response.LastUpdate = &lastUpdate
+		}
+	}
+
+	if exporting, ok := widget.(models.DataExportingWidget); ok {
+		// encoded while locked since the data can share memory with the widget
+		data, err := exporting.MarshalData()
+		if err == nil {
+			response.Data, err = json.Marshal(data)
+		}
+		if err != nil {
+			slog.Warn("Could not export widget data", "widget", widget.GetID(), "type", widget.GetType(), "error", err)
+		}
+	}
+
+	return response
+}
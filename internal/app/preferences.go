@@ -0,0 +1,266 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/limpdev/gander/internal/models"
+)
+
+const (
+	userPreferencesStateName = "user-preferences"
+	preferencesCookieName    = "preferences"
+	maxPreferencesBodySize   = 16 * 1024
+	// browsers drop cookies that are larger than 4KB
+	maxPreferencesCookieSize = 3500
+)
+
+// What users have changed about a page, such as which widgets they've
+// collapsed or hidden and which tabs of groups they've switched to. Widgets
+// are identified by their position within the page, so the preferences carry
+// over across restarts and config reloads as long as widgets aren't moved.
+type pagePreferences struct {
+	Collapsed []string       `json:"collapsed,omitempty"`
+	Hidden    []string       `json:"hidden,omitempty"`
+	Tabs      map[string]int `json:"tabs,omitempty"`
+}
+
+func (p *pagePreferences) isEmpty() bool {
+	return len(p.Collapsed) == 0 && len(p.Hidden) == 0 && len(p.Tabs) == 0
+}
+
+// Keyed by the slug of the page
+type preferences map[string]*pagePreferences
+
+// Preferences of logged in users are kept on the server so that they follow
+// them across devices, everyone else gets them stored in a cookie
+type userPreferencesState struct {
+	Users map[string]preferences `json:"users"`
+}
+
+// The preferences of a page as they're sent to and from the browser, which
+// identifies widgets by their IDs
+type widgetPreferences struct {
+	Collapsed []uint64       `json:"collapsed"`
+	Hidden    []uint64       `json:"hidden"`
+	Tabs      map[uint64]int `json:"tabs"`
+}
+
+func (a *Application) loadUserPreferences() error {
+	a.userPreferences.Users = make(map[string]preferences)
+	return a.state.load(userPreferencesStateName, &a.userPreferences)
+}
+
+// Widgets of the head are keyed as head-{index}, the ones within columns as
+// {column}-{index} and the ones within other widgets get the index within
+// their parent appended to its key, as in 1-2.0
+func preferenceKeysOfWidgets(page *models.Page) map[uint64]string {
+	keys := make(map[uint64]string)
+
+	var collect func(widgets models.Widgets, prefix string)
+	collect = func(widgets models.Widgets, prefix string) {
+		for i, widget := range widgets {
+			key := prefix + strconv.Itoa(i)
+			keys[widget.GetID()] = key
+			if container, ok := widget.(models.ContainerWidget); ok {
+				collect(container.GetWidgets(), key+".")
+			}
+		}
+	}
+
+	collect(page.HeadWidgets, "head-")
+	for c := range page.Columns {
+		collect(page.Columns[c].Widgets, strconv.Itoa(c)+"-")
+	}
+
+	return keys
+}
+
+func (a *Application) preferencesOfRequest(r *http.Request, username string) preferences {
+	if username != "" {
+		a.userPreferencesMu.Lock()
+		defer a.userPreferencesMu.Unlock()
+		return maps.Clone(a.userPreferences.Users[username])
+	}
+
+	prefs := make(preferences)
+	cookie, err := r.Cookie(preferencesCookieName)
+	if err != nil {
+		return prefs
+	}
+	contents, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return prefs
+	}
+	// a cookie that's been tampered with is no different from not having one
+	if err := json.Unmarshal(contents, &prefs); err != nil {
+		return make(preferences)
+	}
+	return prefs
+}
+
+// Translates the preferences of the page so that the browser can apply them
+func (a *Application) widgetPreferencesOfPage(r *http.Request, username string, page *models.Page) widgetPreferences {
+	result := widgetPreferences{
+		Collapsed: []uint64{},
+		Hidden:    []uint64{},
+		Tabs:      make(map[uint64]int),
+	}
+
+	pagePrefs := a.preferencesOfRequest(r, username)[page.Slug]
+	if pagePrefs == nil {
+		return result
+	}
+
+	ids := make(map[string]uint64)
+	for id, key := range preferenceKeysOfWidgets(page) {
+		ids[key] = id
+	}
+
+	for _, key := range pagePrefs.Collapsed {
+		if id, ok := ids[key]; ok {
+			result.Collapsed = append(result.Collapsed, id)
+		}
+	}
+	for _, key := range pagePrefs.Hidden {
+		if id, ok := ids[key]; ok {
+			result.Hidden = append(result.Hidden, id)
+		}
+	}
+	for key, tab := range pagePrefs.Tabs {
+		if id, ok := ids[key]; ok {
+			result.Tabs[id] = tab
+		}
+	}
+
+	return result
+}
+
+func (a *Application) handlePagePreferencesRequest(w http.ResponseWriter, r *http.Request) {
+	page, exists := a.slugToPage[r.PathValue("page")]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+	username, authorized := a.authenticatedUsername(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, showUnauthorizedJSON)
+		return
+	}
+	if !a.canAccessPage(username, page) {
+		a.handleNotFound(w, r)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPreferencesBodySize))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	var received widgetPreferences
+	if err := json.Unmarshal(body, &received); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// anything that isn't on the page gets dropped rather than kept around
+	keys := preferenceKeysOfWidgets(page)
+	pagePrefs := &pagePreferences{}
+	for _, id := range received.Collapsed {
+		if key, ok := keys[id]; ok {
+			pagePrefs.Collapsed = append(pagePrefs.Collapsed, key)
+		}
+	}
+	for _, id := range received.Hidden {
+		if key, ok := keys[id]; ok {
+			pagePrefs.Hidden = append(pagePrefs.Hidden, key)
+		}
+	}
+	for id, tab := range received.Tabs {
+		key, ok := keys[id]
+		if !ok || tab <= 0 {
+			continue
+		}
+		if container, ok := a.widgetByID[id].(models.ContainerWidget); ok && tab < len(container.GetWidgets()) {
+			if pagePrefs.Tabs == nil {
+				pagePrefs.Tabs = make(map[string]int)
+			}
+			pagePrefs.Tabs[key] = tab
+		}
+	}
+
+	if username != "" {
+		if err := a.saveUserPagePreferences(username, page.Slug, pagePrefs); err != nil {
+			slog.Error("Could not save preferences of user", "user", username, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	prefs := a.preferencesOfRequest(r, "")
+	setPagePreferences(prefs, page.Slug, pagePrefs)
+	// preferences of pages that no longer exist would otherwise take up space forever
+	for slug := range prefs {
+		if _, exists := a.slugToPage[slug]; !exists {
+			delete(prefs, slug)
+		}
+	}
+	contents, err := json.Marshal(prefs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	value := base64.RawURLEncoding.EncodeToString(contents)
+	if len(value) > maxPreferencesCookieSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     preferencesCookieName,
+		Value:    value,
+		Path:     a.Config.Server.BaseURL + "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+		Expires:  time.Now().Add(2 * 365 * 24 * time.Hour),
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *Application) saveUserPagePreferences(username, slug string, pagePrefs *pagePreferences) error {
+	a.userPreferencesMu.Lock()
+	defer a.userPreferencesMu.Unlock()
+
+	// the state may have been changed by the application of a previous config
+	if err := a.state.load(userPreferencesStateName, &a.userPreferences); err != nil {
+		return err
+	}
+
+	prefs := a.userPreferences.Users[username]
+	if prefs == nil {
+		prefs = make(preferences)
+		a.userPreferences.Users[username] = prefs
+	}
+	setPagePreferences(prefs, slug, pagePrefs)
+
+	return a.state.save(userPreferencesStateName, &a.userPreferences)
+}
+
+func setPagePreferences(prefs preferences, slug string, pagePrefs *pagePreferences) {
+	if pagePrefs.isEmpty() {
+		delete(prefs, slug)
+	} else {
+		prefs[slug] = pagePrefs
+	}
+}
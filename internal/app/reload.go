@@ -0,0 +1,238 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
+)
+
+// Reloads of a config that get requested while another one is pending are
+// merged into it, so requesting one never blocks
+type reloadRequests struct {
+	ch chan struct{}
+
+	// A config that was already parsed when its reload got requested, which
+	// gets used rather than parsing it again as long as the files haven't
+	// changed since, so that exec variables and secrets aren't resolved twice
+	mu             sync.Mutex
+	parsedContents []byte
+	parsedConfig   *models.Config
+}
+
+func newReloadRequests() *reloadRequests {
+	return &reloadRequests{ch: make(chan struct{}, 1)}
+}
+
+func (r *reloadRequests) request() {
+	select {
+	case r.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (r *reloadRequests) requestWithConfig(contents []byte, config *models.Config) {
+	r.mu.Lock()
+	r.parsedContents, r.parsedConfig = contents, config
+	r.mu.Unlock()
+
+	r.request()
+}
+
+// Returns the config that was parsed when requesting the reload if it was
+// parsed from the same contents, otherwise parses them. Safe to call on nil.
+func (r *reloadRequests) parse(contents []byte) (*models.Config, error) {
+	if r != nil {
+		r.mu.Lock()
+		parsedContents, parsedConfig := r.parsedContents, r.parsedConfig
+		r.parsedContents, r.parsedConfig = nil, nil
+		r.mu.Unlock()
+
+		if parsedConfig != nil && bytes.Equal(parsedContents, contents) {
+			return parsedConfig, nil
+		}
+	}
+
+	return loader.NewConfigFromYAML(contents)
+}
+
+// Requests reloads of the configs whenever the process receives SIGHUP, which
+// otherwise terminates it
+func reloadOnSIGHUP(requests ...*reloadRequests) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			slog.Info("Received SIGHUP, reloading config...")
+			for _, r := range requests {
+				r.request()
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
+
+type reloadResponse struct {
+	Reloading bool   `json:"reloading"`
+	Error     string `json:"error,omitempty"`
+}
+
+// The config is parsed before responding so that its errors can be returned,
+// while the reload itself happens shortly after since the server that handles
+// the request gets replaced
+func (a *Application) handleReloadRequest(w http.ResponseWriter, r *http.Request) {
+	if a.configPath == "" || a.reloads == nil {
+		http.Error(w, "the config can't be reloaded while running this way", http.StatusNotImplemented)
+		return
+	}
+
+	response := reloadResponse{Reloading: true}
+	status := http.StatusAccepted
+
+	var config *models.Config
+	contents, _, sourceMap, err := loader.ParseYAMLIncludes(a.configPath)
+	if err == nil {
+		config, err = loader.NewConfigFromYAML(contents)
+		err = sourceMap.TranslateError(err)
+	}
+
+	if err != nil {
+		response = reloadResponse{Error: err.Error()}
+		status = http.StatusUnprocessableEntity
+	} else {
+		a.reloads.requestWithConfig(contents, config)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Replaces the widgets of the new config whose YAML is identical to a widget in
+// the previous config with that previous widget, so that they keep their cached
+// content, update schedule and ID instead of having to be fetched again
+func carryOverUnchangedWidgets(previous, current *models.Config) int {
+	for p := range previous.Pages {
+		page := &previous.Pages[p]
+		page.Mu.Lock()
+		defer page.Mu.Unlock()
+	}
+
+	available := make(map[string][]models.Widget)
+	// containers change some properties of their children, such as hiding their
+	// header, so a widget is only reused if it's within the same type of container
+	key := func(widget models.Widget, parentType string) string {
+		fingerprinted, ok := widget.(models.FingerprintedWidget)
+		if !ok || fingerprinted.GetFingerprint() == "" {
+			return ""
+		}
+		return parentType + "/" + fingerprinted.GetFingerprint()
+	}
+
+	var collect func(widgets models.Widgets, parentType string)
+	collect = func(widgets models.Widgets, parentType string) {
+		for _, widget := range widgets {
+			if k := key(widget, parentType); k != "" {
+				available[k] = append(available[k], widget)
+			}
+			if container, ok := widget.(models.ContainerWidget); ok {
+				collect(container.GetWidgets(), widget.GetType())
+			}
+		}
+	}
+	for p := range previous.Pages {
+		page := &previous.Pages[p]
+		collect(page.HeadWidgets, "")
+		for c := range page.Columns {
+			collect(page.Columns[c].Widgets, "")
+		}
+	}
+
+	// a reused container brings its children along, they can't be reused a second time
+	used := make(map[uint64]bool)
+	var markUsed func(widget models.Widget)
+	markUsed = func(widget models.Widget) {
+		used[widget.GetID()] = true
+		if container, ok := widget.(models.ContainerWidget); ok {
+			for _, child := range container.GetWidgets() {
+				markUsed(child)
+			}
+		}
+	}
+
+	take := func(k string) models.Widget {
+		candidates := available[k]
+		for i, candidate := range candidates {
+			if used[candidate.GetID()] {
+				continue
+			}
+			available[k] = candidates[i+1:]
+			markUsed(candidate)
+			return candidate
+		}
+		return nil
+	}
+
+	reused := 0
+	var replace func(widgets models.Widgets, parentType string)
+	replace = func(widgets models.Widgets, parentType string) {
+		for i, widget := range widgets {
+			if k := key(widget, parentType); k != "" {
+				if previousWidget := take(k); previousWidget != nil {
+					relocateWidget(previousWidget, widget)
+					widgets[i] = previousWidget
+					reused++
+					continue
+				}
+			}
+			if container, ok := widget.(models.ContainerWidget); ok {
+				replace(container.GetWidgets(), widget.GetType())
+			}
+		}
+	}
+	for p := range current.Pages {
+		page := &current.Pages[p]
+		replace(page.HeadWidgets, "")
+		for c := range page.Columns {
+			replace(page.Columns[c].Widgets, "")
+		}
+	}
+
+	return reused
+}
+
+// A reused widget takes the place of the new one, which can be on another line
+// of the config, as can the widgets within it
+func relocateWidget(reused, replaced models.Widget) {
+	if located, ok := reused.(models.LocatedWidget); ok {
+		if replacedLocated, ok := replaced.(models.LocatedWidget); ok {
+			located.SetSourceLine(replacedLocated.GetSourceLine())
+		}
+	}
+
+	reusedContainer, ok := reused.(models.ContainerWidget)
+	if !ok {
+		return
+	}
+	replacedContainer, ok := replaced.(models.ContainerWidget)
+	if !ok {
+		return
+	}
+
+	reusedChildren, replacedChildren := reusedContainer.GetWidgets(), replacedContainer.GetWidgets()
+	for i := range min(len(reusedChildren), len(replacedChildren)) {
+		relocateWidget(reusedChildren[i], replacedChildren[i])
+	}
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
+)
+
+func loadReloadTestConfig(t *testing.T, widgets string) *models.Config {
+	t.Helper()
+
+	config, err := loader.NewConfigFromYAML([]byte(
+		"pages:\n  - name: Home\n    columns:\n      - size: full\n        widgets:\n" + widgets,
+	))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	return config
+}
+
+func firstColumn(config *models.Config) models.Widgets {
+	return config.Pages[0].Columns[0].Widgets
+}
+
+func sourceLine(widget models.Widget) int {
+	return widget.(models.LocatedWidget).GetSourceLine()
+}
+
+func TestCarryOverUnchangedWidgets(t *testing.T) {
+	previous := loadReloadTestConfig(t, ""+
+		"          - type: html\n            source: a\n"+
+		"          - type: html\n            source: b\n")
+	current := loadReloadTestConfig(t, ""+
+		"          - type: html\n            source: new\n"+
+		"          - type: html\n            source: b\n"+
+		"          - type: html\n            source: a\n")
+
+	previousA, previousB := firstColumn(previous)[0], firstColumn(previous)[1]
+	currentA := firstColumn(current)[2]
+
+	if reused := carryOverUnchangedWidgets(previous, current); reused != 2 {
+		t.Fatalf("Reused %d widgets, expected 2", reused)
+	}
+
+	widgets := firstColumn(current)
+	if widgets[1] != previousB {
+		t.Error("Unchanged widget b wasn't reused")
+	}
+	if widgets[2] != previousA {
+		t.Error("Unchanged widget a wasn't reused after being moved")
+	}
+	if widgets[0] == previousA || widgets[0] == previousB {
+		t.Error("New widget got replaced by a previous one")
+	}
+
+	// the reused widget has to point at where it's defined now rather than
+	// where it was, otherwise edits made through the UI would go to the wrong place
+	if sourceLine(widgets[2]) != sourceLine(currentA) {
+		t.Errorf("Reused widget is on line %d, expected %d", sourceLine(widgets[2]), sourceLine(currentA))
+	}
+}
+
+func TestCarryOverChangedWidgetIsNotReused(t *testing.T) {
+	previous := loadReloadTestConfig(t, "          - type: html\n            source: a\n")
+	current := loadReloadTestConfig(t, "          - type: html\n            source: a\n            title: Changed\n")
+
+	if reused := carryOverUnchangedWidgets(previous, current); reused != 0 {
+		t.Fatalf("Reused %d widgets, expected none", reused)
+	}
+
+	if firstColumn(current)[0] == firstColumn(previous)[0] {
+		t.Error("Changed widget got replaced by its previous version")
+	}
+}
+
+func TestCarryOverIdenticalWidgetsAreReusedOnce(t *testing.T) {
+	widget := "          - type: html\n            source: same\n"
+	previous := loadReloadTestConfig(t, widget+widget)
+	current := loadReloadTestConfig(t, widget+widget+widget)
+
+	if reused := carryOverUnchangedWidgets(previous, current); reused != 2 {
+		t.Fatalf("Reused %d widgets, expected 2", reused)
+	}
+
+	widgets := firstColumn(current)
+	if widgets[0] != firstColumn(previous)[0] || widgets[1] != firstColumn(previous)[1] {
+		t.Error("Identical widgets weren't reused in order")
+	}
+	if widgets[2] == widgets[0] || widgets[2] == widgets[1] {
+		t.Error("Same previous widget got reused twice")
+	}
+}
+
+func TestCarryOverContainers(t *testing.T) {
+	group := "" +
+		"          - type: group\n" +
+		"            widgets:\n" +
+		"              - type: html\n                source: a\n" +
+		"              - type: html\n                source: b\n"
+
+	t.Run("unchanged container brings its widgets along", func(t *testing.T) {
+		previous := loadReloadTestConfig(t, group)
+		current := loadReloadTestConfig(t, "          - type: html\n            source: new\n"+group)
+
+		previousGroup := firstColumn(previous)[0]
+		currentChildren := firstColumn(current)[1].(models.ContainerWidget).GetWidgets()
+		expectedLines := []int{sourceLine(currentChildren[0]), sourceLine(currentChildren[1])}
+
+		// the group itself counts, its widgets don't since they came with it
+		if reused := carryOverUnchangedWidgets(previous, current); reused != 1 {
+			t.Fatalf("Reused %d widgets, expected 1", reused)
+		}
+
+		if firstColumn(current)[1] != previousGroup {
+			t.Fatal("Unchanged group wasn't reused")
+		}
+
+		children := previousGroup.(models.ContainerWidget).GetWidgets()
+		for i, child := range children {
+			if sourceLine(child) != expectedLines[i] {
+				t.Errorf("Widget %d of the reused group is on line %d, expected %d", i, sourceLine(child), expectedLines[i])
+			}
+		}
+	})
+
+	t.Run("unchanged widgets of a changed container are reused", func(t *testing.T) {
+		previous := loadReloadTestConfig(t, group)
+		current := loadReloadTestConfig(t, group+"              - type: html\n                source: c\n")
+
+		previousChildren := firstColumn(previous)[0].(models.ContainerWidget).GetWidgets()
+
+		if reused := carryOverUnchangedWidgets(previous, current); reused != 2 {
+			t.Fatalf("Reused %d widgets, expected 2", reused)
+		}
+
+		if firstColumn(current)[0] == firstColumn(previous)[0] {
+			t.Error("Changed group got reused")
+		}
+
+		children := firstColumn(current)[0].(models.ContainerWidget).GetWidgets()
+		if children[0] != previousChildren[0] || children[1] != previousChildren[1] {
+			t.Error("Unchanged widgets within the changed group weren't reused")
+		}
+	})
+
+	t.Run("widgets aren't reused outside of the container type they were in", func(t *testing.T) {
+		previous := loadReloadTestConfig(t, group)
+		current := loadReloadTestConfig(t, "          - type: html\n            source: a\n")
+
+		if reused := carryOverUnchangedWidgets(previous, current); reused != 0 {
+			t.Fatalf("Reused %d widgets, expected none", reused)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+)
+
+const cspNoncePlaceholder = "{nonce}"
+
+type cspNonceContextKey struct{}
+
+// Directives of the automatic policy in the order they get written, anything
+// added through widgets or extra-csp-sources that isn't listed here follows them
+var cspDirectiveOrder = []string{
+	"default-src",
+	"script-src",
+	"style-src",
+	"img-src",
+	"font-src",
+	"connect-src",
+	"frame-src",
+	"object-src",
+	"base-uri",
+	"form-action",
+	"frame-ancestors",
+}
+
+// Builds the policy from what the config needs in order to work, i.e. the
+// scripts within document.head and custom-footer, an external custom CSS file
+// and the sources that widgets such as iframe ask for
+func (a *Application) buildContentSecurityPolicy() string {
+	config := &a.Config
+	directives := map[string][]string{
+		"default-src": {"'self'"},
+		"script-src":  {"'self'", "'nonce-" + cspNoncePlaceholder + "'"},
+		"style-src":   {"'self'", "'unsafe-inline'"},
+		"img-src":     {"*", "data:", "blob:"},
+		"font-src":    {"'self'", "data:"},
+		"connect-src": {"'self'"},
+		"frame-src":   {"'self'"},
+		"object-src":  {"'none'"},
+		"base-uri":    {"'self'"},
+		"form-action": {"'self'"},
+	}
+
+	add := func(directive string, sources ...string) {
+		for _, source := range sources {
+			if !slices.Contains(directives[directive], source) {
+				directives[directive] = append(directives[directive], source)
+			}
+		}
+	}
+
+	htmls := []string{string(config.Document.Head), string(config.Branding.CustomFooter)}
+	for _, host := range config.Server.Hosts {
+		htmls = append(htmls, string(host.Branding.CustomFooter))
+	}
+
+	for _, html := range htmls {
+		origins, hasInline := common.ScriptSourcesOfHTML(html)
+		add("script-src", origins...)
+		if hasInline {
+			add("script-src", "'unsafe-inline'")
+		}
+	}
+
+	if origin := common.OriginOfURL(config.Theme.CustomCSSFile); origin != "" {
+		add("style-src", origin)
+	}
+
+	for _, widget := range a.widgetByID {
+		if widget, ok := widget.(models.ContentSecurityPolicyWidget); ok {
+			for directive, sources := range widget.GetCSPSources() {
+				add(directive, sources...)
+			}
+		}
+	}
+
+	for directive, sources := range config.Server.SecurityHeaders.ExtraCSPSources {
+		add(directive, sources...)
+	}
+
+	// browsers ignore 'unsafe-inline' when a nonce is present
+	if slices.Contains(directives["script-src"], "'unsafe-inline'") {
+		directives["script-src"] = slices.DeleteFunc(directives["script-src"], func(source string) bool {
+			return strings.HasPrefix(source, "'nonce-")
+		})
+	}
+
+	switch config.Server.SecurityHeaders.FrameOptions {
+	case "deny":
+		directives["frame-ancestors"] = []string{"'none'"}
+	case "sameorigin":
+		directives["frame-ancestors"] = []string{"'self'"}
+	}
+
+	var extraDirectives []string
+	for directive := range directives {
+		if !slices.Contains(cspDirectiveOrder, directive) {
+			extraDirectives = append(extraDirectives, directive)
+		}
+	}
+	slices.Sort(extraDirectives)
+
+	var policy strings.Builder
+	for _, directive := range append(slices.Clone(cspDirectiveOrder), extraDirectives...) {
+		sources, exists := directives[directive]
+		if !exists {
+			continue
+		}
+		if policy.Len() > 0 {
+			policy.WriteString("; ")
+		}
+		policy.WriteString(directive + " " + strings.Join(sources, " "))
+	}
+
+	return policy.String()
+}
+
+// Sets the configured security headers on every response, pages get the nonce
+// of their request through the context so that their inline script can run
+func (a *Application) setSecurityHeaders(handler http.Handler) http.Handler {
+	config := &a.Config.Server.SecurityHeaders
+
+	policy := config.ContentSecurityPolicy
+	if policy == models.CSPAuto {
+		policy = a.buildContentSecurityPolicy()
+	}
+	usesNonce := strings.Contains(policy, cspNoncePlaceholder)
+
+	frameOptions := strings.ToUpper(config.FrameOptions)
+
+	var hsts string
+	if config.HSTS.MaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int(time.Duration(config.HSTS.MaxAge).Seconds()))
+		if config.HSTS.IncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if config.HSTS.Preload {
+			hsts += "; preload"
+		}
+	}
+
+	if policy == "" && frameOptions == "" && config.ReferrerPolicy == "" && hsts == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+
+		if policy != "" {
+			if usesNonce {
+				nonce := newCSPNonce()
+				header.Set("Content-Security-Policy", strings.ReplaceAll(policy, cspNoncePlaceholder, nonce))
+				r = r.WithContext(context.WithValue(r.Context(), cspNonceContextKey{}, nonce))
+			} else {
+				header.Set("Content-Security-Policy", policy)
+			}
+		}
+
+		if frameOptions != "" {
+			header.Set("X-Frame-Options", frameOptions)
+		}
+
+		if config.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", config.ReferrerPolicy)
+		}
+
+		// browsers ignore the header when it's received over plain HTTP
+		if hsts != "" && a.isRequestSecure(r) {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (a *Application) isRequestSecure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	return a.Config.Server.Proxied && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+func newCSPNonce() string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(nonce)
+}
+
+func cspNonceOfRequest(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceContextKey{}).(string)
+	return nonce
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const sessionsStateName = "sessions"
+
+// Every session token carries the generation of its user at the time it was
+// issued, moving a user on to the next generation invalidates all of them
+type sessionsState struct {
+	Generations map[string]uint32 `json:"generations"`
+}
+
+// Without a data path the generations get lost on restart, which would make the
+// tokens of users that have been logged out everywhere valid again. They're
+// offset by an epoch picked at random for each run of the process instead, so
+// that a restart logs everyone out rather than bringing revoked sessions back.
+var inMemorySessionsEpoch = func() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}()
+
+func (a *Application) loadSessionsState() error {
+	a.sessions.Generations = make(map[string]uint32)
+	return a.state.load(sessionsStateName, &a.sessions)
+}
+
+func (a *Application) sessionGeneration(username string) uint32 {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+
+	generation := a.sessions.Generations[username]
+	if !a.state.persistent() {
+		generation += inMemorySessionsEpoch
+	}
+
+	return generation
+}
+
+func (a *Application) revokeSessions(username string) error {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+
+	// the state may have been changed by the application of a previous config
+	if err := a.state.load(sessionsStateName, &a.sessions); err != nil {
+		return err
+	}
+
+	a.sessions.Generations[username]++
+	return a.state.save(sessionsStateName, &a.sessions)
+}
+
+// Logs the user out everywhere, including the session the request was made with
+func (a *Application) handleRevokeOwnSessionsRequest(w http.ResponseWriter, r *http.Request) {
+	username, authorized := a.authenticatedUsername(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, showUnauthorizedJSON)
+		return
+	}
+	if err := a.revokeSessions(username); err != nil {
+		slog.Error("Could not revoke sessions", "user", username, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, auditEventSessionsRevoked, username, nil)
+	a.setAuthSessionCookie(w, r, "", time.Now().Add(-1*time.Hour))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *Application) handleRevokeUserSessionsRequest(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("user")
+	if _, exists := a.Config.Auth.Users[username]; !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+	if err := a.revokeSessions(username); err != nil {
+		slog.Error("Could not revoke sessions", "user", username, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// the admin that made the request gets recorded along with the admin.request event
+	a.audit(r, auditEventSessionsRevoked, username, nil)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,307 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+)
+
+const (
+	snapshotLoginPath       = "/api/snapshot-login"
+	defaultSnapshotWidth    = 1280
+	defaultSnapshotHeight   = 800
+	maxSnapshotSize         = 4096
+	defaultSnapshotWait     = 5 * time.Second
+	defaultSnapshotTimeout  = 30 * time.Second
+	maxConcurrentSnapshots  = 2
+	snapshotLoginExpiration = 30 * time.Second
+)
+
+// Tried in order when chromium-path isn't set
+var snapshotChromiumNames = []string{
+	"chromium",
+	"chromium-browser",
+	"google-chrome",
+	"google-chrome-stable",
+	"headless-shell",
+}
+
+var errChromiumNotFound = errors.New("could not find chromium, set chromium-path to where it's installed")
+
+// Lets the browser that renders a snapshot log in as the user who asked for
+// it, once and only for a short while
+type snapshotLogin struct {
+	username  string
+	slug      string
+	expiresAt time.Time
+}
+
+// Handles GET /api/pages/{page}/snapshot.png, which responds with a screenshot
+// of the page taken by a headless Chromium, optionally sized through the width
+// and height parameters
+func (a *Application) handlePageSnapshotRequest(w http.ResponseWriter, r *http.Request) {
+	page, exists := a.slugToPage[r.PathValue("page")]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	username, authorized := a.snapshotRequester(w, r)
+	if !authorized {
+		a.respondUnauthorized(w, r, showUnauthorizedJSON)
+		return
+	}
+
+	if !a.canAccessPage(username, page) {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	config := &a.Config.Server.Snapshots
+	width, err := snapshotDimension(r, "width", common.Ternary(config.Width > 0, config.Width, defaultSnapshotWidth))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	height, err := snapshotDimension(r, "height", common.Ternary(config.Height > 0, config.Height, defaultSnapshotHeight))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case a.snapshotSlots <- struct{}{}:
+		defer func() { <-a.snapshotSlots }()
+	case <-r.Context().Done():
+		return
+	}
+
+	image, err := a.renderPageSnapshot(r.Context(), page, username, width, height)
+	if err != nil {
+		slog.Error("Failed to render snapshot", "page", page.Slug, "error", err)
+		if errors.Is(err, errChromiumNotFound) {
+			http.Error(w, "chromium is not available", http.StatusServiceUnavailable)
+		} else {
+			http.Error(w, "could not render snapshot", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(image)
+}
+
+// Requests made by a logged in user are rendered as seen by them, otherwise
+// the token, when there is one, renders pages as seen by the configured user
+func (a *Application) snapshotRequester(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if username, authorized := a.authenticatedUsername(w, r); authorized {
+		return username, true
+	}
+
+	config := &a.Config.Server.Snapshots
+	if config.Token == "" {
+		return "", false
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		token = r.URL.Query().Get("token")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(config.Token)) != 1 {
+		return "", false
+	}
+
+	return config.User, true
+}
+
+func snapshotDimension(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	dimension, err := strconv.Atoi(value)
+	if err != nil || dimension < 1 || dimension > maxSnapshotSize {
+		return 0, fmt.Errorf("%s must be a number between 1 and %d", name, maxSnapshotSize)
+	}
+
+	return dimension, nil
+}
+
+func (a *Application) renderPageSnapshot(ctx context.Context, page *models.Page, username string, width, height int) ([]byte, error) {
+	config := &a.Config.Server.Snapshots
+
+	chromiumPath, err := findChromium(config.ChromiumPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "glance-snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	baseURL := a.snapshotBaseURL()
+	target := baseURL + "/" + page.Slug
+	if a.RequiresAuth {
+		target = baseURL + snapshotLoginPath + "?token=" + a.newSnapshotLogin(username, page.Slug)
+	}
+
+	wait := common.Ternary(config.Wait > 0, time.Duration(config.Wait), defaultSnapshotWait)
+	timeout := common.Ternary(config.Timeout > 0, time.Duration(config.Timeout), defaultSnapshotTimeout)
+	screenshotPath := filepath.Join(dir, "snapshot.png")
+
+	args := []string{
+		"--headless",
+		"--disable-gpu",
+		"--hide-scrollbars",
+		"--mute-audio",
+		"--no-first-run",
+		"--user-data-dir=" + filepath.Join(dir, "profile"),
+		fmt.Sprintf("--window-size=%d,%d", width, height),
+		// gives the widgets that load after the page the time to do so
+		fmt.Sprintf("--virtual-time-budget=%d", wait.Milliseconds()),
+		"--screenshot=" + screenshotPath,
+	}
+
+	// Chromium refuses to start as root with its sandbox, which is what
+	// happens in most containers
+	if os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, chromiumPath, append(args, target)...).CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("chromium did not finish within %s", timeout)
+		}
+
+		return nil, fmt.Errorf("running chromium: %v: %s", err, lastLineOf(output))
+	}
+
+	image, err := os.ReadFile(screenshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading screenshot: %v", err)
+	}
+
+	return image, nil
+}
+
+func findChromium(configured string) (string, error) {
+	if configured != "" {
+		path, err := exec.LookPath(configured)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errChromiumNotFound, err)
+		}
+
+		return path, nil
+	}
+
+	for _, name := range snapshotChromiumNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", errChromiumNotFound
+}
+
+// Where Chromium can reach the server, which is the address it listens on
+// unless set otherwise
+func (a *Application) snapshotBaseURL() string {
+	server := &a.Config.Server
+	if server.Snapshots.URL != "" {
+		return strings.TrimRight(server.Snapshots.URL, "/")
+	}
+
+	host := server.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(int(server.Port))) + server.BaseURL
+}
+
+func lastLineOf(output []byte) string {
+	output = bytes.TrimSpace(output)
+	if i := bytes.LastIndexByte(output, '\n'); i >= 0 {
+		output = output[i+1:]
+	}
+
+	return string(output)
+}
+
+func (a *Application) newSnapshotLogin(username, slug string) string {
+	key := make([]byte, 32)
+	rand.Read(key)
+	token := hex.EncodeToString(key)
+	now := time.Now()
+
+	a.snapshotLoginsMu.Lock()
+	defer a.snapshotLoginsMu.Unlock()
+
+	for existing, login := range a.snapshotLogins {
+		if now.After(login.expiresAt) {
+			delete(a.snapshotLogins, existing)
+		}
+	}
+
+	a.snapshotLogins[token] = snapshotLogin{
+		username:  username,
+		slug:      slug,
+		expiresAt: now.Add(snapshotLoginExpiration),
+	}
+
+	return token
+}
+
+// Handles GET /api/snapshot-login, which gives the browser that renders a
+// snapshot a session and sends it to the page. The session only lives within
+// the profile of that browser, which gets deleted along with the snapshot.
+func (a *Application) handleSnapshotLoginRequest(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	a.snapshotLoginsMu.Lock()
+	login, exists := a.snapshotLogins[token]
+	delete(a.snapshotLogins, token)
+	a.snapshotLoginsMu.Unlock()
+
+	now := time.Now()
+	if !exists || now.After(login.expiresAt) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	sessionToken, err := a.sessionLifetime.GenerateToken(login.username, a.authSecretKey, now, now, a.sessionGeneration(login.username))
+	if err != nil {
+		slog.Error("Could not compute session token for snapshot", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.setAuthSessionCookie(w, r, sessionToken, a.sessionLifetime.Expiry(now, now))
+	http.Redirect(w, r, a.Config.Server.BaseURL+"/"+login.slug, http.StatusSeeOther)
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+)
+
+// Listens on the Unix domain socket at server.socket-path when one is set,
+// otherwise on the TCP address
+func (a *Application) listen(address string) (net.Listener, error) {
+	path := a.Config.Server.SocketPath
+	if path == "" {
+		return net.Listen("tcp", address)
+	}
+
+	// a socket left behind by a previous run that didn't shut down cleanly
+	// would prevent listening, anything else at that path is left alone
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %v", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Config.Server.SocketMode != "" {
+		mode, _ := strconv.ParseUint(a.Config.Server.SocketMode, 8, 32)
+		if err := os.Chmod(path, fs.FileMode(mode)); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("setting socket permissions: %v", err)
+		}
+	}
+
+	return listener, nil
+}
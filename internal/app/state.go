@@ -0,0 +1,120 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Small pieces of state that have to outlive the application, such as which
+// sessions have been revoked, stored as JSON files within server.data-path.
+// Without a data path they're kept in memory, which survives config reloads
+// but not restarts.
+type stateStore struct {
+	dir    string
+	memory *inMemoryState
+}
+
+type inMemoryState struct {
+	mu       sync.Mutex
+	contents map[string][]byte
+}
+
+// Every dashboard keeps its state in memory separately from the others, under
+// the path of its config, so that the sessions and preferences of one can't
+// leak into another
+var (
+	inMemoryStatesMu sync.Mutex
+	inMemoryStates   = make(map[string]*inMemoryState)
+)
+
+func newStateStore(dir string, memoryScope string) (*stateStore, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("creating data directory: %v", err)
+		}
+
+		return &stateStore{dir: dir}, nil
+	}
+
+	inMemoryStatesMu.Lock()
+	defer inMemoryStatesMu.Unlock()
+
+	memory, exists := inMemoryStates[memoryScope]
+	if !exists {
+		memory = &inMemoryState{contents: make(map[string][]byte)}
+		inMemoryStates[memoryScope] = memory
+	}
+
+	return &stateStore{memory: memory}, nil
+}
+
+func (s *stateStore) persistent() bool {
+	return s.dir != ""
+}
+
+func (s *stateStore) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+// Leaves v untouched if nothing has been saved under the name yet
+func (s *stateStore) load(name string, v any) error {
+	var contents []byte
+
+	if s.dir == "" {
+		s.memory.mu.Lock()
+		contents = s.memory.contents[name]
+		s.memory.mu.Unlock()
+	} else {
+		var err error
+		contents, err = os.ReadFile(s.path(name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if contents == nil {
+		return nil
+	}
+
+	return json.Unmarshal(contents, v)
+}
+
+func (s *stateStore) save(name string, v any) error {
+	contents, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if s.dir == "" {
+		s.memory.mu.Lock()
+		s.memory.contents[name] = contents
+		s.memory.mu.Unlock()
+		return nil
+	}
+
+	// written to a temporary file first so that a crash can't leave a partially written file behind
+	temporaryPath := s.path(name) + ".tmp"
+	if err := os.WriteFile(temporaryPath, contents, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(temporaryPath, s.path(name))
+}
+
+// Widgets share the store with the application, their state is kept under a
+// prefix so that it can't clash with that of the application
+func (s *stateStore) LoadWidgetState(key string, v any) error {
+	return s.load("widget-"+key, v)
+}
+
+func (s *stateStore) SaveWidgetState(key string, v any) error {
+	return s.save("widget-"+key, v)
+}
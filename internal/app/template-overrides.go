@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/limpdev/gander/internal/common"
+)
+
+// Templates placed here replace the embedded ones with the same name
+func (a *Application) templateOverridesDir() string {
+	if a.Config.Server.AssetsPath == "" {
+		return ""
+	}
+
+	return filepath.Join(a.Config.Server.AssetsPath, "templates")
+}
+
+// Loads the overrides again whenever a file within their directory changes,
+// for as long as ctx isn't done. Templates get looked up every time they're
+// rendered so nothing else has to be reloaded.
+func (a *Application) watchTemplateOverrides(ctx context.Context) {
+	dir := a.templateOverridesDir()
+	if dir == "" {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Warn("Could not watch template overrides, changes to them will require a restart", "error", err)
+		return
+	}
+
+	// the directory not existing is fine, there's nothing to override
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return
+	}
+
+	reload := func() {
+		overridden, err := common.LoadTemplateOverrides(dir)
+		if err != nil {
+			slog.Error("Could not reload template overrides, keeping the previous ones", "error", err)
+			return
+		}
+		slog.Info("Reloaded template overrides", "count", overridden)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		const debounceDuration = 500 * time.Millisecond
+		debounce := time.NewTimer(debounceDuration)
+		debounce.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				debounce.Stop()
+				return
+			case _, isOpen := <-watcher.Events:
+				if !isOpen {
+					return
+				}
+				debounce.Reset(debounceDuration)
+			case err, isOpen := <-watcher.Errors:
+				if !isOpen {
+					return
+				}
+				slog.Error("Error watching template overrides", "error", err)
+			case <-debounce.C:
+				reload()
+			}
+		}
+	}()
+}
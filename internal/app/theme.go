@@ -1,30 +1,285 @@
 package app
 
 import (
+	"errors"
+	"html/template"
+	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+	"gopkg.in/yaml.v3"
 )
 
+const userThemesStateName = "user-themes"
+
+// The themes that logged in users have picked, so that they follow them
+// across browsers and devices
+type userThemesState struct {
+	Themes map[string]string `json:"themes"`
+}
+
+const maxThemePreviewBodySize = 64 * 1024
+
+// The theme that a request gets rendered with
+type requestTheme struct {
+	// The preset in use, which when following theme.auto is the dark one until
+	// the browser switches to the light one if it prefers it
+	*models.ThemeProperties
+	// What's selected in the picker, which is either a preset, default or auto
+	Key         string
+	CSS         template.CSS
+	PreviewHTML template.HTML
+	// Set when the browser picks between the presets of theme.auto
+	FollowsSystem bool
+	// When the sun next rises or sets, if the theme follows it
+	SwitchesAt time.Time
+}
+
 func (a *Application) handleThemeChangeRequest(w http.ResponseWriter, r *http.Request) {
 	themeKey := r.PathValue("key")
-	properties, exists := a.Config.Theme.Presets.Get(themeKey)
-	if !exists && themeKey != "default" {
+	if !a.themeExists(themeKey) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	if themeKey == "default" {
-		properties = &a.Config.Theme.ThemeProperties
+	if !a.Config.Theme.DisablePicker {
+		username, _ := a.authenticatedUsername(w, r)
+		// the page switches between the presets of theme.auto through here
+		// too, which isn't something worth recording
+		if themeKey != a.selectedThemeKey(r, username) {
+			a.audit(r, auditEventThemeChanged, username, map[string]any{"theme": themeKey})
+		}
+		if username != "" {
+			if err := a.saveUserTheme(username, themeKey); err != nil {
+				slog.Error("Could not save theme of user", "user", username, "error", err)
+			}
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     "theme",
+			Value:    themeKey,
+			Path:     a.Config.Server.BaseURL + "/",
+			SameSite: http.SameSiteLaxMode,
+			Expires:  time.Now().Add(2 * 365 * 24 * time.Hour),
+		})
+	}
+	a.writeThemeCSS(w, a.resolveTheme(themeKey))
+}
+
+// Compiles the theme properties in the body of the request without saving
+// them anywhere, which lets themes be tried out before adding them to the
+// config. The body is JSON with the same keys as the theme in the config.
+func (a *Application) handleThemePreviewRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxThemePreviewBodySize))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// JSON is also YAML, which is how colors and everything else get parsed
+	// the same way as they do in the config
+	properties := &models.ThemeProperties{}
+	if err := yaml.Unmarshal(body, properties); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.compileThemePreview(properties); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "theme",
-		Value:    themeKey,
-		Path:     a.Config.Server.BaseURL + "/",
-		SameSite: http.SameSiteLaxMode,
-		Expires:  time.Now().Add(2 * 365 * 24 * time.Hour),
+
+	a.writeThemeCSS(w, requestTheme{
+		ThemeProperties: properties,
+		CSS:             properties.CSS,
 	})
+}
+
+func (a *Application) compileThemePreview(properties *models.ThemeProperties) error {
+	// reading files of the server is left to the config
+	if properties.Base16 != "" {
+		return errors.New("base16 can't be used in previews")
+	}
+	if err := properties.InheritFromPreset(); err != nil {
+		return err
+	}
+	properties.BackgroundImage = a.resolveUserDefinedAssetPath(properties.BackgroundImage)
+	return properties.Initialize()
+}
+
+func (a *Application) writeThemeCSS(w http.ResponseWriter, theme requestTheme) {
 	w.Header().Set("Content-Type", "text/css")
-	w.Header().Set("X-Scheme", common.Ternary(properties.Light, "light", "dark"))
-	w.Write([]byte(properties.CSS))
+	w.Header().Set("X-Scheme", common.Ternary(
+		theme.FollowsSystem,
+		"system",
+		common.Ternary(theme.Light, "light", "dark"),
+	))
+	if !theme.SwitchesAt.IsZero() {
+		w.Header().Set("X-Theme-Switches-At", strconv.FormatInt(theme.SwitchesAt.UnixMilli(), 10))
+	}
+	w.Write([]byte(theme.CSS))
+}
+
+func (a *Application) themeExists(key string) bool {
+	if key == models.ThemeAutoKey {
+		return a.Config.Theme.Auto != nil
+	}
+	if a.Config.Theme.DisablePicker {
+		return false
+	}
+	if key == "default" {
+		return true
+	}
+	_, exists := a.Config.Theme.Presets.Get(key)
+	return exists
+}
+
+// The theme saved for the user takes precedence over the one of the browser,
+// the username being empty for anyone that isn't logged in
+func (a *Application) selectedThemeKey(r *http.Request, username string) string {
+	defaultKey := common.Ternary(a.Config.Theme.Auto != nil, models.ThemeAutoKey, "default")
+	if a.Config.Theme.DisablePicker {
+		return defaultKey
+	}
+	if username != "" {
+		if key := a.userTheme(username); key != "" && a.themeExists(key) {
+			return key
+		}
+	}
+	selectedTheme, err := r.Cookie("theme")
+	if err != nil || !a.themeExists(selectedTheme.Value) {
+		return defaultKey
+	}
+	return selectedTheme.Value
+}
+
+func (a *Application) loadUserThemes() error {
+	a.userThemes.Themes = make(map[string]string)
+	return a.state.load(userThemesStateName, &a.userThemes)
+}
+
+func (a *Application) userTheme(username string) string {
+	a.userThemesMu.Lock()
+	defer a.userThemesMu.Unlock()
+	return a.userThemes.Themes[username]
+}
+
+func (a *Application) saveUserTheme(username, key string) error {
+	a.userThemesMu.Lock()
+	defer a.userThemesMu.Unlock()
+
+	// the state may have been changed by the application of a previous config
+	if err := a.state.load(userThemesStateName, &a.userThemes); err != nil {
+		return err
+	}
+	if a.userThemes.Themes[username] == key {
+		return nil
+	}
+
+	a.userThemes.Themes[username] = key
+	return a.state.save(userThemesStateName, &a.userThemes)
+}
+
+func (a *Application) resolveTheme(key string) requestTheme {
+	if key != models.ThemeAutoKey {
+		properties, exists := a.Config.Theme.Presets.Get(key)
+		if !exists {
+			properties = &a.Config.Theme.ThemeProperties
+		}
+		return requestTheme{
+			ThemeProperties: properties,
+			Key:             properties.Key,
+			CSS:             properties.CSS,
+			PreviewHTML:     properties.PreviewHTML,
+		}
+	}
+
+	auto := a.Config.Theme.Auto
+	theme := requestTheme{
+		Key:         models.ThemeAutoKey,
+		PreviewHTML: auto.PreviewHTML,
+	}
+
+	// until the weather widget has looked up where it is, it's left up to the
+	// browser to decide
+	latitude, longitude, ok := a.themeCoordinates()
+	if auto.Mode == models.ThemeAutoModeSystem || !ok {
+		theme.ThemeProperties = auto.Dark
+		theme.CSS = auto.CSS
+		theme.FollowsSystem = true
+		return theme
+	}
+
+	now := time.Now()
+	theme.ThemeProperties = common.Ternary(common.IsDaytime(now, latitude, longitude), auto.Light, auto.Dark)
+	theme.CSS = theme.ThemeProperties.CSS
+	if switchesAt, ok := common.NextSunTransition(now, latitude, longitude); ok {
+		theme.SwitchesAt = switchesAt
+	} else {
+		// polar days and nights, checked again daily since they do end
+		theme.SwitchesAt = now.Add(24 * time.Hour)
+	}
+	return theme
+}
+
+// The coordinates get remembered once known since they don't change, which
+// avoids having to wait for the weather widget to finish updating
+func (a *Application) themeCoordinates() (float64, float64, bool) {
+	if coordinates := a.cachedThemeCoordinates.Load(); coordinates != nil {
+		return coordinates[0], coordinates[1], true
+	}
+	if a.themeCoordinatesWidget == nil {
+		return 0, 0, false
+	}
+	if locked, ok := a.themeCoordinatesWidget.(models.LockedWidget); ok {
+		lock := locked.GetUpdateLock()
+		if !lock.TryRLock() {
+			return 0, 0, false
+		}
+		defer lock.RUnlock()
+	}
+	latitude, longitude, ok := a.themeCoordinatesWidget.(models.CoordinatesWidget).GetCoordinates()
+	if !ok {
+		return 0, 0, false
+	}
+	a.cachedThemeCoordinates.Store(&[2]float64{latitude, longitude})
+	return latitude, longitude, true
+}
+
+// The first widget in the config that's tied to a place
+func findCoordinatesWidget(pages []models.Page) models.Widget {
+	var find func(widgets models.Widgets) models.Widget
+	find = func(widgets models.Widgets) models.Widget {
+		for _, widget := range widgets {
+			if _, ok := widget.(models.CoordinatesWidget); ok {
+				return widget
+			}
+			if container, ok := widget.(models.ContainerWidget); ok {
+				if found := find(container.GetWidgets()); found != nil {
+					return found
+				}
+			}
+		}
+		return nil
+	}
+	for p := range pages {
+		if found := find(pages[p].HeadWidgets); found != nil {
+			return found
+		}
+		for c := range pages[p].Columns {
+			if found := find(pages[p].Columns[c].Widgets); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
 }
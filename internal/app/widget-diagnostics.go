@@ -0,0 +1,181 @@
+package app
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
+)
+
+type widgetDiagnostic struct {
+	ID                uint64     `json:"id"`
+	Type              string     `json:"type"`
+	Title             string     `json:"title,omitempty"`
+	Page              string     `json:"page"`
+	Error             string     `json:"error,omitempty"`
+	Updates           int        `json:"updates"`
+	LastUpdate        *time.Time `json:"last_update"`
+	LastDurationMs    int64      `json:"last_duration_ms"`
+	LastBytesFetched  int64      `json:"last_bytes_fetched"`
+	TotalBytesFetched int64      `json:"total_bytes_fetched"`
+	SuccessStreak     int        `json:"success_streak"`
+	FailureStreak     int        `json:"failure_streak"`
+}
+
+// Collects the update metrics of every widget that has them, the slowest
+// first. Waits for widgets that are in the middle of updating.
+func (a *Application) widgetDiagnostics() []widgetDiagnostic {
+	diagnostics := make([]widgetDiagnostic, 0, len(a.widgetByID))
+
+	var collect func(widget models.Widget, page *models.Page)
+	collect = func(widget models.Widget, page *models.Page) {
+		if container, ok := widget.(models.ContainerWidget); ok {
+			for _, child := range container.GetWidgets() {
+				collect(child, page)
+			}
+			return
+		}
+
+		measured, ok := widget.(models.MeasuredWidget)
+		if !ok {
+			return
+		}
+
+		if locked, ok := widget.(models.LockedWidget); ok {
+			lock := locked.GetUpdateLock()
+			lock.RLock()
+			defer lock.RUnlock()
+		}
+
+		metrics := measured.GetUpdateMetrics()
+		diagnostic := widgetDiagnostic{
+			ID:                widget.GetID(),
+			Type:              widget.GetType(),
+			Page:              page.Slug,
+			Updates:           metrics.Updates,
+			LastDurationMs:    metrics.LastDuration.Milliseconds(),
+			LastBytesFetched:  metrics.LastBytesFetched,
+			TotalBytesFetched: metrics.TotalBytesFetched,
+			SuccessStreak:     metrics.SuccessStreak,
+			FailureStreak:     metrics.FailureStreak,
+		}
+		if titled, ok := widget.(models.TitledWidget); ok {
+			diagnostic.Title = titled.GetTitle()
+		}
+		if status, ok := widget.(models.WidgetStatusReporter); ok {
+			if err := status.GetError(); err != nil {
+				diagnostic.Error = err.Error()
+			}
+			if lastUpdate := status.GetLastUpdate(); !lastUpdate.IsZero() {
+				diagnostic.LastUpdate = &lastUpdate
+			}
+		}
+
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	for p := range a.Config.Pages {
+		page := &a.Config.Pages[p]
+		for _, widget := range page.HeadWidgets {
+			collect(widget, page)
+		}
+		for c := range page.Columns {
+			for _, widget := range page.Columns[c].Widgets {
+				collect(widget, page)
+			}
+		}
+	}
+
+	slices.SortStableFunc(diagnostics, func(a, b widgetDiagnostic) int {
+		return cmp.Compare(b.LastDurationMs, a.LastDurationMs)
+	})
+
+	return diagnostics
+}
+
+func (a *Application) handleWidgetDiagnosticsRequest(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.widgetDiagnostics())
+}
+
+// Updates every widget of the config once and prints how long each of them
+// took along with how much they fetched, the slowest first
+func runWidgetDiagnostic(configPath string) int {
+	contents, _, sourceMap, err := loader.ParseYAMLIncludes(configPath)
+	if err != nil {
+		fmt.Printf("Could not parse config file: %v\n", err)
+		return 1
+	}
+
+	config, err := loader.NewConfigFromYAML(contents)
+	if err != nil {
+		fmt.Printf("Config file is invalid: %v\n", sourceMap.TranslateError(err))
+		return 1
+	}
+
+	// failing widgets shouldn't notify anyone while diagnosing
+	config.Notifications = nil
+
+	app, err := NewApplication(config)
+	if err != nil {
+		fmt.Printf("Could not create application: %v\n", err)
+		return 1
+	}
+
+	fmt.Println("Updating widgets, this may take a while...")
+	fmt.Println()
+
+	start := time.Now()
+	for p := range app.Config.Pages {
+		app.Config.Pages[p].UpdateOutdatedWidgets()
+	}
+	elapsed := time.Since(start)
+
+	// widgets that never update on their own, such as html, have nothing to report
+	diagnostics := slices.DeleteFunc(app.widgetDiagnostics(), func(diagnostic widgetDiagnostic) bool {
+		return diagnostic.Updates == 0
+	})
+
+	fmt.Println("```")
+	fmt.Printf("%9s  %9s  %-6s  %s\n", "DURATION", "FETCHED", "STATUS", "WIDGET")
+	for _, diagnostic := range diagnostics {
+		name := diagnostic.Type
+		if diagnostic.Title != "" {
+			name += " \"" + diagnostic.Title + "\""
+		}
+
+		fmt.Printf(
+			"%7dms  %9s  %-6s  %s on page %s\n",
+			diagnostic.LastDurationMs,
+			formatByteCount(diagnostic.LastBytesFetched),
+			common.Ternary(diagnostic.Error == "", "ok", "failed"),
+			name,
+			diagnostic.Page,
+		)
+		if diagnostic.Error != "" {
+			fmt.Printf("└╴ error: %s\n", strings.ReplaceAll(diagnostic.Error, "\n", " "))
+		}
+	}
+	fmt.Println("```")
+	fmt.Printf("\nUpdated %d widgets in %dms\n", len(diagnostics), elapsed.Milliseconds())
+
+	return 0
+}
+
+func formatByteCount(count int64) string {
+	switch {
+	case count >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(count)/1024/1024)
+	case count >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(count)/1024)
+	default:
+		return fmt.Sprintf("%d B", count)
+	}
+}
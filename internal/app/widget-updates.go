@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/limpdev/gander/internal/models"
+)
+
+// How often each page checks whether any of its widgets need updating
+const widgetUpdateCheckInterval = time.Second
+
+// Keeps the widgets of every page of every running application up to date on
+// their own schedule so that loading a page never has to wait for them. The
+// same scheduler is shared by every dashboard served by the process. Each page
+// gets updated in its own goroutine so that a slow widget only holds back the
+// widgets on the same page.
+type widgetScheduler struct {
+	mu    sync.Mutex
+	pages map[*models.Page]*atomic.Bool
+	once  sync.Once
+}
+
+var scheduler = &widgetScheduler{pages: make(map[*models.Page]*atomic.Bool)}
+
+func (a *Application) updateWidgetsInBackground(ctx context.Context) {
+	scheduler.add(ctx, a.Config.Pages)
+}
+
+// Updates the pages until the context is done
+func (s *widgetScheduler) add(ctx context.Context, pages []models.Page) {
+	s.once.Do(func() {
+		go func() {
+			ticker := time.NewTicker(widgetUpdateCheckInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				s.updateOutdated()
+			}
+		}()
+	})
+
+	s.mu.Lock()
+	for p := range pages {
+		s.pages[&pages[p]] = &atomic.Bool{}
+	}
+	s.mu.Unlock()
+
+	// pages don't have to wait for the next tick to start updating
+	s.updateOutdated()
+
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for p := range pages {
+			delete(s.pages, &pages[p])
+		}
+	}()
+}
+
+func (s *widgetScheduler) updateOutdated() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for page, updating := range s.pages {
+		// pages that are still busy with their previous update get skipped
+		if !updating.CompareAndSwap(false, true) {
+			continue
+		}
+
+		go func() {
+			defer updating.Store(false)
+			// not cancelled along with the application, widgets that are kept
+			// after a config reload would otherwise end up with an error
+			page.UpdateOutdatedWidgets()
+		}()
+	}
+}
@@ -20,22 +20,76 @@ const (
 	AUTH_USERNAME_HASH_LENGTH = 32
 	AUTH_SECRET_KEY_LENGTH    = AUTH_TOKEN_SECRET_LENGTH + AUTH_USERNAME_HASH_LENGTH
 	AUTH_TIMESTAMP_LENGTH     = 4 // uint32
-	AUTH_TOKEN_DATA_LENGTH    = AUTH_USERNAME_HASH_LENGTH + AUTH_TIMESTAMP_LENGTH
+	AUTH_GENERATION_LENGTH    = 4 // uint32
+	// username hash + expiration timestamp + login timestamp + generation
+	AUTH_TOKEN_DATA_LENGTH = AUTH_USERNAME_HASH_LENGTH + 2*AUTH_TIMESTAMP_LENGTH + AUTH_GENERATION_LENGTH
 )
 
-// How long the token will be valid for
+// Defaults for how long the token will be valid for
 const (
 	AUTH_TOKEN_VALID_PERIOD = 14 * 24 * time.Hour // 14 days
 	// How long the token has left before it should be regenerated
 	AUTH_TOKEN_REGEN_BEFORE = 7 * 24 * time.Hour // 7 days
 )
 
-type FailedAuthAttempt struct {
-	Attempts int
-	First    time.Time
+type SessionLifetime struct {
+	// How long a token is valid for after it was issued
+	Duration time.Duration
+	// Tokens that have less than this left get regenerated when used
+	RegenerateBefore time.Duration
+	// When set, sessions that go unused for this long expire even if their
+	// duration hasn't passed yet
+	IdleTimeout time.Duration
+	// When set, sessions expire this long after logging in no matter how often
+	// their token gets regenerated
+	MaxDuration time.Duration
+}
+
+var DefaultSessionLifetime = SessionLifetime{
+	Duration:         AUTH_TOKEN_VALID_PERIOD,
+	RegenerateBefore: AUTH_TOKEN_REGEN_BEFORE,
+}
+
+func (l SessionLifetime) validPeriod() time.Duration {
+	if l.IdleTimeout > 0 && l.IdleTimeout < l.Duration {
+		return l.IdleTimeout
+	}
+
+	return l.Duration
+}
+
+func (l SessionLifetime) regenerateBefore() time.Duration {
+	period := l.validPeriod()
+
+	// an idle timeout only works if tokens get regenerated often enough, at the
+	// cost of sessions expiring anywhere between half and the full timeout
+	if period != l.Duration || l.RegenerateBefore <= 0 || l.RegenerateBefore > period {
+		return period / 2
+	}
+
+	return l.RegenerateBefore
+}
+
+// Returns when a token issued now should expire for a session that started at loggedInAt
+func (l SessionLifetime) Expiry(now, loggedInAt time.Time) time.Time {
+	expires := now.Add(l.validPeriod())
+
+	if l.MaxDuration > 0 {
+		if limit := loggedInAt.Add(l.MaxDuration); limit.Before(expires) {
+			return limit
+		}
+	}
+
+	return expires
 }
 
 func GenerateSessionToken(username string, secret []byte, now time.Time) (string, error) {
+	return DefaultSessionLifetime.GenerateToken(username, secret, now, now, 0)
+}
+
+// The generation gets embedded in the token so that all of a user's sessions
+// can be revoked by moving on to the next generation
+func (l SessionLifetime) GenerateToken(username string, secret []byte, now, loggedInAt time.Time, generation uint32) (string, error) {
 	if len(secret) != AUTH_SECRET_KEY_LENGTH {
 		return "", fmt.Errorf("secret key length is not %d bytes", AUTH_SECRET_KEY_LENGTH)
 	}
@@ -45,13 +99,15 @@ func GenerateSessionToken(username string, secret []byte, now time.Time) (string
 	}
 	data := make([]byte, AUTH_TOKEN_DATA_LENGTH)
 	copy(data, usernameHash)
-	expires := now.Add(AUTH_TOKEN_VALID_PERIOD).Unix()
+	expires := l.Expiry(now, loggedInAt).Unix()
 	binary.LittleEndian.PutUint32(data[AUTH_USERNAME_HASH_LENGTH:], uint32(expires))
+	binary.LittleEndian.PutUint32(data[AUTH_USERNAME_HASH_LENGTH+AUTH_TIMESTAMP_LENGTH:], uint32(loggedInAt.Unix()))
+	binary.LittleEndian.PutUint32(data[AUTH_USERNAME_HASH_LENGTH+2*AUTH_TIMESTAMP_LENGTH:], generation)
 	h := hmac.New(sha256.New, secret[0:AUTH_TOKEN_SECRET_LENGTH])
 	h.Write(data)
 	signature := h.Sum(nil)
 	encodedToken := base64.StdEncoding.EncodeToString(append(data, signature...))
-	// encodedToken ends up being (hashed username + expiration timestamp + signature) encoded as base64
+	// encodedToken ends up being (hashed username + expiration timestamp + login timestamp + generation + signature) encoded as base64
 	return encodedToken, nil
 }
 func ComputeUsernameHash(username string, secret []byte) ([]byte, error) {
@@ -63,33 +119,52 @@ func ComputeUsernameHash(username string, secret []byte) ([]byte, error) {
 	return h.Sum(nil), nil
 }
 func VerifySessionToken(token string, secretBytes []byte, now time.Time) ([]byte, bool, error) {
+	session, shouldRegenerate, err := DefaultSessionLifetime.VerifyToken(token, secretBytes, now)
+	return session.UsernameHash, shouldRegenerate, err
+}
+
+// What a valid session token contains
+type Session struct {
+	UsernameHash []byte
+	LoggedInAt   time.Time
+	Generation   uint32
+}
+
+// Returns the session along with whether its token should be regenerated
+func (l SessionLifetime) VerifyToken(token string, secretBytes []byte, now time.Time) (Session, bool, error) {
 	tokenBytes, err := base64.StdEncoding.DecodeString(token)
 	if err != nil {
-		return nil, false, err
+		return Session{}, false, err
 	}
 	if len(tokenBytes) != AUTH_TOKEN_DATA_LENGTH+32 {
-		return nil, false, fmt.Errorf("token length is invalid")
+		return Session{}, false, fmt.Errorf("token length is invalid")
 	}
 	if len(secretBytes) != AUTH_SECRET_KEY_LENGTH {
-		return nil, false, fmt.Errorf("secret key length is not %d bytes", AUTH_SECRET_KEY_LENGTH)
+		return Session{}, false, fmt.Errorf("secret key length is not %d bytes", AUTH_SECRET_KEY_LENGTH)
 	}
 	usernameHashBytes := tokenBytes[0:AUTH_USERNAME_HASH_LENGTH]
 	timestampBytes := tokenBytes[AUTH_USERNAME_HASH_LENGTH : AUTH_USERNAME_HASH_LENGTH+AUTH_TIMESTAMP_LENGTH]
+	loginTimestampBytes := tokenBytes[AUTH_USERNAME_HASH_LENGTH+AUTH_TIMESTAMP_LENGTH : AUTH_USERNAME_HASH_LENGTH+2*AUTH_TIMESTAMP_LENGTH]
+	generationBytes := tokenBytes[AUTH_USERNAME_HASH_LENGTH+2*AUTH_TIMESTAMP_LENGTH : AUTH_TOKEN_DATA_LENGTH]
 	providedSignatureBytes := tokenBytes[AUTH_TOKEN_DATA_LENGTH:]
 	h := hmac.New(sha256.New, secretBytes[0:32])
 	h.Write(tokenBytes[0:AUTH_TOKEN_DATA_LENGTH])
 	expectedSignatureBytes := h.Sum(nil)
 	if !hmac.Equal(expectedSignatureBytes, providedSignatureBytes) {
-		return nil, false, fmt.Errorf("signature does not match")
+		return Session{}, false, fmt.Errorf("signature does not match")
+	}
+	expires := time.Unix(int64(binary.LittleEndian.Uint32(timestampBytes)), 0)
+	if now.Unix() > expires.Unix() {
+		return Session{}, false, fmt.Errorf("token has expired")
 	}
-	expiresTimestamp := int64(binary.LittleEndian.Uint32(timestampBytes))
-	if now.Unix() > expiresTimestamp {
-		return nil, false, fmt.Errorf("token has expired")
+	session := Session{
+		UsernameHash: usernameHashBytes,
+		LoggedInAt:   time.Unix(int64(binary.LittleEndian.Uint32(loginTimestampBytes)), 0),
+		Generation:   binary.LittleEndian.Uint32(generationBytes),
 	}
-	return usernameHashBytes,
-		// True if the token should be regenerated
-		time.Unix(expiresTimestamp, 0).Add(-AUTH_TOKEN_REGEN_BEFORE).Before(now),
-		nil
+	// a session that has reached its max duration can't be extended any further
+	shouldRegenerate := expires.Add(-l.regenerateBefore()).Before(now) && l.Expiry(now, session.LoggedInAt).After(expires)
+	return session, shouldRegenerate, nil
 }
 func MakeAuthSecretKey(length int) (string, error) {
 	key := make([]byte, length)
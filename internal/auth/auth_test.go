@@ -69,3 +69,83 @@ func TestAuthTokenGenerationAndVerification(t *testing.T) {
 		}
 	}
 }
+
+func TestSessionTokenLifetimes(t *testing.T) {
+	secret := make([]byte, AUTH_SECRET_KEY_LENGTH)
+	loggedInAt := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name             string
+		lifetime         SessionLifetime
+		generation       uint32
+		verifyAfter      time.Duration
+		expectExpired    bool
+		expectRegenerate bool
+	}{
+		{
+			name:        "default lifetime right after logging in",
+			lifetime:    DefaultSessionLifetime,
+			generation:  3,
+			verifyAfter: time.Second,
+		},
+		{
+			name:             "default lifetime within the regeneration period",
+			lifetime:         DefaultSessionLifetime,
+			verifyAfter:      AUTH_TOKEN_VALID_PERIOD - AUTH_TOKEN_REGEN_BEFORE + time.Hour,
+			expectRegenerate: true,
+		},
+		{
+			name:          "default lifetime after expiring",
+			lifetime:      DefaultSessionLifetime,
+			verifyAfter:   AUTH_TOKEN_VALID_PERIOD + time.Hour,
+			expectExpired: true,
+		},
+		{
+			name:          "idle timeout shorter than the duration",
+			lifetime:      SessionLifetime{Duration: 24 * time.Hour, IdleTimeout: time.Hour},
+			verifyAfter:   2 * time.Hour,
+			expectExpired: true,
+		},
+		{
+			name:             "idle timeout regenerates after half of it",
+			lifetime:         SessionLifetime{Duration: 24 * time.Hour, IdleTimeout: time.Hour},
+			verifyAfter:      31 * time.Minute,
+			expectRegenerate: true,
+		},
+		{
+			name:        "max duration doesn't regenerate past it",
+			lifetime:    SessionLifetime{Duration: 24 * time.Hour, RegenerateBefore: 12 * time.Hour, MaxDuration: 24 * time.Hour},
+			verifyAfter: 13 * time.Hour,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := test.lifetime.GenerateToken("admin", secret, loggedInAt, loggedInAt, test.generation)
+			if err != nil {
+				t.Fatalf("Failed to generate session token: %v", err)
+			}
+
+			session, shouldRegen, err := test.lifetime.VerifyToken(token, secret, loggedInAt.Add(test.verifyAfter))
+			if test.expectExpired {
+				if err == nil {
+					t.Fatal("Expected token verification to fail after token expiration")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to verify session token: %v", err)
+			}
+
+			if session.Generation != test.generation {
+				t.Errorf("Generation is %d, expected %d", session.Generation, test.generation)
+			}
+			if !session.LoggedInAt.Equal(loggedInAt) {
+				t.Errorf("Logged in at %v, expected %v", session.LoggedInAt, loggedInAt)
+			}
+			if shouldRegen != test.expectRegenerate {
+				t.Errorf("Should regenerate is %v, expected %v", shouldRegen, test.expectRegenerate)
+			}
+		})
+	}
+}
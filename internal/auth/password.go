@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordHashAlgoBcrypt   = "bcrypt"
+	PasswordHashAlgoArgon2id = "argon2id"
+)
+
+// Argon2id parameters other than the number of iterations, which is what the
+// cost refers to, based on the recommendations of RFC 9106
+const (
+	ARGON2_DEFAULT_ITERATIONS = 3
+	ARGON2_MEMORY_KIB         = 64 * 1024
+	ARGON2_PARALLELISM        = 4
+	ARGON2_SALT_LENGTH        = 16
+	ARGON2_KEY_LENGTH         = 32
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// Returns the cost used when none is specified, 0 for unknown algorithms
+func DefaultPasswordHashCost(algo string) int {
+	switch algo {
+	case PasswordHashAlgoBcrypt:
+		return bcrypt.DefaultCost
+	case PasswordHashAlgoArgon2id:
+		return ARGON2_DEFAULT_ITERATIONS
+	}
+
+	return 0
+}
+
+func ValidatePasswordHashOptions(algo string, cost int) error {
+	switch algo {
+	case PasswordHashAlgoBcrypt:
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case PasswordHashAlgoArgon2id:
+		if cost < 1 || cost > 100 {
+			return errors.New("argon2id cost must be between 1 and 100")
+		}
+	default:
+		return fmt.Errorf("unknown password hashing algorithm %q, must be either %s or %s", algo, PasswordHashAlgoBcrypt, PasswordHashAlgoArgon2id)
+	}
+
+	return nil
+}
+
+// Argon2id hashes are encoded in the PHC string format, the same one used by
+// the reference implementation, e.g. $argon2id$v=19$m=65536,t=3,p=4$salt$key
+func HashPassword(password []byte, algo string, cost int) ([]byte, error) {
+	if err := ValidatePasswordHashOptions(algo, cost); err != nil {
+		return nil, err
+	}
+
+	if algo == PasswordHashAlgoBcrypt {
+		return bcrypt.GenerateFromPassword(password, cost)
+	}
+
+	salt := make([]byte, ARGON2_SALT_LENGTH)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey(password, salt, uint32(cost), ARGON2_MEMORY_KIB, ARGON2_PARALLELISM, ARGON2_KEY_LENGTH)
+
+	return fmt.Appendf(nil,
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, ARGON2_MEMORY_KIB, cost, ARGON2_PARALLELISM,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Checks the password against a hash made by either of the supported
+// algorithms, returning ErrPasswordMismatch if it doesn't match
+func VerifyPassword(hash, password []byte) error {
+	if !strings.HasPrefix(string(hash), "$argon2id$") {
+		if err := bcrypt.CompareHashAndPassword(hash, password); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return ErrPasswordMismatch
+			}
+			return err
+		}
+		return nil
+	}
+
+	params, err := parseArgon2idHash(string(hash))
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey(password, params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	if subtle.ConstantTimeCompare(key, params.key) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+// Used to catch malformed password-hash values when the config gets loaded
+// rather than when someone tries to log in
+func CheckPasswordHash(hash string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		_, err := parseArgon2idHash(hash)
+		return err
+	}
+
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("not a valid bcrypt or argon2id hash")
+	}
+
+	return nil
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func parseArgon2idHash(hash string) (*argon2idParams, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, errors.New("malformed argon2id hash version")
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	params := &argon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, errors.New("malformed argon2id hash parameters")
+	}
+	if params.iterations == 0 || params.parallelism == 0 {
+		return nil, errors.New("malformed argon2id hash parameters")
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errors.New("malformed argon2id hash salt")
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return nil, errors.New("malformed argon2id hash key")
+	}
+
+	return params, nil
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	password := []byte("correct horse")
+
+	bcryptHash, err := HashPassword(password, PasswordHashAlgoBcrypt, 4)
+	if err != nil {
+		t.Fatalf("Failed to hash password with bcrypt: %v", err)
+	}
+	if !strings.HasPrefix(string(bcryptHash), "$2a$04$") {
+		t.Fatalf("bcrypt hash %q doesn't use the given cost", bcryptHash)
+	}
+
+	argon2Hash, err := HashPassword(password, PasswordHashAlgoArgon2id, 1)
+	if err != nil {
+		t.Fatalf("Failed to hash password with argon2id: %v", err)
+	}
+	if !strings.HasPrefix(string(argon2Hash), "$argon2id$v=19$m=65536,t=1,p=4$") {
+		t.Fatalf("argon2id hash %q doesn't use the given cost", argon2Hash)
+	}
+
+	// Both formats are verified the same way, regardless of the configured algorithm
+	for _, hash := range [][]byte{bcryptHash, argon2Hash} {
+		if err := CheckPasswordHash(string(hash)); err != nil {
+			t.Errorf("Hash %q is reported as invalid: %v", hash, err)
+		}
+		if err := VerifyPassword(hash, password); err != nil {
+			t.Errorf("Failed to verify the correct password against %q: %v", hash, err)
+		}
+		if err := VerifyPassword(hash, []byte("correct horsf")); !errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("Expected a mismatch for the wrong password against %q, got %v", hash, err)
+		}
+	}
+
+	// Salts are random, so the same password never hashes the same way twice
+	again, err := HashPassword(password, PasswordHashAlgoArgon2id, 1)
+	if err != nil {
+		t.Fatalf("Failed to hash password with argon2id: %v", err)
+	}
+	if string(again) == string(argon2Hash) {
+		t.Fatal("Hashing the same password twice resulted in the same hash")
+	}
+}
+
+func TestPasswordHashOptions(t *testing.T) {
+	tests := []struct {
+		algo      string
+		cost      int
+		expectErr bool
+	}{
+		{PasswordHashAlgoBcrypt, DefaultPasswordHashCost(PasswordHashAlgoBcrypt), false},
+		{PasswordHashAlgoBcrypt, 3, true},
+		{PasswordHashAlgoBcrypt, 32, true},
+		{PasswordHashAlgoArgon2id, DefaultPasswordHashCost(PasswordHashAlgoArgon2id), false},
+		{PasswordHashAlgoArgon2id, 0, true},
+		{PasswordHashAlgoArgon2id, 101, true},
+		{"scrypt", 10, true},
+	}
+
+	for _, test := range tests {
+		err := ValidatePasswordHashOptions(test.algo, test.cost)
+		if (err != nil) != test.expectErr {
+			t.Errorf("ValidatePasswordHashOptions(%q, %d) = %v, expected error: %v", test.algo, test.cost, err, test.expectErr)
+		}
+	}
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	tests := []struct {
+		hash      string
+		expectErr bool
+	}{
+		{"$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", false},
+		{"$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", false},
+		{"$argon2id$v=18$m=65536,t=3,p=4$c2FsdA$a2V5", true},
+		{"$argon2id$v=19$m=65536,t=0,p=4$c2FsdA$a2V5", true},
+		{"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$", true},
+		{"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA", true},
+		{"$argon2id$v=19$t=3$c2FsdA$a2V5", true},
+		{"123456", true},
+		{"", true},
+	}
+
+	for _, test := range tests {
+		err := CheckPasswordHash(test.hash)
+		if (err != nil) != test.expectErr {
+			t.Errorf("CheckPasswordHash(%q) = %v, expected error: %v", test.hash, err, test.expectErr)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LoginLimits struct {
+	// How far back failed attempts are counted
+	Window time.Duration
+	// How many failed attempts within the window lead to a lockout, keys
+	// starting with user: and ip: each have their own limit
+	MaxAttemptsPerIP   int
+	MaxAttemptsPerUser int
+	// How long the first lockout lasts, each consecutive one lasts twice as
+	// long as the previous, up to MaxLockout
+	Lockout    time.Duration
+	MaxLockout time.Duration
+}
+
+var DefaultLoginLimits = LoginLimits{
+	Window:             AUTH_RATE_LIMIT_WINDOW,
+	MaxAttemptsPerIP:   AUTH_RATE_LIMIT_MAX_ATTEMPTS,
+	MaxAttemptsPerUser: 2 * AUTH_RATE_LIMIT_MAX_ATTEMPTS,
+	Lockout:            AUTH_RATE_LIMIT_WINDOW,
+	MaxLockout:         24 * time.Hour,
+}
+
+// Failed login attempts of a single IP address or username
+type FailedAuthAttempts struct {
+	Failures    []time.Time `json:"failures"`
+	Lockouts    int         `json:"lockouts"`
+	LockedUntil time.Time   `json:"locked_until"`
+}
+
+type Lockout struct {
+	Key      string
+	Attempts int
+	Until    time.Time
+}
+
+// Keeps track of failed login attempts per IP address and per username using
+// sliding windows, locking out those that exceed the limits for increasingly
+// longer periods of time
+type LoginLimiter struct {
+	limits   LoginLimits
+	mu       sync.Mutex
+	attempts map[string]*FailedAuthAttempts
+}
+
+func NewLoginLimiter(limits LoginLimits, attempts map[string]*FailedAuthAttempts) *LoginLimiter {
+	if attempts == nil {
+		attempts = make(map[string]*FailedAuthAttempts)
+	}
+
+	return &LoginLimiter{
+		limits:   limits,
+		attempts: attempts,
+	}
+}
+
+func IPLimiterKey(ip string) string {
+	return "ip:" + ip
+}
+
+func UserLimiterKey(username string) string {
+	return "user:" + username
+}
+
+// Returns how long until another attempt can be made if any of the keys are
+// currently locked out
+func (l *LoginLimiter) LockedOutFor(now time.Time, keys ...string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var longest time.Duration
+	for _, key := range keys {
+		if attempts, exists := l.attempts[key]; exists && attempts.LockedUntil.After(now) {
+			longest = max(longest, attempts.LockedUntil.Sub(now))
+		}
+	}
+
+	return longest, longest > 0
+}
+
+// Returns the keys that got locked out as a result of this failure
+func (l *LoginLimiter) RecordFailure(now time.Time, keys ...string) []Lockout {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	var lockouts []Lockout
+	for _, key := range keys {
+		attempts, exists := l.attempts[key]
+		if !exists {
+			attempts = &FailedAuthAttempts{}
+			l.attempts[key] = attempts
+		}
+
+		attempts.Failures = append(attempts.Failures, now)
+		if len(attempts.Failures) < l.maxAttempts(key) {
+			continue
+		}
+
+		lockout := l.limits.Lockout << min(attempts.Lockouts, 30)
+		if lockout <= 0 || lockout > l.limits.MaxLockout {
+			lockout = l.limits.MaxLockout
+		}
+
+		attempts.Lockouts++
+		attempts.LockedUntil = now.Add(lockout)
+		lockouts = append(lockouts, Lockout{
+			Key:      key,
+			Attempts: len(attempts.Failures),
+			Until:    attempts.LockedUntil,
+		})
+		attempts.Failures = nil
+	}
+
+	return lockouts
+}
+
+func (l *LoginLimiter) RecordSuccess(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		delete(l.attempts, key)
+	}
+}
+
+// Returns a copy of the current state, used for persisting it
+func (l *LoginLimiter) Snapshot() map[string]*FailedAuthAttempts {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	snapshot := make(map[string]*FailedAuthAttempts, len(l.attempts))
+	for key, attempts := range l.attempts {
+		copied := *attempts
+		copied.Failures = slices.Clone(attempts.Failures)
+		snapshot[key] = &copied
+	}
+
+	return snapshot
+}
+
+func (l *LoginLimiter) maxAttempts(key string) int {
+	if strings.HasPrefix(key, "user:") {
+		return l.limits.MaxAttemptsPerUser
+	}
+
+	return l.limits.MaxAttemptsPerIP
+}
+
+// Forgets failures that fell out of the window, as well as the lockout count
+// of those that have behaved for as long as the longest possible lockout
+func (l *LoginLimiter) prune(now time.Time) {
+	for key, attempts := range l.attempts {
+		attempts.Failures = slices.DeleteFunc(attempts.Failures, func(failure time.Time) bool {
+			return now.Sub(failure) > l.limits.Window
+		})
+
+		if len(attempts.Failures) == 0 && now.Sub(attempts.LockedUntil) > l.limits.MaxLockout {
+			delete(l.attempts, key)
+		}
+	}
+}
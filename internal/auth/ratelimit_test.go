@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	limits := LoginLimits{
+		Window:             time.Minute,
+		MaxAttemptsPerIP:   3,
+		MaxAttemptsPerUser: 5,
+		Lockout:            time.Minute,
+		MaxLockout:         3 * time.Minute,
+	}
+	start := time.Unix(1_700_000_000, 0)
+
+	ip, user := IPLimiterKey("192.0.2.1"), UserLimiterKey("admin")
+
+	type step struct {
+		after        time.Duration
+		keys         []string
+		fail         bool
+		succeed      bool
+		lockouts     []string
+		lockedOut    bool
+		lockedOutFor time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "IP gets locked out before the user",
+			steps: []step{
+				{keys: []string{ip, user}, fail: true},
+				{keys: []string{ip, user}, fail: true},
+				{keys: []string{ip, user}, fail: true, lockouts: []string{ip}},
+				{after: time.Second, keys: []string{ip, user}, lockedOut: true, lockedOutFor: time.Minute - time.Second},
+				{after: time.Second, keys: []string{user}},
+			},
+		},
+		{
+			name: "failures outside of the window aren't counted",
+			steps: []step{
+				{keys: []string{ip}, fail: true},
+				{keys: []string{ip}, fail: true},
+				{after: 2 * time.Minute, keys: []string{ip}, fail: true},
+				{keys: []string{ip}},
+			},
+		},
+		{
+			name: "success forgets the failures",
+			steps: []step{
+				{keys: []string{ip}, fail: true},
+				{keys: []string{ip}, fail: true},
+				{keys: []string{ip}, succeed: true},
+				{keys: []string{ip}, fail: true},
+				{keys: []string{ip}},
+			},
+		},
+		{
+			name: "consecutive lockouts get longer up to the max",
+			steps: []step{
+				{keys: []string{ip}, fail: true},
+				{keys: []string{ip}, fail: true},
+				{keys: []string{ip}, fail: true, lockouts: []string{ip}},
+				{keys: []string{ip}, lockedOut: true, lockedOutFor: time.Minute},
+				{after: time.Minute, keys: []string{ip}, fail: true},
+				{keys: []string{ip}, fail: true},
+				{keys: []string{ip}, fail: true, lockouts: []string{ip}},
+				{keys: []string{ip}, lockedOut: true, lockedOutFor: 2 * time.Minute},
+				{after: 2 * time.Minute, keys: []string{ip}, fail: true},
+				{keys: []string{ip}, fail: true},
+				{keys: []string{ip}, fail: true, lockouts: []string{ip}},
+				{keys: []string{ip}, lockedOut: true, lockedOutFor: 3 * time.Minute},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewLoginLimiter(limits, nil)
+			now := start
+
+			for i, step := range test.steps {
+				now = now.Add(step.after)
+
+				if step.fail {
+					lockouts := limiter.RecordFailure(now, step.keys...)
+					if len(lockouts) != len(step.lockouts) {
+						t.Fatalf("step %d: got %d lockouts, expected %d", i, len(lockouts), len(step.lockouts))
+					}
+					for j := range lockouts {
+						if lockouts[j].Key != step.lockouts[j] {
+							t.Errorf("step %d: locked out %q, expected %q", i, lockouts[j].Key, step.lockouts[j])
+						}
+					}
+					continue
+				}
+
+				if step.succeed {
+					limiter.RecordSuccess(step.keys...)
+					continue
+				}
+
+				lockedOutFor, lockedOut := limiter.LockedOutFor(now, step.keys...)
+				if lockedOut != step.lockedOut {
+					t.Fatalf("step %d: locked out is %v, expected %v", i, lockedOut, step.lockedOut)
+				}
+				if lockedOutFor != step.lockedOutFor {
+					t.Errorf("step %d: locked out for %v, expected %v", i, lockedOutFor, step.lockedOutFor)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginLimiterSnapshotIsACopy(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	limiter := NewLoginLimiter(DefaultLoginLimits, nil)
+	limiter.RecordFailure(now, IPLimiterKey("192.0.2.1"))
+
+	snapshot := limiter.Snapshot()
+	snapshot[IPLimiterKey("192.0.2.1")].Failures[0] = time.Time{}
+
+	restored := NewLoginLimiter(DefaultLoginLimits, limiter.Snapshot())
+	if got := restored.Snapshot()[IPLimiterKey("192.0.2.1")].Failures[0]; !got.Equal(now) {
+		t.Errorf("Failure is at %v, expected %v", got, now)
+	}
+}
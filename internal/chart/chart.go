@@ -0,0 +1,231 @@
+// Package chart works out the shapes of the charts that widgets draw as SVG,
+// in the coordinates of a view box of a given size. Nothing here knows about
+// the markup, so the same shapes can be styled differently by each widget.
+package chart
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// The values at the bottom and at the top of a chart
+type Bounds struct {
+	Min float64
+	Max float64
+}
+
+// The bounds of the values, where the ones that are set take precedence
+func BoundsOf(values []float64, min, max *float64) Bounds {
+	var bounds Bounds
+
+	if len(values) > 0 {
+		bounds = Bounds{Min: slices.Min(values), Max: slices.Max(values)}
+	}
+
+	if min != nil {
+		bounds.Min = *min
+	}
+
+	if max != nil {
+		bounds.Max = *max
+	}
+
+	return bounds
+}
+
+// Where the value lies between the bounds, from 0 at the bottom to 1 at the
+// top, values outside of them are clamped
+func (b Bounds) Fraction(value float64) float64 {
+	if b.Max <= b.Min {
+		return 0.5
+	}
+
+	return math.Max(0, math.Min(1, (value-b.Min)/(b.Max-b.Min)))
+}
+
+// Widens the bounds to round numbers and returns about count ticks between
+// them, the first and last of which are the new bounds. Bounds that were set
+// by the user can be kept by passing them as fixed.
+func NiceTicks(b Bounds, count int, fixedMin, fixedMax bool) (Bounds, []float64) {
+	if count < 2 {
+		count = 2
+	}
+
+	if b.Max < b.Min {
+		b.Min, b.Max = b.Max, b.Min
+	}
+
+	// a flat series still needs some room around it
+	if b.Max == b.Min {
+		spread := math.Max(math.Abs(b.Min)*0.1, 1)
+		if !fixedMin {
+			b.Min -= spread
+		}
+		if !fixedMax {
+			b.Max += spread
+		}
+	}
+
+	step := niceNumber(niceNumber(b.Max-b.Min, false)/float64(count-1), true)
+
+	if !fixedMin {
+		b.Min = math.Floor(b.Min/step) * step
+	}
+
+	if !fixedMax {
+		b.Max = math.Ceil(b.Max/step) * step
+	}
+
+	ticks := []float64{b.Min}
+	for tick := math.Ceil(b.Min/step) * step; tick < b.Max-step/2; tick += step {
+		if tick > b.Min+step/2 {
+			ticks = append(ticks, roundToStep(tick, step))
+		}
+	}
+	ticks = append(ticks, b.Max)
+
+	return b, ticks
+}
+
+// Rounds to 1, 2, 5 or 10 times a power of ten, as described in "Nice
+// Numbers for Graph Labels" from Graphics Gems
+func niceNumber(x float64, round bool) float64 {
+	if x <= 0 {
+		return 1
+	}
+
+	exponent := math.Floor(math.Log10(x))
+	fraction := x / math.Pow(10, exponent)
+
+	var nice float64
+	switch {
+	case round && fraction < 1.5, !round && fraction <= 1:
+		nice = 1
+	case round && fraction < 3, !round && fraction <= 2:
+		nice = 2
+	case round && fraction < 7, !round && fraction <= 5:
+		nice = 5
+	default:
+		nice = 10
+	}
+
+	return nice * math.Pow(10, exponent)
+}
+
+// Gets rid of the error that adding up steps accumulates, such as 0.30000000000000004
+func roundToStep(value, step float64) float64 {
+	precision := math.Pow(10, float64(Decimals(step)))
+	return math.Round(value*precision) / precision
+}
+
+// How many decimals are needed to tell apart values that are step apart
+func Decimals(step float64) int {
+	if step <= 0 || step >= 1 {
+		return 0
+	}
+
+	return int(math.Ceil(-math.Log10(step) - 1e-9))
+}
+
+// A view box of the given size in which values between the bounds are drawn,
+// padding is left at the top and the bottom so that lines aren't cut in half
+type Canvas struct {
+	Width   float64
+	Height  float64
+	Padding float64
+	Bounds  Bounds
+}
+
+// The vertical coordinate of the value, a flat series goes through the middle
+func (c Canvas) Y(value float64) float64 {
+	inner := c.Height - c.Padding*2
+
+	if c.Bounds.Max == c.Bounds.Min {
+		return inner/2 + c.Padding
+	}
+
+	return (c.Bounds.Max-value)/(c.Bounds.Max-c.Bounds.Min)*inner + c.Padding
+}
+
+// The points of a polyline going through the values spread across the width
+func (c Canvas) Polyline(values []float64) string {
+	if len(values) < 2 {
+		return ""
+	}
+
+	coordinates := make([]string, len(values))
+	distanceBetweenPoints := c.Width / float64(len(values)-1)
+
+	for i := range values {
+		coordinates[i] = fmt.Sprintf("%.2f,%.2f", float64(i)*distanceBetweenPoints, c.Y(values[i]))
+	}
+
+	return strings.Join(coordinates, " ")
+}
+
+// The points of a polygon that fills the area below the polyline of the values
+func (c Canvas) Area(values []float64) string {
+	line := c.Polyline(values)
+	if line == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("0,%.2f %s %.2f,%.2f", c.Height, line, c.Width, c.Height)
+}
+
+type Bar struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+}
+
+// One bar per value across the width, gap is the fraction of the space of
+// each bar that's left empty. Bars grow from zero when it's within the bounds
+// and from the nearest edge otherwise, so negative values point downwards.
+func (c Canvas) Bars(values []float64, gap float64) []Bar {
+	if len(values) == 0 {
+		return nil
+	}
+
+	slot := c.Width / float64(len(values))
+	baseline := c.Height
+	if c.Bounds.Max <= 0 {
+		baseline = 0
+	} else if c.Bounds.Min < 0 {
+		baseline = c.Y(0)
+	}
+
+	bars := make([]Bar, len(values))
+	for i, value := range values {
+		y := math.Max(0, math.Min(c.Height, c.Y(value)))
+		bars[i] = Bar{
+			X:      float64(i)*slot + slot*gap/2,
+			Y:      math.Min(y, baseline),
+			Width:  slot * (1 - gap),
+			Height: math.Abs(baseline - y),
+		}
+	}
+
+	return bars
+}
+
+// The arc of a half circle gauge in a 100x55 view box, going clockwise from
+// the left end for the fraction of the way to the right end. A fraction of 1
+// draws the whole track.
+func GaugeArc(fraction float64) string {
+	const (
+		centerX = 50
+		centerY = 50
+		radius  = 40
+	)
+
+	fraction = math.Max(0, math.Min(1, fraction))
+	angle := math.Pi * (1 - fraction)
+	endX := centerX + radius*math.Cos(angle)
+	endY := centerY - radius*math.Sin(angle)
+
+	return fmt.Sprintf("M %d,%d A %d %d 0 0 1 %.2f,%.2f", centerX-radius, centerY, radius, radius, endX, endY)
+}
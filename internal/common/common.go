@@ -14,22 +14,57 @@ import (
 	"strings"
 	"time"
 
+	"github.com/limpdev/gander/internal/chart"
 	"github.com/limpdev/gander/internal/web"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
-func FileServerWithCache(fs http.FileSystem, cacheDuration time.Duration) http.Handler {
+// Files that are requested through a URL which changes along with their
+// contents can be cached forever
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+func CacheControlForDuration(cacheDuration time.Duration) string {
+	return fmt.Sprintf("public, max-age=%d", int(cacheDuration.Seconds()))
+}
+
+// Serves files with the Cache-Control header returned by cacheControl, which
+// only gets set on successful responses so that missing files aren't cached
+func FileServerWithCache(fs http.FileSystem, cacheControl func(*http.Request) string) http.Handler {
 	server := http.FileServer(fs)
-	cacheControlValue := fmt.Sprintf("public, max-age=%d", int(cacheDuration.Seconds()))
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO: fix always setting cache control even if the file doesn't exist
-		w.Header().Set("Cache-Control", cacheControlValue)
-		server.ServeHTTP(w, r)
+		server.ServeHTTP(&cacheControlResponseWriter{ResponseWriter: w, value: cacheControl(r)}, r)
 	})
 }
 
+type cacheControlResponseWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cacheControlResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < 400 {
+			w.Header().Set("Cache-Control", w.value)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *cacheControlResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 var BuildVersion = "dev"
 
 const DefaultClientTimeout = 5 * time.Second
@@ -68,22 +103,12 @@ func SvgPolylineCoordsFromYValues(width float64, height float64, values []float6
 		return ""
 	}
 
-	verticalPadding := height * 0.02
-	height -= verticalPadding * 2
-	coordinates := make([]string, len(values))
-	distanceBetweenPoints := width / float64(len(values)-1)
-	min := slices.Min(values)
-	max := slices.Max(values)
-
-	for i := range values {
-		coordinates[i] = fmt.Sprintf(
-			"%.2f,%.2f",
-			float64(i)*distanceBetweenPoints,
-			((max-values[i])/(max-min))*height+verticalPadding,
-		)
-	}
-
-	return strings.Join(coordinates, " ")
+	return chart.Canvas{
+		Width:   width,
+		Height:  height,
+		Padding: height * 0.02,
+		Bounds:  chart.BoundsOf(values, nil, nil),
+	}.Polyline(values)
 }
 
 func MaybeCopySliceWithoutZeroValues[T int | float64](values []T) []T {
@@ -170,7 +195,7 @@ func TitleToSlug(s string) string {
 
 func ExecuteTemplateToString(t *template.Template, data any) (string, error) {
 	var b bytes.Buffer
-	err := t.Execute(&b, data)
+	err := OverriddenTemplate(t).Execute(&b, data)
 	if err != nil {
 		return "", fmt.Errorf("executing template: %w", err)
 	}
@@ -253,15 +278,65 @@ func HslToHex(h, s, l float64) string {
 	return fmt.Sprintf("#%02x%02x%02x", ir, ig, ib)
 }
 
+// Accepts colors in the #rrggbb format, with or without the #
+func HexToHsl(hex string) (h, s, l float64, err error) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return 0, 0, 0, fmt.Errorf("invalid hex color: %s", hex)
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid hex color: %s", hex)
+	}
+
+	r := float64(value>>16&0xff) / 255.0
+	g := float64(value>>8&0xff) / 255.0
+	b := float64(value&0xff) / 255.0
+
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	l = (max + min) / 2
+
+	if max != min {
+		d := max - min
+		if l > 0.5 {
+			s = d / (2 - max - min)
+		} else {
+			s = d / (max + min)
+		}
+
+		switch max {
+		case r:
+			h = (g - b) / d
+			if g < b {
+				h += 6
+			}
+		case g:
+			h = (b-r)/d + 2
+		default:
+			h = (r-g)/d + 4
+		}
+		h *= 60
+	}
+
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+
+	return round(h), round(s * 100), round(l * 100), nil
+}
+
 func MustParseTemplate(primary string, dependencies ...string) *template.Template {
+	files := append([]string{primary}, dependencies...)
 	t, err := template.New(primary).
 		Funcs(web.GlobalTemplateFunctions).
-		ParseFS(web.TemplateFS, append([]string{primary}, dependencies...)...)
+		ParseFS(web.TemplateFS, files...)
 
 	if err != nil {
 		panic(err)
 	}
 
+	templateFiles[t] = files
+
 	return t
 }
 
@@ -331,3 +406,40 @@ var GlobalTemplateFunctions = template.FuncMap{
 		return template.HTML(value + ` <span class="color-base size-h5">` + label + `</span>`)
 	},
 }
+
+var (
+	scriptTagPattern       = regexp.MustCompile(`(?i)<script\b[^>]*>`)
+	scriptSourcePattern    = regexp.MustCompile(`(?i)\ssrc\s*=\s*["']?([^"'\s>]+)`)
+	externalOriginsPattern = regexp.MustCompile(`^(https?://[^/?#]+)`)
+	inlineHandlerPattern   = regexp.MustCompile(`(?i)(<[^>]+\son[a-z]+\s*=|javascript:)`)
+)
+
+// Returns the origins of external scripts within some HTML and whether it
+// contains inline scripts, including event handler attributes, so that a
+// Content-Security-Policy can allow them
+func ScriptSourcesOfHTML(html string) (origins []string, hasInline bool) {
+	hasInline = inlineHandlerPattern.MatchString(html)
+
+	for _, tag := range scriptTagPattern.FindAllString(html, -1) {
+		source := scriptSourcePattern.FindStringSubmatch(tag)
+		if source == nil {
+			hasInline = true
+			continue
+		}
+
+		if origin := externalOriginsPattern.FindStringSubmatch(source[1]); origin != nil && !slices.Contains(origins, origin[1]) {
+			origins = append(origins, origin[1])
+		}
+	}
+
+	return origins, hasInline
+}
+
+// Returns the scheme and host of a URL, or an empty string if it isn't absolute
+func OriginOfURL(rawURL string) string {
+	if origin := externalOriginsPattern.FindStringSubmatch(rawURL); origin != nil {
+		return origin[1]
+	}
+
+	return ""
+}
@@ -0,0 +1,88 @@
+package common
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// How much of the HTML that comes from remote sources, such as the
+// descriptions of feed items, is kept when it gets rendered
+const (
+	// Only the text is kept
+	HTMLPolicyStrict = "strict"
+	// Formatting, links, lists, tables and images are kept, anything that can
+	// run scripts or change the rest of the page isn't
+	HTMLPolicyRelaxed = "relaxed"
+	// Everything is kept as it is, only meant for sources that are fully trusted
+	HTMLPolicyUnsafe = "unsafe"
+)
+
+var (
+	strictHTMLPolicy  = bluemonday.StrictPolicy()
+	relaxedHTMLPolicy = newRelaxedHTMLPolicy()
+)
+
+func newRelaxedHTMLPolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	// lets the HTML make use of the styles that come with the dashboard
+	policy.AllowAttrs("class").Globally()
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+	policy.RequireNoReferrerOnFullyQualifiedLinks(true)
+
+	return policy
+}
+
+func ValidateHTMLPolicy(policy string) error {
+	switch policy {
+	case HTMLPolicyStrict, HTMLPolicyRelaxed, HTMLPolicyUnsafe:
+		return nil
+	default:
+		return fmt.Errorf(
+			"unknown html-policy %q, must be one of %s, %s or %s",
+			policy, HTMLPolicyStrict, HTMLPolicyRelaxed, HTMLPolicyUnsafe,
+		)
+	}
+}
+
+// Returns the HTML as it should be rendered under the policy, which is escaped
+// text for the strict policy. Tags left open by the relaxed policy get closed
+// so that they can't affect the rest of the page.
+func SanitizeHTML(policy, value string) template.HTML {
+	switch policy {
+	case HTMLPolicyUnsafe:
+		return template.HTML(value)
+	case HTMLPolicyRelaxed:
+		return template.HTML(balanceHTML(relaxedHTMLPolicy.Sanitize(value)))
+	default:
+		return template.HTML(strictHTMLPolicy.Sanitize(value))
+	}
+}
+
+// The text of the HTML, unescaped so that it can be used as a plain string
+func HTMLToText(value string) string {
+	return html.UnescapeString(strictHTMLPolicy.Sanitize(value))
+}
+
+func balanceHTML(value string) string {
+	context := &nethtml.Node{Type: nethtml.ElementNode, DataAtom: atom.Div, Data: "div"}
+
+	nodes, err := nethtml.ParseFragment(strings.NewReader(value), context)
+	if err != nil {
+		return html.EscapeString(HTMLToText(value))
+	}
+
+	var balanced strings.Builder
+	for _, node := range nodes {
+		if err := nethtml.Render(&balanced, node); err != nil {
+			return html.EscapeString(HTMLToText(value))
+		}
+	}
+
+	return balanced.String()
+}
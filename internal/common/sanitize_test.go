@@ -0,0 +1,74 @@
+package common
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		policy   string
+		value    string
+		expected template.HTML
+	}{
+		{HTMLPolicyStrict, `<b>bold</b> text`, `bold text`},
+		{HTMLPolicyStrict, `<script>alert(1)</script>text`, `text`},
+		{HTMLPolicyStrict, `Tom & Jerry`, `Tom &amp; Jerry`},
+		{"", `<i>unknown</i>`, `unknown`},
+		{HTMLPolicyRelaxed, `<b class="color-primary">bold</b>`, `<b class="color-primary">bold</b>`},
+		{HTMLPolicyRelaxed, `<p onclick="alert(1)">text</p>`, `<p>text</p>`},
+		{HTMLPolicyRelaxed, `<script>alert(1)</script><p>text</p>`, `<p>text</p>`},
+		{HTMLPolicyRelaxed, `<a href="javascript:alert(1)">link</a>`, `link`},
+		{
+			HTMLPolicyRelaxed,
+			`<a href="https://example.com">link</a>`,
+			`<a href="https://example.com" rel="nofollow noreferrer noopener" target="_blank">link</a>`,
+		},
+		{HTMLPolicyRelaxed, `<div><b>left open`, `<div><b>left open</b></div>`},
+		{HTMLPolicyRelaxed, `closed</div></div> after`, `closed after`},
+		{HTMLPolicyRelaxed, `<iframe src="https://example.com"></iframe>`, ``},
+		{HTMLPolicyUnsafe, `<script>alert(1)</script>`, `<script>alert(1)</script>`},
+	}
+
+	for _, test := range tests {
+		if got := SanitizeHTML(test.policy, test.value); got != test.expected {
+			t.Errorf("SanitizeHTML(%q, %q) = %q, expected %q", test.policy, test.value, got, test.expected)
+		}
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{`<p>Tom &amp; Jerry</p>`, `Tom & Jerry`},
+		{`<img src="x" onerror="alert(1)">caption`, `caption`},
+		{`plain`, `plain`},
+	}
+
+	for _, test := range tests {
+		if got := HTMLToText(test.value); got != test.expected {
+			t.Errorf("HTMLToText(%q) = %q, expected %q", test.value, got, test.expected)
+		}
+	}
+}
+
+func TestValidateHTMLPolicy(t *testing.T) {
+	tests := []struct {
+		policy    string
+		expectErr bool
+	}{
+		{HTMLPolicyStrict, false},
+		{HTMLPolicyRelaxed, false},
+		{HTMLPolicyUnsafe, false},
+		{"", true},
+		{"loose", true},
+	}
+
+	for _, test := range tests {
+		if err := ValidateHTMLPolicy(test.policy); (err != nil) != test.expectErr {
+			t.Errorf("ValidateHTMLPolicy(%q) = %v, expected error: %v", test.policy, err, test.expectErr)
+		}
+	}
+}
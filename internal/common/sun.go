@@ -0,0 +1,67 @@
+package common
+
+import (
+	"math"
+	"time"
+)
+
+// Elevation of the center of the sun at which its upper edge touches the
+// horizon, accounting for refraction
+const sunriseElevation = -0.833
+
+// Reports whether the sun is up at the given coordinates, which is accurate to
+// within a minute or two of the actual sunrise and sunset
+func IsDaytime(t time.Time, latitude, longitude float64) bool {
+	return solarElevation(t, latitude, longitude) > sunriseElevation
+}
+
+// Returns the next time after t at which the sun rises or sets, looking at
+// most a day ahead since there's none during polar days and nights
+func NextSunTransition(t time.Time, latitude, longitude float64) (time.Time, bool) {
+	const step = 10 * time.Minute
+
+	daytime := IsDaytime(t, latitude, longitude)
+	for before := t; before.Before(t.Add(24 * time.Hour)); before = before.Add(step) {
+		after := before.Add(step)
+		if IsDaytime(after, latitude, longitude) == daytime {
+			continue
+		}
+
+		for after.Sub(before) > time.Minute {
+			middle := before.Add(after.Sub(before) / 2)
+			if IsDaytime(middle, latitude, longitude) == daytime {
+				before = middle
+			} else {
+				after = middle
+			}
+		}
+
+		return after, true
+	}
+
+	return time.Time{}, false
+}
+
+// Based on the approximation from the Astronomical Almanac, in degrees
+func solarElevation(t time.Time, latitude, longitude float64) float64 {
+	const rad = math.Pi / 180
+
+	// days since J2000.0
+	d := float64(t.UnixMilli())/86400000 - 10957.5
+
+	meanAnomaly := (357.529 + 0.98560028*d) * rad
+	meanLongitude := 280.459 + 0.98564736*d
+	eclipticLongitude := (meanLongitude + 1.915*math.Sin(meanAnomaly) + 0.020*math.Sin(2*meanAnomaly)) * rad
+	obliquity := (23.439 - 0.00000036*d) * rad
+
+	rightAscension := math.Atan2(math.Cos(obliquity)*math.Sin(eclipticLongitude), math.Cos(eclipticLongitude))
+	declination := math.Asin(math.Sin(obliquity) * math.Sin(eclipticLongitude))
+
+	siderealTime := (280.46061837 + 360.98564736629*d + longitude) * rad
+	hourAngle := siderealTime - rightAscension
+
+	lat := latitude * rad
+	elevation := math.Asin(math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Cos(hourAngle))
+
+	return elevation / rad
+}
@@ -0,0 +1,111 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/limpdev/gander/internal/web"
+)
+
+// The files each template parsed by MustParseTemplate was made from, only
+// written to while packages get initialized
+var templateFiles = make(map[*template.Template][]string)
+
+// Versions of the embedded templates that were parsed with one or more of
+// their files replaced by the user's
+var templateOverrides atomic.Pointer[map[*template.Template]*template.Template]
+
+// Returns the user's version of a template parsed by MustParseTemplate when
+// there is one, otherwise the template itself
+func OverriddenTemplate(t *template.Template) *template.Template {
+	if overrides := templateOverrides.Load(); overrides != nil {
+		if overridden, ok := (*overrides)[t]; ok {
+			return overridden
+		}
+	}
+
+	return t
+}
+
+// Parses the embedded templates again with the files in dir taking the place
+// of the embedded files that have the same name, and returns how many files
+// were overridden. A dir that doesn't exist removes any previous overrides,
+// while a file that fails to parse leaves them as they were.
+func LoadTemplateOverrides(dir string) (int, error) {
+	if dir == "" {
+		templateOverrides.Store(nil)
+		return 0, nil
+	}
+
+	userFiles := make(map[string][]byte)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("reading templates directory: %v", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		// files that don't replace an embedded template could only be used
+		// by other overrides, which would break as soon as they get removed
+		if _, err := fs.Stat(web.TemplateFS, entry.Name()); err != nil {
+			continue
+		}
+
+		contents, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return 0, fmt.Errorf("reading template: %v", err)
+		}
+
+		userFiles[entry.Name()] = contents
+	}
+
+	overrides := make(map[*template.Template]*template.Template)
+
+	for original, files := range templateFiles {
+		overridden := false
+		for _, file := range files {
+			if _, ok := userFiles[file]; ok {
+				overridden = true
+				break
+			}
+		}
+
+		if !overridden {
+			continue
+		}
+
+		t := template.New(files[0]).Funcs(web.GlobalTemplateFunctions)
+		for _, file := range files {
+			contents, ok := userFiles[file]
+			if !ok {
+				if contents, err = fs.ReadFile(web.TemplateFS, file); err != nil {
+					return 0, err
+				}
+			}
+
+			target := t
+			if file != t.Name() {
+				target = t.New(file)
+			}
+
+			if _, err := target.Parse(string(contents)); err != nil {
+				return 0, fmt.Errorf("parsing template %s: %v", file, err)
+			}
+		}
+
+		overrides[original] = t
+	}
+
+	templateOverrides.Store(&overrides)
+
+	return len(userFiles), nil
+}
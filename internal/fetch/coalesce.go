@@ -0,0 +1,114 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Widgets commonly point at the same sources (the same feed in multiple RSS
+// widgets, the same repository in a releases and a repository widget, etc.)
+// and since they all get updated together, identical requests that are in
+// flight at the same time get sent once and the response is shared between
+// everyone that asked for it.
+
+type inflightCall struct {
+	done     chan struct{}
+	response *http.Response
+	body     []byte
+	err      error
+}
+
+func isCoalescable(request *http.Request) bool {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		return false
+	}
+
+	return request.Body == nil || request.Body == http.NoBody
+}
+
+func coalesceKey(request *http.Request) string {
+	var key strings.Builder
+
+	key.WriteString(request.Method)
+	key.WriteByte(' ')
+	key.WriteString(request.URL.String())
+	// requests with different size limits can't share a response since the
+	// limit of one could fail the others
+	key.WriteByte(' ')
+	key.WriteString(strconv.FormatInt(maxResponseSizeFor(request), 10))
+
+	headerNames := make([]string, 0, len(request.Header))
+	for name := range request.Header {
+		headerNames = append(headerNames, name)
+	}
+	slices.Sort(headerNames)
+
+	for _, name := range headerNames {
+		key.WriteByte('\n')
+		key.WriteString(name)
+		key.WriteByte(':')
+		key.WriteString(strings.Join(request.Header[name], ","))
+	}
+
+	return key.String()
+}
+
+func (t *transport) coalescedRoundTrip(request *http.Request) (*http.Response, error) {
+	key := coalesceKey(request)
+
+	t.inflightMu.Lock()
+	if call, exists := t.inflight[key]; exists {
+		t.inflightMu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+
+		// The request that was actually sent got canceled or timed out on its own,
+		// that shouldn't fail everyone else so send it again instead
+		if errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded) {
+			return t.limitedRoundTrip(request)
+		}
+
+		return call.responseFor(request)
+	}
+
+	call := &inflightCall{done: make(chan struct{})}
+	t.inflight[key] = call
+	t.inflightMu.Unlock()
+
+	call.response, call.err = t.limitedRoundTrip(request)
+	if call.err == nil {
+		call.body, call.err = io.ReadAll(call.response.Body)
+		call.response.Body.Close()
+	}
+
+	t.inflightMu.Lock()
+	delete(t.inflight, key)
+	t.inflightMu.Unlock()
+	close(call.done)
+
+	return call.responseFor(request)
+}
+
+func (call *inflightCall) responseFor(request *http.Request) (*http.Response, error) {
+	if call.err != nil {
+		return nil, call.err
+	}
+
+	response := *call.response
+	response.Header = call.response.Header.Clone()
+	response.Body = io.NopCloser(bytes.NewReader(call.body))
+	response.ContentLength = int64(len(call.body))
+	response.Request = request
+
+	return &response, nil
+}
@@ -0,0 +1,246 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Long enough for every goroutine that was started to have joined the
+// request that's in flight before the server gets to respond
+const coalesceJoinDelay = 100 * time.Millisecond
+
+func newCoalesceTestClient() *http.Client {
+	return &http.Client{Transport: newTransport(&http.Transport{})}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	newRequest := func(method, url string, headers ...string) *http.Request {
+		request := httptest.NewRequest(method, url, nil)
+		request.Header = http.Header{}
+		for i := 0; i < len(headers); i += 2 {
+			request.Header.Add(headers[i], headers[i+1])
+		}
+		return request
+	}
+
+	a := newRequest("GET", "https://example.com/feed", "Accept", "application/json", "Authorization", "token a")
+	b := newRequest("GET", "https://example.com/feed", "Authorization", "token a", "Accept", "application/json")
+	if coalesceKey(a) != coalesceKey(b) {
+		t.Error("Order in which headers were set changed the key")
+	}
+
+	if coalesceKey(a) == coalesceKey(newRequest("GET", "https://example.com/feed", "Accept", "application/json", "Authorization", "token b")) {
+		t.Error("Requests with different credentials share a key")
+	}
+
+	if coalesceKey(a) == coalesceKey(newRequest("HEAD", "https://example.com/feed", "Accept", "application/json", "Authorization", "token a")) {
+		t.Error("Requests with different methods share a key")
+	}
+
+	if coalesceKey(a) == coalesceKey(newRequest("GET", "https://example.com/feed?page=2", "Accept", "application/json", "Authorization", "token a")) {
+		t.Error("Requests with different queries share a key")
+	}
+
+	limited := a.WithContext(context.WithValue(a.Context(), maxResponseSizeKey{}, int64(1024)))
+	if coalesceKey(a) == coalesceKey(limited) {
+		t.Error("Requests with different size limits share a key")
+	}
+}
+
+func TestIsCoalescable(t *testing.T) {
+	if !isCoalescable(httptest.NewRequest("GET", "https://example.com", nil)) {
+		t.Error("GET request without a body isn't coalescable")
+	}
+
+	if !isCoalescable(httptest.NewRequest("HEAD", "https://example.com", nil)) {
+		t.Error("HEAD request isn't coalescable")
+	}
+
+	if isCoalescable(httptest.NewRequest("POST", "https://example.com", nil)) {
+		t.Error("POST request is coalescable")
+	}
+
+	withBody, _ := http.NewRequest("GET", "https://example.com", strings.NewReader("query"))
+	if isCoalescable(withBody) {
+		t.Error("GET request with a body is coalescable")
+	}
+}
+
+func TestIdenticalRequestsAreSentOnce(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		w.Header().Set("X-Shared", "original")
+		io.WriteString(w, "shared body")
+	}))
+	defer server.Close()
+
+	client := newCoalesceTestClient()
+
+	const callers = 5
+	responses := make([]*http.Response, callers)
+	errs := make([]error, callers)
+
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], errs[i] = client.Get(server.URL)
+		}()
+	}
+
+	time.Sleep(coalesceJoinDelay)
+	close(release)
+	wg.Wait()
+
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("Server got %d requests, expected 1", got)
+	}
+
+	for i := range callers {
+		if errs[i] != nil {
+			t.Fatalf("Caller %d failed: %v", i, errs[i])
+		}
+
+		// every caller gets its own copy of the body and headers, reading or
+		// changing one must not affect the others
+		body, err := io.ReadAll(responses[i].Body)
+		responses[i].Body.Close()
+		if err != nil {
+			t.Fatalf("Caller %d failed to read the body: %v", i, err)
+		}
+		if string(body) != "shared body" {
+			t.Errorf("Caller %d got body %q", i, body)
+		}
+
+		if got := responses[i].Header.Get("X-Shared"); got != "original" {
+			t.Errorf("Caller %d got header %q", i, got)
+		}
+		responses[i].Header.Set("X-Shared", "changed")
+	}
+}
+
+func TestRequestsAreNotCoalescedOnceDone(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+
+	client := newCoalesceTestClient()
+	for range 3 {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		response.Body.Close()
+	}
+
+	if got := hits.Load(); got != 3 {
+		t.Errorf("Server got %d requests, expected 3", got)
+	}
+}
+
+func TestCanceledRequestDoesNotFailTheOthers(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request hangs until its client gives up on it
+		if hits.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, "resent")
+	}))
+	defer server.Close()
+
+	client := newCoalesceTestClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() {
+		request, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+		_, err := client.Do(request)
+		firstDone <- err
+	}()
+
+	for hits.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	secondDone := make(chan struct{})
+	var body []byte
+	var err error
+	go func() {
+		defer close(secondDone)
+		var response *http.Response
+		response, err = client.Get(server.URL)
+		if err != nil {
+			return
+		}
+		defer response.Body.Close()
+		body, err = io.ReadAll(response.Body)
+	}()
+
+	time.Sleep(coalesceJoinDelay)
+	cancel()
+
+	if err := <-firstDone; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the canceled request to fail with %v, got %v", context.Canceled, err)
+	}
+
+	<-secondDone
+	if err != nil {
+		t.Fatalf("Request that joined the canceled one failed: %v", err)
+	}
+	if string(body) != "resent" {
+		t.Errorf("Got body %q, expected it to come from a new request", body)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("Server got %d requests, expected 2", got)
+	}
+}
+
+func TestWaitingRequestCanBeCanceled(t *testing.T) {
+	release := make(chan struct{})
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := newCoalesceTestClient()
+
+	go func() {
+		response, err := client.Get(server.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+	}()
+
+	for hits.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	_, err := client.Do(request)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the waiting request to give up with %v, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,42 @@
+package fetch
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// Returns a copy of the client that adds the size of every response body it
+// reads to counter, used to tell how much data each widget fetches
+func WithByteCounter(client *http.Client, counter *atomic.Int64) *http.Client {
+	return &http.Client{
+		Transport: &countingTransport{base: client.Transport, counter: counter},
+		Timeout:   client.Timeout,
+	}
+}
+
+type countingTransport struct {
+	base    http.RoundTripper
+	counter *atomic.Int64
+}
+
+func (t *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.base.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response.Body = &countingReadCloser{ReadCloser: response.Body, counter: t.counter}
+	return response, nil
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	counter *atomic.Int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.counter.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,134 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+)
+
+var UserAgent = "Gander/" + common.BuildVersion + " +https://github.com/limpdev/gander"
+
+var (
+	secureTransport = newTransport(&http.Transport{
+		MaxIdleConnsPerHost: 10,
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         DialContext,
+	})
+
+	insecureTransport = newTransport(&http.Transport{
+		MaxIdleConnsPerHost: 10,
+		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         DialContext,
+	})
+)
+
+var Client = &http.Client{
+	Transport: secureTransport,
+	Timeout:   common.DefaultClientTimeout,
+}
+
+var InsecureClient = &http.Client{
+	Transport: insecureTransport,
+	Timeout:   common.DefaultClientTimeout,
+}
+
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Returns a client that shares its connection pool and per-host limits with
+// the default clients, a timeout of 0 or less uses the default timeout
+func NewClient(timeout time.Duration, allowInsecure bool) *http.Client {
+	client := common.Ternary(allowInsecure, InsecureClient, Client)
+
+	if timeout <= 0 {
+		return client
+	}
+
+	return &http.Client{
+		Transport: client.Transport,
+		Timeout:   timeout,
+	}
+}
+
+var browserUserAgentVersion atomic.Int32
+
+func BrowserUserAgent() string {
+	if rand.IntN(2000) == 0 {
+		browserUserAgentVersion.Store(rand.Int32N(5))
+	}
+
+	version := strconv.Itoa(130 + int(browserUserAgentVersion.Load()))
+	return "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:" + version + ".0) Gecko/20100101 Firefox/" + version + ".0"
+}
+
+func SetBrowserUserAgent(request *http.Request) {
+	request.Header.Set("User-Agent", BrowserUserAgent())
+}
+
+func DecodeJSON[T any](client Doer, request *http.Request) (T, error) {
+	return decode[T](client, request, json.Unmarshal)
+}
+
+func DecodeJSONTask[T any](client Doer) func(*http.Request) (T, error) {
+	return func(request *http.Request) (T, error) {
+		return DecodeJSON[T](client, request)
+	}
+}
+
+func DecodeXML[T any](client Doer, request *http.Request) (T, error) {
+	return decode[T](client, request, xml.Unmarshal)
+}
+
+func DecodeXMLTask[T any](client Doer) func(*http.Request) (T, error) {
+	return func(request *http.Request) (T, error) {
+		return DecodeXML[T](client, request)
+	}
+}
+
+func decode[T any](client Doer, request *http.Request, unmarshal func([]byte, any) error) (T, error) {
+	var result T
+
+	response, err := client.Do(request)
+	if err != nil {
+		return result, err
+	}
+	defer response.Body.Close()
+
+	contentType := response.Header.Get("Content-Type")
+	if response.StatusCode == http.StatusOK && !isTextContentType(contentType) {
+		return result, fmt.Errorf("unexpected content type %q from %s", contentType, request.URL)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return result, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		truncatedBody, _ := common.LimitStringLength(string(body), 256)
+
+		return result, fmt.Errorf(
+			"unexpected status code %d from %s, response: %s",
+			response.StatusCode,
+			request.URL,
+			truncatedBody,
+		)
+	}
+
+	if err = unmarshal(body, &result); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
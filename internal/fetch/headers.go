@@ -0,0 +1,60 @@
+package fetch
+
+import (
+	"net/http"
+)
+
+// Credentials sent with the Authorization header of every request
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Returns a copy of the client that adds the headers and basic auth to every
+// request it sends. Headers that the request already has and the credentials
+// of requests that are already authorized are left as they are, so that the
+// ones set by the widgets themselves take precedence.
+func WithHeaders(client *http.Client, headers map[string]string, basicAuth *BasicAuth) *http.Client {
+	if len(headers) == 0 && basicAuth == nil {
+		return client
+	}
+
+	return &http.Client{
+		Transport: &headersTransport{base: client.Transport, headers: headers, basicAuth: basicAuth},
+		Timeout:   client.Timeout,
+	}
+}
+
+type headersTransport struct {
+	base      http.RoundTripper
+	headers   map[string]string
+	basicAuth *BasicAuth
+}
+
+func (t *headersTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	// same as the client does with the Authorization header, nothing gets added
+	// once the request has been redirected to a different host
+	original := request
+	for original.Response != nil && original.Response.Request != nil {
+		original = original.Response.Request
+	}
+
+	if original.URL.Host != request.URL.Host {
+		return t.base.RoundTrip(request)
+	}
+
+	// round trippers must not modify the request they're given
+	request = request.Clone(request.Context())
+
+	for key, value := range t.headers {
+		if request.Header.Get(key) == "" {
+			request.Header.Set(key, value)
+		}
+	}
+
+	if t.basicAuth != nil && request.Header.Get("Authorization") == "" {
+		request.SetBasicAuth(t.basicAuth.Username, t.basicAuth.Password)
+	}
+
+	return t.base.RoundTrip(request)
+}
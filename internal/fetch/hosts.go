@@ -0,0 +1,266 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var ErrHostNotAllowed = errors.New("host not allowed")
+
+// Which hosts requests can be sent to, shared by the whole process. Hosts can
+// be listed by name, by name with a leading wildcard such as *.example.com
+// which matches its subdomains, by IP address or by CIDR range. Blocked hosts
+// take precedence over allowed ones, and when any hosts are allowed then
+// everything else is blocked.
+type HostPolicy struct {
+	allowed hostPatterns
+	blocked hostPatterns
+}
+
+type hostPatterns struct {
+	any      bool
+	names    []string
+	suffixes []string
+	prefixes []netip.Prefix
+}
+
+var hostPolicy atomic.Pointer[HostPolicy]
+
+// A nil policy lets requests go anywhere
+func SetHostPolicy(policy *HostPolicy) {
+	hostPolicy.Store(policy)
+
+	// connections made under the previous policy shouldn't get reused
+	secureTransport.base.CloseIdleConnections()
+	insecureTransport.base.CloseIdleConnections()
+}
+
+// Returns nil when neither list has any hosts
+func NewHostPolicy(allowed, blocked []string) (*HostPolicy, error) {
+	if len(allowed) == 0 && len(blocked) == 0 {
+		return nil, nil
+	}
+
+	allowedPatterns, err := parseHostPatterns(allowed)
+	if err != nil {
+		return nil, fmt.Errorf("allowed-hosts: %w", err)
+	}
+
+	blockedPatterns, err := parseHostPatterns(blocked)
+	if err != nil {
+		return nil, fmt.Errorf("blocked-hosts: %w", err)
+	}
+
+	return &HostPolicy{allowed: allowedPatterns, blocked: blockedPatterns}, nil
+}
+
+func parseHostPatterns(patterns []string) (hostPatterns, error) {
+	var parsed hostPatterns
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+
+		switch {
+		case pattern == "":
+			return parsed, errors.New("hosts can't be empty")
+		case pattern == "*":
+			parsed.any = true
+		case strings.Contains(pattern, "/"):
+			prefix, err := netip.ParsePrefix(pattern)
+			if err != nil {
+				return parsed, fmt.Errorf("invalid CIDR range %q", pattern)
+			}
+
+			parsed.prefixes = append(parsed.prefixes, prefix.Masked())
+		case strings.HasPrefix(pattern, "*."):
+			parsed.suffixes = append(parsed.suffixes, pattern[1:])
+		case strings.Contains(pattern, "*"):
+			return parsed, fmt.Errorf("invalid host %q, wildcards can only be used as in *.example.com", pattern)
+		default:
+			if addr, err := netip.ParseAddr(strings.Trim(pattern, "[]")); err == nil {
+				parsed.prefixes = append(parsed.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			} else {
+				parsed.names = append(parsed.names, pattern)
+			}
+		}
+	}
+
+	return parsed, nil
+}
+
+func (p *hostPatterns) isEmpty() bool {
+	return !p.any && len(p.names) == 0 && len(p.suffixes) == 0 && len(p.prefixes) == 0
+}
+
+func (p *hostPatterns) matchesName(host string) bool {
+	if p.any || slices.Contains(p.names, host) {
+		return true
+	}
+
+	for _, suffix := range p.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *hostPatterns) matchesAddr(addr netip.Addr) bool {
+	if p.any {
+		return true
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// An invalid addr only checks the name of the host
+func (p *HostPolicy) allows(host string, addr netip.Addr) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if p.blocked.matchesName(host) || addr.IsValid() && p.blocked.matchesAddr(addr) {
+		return false
+	}
+
+	if p.allowed.isEmpty() {
+		return true
+	}
+
+	return p.allowed.matchesName(host) || addr.IsValid() && p.allowed.matchesAddr(addr)
+}
+
+// Whether the addresses of the host are needed to tell if it's allowed, in
+// which case the host gets resolved before the request is sent
+func (p *HostPolicy) needsAddrs(host string) bool {
+	return len(p.blocked.prefixes) > 0 || len(p.allowed.prefixes) > 0 && !p.allowed.matchesName(host)
+}
+
+// Checks the host before anything is sent to it, which only needs one of the
+// addresses that it resolves to be allowed since connections are only made to
+// the allowed ones. They get checked again when connecting in case they changed.
+func (p *HostPolicy) check(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !p.allows(host, addr) {
+			return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+		}
+
+		return nil
+	}
+
+	if !p.needsAddrs(host) {
+		if !p.allows(host, netip.Addr{}) {
+			return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+		}
+
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if p.allows(host, addr) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+}
+
+type hostPolicyTargetKey struct{}
+
+// Checks the host of the request and remembers it so that connections to a
+// proxy, whose address is a different host, aren't held to the same checks
+func checkRequestHost(ctx context.Context, host string) (context.Context, error) {
+	policy := hostPolicy.Load()
+	denyPrivate := deniesPrivateAddresses(ctx)
+
+	if policy == nil && !denyPrivate {
+		return ctx, nil
+	}
+
+	if policy != nil {
+		if err := policy.check(ctx, host); err != nil {
+			return ctx, err
+		}
+	}
+
+	if denyPrivate {
+		if err := checkNotPrivate(ctx, host); err != nil {
+			return ctx, err
+		}
+	}
+
+	return context.WithValue(ctx, hostPolicyTargetKey{}, host), nil
+}
+
+var dialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// Connects to the address as long as the host policy allows it and, for the
+// requests of clients that don't allow them, the address isn't private. Also
+// used by widgets that connect to services without going through a client.
+func DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	policy := hostPolicy.Load()
+	denyPrivate := deniesPrivateAddresses(ctx)
+
+	if policy == nil && !denyPrivate {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	target, checked := ctx.Value(hostPolicyTargetKey{}).(string)
+	if checked && target != host {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	if !checked && policy != nil {
+		if err := policy.check(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+
+	policyDialer := *dialer
+	policyDialer.Control = func(_, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+
+		addr := addrPort.Addr()
+		if denyPrivate && isPrivateAddr(addr) {
+			return fmt.Errorf("%w: %s (%s)", ErrPrivateAddress, host, addr.Unmap())
+		}
+
+		if policy != nil && !policy.allows(host, addr) {
+			return fmt.Errorf("%w: %s (%s)", ErrHostNotAllowed, host, addr.Unmap())
+		}
+
+		return nil
+	}
+
+	return policyDialer.DialContext(ctx, network, address)
+}
@@ -0,0 +1,108 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestHostPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		blocked []string
+		host    string
+		addr    string
+		allows  bool
+	}{
+		{"nothing listed", nil, []string{"other.com"}, "example.com", "", true},
+		{"allowed by name", []string{"example.com"}, nil, "example.com", "", true},
+		{"name is case insensitive", []string{"Example.COM."}, nil, "EXAMPLE.com.", "", true},
+		{"not allowed by name", []string{"example.com"}, nil, "other.com", "", false},
+		{"subdomain allowed by wildcard", []string{"*.example.com"}, nil, "api.example.com", "", true},
+		{"domain itself isn't matched by wildcard", []string{"*.example.com"}, nil, "example.com", "", false},
+		{"wildcard doesn't match other suffixes", []string{"*.example.com"}, nil, "badexample.com", "", false},
+		{"allowed by CIDR range", []string{"10.0.0.0/8"}, nil, "nas.lan", "10.1.2.3", true},
+		{"not in CIDR range", []string{"10.0.0.0/8"}, nil, "nas.lan", "192.168.1.1", false},
+		{"allowed by IP", []string{"192.0.2.1"}, nil, "192.0.2.1", "192.0.2.1", true},
+		{"mapped IPv4 matches IPv4 range", []string{"192.0.2.0/24"}, nil, "host", "::ffff:192.0.2.7", true},
+		{"allowed by IPv6 range", []string{"2001:db8::/32"}, nil, "host", "2001:db8::1", true},
+		{"blocked takes precedence", []string{"*.example.com"}, []string{"admin.example.com"}, "admin.example.com", "", false},
+		{"blocked CIDR range", nil, []string{"169.254.0.0/16"}, "metadata", "169.254.169.254", false},
+		{"blocked by any", []string{"example.com"}, []string{"*"}, "example.com", "", false},
+		{"allowed by any", []string{"*"}, []string{"10.0.0.0/8"}, "anything.com", "203.0.113.1", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := NewHostPolicy(test.allowed, test.blocked)
+			if err != nil {
+				t.Fatalf("Failed to create host policy: %v", err)
+			}
+
+			var addr netip.Addr
+			if test.addr != "" {
+				addr = netip.MustParseAddr(test.addr)
+			}
+
+			if got := policy.allows(test.host, addr); got != test.allows {
+				t.Errorf("allows(%q, %q) = %v, expected %v", test.host, test.addr, got, test.allows)
+			}
+		})
+	}
+}
+
+func TestNewHostPolicy(t *testing.T) {
+	tests := []struct {
+		allowed   []string
+		blocked   []string
+		expectNil bool
+		expectErr bool
+	}{
+		{nil, nil, true, false},
+		{[]string{"example.com", "*.example.com", "10.0.0.0/8", "::1"}, nil, false, false},
+		{nil, []string{""}, false, true},
+		{[]string{"10.0.0.0/33"}, nil, false, true},
+		{[]string{"api.*.com"}, nil, false, true},
+		{[]string{"*example.com"}, nil, false, true},
+	}
+
+	for _, test := range tests {
+		policy, err := NewHostPolicy(test.allowed, test.blocked)
+		if (err != nil) != test.expectErr {
+			t.Errorf("NewHostPolicy(%q, %q) error = %v, expected error: %v", test.allowed, test.blocked, err, test.expectErr)
+		}
+		if err == nil && (policy == nil) != test.expectNil {
+			t.Errorf("NewHostPolicy(%q, %q) = %v, expected nil: %v", test.allowed, test.blocked, policy, test.expectNil)
+		}
+	}
+}
+
+func TestHostPolicyCheck(t *testing.T) {
+	policy, err := NewHostPolicy([]string{"*.example.com", "192.0.2.0/24"}, []string{"admin.example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create host policy: %v", err)
+	}
+
+	// none of these need the host to be resolved
+	tests := []struct {
+		host      string
+		expectErr bool
+	}{
+		{"api.example.com", false},
+		{"192.0.2.1", false},
+		{"admin.example.com", true},
+		{"198.51.100.1", true},
+	}
+
+	for _, test := range tests {
+		err := policy.check(context.Background(), test.host)
+		if test.expectErr && !errors.Is(err, ErrHostNotAllowed) {
+			t.Errorf("check(%q) = %v, expected %v", test.host, err, ErrHostNotAllowed)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("check(%q) = %v, expected no error", test.host, err)
+		}
+	}
+}
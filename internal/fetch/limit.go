@@ -0,0 +1,112 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// The most that a single response can be unless the client was given a limit
+// of its own, keeps a URL that points at a large file from using up all of the
+// memory of the process
+const DefaultMaxResponseSize = 20 << 20
+
+var ErrResponseTooLarge = errors.New("response too large")
+
+type maxResponseSizeKey struct{}
+
+// Returns a copy of the client whose responses fail to be read once they go
+// over maxSize bytes, a maxSize of 0 or less uses the default
+func WithMaxResponseSize(client *http.Client, maxSize int64) *http.Client {
+	if maxSize <= 0 {
+		return client
+	}
+
+	return &http.Client{
+		Transport: &maxResponseSizeTransport{base: client.Transport, maxSize: maxSize},
+		Timeout:   client.Timeout,
+	}
+}
+
+type maxResponseSizeTransport struct {
+	base    http.RoundTripper
+	maxSize int64
+}
+
+func (t *maxResponseSizeTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(request.WithContext(
+		context.WithValue(request.Context(), maxResponseSizeKey{}, t.maxSize),
+	))
+}
+
+func maxResponseSizeFor(request *http.Request) int64 {
+	if maxSize, ok := request.Context().Value(maxResponseSizeKey{}).(int64); ok {
+		return maxSize
+	}
+
+	return DefaultMaxResponseSize
+}
+
+func responseTooLargeError(request *http.Request, maxSize int64) error {
+	size := fmt.Sprintf("%d bytes", maxSize)
+	if maxSize%(1<<20) == 0 {
+		size = fmt.Sprintf("%d MB", maxSize>>20)
+	}
+
+	return fmt.Errorf("%w, %s returned more than %s", ErrResponseTooLarge, request.URL.Redacted(), size)
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	request   *http.Request
+	maxSize   int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// the body is only too large if there's anything left after the limit
+		var next [1]byte
+		n, err := b.ReadCloser.Read(next[:])
+		if n > 0 {
+			return 0, responseTooLargeError(b.request, b.maxSize)
+		}
+
+		return 0, err
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+
+	return n, err
+}
+
+// Responses that get decoded are expected to be text, anything else is most
+// likely a URL that points to the wrong place
+func isTextContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	// the subtype of some APIs only contains json rather than ending with it,
+	// such as application/x-amz-json-1.1 which AWS responds with
+	mainType, subtype, _ := strings.Cut(mediaType, "/")
+
+	return mainType == "text" ||
+		strings.Contains(subtype, "json") ||
+		strings.Contains(subtype, "xml") ||
+		strings.HasSuffix(subtype, "javascript")
+}
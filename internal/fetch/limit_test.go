@@ -0,0 +1,35 @@
+package fetch
+
+import "testing"
+
+func TestIsTextContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    bool
+	}{
+		{"", true},
+		{"text/html; charset=utf-8", true},
+		{"text/plain", true},
+		{"application/json", true},
+		{"application/feed+json", true},
+		{"application/vnd.api+json; charset=utf-8", true},
+		{"application/x-amz-json-1.1", true},
+		{"application/x-amz-json-1.0", true},
+		{"application/json-seq", true},
+		{"application/xml", true},
+		{"application/rss+xml", true},
+		{"application/atom+xml; charset=utf-8", true},
+		{"application/javascript", true},
+		{"image/png", false},
+		{"application/octet-stream", false},
+		{"application/pdf", false},
+		{"video/mp4", false},
+		{"not a content type", false},
+	}
+
+	for _, test := range tests {
+		if got := isTextContentType(test.contentType); got != test.expected {
+			t.Errorf("isTextContentType(%q) = %v, expected %v", test.contentType, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+var ErrPrivateAddress = errors.New("private addresses not allowed")
+
+type denyPrivateAddressesKey struct{}
+
+// Returns a copy of the client that refuses to connect to loopback, link-local
+// and private network addresses, for requests to URLs that could have come
+// from someone other than whoever runs the server. Hostnames are checked both
+// before the request is sent and when connecting, so that they can't resolve
+// to a public address when checked and to a private one afterwards.
+func WithoutPrivateAddresses(client *http.Client) *http.Client {
+	return &http.Client{
+		Transport: &denyPrivateAddressesTransport{base: client.Transport},
+		Timeout:   client.Timeout,
+	}
+}
+
+type denyPrivateAddressesTransport struct {
+	base http.RoundTripper
+}
+
+func (t *denyPrivateAddressesTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(request.WithContext(
+		context.WithValue(request.Context(), denyPrivateAddressesKey{}, true),
+	))
+}
+
+func deniesPrivateAddresses(ctx context.Context) bool {
+	deny, _ := ctx.Value(denyPrivateAddressesKey{}).(bool)
+	return deny
+}
+
+func isPrivateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		// connecting to it reaches the machine itself
+		addr.IsUnspecified()
+}
+
+// Unlike the host policy, every address that the host resolves to has to be
+// public, otherwise a connection made earlier to one of the private ones could
+// get reused
+func checkNotPrivate(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if isPrivateAddr(addr) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if isPrivateAddr(addr) {
+			return fmt.Errorf("%w: %s (%s)", ErrPrivateAddress, host, addr.Unmap())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPrivateAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.0.0.1", true},
+		{"172.16.5.4", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"8.8.8.8", false},
+		{"172.32.0.1", false},
+		{"2606:4700:4700::1111", false},
+		{"::ffff:8.8.8.8", false},
+	}
+
+	for _, test := range tests {
+		if got := isPrivateAddr(netip.MustParseAddr(test.addr)); got != test.expected {
+			t.Errorf("isPrivateAddr(%q) = %v, expected %v", test.addr, got, test.expected)
+		}
+	}
+}
+
+func TestWithoutPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	response, err := Client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request with the default client failed: %v", err)
+	}
+	response.Body.Close()
+
+	// the test server listens on loopback, which is exactly what gets refused
+	_, err = WithoutPrivateAddresses(Client).Get(server.URL)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("Expected %v, got %v", ErrPrivateAddress, err)
+	}
+
+	// the restriction only applies to the returned client
+	response, err = Client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Default client got restricted as well: %v", err)
+	}
+	response.Body.Close()
+}
@@ -0,0 +1,37 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// socks5h resolves hostnames through the proxy rather than locally
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+func ValidateProxyURL(proxyURL *url.URL) error {
+	if !slices.Contains(proxySchemes, proxyURL.Scheme) {
+		return fmt.Errorf("unsupported proxy scheme %q, must be one of %s", proxyURL.Scheme, strings.Join(proxySchemes, ", "))
+	}
+
+	if proxyURL.Host == "" {
+		return fmt.Errorf("proxy URL %q has no host", proxyURL.Redacted())
+	}
+
+	return nil
+}
+
+// Returns a transport that sends every request through the proxy, with the
+// same per-host limits as the transports of the default clients. Credentials
+// in the URL are used to authenticate with both HTTP and SOCKS5 proxies.
+func NewProxyTransport(proxyURL *url.URL, allowInsecure bool) http.RoundTripper {
+	return newTransport(&http.Transport{
+		MaxIdleConnsPerHost: 10,
+		TLSClientConfig:     &tls.Config{InsecureSkipVerify: allowInsecure},
+		Proxy:               http.ProxyURL(proxyURL),
+		DialContext:         DialContext,
+	})
+}
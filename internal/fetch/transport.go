@@ -0,0 +1,188 @@
+package fetch
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How many requests to a single host can be in flight at once, anything
+	// above that waits for one of the earlier requests to finish
+	maxConcurrentRequestsPerHost = 10
+	// The minimum amount of time between the start of two requests to the
+	// same host, prevents large dashboards from bursting a host on startup
+	minIntervalBetweenRequestsPerHost = 20 * time.Millisecond
+)
+
+type transport struct {
+	base *http.Transport
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+
+	inflightMu sync.Mutex
+	inflight   map[string]*inflightCall
+}
+
+func newTransport(base *http.Transport) *transport {
+	return &transport{
+		base:     base,
+		hosts:    make(map[string]*hostLimiter),
+		inflight: make(map[string]*inflightCall),
+	}
+}
+
+func (t *transport) limiterFor(host string) *hostLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limiter, exists := t.hosts[host]
+	if !exists {
+		limiter = &hostLimiter{
+			slots: make(chan struct{}, maxConcurrentRequestsPerHost),
+		}
+		t.hosts[host] = limiter
+	}
+
+	return limiter
+}
+
+func (t *transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, err := checkRequestHost(request.Context(), request.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+
+	if request.Header.Get("User-Agent") == "" {
+		request = request.Clone(request.Context())
+		request.Header.Set("User-Agent", UserAgent)
+	}
+
+	if isCoalescable(request) {
+		return t.coalescedRoundTrip(request)
+	}
+
+	return t.limitedRoundTrip(request)
+}
+
+func (t *transport) limitedRoundTrip(request *http.Request) (*http.Response, error) {
+	limiter := t.limiterFor(request.URL.Host)
+	if err := limiter.acquire(request); err != nil {
+		return nil, err
+	}
+
+	response, err := t.base.RoundTrip(request)
+	if err != nil {
+		limiter.release()
+		return nil, err
+	}
+
+	// The standard transport only decompresses transparently when it was the one
+	// to ask for gzip, so handle the case where the caller set Accept-Encoding
+	if !response.Uncompressed && strings.EqualFold(response.Header.Get("Content-Encoding"), "gzip") {
+		reader, err := gzip.NewReader(response.Body)
+		if err != nil {
+			response.Body.Close()
+			limiter.release()
+			return nil, err
+		}
+
+		response.Body = &gzipBody{Reader: reader, body: response.Body}
+		response.Header.Del("Content-Encoding")
+		response.Header.Del("Content-Length")
+		response.ContentLength = -1
+		response.Uncompressed = true
+	}
+
+	// Checked after decompressing so that small archives of large bodies can't
+	// get past the limit
+	maxSize := maxResponseSizeFor(request)
+	if response.ContentLength > maxSize {
+		response.Body.Close()
+		limiter.release()
+		return nil, responseTooLargeError(request, maxSize)
+	}
+
+	// The slot is held until the body gets closed rather than when the headers
+	// arrive, otherwise slow bodies would let through more requests than allowed
+	response.Body = &limitedBody{
+		ReadCloser: &releasingBody{ReadCloser: response.Body, release: limiter.release},
+		request:    request,
+		maxSize:    maxSize,
+		remaining:  maxSize,
+	}
+
+	return response, nil
+}
+
+type hostLimiter struct {
+	slots chan struct{}
+
+	mu          sync.Mutex
+	nextRequest time.Time
+}
+
+func (l *hostLimiter) acquire(request *http.Request) error {
+	ctx := request.Context()
+
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	wait := l.nextRequest.Sub(now)
+	if l.nextRequest.Before(now) {
+		l.nextRequest = now
+	}
+	l.nextRequest = l.nextRequest.Add(minIntervalBetweenRequestsPerHost)
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.release()
+		return ctx.Err()
+	}
+}
+
+func (l *hostLimiter) release() {
+	<-l.slots
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,97 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Fills in the properties of a theme from the built-in preset or the base16
+// scheme it's based on, if any
+func resolveThemeBase(theme *models.ThemeProperties) error {
+	if theme.Preset != "" && theme.Base16 != "" {
+		return errors.New("preset and base16 can't both be set")
+	}
+
+	if theme.Base16 == "" {
+		return theme.InheritFromPreset()
+	}
+
+	base, err := loadBase16Scheme(theme.Base16)
+	if err != nil {
+		return fmt.Errorf("base16 scheme %s: %w", theme.Base16, err)
+	}
+
+	theme.InheritFrom(base)
+	return nil
+}
+
+// Supports both the original format of base16 schemes, where the colors are
+// at the top level, and the one used by tinted-theming, where they're within
+// a palette and the variant is specified
+func loadBase16Scheme(path string) (*models.ThemeProperties, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// colors without quotes could otherwise be taken for numbers
+	var scheme map[string]yaml.Node
+	if err := yaml.Unmarshal(contents, &scheme); err != nil {
+		return nil, err
+	}
+
+	palette := make(map[string]string)
+	if nested, ok := scheme["palette"]; ok {
+		if err := nested.Decode(&palette); err != nil {
+			return nil, fmt.Errorf("palette: %w", err)
+		}
+	} else {
+		for key, node := range scheme {
+			if node.Kind == yaml.ScalarNode {
+				palette[key] = node.Value
+			}
+		}
+	}
+
+	color := func(key string) (*models.HSLColorField, error) {
+		value, ok := palette[key]
+		if !ok {
+			return nil, fmt.Errorf("missing %s", key)
+		}
+
+		h, s, l, err := common.HexToHsl(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+
+		return &models.HSLColorField{H: h, S: s, L: l}, nil
+	}
+
+	theme := &models.ThemeProperties{}
+
+	if theme.BackgroundColor, err = color("base00"); err != nil {
+		return nil, err
+	}
+	if theme.PrimaryColor, err = color("base0D"); err != nil {
+		return nil, err
+	}
+	if theme.PositiveColor, err = color("base0B"); err != nil {
+		return nil, err
+	}
+	if theme.NegativeColor, err = color("base08"); err != nil {
+		return nil, err
+	}
+
+	if variant, ok := scheme["variant"]; ok {
+		theme.Light = variant.Value == "light"
+	} else {
+		theme.Light = theme.BackgroundColor.L > 50
+	}
+
+	return theme, nil
+}
@@ -4,17 +4,22 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/limpdev/gander/internal/auth"
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"github.com/limpdev/gander/internal/models"
 	"gopkg.in/yaml.v3"
 )
@@ -25,10 +30,16 @@ const (
 	configVarTypeEnv         = "env"
 	configVarTypeSecret      = "secret"
 	configVarTypeFileFromEnv = "readFileFromEnv"
+	configVarTypeExec        = "exec"
 )
 
 func NewConfigFromYAML(contents []byte) (*models.Config, error) {
-	contents, err := ParseConfigVariables(contents)
+	contents, lineOrigins, err := parseConfigVariablesByLine(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := parseConfigDocument(contents, lineOrigins)
 	if err != nil {
 		return nil, err
 	}
@@ -36,15 +47,24 @@ func NewConfigFromYAML(contents []byte) (*models.Config, error) {
 	config := &models.Config{}
 	config.Server.Port = 8080
 
-	err = yaml.Unmarshal(contents, config)
-	if err != nil {
-		return nil, err
+	if len(document.Content) > 0 {
+		if err = document.Decode(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Server.StrictConfig {
+		if err = checkUnknownConfigKeys(document); err != nil {
+			return nil, err
+		}
 	}
 
 	if err = IsConfigStateValid(config); err != nil {
 		return nil, err
 	}
 
+	assignWidgetIDs(config)
+
 	// Initialize widgets
 	// We need to iterate over Pages, then HeadWidgets and Column Widgets
 	for p := range config.Pages {
@@ -63,6 +83,15 @@ func NewConfigFromYAML(contents []byte) (*models.Config, error) {
 		}
 	}
 
+	if err := resolveThemeBase(&config.Theme.ThemeProperties); err != nil {
+		return nil, fmt.Errorf("theme: %w", err)
+	}
+	for key, preset := range config.Theme.Presets.Items() {
+		if err := resolveThemeBase(preset); err != nil {
+			return nil, fmt.Errorf("theme preset %s: %w", key, err)
+		}
+	}
+
 	// Initialize theme
 	// Access via config.Theme.ThemeProperties (embedded)
 	if err := config.Theme.ThemeProperties.Initialize(); err != nil {
@@ -81,54 +110,228 @@ func NewConfigFromYAML(contents []byte) (*models.Config, error) {
 	return config, nil
 }
 
+// Parses the config into a node with the sections that aren't part of any of
+// the active profiles already removed. When given, the lines of the nodes get
+// changed to the ones they came from before variables were expanded.
+func parseConfigDocument(contents []byte, lineOrigins []int) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, err
+	}
+
+	if lineOrigins != nil {
+		setOriginalLines(&document, lineOrigins)
+	}
+
+	if err := applyProfileConditions(&document); err != nil {
+		return nil, err
+	}
+
+	return &document, nil
+}
+
 var (
-	envVariableNamePattern = regexp.MustCompile(`^[A-Z0-9_]+$`)
-	configVariablePattern  = regexp.MustCompile(`(^|.)\$\{(?:([a-zA-Z]+):)?([a-zA-Z0-9_-]+)\}`)
+	envVariableNamePattern    = regexp.MustCompile(`^[A-Z0-9_]+$`)
+	configVariableTypePattern = regexp.MustCompile(`^([a-zA-Z]+):`)
+	// exec variables take a whole command line, everything else only a name
+	configVariableNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 )
 
 func ParseConfigVariables(contents []byte) ([]byte, error) {
-	var err error
+	return parseConfigVariables(contents, false)
+}
+
+// Variables can't span lines, so expanding them one line at a time is the same
+// as expanding all of them at once while also keeping track of the line of the
+// config that each of the expanded lines comes from, which can be more than
+// one when a variable's value has line breaks in it
+func parseConfigVariablesByLine(contents []byte) ([]byte, []int, error) {
+	providers, err := loadSecretProviders(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var result bytes.Buffer
+	result.Grow(len(contents))
+	lineOrigins := make([]int, 0, bytes.Count(contents, []byte("\n"))+1)
 
-	replaced := configVariablePattern.ReplaceAllFunc(contents, func(match []byte) []byte {
+	for i, line := range bytes.Split(contents, []byte("\n")) {
+		replaced, err := expandConfigVariables(line, providers, false)
 		if err != nil {
-			return nil
+			return nil, nil, fmt.Errorf("parsing variable: %v", err)
 		}
 
-		groups := configVariablePattern.FindSubmatch(match)
-		if len(groups) != 4 {
-			return match
+		if i > 0 {
+			result.WriteByte('\n')
 		}
+		result.Write(replaced)
 
-		prefix := string(groups[1])
-		if prefix == `\` {
-			if len(match) >= 2 {
-				return match[1:]
-			} else {
-				return nil
-			}
+		for range bytes.Count(replaced, []byte("\n")) + 1 {
+			lineOrigins = append(lineOrigins, i+1)
+		}
+	}
+
+	return result.Bytes(), lineOrigins, nil
+}
+
+func setOriginalLines(node *yaml.Node, lineOrigins []int) {
+	if node.Line > 0 && node.Line <= len(lineOrigins) {
+		node.Line = lineOrigins[node.Line-1]
+	}
+
+	for _, child := range node.Content {
+		setOriginalLines(child, lineOrigins)
+	}
+}
+
+// When redacting, variables still get resolved so that missing ones are reported
+// but what ends up in the config is a placeholder rather than their value
+func parseConfigVariables(contents []byte, redact bool) ([]byte, error) {
+	providers, err := loadSecretProviders(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced, err := expandConfigVariables(contents, providers, redact)
+	if err != nil {
+		return nil, fmt.Errorf("parsing variable: %v", err)
+	}
+
+	return replaced, nil
+}
+
+func expandConfigVariables(contents []byte, providers map[string]SecretProvider, redact bool) ([]byte, error) {
+	var result bytes.Buffer
+	result.Grow(len(contents))
+
+	for len(contents) > 0 {
+		start := bytes.Index(contents, []byte("${"))
+		if start == -1 {
+			result.Write(contents)
+			break
 		}
 
-		typeAsString, variableName := string(groups[2]), string(groups[3])
-		variableType := common.Ternary(typeAsString == "", configVarTypeEnv, typeAsString)
+		end := configVariableEnd(contents, start)
+		if end == -1 {
+			result.Write(contents[:start+2])
+			contents = contents[start+2:]
+			continue
+		}
 
-		parsedValue, returnOriginal, localErr := ParseConfigVariableOfType(variableType, variableName)
-		if localErr != nil {
-			err = fmt.Errorf("parsing variable: %v", localErr)
-			return nil
+		if start > 0 && contents[start-1] == '\\' {
+			result.Write(contents[:start-1])
+			result.Write(contents[start:end])
+			contents = contents[end:]
+			continue
 		}
 
-		if returnOriginal {
-			return match
+		value, err := resolveConfigVariable(contents[start:end], providers, redact)
+		if err != nil {
+			return nil, err
 		}
 
-		return []byte(prefix + parsedValue)
-	})
+		result.Write(contents[:start])
+		result.Write(value)
+		contents = contents[end:]
+	}
+
+	return result.Bytes(), nil
+}
+
+// Returns the index right after the } that closes the variable at start while
+// skipping over any variables nested within it, or -1 if it isn't closed on the
+// same line
+func configVariableEnd(contents []byte, start int) int {
+	depth := 0
+
+	for i := start; i < len(contents); i++ {
+		switch {
+		case contents[i] == '\n':
+			return -1
+		case contents[i] == '$' && i+1 < len(contents) && contents[i+1] == '{':
+			depth++
+			i++
+		case contents[i] == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return -1
+}
+
+// Variables take the form of ${type:name|default}, where the type is env when
+// omitted or the name of a secret provider, and the default gets used if the
+// variable can't be resolved. Both the name and the default can themselves
+// contain variables.
+func resolveConfigVariable(variable []byte, providers map[string]SecretProvider, redact bool) ([]byte, error) {
+	body := string(variable[2 : len(variable)-1])
+
+	variableType := configVarTypeEnv
+	if groups := configVariableTypePattern.FindStringSubmatch(body); groups != nil {
+		variableType = groups[1]
+		body = body[len(groups[0]):]
+	}
 
+	name, fallback, hasFallback := cutConfigVariableDefault(body)
+
+	resolvedName, err := expandConfigVariables([]byte(name), providers, false)
 	if err != nil {
 		return nil, err
 	}
+	name = string(resolvedName)
 
-	return replaced, nil
+	var value string
+
+	if provider, exists := providers[variableType]; exists {
+		path, key, _ := strings.Cut(name, "#")
+		value, err = provider.GetSecret(path, key)
+	} else {
+		if variableType != configVarTypeExec && !configVariableNamePattern.MatchString(name) {
+			return variable, nil
+		}
+
+		var returnOriginal bool
+		value, returnOriginal, err = ParseConfigVariableOfType(variableType, name)
+		if returnOriginal {
+			return variable, nil
+		}
+	}
+
+	if err != nil {
+		if !hasFallback {
+			return nil, err
+		}
+
+		return expandConfigVariables([]byte(fallback), providers, redact)
+	}
+
+	if redact {
+		return []byte(redactedValue), nil
+	}
+
+	return []byte(value), nil
+}
+
+// Splits on the first | that isn't part of a nested variable
+func cutConfigVariableDefault(body string) (string, string, bool) {
+	depth := 0
+
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '$' && i+1 < len(body) && body[i+1] == '{':
+			depth++
+			i++
+		case body[i] == '}':
+			depth--
+		case body[i] == '|' && depth == 0:
+			return body[:i], body[i+1:], true
+		}
+	}
+
+	return body, "", false
 }
 
 func ParseConfigVariableOfType(variableType, variableName string) (string, bool, error) {
@@ -172,86 +375,142 @@ func ParseConfigVariableOfType(variableType, variableName string) (string, bool,
 		}
 
 		return strings.TrimSpace(string(fileContents)), false, nil
+	case configVarTypeExec:
+		output, err := runExecVariableCommand(variableName)
+		if err != nil {
+			return "", false, err
+		}
+
+		return output, false, nil
 	default:
 		return "", true, nil
 	}
 }
 
 func FormatWidgetInitError(err error, w models.Widget) error {
+	if located, ok := w.(models.LocatedWidget); ok && located.GetSourceLine() > 0 {
+		return fmt.Errorf("line %d: %s widget: %v", located.GetSourceLine(), w.GetType(), err)
+	}
+
 	return fmt.Errorf("%s widget: %v", w.GetType(), err)
 }
 
 var configIncludePattern = regexp.MustCompile(`(?m)^([ \t]*)(?:-[ \t]*)?(?:!|\$)include:[ \t]*(.+)$`)
 
-func ParseYAMLIncludes(mainFilePath string) ([]byte, map[string]struct{}, error) {
-	return RecursiveParseYAMLIncludes(mainFilePath, nil, 0)
+func ParseYAMLIncludes(mainFilePath string) ([]byte, map[string]struct{}, *SourceMap, error) {
+	contents, includes, sourceMap, err := RecursiveParseYAMLIncludes(mainFilePath, nil, 0)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if mainFileAbsPath, err := filepath.Abs(mainFilePath); err == nil {
+		sourceMap.baseDir = filepath.Dir(mainFileAbsPath)
+	}
+
+	return contents, includes, sourceMap, nil
+}
+
+func RecursiveParseYAMLIncludes(mainFilePath string, includes map[string]struct{}, depth int) ([]byte, map[string]struct{}, *SourceMap, error) {
+	return recursiveParseYAMLIncludes(mainFilePath, includes, depth, os.ReadFile)
 }
 
-func RecursiveParseYAMLIncludes(mainFilePath string, includes map[string]struct{}, depth int) ([]byte, map[string]struct{}, error) {
+// Files are read through readFile so that changes to them can be tried out
+// before they're written
+func recursiveParseYAMLIncludes(
+	mainFilePath string,
+	includes map[string]struct{},
+	depth int,
+	readFile func(string) ([]byte, error),
+) ([]byte, map[string]struct{}, *SourceMap, error) {
 	if depth > CONFIG_INCLUDE_RECURSION_DEPTH_LIMIT {
-		return nil, nil, fmt.Errorf("recursion depth limit of %d reached", CONFIG_INCLUDE_RECURSION_DEPTH_LIMIT)
+		return nil, nil, nil, fmt.Errorf("recursion depth limit of %d reached", CONFIG_INCLUDE_RECURSION_DEPTH_LIMIT)
 	}
 
-	mainFileContents, err := os.ReadFile(mainFilePath)
+	mainFileContents, err := readFile(mainFilePath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("reading %s: %w", mainFilePath, err)
+		return nil, nil, nil, fmt.Errorf("reading %s: %w", mainFilePath, err)
+	}
+
+	// line numbers of templated files refer to the rendered output, which
+	// can be seen using config:print
+	if configTemplatingEnabled {
+		mainFileContents, err = executeConfigTemplate(mainFilePath, mainFileContents)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: %w", mainFilePath, err)
+		}
 	}
 
 	mainFileAbsPath, err := filepath.Abs(mainFilePath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("getting absolute path of %s: %w", mainFilePath, err)
+		return nil, nil, nil, fmt.Errorf("getting absolute path of %s: %w", mainFilePath, err)
 	}
 	mainFileDir := filepath.Dir(mainFileAbsPath)
 
 	if includes == nil {
 		includes = make(map[string]struct{})
 	}
-	var includesLastErr error
 
-	mainFileContents = configIncludePattern.ReplaceAllFunc(mainFileContents, func(match []byte) []byte {
-		if includesLastErr != nil {
-			return nil
+	// includes are resolved line by line rather than through a single replace so
+	// that every line of the result can be traced back to the file it came from
+	lines := bytes.Split(mainFileContents, []byte("\n"))
+	resultLines := make([][]byte, 0, len(lines))
+	sourceMap := &SourceMap{}
+
+	for i, line := range lines {
+		matches := configIncludePattern.FindSubmatch(line)
+		if matches == nil {
+			resultLines = append(resultLines, line)
+			sourceMap.lines = append(sourceMap.lines, sourceLocation{file: mainFileAbsPath, line: i + 1})
+			continue
 		}
 
-		matches := configIncludePattern.FindSubmatch(match)
-		if len(matches) != 3 {
-			includesLastErr = fmt.Errorf("invalid include match: %v", matches)
-			return nil
+		indent := string(matches[1])
+
+		resolvedIncludePath, err := parseConfigVariables(bytes.TrimSpace(matches[2]), false)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s:%d: include path: %w", mainFilePath, i+1, err)
 		}
 
-		indent := string(matches[1])
-		includeFilePath := strings.TrimSpace(string(matches[2]))
+		includeFilePath := string(resolvedIncludePath)
 		if !filepath.IsAbs(includeFilePath) {
 			includeFilePath = filepath.Join(mainFileDir, includeFilePath)
 		}
 
-		var fileContents []byte
-		var err error
-
 		includes[includeFilePath] = struct{}{}
 
-		fileContents, includes, err = RecursiveParseYAMLIncludes(includeFilePath, includes, depth+1)
+		var fileContents []byte
+		var includedSourceMap *SourceMap
+
+		fileContents, includes, includedSourceMap, err = recursiveParseYAMLIncludes(includeFilePath, includes, depth+1, readFile)
 		if err != nil {
-			includesLastErr = err
-			return nil
+			return nil, nil, nil, err
 		}
 
-		return []byte(common.PrefixStringLines(indent, string(fileContents)))
-	})
-
-	if includesLastErr != nil {
-		return nil, nil, includesLastErr
+		for _, includedLine := range strings.Split(common.PrefixStringLines(indent, string(fileContents)), "\n") {
+			resultLines = append(resultLines, []byte(includedLine))
+		}
+		includedAt := &sourceLocation{file: mainFileAbsPath, line: i + 1}
+		for _, location := range includedSourceMap.lines {
+			sourceMap.lines = append(sourceMap.lines, location.withOutermostInclude(includedAt))
+		}
 	}
 
-	return mainFileContents, includes, nil
+	return bytes.Join(resultLines, []byte("\n")), includes, sourceMap, nil
 }
 
+// Calls onChange whenever the contents of the config change, as well as for
+// every value received from reloads regardless of whether they changed, which
+// is for changes that don't generate events, such as the files being swapped
+// through a symlink, or that are made outside of the files, such as to the
+// environment variables or secrets that the config uses
 func ConfigFilesWatcher(
 	mainFilePath string,
 	lastContents []byte,
+	lastSourceMap *SourceMap,
 	lastIncludes map[string]struct{},
-	onChange func(newContents []byte),
+	onChange func(newContents []byte, sourceMap *SourceMap),
 	onErr func(error),
+	reloads <-chan struct{},
 ) (func() error, error) {
 	mainFileAbsPath, err := filepath.Abs(mainFilePath)
 	if err != nil {
@@ -276,9 +535,9 @@ func ConfigFilesWatcher(
 		for filePath := range newWatched {
 			if _, ok := previousWatched[filePath]; !ok {
 				if err := watcher.Add(filePath); err != nil {
-					log.Printf(
-						"Could not add file to watcher, changes to this file will not trigger a reload. path: %s, error: %v",
-						filePath, err,
+					slog.Warn(
+						"Could not add file to watcher, changes to this file will not trigger a reload",
+						"path", filePath, "error", err,
 					)
 				}
 			}
@@ -290,8 +549,8 @@ func ConfigFilesWatcher(
 	// needed for lastContents and lastIncludes because they get updated in multiple goroutines
 	mu := sync.Mutex{}
 
-	parseAndCompareBeforeCallback := func() {
-		currentContents, currentIncludes, err := ParseYAMLIncludes(mainFilePath)
+	parseAndCompareBeforeCallback := func(force bool) {
+		currentContents, currentIncludes, currentSourceMap, err := ParseYAMLIncludes(mainFilePath)
 		if err != nil {
 			onErr(fmt.Errorf("parsing main file contents for comparison: %w", err))
 			return
@@ -308,9 +567,9 @@ func ConfigFilesWatcher(
 			lastIncludes = currentIncludes
 		}
 
-		if !bytes.Equal(lastContents, currentContents) {
+		if force || !bytes.Equal(lastContents, currentContents) {
 			lastContents = currentContents
-			onChange(currentContents)
+			onChange(currentContents, currentSourceMap)
 		}
 	}
 
@@ -321,7 +580,7 @@ func ConfigFilesWatcher(
 			debounceTimer.Stop()
 			debounceTimer.Reset(debounceDuration)
 		} else {
-			debounceTimer = time.AfterFunc(debounceDuration, parseAndCompareBeforeCallback)
+			debounceTimer = time.AfterFunc(debounceDuration, func() { parseAndCompareBeforeCallback(false) })
 		}
 	}
 
@@ -368,6 +627,8 @@ func ConfigFilesWatcher(
 					deleteLastInclude(event.Name)
 					debouncedParseAndCompareBeforeCallback()
 				}
+			case <-reloads:
+				parseAndCompareBeforeCallback(true)
 			case err, isOpen := <-watcher.Errors:
 				if !isOpen {
 					return
@@ -377,7 +638,7 @@ func ConfigFilesWatcher(
 		}
 	}()
 
-	onChange(lastContents)
+	onChange(lastContents, lastSourceMap)
 
 	return func() error {
 		if debounceTimer != nil {
@@ -397,6 +658,20 @@ func IsConfigStateValid(config *models.Config) error {
 		return fmt.Errorf("secret-key must be set when users are configured")
 	}
 
+	if hashing := &config.Auth.PasswordHashing; len(config.Auth.Users) > 0 {
+		if hashing.Algo == "" {
+			hashing.Algo = auth.PasswordHashAlgoBcrypt
+		}
+
+		if hashing.Cost == 0 {
+			hashing.Cost = auth.DefaultPasswordHashCost(hashing.Algo)
+		}
+
+		if err := auth.ValidatePasswordHashOptions(hashing.Algo, hashing.Cost); err != nil {
+			return fmt.Errorf("password-hashing: %v", err)
+		}
+	}
+
 	for username := range config.Auth.Users {
 		if username == "" {
 			return fmt.Errorf("user has no name")
@@ -408,15 +683,155 @@ func IsConfigStateValid(config *models.Config) error {
 
 		user := config.Auth.Users[username]
 
+		if user.Role == "" {
+			user.Role = models.UserRoleViewer
+		} else if user.Role != models.UserRoleAdmin && user.Role != models.UserRoleViewer {
+			return fmt.Errorf("the role of %s can only be either admin or viewer", username)
+		}
+
 		if user.Password == "" {
 			if user.PasswordHashString == "" {
 				return fmt.Errorf("user %s must have a password or a password-hash set", username)
 			}
+
+			if err := auth.CheckPasswordHash(user.PasswordHashString); err != nil {
+				return fmt.Errorf("the password-hash of %s is %v", username, err)
+			}
 		} else if len(user.Password) < 6 {
 			return fmt.Errorf("the password for %s must be at least 6 characters", username)
 		}
 	}
 
+	if config.Auth.RenewSessionBefore > 0 && config.Auth.SessionDuration > 0 &&
+		config.Auth.RenewSessionBefore >= config.Auth.SessionDuration {
+		return errors.New("renew-session-before must be shorter than session-duration")
+	}
+
+	if auditLog := &config.Server.AuditLog; auditLog.Path != "" && auditLog.Syslog != "" {
+		return errors.New("audit-log can either have a path or use syslog, not both")
+	} else if auditLog.MaxSize < 0 || auditLog.MaxBackups < 0 {
+		return errors.New("audit-log max-size and max-backups can't be negative")
+	}
+
+	if config.Server.SocketMode != "" {
+		if config.Server.SocketPath == "" {
+			return errors.New("socket-mode can only be used along with socket-path")
+		}
+
+		if _, err := strconv.ParseUint(config.Server.SocketMode, 8, 32); err != nil {
+			return fmt.Errorf("socket-mode must be an octal number such as 0660, got %q", config.Server.SocketMode)
+		}
+	}
+
+	if config.Server.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(config.Server.LogLevel)); err != nil {
+			return fmt.Errorf("log-level must be one of debug, info, warn or error, got %q", config.Server.LogLevel)
+		}
+	}
+
+	if config.Server.LogFormat == "" {
+		config.Server.LogFormat = models.LogFormatText
+	} else if config.Server.LogFormat != models.LogFormatText && config.Server.LogFormat != models.LogFormatJSON {
+		return fmt.Errorf("log-format must be either text or json, got %q", config.Server.LogFormat)
+	}
+
+	if accessLog := &config.Server.AccessLog; accessLog.Format == "" && accessLog.Path != "" {
+		accessLog.Format = models.AccessLogFormatCombined
+	} else if accessLog.Format != "" &&
+		accessLog.Format != models.AccessLogFormatCommon &&
+		accessLog.Format != models.AccessLogFormatCombined &&
+		accessLog.Format != models.AccessLogFormatJSON {
+		return fmt.Errorf("access-log format must be one of common, combined or json, got %q", accessLog.Format)
+	} else if accessLog.MaxSize < 0 || accessLog.MaxBackups < 0 {
+		return errors.New("access-log max-size and max-backups can't be negative")
+	}
+
+	if err := isSecurityHeadersConfigValid(&config.Server.SecurityHeaders); err != nil {
+		return fmt.Errorf("security-headers: %v", err)
+	}
+
+	for i := range config.Notifications {
+		if err := isNotificationConfigValid(&config.Notifications[i]); err != nil {
+			return fmt.Errorf("notification %d: %v", i+1, err)
+		}
+	}
+
+	for name, source := range config.DataSources {
+		if err := isDataSourceConfigValid(source); err != nil {
+			return fmt.Errorf("data source %s: %v", name, err)
+		}
+	}
+
+	if config.Server.MaxConcurrentUpdates < -1 {
+		return errors.New("max-concurrent-updates must be -1 or higher")
+	}
+
+	if _, err := fetch.NewHostPolicy(config.Server.AllowedHosts, config.Server.BlockedHosts); err != nil {
+		return err
+	}
+
+	if len(config.Server.Hosts) > 0 {
+		// slugs only get filled in once the application gets created
+		slugs := make(map[string]bool, len(config.Pages))
+		for p := range config.Pages {
+			page := &config.Pages[p]
+			slugs[common.Ternary(page.Slug == "", common.TitleToSlug(page.Title), page.Slug)] = true
+		}
+
+		for name, host := range config.Server.Hosts {
+			if host == nil {
+				continue
+			}
+
+			for _, slug := range host.Pages {
+				if !slugs[slug] {
+					return fmt.Errorf("server.hosts.%s: no page with the slug %s", name, slug)
+				}
+			}
+		}
+	}
+
+	if iconProxy := &config.Server.IconProxy; iconProxy.CacheTTL < 0 {
+		return errors.New("icon-proxy cache-ttl can't be negative")
+	} else if iconProxy.MaxImageSize < 0 || iconProxy.MaxCacheSize < 0 {
+		return errors.New("icon-proxy max-image-size and max-cache-size can't be negative")
+	}
+
+	if snapshots := &config.Server.Snapshots; snapshots.Enabled {
+		if snapshots.Width < 0 || snapshots.Height < 0 || snapshots.Width > 4096 || snapshots.Height > 4096 {
+			return errors.New("snapshots width and height must be between 0 and 4096")
+		} else if snapshots.Wait < 0 || snapshots.Timeout < 0 {
+			return errors.New("snapshots wait and timeout can't be negative")
+		} else if snapshots.URL == "" && config.Server.SocketPath != "" {
+			return errors.New("snapshots url is required when listening on a socket")
+		} else if snapshots.URL != "" && !strings.HasPrefix(snapshots.URL, "http://") && !strings.HasPrefix(snapshots.URL, "https://") {
+			return errors.New("snapshots url must start with http:// or https://")
+		}
+
+		if snapshots.Token != "" && len(config.Auth.Users) > 0 {
+			if snapshots.User == "" {
+				return errors.New("snapshots user is required when using a token along with authentication")
+			} else if _, exists := config.Auth.Users[snapshots.User]; !exists {
+				return fmt.Errorf("snapshots user %s does not exist", snapshots.User)
+			}
+		}
+	}
+
+	if rateLimit := &config.Auth.RateLimit; rateLimit.MaxAttemptsPerIP < 0 || rateLimit.MaxAttemptsPerUser < 0 {
+		return errors.New("rate-limit max-attempts-per-ip and max-attempts-per-user can't be negative")
+	} else if rateLimit.Lockout > 0 && rateLimit.MaxLockout > 0 && rateLimit.Lockout > rateLimit.MaxLockout {
+		return errors.New("rate-limit lockout can't be longer than max-lockout")
+	}
+
+	for username, user := range config.Auth.Users {
+		for _, group := range user.Groups {
+			if group == "" {
+				return fmt.Errorf("user %s has an empty group", username)
+			}
+		}
+	}
+
 	if config.Server.AssetsPath != "" {
 		if _, err := os.Stat(config.Server.AssetsPath); os.IsNotExist(err) {
 			return fmt.Errorf("assets directory does not exist: %s", config.Server.AssetsPath)
@@ -440,6 +855,10 @@ func IsConfigStateValid(config *models.Config) error {
 			}
 		}
 
+		if page.Layout != "" && page.Layout != models.PageLayoutMobileFirst {
+			return fmt.Errorf("page %d: layout can only be mobile-first", i+1)
+		}
+
 		if len(page.Columns) == 0 {
 			return fmt.Errorf("page %d has no columns", i+1)
 		}
@@ -471,6 +890,234 @@ func IsConfigStateValid(config *models.Config) error {
 		if full > 2 || full == 0 {
 			return fmt.Errorf("page %d must have either 1 or 2 full width columns", i+1)
 		}
+
+		if err := checkAccessRestriction(config, page.AllowedUsers, page.AllowedGroups); err != nil {
+			return fmt.Errorf("page %d: %v", i+1, err)
+		}
+
+		if err := checkWidgetAccessRestrictions(config, page.HeadWidgets, false); err != nil {
+			return fmt.Errorf("page %d: %v", i+1, err)
+		}
+
+		if err := checkWidgetDataSources(config, page.HeadWidgets); err != nil {
+			return fmt.Errorf("page %d: %v", i+1, err)
+		}
+
+		for j := range page.Columns {
+			if err := checkWidgetAccessRestrictions(config, page.Columns[j].Widgets, false); err != nil {
+				return fmt.Errorf("page %d: %v", i+1, err)
+			}
+
+			if err := checkWidgetDataSources(config, page.Columns[j].Widgets); err != nil {
+				return fmt.Errorf("page %d: %v", i+1, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+var notificationTypes = []string{
+	models.NotificationTypeGeneric,
+	models.NotificationTypeNtfy,
+	models.NotificationTypeGotify,
+	models.NotificationTypeDiscord,
+	models.NotificationTypeSlack,
+}
+
+func isDataSourceConfigValid(config *models.DataSourceConfig) error {
+	if config == nil {
+		return errors.New("no url specified")
+	}
+
+	if !strings.HasPrefix(config.URL, "http://") && !strings.HasPrefix(config.URL, "https://") {
+		return errors.New("url must be an http or https URL")
+	}
+
+	if config.Format == "" {
+		config.Format = models.DataSourceFormatJSON
+	} else if config.Format != models.DataSourceFormatJSON && config.Format != models.DataSourceFormatText {
+		return fmt.Errorf("format must be either json or text, got %q", config.Format)
+	}
+
+	if config.Cache < 0 || config.RequestTimeout < 0 {
+		return errors.New("cache and request-timeout can't be negative")
+	}
+
+	return nil
+}
+
+func isNotificationConfigValid(config *models.NotificationConfig) error {
+	if config.Type == "" {
+		config.Type = models.NotificationTypeGeneric
+	} else if !slices.Contains(notificationTypes, config.Type) {
+		return fmt.Errorf("type must be one of %s, got %q", strings.Join(notificationTypes, ", "), config.Type)
+	}
+
+	if !strings.HasPrefix(config.URL, "http://") && !strings.HasPrefix(config.URL, "https://") {
+		return errors.New("url must be an http or https URL")
+	}
+
+	if config.Type == models.NotificationTypeGotify && config.Token == "" {
+		return errors.New("gotify requires the token of an application")
+	}
+
+	if config.Body != "" && config.Type != models.NotificationTypeGeneric {
+		return errors.New("body can only be used with the generic type")
+	}
+
+	for _, event := range config.Events {
+		if !slices.Contains(models.WidgetEventTypes, event) {
+			return fmt.Errorf("events must be any of %s, got %q", strings.Join(models.WidgetEventTypes, ", "), event)
+		}
+	}
+
+	for name, text := range map[string]string{"title": config.Title, "message": config.Message, "body": config.Body} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return fmt.Errorf("parsing %s template: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+var validReferrerPolicies = []string{
+	"no-referrer",
+	"no-referrer-when-downgrade",
+	"origin",
+	"origin-when-cross-origin",
+	"same-origin",
+	"strict-origin",
+	"strict-origin-when-cross-origin",
+	"unsafe-url",
+}
+
+func isSecurityHeadersConfigValid(config *models.SecurityHeadersConfig) error {
+	if strings.ContainsAny(config.ContentSecurityPolicy, "\r\n") {
+		return errors.New("content-security-policy can't span multiple lines")
+	}
+
+	if len(config.ExtraCSPSources) > 0 && config.ContentSecurityPolicy != models.CSPAuto {
+		return errors.New("extra-csp-sources can only be used when content-security-policy is set to auto")
+	}
+
+	for directive, sources := range config.ExtraCSPSources {
+		if !strings.HasSuffix(directive, "-src") {
+			return fmt.Errorf("extra-csp-sources: %s is not a fetch directive such as script-src or img-src", directive)
+		}
+
+		for _, source := range sources {
+			if source == "" || strings.ContainsAny(source, " ;,\r\n") {
+				return fmt.Errorf("extra-csp-sources: %s contains an invalid source %q", directive, source)
+			}
+		}
+	}
+
+	config.FrameOptions = strings.ToLower(config.FrameOptions)
+	if config.FrameOptions != "" && config.FrameOptions != "deny" && config.FrameOptions != "sameorigin" {
+		return fmt.Errorf("frame-options must be either deny or sameorigin, got %q", config.FrameOptions)
+	}
+
+	if config.ReferrerPolicy != "" && !slices.Contains(validReferrerPolicies, config.ReferrerPolicy) {
+		return fmt.Errorf("referrer-policy must be one of %s, got %q", strings.Join(validReferrerPolicies, ", "), config.ReferrerPolicy)
+	}
+
+	if hsts := &config.HSTS; hsts.MaxAge < 0 {
+		return errors.New("hsts max-age can't be negative")
+	} else if hsts.MaxAge == 0 && (hsts.IncludeSubdomains || hsts.Preload) {
+		return errors.New("hsts include-subdomains and preload require a max-age")
+	} else if hsts.Preload && !hsts.IncludeSubdomains {
+		return errors.New("hsts preload requires include-subdomains")
+	}
+
+	return nil
+}
+
+func checkAccessRestriction(config *models.Config, allowedUsers, allowedGroups []string) error {
+	if len(allowedUsers) == 0 && len(allowedGroups) == 0 {
+		return nil
+	}
+
+	if len(config.Auth.Users) == 0 {
+		return errors.New("allowed-users and allowed-groups require users to be configured")
+	}
+
+	for _, username := range allowedUsers {
+		if _, exists := config.Auth.Users[username]; !exists {
+			return fmt.Errorf("allowed-users contains %s, which is not a configured user", username)
+		}
+	}
+
+	return nil
+}
+
+func checkEditRestriction(config *models.Config, widget models.EditRestrictedWidget) error {
+	users, groups := widget.GetEditors()
+	if len(users) == 0 && len(groups) == 0 {
+		return nil
+	}
+
+	if len(config.Auth.Users) == 0 {
+		return errors.New("editors and editor-groups require users to be configured")
+	}
+
+	for _, username := range users {
+		if _, exists := config.Auth.Users[username]; !exists {
+			return fmt.Errorf("editors contains %s, which is not a configured user", username)
+		}
+	}
+
+	return nil
+}
+
+func checkWidgetDataSources(config *models.Config, widgets models.Widgets) error {
+	for _, widget := range widgets {
+		if consumer, ok := widget.(models.DataSourceWidget); ok {
+			if name := consumer.GetDataSourceName(); name != "" && config.DataSources[name] == nil {
+				return FormatWidgetInitError(fmt.Errorf("data source %q is not defined", name), widget)
+			}
+		}
+
+		if container, ok := widget.(models.ContainerWidget); ok {
+			if err := checkWidgetDataSources(config, container.GetWidgets()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Containers render their widgets on their own so restrictions can only be set
+// on the container as a whole
+func checkWidgetAccessRestrictions(config *models.Config, widgets models.Widgets, inContainer bool) error {
+	for _, widget := range widgets {
+		if restricted, ok := widget.(models.AccessRestrictedWidget); ok {
+			users, groups := restricted.GetAllowedUsers(), restricted.GetAllowedGroups()
+
+			if inContainer && (len(users) > 0 || len(groups) > 0) {
+				return FormatWidgetInitError(
+					errors.New("allowed-users and allowed-groups can't be set on widgets within a container, set them on the container instead"),
+					widget,
+				)
+			}
+
+			if err := checkAccessRestriction(config, users, groups); err != nil {
+				return FormatWidgetInitError(err, widget)
+			}
+		}
+
+		if restricted, ok := widget.(models.EditRestrictedWidget); ok {
+			if err := checkEditRestriction(config, restricted); err != nil {
+				return FormatWidgetInitError(err, widget)
+			}
+		}
+
+		if container, ok := widget.(models.ContainerWidget); ok {
+			if err := checkWidgetAccessRestrictions(config, container.GetWidgets(), true); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
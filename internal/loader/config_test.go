@@ -0,0 +1,95 @@
+package loader
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigVariables(t *testing.T) {
+	t.Setenv("GANDER_TEST_HOST", "example.com")
+	t.Setenv("GANDER_TEST_ENV", "PROD")
+	t.Setenv("GANDER_TEST_HOST_PROD", "prod.example.com")
+	t.Setenv("GANDER_TEST_EMPTY", "")
+
+	tests := []struct {
+		name      string
+		contents  string
+		expected  string
+		expectErr bool
+	}{
+		{"env variable", "url: https://${GANDER_TEST_HOST}/", "url: https://example.com/", false},
+		{"env variable with type", "url: ${env:GANDER_TEST_HOST}", "url: example.com", false},
+		{"empty env variable", "value: '${GANDER_TEST_EMPTY}'", "value: ''", false},
+		{"missing env variable", "url: ${GANDER_TEST_MISSING}", "", true},
+		{"default of missing variable", "port: ${GANDER_TEST_MISSING|8080}", "port: 8080", false},
+		{"default not used when set", "host: ${GANDER_TEST_HOST|localhost}", "host: example.com", false},
+		{"empty default", "host: '${GANDER_TEST_MISSING|}'", "host: ''", false},
+		{"default with a pipe", "cmd: ${GANDER_TEST_MISSING|a|b}", "cmd: a|b", false},
+		{"variable as default", "host: ${GANDER_TEST_MISSING|${GANDER_TEST_HOST}}", "host: example.com", false},
+		{"variable within name", "host: ${GANDER_TEST_HOST_${GANDER_TEST_ENV}}", "host: prod.example.com", false},
+		{"missing variable within default", "host: ${GANDER_TEST_MISSING|${GANDER_TEST_ALSO_MISSING}}", "", true},
+		{"escaped variable", `value: \${GANDER_TEST_HOST}`, "value: ${GANDER_TEST_HOST}", false},
+		{"not a variable name", "value: ${not a name}", "value: ${not a name}", false},
+		{"unclosed variable", "value: ${GANDER_TEST_HOST\nnext: line", "value: ${GANDER_TEST_HOST\nnext: line", false},
+		{"unknown type", "value: ${unknown:name}", "value: ${unknown:name}", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseConfigVariables([]byte(test.contents))
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to parse variables: %v", err)
+			}
+			if string(got) != test.expected {
+				t.Errorf("Got %q, expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseConfigVariablesByLine(t *testing.T) {
+	t.Setenv("GANDER_TEST_MULTILINE", "one\ntwo\nthree")
+	t.Setenv("GANDER_TEST_HOST", "example.com")
+
+	tests := []struct {
+		name     string
+		contents string
+		origins  []int
+	}{
+		{"no variables", "a: 1\nb: 2", []int{1, 2}},
+		{"single line variable", "a: ${GANDER_TEST_HOST}\nb: 2", []int{1, 2}},
+		{"multiline variable", "a: |\n  ${GANDER_TEST_MULTILINE}\nb: 2", []int{1, 2, 2, 2, 3}},
+		{"trailing newline", "a: ${GANDER_TEST_MULTILINE}\n", []int{1, 1, 1, 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expanded, origins, err := parseConfigVariablesByLine([]byte(test.contents))
+			if err != nil {
+				t.Fatalf("Failed to parse variables: %v", err)
+			}
+
+			all, err := ParseConfigVariables([]byte(test.contents))
+			if err != nil {
+				t.Fatalf("Failed to parse variables: %v", err)
+			}
+			if string(expanded) != string(all) {
+				t.Errorf("Expanding by line got %q, expected %q", expanded, all)
+			}
+
+			if lines := strings.Count(string(expanded), "\n") + 1; len(origins) != lines {
+				t.Errorf("Got %d origins for %d lines", len(origins), lines)
+			}
+			if !slices.Equal(origins, test.origins) {
+				t.Errorf("Got origins %v, expected %v", origins, test.origins)
+			}
+		})
+	}
+}
@@ -0,0 +1,933 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The config gets changed by editing the lines of the files that what's being
+// changed is defined in, which could be the main file or any of its includes,
+// so that comments and formatting are kept everywhere else. Whatever gets
+// written anew goes through yaml.Node, which keeps the comments within it.
+
+var ErrConfigChanged = errors.New("the config has changed since it was loaded")
+
+// A change to one of the files of the config that hasn't been written yet
+type FileChange struct {
+	Path   string
+	Before []byte
+	After  []byte
+	edits  []lineEdit
+}
+
+// Lines of a file that get replaced, where first is the line that the
+// replaced lines start at or that the added lines get inserted before
+type lineEdit struct {
+	first   int
+	removed []string
+	added   []string
+}
+
+// The resolved config along with what's needed to trace its nodes back to the
+// files they're defined in. Edits get recorded against the files while the
+// document gets changed the same way, which is what the edited files have to
+// resolve to.
+type configEditor struct {
+	mainFilePath string
+	sourceMap    *SourceMap
+	lines        []string
+	document     yaml.Node
+	files        map[string]*FileChange
+}
+
+// A list of widgets within the resolved config, such as the ones of a column
+type widgetList struct {
+	key, value *yaml.Node
+	blocks     []widgetBlock
+	// The lines of all of the widgets, as lines of the most deeply included
+	// file that has all of them
+	span fileSpan
+	// The indexes of the blocks of the widgets that are a part of the loaded
+	// config, which doesn't have the ones left out by the active profiles
+	kept []int
+}
+
+// The lines of the resolved config that a widget spans, which include the
+// comments right above it
+type widgetBlock struct {
+	node        *yaml.Node
+	first, last int
+	// Where the dash of the widget is
+	indent int
+}
+
+var (
+	emptyWidgetsKeyPattern   = regexp.MustCompile(`^([ \t]*(?:-[ \t]+)?)(widgets|head-widgets):[ \t]*(?:\[[ \t]*\]|~|null)?[ \t]*(#.*)?$`)
+	emptyWidgetsValuePattern = regexp.MustCompile(`^([ \t]*)\[[ \t]*\][ \t]*(?:#.*)?$`)
+)
+
+// Sets a property of the widget that starts on the given line of the resolved
+// config to the value, which gets encoded the same way yaml.Marshal would, or
+// removes the property if the value is nil. The changes are checked to result
+// in the expected config but don't get written.
+func SetWidgetOption(mainFilePath string, loadedContents []byte, widgetLine int, key string, value any) ([]*FileChange, error) {
+	return editConfig(mainFilePath, loadedContents, func(e *configEditor) error {
+		return e.setWidgetOption(widgetLine, key, value)
+	})
+}
+
+// Adds the widget to a column of a page at the given index. Like when
+// rearranging widgets, the page is identified by the lines that the widgets of
+// each of its columns start on. The widget can be anything that encodes to a
+// mapping with a type, such as a map or a *yaml.Node.
+func AddWidget(mainFilePath string, loadedContents []byte, columns [][]int, column, index int, widget any) ([]*FileChange, error) {
+	return editConfig(mainFilePath, loadedContents, func(e *configEditor) error {
+		return e.addWidget(columns, column, index, widget)
+	})
+}
+
+// Removes the widget that starts on the given line of the resolved config,
+// along with the comments right above it
+func RemoveWidget(mainFilePath string, loadedContents []byte, widgetLine int) ([]*FileChange, error) {
+	return editConfig(mainFilePath, loadedContents, func(e *configEditor) error {
+		return e.removeWidget(widgetLine)
+	})
+}
+
+// Resolves the config, which has to be the same as what it was loaded from,
+// and returns the changes made by edit once they've been checked. Lines within
+// errors get translated to the files they're in.
+func editConfig(mainFilePath string, loadedContents []byte, edit func(*configEditor) error) ([]*FileChange, error) {
+	if configTemplatingEnabled {
+		return nil, errors.New("the config can't be changed when config templates are enabled")
+	}
+
+	contents, _, sourceMap, err := ParseYAMLIncludes(mainFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(contents, loadedContents) {
+		return nil, ErrConfigChanged
+	}
+
+	e := &configEditor{
+		mainFilePath: mainFilePath,
+		sourceMap:    sourceMap,
+		lines:        strings.Split(string(contents), "\n"),
+		files:        make(map[string]*FileChange),
+	}
+	if err := yaml.Unmarshal(contents, &e.document); err != nil {
+		return nil, err
+	}
+	if len(e.document.Content) == 0 {
+		return nil, errors.New("the config is empty")
+	}
+
+	if err := edit(e); err != nil {
+		return nil, sourceMap.TranslateError(err)
+	}
+
+	changes, err := e.changes()
+	if err != nil {
+		return nil, sourceMap.TranslateError(err)
+	}
+
+	return changes, nil
+}
+
+func (e *configEditor) fileLines(path string) ([]string, error) {
+	if change, exists := e.files[path]; exists {
+		return strings.Split(string(change.Before), "\n"), nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	e.files[path] = &FileChange{Path: path, Before: contents}
+	return strings.Split(string(contents), "\n"), nil
+}
+
+// Replaces the lines from first to last of the file with the given ones, where
+// last being before first inserts them instead
+func (e *configEditor) edit(path string, first, last int, replacement []string) error {
+	lines, err := e.fileLines(path)
+	if err != nil {
+		return err
+	}
+
+	e.files[path].addEdit(lines, first, last, replacement)
+	return nil
+}
+
+// Finds the widget that starts on the given line within the pages of the
+// config, including the ones in the head of pages and within other widgets
+func (e *configEditor) findWidget(line int) (*widgetList, int, error) {
+	var found *widgetList
+	index := -1
+
+	var search func(node *yaml.Node)
+	search = func(node *yaml.Node) {
+		if found != nil {
+			return
+		}
+
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				if value.Kind != yaml.SequenceNode || (key.Value != "widgets" && key.Value != "head-widgets") {
+					continue
+				}
+				for j, item := range value.Content {
+					if item.Line == line && item.Kind == yaml.MappingNode {
+						found, index = &widgetList{key: key, value: value}, j
+						return
+					}
+				}
+			}
+		}
+
+		for _, child := range node.Content {
+			search(child)
+		}
+	}
+
+	_, pages := mappingEntry(e.document.Content[0], "pages")
+	if pages != nil {
+		search(pages)
+	}
+	if found == nil {
+		return nil, 0, fmt.Errorf("could not find the widget at line %d", line)
+	}
+
+	if err := e.locateWidgets(found); err != nil {
+		return nil, 0, err
+	}
+
+	return found, index, nil
+}
+
+// Finds the blocks of the widgets of the list and where they're defined
+func (e *configEditor) locateWidgets(list *widgetList) error {
+	list.blocks = widgetBlocks(e.lines, list.value)
+	if len(list.blocks) == 0 {
+		return nil
+	}
+
+	// the empty lines at the end of an included file are a part of the
+	// include, which can't be split up
+	last := &list.blocks[len(list.blocks)-1].last
+	for *last < len(e.lines) && strings.TrimSpace(e.lines[*last]) == "" && e.sourceMap.sameInclude(*last+1, *last) {
+		*last++
+	}
+
+	var err error
+	list.span, err = e.sourceMap.span(list.blocks[0].first, list.blocks[len(list.blocks)-1].last)
+	if err != nil {
+		return fmt.Errorf("the widgets starting at line %d: %w", list.blocks[0].node.Line, err)
+	}
+
+	return nil
+}
+
+// Where a widget of the list is defined, preferably at the same level as the
+// rest of the list so that includes of single widgets get treated as a part of
+// the widget rather than as a place for other widgets to go
+func (e *configEditor) blockSpan(list *widgetList, block *widgetBlock) (fileSpan, error) {
+	if span, err := e.sourceMap.spanWithin(block.first, block.last, list.span.includes); err == nil {
+		return span, nil
+	}
+
+	return e.sourceMap.span(block.first, block.last)
+}
+
+// Where the first widget goes within a list that doesn't have any, returning
+// the lines to replace and how indented the widgets have to be
+func (e *configEditor) emptyListEdit(list *widgetList) (file string, first, last, indent int, replacement []string, err error) {
+	span, err := e.sourceMap.span(list.key.Line, list.key.Line)
+	if err != nil {
+		return "", 0, 0, 0, nil, err
+	}
+
+	target, err := e.fileLines(span.file)
+	if err != nil {
+		return "", 0, 0, 0, nil, err
+	}
+
+	notOwnLine := fmt.Errorf("the %s property at line %d has to be on a line of its own", list.key.Value, list.key.Line)
+
+	if list.value.Line == list.key.Line || list.value.Kind == yaml.ScalarNode {
+		matches := emptyWidgetsKeyPattern.FindStringSubmatch(target[span.first-1])
+		if matches == nil {
+			return "", 0, 0, 0, nil, notOwnLine
+		}
+
+		keyLine := matches[1] + matches[2] + ":"
+		if matches[3] != "" {
+			keyLine += " " + matches[3]
+		}
+
+		return span.file, span.first, span.first, len(matches[1]) + 2, []string{keyLine}, nil
+	}
+
+	valueSpan, err := e.sourceMap.span(list.value.Line, list.value.Line)
+	if err != nil {
+		return "", 0, 0, 0, nil, err
+	}
+
+	matches := emptyWidgetsValuePattern.FindStringSubmatch(target[valueSpan.first-1])
+	if valueSpan.file != span.file || matches == nil {
+		return "", 0, 0, 0, nil, notOwnLine
+	}
+
+	return span.file, valueSpan.first, valueSpan.first, len(matches[1]), nil, nil
+}
+
+// What a list of widgets that no longer has any gets replaced with, since the
+// property can't be left without a value. The indent is the one of its widgets
+// within the file they're in.
+func emptyListLine(list *widgetList, indent int) string {
+	keyIndent := list.key.Column - 1
+	return strings.Repeat(" ", indent+max(0, keyIndent+2-list.blocks[0].indent)) + "[]"
+}
+
+func (e *configEditor) setWidgetOption(widgetLine int, key string, value any) error {
+	list, index, err := e.findWidget(widgetLine)
+	if err != nil {
+		return err
+	}
+	if key == "type" {
+		return errors.New("the type of a widget can't be changed")
+	}
+
+	block := &list.blocks[index]
+	span, err := e.sourceMap.span(block.first, block.last)
+	if err != nil {
+		return fmt.Errorf("the widget at line %d %w", widgetLine, err)
+	}
+
+	source, err := e.fileLines(span.file)
+	if err != nil {
+		return err
+	}
+	// empty lines between widgets are left where they are
+	last := span.last
+	for last > span.first && strings.TrimSpace(source[last-1]) == "" {
+		last--
+	}
+	blockLines := source[span.first-1 : last]
+
+	for _, line := range blockLines {
+		if configIncludePattern.MatchString(line) {
+			return fmt.Errorf("the widget at line %d has includes within it, which can't be edited", widgetLine)
+		}
+	}
+
+	indent := leadingWhitespace(blockLines[0])
+	dedented, err := reindentLines(blockLines, -indent)
+	if err != nil {
+		return fmt.Errorf("the widget at line %d %w", widgetLine, err)
+	}
+
+	// the widget gets edited on its own so that the rest of the file stays as is
+	var parsed yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.Join(dedented, "\n")), &parsed); err != nil {
+		return err
+	}
+	if len(parsed.Content) == 0 || len(parsed.Content[0].Content) != 1 {
+		return fmt.Errorf("the widget at line %d could not be edited on its own", widgetLine)
+	}
+
+	edited := parsed.Content[0].Content[0]
+	if err := setMappingValue(edited, key, value); err != nil {
+		return err
+	}
+	if err := setMappingValue(list.value.Content[index], key, value); err != nil {
+		return err
+	}
+
+	encoded, err := encodeYAMLLines(&parsed)
+	if err != nil {
+		return err
+	}
+	reindented, _ := reindentLines(encoded, indent)
+
+	return e.edit(span.file, span.first, last, reindented)
+}
+
+func (e *configEditor) addWidget(columns [][]int, column, index int, widget any) error {
+	_, lists, err := e.findPageColumns(columns)
+	if err != nil {
+		return err
+	}
+	if column < 0 || column >= len(lists) {
+		return fmt.Errorf("the page has no column %d", column+1)
+	}
+
+	list := &lists[column]
+	if index < 0 || index > len(list.kept) {
+		return fmt.Errorf("column %d has no place for a widget at %d", column+1, index+1)
+	}
+
+	// the index is among the widgets that were loaded, the widget goes right
+	// before the one that's there or right after the last one otherwise
+	switch {
+	case index < len(list.kept):
+		index = list.kept[index]
+	case len(list.kept) > 0:
+		index = list.kept[len(list.kept)-1] + 1
+	default:
+		index = len(list.blocks)
+	}
+
+	item := &yaml.Node{}
+	if err := item.Encode(widget); err != nil {
+		return err
+	}
+	if _, widgetType := mappingEntry(item, "type"); widgetType == nil || widgetType.Value == "" {
+		return errors.New("the widget has to have a type")
+	}
+	// maps get encoded with their keys sorted, the type reads better first
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		if item.Content[i].Value == "type" {
+			pair := slices.Clone(item.Content[i : i+2])
+			item.Content = slices.Insert(slices.Delete(item.Content, i, i+2), 0, pair...)
+			break
+		}
+	}
+
+	encoded, err := encodeYAMLLines(&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{item}})
+	if err != nil {
+		return err
+	}
+
+	var file string
+	var first, last, indent int
+	var replacement []string
+
+	switch {
+	case len(list.blocks) == 0:
+		file, first, last, indent, replacement, err = e.emptyListEdit(list)
+		if err != nil {
+			return err
+		}
+	case index == 0:
+		span, err := e.blockSpan(list, &list.blocks[0])
+		if err != nil {
+			return err
+		}
+		target, err := e.fileLines(span.file)
+		if err != nil {
+			return err
+		}
+		file, first, last, indent = span.file, span.first, span.first-1, leadingWhitespace(target[span.first-1])
+	default:
+		span, err := e.blockSpan(list, &list.blocks[index-1])
+		if err != nil {
+			return err
+		}
+		target, err := e.fileLines(span.file)
+		if err != nil {
+			return err
+		}
+		file, first, last, indent = span.file, span.last+1, span.last, leadingWhitespace(target[span.first-1])
+	}
+
+	reindented, _ := reindentLines(encoded, indent)
+	if err := e.edit(file, first, last, append(replacement, reindented...)); err != nil {
+		return err
+	}
+
+	list.value.Kind, list.value.Tag = yaml.SequenceNode, "!!seq"
+	list.value.Content = slices.Insert(list.value.Content, index, item)
+	return nil
+}
+
+func (e *configEditor) removeWidget(widgetLine int) error {
+	list, index, err := e.findWidget(widgetLine)
+	if err != nil {
+		return err
+	}
+
+	span, err := e.blockSpan(list, &list.blocks[index])
+	if err != nil {
+		return fmt.Errorf("the widget at line %d is defined within an include along with other widgets, which can't be split up", widgetLine)
+	}
+
+	target, err := e.fileLines(span.file)
+	if err != nil {
+		return err
+	}
+
+	// empty lines between widgets are left where they are
+	last := span.last
+	for last > span.first && strings.TrimSpace(target[last-1]) == "" {
+		last--
+	}
+
+	var replacement []string
+	if len(list.blocks) == 1 {
+		replacement = []string{emptyListLine(list, leadingWhitespace(target[span.first-1]))}
+	}
+
+	if err := e.edit(span.file, span.first, last, replacement); err != nil {
+		return err
+	}
+
+	list.value.Content = slices.Delete(list.value.Content, index, index+1)
+	return nil
+}
+
+// Finds the columns of the page whose widgets start on the given lines. Pages,
+// columns and widgets left out by the active profiles aren't a part of the
+// loaded config and so get skipped over.
+func (e *configEditor) findPageColumns(current [][]int) (int, []widgetList, error) {
+	_, pages := mappingEntry(e.document.Content[0], "pages")
+	if pages == nil || pages.Kind != yaml.SequenceNode {
+		return 0, nil, errors.New("the config has no pages")
+	}
+
+search:
+	for p, page := range pages.Content {
+		if !isKeptByProfiles(page) {
+			continue
+		}
+
+		_, columnsNode := mappingEntry(page, "columns")
+		if columnsNode == nil || columnsNode.Kind != yaml.SequenceNode {
+			continue
+		}
+
+		var columnNodes []*yaml.Node
+		for _, columnNode := range columnsNode.Content {
+			if isKeptByProfiles(columnNode) {
+				columnNodes = append(columnNodes, columnNode)
+			}
+		}
+		if len(columnNodes) != len(current) {
+			continue
+		}
+
+		lists := make([]widgetList, len(current))
+		matched := 0
+
+		for c, columnNode := range columnNodes {
+			key, value := mappingEntry(columnNode, "widgets")
+			if key == nil {
+				continue search
+			}
+
+			var items []*yaml.Node
+			if value.Kind == yaml.SequenceNode {
+				items = value.Content
+			} else if value.Kind != yaml.ScalarNode || value.Tag != "!!null" {
+				continue search
+			}
+
+			var kept []int
+			for i, item := range items {
+				if isKeptByProfiles(item) {
+					kept = append(kept, i)
+				}
+			}
+
+			if len(kept) != len(current[c]) {
+				continue search
+			}
+			for i, k := range kept {
+				if items[k].Line != current[c][i] {
+					continue search
+				}
+			}
+			if len(items) > 0 && value.Style&yaml.FlowStyle != 0 {
+				return 0, nil, fmt.Errorf("column %d: widgets written in flow style can't be changed", c+1)
+			}
+
+			lists[c] = widgetList{key: key, value: value, kept: kept}
+			matched += len(kept)
+		}
+
+		if matched > 0 {
+			for c := range lists {
+				if err := e.locateWidgets(&lists[c]); err != nil {
+					return 0, nil, fmt.Errorf("column %d: %w", c+1, err)
+				}
+			}
+			return p, lists, nil
+		}
+	}
+
+	return 0, nil, errors.New("could not find the page within the config")
+}
+
+// Applies the recorded edits and makes sure that the edited files resolve to
+// the document as it's been changed
+func (e *configEditor) changes() ([]*FileChange, error) {
+	var changes []*FileChange
+	for _, change := range e.files {
+		if len(change.edits) == 0 {
+			continue
+		}
+		if err := change.apply(); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	readFile := func(path string) ([]byte, error) {
+		if absPath, err := filepath.Abs(path); err == nil {
+			path = absPath
+		}
+		for _, change := range changes {
+			if change.Path == path {
+				return change.After, nil
+			}
+		}
+		return os.ReadFile(path)
+	}
+
+	contents, _, _, err := recursiveParseYAMLIncludes(e.mainFilePath, nil, 0, readFile)
+	if err != nil {
+		return nil, fmt.Errorf("the changed config can't be resolved: %w", err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, fmt.Errorf("the changed config can't be parsed: %w", err)
+	}
+	if len(document.Content) == 0 || comparableNode(document.Content[0]) != comparableNode(e.document.Content[0]) {
+		return nil, errors.New("the changed config doesn't turn out as expected")
+	}
+
+	return changes, nil
+}
+
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+
+	return nil, nil
+}
+
+// Sets the value of the key within the mapping, keeping the comments of the
+// key when it already exists, or removes the key if the value is nil
+func setMappingValue(node *yaml.Node, key string, value any) error {
+	index := -1
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			index = i
+			break
+		}
+	}
+
+	if value == nil {
+		if index != -1 {
+			node.Content = slices.Delete(node.Content, index, index+2)
+		}
+		return nil
+	}
+
+	encoded := &yaml.Node{}
+	if err := encoded.Encode(value); err != nil {
+		return err
+	}
+
+	if index != -1 {
+		encoded.LineComment = node.Content[index+1].LineComment
+		node.Content[index+1] = encoded
+		return nil
+	}
+
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, encoded)
+	return nil
+}
+
+func encodeYAMLLines(node *yaml.Node) ([]string, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n"), nil
+}
+
+func widgetBlocks(lines []string, sequence *yaml.Node) []widgetBlock {
+	if sequence.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	blocks := make([]widgetBlock, len(sequence.Content))
+
+	for i, item := range sequence.Content {
+		first := item.Line
+		// the dash can be on a line of its own
+		if first > 1 && strings.TrimSpace(lines[first-2]) == "-" {
+			first--
+		}
+
+		indent := leadingWhitespace(lines[first-1])
+		for first > 1 {
+			above := lines[first-2]
+			if !strings.HasPrefix(strings.TrimSpace(above), "#") || leadingWhitespace(above) != indent {
+				break
+			}
+			first--
+		}
+
+		blocks[i] = widgetBlock{node: item, first: first, indent: indent}
+	}
+
+	for i := range blocks {
+		if i+1 < len(blocks) {
+			blocks[i].last = blocks[i+1].first - 1
+			continue
+		}
+
+		// the last widget goes on for as long as lines are indented further
+		// than its dash, not counting empty lines at its end
+		last := blocks[i].node.Line
+		for line := last + 1; line <= len(lines); line++ {
+			if strings.TrimSpace(lines[line-1]) == "" {
+				continue
+			}
+			if leadingWhitespace(lines[line-1]) <= blocks[i].indent {
+				break
+			}
+			last = line
+		}
+		blocks[i].last = last
+	}
+
+	return blocks
+}
+
+func leadingWhitespace(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func reindentLines(lines []string, by int) ([]string, error) {
+	reindented := make([]string, len(lines))
+
+	for i, line := range lines {
+		switch {
+		case by >= 0 && strings.TrimSpace(line) == "":
+			reindented[i] = line
+		case by >= 0:
+			reindented[i] = strings.Repeat(" ", by) + line
+		case leadingWhitespace(line) >= -by:
+			reindented[i] = line[-by:]
+		case strings.TrimSpace(line) == "":
+			reindented[i] = ""
+		default:
+			return nil, errors.New("can't be indented any less")
+		}
+	}
+
+	return reindented, nil
+}
+
+// Replaces the lines from first to last, which are part of lines, with the
+// given ones, only recording the lines that actually change
+func (c *FileChange) addEdit(lines []string, first, last int, replacement []string) {
+	removed := lines[first-1 : last]
+	n, m := len(removed), len(replacement)
+
+	// the lengths of the longest common subsequences of what's left of both
+	common := make([][]int, n+1)
+	for i := range common {
+		common[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if removed[i] == replacement[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var current *lineEdit
+	flush := func() {
+		if current != nil {
+			c.edits = append(c.edits, *current)
+			current = nil
+		}
+	}
+
+	for i, j := 0, 0; i < n || j < m; {
+		if i < n && j < m && removed[i] == replacement[j] {
+			flush()
+			i++
+			j++
+			continue
+		}
+
+		if current == nil {
+			current = &lineEdit{first: first + i}
+		}
+		if i < n && (j == m || common[i+1][j] >= common[i][j+1]) {
+			current.removed = append(current.removed, removed[i])
+			i++
+		} else {
+			current.added = append(current.added, replacement[j])
+			j++
+		}
+	}
+	flush()
+}
+
+func (c *FileChange) apply() error {
+	sort.Slice(c.edits, func(i, j int) bool { return c.edits[i].first < c.edits[j].first })
+
+	for i := 1; i < len(c.edits); i++ {
+		if c.edits[i-1].first+len(c.edits[i-1].removed) > c.edits[i].first {
+			return fmt.Errorf("%s: changes overlap", c.Path)
+		}
+	}
+
+	lines := strings.Split(string(c.Before), "\n")
+	for i := len(c.edits) - 1; i >= 0; i-- {
+		edit := c.edits[i]
+		lines = slices.Replace(lines, edit.first-1, edit.first-1+len(edit.removed), edit.added...)
+	}
+
+	c.After = []byte(strings.Join(lines, "\n"))
+	return nil
+}
+
+// Writes the file while keeping its permissions
+func (c *FileChange) Write() error {
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.Path, c.After, info.Mode().Perm())
+}
+
+// Nodes are the same if they only differ in comments and formatting
+func comparableNode(node *yaml.Node) string {
+	var strip func(node *yaml.Node) *yaml.Node
+	strip = func(node *yaml.Node) *yaml.Node {
+		stripped := *node
+		stripped.HeadComment, stripped.LineComment, stripped.FootComment = "", "", ""
+		stripped.Style = 0
+		stripped.Content = make([]*yaml.Node, len(node.Content))
+		for i := range node.Content {
+			stripped.Content[i] = strip(node.Content[i])
+		}
+		return &stripped
+	}
+
+	contents, err := yaml.Marshal(strip(node))
+	if err != nil {
+		return ""
+	}
+
+	return string(contents)
+}
+
+// Renders the changes in the unified diff format with the paths of files being
+// relative to the directory of the main config file
+func UnifiedDiff(mainFilePath string, changes []*FileChange) string {
+	baseDir := ""
+	if absPath, err := filepath.Abs(mainFilePath); err == nil {
+		baseDir = filepath.Dir(absPath)
+	}
+
+	var diff strings.Builder
+	for _, change := range changes {
+		name := change.Path
+		if relative, err := filepath.Rel(baseDir, name); err == nil {
+			name = relative
+		}
+		name = filepath.ToSlash(name)
+
+		fmt.Fprintf(&diff, "--- a/%s\n+++ b/%s\n", name, name)
+		change.writeHunks(&diff)
+	}
+
+	return diff.String()
+}
+
+func (c *FileChange) writeHunks(diff *strings.Builder) {
+	const context = 3
+
+	lines := strings.Split(string(c.Before), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	offset := 0
+	for i := 0; i < len(c.edits); {
+		// edits that are close enough to share their context go into one hunk
+		j := i + 1
+		for j < len(c.edits) && c.edits[j].first-(c.edits[j-1].first+len(c.edits[j-1].removed)) <= 2*context {
+			j++
+		}
+		group := c.edits[i:j]
+		lastEdit := group[len(group)-1]
+
+		start := max(1, group[0].first-context)
+		end := min(len(lines), lastEdit.first+len(lastEdit.removed)-1+context)
+
+		var hunk strings.Builder
+		oldCount, newCount := 0, 0
+		line := start
+
+		for _, edit := range group {
+			for ; line < edit.first; line++ {
+				hunk.WriteString(" " + lines[line-1] + "\n")
+				oldCount++
+				newCount++
+			}
+			for _, removed := range edit.removed {
+				hunk.WriteString("-" + removed + "\n")
+				oldCount++
+			}
+			for _, added := range edit.added {
+				hunk.WriteString("+" + added + "\n")
+				newCount++
+			}
+			line += len(edit.removed)
+		}
+		for ; line <= end; line++ {
+			hunk.WriteString(" " + lines[line-1] + "\n")
+			oldCount++
+			newCount++
+		}
+
+		fmt.Fprintf(diff, "@@ -%d,%d +%d,%d @@\n", start, oldCount, start+offset, newCount)
+		diff.WriteString(hunk.String())
+
+		for _, edit := range group {
+			offset += len(edit.added) - len(edit.removed)
+		}
+		i = j
+	}
+}
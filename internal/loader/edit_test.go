@@ -0,0 +1,183 @@
+package loader_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
+)
+
+// Writes the files of the config and loads it the way the server does,
+// returning the lines that the widgets of each column of the first page start
+// on according to the loaded config
+func loadTestConfig(t *testing.T, files map[string]string) (string, []byte, [][]int) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	mainFilePath := filepath.Join(dir, "glance.yml")
+	contents, _, sourceMap, err := loader.ParseYAMLIncludes(mainFilePath)
+	if err != nil {
+		t.Fatalf("Failed to parse includes: %v", err)
+	}
+
+	config, err := loader.NewConfigFromYAML(contents)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", sourceMap.TranslateError(err))
+	}
+
+	columns := make([][]int, len(config.Pages[0].Columns))
+	for c, column := range config.Pages[0].Columns {
+		for _, widget := range column.Widgets {
+			columns[c] = append(columns[c], widget.(models.LocatedWidget).GetSourceLine())
+		}
+	}
+
+	return mainFilePath, contents, columns
+}
+
+func writeTestChanges(t *testing.T, changes []*loader.FileChange) map[string]string {
+	t.Helper()
+
+	written := make(map[string]string)
+	for _, change := range changes {
+		if err := change.Write(); err != nil {
+			t.Fatalf("Failed to write %s: %v", change.Path, err)
+		}
+		written[filepath.Base(change.Path)] = string(change.After)
+	}
+
+	return written
+}
+
+func htmlWidgets(indent string, titles ...string) string {
+	var widgets strings.Builder
+	for _, title := range titles {
+		widgets.WriteString(indent + "- type: html\n")
+		widgets.WriteString(indent + "  title: " + title + "\n")
+		widgets.WriteString(indent + "  source: " + strings.ToLower(title) + "\n")
+	}
+
+	return widgets.String()
+}
+
+func TestEditWidgets(t *testing.T) {
+	const header = "pages:\n  - name: Home\n    columns:\n      - size: full\n        widgets:\n"
+
+	tests := []struct {
+		name      string
+		widgets   string
+		edit      func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error)
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:    "set an option",
+			widgets: htmlWidgets("          ", "A", "B"),
+			edit: func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error) {
+				return loader.SetWidgetOption(mainFilePath, contents, current[0][1], "title", "Renamed")
+			},
+			expected: htmlWidgets("          ", "A") + "          - type: html\n            title: Renamed\n            source: b\n",
+		},
+		{
+			name:    "add an option",
+			widgets: htmlWidgets("          ", "A"),
+			edit: func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error) {
+				return loader.SetWidgetOption(mainFilePath, contents, current[0][0], "hide-header", true)
+			},
+			expected: "          - type: html\n            title: A\n            source: a\n            hide-header: true\n",
+		},
+		{
+			name:    "remove an option",
+			widgets: htmlWidgets("          ", "A"),
+			edit: func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error) {
+				return loader.SetWidgetOption(mainFilePath, contents, current[0][0], "title", nil)
+			},
+			expected: "          - type: html\n            source: a\n",
+		},
+		{
+			name:    "type can't be changed",
+			widgets: htmlWidgets("          ", "A"),
+			edit: func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error) {
+				return loader.SetWidgetOption(mainFilePath, contents, current[0][0], "type", "clock")
+			},
+			expectErr: true,
+		},
+		{
+			name:    "remove a widget",
+			widgets: htmlWidgets("          ", "A", "B"),
+			edit: func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error) {
+				return loader.RemoveWidget(mainFilePath, contents, current[0][0])
+			},
+			expected: htmlWidgets("          ", "B"),
+		},
+		{
+			name:    "remove the last widget",
+			widgets: htmlWidgets("          ", "A"),
+			edit: func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error) {
+				return loader.RemoveWidget(mainFilePath, contents, current[0][0])
+			},
+			expected: "          []\n",
+		},
+		{
+			name:    "add a widget",
+			widgets: htmlWidgets("          ", "A", "B"),
+			edit: func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error) {
+				widget := map[string]any{"type": "html", "source": "new"}
+				return loader.AddWidget(mainFilePath, contents, current, 0, 1, widget)
+			},
+			expected: htmlWidgets("          ", "A") + "          - type: html\n            source: new\n" + htmlWidgets("          ", "B"),
+		},
+		{
+			name: "add a widget next to ones left out by profiles",
+			widgets: htmlWidgets("          ", "A") +
+				"          - type: html\n            $if: gander-test-profile\n            source: hidden\n",
+			edit: func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error) {
+				widget := map[string]any{"type": "html", "source": "new"}
+				return loader.AddWidget(mainFilePath, contents, current, 0, 1, widget)
+			},
+			expected: htmlWidgets("          ", "A") + "          - type: html\n            source: new\n" +
+				"          - type: html\n            $if: gander-test-profile\n            source: hidden\n",
+		},
+		{
+			name:    "widgets need a type",
+			widgets: htmlWidgets("          ", "A"),
+			edit: func(mainFilePath string, contents []byte, current [][]int) ([]*loader.FileChange, error) {
+				return loader.AddWidget(mainFilePath, contents, current, 0, 0, map[string]any{"title": "untyped"})
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mainFilePath, contents, current := loadTestConfig(t, map[string]string{
+				"glance.yml": header + test.widgets,
+			})
+
+			changes, err := test.edit(mainFilePath, contents, current)
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("Expected editing to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to edit the config: %v", err)
+			}
+
+			written := writeTestChanges(t, changes)
+			if expected := header + test.expected; written["glance.yml"] != expected {
+				t.Errorf("glance.yml is\n%s\nexpected\n%s", written["glance.yml"], expected)
+			}
+		})
+	}
+}
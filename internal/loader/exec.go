@@ -0,0 +1,86 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	allowedExecCommandsEnvVariable = "GANDER_ALLOW_EXEC"
+	execVariableTimeout            = 30 * time.Second
+)
+
+var allowedExecCommands []string
+
+// Sets the commands that ${exec:...} variables are allowed to run, when none
+// are given the comma separated list from the GANDER_ALLOW_EXEC env variable
+// is used. Without any allowed commands exec variables are disabled.
+func SetAllowedExecCommands(commands string) {
+	if commands == "" {
+		commands = os.Getenv(allowedExecCommandsEnvVariable)
+	}
+
+	allowedExecCommands = allowedExecCommands[:0]
+
+	for command := range strings.SplitSeq(commands, ",") {
+		if command = strings.TrimSpace(command); command != "" {
+			allowedExecCommands = append(allowedExecCommands, command)
+		}
+	}
+}
+
+func init() {
+	SetAllowedExecCommands("")
+}
+
+// Everything that runs commands named by the config goes through this, so that
+// a config can't run anything that wasn't allowed when starting the process
+func CheckExecCommand(command string) error {
+	if len(allowedExecCommands) == 0 {
+		return fmt.Errorf("running commands is disabled, allow %s using --allow-exec or %s", command, allowedExecCommandsEnvVariable)
+	}
+
+	if !slices.Contains(allowedExecCommands, command) {
+		return fmt.Errorf("command %s is not allowed", command)
+	}
+
+	return nil
+}
+
+// Arguments are split on whitespace and passed to the command as they are,
+// there's no shell involved so quoting, pipes and the likes aren't supported
+func runExecVariableCommand(commandLine string) (string, error) {
+	args := strings.Fields(commandLine)
+	if len(args) == 0 {
+		return "", errors.New("exec: no command given")
+	}
+
+	if err := CheckExecCommand(args[0]); err != nil {
+		return "", fmt.Errorf("exec: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), execVariableTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("exec: running %s: %v: %s", args[0], err, message)
+		}
+
+		return "", fmt.Errorf("exec: running %s: %v", args[0], err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,350 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ImportFromHomer    = "homer"
+	ImportFromDashy    = "dashy"
+	ImportFromHeimdall = "heimdall"
+)
+
+var ImportSources = []string{ImportFromHomer, ImportFromDashy, ImportFromHeimdall}
+
+// What's common to the dashboards that can be imported, links grouped under
+// a title, some of which get their status checked
+type importedDashboard struct {
+	title    string
+	groups   []importedGroup
+	warnings []string
+}
+
+type importedGroup struct {
+	title string
+	links []importedLink
+}
+
+type importedLink struct {
+	title       string
+	url         string
+	description string
+	icon        string
+	checkURL    string
+	monitored   bool
+}
+
+type importedConfig struct {
+	Pages []importedPage `yaml:"pages"`
+}
+
+type importedPage struct {
+	Name    string           `yaml:"name"`
+	Columns []importedColumn `yaml:"columns"`
+}
+
+type importedColumn struct {
+	Size    string `yaml:"size"`
+	Widgets []any  `yaml:"widgets"`
+}
+
+type importedBookmarksWidget struct {
+	Type   string                   `yaml:"type"`
+	Groups []importedBookmarksGroup `yaml:"groups"`
+}
+
+type importedBookmarksGroup struct {
+	Title string             `yaml:"title,omitempty"`
+	Links []importedBookmark `yaml:"links"`
+}
+
+type importedBookmark struct {
+	Title       string `yaml:"title"`
+	URL         string `yaml:"url"`
+	Description string `yaml:"description,omitempty"`
+	Icon        string `yaml:"icon,omitempty"`
+}
+
+type importedMonitorWidget struct {
+	Type  string                `yaml:"type"`
+	Sites []importedMonitorSite `yaml:"sites"`
+}
+
+type importedMonitorSite struct {
+	Title    string `yaml:"title"`
+	URL      string `yaml:"url"`
+	CheckURL string `yaml:"check-url,omitempty"`
+	Icon     string `yaml:"icon,omitempty"`
+}
+
+// Converts the config of another dashboard into a page with its links as
+// bookmarks and the ones that had their status checked in a monitor. What
+// couldn't be converted is listed in comments at the top.
+func ImportConfig(from string, contents []byte) ([]byte, error) {
+	var dashboard *importedDashboard
+	var err error
+
+	switch from {
+	case ImportFromHomer:
+		dashboard, err = importHomerConfig(contents)
+	case ImportFromDashy:
+		dashboard, err = importDashyConfig(contents)
+	case ImportFromHeimdall:
+		dashboard, err = importHeimdallItems(contents)
+	default:
+		return nil, fmt.Errorf("unknown source %q, must be one of %s", from, strings.Join(ImportSources, ", "))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarks := importedBookmarksWidget{Type: "bookmarks"}
+	monitor := importedMonitorWidget{Type: "monitor"}
+
+	for _, group := range dashboard.groups {
+		bookmarksGroup := importedBookmarksGroup{Title: group.title}
+
+		for _, link := range group.links {
+			if link.url == "" {
+				dashboard.warnings = append(dashboard.warnings, fmt.Sprintf("%s was left out since it has no URL", link.title))
+				continue
+			}
+
+			bookmarksGroup.Links = append(bookmarksGroup.Links, importedBookmark{
+				Title:       link.title,
+				URL:         link.url,
+				Description: link.description,
+				Icon:        link.icon,
+			})
+
+			if link.monitored {
+				monitor.Sites = append(monitor.Sites, importedMonitorSite{
+					Title:    link.title,
+					URL:      link.url,
+					CheckURL: link.checkURL,
+					Icon:     link.icon,
+				})
+			}
+		}
+
+		if len(bookmarksGroup.Links) > 0 {
+			bookmarks.Groups = append(bookmarks.Groups, bookmarksGroup)
+		}
+	}
+
+	if len(bookmarks.Groups) == 0 {
+		return nil, errors.New("no links were found")
+	}
+
+	page := importedPage{
+		Name:    dashboard.title,
+		Columns: []importedColumn{{Size: "full", Widgets: []any{bookmarks}}},
+	}
+
+	if page.Name == "" {
+		page.Name = "Home"
+	}
+
+	if len(monitor.Sites) > 0 {
+		page.Columns = append(page.Columns, importedColumn{Size: "small", Widgets: []any{monitor}})
+	}
+
+	var output bytes.Buffer
+	fmt.Fprintf(&output, "# Imported from %s\n", from)
+	for _, warning := range dashboard.warnings {
+		fmt.Fprintf(&output, "# %s\n", warning)
+	}
+
+	encoder := yaml.NewEncoder(&output)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(importedConfig{Pages: []importedPage{page}}); err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
+
+// Homer's services are the groups, its links go in a group of their own and
+// the items of type Ping are the ones that get monitored
+func importHomerConfig(contents []byte) (*importedDashboard, error) {
+	var config struct {
+		Title    string `yaml:"title"`
+		Services []struct {
+			Name  string `yaml:"name"`
+			Items []struct {
+				Name     string `yaml:"name"`
+				Subtitle string `yaml:"subtitle"`
+				Logo     string `yaml:"logo"`
+				Icon     string `yaml:"icon"`
+				URL      string `yaml:"url"`
+				Type     string `yaml:"type"`
+				Endpoint string `yaml:"endpoint"`
+			} `yaml:"items"`
+		} `yaml:"services"`
+		Links []struct {
+			Name string `yaml:"name"`
+			Icon string `yaml:"icon"`
+			URL  string `yaml:"url"`
+		} `yaml:"links"`
+	}
+
+	if err := yaml.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("parsing Homer config: %w", err)
+	}
+
+	dashboard := &importedDashboard{title: config.Title}
+
+	for _, service := range config.Services {
+		group := importedGroup{title: service.Name}
+
+		for _, item := range service.Items {
+			// the icon is a Font Awesome class, which only gets used without a logo
+			icon := item.Logo
+			if icon == "" {
+				icon = item.Icon
+			}
+
+			group.links = append(group.links, importedLink{
+				title:       item.Name,
+				url:         item.URL,
+				description: item.Subtitle,
+				icon:        dashboard.convertIcon(item.Name, icon),
+				checkURL:    item.Endpoint,
+				monitored:   strings.EqualFold(item.Type, "ping"),
+			})
+		}
+
+		dashboard.groups = append(dashboard.groups, group)
+	}
+
+	if len(config.Links) > 0 {
+		group := importedGroup{title: "Links"}
+
+		for _, link := range config.Links {
+			group.links = append(group.links, importedLink{
+				title: link.Name,
+				url:   link.URL,
+				icon:  dashboard.convertIcon(link.Name, link.Icon),
+			})
+		}
+
+		dashboard.groups = append(dashboard.groups, group)
+	}
+
+	return dashboard, nil
+}
+
+// Dashy's sections are the groups, items get monitored when status checks are
+// enabled for them or for the whole dashboard
+func importDashyConfig(contents []byte) (*importedDashboard, error) {
+	var config struct {
+		PageInfo struct {
+			Title string `yaml:"title"`
+		} `yaml:"pageInfo"`
+		AppConfig struct {
+			StatusCheck bool `yaml:"statusCheck"`
+		} `yaml:"appConfig"`
+		Pages []struct {
+			Name string `yaml:"name"`
+			Path string `yaml:"path"`
+		} `yaml:"pages"`
+		Sections []struct {
+			Name  string `yaml:"name"`
+			Items []struct {
+				Title          string `yaml:"title"`
+				Description    string `yaml:"description"`
+				Icon           string `yaml:"icon"`
+				URL            string `yaml:"url"`
+				StatusCheck    *bool  `yaml:"statusCheck"`
+				StatusCheckURL string `yaml:"statusCheckUrl"`
+			} `yaml:"items"`
+		} `yaml:"sections"`
+	}
+
+	if err := yaml.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("parsing Dashy config: %w", err)
+	}
+
+	dashboard := &importedDashboard{title: config.PageInfo.Title}
+
+	for _, page := range config.Pages {
+		dashboard.warnings = append(dashboard.warnings, fmt.Sprintf("the page %s at %s has to be imported separately", page.Name, page.Path))
+	}
+
+	for _, section := range config.Sections {
+		group := importedGroup{title: section.Name}
+
+		for _, item := range section.Items {
+			monitored := config.AppConfig.StatusCheck
+			if item.StatusCheck != nil {
+				monitored = *item.StatusCheck
+			}
+
+			group.links = append(group.links, importedLink{
+				title:       item.Title,
+				url:         item.URL,
+				description: item.Description,
+				icon:        dashboard.convertIcon(item.Title, item.Icon),
+				checkURL:    item.StatusCheckURL,
+				monitored:   monitored,
+			})
+		}
+
+		dashboard.groups = append(dashboard.groups, group)
+	}
+
+	return dashboard, nil
+}
+
+// Heimdall keeps its items in a database, so they're taken from the JSON
+// file its items can be exported to
+func importHeimdallItems(contents []byte) (*importedDashboard, error) {
+	var items []struct {
+		Title       string `json:"title"`
+		URL         string `json:"url"`
+		Description string `json:"description"`
+	}
+
+	if err := json.Unmarshal(contents, &items); err != nil {
+		return nil, fmt.Errorf("parsing Heimdall items: %w", err)
+	}
+
+	dashboard := &importedDashboard{title: "Home"}
+	group := importedGroup{}
+
+	for _, item := range items {
+		group.links = append(group.links, importedLink{
+			title:       item.Title,
+			url:         item.URL,
+			description: item.Description,
+		})
+	}
+
+	dashboard.groups = append(dashboard.groups, group)
+	return dashboard, nil
+}
+
+// Icons that are URLs are kept as they are while those from the icon sets
+// that are also supported here get their prefix changed, the rest are left
+// out with a warning since there's no way to tell what they'd point to
+func (d *importedDashboard) convertIcon(title, icon string) string {
+	if icon == "" || strings.HasPrefix(icon, "http://") || strings.HasPrefix(icon, "https://") {
+		return icon
+	}
+
+	for from, to := range map[string]string{"hl-": "di:", "si-": "si:", "mdi-": "mdi:", "sh-": "sh:"} {
+		if name, found := strings.CutPrefix(icon, from); found {
+			return to + name
+		}
+	}
+
+	d.warnings = append(d.warnings, fmt.Sprintf("the icon %s of %s was left out", icon, title))
+	return ""
+}
@@ -0,0 +1,188 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Moves the widgets within the columns of a page around. Widgets are identified
+// by the line of the resolved config that they start on, with current having
+// them in the order they were loaded from loadedContents and desired in the
+// order they should end up in. The changes are checked to result in the
+// desired layout but don't get written.
+func RearrangeWidgets(mainFilePath string, loadedContents []byte, current, desired [][]int) ([]*FileChange, error) {
+	if len(current) != len(desired) {
+		return nil, fmt.Errorf("expected %d columns, got %d", len(current), len(desired))
+	}
+
+	return editConfig(mainFilePath, loadedContents, func(e *configEditor) error {
+		return e.rearrangeWidgets(current, desired)
+	})
+}
+
+func (e *configEditor) rearrangeWidgets(current, desired [][]int) error {
+	_, columns, err := e.findPageColumns(current)
+	if err != nil {
+		return err
+	}
+
+	// widgets left out by the active profiles stay where they are within
+	// their column while the rest get placed around them
+	current, desired = slices.Clone(current), slices.Clone(desired)
+	for c := range columns {
+		current[c] = columns[c].withLeftOut(current[c])
+		desired[c] = columns[c].withLeftOut(desired[c])
+	}
+
+	blockOfLine := make(map[int]*widgetBlock)
+	columnOfLine := make(map[int]*widgetList)
+
+	for c := range columns {
+		for b := range columns[c].blocks {
+			blockOfLine[columns[c].blocks[b].node.Line] = &columns[c].blocks[b]
+			columnOfLine[columns[c].blocks[b].node.Line] = &columns[c]
+		}
+	}
+
+	seen := make(map[int]bool)
+	for _, lines := range desired {
+		for _, line := range lines {
+			if blockOfLine[line] == nil || seen[line] {
+				return fmt.Errorf("the widget at line %d can't be placed there", line)
+			}
+			seen[line] = true
+		}
+	}
+	if len(seen) != len(blockOfLine) {
+		return errors.New("all of the widgets of the page have to be placed")
+	}
+
+	for c := range columns {
+		column := &columns[c]
+
+		if slices.Equal(current[c], desired[c]) {
+			continue
+		}
+
+		// the widgets that end up in the column, as lines of the files they're in
+		var moved [][]string
+		var movedIndents []int
+		var movedFiles []string
+
+		for _, line := range desired[c] {
+			block, from := blockOfLine[line], columnOfLine[line]
+
+			span, err := e.sourceMap.spanWithin(block.first, block.last, from.span.includes)
+			if err != nil {
+				return fmt.Errorf(
+					"the widget at line %d is defined within an include along with other widgets, which can't be split up",
+					line,
+				)
+			}
+
+			source, err := e.fileLines(span.file)
+			if err != nil {
+				return err
+			}
+
+			blockLines := source[span.first-1 : span.last]
+			moved = append(moved, blockLines)
+			movedIndents = append(movedIndents, leadingWhitespace(blockLines[0]))
+			movedFiles = append(movedFiles, span.file)
+		}
+
+		var file string
+		var first, last, indent int
+		var replacement []string
+
+		if len(column.blocks) > 0 {
+			file, first, last = column.span.file, column.span.first, column.span.last
+
+			target, err := e.fileLines(file)
+			if err != nil {
+				return err
+			}
+			indent = leadingWhitespace(target[first-1])
+
+			if len(moved) == 0 {
+				replacement = []string{emptyListLine(column, indent)}
+			}
+		} else {
+			file, first, last, indent, replacement, err = e.emptyListEdit(column)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, blockLines := range moved {
+			if err := checkMovedIncludes(blockLines, movedFiles[i], file); err != nil {
+				return fmt.Errorf("the widget at line %d %w", desired[c][i], err)
+			}
+
+			reindented, err := reindentLines(blockLines, indent-movedIndents[i])
+			if err != nil {
+				return fmt.Errorf("the widget at line %d %w", desired[c][i], err)
+			}
+
+			replacement = append(replacement, reindented...)
+		}
+
+		if err := e.edit(file, first, last, replacement); err != nil {
+			return err
+		}
+	}
+
+	for c := range columns {
+		items := make([]*yaml.Node, 0, len(desired[c]))
+		for _, line := range desired[c] {
+			items = append(items, blockOfLine[line].node)
+		}
+
+		columns[c].value.Kind, columns[c].value.Tag = yaml.SequenceNode, "!!seq"
+		columns[c].value.Content = items
+	}
+
+	return nil
+}
+
+// Inserts the lines of the widgets that aren't kept by the active profiles at
+// the same indexes they're at within the list, or at the end if there are
+// fewer widgets than that
+func (list *widgetList) withLeftOut(lines []int) []int {
+	lines = slices.Clone(lines)
+
+	for i, block := range list.blocks {
+		if !slices.Contains(list.kept, i) {
+			lines = slices.Insert(lines, min(i, len(lines)), block.node.Line)
+		}
+	}
+
+	return lines
+}
+
+// Includes with relative paths would point somewhere else once moved to a file
+// within another directory
+func checkMovedIncludes(lines []string, from, to string) error {
+	if filepath.Dir(from) == filepath.Dir(to) {
+		return nil
+	}
+
+	for _, line := range lines {
+		matches := configIncludePattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		path := strings.TrimSpace(matches[2])
+		if !filepath.IsAbs(path) && !strings.Contains(path, "${") {
+			return fmt.Errorf("includes %s, which can't be moved to a file in another directory", path)
+		}
+	}
+
+	return nil
+}
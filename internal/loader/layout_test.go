@@ -0,0 +1,221 @@
+package loader_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/limpdev/gander/internal/loader"
+)
+
+func TestRearrangeWidgets(t *testing.T) {
+	const header = "pages:\n  - name: Home\n    columns:\n"
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		// indexes of the widgets of the loaded config, counted across columns
+		desired   [][]int
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name: "within a column",
+			files: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" + htmlWidgets("          ", "A", "B", "C"),
+			},
+			desired: [][]int{{2, 0, 1}},
+			expected: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" + htmlWidgets("          ", "C", "A", "B"),
+			},
+		},
+		{
+			name: "between columns",
+			files: map[string]string{
+				"glance.yml": header +
+					"      - size: small\n        widgets:\n" + htmlWidgets("          ", "A", "B") +
+					"      - size: full\n        widgets:\n" + htmlWidgets("          ", "C"),
+			},
+			desired: [][]int{{1}, {2, 0}},
+			expected: map[string]string{
+				"glance.yml": header +
+					"      - size: small\n        widgets:\n" + htmlWidgets("          ", "B") +
+					"      - size: full\n        widgets:\n" + htmlWidgets("          ", "C", "A"),
+			},
+		},
+		{
+			name: "comments move along with widgets",
+			files: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" +
+					"          # about A\n" + htmlWidgets("          ", "A") +
+					"          # about B\n" + htmlWidgets("          ", "B"),
+			},
+			desired: [][]int{{1, 0}},
+			expected: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" +
+					"          # about B\n" + htmlWidgets("          ", "B") +
+					"          # about A\n" + htmlWidgets("          ", "A"),
+			},
+		},
+		{
+			name: "variables that expand to several lines",
+			files: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" +
+					"          - type: html\n            title: Multiline\n            source: |\n              ${GANDER_TEST_MULTILINE}\n" +
+					htmlWidgets("          ", "B"),
+			},
+			desired: [][]int{{1, 0}},
+			expected: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" +
+					htmlWidgets("          ", "B") +
+					"          - type: html\n            title: Multiline\n            source: |\n              ${GANDER_TEST_MULTILINE}\n",
+			},
+		},
+		{
+			name: "widgets left out by profiles stay where they are",
+			files: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" +
+					htmlWidgets("          ", "A") +
+					"          - type: html\n            $if: gander-test-profile\n            title: Hidden\n            source: hidden\n" +
+					htmlWidgets("          ", "B", "C"),
+			},
+			desired: [][]int{{2, 0, 1}},
+			expected: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" +
+					htmlWidgets("          ", "C") +
+					"          - type: html\n            $if: gander-test-profile\n            title: Hidden\n            source: hidden\n" +
+					htmlWidgets("          ", "A", "B"),
+			},
+		},
+		{
+			name: "columns left out by profiles",
+			files: map[string]string{
+				"glance.yml": header +
+					"      - size: small\n        $if: gander-test-profile\n        widgets:\n" + htmlWidgets("          ", "Hidden") +
+					"      - size: full\n        widgets:\n" + htmlWidgets("          ", "A", "B"),
+			},
+			desired: [][]int{{1, 0}},
+			expected: map[string]string{
+				"glance.yml": header +
+					"      - size: small\n        $if: gander-test-profile\n        widgets:\n" + htmlWidgets("          ", "Hidden") +
+					"      - size: full\n        widgets:\n" + htmlWidgets("          ", "B", "A"),
+			},
+		},
+		{
+			name: "widgets within includes",
+			files: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" +
+					htmlWidgets("          ", "A") + "          - $include: b.yml\n",
+				"b.yml": htmlWidgets("", "B"),
+			},
+			desired: [][]int{{1, 0}},
+			expected: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" +
+					"          - $include: b.yml\n" + htmlWidgets("          ", "A"),
+			},
+		},
+		{
+			name: "widgets that share an include can't be split up",
+			files: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" +
+					"          - $include: shared.yml\n" + htmlWidgets("          ", "C"),
+				"shared.yml": htmlWidgets("", "A", "B"),
+			},
+			desired:   [][]int{{1, 0, 2}},
+			expectErr: true,
+		},
+		{
+			name: "every widget has to be placed",
+			files: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" + htmlWidgets("          ", "A", "B"),
+			},
+			desired:   [][]int{{1}},
+			expectErr: true,
+		},
+		{
+			name: "widgets can't be placed twice",
+			files: map[string]string{
+				"glance.yml": header + "      - size: full\n        widgets:\n" + htmlWidgets("          ", "A", "B"),
+			},
+			desired:   [][]int{{1, 1}},
+			expectErr: true,
+		},
+	}
+
+	t.Setenv("GANDER_TEST_MULTILINE", "one\n              two\n              three")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mainFilePath, contents, current := loadTestConfig(t, test.files)
+
+			var loaded []int
+			for _, lines := range current {
+				loaded = append(loaded, lines...)
+			}
+
+			desired := make([][]int, len(test.desired))
+			for c, indexes := range test.desired {
+				desired[c] = make([]int, 0, len(indexes))
+				for _, index := range indexes {
+					desired[c] = append(desired[c], loaded[index])
+				}
+			}
+
+			changes, err := loader.RearrangeWidgets(mainFilePath, contents, current, desired)
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("Expected rearranging to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to rearrange widgets: %v", err)
+			}
+
+			written := writeTestChanges(t, changes)
+			if len(written) != len(test.expected) {
+				t.Errorf("Changed %d files, expected %d", len(written), len(test.expected))
+			}
+			for name, expected := range test.expected {
+				if written[name] != expected {
+					t.Errorf("%s is\n%s\nexpected\n%s", name, written[name], expected)
+				}
+			}
+
+			// the written config has to load with the widgets where they were put
+			_, _, rearranged := loadTestConfig(t, mergeFiles(test.files, written))
+			for c := range desired {
+				if len(rearranged[c]) != len(desired[c]) {
+					t.Errorf("Column %d has %d widgets after loading, expected %d", c+1, len(rearranged[c]), len(desired[c]))
+				}
+			}
+		})
+	}
+}
+
+func mergeFiles(files, changed map[string]string) map[string]string {
+	merged := make(map[string]string, len(files))
+	for name, contents := range files {
+		merged[name] = contents
+	}
+	for name, contents := range changed {
+		merged[name] = contents
+	}
+
+	return merged
+}
+
+func TestRearrangeWidgetsAfterConfigChanged(t *testing.T) {
+	mainFilePath, contents, current := loadTestConfig(t, map[string]string{
+		"glance.yml": "pages:\n  - name: Home\n    columns:\n      - size: full\n        widgets:\n" + htmlWidgets("          ", "A", "B"),
+	})
+
+	if err := os.WriteFile(mainFilePath, append(contents, "# edited\n"...), 0o644); err != nil {
+		t.Fatalf("Failed to edit config: %v", err)
+	}
+
+	desired := [][]int{{current[0][1], current[0][0]}}
+	if _, err := loader.RearrangeWidgets(mainFilePath, contents, current, desired); !errors.Is(err, loader.ErrConfigChanged) {
+		t.Fatalf("Expected %v, got %v", loader.ErrConfigChanged, err)
+	}
+}
@@ -0,0 +1,197 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redactedValue = "<redacted>"
+
+// Keys whose values get redacted regardless of where the value came from,
+// matched case-insensitively against any part of the key
+var sensitiveConfigKeys = []string{
+	"password",
+	"secret",
+	"token",
+	"api-key",
+	"apikey",
+	"authorization",
+}
+
+// Prepares the config for being shared, e.g. in a bug report. Resolving
+// variables shows the effective config, redacting replaces the values of
+// sensitive properties as well as anything that came from a variable while
+// keeping every line where it was so that line numbers still match up
+func PrepareConfigForPrint(contents []byte, resolveVariables, redactSecrets bool) ([]byte, error) {
+	var err error
+
+	if resolveVariables {
+		contents, err = parseConfigVariables(contents, redactSecrets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if redactSecrets {
+		contents, err = redactSensitiveValues(contents)
+		if err != nil {
+			return nil, fmt.Errorf("redacting secrets: %w", err)
+		}
+	}
+
+	return contents, nil
+}
+
+func isSensitiveConfigKey(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, sensitive := range sensitiveConfigKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func redactSensitiveValues(contents []byte) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, err
+	}
+
+	lines := bytes.Split(contents, []byte("\n"))
+
+	var walk func(node *yaml.Node, inFlow bool)
+	walk = func(node *yaml.Node, inFlow bool) {
+		inFlow = inFlow || node.Style&yaml.FlowStyle != 0
+
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+
+				if value.Kind == yaml.ScalarNode && value.Value != "" && isSensitiveConfigKey(key.Value) {
+					redactScalarInLines(lines, key, value, inFlow)
+					continue
+				}
+
+				walk(value, inFlow)
+			}
+
+			return
+		}
+
+		for _, child := range node.Content {
+			walk(child, inFlow)
+		}
+	}
+
+	walk(&document, false)
+
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+func redactScalarInLines(lines [][]byte, key, value *yaml.Node, inFlow bool) {
+	lineIndex := value.Line - 1
+	if lineIndex < 0 || lineIndex >= len(lines) {
+		return
+	}
+
+	line := lines[lineIndex]
+	start := value.Column - 1
+	if start < 0 || start > len(line) {
+		return
+	}
+
+	keyIndent := key.Column - 1
+
+	if value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		// block scalars span multiple lines below the indicator, blank them
+		// out rather than removing them to keep the line numbers the same
+		blankMoreIndentedLines(lines, lineIndex+1, keyIndent)
+		lines[lineIndex] = append(append([]byte{}, line[:start]...), redactedValue...)
+		return
+	}
+
+	end := scalarEnd(line, start, value.Style, inFlow)
+	redacted := make([]byte, 0, len(line))
+	redacted = append(redacted, line[:start]...)
+	redacted = append(redacted, redactedValue...)
+	redacted = append(redacted, line[end:]...)
+	lines[lineIndex] = redacted
+
+	if inFlow {
+		return
+	}
+
+	// quoted and plain scalars can also continue on the lines below, as long
+	// as those are indented more than the key
+	switch {
+	case value.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0:
+		if _, closed := quotedScalarEnd(line, start, value.Style); !closed {
+			blankMoreIndentedLines(lines, lineIndex+1, keyIndent)
+		}
+	case string(line[start:end]) != value.Value:
+		blankMoreIndentedLines(lines, lineIndex+1, keyIndent)
+	}
+}
+
+// Blank lines, including ones with only a carriage return, are part of the
+// scalar unless they're what comes after it
+func blankMoreIndentedLines(lines [][]byte, from int, keyIndent int) {
+	for i := from; i < len(lines); i++ {
+		trimmed := bytes.TrimLeft(lines[i], " \t")
+		if len(bytes.TrimSpace(trimmed)) > 0 && len(lines[i])-len(trimmed) <= keyIndent {
+			break
+		}
+		lines[i] = nil
+	}
+}
+
+func scalarEnd(line []byte, start int, style yaml.Style, inFlow bool) int {
+	if style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		end, _ := quotedScalarEnd(line, start, style)
+		return end
+	}
+
+	for i := start; i < len(line); i++ {
+		if line[i] == '#' && i > start && (line[i-1] == ' ' || line[i-1] == '\t') {
+			return len(bytes.TrimRight(line[:i], " \t"))
+		}
+
+		if inFlow && (line[i] == ',' || line[i] == '}' || line[i] == ']') {
+			return len(bytes.TrimRight(line[:i], " \t"))
+		}
+	}
+
+	return len(bytes.TrimRight(line, " \t\r"))
+}
+
+// Reports whether the closing quote is on the same line, the scalar goes on
+// to the end of the line when it isn't
+func quotedScalarEnd(line []byte, start int, style yaml.Style) (int, bool) {
+	if style&yaml.DoubleQuotedStyle != 0 {
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				return i + 1, true
+			}
+		}
+		return len(line), false
+	}
+
+	for i := start + 1; i < len(line); i++ {
+		if line[i] == '\'' {
+			if i+1 < len(line) && line[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1, true
+		}
+	}
+	return len(line), false
+}
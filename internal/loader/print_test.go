@@ -0,0 +1,91 @@
+package loader
+
+import "testing"
+
+func TestPrepareConfigForPrint(t *testing.T) {
+	t.Setenv("GANDER_TEST_HOST", "example.com")
+	t.Setenv("GANDER_TEST_TOKEN", "hunter2")
+
+	tests := []struct {
+		name      string
+		contents  string
+		resolve   bool
+		redact    bool
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "left as is",
+			contents: "password: hunter2\nurl: ${GANDER_TEST_HOST}",
+			expected: "password: hunter2\nurl: ${GANDER_TEST_HOST}",
+		},
+		{
+			name:     "variables resolved",
+			contents: "url: https://${GANDER_TEST_HOST}/",
+			resolve:  true,
+			expected: "url: https://example.com/",
+		},
+		{
+			name:     "variables resolved and redacted",
+			contents: "url: https://${GANDER_TEST_HOST}/\nheader: Bearer ${GANDER_TEST_TOKEN}",
+			resolve:  true,
+			redact:   true,
+			expected: "url: https://<redacted>/\nheader: Bearer <redacted>",
+		},
+		{
+			name:     "sensitive keys",
+			contents: "password: hunter2\nApi-Key: abc # comment\nsecret-key: 'quoted'\nusername: admin",
+			redact:   true,
+			expected: "password: <redacted>\nApi-Key: <redacted> # comment\nsecret-key: <redacted>\nusername: admin",
+		},
+		{
+			name:     "nested and in flow style",
+			contents: "auth:\n  users:\n    admin: {password: hunter2, role: admin}\nheaders:\n  Authorization: Bearer abc",
+			redact:   true,
+			expected: "auth:\n  users:\n    admin: {password: <redacted>, role: admin}\nheaders:\n  Authorization: <redacted>",
+		},
+		{
+			name:     "block scalars keep their lines",
+			contents: "token: |\n  line one\n  line two\nnext: value",
+			redact:   true,
+			expected: "token: <redacted>\n\n\nnext: value",
+		},
+		{
+			name:     "plain scalars spanning lines",
+			contents: "token: first\n  second\nnext: value",
+			redact:   true,
+			expected: "token: <redacted>\n\nnext: value",
+		},
+		{
+			name:     "empty values aren't redacted",
+			contents: "password: ''\ntoken:",
+			redact:   true,
+			expected: "password: ''\ntoken:",
+		},
+		{
+			name:      "missing variable",
+			contents:  "url: ${GANDER_TEST_MISSING}",
+			resolve:   true,
+			redact:    true,
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := PrepareConfigForPrint([]byte(test.contents), test.resolve, test.redact)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to prepare config: %v", err)
+			}
+			if string(got) != test.expected {
+				t.Errorf("Got %q, expected %q", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	profileConditionKey = "$if"
+	profileEnvVariable  = "GANDER_PROFILE"
+)
+
+var activeProfiles []string
+
+// Sets the profiles that $if conditions get checked against, when none are
+// given the comma separated list from the GANDER_PROFILE env variable is used
+func SetActiveProfiles(profiles string) {
+	if profiles == "" {
+		profiles = os.Getenv(profileEnvVariable)
+	}
+
+	activeProfiles = activeProfiles[:0]
+
+	for profile := range strings.SplitSeq(profiles, ",") {
+		if profile = strings.TrimSpace(profile); profile != "" {
+			activeProfiles = append(activeProfiles, profile)
+		}
+	}
+}
+
+func init() {
+	SetActiveProfiles("")
+}
+
+// A condition is a comma separated list of profiles, of which at least one has
+// to be active, profiles prefixed with ! must not be active
+func isProfileConditionMet(condition string) bool {
+	anyRequired, anyMet := false, false
+
+	for profile := range strings.SplitSeq(condition, ",") {
+		profile = strings.TrimSpace(profile)
+
+		if negated, ok := strings.CutPrefix(profile, "!"); ok {
+			if slices.Contains(activeProfiles, strings.TrimSpace(negated)) {
+				return false
+			}
+			continue
+		}
+
+		if profile == "" {
+			continue
+		}
+
+		anyRequired = true
+		if slices.Contains(activeProfiles, profile) {
+			anyMet = true
+		}
+	}
+
+	return !anyRequired || anyMet
+}
+
+// Removes every mapping whose $if condition isn't met, along with its key when
+// it's the value of a property or from the list when it's an item of one. The
+// $if property itself is removed from the mappings that are kept.
+func applyProfileConditions(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := applyProfileConditions(child); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		kept := node.Content[:0]
+
+		for _, item := range node.Content {
+			include, err := evaluateProfileCondition(item)
+			if err != nil {
+				return err
+			}
+
+			if !include {
+				continue
+			}
+
+			if err := applyProfileConditions(item); err != nil {
+				return err
+			}
+
+			kept = append(kept, item)
+		}
+
+		node.Content = kept
+	case yaml.MappingNode:
+		kept := node.Content[:0]
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			include, err := evaluateProfileCondition(value)
+			if err != nil {
+				return err
+			}
+
+			if !include {
+				continue
+			}
+
+			if err := applyProfileConditions(value); err != nil {
+				return err
+			}
+
+			kept = append(kept, key, value)
+		}
+
+		node.Content = kept
+	}
+
+	return nil
+}
+
+// Whether the node is kept with the active profiles, without removing its $if
+// property like when the config is loaded
+func isKeptByProfiles(node *yaml.Node) bool {
+	if node.Kind != yaml.MappingNode {
+		return true
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == profileConditionKey {
+			return isProfileConditionMet(node.Content[i+1].Value)
+		}
+	}
+
+	return true
+}
+
+func evaluateProfileCondition(node *yaml.Node) (bool, error) {
+	if node.Kind != yaml.MappingNode {
+		return true, nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value != profileConditionKey {
+			continue
+		}
+
+		if value.Kind != yaml.ScalarNode {
+			return false, fmt.Errorf("line %d: %s must be a comma separated list of profiles", key.Line, profileConditionKey)
+		}
+
+		node.Content = slices.Delete(node.Content, i, i+2)
+
+		return isProfileConditionMet(value.Value), nil
+	}
+
+	return true, nil
+}
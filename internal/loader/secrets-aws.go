@@ -0,0 +1,190 @@
+package loader
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/limpdev/gander/internal/fetch"
+	"gopkg.in/yaml.v3"
+)
+
+// Reads secrets from AWS Secrets Manager, signing requests with the given
+// credentials or the standard AWS_* environment variables
+type awsSecretsManagerProvider struct {
+	Region          string `yaml:"region"`
+	AccessKeyID     string `yaml:"access-key-id"`
+	SecretAccessKey string `yaml:"secret-access-key"`
+	SessionToken    string `yaml:"session-token"`
+	Endpoint        string `yaml:"endpoint"`
+
+	client *http.Client
+	cache  map[string]string
+}
+
+func newAWSSecretsManagerProvider(config *yaml.Node) (SecretProvider, error) {
+	provider := &awsSecretsManagerProvider{}
+	if err := config.Decode(provider); err != nil {
+		return nil, err
+	}
+
+	if provider.Region == "" {
+		provider.Region = firstEnvVariable("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+
+	if provider.Region == "" {
+		return nil, fmt.Errorf("region is required")
+	}
+
+	if provider.AccessKeyID == "" && provider.SecretAccessKey == "" {
+		provider.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		provider.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if provider.SessionToken == "" {
+			provider.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+
+	if provider.AccessKeyID == "" || provider.SecretAccessKey == "" {
+		return nil, fmt.Errorf("access-key-id and secret-access-key are required")
+	}
+
+	if provider.Endpoint == "" {
+		provider.Endpoint = "https://secretsmanager." + provider.Region + ".amazonaws.com"
+	}
+
+	provider.client = fetch.NewClient(10*time.Second, false)
+	provider.cache = make(map[string]string)
+
+	return provider, nil
+}
+
+func firstEnvVariable(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// Secrets that store key/value pairs are JSON objects, in which case a key
+// picks out one of the values, otherwise the whole secret is used
+func (p *awsSecretsManagerProvider) GetSecret(path, key string) (string, error) {
+	secret, cached := p.cache[path]
+	if !cached {
+		var err error
+		if secret, err = p.fetchSecret(path); err != nil {
+			return "", fmt.Errorf("aws-secrets-manager: reading %s: %v", path, err)
+		}
+		p.cache[path] = secret
+	}
+
+	if key == "" {
+		return secret, nil
+	}
+
+	var document any
+	if err := json.Unmarshal([]byte(secret), &document); err != nil {
+		return "", fmt.Errorf("aws-secrets-manager: %s is not a JSON object so #%s can't be used", path, key)
+	}
+
+	value, err := lookupSecretKey(document, key)
+	if err != nil {
+		return "", fmt.Errorf("aws-secrets-manager: %s: %v", path, err)
+	}
+
+	return value, nil
+}
+
+func (p *awsSecretsManagerProvider) fetchSecret(secretID string) (string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequest("POST", p.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.signRequest(request, body, time.Now().UTC())
+
+	type response struct {
+		SecretString string `json:"SecretString"`
+	}
+
+	decoded, err := fetch.DecodeJSON[response](p.client, request)
+	if err != nil {
+		return "", err
+	}
+
+	return decoded.SecretString, nil
+}
+
+// Implements AWS Signature Version 4, see
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html
+func (p *awsSecretsManagerProvider) signRequest(request *http.Request, body []byte, now time.Time) {
+	const service = "secretsmanager"
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	if p.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", p.SessionToken)
+	}
+
+	// headers have to be sorted by name
+	signedHeaders := "content-type;host;x-amz-date"
+	canonicalHeaders := "content-type:" + request.Header.Get("Content-Type") + "\n" +
+		"host:" + request.URL.Host + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if p.SessionToken != "" {
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + p.SessionToken + "\n"
+	}
+	signedHeaders += ";x-amz-target"
+	canonicalHeaders += "x-amz-target:" + request.Header.Get("X-Amz-Target") + "\n"
+
+	canonicalRequest := request.Method + "\n" +
+		"/\n" +
+		"\n" +
+		canonicalHeaders + "\n" +
+		signedHeaders + "\n" +
+		sha256Hex(body)
+
+	scope := date + "/" + p.Region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+p.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, p.Region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set(
+		"Authorization",
+		"AWS4-HMAC-SHA256 Credential="+p.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature,
+	)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
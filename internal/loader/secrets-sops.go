@@ -0,0 +1,86 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Reads secrets from files encrypted with SOPS by having the sops binary
+// decrypt them, so that every key management backend it supports just works
+type sopsSecretProvider struct {
+	Command string `yaml:"command"`
+
+	cache map[string]any
+}
+
+func newSOPSSecretProvider(config *yaml.Node) (SecretProvider, error) {
+	provider := &sopsSecretProvider{}
+	if err := config.Decode(provider); err != nil {
+		return nil, err
+	}
+
+	if provider.Command == "" {
+		provider.Command = "sops"
+	}
+
+	provider.cache = make(map[string]any)
+
+	return provider, nil
+}
+
+func (p *sopsSecretProvider) GetSecret(path, key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("sops secrets require a key, such as %s#database.password", path)
+	}
+
+	document, cached := p.cache[path]
+	if !cached {
+		var err error
+		if document, err = p.decryptFile(path); err != nil {
+			return "", fmt.Errorf("sops: decrypting %s: %v", path, err)
+		}
+		p.cache[path] = document
+	}
+
+	value, err := lookupSecretKey(document, key)
+	if err != nil {
+		return "", fmt.Errorf("sops: %s: %v", path, err)
+	}
+
+	return value, nil
+}
+
+func (p *sopsSecretProvider) decryptFile(path string) (any, error) {
+	if err := CheckExecCommand(p.Command); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), execVariableTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command, "--decrypt", "--output-type", "json", path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%v: %s", err, message)
+		}
+
+		return nil, err
+	}
+
+	var document any
+	if err := json.Unmarshal(stdout.Bytes(), &document); err != nil {
+		return nil, fmt.Errorf("parsing decrypted output: %v", err)
+	}
+
+	return document, nil
+}
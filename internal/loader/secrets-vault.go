@@ -0,0 +1,129 @@
+package loader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/fetch"
+	"gopkg.in/yaml.v3"
+)
+
+// Reads secrets from a KV secrets engine of HashiCorp Vault (or OpenBao)
+type vaultSecretProvider struct {
+	Address       string `yaml:"address"`
+	Token         string `yaml:"token"`
+	Namespace     string `yaml:"namespace"`
+	Mount         string `yaml:"mount"`
+	KVVersion     int    `yaml:"kv-version"`
+	AllowInsecure bool   `yaml:"allow-insecure"`
+
+	client *http.Client
+	cache  map[string]map[string]any
+}
+
+func newVaultSecretProvider(config *yaml.Node) (SecretProvider, error) {
+	provider := &vaultSecretProvider{}
+	if err := config.Decode(provider); err != nil {
+		return nil, err
+	}
+
+	if provider.Address == "" {
+		provider.Address = os.Getenv("VAULT_ADDR")
+	}
+
+	if provider.Address == "" {
+		return nil, fmt.Errorf("address is required")
+	}
+
+	if provider.Token == "" {
+		provider.Token = os.Getenv("VAULT_TOKEN")
+	}
+
+	if provider.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+
+	if provider.Mount == "" {
+		provider.Mount = "secret"
+	}
+
+	if provider.KVVersion == 0 {
+		provider.KVVersion = 2
+	} else if provider.KVVersion != 1 && provider.KVVersion != 2 {
+		return nil, fmt.Errorf("kv-version must be either 1 or 2")
+	}
+
+	provider.Address = strings.TrimSuffix(provider.Address, "/")
+	provider.Mount = strings.Trim(provider.Mount, "/")
+	provider.client = fetch.NewClient(10*time.Second, provider.AllowInsecure)
+	provider.cache = make(map[string]map[string]any)
+
+	return provider, nil
+}
+
+func (p *vaultSecretProvider) GetSecret(path, key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("vault secrets require a key, such as %s#password", path)
+	}
+
+	path = strings.Trim(path, "/")
+
+	data, cached := p.cache[path]
+	if !cached {
+		var err error
+		if data, err = p.fetchSecret(path); err != nil {
+			return "", fmt.Errorf("vault: reading %s: %v", path, err)
+		}
+		p.cache[path] = data
+	}
+
+	value, err := lookupSecretKey(data, key)
+	if err != nil {
+		return "", fmt.Errorf("vault: %s: %v", path, err)
+	}
+
+	return value, nil
+}
+
+func (p *vaultSecretProvider) fetchSecret(path string) (map[string]any, error) {
+	requestURL := p.Address + "/v1/" + p.Mount + "/"
+	if p.KVVersion == 2 {
+		requestURL += "data/"
+	}
+	requestURL += (&url.URL{Path: path}).EscapedPath()
+
+	request, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("X-Vault-Token", p.Token)
+	if p.Namespace != "" {
+		request.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	type response struct {
+		Data map[string]any `json:"data"`
+	}
+
+	decoded, err := fetch.DecodeJSON[response](p.client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	data := decoded.Data
+	if p.KVVersion == 2 {
+		// version 2 wraps the secret along with its metadata
+		data, _ = data["data"].(map[string]any)
+	}
+
+	if data == nil {
+		return nil, fmt.Errorf("response contains no data")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,168 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fetches the values of ${name:path#key} variables, where name is the name the
+// provider was given in the secrets block of the config
+type SecretProvider interface {
+	GetSecret(path, key string) (string, error)
+}
+
+type secretProviderFactory func(config *yaml.Node) (SecretProvider, error)
+
+var secretProviderTypes = map[string]secretProviderFactory{
+	"files":               newFilesSecretProvider,
+	"vault":               newVaultSecretProvider,
+	"aws-secrets-manager": newAWSSecretsManagerProvider,
+	"sops":                newSOPSSecretProvider,
+}
+
+var secretProviderNamePattern = regexp.MustCompile(`^[a-zA-Z]+$`)
+
+// Secret providers are needed in order to resolve the variables of the config,
+// so the secrets block gets picked out of it and set up beforehand. Only the
+// built-in variable types can be used within the block itself.
+func loadSecretProviders(contents []byte) (map[string]SecretProvider, error) {
+	var document struct {
+		Secrets yaml.Node `yaml:"secrets"`
+	}
+
+	// a config that isn't valid YAML gets reported once it's parsed for real
+	if err := yaml.Unmarshal(contents, &document); err != nil || document.Secrets.Kind == 0 {
+		return nil, nil
+	}
+
+	if document.Secrets.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: secrets must be a map of providers", document.Secrets.Line)
+	}
+
+	providers := make(map[string]SecretProvider)
+
+	for i := 0; i+1 < len(document.Secrets.Content); i += 2 {
+		name, config := document.Secrets.Content[i].Value, document.Secrets.Content[i+1]
+
+		if !secretProviderNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("line %d: secret provider name %q can only contain letters", config.Line, name)
+		}
+
+		if name == configVarTypeEnv || name == configVarTypeFileFromEnv || name == configVarTypeExec {
+			return nil, fmt.Errorf("line %d: %s is a built-in variable type and can't be used as a secret provider name", config.Line, name)
+		}
+
+		if err := expandConfigVariablesInNode(config); err != nil {
+			return nil, fmt.Errorf("line %d: secret provider %s: %v", config.Line, name, err)
+		}
+
+		var header struct {
+			Type string `yaml:"type"`
+		}
+		if err := config.Decode(&header); err != nil {
+			return nil, fmt.Errorf("secret provider %s: %w", name, err)
+		}
+
+		factory, exists := secretProviderTypes[header.Type]
+		if !exists {
+			return nil, fmt.Errorf("line %d: secret provider %s has unknown type %q", config.Line, name, header.Type)
+		}
+
+		provider, err := factory(config)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: secret provider %s: %v", config.Line, name, err)
+		}
+
+		providers[name] = provider
+	}
+
+	return providers, nil
+}
+
+func expandConfigVariablesInNode(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		value, err := expandConfigVariables([]byte(node.Value), nil, false)
+		if err != nil {
+			return err
+		}
+
+		node.Value = string(value)
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := expandConfigVariablesInNode(child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads secrets from files within a directory, a provider of this type named
+// secret replaces the default of reading Docker secrets from /run/secrets
+type filesSecretProvider struct {
+	Directory string `yaml:"directory"`
+}
+
+func newFilesSecretProvider(config *yaml.Node) (SecretProvider, error) {
+	provider := &filesSecretProvider{}
+	if err := config.Decode(provider); err != nil {
+		return nil, err
+	}
+
+	if provider.Directory == "" {
+		return nil, fmt.Errorf("directory is required")
+	}
+
+	return provider, nil
+}
+
+func (p *filesSecretProvider) GetSecret(path, key string) (string, error) {
+	if key != "" {
+		return "", fmt.Errorf("files secrets don't have keys, remove #%s", key)
+	}
+
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("secret %s is outside of %s", path, p.Directory)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(p.Directory, path))
+	if err != nil {
+		return "", fmt.Errorf("reading secret file: %v", err)
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// Looks up a value within a decoded JSON or YAML document using a dot
+// separated path, such as database.password
+func lookupSecretKey(document any, key string) (string, error) {
+	current := document
+
+	for part := range strings.SplitSeq(key, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("key %s not found", key)
+		}
+
+		current, ok = object[part]
+		if !ok {
+			return "", fmt.Errorf("key %s not found", key)
+		}
+	}
+
+	switch value := current.(type) {
+	case string:
+		return value, nil
+	case map[string]any, []any:
+		return "", fmt.Errorf("key %s is not a single value", key)
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
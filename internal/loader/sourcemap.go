@@ -0,0 +1,182 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// Maps the lines of a config with its includes resolved back to the file and
+// line they originally came from
+type SourceMap struct {
+	baseDir string
+	lines   []sourceLocation
+}
+
+type sourceLocation struct {
+	file string
+	line int
+	// The line with the include that the line was brought in by, if any
+	includedAt *sourceLocation
+}
+
+func (l sourceLocation) withOutermostInclude(includedAt *sourceLocation) sourceLocation {
+	if l.includedAt == nil {
+		l.includedAt = includedAt
+	} else {
+		outer := l.includedAt.withOutermostInclude(includedAt)
+		l.includedAt = &outer
+	}
+
+	return l
+}
+
+// The includes that lead to the line starting from the main file, followed by
+// the line itself
+func (l sourceLocation) chain() []sourceLocation {
+	var chain []sourceLocation
+
+	for current := &l; current != nil; current = current.includedAt {
+		chain = append(chain, sourceLocation{file: current.file, line: current.line})
+	}
+
+	slices.Reverse(chain)
+	return chain
+}
+
+// Returns the location of a line of the resolved config in the form of
+// file:line, with the file being relative to the main config file's directory
+func (m *SourceMap) Locate(line int) (string, bool) {
+	if m == nil || line < 1 || line > len(m.lines) {
+		return "", false
+	}
+
+	location := m.lines[line-1]
+	file := location.file
+
+	if m.baseDir != "" {
+		if relative, err := filepath.Rel(m.baseDir, file); err == nil {
+			file = relative
+		}
+	}
+
+	return file + ":" + strconv.Itoa(location.line), true
+}
+
+var errorLinePattern = regexp.MustCompile(`\bline (\d+)\b`)
+
+// Rewrites the line numbers within an error, which refer to the resolved
+// config, to the file and line they were originally written in
+func (m *SourceMap) TranslateError(err error) error {
+	if m == nil || err == nil {
+		return err
+	}
+
+	message := errorLinePattern.ReplaceAllStringFunc(err.Error(), func(match string) string {
+		line, _ := strconv.Atoi(errorLinePattern.FindStringSubmatch(match)[1])
+
+		if location, ok := m.Locate(line); ok {
+			return location
+		}
+
+		return match
+	})
+
+	return errors.New(message)
+}
+
+// Whether both lines were brought in by the same include
+func (m *SourceMap) sameInclude(line, other int) bool {
+	if line < 1 || other < 1 || line > len(m.lines) || other > len(m.lines) {
+		return false
+	}
+
+	chain, otherChain := m.lines[line-1].chain(), m.lines[other-1].chain()
+	return len(chain) > 1 && slices.Equal(chain[:len(chain)-1], otherChain[:len(otherChain)-1])
+}
+
+// A range of lines within a single file of the config, where lines brought in
+// by includes are represented by the line with the include
+type fileSpan struct {
+	file        string
+	first, last int
+	// The lines with the includes that lead to the file, starting from the
+	// main file
+	includes []sourceLocation
+}
+
+// Expresses lines of the resolved config as lines of the most deeply included
+// file that still has all of them
+func (m *SourceMap) span(first, last int) (fileSpan, error) {
+	if first < 1 || last > len(m.lines) || first > last {
+		return fileSpan{}, fmt.Errorf("lines %d-%d are out of range", first, last)
+	}
+
+	chains := make([][]sourceLocation, 0, last-first+1)
+	for line := first; line <= last; line++ {
+		chains = append(chains, m.lines[line-1].chain())
+	}
+
+	depth := 0
+outer:
+	for {
+		for _, chain := range chains {
+			if len(chain) <= depth+1 || chain[depth] != chains[0][depth] {
+				break outer
+			}
+		}
+		depth++
+	}
+
+	return m.spanWithin(first, last, chains[0][:depth])
+}
+
+// Expresses lines of the resolved config as lines of the file that the given
+// includes lead to, which all of them have to be within
+func (m *SourceMap) spanWithin(first, last int, includes []sourceLocation) (fileSpan, error) {
+	if first < 1 || last > len(m.lines) || first > last {
+		return fileSpan{}, fmt.Errorf("lines %d-%d are out of range", first, last)
+	}
+
+	depth := len(includes)
+	isWithin := func(chain []sourceLocation) bool {
+		return len(chain) > depth && slices.Equal(chain[:depth], includes)
+	}
+
+	span := fileSpan{includes: includes}
+	var previous sourceLocation
+
+	for line := first; line <= last; line++ {
+		chain := m.lines[line-1].chain()
+		if !isWithin(chain) {
+			return fileSpan{}, fmt.Errorf("lines %d-%d aren't all within the same file", first, last)
+		}
+
+		location := chain[depth]
+		if line == first {
+			span.file, span.first = location.file, location.line
+		} else if location.file != span.file || (location.line != previous.line && location.line != previous.line+1) {
+			return fileSpan{}, fmt.Errorf("lines %d-%d aren't next to each other within %s", first, last, span.file)
+		}
+		previous = location
+	}
+	span.last = previous.line
+
+	// the lines of an include can't be split up
+	sharesInclude := func(line int, location sourceLocation) bool {
+		if line < 1 || line > len(m.lines) {
+			return false
+		}
+		chain := m.lines[line-1].chain()
+		return isWithin(chain) && len(chain) > depth+1 && chain[depth] == location
+	}
+	firstChain, lastChain := m.lines[first-1].chain(), m.lines[last-1].chain()
+	if sharesInclude(first-1, firstChain[depth]) || sharesInclude(last+1, lastChain[depth]) {
+		return fileSpan{}, fmt.Errorf("lines %d-%d only include part of a file", first, last)
+	}
+
+	return span, nil
+}
@@ -0,0 +1,259 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/limpdev/gander/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	yamlUnmarshalerType = reflect.TypeFor[yaml.Unmarshaler]()
+	widgetsType         = reflect.TypeFor[models.Widgets]()
+)
+
+// Reports every property in the config that doesn't correspond to anything,
+// which would otherwise be silently ignored. Types with their own unmarshaling
+// logic aren't looked into since there's no way of knowing what they accept.
+func CheckUnknownConfigKeys(contents []byte) error {
+	document, err := parseConfigDocument(contents, nil)
+	if err != nil {
+		return err
+	}
+
+	return checkUnknownConfigKeys(document)
+}
+
+func checkUnknownConfigKeys(document *yaml.Node) error {
+	if len(document.Content) == 0 {
+		return nil
+	}
+
+	var errs []error
+	checkUnknownKeys(document.Content[0], reflect.TypeFor[models.Config](), "", &errs)
+
+	return errors.Join(errs...)
+}
+
+func checkUnknownKeys(node *yaml.Node, t reflect.Type, context string, errs *[]error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == widgetsType {
+		checkUnknownWidgetKeys(node, errs)
+		return
+	}
+
+	if reflect.PointerTo(t).Implements(yamlUnmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+
+		fields := make(map[string]reflect.Type)
+		if !collectYAMLFields(t, fields) {
+			return
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			// merge keys bring in properties from elsewhere which get checked there
+			if key.Value == "<<" {
+				continue
+			}
+
+			fieldType, known := fields[key.Value]
+			if !known {
+				// such as define, which holds properties that get merged into
+				// other places, those places are what gets checked
+				if !holdsOnlyAnchors(value) {
+					*errs = append(*errs, unknownKeyError(key, context, fields))
+				}
+				continue
+			}
+
+			checkUnknownKeys(value, fieldType, context, errs)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+
+		for i := 1; i < len(node.Content); i += 2 {
+			checkUnknownKeys(node.Content[i], t.Elem(), context, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+
+		for _, item := range node.Content {
+			checkUnknownKeys(item, t.Elem(), context, errs)
+		}
+	}
+}
+
+// Whether the value only exists to define anchors, either by being one or by
+// being a list or mapping of them
+func holdsOnlyAnchors(node *yaml.Node) bool {
+	if node.Anchor != "" {
+		return true
+	}
+
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Anchor == "" {
+				return false
+			}
+		}
+		return len(node.Content) > 0
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if node.Content[i].Anchor == "" {
+				return false
+			}
+		}
+		return len(node.Content) > 0
+	}
+
+	return false
+}
+
+func checkUnknownWidgetKeys(node *yaml.Node, errs *[]error) {
+	if node.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+
+		var widgetType string
+		for i := 0; i+1 < len(item.Content); i += 2 {
+			if item.Content[i].Value == "type" {
+				widgetType = item.Content[i+1].Value
+				break
+			}
+		}
+
+		factory, exists := models.LookupWidgetFactory(widgetType)
+		if !exists {
+			// reported when decoding the widget
+			continue
+		}
+
+		checkUnknownKeys(item, reflect.TypeOf(factory()), widgetType+" widget", errs)
+	}
+}
+
+// Returns false if the struct accepts any property through an inlined map
+func collectYAMLFields(t reflect.Type, fields map[string]reflect.Type) bool {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("yaml")
+		name, options, _ := strings.Cut(tag, ",")
+
+		if name == "-" {
+			continue
+		}
+
+		if options == "inline" {
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+
+			if fieldType.Kind() == reflect.Map {
+				return false
+			}
+
+			if fieldType.Kind() == reflect.Struct && !collectYAMLFields(fieldType, fields) {
+				return false
+			}
+
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		fields[name] = field.Type
+	}
+
+	return true
+}
+
+func unknownKeyError(key *yaml.Node, context string, fields map[string]reflect.Type) error {
+	message := fmt.Sprintf("line %d: unknown property %q", key.Line, key.Value)
+	if context != "" {
+		message += " in " + context
+	}
+
+	if suggestion := nearestFieldName(key.Value, fields); suggestion != "" {
+		message += fmt.Sprintf(", did you mean %q?", suggestion)
+	}
+
+	return errors.New(message)
+}
+
+func nearestFieldName(name string, fields map[string]reflect.Type) string {
+	best := ""
+	// anything further away than this is unlikely to be a typo
+	bestDistance := max(2, len(name)/3) + 1
+
+	for candidate := range fields {
+		distance := levenshteinDistance(name, candidate)
+		if distance < bestDistance || (distance == bestDistance && candidate < best) {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+func levenshteinDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,117 @@
+package loader_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/limpdev/gander/internal/loader"
+	_ "github.com/limpdev/gander/internal/widgets"
+)
+
+func TestCheckUnknownConfigKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		errors   []string
+	}{
+		{
+			name:     "known properties",
+			contents: "server:\n  port: 8080\npages:\n  - name: Home\n    columns:\n      - size: full\n        widgets:\n          - type: clock\n            title: Time\n",
+		},
+		{
+			name:     "top level typo",
+			contents: "serve:\n  port: 8080\n",
+			errors:   []string{`line 1: unknown property "serve", did you mean "server"?`},
+		},
+		{
+			name:     "nested typo",
+			contents: "server:\n  prot: 8080\n",
+			errors:   []string{`line 2: unknown property "prot", did you mean "port"?`},
+		},
+		{
+			name:     "widget property",
+			contents: "pages:\n  - name: Home\n    columns:\n      - size: full\n        widgets:\n          - type: clock\n            titel: Time\n",
+			errors:   []string{`line 7: unknown property "titel" in clock widget, did you mean "title"?`},
+		},
+		{
+			name:     "unknown widget types are left to decoding",
+			contents: "pages:\n  - name: Home\n    columns:\n      - size: full\n        widgets:\n          - type: not-a-widget\n            anything: here\n",
+		},
+		{
+			name:     "every unknown property",
+			contents: "colour: red\npages:\n  - name: Home\n    withd: wide\n",
+			errors:   []string{`line 1: unknown property "colour"`, `line 4: unknown property "withd"`},
+		},
+		{
+			name: "anchors defined within a widget, as in the docs",
+			contents: `pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: group
+            define: &shared-properties
+                type: reddit
+                show-thumbnails: true
+                collapse-after: 6
+            widgets:
+              - subreddit: gamingnews
+                <<: *shared-properties
+              - subreddit: games
+                <<: *shared-properties
+`,
+		},
+		{
+			name: "anchors defined at the top level, as in the docs",
+			contents: `define:
+  - &subreddit-settings
+    type: reddit
+    collapse-after: 5
+
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: split-column
+            widgets:
+              - subreddit: selfhosted
+                <<: *subreddit-settings
+`,
+		},
+		{
+			name:     "lists that aren't only anchors",
+			contents: "define:\n  - &a\n    type: reddit\n  - not-an-anchor\n",
+			errors:   []string{`line 1: unknown property "define"`},
+		},
+		{
+			name:     "merge keys",
+			contents: "defaults: &defaults\n  port: 8080\nserver:\n  <<: *defaults\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := loader.CheckUnknownConfigKeys([]byte(test.contents))
+			if len(test.errors) == 0 {
+				if err != nil {
+					t.Fatalf("Expected no errors, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected errors %q, got none", test.errors)
+			}
+
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(test.errors) {
+				t.Fatalf("Got errors %q, expected %q", lines, test.errors)
+			}
+			for i := range lines {
+				if !strings.HasPrefix(lines[i], test.errors[i]) {
+					t.Errorf("Got error %q, expected it to start with %q", lines[i], test.errors[i])
+				}
+			}
+		})
+	}
+}
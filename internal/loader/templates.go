@@ -0,0 +1,127 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/limpdev/gander/internal/web"
+)
+
+const configTemplateEnvVariable = "GANDER_CONFIG_TEMPLATE"
+
+var configTemplatingEnabled bool
+
+// Enables running every config file through text/template before it gets
+// parsed, can also be enabled by setting GANDER_CONFIG_TEMPLATE to true
+func SetConfigTemplating(enabled bool) {
+	if !enabled {
+		enabled, _ = strconv.ParseBool(os.Getenv(configTemplateEnvVariable))
+	}
+
+	configTemplatingEnabled = enabled
+}
+
+func init() {
+	SetConfigTemplating(false)
+}
+
+type configTemplateData struct {
+	Env      map[string]string
+	Profiles []string
+}
+
+func executeConfigTemplate(filePath string, contents []byte) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(filePath)).
+		Funcs(configTemplateFuncs).
+		Option("missingkey=error").
+		Parse(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+
+	env := make(map[string]string)
+	for _, variable := range os.Environ() {
+		if name, value, ok := strings.Cut(variable, "="); ok {
+			env[name] = value
+		}
+	}
+
+	var output bytes.Buffer
+	if err := tmpl.Execute(&output, configTemplateData{Env: env, Profiles: activeProfiles}); err != nil {
+		return nil, fmt.Errorf("executing template: %w", err)
+	}
+
+	return output.Bytes(), nil
+}
+
+// The functions shared with the templates of widgets, along with ones that are
+// only useful for generating configs. The names that config templates had
+// before sharing them are kept as aliases so that existing configs still work.
+var configTemplateFuncs = func() template.FuncMap {
+	funcs := template.FuncMap(maps.Clone(web.TextTemplateFunctions))
+
+	maps.Copy(funcs, template.FuncMap{
+		"env": os.Getenv,
+		"list": func(items ...any) []any {
+			return items
+		},
+		"dict": func(pairs ...any) (map[string]any, error) {
+			if len(pairs)%2 != 0 {
+				return nil, fmt.Errorf("dict requires an even number of arguments")
+			}
+
+			dict := make(map[string]any, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				key, ok := pairs[i].(string)
+				if !ok {
+					return nil, fmt.Errorf("dict keys must be strings, got %T", pairs[i])
+				}
+				dict[key] = pairs[i+1]
+			}
+
+			return dict, nil
+		},
+		// takes the place of the one that returns the time until a date
+		"until": func(count int) []int {
+			return seq(0, count-1)
+		},
+		"seq":     seq,
+		"add":     func(a, b int) int { return a + b },
+		"sub":     func(a, b int) int { return a - b },
+		"mul":     func(a, b int) int { return a * b },
+		"upper":   funcs["toUpper"],
+		"lower":   funcs["toLower"],
+		"trim":    funcs["trimSpace"],
+		"replace": funcs["replaceAll"],
+		"quote":   strconv.Quote,
+		"indent": func(spaces int, s string) string {
+			padding := strings.Repeat(" ", spaces)
+			return padding + strings.ReplaceAll(s, "\n", "\n"+padding)
+		},
+		"nindent": func(spaces int, s string) string {
+			padding := strings.Repeat(" ", spaces)
+			return "\n" + padding + strings.ReplaceAll(s, "\n", "\n"+padding)
+		},
+	})
+
+	return funcs
+}()
+
+func seq(start, end int) []int {
+	if end < start {
+		return []int{}
+	}
+
+	numbers := make([]int, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		numbers = append(numbers, i)
+	}
+
+	return numbers
+}
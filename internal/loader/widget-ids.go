@@ -0,0 +1,70 @@
+package loader
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+)
+
+// IDs are kept below 2^53 so that the browser can hold them as numbers
+const maxWidgetID = 1<<53 - 1
+
+// Gives the widgets IDs derived from the slug of their page, where they are on
+// it and the fingerprint of their config, rather than from the order in which
+// they got decoded. That way the collapsed and hidden widgets of the browser,
+// its subscriptions and anything else kept by widget ID stay valid across
+// restarts and reloads for as long as the widget doesn't change or move. This
+// has to happen before the widgets get initialized, since some of them render
+// their HTML, which includes their ID, only once.
+func assignWidgetIDs(config *models.Config) {
+	taken := make(map[uint64]bool)
+
+	for p := range config.Pages {
+		assignWidgetIDsOfPage(&config.Pages[p], taken)
+	}
+}
+
+// Positions are keyed the same way as the preferences of the widgets
+func assignWidgetIDsOfPage(page *models.Page, taken map[uint64]bool) {
+	// slugs only get filled in once the application gets created
+	slug := common.Ternary(page.Slug == "", common.TitleToSlug(page.Title), page.Slug)
+
+	var assign func(widgets models.Widgets, prefix string)
+	assign = func(widgets models.Widgets, prefix string) {
+		for i, widget := range widgets {
+			position := prefix + strconv.Itoa(i)
+			widget.SetID(stableWidgetID(slug, position, widget, taken))
+			if container, ok := widget.(models.ContainerWidget); ok {
+				assign(container.GetWidgets(), position+".")
+			}
+		}
+	}
+
+	assign(page.HeadWidgets, "head-")
+	for c := range page.Columns {
+		assign(page.Columns[c].Widgets, strconv.Itoa(c)+"-")
+	}
+}
+
+// Two widgets can only get the same hash when they're identical and on the
+// same position of pages with the same slug, in which case the one that comes
+// later gets the next ID that isn't taken
+func stableWidgetID(slug, position string, widget models.Widget, taken map[uint64]bool) uint64 {
+	var fingerprint string
+	if fingerprinted, ok := widget.(models.FingerprintedWidget); ok {
+		fingerprint = fingerprinted.GetFingerprint()
+	}
+
+	sum := sha256.Sum256([]byte(slug + "\x00" + position + "\x00" + widget.GetType() + "\x00" + fingerprint))
+	id := binary.BigEndian.Uint64(sum[:8]) & maxWidgetID
+
+	for id == 0 || taken[id] {
+		id = id%maxWidgetID + 1
+	}
+
+	taken[id] = true
+	return id
+}
@@ -0,0 +1,121 @@
+package loader
+
+import (
+	"testing"
+
+	"github.com/limpdev/gander/internal/models"
+)
+
+// Only implements what assigning IDs needs, calling anything else panics
+type idTestWidget struct {
+	models.Widget
+	widgetType  string
+	fingerprint string
+	id          uint64
+}
+
+func (w *idTestWidget) GetType() string         { return w.widgetType }
+func (w *idTestWidget) GetFingerprint() string  { return w.fingerprint }
+func (w *idTestWidget) SetFingerprint(f string) { w.fingerprint = f }
+func (w *idTestWidget) GetID() uint64           { return w.id }
+func (w *idTestWidget) SetID(id uint64)         { w.id = id }
+
+type idTestContainer struct {
+	idTestWidget
+	widgets models.Widgets
+}
+
+func (w *idTestContainer) GetWidgets() models.Widgets { return w.widgets }
+
+func TestStableWidgetID(t *testing.T) {
+	widget := &idTestWidget{widgetType: "rss", fingerprint: "abc"}
+
+	// a fresh map is what a restart looks like
+	id := stableWidgetID("home", "0-1", widget, map[uint64]bool{})
+	if id != stableWidgetID("home", "0-1", widget, map[uint64]bool{}) {
+		t.Fatal("Same widget got a different ID on the next run")
+	}
+	if id == 0 || id > maxWidgetID {
+		t.Errorf("ID %d is outside of the range the browser can hold", id)
+	}
+
+	variations := map[string]uint64{
+		"slug":        stableWidgetID("other", "0-1", widget, map[uint64]bool{}),
+		"position":    stableWidgetID("home", "0-2", widget, map[uint64]bool{}),
+		"type":        stableWidgetID("home", "0-1", &idTestWidget{widgetType: "videos", fingerprint: "abc"}, map[uint64]bool{}),
+		"fingerprint": stableWidgetID("home", "0-1", &idTestWidget{widgetType: "rss", fingerprint: "abd"}, map[uint64]bool{}),
+	}
+	for changed, other := range variations {
+		if other == id {
+			t.Errorf("Changing the %s kept the same ID", changed)
+		}
+	}
+
+	// the parts are separated, so moving characters between them isn't the same widget
+	if stableWidgetID("home0", "-1", widget, map[uint64]bool{}) == id {
+		t.Error("Slug and position ran into each other")
+	}
+}
+
+func TestStableWidgetIDCollisions(t *testing.T) {
+	widget := &idTestWidget{widgetType: "clock"}
+	taken := make(map[uint64]bool)
+
+	first := stableWidgetID("home", "0-0", widget, taken)
+	second := stableWidgetID("home", "0-0", widget, taken)
+	if second != first%maxWidgetID+1 {
+		t.Errorf("Identical widget got ID %d, expected the next one after %d", second, first)
+	}
+
+	if !taken[first] || !taken[second] {
+		t.Error("Assigned IDs weren't marked as taken")
+	}
+
+	third := stableWidgetID("home", "0-0", widget, taken)
+	if third == first || third == second {
+		t.Errorf("Third identical widget got ID %d which was already taken", third)
+	}
+}
+
+func TestAssignWidgetIDsOfPage(t *testing.T) {
+	newPage := func(widgets ...models.Widget) *models.Page {
+		return &models.Page{Title: "Home", HeadWidgets: widgets}
+	}
+
+	child := &idTestWidget{widgetType: "html", fingerprint: "child"}
+	group := &idTestContainer{
+		idTestWidget: idTestWidget{widgetType: "group", fingerprint: "group"},
+		widgets:      models.Widgets{child},
+	}
+	clock := &idTestWidget{widgetType: "clock", fingerprint: "clock"}
+
+	assignWidgetIDsOfPage(newPage(group, clock), map[uint64]bool{})
+	groupID, childID, clockID := group.id, child.id, clock.id
+
+	if groupID == 0 || childID == 0 || clockID == 0 {
+		t.Fatal("Not every widget got an ID")
+	}
+	if childID == groupID {
+		t.Error("Widget within a group got the same ID as the group")
+	}
+
+	// the slug that the title turns into is the same as setting it explicitly
+	slugged := newPage(group, clock)
+	slugged.Slug = "home"
+	assignWidgetIDsOfPage(slugged, map[uint64]bool{})
+	if group.id != groupID || child.id != childID || clock.id != clockID {
+		t.Error("IDs changed when the slug was set to what the title gives")
+	}
+
+	// adding a widget after the others doesn't change their IDs, moving one does
+	added := &idTestWidget{widgetType: "html", fingerprint: "added"}
+	assignWidgetIDsOfPage(newPage(group, clock, added), map[uint64]bool{})
+	if group.id != groupID || child.id != childID || clock.id != clockID {
+		t.Error("IDs of existing widgets changed when a widget was added after them")
+	}
+
+	assignWidgetIDsOfPage(newPage(clock, group), map[uint64]bool{})
+	if clock.id == clockID || group.id == groupID || child.id == childID {
+		t.Error("IDs stayed the same after the widgets were moved")
+	}
+}
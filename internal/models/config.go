@@ -3,21 +3,68 @@ package models
 import (
 	"context"
 	"html/template"
+	"slices"
 	"sync"
-	"time"
 )
 
 type Config struct {
 	Server struct {
-		Host       string `yaml:"host"`
-		Port       uint16 `yaml:"port"`
-		Proxied    bool   `yaml:"proxied"`
-		AssetsPath string `yaml:"assets-path"`
-		BaseURL    string `yaml:"base-url"`
+		Host         string          `yaml:"host"`
+		Port         uint16          `yaml:"port"`
+		Proxied      bool            `yaml:"proxied"`
+		AssetsPath   string          `yaml:"assets-path"`
+		BaseURL      string          `yaml:"base-url"`
+		StrictConfig bool            `yaml:"strict-config"`
+		SocketPath   string          `yaml:"socket-path"`
+		SocketMode   string          `yaml:"socket-mode"`
+		DataPath     string          `yaml:"data-path"`
+		AuditLog     AuditLogConfig  `yaml:"audit-log"`
+		AccessLog    AccessLogConfig `yaml:"access-log"`
+		Compression  struct {
+			Disable      bool     `yaml:"disable"`
+			MinSize      int      `yaml:"min-size"`
+			ContentTypes []string `yaml:"content-types"`
+		} `yaml:"compression"`
+		LogLevel        string                `yaml:"log-level"`
+		LogFormat       string                `yaml:"log-format"`
+		LogFile         string                `yaml:"log-file"`
+		SecurityHeaders SecurityHeadersConfig `yaml:"security-headers"`
+		IconProxy       IconProxyConfig       `yaml:"icon-proxy"`
+		Snapshots       SnapshotsConfig       `yaml:"snapshots"`
+		UpdateSchedule  UpdateScheduleField   `yaml:"update-schedule"`
+		DefaultProxy    ProxyOptionsField     `yaml:"default-proxy"`
+		// In megabytes, defaults to fetch.DefaultMaxResponseSize
+		MaxResponseSize int      `yaml:"max-response-size"`
+		AllowedHosts    []string `yaml:"allowed-hosts"`
+		BlockedHosts    []string `yaml:"blocked-hosts"`
+		// Lets the extension and custom API widgets reach the local network
+		AllowPrivateAddresses bool `yaml:"allow-private-addresses"`
+		// Defaults to DefaultMaxConcurrentUpdates, -1 removes the limit
+		MaxConcurrentUpdates int `yaml:"max-concurrent-updates"`
+		// Only used when serving a directory of dashboards
+		Hostnames []string `yaml:"hostnames"`
+		// Keyed by hostname
+		Hosts map[string]*HostConfig `yaml:"hosts"`
 	} `yaml:"server"`
 	Auth struct {
-		SecretKey string           `yaml:"secret-key"`
-		Users     map[string]*User `yaml:"users"`
+		SecretKey          string           `yaml:"secret-key"`
+		Users              map[string]*User `yaml:"users"`
+		SessionDuration    DurationField    `yaml:"session-duration"`
+		RenewSessionBefore DurationField    `yaml:"renew-session-before"`
+		IdleTimeout        DurationField    `yaml:"idle-timeout"`
+		MaxSessionDuration DurationField    `yaml:"max-session-duration"`
+		PasswordHashing    struct {
+			Algo string `yaml:"algo"`
+			Cost int    `yaml:"cost"`
+		} `yaml:"password-hashing"`
+		RateLimit struct {
+			Window             DurationField `yaml:"window"`
+			MaxAttemptsPerIP   int           `yaml:"max-attempts-per-ip"`
+			MaxAttemptsPerUser int           `yaml:"max-attempts-per-user"`
+			Lockout            DurationField `yaml:"lockout"`
+			MaxLockout         DurationField `yaml:"max-lockout"`
+			Webhook            string        `yaml:"webhook"`
+		} `yaml:"rate-limit"`
 	} `yaml:"auth"`
 	Document struct {
 		Head template.HTML `yaml:"head"`
@@ -27,38 +74,206 @@ type Config struct {
 		CustomCSSFile   string                                   `yaml:"custom-css-file"`
 		DisablePicker   bool                                     `yaml:"disable-picker"`
 		Presets         OrderedYAMLMap[string, *ThemeProperties] `yaml:"presets"`
+		Auto            *ThemeAutoConfig                         `yaml:"auto"`
 	} `yaml:"theme"`
-	Branding struct {
-		HideFooter         bool          `yaml:"hide-footer"`
-		CustomFooter       template.HTML `yaml:"custom-footer"`
-		LogoText           string        `yaml:"logo-text"`
-		LogoURL            string        `yaml:"logo-url"`
-		FaviconURL         string        `yaml:"favicon-url"`
-		FaviconType        string        `yaml:"-"`
-		AppName            string        `yaml:"app-name"`
-		AppIconURL         string        `yaml:"app-icon-url"`
-		AppBackgroundColor string        `yaml:"app-background-color"`
-	} `yaml:"branding"`
-	Pages []Page `yaml:"pages"`
+	Branding      BrandingConfig       `yaml:"branding"`
+	Notifications []NotificationConfig `yaml:"notifications"`
+	// Fetched once and shared by every widget that references them by name
+	DataSources map[string]*DataSourceConfig `yaml:"data-sources"`
+	// Resolved by the loader along with the variables that use them, before the
+	// rest of the config gets parsed
+	Secrets map[string]map[string]any `yaml:"secrets"`
+	Pages   []Page                    `yaml:"pages"`
+}
+
+type BrandingConfig struct {
+	HideFooter         bool          `yaml:"hide-footer"`
+	CustomFooter       template.HTML `yaml:"custom-footer"`
+	LogoText           string        `yaml:"logo-text"`
+	LogoURL            string        `yaml:"logo-url"`
+	FaviconURL         string        `yaml:"favicon-url"`
+	FaviconType        string        `yaml:"-"`
+	AppName            string        `yaml:"app-name"`
+	AppIconURL         string        `yaml:"app-icon-url"`
+	AppBackgroundColor string        `yaml:"app-background-color"`
+}
+
+// Requests made through one of the hosts get its branding, with what it leaves
+// out taken from the global branding, and only get shown its pages, if any
+type HostConfig struct {
+	Branding BrandingConfig `yaml:"branding"`
+	// Slugs of the pages
+	Pages []string `yaml:"pages"`
+}
+
+// Security related events get written either to a file, which gets rotated
+// once it reaches max-size megabytes, or to syslog
+type AuditLogConfig struct {
+	Path       string `yaml:"path"`
+	MaxSize    int    `yaml:"max-size"`
+	MaxBackups int    `yaml:"max-backups"`
+	Syslog     string `yaml:"syslog"`
+}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+const (
+	AccessLogFormatCommon   = "common"
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatJSON     = "json"
+)
+
+// Requests get logged to stdout unless a path is specified, in which case the
+// file gets rotated the same way as the audit log
+type AccessLogConfig struct {
+	Format        string   `yaml:"format"`
+	Path          string   `yaml:"path"`
+	MaxSize       int      `yaml:"max-size"`
+	MaxBackups    int      `yaml:"max-backups"`
+	ExcludeStatic bool     `yaml:"exclude-static"`
+	ExcludePaths  []string `yaml:"exclude-paths"`
+}
+
+const CSPAuto = "auto"
+
+// Headers are only sent for the properties that are set, content-security-policy
+// can either be a policy of its own, in which {nonce} gets replaced with the
+// nonce of the request, or auto to have one built from the config
+type SecurityHeadersConfig struct {
+	ContentSecurityPolicy string              `yaml:"content-security-policy"`
+	ExtraCSPSources       map[string][]string `yaml:"extra-csp-sources"`
+	FrameOptions          string              `yaml:"frame-options"`
+	ReferrerPolicy        string              `yaml:"referrer-policy"`
+	HSTS                  struct {
+		MaxAge            DurationField `yaml:"max-age"`
+		IncludeSubdomains bool          `yaml:"include-subdomains"`
+		Preload           bool          `yaml:"preload"`
+	} `yaml:"hsts"`
+}
+
+// External icons and thumbnails get loaded through the server, which keeps
+// them for cache-ttl, in memory and within data-path/icons when it's set
+type IconProxyConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	CacheTTL     DurationField `yaml:"cache-ttl"`
+	MaxImageSize int           `yaml:"max-image-size"`
+	MaxCacheSize int           `yaml:"max-cache-size"`
+}
+
+// Pages get rendered to PNG images by a headless Chromium that loads them from
+// url, which defaults to the address the server listens on. Scripts that can't
+// log in can use token instead, which renders pages as seen by user.
+type SnapshotsConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	ChromiumPath string        `yaml:"chromium-path"`
+	URL          string        `yaml:"url"`
+	Width        int           `yaml:"width"`
+	Height       int           `yaml:"height"`
+	Wait         DurationField `yaml:"wait"`
+	Timeout      DurationField `yaml:"timeout"`
+	Token        string        `yaml:"token"`
+	User         string        `yaml:"user"`
+}
+
+const (
+	NotificationTypeGeneric = "generic"
+	NotificationTypeNtfy    = "ntfy"
+	NotificationTypeGotify  = "gotify"
+	NotificationTypeDiscord = "discord"
+	NotificationTypeSlack   = "slack"
+)
+
+// Where to send the events reported by widgets, title, message and body are
+// Go templates that get executed against the event
+type NotificationConfig struct {
+	Type        string            `yaml:"type"`
+	URL         string            `yaml:"url"`
+	Token       string            `yaml:"token"`
+	Events      []string          `yaml:"events"`
+	WidgetTypes []string          `yaml:"widget-types"`
+	Title       string            `yaml:"title"`
+	Message     string            `yaml:"message"`
+	Body        string            `yaml:"body"`
+	Headers     map[string]string `yaml:"headers"`
+}
+
+const (
+	DataSourceFormatJSON = "json"
+	DataSourceFormatText = "text"
+)
+
+type DataSourceConfig struct {
+	URL            string               `yaml:"url"`
+	Headers        map[string]string    `yaml:"headers"`
+	Parameters     QueryParametersField `yaml:"parameters"`
+	Format         string               `yaml:"format"`
+	Cache          DurationField        `yaml:"cache"`
+	RequestTimeout DurationField        `yaml:"request-timeout"`
+	AllowInsecure  bool                 `yaml:"allow-insecure"`
 }
 
 type User struct {
-	Password           string `yaml:"password"`
-	PasswordHashString string `yaml:"password-hash"`
-	PasswordHash       []byte `yaml:"-"`
+	Password           string   `yaml:"password"`
+	PasswordHashString string   `yaml:"password-hash"`
+	PasswordHash       []byte   `yaml:"-"`
+	Groups             []string `yaml:"groups"`
+	Role               string   `yaml:"role"`
+}
+
+const (
+	UserRoleAdmin  = "admin"
+	UserRoleViewer = "viewer"
+)
+
+func (u *User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
+}
+
+// Reports whether the user is one of the allowed users or part of one of the
+// allowed groups, everyone is allowed when neither are set
+func IsUserAllowed(username string, user *User, allowedUsers, allowedGroups []string) bool {
+	if len(allowedUsers) == 0 && len(allowedGroups) == 0 {
+		return true
+	}
+
+	if slices.Contains(allowedUsers, username) {
+		return true
+	}
+
+	if user == nil {
+		return false
+	}
+
+	for _, group := range user.Groups {
+		if slices.Contains(allowedGroups, group) {
+			return true
+		}
+	}
+
+	return false
 }
 
+const PageLayoutMobileFirst = "mobile-first"
+
 type Page struct {
-	Title                  string  `yaml:"name"`
-	Slug                   string  `yaml:"slug"`
-	Width                  string  `yaml:"width"`
-	DesktopNavigationWidth string  `yaml:"desktop-navigation-width"`
-	ShowMobileHeader       bool    `yaml:"show-mobile-header"`
-	HideDesktopNavigation  bool    `yaml:"hide-desktop-navigation"`
-	CenterVertically       bool    `yaml:"center-vertically"`
-	HeadWidgets            Widgets `yaml:"head-widgets"`
+	Title                  string   `yaml:"name"`
+	Slug                   string   `yaml:"slug"`
+	Width                  string   `yaml:"width"`
+	DesktopNavigationWidth string   `yaml:"desktop-navigation-width"`
+	ShowMobileHeader       bool     `yaml:"show-mobile-header"`
+	HideDesktopNavigation  bool     `yaml:"hide-desktop-navigation"`
+	CenterVertically       bool     `yaml:"center-vertically"`
+	AllowHidingWidgets     bool     `yaml:"allow-hiding-widgets"`
+	Layout                 string   `yaml:"layout"`
+	AllowedUsers           []string `yaml:"allowed-users"`
+	AllowedGroups          []string `yaml:"allowed-groups"`
+	HeadWidgets            Widgets  `yaml:"head-widgets"`
 	Columns                []struct {
 		Size    string  `yaml:"size"`
+		Name    string  `yaml:"name"`
 		Widgets Widgets `yaml:"widgets"`
 	} `yaml:"columns"`
 	PrimaryColumnIndex int8       `yaml:"-"`
@@ -69,34 +284,10 @@ type Page struct {
 // for those that require it. This was moved here from app/glance.go because
 // methods on Page must be defined in the models package.
 func (p *Page) UpdateOutdatedWidgets() {
-	now := time.Now()
-	var wg sync.WaitGroup
-	ctx := context.Background()
-
-	for w := range p.HeadWidgets {
-		widget := p.HeadWidgets[w]
-		if !widget.RequiresUpdate(&now) {
-			continue
-		}
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			widget.Update(ctx)
-		}()
-	}
-
+	widgets := slices.Clone(p.HeadWidgets)
 	for c := range p.Columns {
-		for w := range p.Columns[c].Widgets {
-			widget := p.Columns[c].Widgets[w]
-			if !widget.RequiresUpdate(&now) {
-				continue
-			}
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				widget.Update(ctx)
-			}()
-		}
+		widgets = append(widgets, p.Columns[c].Widgets...)
 	}
-	wg.Wait()
+
+	UpdateOutdatedWidgets(context.Background(), widgets)
 }
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+)
+
+const DefaultDataSourceCache = 5 * time.Minute
+
+// A document that gets fetched on behalf of all of the widgets that reference
+// it, at most once per cache duration regardless of how many widgets there are
+type DataSource struct {
+	Name   string
+	config *DataSourceConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	data      any
+	fetchedAt time.Time
+}
+
+func NewDataSources(configs map[string]*DataSourceConfig) map[string]*DataSource {
+	sources := make(map[string]*DataSource, len(configs))
+
+	for name, config := range configs {
+		sources[name] = &DataSource{
+			Name:   name,
+			config: config,
+			client: fetch.NewClient(time.Duration(config.RequestTimeout), config.AllowInsecure),
+		}
+	}
+
+	return sources
+}
+
+func (s *DataSource) cacheDuration() time.Duration {
+	return common.Ternary(s.config.Cache > 0, time.Duration(s.config.Cache), DefaultDataSourceCache)
+}
+
+// Returns the cached data when it's still fresh, otherwise fetches it again.
+// Widgets that ask while a fetch is in progress wait for it and get its result
+// instead of starting their own. Failed fetches aren't cached so the next
+// widget that asks tries again.
+func (s *DataSource) Get(ctx context.Context) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < s.cacheDuration() {
+		return s.data, nil
+	}
+
+	data, err := s.fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("data source %s: %w", s.Name, err)
+	}
+
+	s.data = data
+	s.fetchedAt = time.Now()
+
+	return data, nil
+}
+
+func (s *DataSource) fetch(ctx context.Context) (any, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.config.Parameters) > 0 {
+		query := request.URL.Query()
+		for key, values := range s.config.Parameters {
+			for _, value := range values {
+				query.Add(key, value)
+			}
+		}
+		request.URL.RawQuery = query.Encode()
+	}
+
+	for name, value := range s.config.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		truncatedBody, _ := common.LimitStringLength(string(body), 256)
+		return nil, fmt.Errorf(
+			"unexpected status code %d from %s, response: %s",
+			response.StatusCode,
+			request.URL,
+			truncatedBody,
+		)
+	}
+
+	if s.config.Format == DataSourceFormatText {
+		return string(body), nil
+	}
+
+	var data any
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %v", err)
+	}
+
+	return data, nil
+}
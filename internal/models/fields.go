@@ -1,17 +1,19 @@
 package models
 
 import (
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"gopkg.in/yaml.v3"
 )
 
@@ -130,6 +132,132 @@ func (d *DurationField) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+var updateScheduleRangePattern = regexp.MustCompile(`^(?:([a-z,\-]+) +)?(\d{1,2}):(\d{2}) *- *(\d{1,2}):(\d{2})$`)
+
+var weekdayAbbreviations = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Times of the week during which widgets are allowed to update, written as
+// time ranges in the server's time zone that are optionally limited to some
+// days, such as "mon-fri 09:00-18:00" or "22:00-06:00". An empty schedule
+// allows updates at any time.
+type UpdateScheduleField []updateScheduleRange
+
+type updateScheduleRange struct {
+	days  [7]bool
+	start int // minutes since midnight
+	end   int
+}
+
+func (s *UpdateScheduleField) UnmarshalYAML(node *yaml.Node) error {
+	var values []string
+
+	if err := node.Decode(&values); err != nil {
+		var value string
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		values = []string{value}
+	}
+
+	*s = make(UpdateScheduleField, 0, len(values))
+
+	for _, value := range values {
+		parsed, err := parseUpdateScheduleRange(strings.ToLower(strings.TrimSpace(value)))
+		if err != nil {
+			return fmt.Errorf("invalid update-schedule range %q: %v", value, err)
+		}
+		*s = append(*s, parsed)
+	}
+
+	return nil
+}
+
+func parseUpdateScheduleRange(value string) (updateScheduleRange, error) {
+	var r updateScheduleRange
+
+	matches := updateScheduleRangePattern.FindStringSubmatch(value)
+	if matches == nil {
+		return r, errors.New("expected a time range such as 09:00-18:00, optionally preceded by days such as mon-fri")
+	}
+
+	parseTime := func(hours, minutes string) (int, error) {
+		h, _ := strconv.Atoi(hours)
+		m, _ := strconv.Atoi(minutes)
+		if h > 24 || m > 59 || (h == 24 && m != 0) {
+			return 0, fmt.Errorf("%s:%s is not a valid time", hours, minutes)
+		}
+		return h*60 + m, nil
+	}
+
+	var err error
+	if r.start, err = parseTime(matches[2], matches[3]); err != nil {
+		return r, err
+	}
+	if r.end, err = parseTime(matches[4], matches[5]); err != nil {
+		return r, err
+	}
+	if r.start == r.end {
+		return r, errors.New("start and end can't be the same")
+	}
+
+	if matches[1] == "" {
+		r.days = [7]bool{true, true, true, true, true, true, true}
+		return r, nil
+	}
+
+	for _, days := range strings.Split(matches[1], ",") {
+		from, to, isRange := strings.Cut(days, "-")
+		first := slices.Index(weekdayAbbreviations, from)
+		last := first
+		if isRange {
+			last = slices.Index(weekdayAbbreviations, to)
+		}
+		if first == -1 || last == -1 {
+			return r, fmt.Errorf("days must be any of %s", strings.Join(weekdayAbbreviations, ", "))
+		}
+		// ranges such as fri-mon wrap around the end of the week
+		for day := first; ; day = (day + 1) % 7 {
+			r.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// Ranges that end before they start, such as 22:00-06:00, go past midnight
+// and belong to the day on which they start
+func (r *updateScheduleRange) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+
+	if r.start < r.end {
+		return r.days[day] && minute >= r.start && minute < r.end
+	}
+
+	if minute >= r.start {
+		return r.days[day]
+	}
+
+	return minute < r.end && r.days[(day+6)%7]
+}
+
+func (s UpdateScheduleField) Allows(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+
+	for i := range s {
+		if s[i].contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type CustomIconField struct {
 	URL        template.URL
 	AutoInvert bool
@@ -188,13 +316,24 @@ func (i *CustomIconField) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+// Either the URL of the proxy, none to not use a proxy even when a default one
+// is configured, or its URL along with other options
 type ProxyOptionsField struct {
 	URL           string        `yaml:"url"`
+	Username      string        `yaml:"username"`
+	Password      string        `yaml:"password"`
 	AllowInsecure bool          `yaml:"allow-insecure"`
 	Timeout       DurationField `yaml:"timeout"`
+	Disabled      bool          `yaml:"-"`
 	Client        *http.Client  `yaml:"-"`
+	// kept separate so that widgets with allow-insecure don't turn off
+	// verification for the other widgets that use the same proxy
+	transport         http.RoundTripper
+	insecureTransport http.RoundTripper
 }
 
+const proxyOptionsDisabledValue = "none"
+
 func (p *ProxyOptionsField) UnmarshalYAML(node *yaml.Node) error {
 	type proxyOptionsFieldAlias ProxyOptionsField
 	alias := (*proxyOptionsFieldAlias)(p)
@@ -206,6 +345,11 @@ func (p *ProxyOptionsField) UnmarshalYAML(node *yaml.Node) error {
 		}
 	}
 
+	if proxyURL == proxyOptionsDisabledValue {
+		p.Disabled = true
+		return nil
+	}
+
 	if proxyURL == "" && p.URL == "" {
 		return nil
 	}
@@ -219,22 +363,49 @@ func (p *ProxyOptionsField) UnmarshalYAML(node *yaml.Node) error {
 		return fmt.Errorf("parsing proxy URL: %v", err)
 	}
 
+	if err := fetch.ValidateProxyURL(parsedUrl); err != nil {
+		return err
+	}
+
+	if p.Username != "" || p.Password != "" {
+		parsedUrl.User = url.UserPassword(p.Username, p.Password)
+	}
+
 	timeout := common.DefaultClientTimeout
 	if p.Timeout > 0 {
 		timeout = time.Duration(p.Timeout)
 	}
 
+	p.transport = fetch.NewProxyTransport(parsedUrl, p.AllowInsecure)
+	p.insecureTransport = p.transport
+	if !p.AllowInsecure {
+		p.insecureTransport = fetch.NewProxyTransport(parsedUrl, true)
+	}
+
 	p.Client = &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			Proxy:           http.ProxyURL(parsedUrl),
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: p.AllowInsecure},
-		},
+		Timeout:   timeout,
+		Transport: p.transport,
 	}
 
 	return nil
 }
 
+// Returns a client that sends requests through the proxy and shares its
+// connections with the other clients of the same proxy, the timeout of the
+// proxy takes precedence over the given one
+func (p *ProxyOptionsField) NewClient(timeout time.Duration, allowInsecure bool) *http.Client {
+	if p.Timeout > 0 {
+		timeout = time.Duration(p.Timeout)
+	} else if timeout <= 0 {
+		timeout = common.DefaultClientTimeout
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: common.Ternary(allowInsecure, p.insecureTransport, p.transport),
+	}
+}
+
 type QueryParametersField map[string][]string
 
 func (q *QueryParametersField) UnmarshalYAML(node *yaml.Node) error {
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+func hsl(h, s, l float64) *HSLColorField {
+	return &HSLColorField{H: h, S: s, L: l}
+}
+
+// Themes that can be used as the base of the theme or of any preset through
+// the preset property, the same ones that are listed in docs/themes.md
+var builtinThemePresets = map[string]ThemeProperties{
+	"teal-city": {
+		BackgroundColor:    hsl(225, 14, 15),
+		PrimaryColor:       hsl(157, 47, 65),
+		ContrastMultiplier: 1.1,
+	},
+	"catppuccin-frappe": {
+		BackgroundColor:    hsl(229, 19, 23),
+		PrimaryColor:       hsl(222, 74, 74),
+		PositiveColor:      hsl(96, 44, 68),
+		NegativeColor:      hsl(359, 68, 71),
+		ContrastMultiplier: 1.2,
+	},
+	"catppuccin-macchiato": {
+		BackgroundColor:    hsl(232, 23, 18),
+		PrimaryColor:       hsl(220, 83, 75),
+		PositiveColor:      hsl(105, 48, 72),
+		NegativeColor:      hsl(351, 74, 73),
+		ContrastMultiplier: 1.2,
+	},
+	"catppuccin-mocha": {
+		BackgroundColor:    hsl(240, 21, 15),
+		PrimaryColor:       hsl(217, 92, 83),
+		PositiveColor:      hsl(115, 54, 76),
+		NegativeColor:      hsl(347, 70, 65),
+		ContrastMultiplier: 1.2,
+	},
+	"camouflage": {
+		BackgroundColor:    hsl(186, 21, 20),
+		PrimaryColor:       hsl(97, 13, 80),
+		ContrastMultiplier: 1.2,
+	},
+	"gruvbox-dark": {
+		BackgroundColor: hsl(0, 0, 16),
+		PrimaryColor:    hsl(43, 59, 81),
+		PositiveColor:   hsl(61, 66, 44),
+		NegativeColor:   hsl(6, 96, 59),
+	},
+	"kanagawa-dark": {
+		BackgroundColor:    hsl(240, 13, 14),
+		PrimaryColor:       hsl(51, 33, 68),
+		NegativeColor:      hsl(358, 100, 68),
+		ContrastMultiplier: 1.2,
+	},
+	"tucan": {
+		BackgroundColor: hsl(50, 1, 6),
+		PrimaryColor:    hsl(24, 97, 58),
+		NegativeColor:   hsl(209, 88, 54),
+	},
+	"dracula": {
+		BackgroundColor:    hsl(231, 15, 21),
+		PrimaryColor:       hsl(265, 89, 79),
+		PositiveColor:      hsl(135, 94, 66),
+		NegativeColor:      hsl(0, 100, 67),
+		ContrastMultiplier: 1.2,
+	},
+	"shades-of-purple": {
+		BackgroundColor:    hsl(243, 33, 25),
+		PrimaryColor:       hsl(50, 100, 49),
+		PositiveColor:      hsl(98, 82, 71),
+		NegativeColor:      hsl(12, 77, 52),
+		ContrastMultiplier: 1.2,
+	},
+	"neon-pink": {
+		BackgroundColor:    hsl(240, 27, 11),
+		PrimaryColor:       hsl(321, 100, 71),
+		PositiveColor:      hsl(165, 78, 51),
+		NegativeColor:      hsl(360, 100, 71),
+		ContrastMultiplier: 1.5,
+	},
+	"nord": {
+		BackgroundColor: hsl(220, 16, 22),
+		PrimaryColor:    hsl(193, 43, 67),
+		PositiveColor:   hsl(92, 28, 65),
+		NegativeColor:   hsl(354, 42, 56),
+	},
+	"catppuccin-latte": {
+		Light:              true,
+		BackgroundColor:    hsl(220, 23, 95),
+		PrimaryColor:       hsl(220, 91, 54),
+		PositiveColor:      hsl(109, 58, 40),
+		NegativeColor:      hsl(347, 87, 44),
+		ContrastMultiplier: 1.0,
+	},
+	"peachy": {
+		Light:                    true,
+		BackgroundColor:          hsl(28, 40, 77),
+		PrimaryColor:             hsl(155, 100, 20),
+		NegativeColor:            hsl(0, 100, 60),
+		ContrastMultiplier:       1.1,
+		TextSaturationMultiplier: 0.5,
+	},
+	"zebra": {
+		Light:           true,
+		BackgroundColor: hsl(0, 0, 95),
+		PrimaryColor:    hsl(0, 0, 10),
+		NegativeColor:   hsl(0, 90, 50),
+	},
+}
+
+// Returns a copy of the built-in preset with the given name
+func BuiltinThemePreset(name string) (*ThemeProperties, bool) {
+	preset, exists := builtinThemePresets[name]
+	if !exists {
+		return nil, false
+	}
+
+	copyColor := func(c *HSLColorField) *HSLColorField {
+		if c == nil {
+			return nil
+		}
+		copied := *c
+		return &copied
+	}
+
+	preset.BackgroundColor = copyColor(preset.BackgroundColor)
+	preset.PrimaryColor = copyColor(preset.PrimaryColor)
+	preset.PositiveColor = copyColor(preset.PositiveColor)
+	preset.NegativeColor = copyColor(preset.NegativeColor)
+
+	return &preset, true
+}
+
+func BuiltinThemePresetNames() []string {
+	return slices.Sorted(maps.Keys(builtinThemePresets))
+}
+
+// Fills in the properties that haven't been set from the built-in preset named
+// by the preset property, if there is one
+func (t *ThemeProperties) InheritFromPreset() error {
+	if t.Preset == "" {
+		return nil
+	}
+
+	base, exists := BuiltinThemePreset(t.Preset)
+	if !exists {
+		return fmt.Errorf(
+			"preset %s does not exist, available presets are: %s",
+			t.Preset,
+			strings.Join(BuiltinThemePresetNames(), ", "),
+		)
+	}
+
+	t.InheritFrom(base)
+	return nil
+}
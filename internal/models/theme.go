@@ -1,8 +1,11 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/limpdev/gander/internal/common"
 )
@@ -10,9 +13,20 @@ import (
 var (
 	StyleTemplate         = common.MustParseTemplate("theme-style.gotmpl")
 	PresetPreviewTemplate = common.MustParseTemplate("theme-preset-preview.html")
+	AutoPreviewTemplate   = common.MustParseTemplate("theme-auto-preview.html")
+)
+
+const (
+	ThemeAutoKey        = "auto"
+	ThemeAutoModeSystem = "system"
+	ThemeAutoModeSun    = "sun"
 )
 
 type ThemeProperties struct {
+	// The name of a built-in preset or the path to a base16 scheme, which the
+	// other properties get applied on top of
+	Preset                   string         `yaml:"preset"`
+	Base16                   string         `yaml:"base16"`
 	BackgroundColor          *HSLColorField `yaml:"background-color"`
 	PrimaryColor             *HSLColorField `yaml:"primary-color"`
 	PositiveColor            *HSLColorField `yaml:"positive-color"`
@@ -20,6 +34,11 @@ type ThemeProperties struct {
 	Light                    bool           `yaml:"light"`
 	ContrastMultiplier       float32        `yaml:"contrast-multiplier"`
 	TextSaturationMultiplier float32        `yaml:"text-saturation-multiplier"`
+	BackgroundImage          string         `yaml:"background-image"`
+	BackgroundBlur           int            `yaml:"background-blur"`
+	BackgroundOpacity        float32        `yaml:"background-opacity"`
+	WidgetOpacity            float32        `yaml:"widget-opacity"`
+	WidgetBlur               int            `yaml:"widget-blur"`
 
 	Key                  string        `yaml:"-"`
 	CSS                  template.CSS  `yaml:"-"`
@@ -28,6 +47,19 @@ type ThemeProperties struct {
 }
 
 func (t *ThemeProperties) Initialize() error {
+	if t.BackgroundBlur < 0 {
+		return errors.New("background-blur can't be negative")
+	}
+	if t.WidgetBlur < 0 {
+		return errors.New("widget-blur can't be negative")
+	}
+	if t.BackgroundOpacity < 0 || t.BackgroundOpacity > 1 {
+		return errors.New("background-opacity must be between 0 and 1")
+	}
+	if t.WidgetOpacity < 0 || t.WidgetOpacity > 1 {
+		return errors.New("widget-opacity must be between 0 and 1")
+	}
+
 	css, err := common.ExecuteTemplateToString(StyleTemplate, t)
 	if err != nil {
 		return fmt.Errorf("compiling theme style: %v", err)
@@ -49,6 +81,115 @@ func (t *ThemeProperties) Initialize() error {
 	return nil
 }
 
+// Fills in the properties that haven't been set from base
+func (t *ThemeProperties) InheritFrom(base *ThemeProperties) {
+	if t.BackgroundColor == nil {
+		t.BackgroundColor = base.BackgroundColor
+	}
+	if t.PrimaryColor == nil {
+		t.PrimaryColor = base.PrimaryColor
+	}
+	if t.PositiveColor == nil {
+		t.PositiveColor = base.PositiveColor
+	}
+	if t.NegativeColor == nil {
+		t.NegativeColor = base.NegativeColor
+	}
+	if !t.Light {
+		t.Light = base.Light
+	}
+	if t.ContrastMultiplier == 0 {
+		t.ContrastMultiplier = base.ContrastMultiplier
+	}
+	if t.TextSaturationMultiplier == 0 {
+		t.TextSaturationMultiplier = base.TextSaturationMultiplier
+	}
+}
+
+// The URL of the background image escaped so that it can be placed within a
+// quoted CSS string. Anything that isn't plainly safe becomes a CSS escape,
+// which leaves nothing for the HTML escaping of the style template to change.
+func (t *ThemeProperties) BackgroundImageURL() string {
+	var escaped strings.Builder
+
+	for _, r := range t.BackgroundImage {
+		if r < utf8.RuneSelf && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/:.-_~?=%+,@#", r)) {
+			escaped.WriteRune(r)
+		} else {
+			fmt.Fprintf(&escaped, "\\%x ", r)
+		}
+	}
+
+	return escaped.String()
+}
+
+// Switches between two presets, either following the color scheme preferred by
+// the browser or whether the sun is up where the weather widget is
+type ThemeAutoConfig struct {
+	Mode        string `yaml:"mode"`
+	LightPreset string `yaml:"light-preset"`
+	DarkPreset  string `yaml:"dark-preset"`
+
+	Light *ThemeProperties `yaml:"-"`
+	Dark  *ThemeProperties `yaml:"-"`
+	// Both presets behind prefers-color-scheme media queries, which is what
+	// gets used when the browser picks between them
+	CSS         template.CSS  `yaml:"-"`
+	PreviewHTML template.HTML `yaml:"-"`
+}
+
+// Must be called after the presets have been initialized. Presets can also be
+// default, which refers to the theme that's used when none has been picked.
+func (t *ThemeAutoConfig) Initialize(defaultTheme *ThemeProperties, presets *OrderedYAMLMap[string, *ThemeProperties]) error {
+	if t.Mode == "" {
+		t.Mode = ThemeAutoModeSystem
+	} else if t.Mode != ThemeAutoModeSystem && t.Mode != ThemeAutoModeSun {
+		return fmt.Errorf("mode must be either system or sun, got %q", t.Mode)
+	}
+
+	if t.LightPreset == "" {
+		t.LightPreset = "default-light"
+	}
+	if t.DarkPreset == "" {
+		// there's only a default-dark preset when the default theme isn't
+		// already the same
+		if _, ok := presets.Get("default-dark"); ok {
+			t.DarkPreset = "default-dark"
+		} else {
+			t.DarkPreset = "default"
+		}
+	}
+
+	get := func(key string) (*ThemeProperties, bool) {
+		if key == "default" {
+			return defaultTheme, true
+		}
+		return presets.Get(key)
+	}
+
+	var ok bool
+	if t.Light, ok = get(t.LightPreset); !ok {
+		return fmt.Errorf("light-preset %s does not exist", t.LightPreset)
+	}
+	if t.Dark, ok = get(t.DarkPreset); !ok {
+		return fmt.Errorf("dark-preset %s does not exist", t.DarkPreset)
+	}
+	if t.Light == t.Dark {
+		return errors.New("light-preset and dark-preset must be different")
+	}
+
+	t.CSS = "@media (prefers-color-scheme: light) {" + t.Light.CSS + "}" +
+		"@media not all and (prefers-color-scheme: light) {" + t.Dark.CSS + "}"
+
+	previewHTML, err := common.ExecuteTemplateToString(AutoPreviewTemplate, t)
+	if err != nil {
+		return fmt.Errorf("compiling preview: %v", err)
+	}
+	t.PreviewHTML = template.HTML(previewHTML)
+
+	return nil
+}
+
 func (t1 *ThemeProperties) SameAs(t2 *ThemeProperties) bool {
 	if t1 == nil && t2 == nil {
 		return true
@@ -65,6 +206,12 @@ func (t1 *ThemeProperties) SameAs(t2 *ThemeProperties) bool {
 	if t1.TextSaturationMultiplier != t2.TextSaturationMultiplier {
 		return false
 	}
+	if t1.BackgroundImage != t2.BackgroundImage || t1.BackgroundBlur != t2.BackgroundBlur || t1.BackgroundOpacity != t2.BackgroundOpacity {
+		return false
+	}
+	if t1.WidgetOpacity != t2.WidgetOpacity || t1.WidgetBlur != t2.WidgetBlur {
+		return false
+	}
 	if !t1.BackgroundColor.SameAs(t2.BackgroundColor) {
 		return false
 	}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultMaxConcurrentUpdates = 10
+	// Delay between starting the updates of widgets that became outdated at
+	// the same time, such as when a page gets loaded for the first time
+	widgetUpdateStagger = 20 * time.Millisecond
+)
+
+// Limits how many widgets can be updating at the same time across all pages,
+// nil when there's no limit
+var widgetUpdateSlots atomic.Pointer[chan struct{}]
+
+func init() {
+	SetMaxConcurrentUpdates(DefaultMaxConcurrentUpdates)
+}
+
+// A value lower than 1 removes the limit. Updates that are already waiting
+// for a slot keep waiting on the previous limit.
+func SetMaxConcurrentUpdates(max int) {
+	if max < 1 {
+		widgetUpdateSlots.Store(nil)
+		return
+	}
+
+	slots := make(chan struct{}, max)
+	widgetUpdateSlots.Store(&slots)
+}
+
+// Updates the widgets that require it and waits for them to finish. Containers
+// don't take up a slot themselves since the widgets within them do, otherwise
+// they could end up waiting on slots held by other containers.
+func UpdateOutdatedWidgets(ctx context.Context, widgets Widgets) {
+	now := time.Now()
+	var wg sync.WaitGroup
+	started := 0
+
+	for _, widget := range widgets {
+		if !widget.RequiresUpdate(&now) {
+			continue
+		}
+
+		delay := time.Duration(started) * widgetUpdateStagger
+		started++
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			UpdateWidgetWithinLimit(ctx, widget)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Updates the widget once one of the update slots frees up, also used for the
+// updates that users ask for so that they can't get around the limit. Fails
+// only when ctx is done before the update could start.
+func UpdateWidgetWithinLimit(ctx context.Context, widget Widget) error {
+	if _, isContainer := widget.(ContainerWidget); !isContainer {
+		if slots := widgetUpdateSlots.Load(); slots != nil {
+			select {
+			case *slots <- struct{}{}:
+				defer func() { <-*slots }()
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	UpdateWidget(ctx, widget)
+	return nil
+}
+
+// Updates the widget while holding its lock, if it has one. Containers aren't
+// locked or measured so that the widgets within them can be rendered while
+// they update, and since their updates are made up of those of their widgets.
+func UpdateWidget(ctx context.Context, widget Widget) {
+	if _, isContainer := widget.(ContainerWidget); isContainer {
+		widget.Update(ctx)
+		return
+	}
+
+	if locked, ok := widget.(LockedWidget); ok {
+		lock := locked.GetUpdateLock()
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	start := time.Now()
+	widget.Update(ctx)
+
+	if measured, ok := widget.(MeasuredWidget); ok {
+		measured.RecordUpdate(time.Since(start))
+	}
+}
+
+// Handles the request while holding the widget's lock, if it has one, so that
+// it can't change the widget's state in the middle of an update. Like when
+// updating, containers aren't locked and leave it to the widgets within them.
+func HandleWidgetRequest(w http.ResponseWriter, r *http.Request, widget Widget) {
+	_, isContainer := widget.(ContainerWidget)
+	_, locksItself := widget.(SelfLockingWidget)
+
+	if locked, ok := widget.(LockedWidget); ok && !isContainer && !locksItself {
+		lock := locked.GetUpdateLock()
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	widget.HandleRequest(w, r)
+}
@@ -3,19 +3,30 @@ package models
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"math"
 	"net/http"
-	"sync/atomic"
+	"sync"
 	"time"
 
+	"github.com/limpdev/gander/internal/common"
 	"gopkg.in/yaml.v3"
 )
 
-var widgetIDCounter atomic.Uint64
+var (
+	// Widgets return errors that wrap this one when none of their sources
+	// could be fetched, there's nothing to show besides the error
+	ErrNoContent = errors.New("failed to retrieve any content")
+	// Widgets return errors that wrap this one when some of their sources
+	// could be fetched but others couldn't, what was fetched gets shown along
+	// with the error as a notice and the next update happens as usual
+	ErrPartialContent = errors.New("failed to retrieve some of the content")
+)
 
 type Widget interface {
 	// These need to be exported because they get called in templates
@@ -34,6 +45,159 @@ type Widget interface {
 
 type Widgets []Widget
 
+// Implemented by widgets that keep track of the outcome of their last update
+type WidgetStatusReporter interface {
+	GetError() error
+	GetNotice() error
+	GetLastUpdate() time.Time
+}
+
+// Implemented by widgets that get updated in the background. The lock is held
+// for writing while the widget updates, so its state must only be read while
+// holding it for reading.
+type LockedWidget interface {
+	GetUpdateLock() *sync.RWMutex
+}
+
+// Implemented by locked widgets whose HandleRequest takes the update lock
+// itself, only for as long as it changes their state, so that they can wait on
+// other services and render themselves for the response without holding it
+type SelfLockingWidget interface {
+	LocksOwnRequests()
+}
+
+// Implemented by widgets that can tell whether updating them outside of their
+// schedule does anything, which isn't the case for those that never update
+type RefreshableWidget interface {
+	CanRefresh() bool
+}
+
+// Implemented by widgets that keep track of how long their updates take and
+// how much they fetch. RecordUpdate gets called after every update, while the
+// update lock is still held.
+type MeasuredWidget interface {
+	RecordUpdate(duration time.Duration)
+	GetUpdateMetrics() WidgetUpdateMetrics
+}
+
+type WidgetUpdateMetrics struct {
+	Updates           int
+	LastDuration      time.Duration
+	LastBytesFetched  int64
+	TotalBytesFetched int64
+	// Only one of them is above 0, depending on whether the last update failed
+	SuccessStreak int
+	FailureStreak int
+}
+
+// Implemented by widgets that hold other widgets, such as groups and split columns
+type ContainerWidget interface {
+	GetWidgets() Widgets
+}
+
+// Implemented by widgets that remember a fingerprint of the YAML they were
+// decoded from, used to tell which widgets are unchanged after a config reload
+type FingerprintedWidget interface {
+	SetFingerprint(string)
+	GetFingerprint() string
+}
+
+// Implemented by widgets that remember the line of the config they were defined
+// on, used to point to the right place when reporting errors
+type LocatedWidget interface {
+	SetSourceLine(int)
+	GetSourceLine() int
+}
+
+// Implemented by widgets that are tied to a place, such as the weather
+// widget once it has looked up its location. Must be called while holding the
+// update lock for reading.
+type CoordinatesWidget interface {
+	GetCoordinates() (latitude, longitude float64, ok bool)
+}
+
+// Implemented by widgets that can be limited to specific users and groups
+type AccessRestrictedWidget interface {
+	GetAllowedUsers() []string
+	GetAllowedGroups() []string
+}
+
+// Implemented by widgets whose content can be changed from the dashboard and
+// where that can be limited to some of the users that can see them
+type EditRestrictedWidget interface {
+	GetEditors() (users, groups []string)
+}
+
+// Implemented by widgets with requests that stay open, such as streams of
+// events, which are handled without holding the lock of the widget's page
+type StreamingWidget interface {
+	IsStreamingRequest(r *http.Request) bool
+}
+
+// Implemented by widgets that receive events pushed to
+// /api/webhooks/{name}, those requests are authenticated by the widget itself
+// rather than by the session of a user
+type WebhookWidget interface {
+	GetWebhookName() string
+	HandleWebhook(w http.ResponseWriter, r *http.Request)
+}
+
+type widgetRequestUserKey struct{}
+
+type widgetRequestUser struct {
+	username string
+	user     *User
+}
+
+// Attaches the user making a request to a widget so that the widget can look
+// them up through WidgetRequestUser
+func WithWidgetRequestUser(r *http.Request, username string, user *User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), widgetRequestUserKey{}, widgetRequestUser{username, user}))
+}
+
+// The username is empty and the user is nil when authentication isn't enabled
+func WidgetRequestUser(r *http.Request) (string, *User) {
+	requestUser, _ := r.Context().Value(widgetRequestUserKey{}).(widgetRequestUser)
+	return requestUser.username, requestUser.user
+}
+
+// Implemented by widgets that can reference one of the data sources of the
+// config, an empty name means that the widget doesn't use one
+type DataSourceWidget interface {
+	GetDataSourceName() string
+}
+
+// Implemented by widgets that embed content from elsewhere, the returned
+// sources get added to the directives of the automatic Content-Security-Policy,
+// e.g. {"frame-src": {"https://example.com"}}
+type ContentSecurityPolicyWidget interface {
+	GetCSPSources() map[string][]string
+}
+
+// Implemented by widgets that have a title, which is shown in their header
+type TitledWidget interface {
+	GetTitle() string
+	GetTitleURL() string
+}
+
+// Implemented by widgets that expose the data they fetched so that it can be
+// consumed without scraping their HTML, such as through the JSON page API.
+// The returned value gets encoded as JSON while the lock of the widget's page
+// is held, so it can share memory with the widget.
+type DataExportingWidget interface {
+	MarshalData() (any, error)
+}
+
+// Implemented by widgets that read feeds, used when exporting them to OPML
+type FeedWidget interface {
+	GetFeeds() []Feed
+}
+
+type Feed struct {
+	Title string
+	URL   string
+}
+
 // Registry for widget factories
 var widgetFactories = make(map[string]func() Widget)
 
@@ -41,6 +205,11 @@ func RegisterWidget(name string, factory func() Widget) {
 	widgetFactories[name] = factory
 }
 
+func LookupWidgetFactory(name string) (func() Widget, bool) {
+	factory, ok := widgetFactories[name]
+	return factory, ok
+}
+
 func NewWidget(widgetType string) (Widget, error) {
 	if widgetType == "" {
 		return nil, errors.New("widget 'type' property is empty or not specified")
@@ -52,8 +221,6 @@ func NewWidget(widgetType string) (Widget, error) {
 	}
 
 	w := factory()
-	w.SetID(widgetIDCounter.Add(1))
-
 	return w, nil
 }
 
@@ -82,12 +249,34 @@ func (w *Widgets) UnmarshalYAML(node *yaml.Node) error {
 			return err
 		}
 
+		if located, ok := widget.(LocatedWidget); ok {
+			located.SetSourceLine(node.Line)
+		}
+
+		if fingerprinted, ok := widget.(FingerprintedWidget); ok {
+			fingerprint, err := fingerprintYAMLNode(&node)
+			if err != nil {
+				return err
+			}
+			fingerprinted.SetFingerprint(fingerprint)
+		}
+
 		*w = append(*w, widget)
 	}
 
 	return nil
 }
 
+func fingerprintYAMLNode(node *yaml.Node) (string, error) {
+	contents, err := yaml.Marshal(node)
+	if err != nil {
+		return "", fmt.Errorf("line %d: fingerprinting widget: %w", node.Line, err)
+	}
+
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 type CacheType int
 
 const (
@@ -118,6 +307,67 @@ type WidgetBase struct {
 
 type WidgetProviders struct {
 	AssetResolver func(string) string
+	// Sends notifications about the event to wherever the config says they
+	// should go, nil when no notifications are configured
+	Notify func(WidgetEvent)
+	// Applies to the widgets that don't have a schedule of their own
+	UpdateSchedule UpdateScheduleField
+	// Used by the widgets that don't have a proxy of their own
+	DefaultProxy *ProxyOptionsField
+	// In megabytes, for the widgets that don't have a limit of their own
+	MaxResponseSize       int
+	AllowPrivateAddresses bool
+	DataSources           map[string]*DataSource
+	// Whether visitors have to log in, actions that change something outside
+	// of the dashboard are only offered when they do
+	RequiresAuth bool
+	// Persists state that widgets can't fetch again after a restart, such as
+	// the history of their values
+	State WidgetStateStore
+}
+
+// Keys are only made up of letters, digits and dashes. Loading leaves v
+// untouched if nothing has been saved under the key yet.
+type WidgetStateStore interface {
+	LoadWidgetState(key string, v any) error
+	SaveWidgetState(key string, v any) error
+}
+
+const (
+	WidgetEventFailed     = "widget-failed"
+	WidgetEventRecovered  = "widget-recovered"
+	WidgetEventNewPost    = "new-post"
+	WidgetEventNewVideo   = "new-video"
+	WidgetEventStreamLive = "stream-live"
+	// Sent by the ups widget when the power goes out, when the battery gets
+	// low and when the power comes back
+	WidgetEventUPSOnBattery  = "ups-on-battery"
+	WidgetEventUPSLowBattery = "ups-low-battery"
+	WidgetEventUPSOnLine     = "ups-on-line"
+)
+
+var WidgetEventTypes = []string{
+	WidgetEventFailed,
+	WidgetEventRecovered,
+	WidgetEventNewPost,
+	WidgetEventNewVideo,
+	WidgetEventStreamLive,
+	WidgetEventUPSOnBattery,
+	WidgetEventUPSLowBattery,
+	WidgetEventUPSOnLine,
+}
+
+// A state transition reported by a widget, such as a channel going live or a
+// widget failing to update after having worked
+type WidgetEvent struct {
+	Type        string    `json:"type"`
+	WidgetID    uint64    `json:"widget_id"`
+	WidgetType  string    `json:"widget_type"`
+	WidgetTitle string    `json:"widget_title"`
+	Title       string    `json:"title"`
+	Message     string    `json:"message"`
+	URL         string    `json:"url,omitempty"`
+	Time        time.Time `json:"time"`
 }
 
 func (w *WidgetBase) RequiresUpdate(now *time.Time) bool {
@@ -165,6 +415,7 @@ func (w *WidgetBase) SetProviders(providers *WidgetProviders) {
 }
 
 func (w *WidgetBase) RenderTemplate(data any, t *template.Template) template.HTML {
+	t = common.OverriddenTemplate(t)
 	w.templateBuffer.Reset()
 	err := t.Execute(&w.templateBuffer, data)
 	if err != nil {
@@ -239,23 +490,25 @@ func (w *WidgetBase) WithError(err error) *WidgetBase {
 }
 
 func (w *WidgetBase) CanContinueUpdateAfterHandlingErr(err error) bool {
-	// TODO errors
-	// if errors.Is(err, errPartialContent) { ... }
-	// I need errPartialContent from somewhere.
-	// It was in widgets/utils.go. I should move it to models or common.
-
-	if err != nil {
-		w.ScheduleEarlyUpdate()
-		// Simplification for now, assuming logic handling is adjusted
-		w.WithError(err)
+	if err == nil {
 		w.WithNotice(nil)
-		return false
+		w.WithError(nil)
+		w.ScheduleNextUpdate()
+		return true
+	}
+
+	// retrying early could return even less content than this update did
+	if errors.Is(err, ErrPartialContent) {
+		w.WithError(nil)
+		w.WithNotice(err)
+		w.ScheduleNextUpdate()
+		return true
 	}
 
+	w.ScheduleEarlyUpdate()
+	w.WithError(err)
 	w.WithNotice(nil)
-	w.WithError(nil)
-	w.ScheduleNextUpdate()
-	return true
+	return false
 }
 
 func (w *WidgetBase) GetNextUpdateTime() time.Time {
@@ -0,0 +1,129 @@
+// Package opml reads and writes the OPML files that feed readers use to import
+// and export subscriptions
+package opml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A subscription, the category is the title of the outline it was nested in
+type Feed struct {
+	Title    string
+	URL      string
+	SiteURL  string
+	Category string
+}
+
+type document struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title,omitempty"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []outline `xml:"outline"`
+	} `xml:"body"`
+}
+
+type outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []outline `xml:"outline"`
+}
+
+func (o *outline) name() string {
+	if o.Title != "" {
+		return o.Title
+	}
+
+	return o.Text
+}
+
+// The feeds in the order they appear in, however deeply they're nested
+func Parse(r io.Reader) ([]Feed, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing OPML: %w", err)
+	}
+
+	var feeds []Feed
+	var walk func(outlines []outline, category string)
+	walk = func(outlines []outline, category string) {
+		for i := range outlines {
+			o := &outlines[i]
+			if o.XMLURL != "" {
+				feeds = append(feeds, Feed{
+					Title:    o.name(),
+					URL:      o.XMLURL,
+					SiteURL:  o.HTMLURL,
+					Category: category,
+				})
+			}
+
+			if len(o.Outlines) > 0 {
+				walk(o.Outlines, o.name())
+			}
+		}
+	}
+	walk(doc.Body.Outlines, "")
+
+	return feeds, nil
+}
+
+// Feeds with a category are grouped within an outline of that name, in the
+// order the categories first appear in
+func Write(w io.Writer, title string, feeds []Feed) error {
+	var doc document
+	doc.Version = "2.0"
+	doc.Head.Title = title
+	doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+
+	categoryIndex := make(map[string]int)
+	for _, feed := range feeds {
+		entry := outline{
+			Text:    feed.Title,
+			Title:   feed.Title,
+			Type:    "rss",
+			XMLURL:  feed.URL,
+			HTMLURL: feed.SiteURL,
+		}
+
+		if entry.Text == "" {
+			entry.Text = feed.URL
+		}
+
+		if feed.Category == "" {
+			doc.Body.Outlines = append(doc.Body.Outlines, entry)
+			continue
+		}
+
+		i, exists := categoryIndex[feed.Category]
+		if !exists {
+			i = len(doc.Body.Outlines)
+			categoryIndex[feed.Category] = i
+			doc.Body.Outlines = append(doc.Body.Outlines, outline{Text: feed.Category, Title: feed.Category})
+		}
+
+		doc.Body.Outlines[i].Outlines = append(doc.Body.Outlines[i].Outlines, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -9,7 +9,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -41,12 +41,18 @@ func readAllFromStaticFS(path string) ([]byte, error) {
 var StaticFSHash = func() string {
 	hash, err := computeFSHash(StaticFS)
 	if err != nil {
-		log.Printf("Could not compute static assets cache key: %v", err)
+		slog.Error("Could not compute static assets cache key", "error", err)
 		return strconv.FormatInt(time.Now().Unix(), 10)
 	}
 	return hash
 }()
 
+// Short hash of some contents, used to bust caches once they change
+func ContentHash(contents []byte) string {
+	sum := md5.Sum(contents)
+	return hex.EncodeToString(sum[:])[:10]
+}
+
 func computeFSHash(files fs.FS) (string, error) {
 	hash := md5.New()
 	err := fs.WalkDir(files, ".", func(path string, d fs.DirEntry, err error) error {
@@ -0,0 +1,257 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+)
+
+// Functions that are available to every template, including the ones that
+// users write for the custom-api, html and plugin widgets and config files.
+// Functions that take the value they operate on take it as their last argument
+// so that calls can be chained, as in {{ .Title | trimPrefix "Re: " | truncate 40 }},
+// since the piped value gets passed as the last argument.
+var TextTemplateFunctions = template.FuncMap{
+	"toUpper":    strings.ToUpper,
+	"toLower":    strings.ToLower,
+	"trimSpace":  strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"contains":   func(substring, s string) bool { return strings.Contains(s, substring) },
+	"replaceAll": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"split":      func(separator, s string) []string { return strings.Split(s, separator) },
+	"join":       join,
+	"concat":     func(items ...string) string { return strings.Join(items, "") },
+	"truncate":   truncate,
+	"default":    defaultValue,
+
+	"matches": func(pattern, s string) bool {
+		return cachedRegexp(pattern).MatchString(s)
+	},
+	"replaceMatches": func(pattern, replacement, s string) string {
+		if s == "" {
+			return ""
+		}
+
+		return cachedRegexp(pattern).ReplaceAllString(s, replacement)
+	},
+	"findMatch": func(pattern, s string) string {
+		if s == "" {
+			return ""
+		}
+
+		return cachedRegexp(pattern).FindString(s)
+	},
+	"findSubmatch": func(pattern, s string) string {
+		if s == "" {
+			return ""
+		}
+
+		if submatches := cachedRegexp(pattern).FindStringSubmatch(s); len(submatches) > 1 {
+			return submatches[1]
+		}
+
+		return ""
+	},
+
+	"now": time.Now,
+	"offsetNow": func(offset string) time.Time {
+		d, err := time.ParseDuration(offset)
+		if err != nil {
+			return time.Now()
+		}
+		return time.Now().Add(d)
+	},
+	"duration": func(str string) time.Duration {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return 0
+		}
+
+		return d
+	},
+	"addDuration": func(offset string, t time.Time) time.Time {
+		d, err := time.ParseDuration(offset)
+		if err != nil {
+			return t
+		}
+		return t.Add(d)
+	},
+	"since": time.Since,
+	"until": time.Until,
+	"parseTime": func(layout, value string) time.Time {
+		return ParseTimeInLocation(layout, value, time.UTC)
+	},
+	"parseLocalTime": func(layout, value string) time.Time {
+		return ParseTimeInLocation(layout, value, time.Local)
+	},
+	"formatTime": FormatTime,
+	"startOfDay": func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	},
+	"endOfDay": func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, t.Location())
+	},
+
+	"jsonPath": jsonPath,
+	"toJSON": func(value any) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+func init() {
+	for name, function := range TextTemplateFunctions {
+		GlobalTemplateFunctions[name] = function
+	}
+}
+
+// Shortens s to at most length characters, ending it with an ellipsis when
+// anything had to be cut
+func truncate(length int, s string) string {
+	if length <= 0 || utf8.RuneCountInString(s) <= length {
+		return s
+	}
+
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:length-1])) + "…"
+}
+
+// Accepts []any as well so that the results of jsonPath can be joined
+func join(separator string, items any) (string, error) {
+	switch items := items.(type) {
+	case []string:
+		return strings.Join(items, separator), nil
+	case []any:
+		parts := make([]string, len(items))
+		for i := range items {
+			parts[i] = fmt.Sprint(items[i])
+		}
+		return strings.Join(parts, separator), nil
+	}
+
+	return "", fmt.Errorf("join requires a list, got %T", items)
+}
+
+// Returns value unless it's the zero value of its type or an empty collection
+func defaultValue(fallback, value any) any {
+	if value == nil {
+		return fallback
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if v.Len() == 0 {
+			return fallback
+		}
+	default:
+		if v.IsZero() {
+			return fallback
+		}
+	}
+
+	return value
+}
+
+// Looks up a gjson path, such as "items.0.name" or "items.#.name", within
+// either a JSON string or any value that can be encoded as JSON, like the
+// data of a data source
+func jsonPath(path string, value any) (any, error) {
+	var document string
+
+	switch value := value.(type) {
+	case string:
+		document = value
+	case template.HTML:
+		document = string(value)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		document = string(encoded)
+	}
+
+	return gjson.Get(document, path).Value(), nil
+}
+
+var (
+	regexpCacheMu sync.Mutex
+	regexpCache   = make(map[string]*regexp.Regexp)
+)
+
+const maxCachedRegexps = 256
+
+// Invalid patterns panic, which templates turn into an error for the call
+func cachedRegexp(pattern string) *regexp.Regexp {
+	regexpCacheMu.Lock()
+	defer regexpCacheMu.Unlock()
+
+	regex, exists := regexpCache[pattern]
+	if !exists {
+		regex = regexp.MustCompile(pattern)
+		if len(regexpCache) < maxCachedRegexps {
+			regexpCache[pattern] = regex
+		}
+	}
+
+	return regex
+}
+
+func FormatTime(layout string, t time.Time) string {
+	switch strings.ToLower(layout) {
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "rfc3339":
+		layout = time.RFC3339
+	case "rfc3339nano":
+		layout = time.RFC3339Nano
+	case "datetime":
+		layout = time.DateTime
+	case "dateonly":
+		layout = time.DateOnly
+	}
+
+	return t.Format(layout)
+}
+
+// Besides Go's layouts, accepts unix, rfc3339, rfc3339nano, datetime and
+// dateonly. Values that can't be parsed result in the unix epoch.
+func ParseTimeInLocation(layout, value string, loc *time.Location) time.Time {
+	switch strings.ToLower(layout) {
+	case "unix":
+		asInt, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Unix(0, 0)
+		}
+
+		return time.Unix(asInt, 0)
+	case "rfc3339":
+		layout = time.RFC3339
+	case "rfc3339nano":
+		layout = time.RFC3339Nano
+	case "datetime":
+		layout = time.DateTime
+	case "dateonly":
+		layout = time.DateOnly
+	}
+
+	parsed, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Unix(0, 0)
+	}
+
+	return parsed
+}
@@ -0,0 +1,176 @@
+import { elem } from "./templating.js";
+import { autoScalingTextarea, newItemID, trashIconSvg } from "./todo.js";
+
+export default async function(element) {
+    const widget = element.closest(".widget");
+    const endpoint = `${pageData.baseURL}/api/widgets/${widget.dataset.widgetId}`;
+
+    let initial;
+
+    try {
+        const response = await fetch(`${endpoint}/items`);
+        if (!response.ok) throw new Error(`unexpected status code ${response.status}`);
+        initial = await response.json();
+    } catch (error) {
+        console.error("Failed to load list:", error);
+        element.classes("color-negative").text("Could not load list");
+        return;
+    }
+
+    const list = SharedList(endpoint, initial.items, initial.can_edit);
+    element.swapWith(list);
+
+    // also sends the items when reconnecting, so changes made while the
+    // connection was down don't get missed
+    const events = new EventSource(`${endpoint}/events`);
+    events.addEventListener("items", (event) => list.component.received(JSON.parse(event.data)));
+}
+
+function SharedList(endpoint, items, canEdit) {
+    let itemsContainer, input, clearButton;
+
+    // Changes are shown straight away, while they're being sent the items
+    // from the server would undo them so only the latest of those is kept
+    // until every change has been sent
+    let pendingRequests = 0;
+    let latestFromServer = null;
+
+    const render = () => {
+        itemsContainer.replaceChildren(...items.map(Item));
+        clearButton.showIf(canEdit && items.some(item => item.checked));
+    };
+
+    const received = (fromServer) => {
+        if (pendingRequests > 0) {
+            latestFromServer = fromServer;
+            return;
+        }
+
+        items = fromServer;
+        render();
+    };
+
+    const send = async (method, path, body) => {
+        pendingRequests++;
+
+        try {
+            const response = await fetch(`${endpoint}/${path}`, {
+                method,
+                body: body === undefined ? undefined : JSON.stringify(body),
+            });
+
+            if (!response.ok) throw new Error(`unexpected status code ${response.status}`);
+            latestFromServer = (await response.json()).items;
+        } catch (error) {
+            console.error("Failed to change list:", error);
+
+            // the items of the server undo the change that couldn't be made
+            try {
+                const response = await fetch(`${endpoint}/items`);
+                if (response.ok) latestFromServer = (await response.json()).items;
+            } catch {}
+        } finally {
+            pendingRequests--;
+
+            if (pendingRequests === 0 && latestFromServer !== null) {
+                items = latestFromServer;
+                latestFromServer = null;
+                render();
+            }
+        }
+    };
+
+    const add = (text) => {
+        const item = { id: newItemID(), text, checked: false };
+        items = [...items, item];
+        render();
+        send("POST", "items", { id: item.id, text });
+    };
+
+    const setChecked = (id, checked) => {
+        items = items.map(item => item.id === id ? { ...item, checked } : item);
+        render();
+        send("PATCH", `items/${encodeURIComponent(id)}`, { checked });
+    };
+
+    const remove = (id) => {
+        items = items.filter(item => item.id !== id);
+        render();
+        send("DELETE", `items/${encodeURIComponent(id)}`);
+    };
+
+    const clearChecked = () => {
+        items = items.filter(item => !item.checked);
+        render();
+        send("POST", "clear-checked");
+    };
+
+    const Item = (item) => elem().classes("todo-item", "flex", "gap-10", "items-center").append(
+        elem("input")
+            .classes("todo-item-checkbox", "shrink-0")
+            .attrs({ type: "checkbox" })
+            .tap(self => {
+                self.checked = item.checked;
+                self.disabled = !canEdit;
+            })
+            .on("change", (e) => setChecked(item.id, e.target.checked)),
+
+        elem()
+            .classes("todo-item-text", "shared-list-item-text", "grow", "min-width-0")
+            .text(item.text)
+            .tap(self => {
+                if (item.added_by) self.title = `Added by ${item.added_by}`;
+            }),
+
+        ...(canEdit ? [
+            elem("button")
+                .classes("todo-item-delete", "shrink-0")
+                .attrs({ "aria-label": "Remove item" })
+                .html(trashIconSvg)
+                .on("click", () => remove(item.id))
+        ] : [])
+    );
+
+    const handleInputKeyDown = (e) => {
+        switch (e.key) {
+            case "Enter":
+                e.preventDefault();
+                const value = e.target.value.trim();
+                if (value === "") return;
+                add(value);
+                input.component.setValue("");
+                break;
+            case "Escape":
+                e.target.blur();
+                break;
+        }
+    };
+
+    const container = elem().classes("shared-list").append(
+        ...(canEdit ? [
+            elem()
+                .classes("todo-input", "flex", "gap-10", "items-center", "margin-bottom-10")
+                .append(
+                    elem().classes("todo-plus-icon", "shrink-0"),
+                    input = autoScalingTextarea(textarea => textarea
+                        .on("keydown", handleInputKeyDown)
+                        .attrs({
+                            placeholder: "Add an item",
+                            spellcheck: "false"
+                        })
+                    ).classes("grow", "min-width-0")
+                )
+        ] : []),
+
+        itemsContainer = elem().classes("shared-list-items"),
+
+        clearButton = elem("button")
+            .classes("shared-list-clear", "size-h6", "margin-top-10")
+            .text("Remove checked items")
+            .on("click", clearChecked)
+    );
+
+    render();
+
+    return container.component({ received });
+}
@@ -1,8 +1,17 @@
 
 import { clamp } from "./utils.js";
 
-export function setupMasonries() {
-    const masonryContainers = document.getElementsByClassName("masonry");
+// Parses the value of --masonry-columns-at, which is a list of
+// "<min viewport width> <columns>" pairs sorted from widest to narrowest
+function parseColumnsAt(value) {
+    return value
+        .split(",")
+        .map((pair) => pair.trim().split(/\s+/).map(Number))
+        .filter((pair) => pair.length == 2 && !pair.some(isNaN));
+}
+
+export function setupMasonries(root = document) {
+    const masonryContainers = root.getElementsByClassName("masonry");
 
     for (let i = 0; i < masonryContainers.length; i++) {
         const container = masonryContainers[i];
@@ -12,14 +21,25 @@ export function setupMasonries() {
             maxColumns: container.dataset.maxColumns || 6,
         };
 
+        const columnsAt = parseColumnsAt(getComputedStyle(container).getPropertyValue("--masonry-columns-at"));
         const items = Array.from(container.children);
         let previousColumnsCount = 0;
 
+        const maxColumnsForViewport = function() {
+            for (let i = 0; i < columnsAt.length; i++) {
+                if (window.innerWidth >= columnsAt[i][0]) {
+                    return columnsAt[i][1];
+                }
+            }
+
+            return options.maxColumns;
+        };
+
         const render = function() {
             const columnsCount = clamp(
                 Math.floor(container.offsetWidth / options.minColumnWidth),
                 1,
-                Math.min(options.maxColumns, items.length)
+                Math.min(maxColumnsForViewport(), items.length)
             );
 
             if (columnsCount === previousColumnsCount) {
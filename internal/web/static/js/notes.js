@@ -0,0 +1,93 @@
+import { elem } from "./templating.js";
+import { autoScalingTextarea } from "./todo.js";
+
+export default function setupNotesEditor(widget) {
+    const button = widget.querySelector("[data-notes-edit]");
+    if (button === null) return;
+
+    const endpoint = `${pageData.baseURL}/api/widgets/${widget.dataset.widgetId}/source`;
+    const content = widget.querySelector(".notes-content");
+
+    button.addEventListener("click", async () => {
+        button.disabled = true;
+
+        let source;
+
+        try {
+            const response = await fetch(endpoint);
+            if (!response.ok) throw new Error(await response.text());
+            source = await response.text();
+        } catch (error) {
+            console.error("Failed to load notes:", error);
+            button.text("Could not load notes");
+            return;
+        }
+
+        let editor, saveButton;
+
+        const close = () => {
+            editor.remove();
+            content.show();
+            button.show();
+            button.disabled = false;
+        };
+
+        const save = async () => {
+            saveButton.disabled = true;
+
+            let html;
+
+            try {
+                const response = await fetch(endpoint, { method: "PUT", body: editor.component.value() });
+                if (!response.ok) throw new Error(await response.text());
+                html = await response.text();
+            } catch (error) {
+                console.error("Failed to save notes:", error);
+                saveButton.text("Could not save, try again");
+                saveButton.disabled = false;
+                return;
+            }
+
+            const container = document.createElement("div");
+            container.innerHTML = html;
+            const replacement = container.firstElementChild;
+
+            for (const className of ["widget-collapsed", "widget-hidden"]) {
+                if (widget.classList.contains(className)) {
+                    replacement.classList.add(className);
+                }
+            }
+
+            widget.replaceWith(replacement);
+            setupNotesEditor(replacement);
+        };
+
+        let textarea;
+        const input = autoScalingTextarea(t => textarea = t
+            .classes("notes-editor-textarea")
+            .attrs({ spellcheck: "false" })
+            .on("keydown", (e) => {
+                if (e.key === "Escape") {
+                    close();
+                } else if (e.key === "Enter" && (e.ctrlKey || e.metaKey)) {
+                    e.preventDefault();
+                    save();
+                }
+            })
+        );
+        input.component.setValue(source);
+
+        editor = elem().classes("notes-editor").append(
+            input,
+            elem().classes("flex", "gap-15", "margin-top-10", "size-h6").append(
+                saveButton = elem("button").classes("notes-edit-button").text("Save").on("click", save),
+                elem("button").classes("notes-edit-button").text("Cancel").on("click", close)
+            )
+        ).component({ value: () => textarea.value });
+
+        content.hide();
+        button.hide();
+        content.after(editor);
+        textarea.focus();
+    });
+}
@@ -12,8 +12,8 @@ async function fetchPageContent(pageData) {
     return content;
 }
 
-function setupCarousels() {
-    const carouselElements = document.getElementsByClassName("carousel-container");
+function setupCarousels(root = document) {
+    const carouselElements = root.getElementsByClassName("carousel-container");
 
     if (carouselElements.length == 0) {
         return;
@@ -248,8 +248,209 @@ function setupDynamicRelativeTime() {
     });
 }
 
-function setupGroups() {
-    const groups = document.getElementsByClassName("widget-type-group");
+async function loadLazyGroupTab(groupID, tab) {
+    const index = tab.dataset.lazyTab;
+    delete tab.dataset.lazyTab;
+
+    try {
+        const response = await fetch(`${pageData.baseURL}/api/widgets/${groupID}/tabs/${index}`);
+
+        if (!response.ok) {
+            throw new Error(`unexpected status code ${response.status}`);
+        }
+
+        tab.innerHTML = await response.text();
+    } catch (error) {
+        console.error("Failed to load group tab:", error);
+        tab.dataset.lazyTab = index;
+        return;
+    }
+
+    setupPopovers(tab);
+    setupCollapsibleLists(tab);
+    setupCollapsibleGrids(tab);
+    setupLazyImages(tab);
+    setupWidgetActions(tab);
+    updateRelativeTimeForElements(tab.querySelectorAll("[data-dynamic-relative-time]"));
+}
+
+async function refreshWidget(widget) {
+    if (widget.classList.contains("widget-refreshing")) {
+        return;
+    }
+
+    widget.classList.add("widget-refreshing");
+
+    let html;
+
+    try {
+        const response = await fetch(`${pageData.baseURL}/api/widgets/${widget.dataset.widgetId}/refresh`, {
+            method: "POST",
+        });
+
+        if (!response.ok) {
+            throw new Error(`unexpected status code ${response.status}`);
+        }
+
+        html = await response.text();
+    } catch (error) {
+        console.error("Failed to refresh widget:", error);
+        widget.classList.remove("widget-refreshing");
+        return;
+    }
+
+    const refreshed = replaceWidget(widget, html);
+
+    if (refreshed === null) {
+        widget.classList.remove("widget-refreshing");
+        return;
+    }
+
+    setupUpdatingWidgets(refreshed);
+}
+
+function replaceWidget(widget, html) {
+    const container = document.createElement("div");
+    container.innerHTML = html;
+    const replacement = container.firstElementChild;
+
+    if (replacement === null) {
+        return null;
+    }
+
+    for (const className of ["widget-collapsed", "widget-hidden"]) {
+        if (widget.classList.contains(className)) {
+            replacement.classList.add(className);
+        }
+    }
+
+    widget.replaceWith(replacement);
+
+    setupPopovers(replacement);
+    setupCarousels(replacement);
+    setupCollapsibleLists(replacement);
+    setupCollapsibleGrids(replacement);
+    setupGroups(replacement);
+    setupMasonries(replacement);
+    setupLazyImages(replacement);
+    setupWidgetRefreshButtons(replacement);
+    setupWidgetActions(replacement);
+    setupNotes(replacement);
+    setupExchangeRateConverters(replacement);
+    setupTables(replacement);
+    setupImageWidgets(replacement);
+    if (pageData.allowHidingWidgets) {
+        setupWidgetHideButtons(replacement);
+    }
+    updateRelativeTimeForElements(replacement.querySelectorAll("[data-dynamic-relative-time]"));
+
+    return replacement;
+}
+
+const UPDATING_WIDGET_POLL_INTERVAL = 2000;
+const UPDATING_WIDGET_MAX_POLLS = 30;
+
+// Widgets that were still updating in the background when the page got loaded
+// show their previous content, which gets replaced once they're done
+function setupUpdatingWidgets(root = document, polls = 0) {
+    const widgets = root.classList?.contains("widget-updating")
+        ? [root]
+        : root.querySelectorAll(".widget-updating");
+
+    for (let i = 0; i < widgets.length; i++) {
+        pollUpdatingWidget(widgets[i], polls);
+    }
+}
+
+function pollUpdatingWidget(widget, polls) {
+    if (polls >= UPDATING_WIDGET_MAX_POLLS) {
+        return;
+    }
+
+    setTimeout(async () => {
+        if (!widget.isConnected || widget.classList.contains("widget-refreshing")) {
+            return;
+        }
+
+        let html;
+
+        try {
+            const response = await fetch(`${pageData.baseURL}/api/widgets/${widget.dataset.widgetId}/content`);
+
+            if (!response.ok) {
+                throw new Error(`unexpected status code ${response.status}`);
+            }
+
+            html = await response.text();
+        } catch (error) {
+            console.error("Failed to load updated widget:", error);
+            return;
+        }
+
+        if (!widget.isConnected) {
+            return;
+        }
+
+        const replacement = replaceWidget(widget, html);
+
+        if (replacement !== null) {
+            setupUpdatingWidgets(replacement, polls + 1);
+        }
+    }, UPDATING_WIDGET_POLL_INTERVAL);
+}
+
+function setupWidgetRefreshButtons(root = document) {
+    const buttons = root.querySelectorAll("[data-widget-refresh]");
+
+    for (let i = 0; i < buttons.length; i++) {
+        const button = buttons[i];
+        const widget = button.closest(".widget");
+
+        button.addEventListener("click", () => refreshWidget(widget));
+    }
+}
+
+// Buttons of widgets that do something, such as toggling a light, get the
+// widget back with the result and replace it
+function setupWidgetActions(root = document) {
+    const buttons = root.querySelectorAll("[data-widget-action]");
+
+    for (let i = 0; i < buttons.length; i++) {
+        const button = buttons[i];
+        const widget = button.closest(".widget");
+
+        button.addEventListener("click", async () => {
+            button.disabled = true;
+
+            let html;
+
+            try {
+                const response = await fetch(`${pageData.baseURL}/api/widgets/${widget.dataset.widgetId}/${button.dataset.widgetAction}`, {
+                    method: "POST",
+                });
+
+                if (!response.ok) {
+                    throw new Error(`unexpected status code ${response.status}`);
+                }
+
+                html = await response.text();
+            } catch (error) {
+                console.error("Failed to perform widget action:", error);
+                button.disabled = false;
+                return;
+            }
+
+            replaceWidget(widget, html);
+        });
+    }
+}
+
+function setupGroups(root = document) {
+    const groups = Array.from(root.getElementsByClassName("widget-type-group"));
+
+    if (root.classList !== undefined && root.classList.contains("widget-type-group")) {
+        groups.unshift(root);
+    }
 
     if (groups.length == 0) {
         return;
@@ -258,9 +459,37 @@ function setupGroups() {
     for (let g = 0; g < groups.length; g++) {
         const group = groups[g];
         const titles = group.getElementsByClassName("widget-header")[0].children;
-        const tabs = group.getElementsByClassName("widget-group-contents")[0].children;
+        const tabsContainer = group.getElementsByClassName("widget-group-contents")[0];
+        const tabs = tabsContainer.children;
+        const groupID = tabsContainer.dataset.groupId;
         let current = 0;
 
+        const selectTab = (t) => {
+            for (let i = 0; i < titles.length; i++) {
+                titles[i].classList.remove("widget-group-title-current");
+                titles[i].setAttribute("aria-selected", "false");
+                tabs[i].classList.remove("widget-group-content-current");
+                tabs[i].setAttribute("aria-hidden", "true");
+            }
+
+            if (current < t) {
+                tabs[t].dataset.direction = "right";
+            } else {
+                tabs[t].dataset.direction = "left";
+            }
+
+            current = t;
+
+            titles[t].classList.add("widget-group-title-current");
+            titles[t].setAttribute("aria-selected", "true");
+            tabs[t].classList.add("widget-group-content-current");
+            tabs[t].setAttribute("aria-hidden", "false");
+
+            if (tabs[t].dataset.lazyTab !== undefined) {
+                loadLazyGroupTab(groupID, tabs[t]);
+            }
+        };
+
         for (let t = 0; t < titles.length; t++) {
             const title = titles[t];
 
@@ -284,32 +513,29 @@ function setupGroups() {
                     return;
                 }
 
-                for (let i = 0; i < titles.length; i++) {
-                    titles[i].classList.remove("widget-group-title-current");
-                    titles[i].setAttribute("aria-selected", "false");
-                    tabs[i].classList.remove("widget-group-content-current");
-                    tabs[i].setAttribute("aria-hidden", "true");
-                }
+                selectTab(t);
 
-                if (current < t) {
-                    tabs[t].dataset.direction = "right";
+                if (t == 0) {
+                    delete pageData.preferences.tabs[groupID];
                 } else {
-                    tabs[t].dataset.direction = "left";
+                    pageData.preferences.tabs[groupID] = t;
                 }
 
-                current = t;
-
-                title.classList.add("widget-group-title-current");
-                title.setAttribute("aria-selected", "true");
-                tabs[t].classList.add("widget-group-content-current");
-                tabs[t].setAttribute("aria-hidden", "false");
+                savePagePreferences();
             });
         }
+
+        const preferredTab = pageData.preferences.tabs[groupID];
+        if (preferredTab !== undefined && preferredTab < tabs.length) {
+            selectTab(preferredTab);
+            // shown right away rather than sliding in
+            delete tabs[preferredTab].dataset.direction;
+        }
     }
 }
 
-function setupLazyImages() {
-    const images = document.querySelectorAll("img[loading=lazy]");
+function setupLazyImages(root = document) {
+    const images = root.querySelectorAll("img[loading=lazy]");
 
     if (images.length == 0) {
         return;
@@ -383,8 +609,8 @@ function attachExpandToggleButton(collapsibleContainer) {
 };
 
 
-function setupCollapsibleLists() {
-    const collapsibleLists = document.querySelectorAll(".list.collapsible-container");
+function setupCollapsibleLists(root = document) {
+    const collapsibleLists = root.querySelectorAll(".list.collapsible-container");
 
     if (collapsibleLists.length == 0) {
         return;
@@ -417,8 +643,8 @@ function setupCollapsibleLists() {
     }
 }
 
-function setupCollapsibleGrids() {
-    const collapsibleGridElements = document.querySelectorAll(".cards-grid.collapsible-container");
+function setupCollapsibleGrids(root = document) {
+    const collapsibleGridElements = root.querySelectorAll(".cards-grid.collapsible-container");
 
     if (collapsibleGridElements.length == 0) {
         return;
@@ -493,8 +719,14 @@ function setupCollapsibleGrids() {
 }
 
 const contentReadyCallbacks = [];
+let contentReady = false;
 
 function afterContentReady(callback) {
+    if (contentReady) {
+        callback();
+        return;
+    }
+
     contentReadyCallbacks.push(callback);
 }
 
@@ -653,6 +885,147 @@ async function setupTodos() {
     }
 }
 
+async function setupSharedLists() {
+    const elems = Array.from(document.getElementsByClassName("shared-list"));
+    if (elems.length == 0) return;
+
+    const list = await import ('./list.js');
+
+    for (let i = 0; i < elems.length; i++) {
+        list.default(elems[i]);
+    }
+}
+
+async function setupNotes(root = document) {
+    const widgets = root.classList?.contains("widget-type-notes")
+        ? [root]
+        : root.querySelectorAll(".widget-type-notes");
+    if (widgets.length == 0) return;
+
+    const notes = await import ('./notes.js');
+
+    for (let i = 0; i < widgets.length; i++) {
+        notes.default(widgets[i]);
+    }
+}
+
+function setupExchangeRateConverters(root = document) {
+    const inputs = root.querySelectorAll("[data-exchange-rate-amount]");
+
+    for (let i = 0; i < inputs.length; i++) {
+        const input = inputs[i];
+        const rates = input.closest(".widget").querySelectorAll("[data-exchange-rate]");
+
+        input.addEventListener("input", () => {
+            const amount = input.value === "" ? 1 : Number(input.value);
+            if (!Number.isFinite(amount)) return;
+
+            for (let j = 0; j < rates.length; j++) {
+                const precision = Number(rates[j].dataset.exchangeRatePrecision);
+
+                rates[j].querySelector("[data-exchange-rate-value]").textContent = (amount * Number(rates[j].dataset.exchangeRate)).toLocaleString("en-US", {
+                    minimumFractionDigits: precision,
+                    maximumFractionDigits: precision,
+                });
+            }
+        });
+    }
+}
+
+// Images are loaded in the background before replacing the shown one so that
+// it doesn't flicker, refreshing stops once the widget has been replaced
+function setupImageWidgets(root = document) {
+    const containers = root.querySelectorAll("[data-image-widget]");
+
+    for (let i = 0; i < containers.length; i++) {
+        const container = containers[i];
+        const widget = container.closest(".widget");
+        const image = container.querySelector(".image-widget-image");
+        const error = container.querySelector(".image-widget-error");
+        const dialog = container.querySelector(".image-widget-dialog");
+        const interval = Number(container.dataset.imageRefreshInterval);
+        const source = `${pageData.baseURL}/api/widgets/${widget.dataset.widgetId}/image`;
+
+        const load = () => {
+            const next = new Image();
+
+            next.addEventListener("load", () => {
+                image.src = next.src;
+                image.hidden = false;
+                error.hidden = true;
+            });
+
+            next.addEventListener("error", () => {
+                if (image.hidden) error.hidden = false;
+            });
+
+            next.src = `${source}?t=${Date.now()}`;
+        };
+
+        const refresh = () => {
+            if (!container.isConnected) return;
+            if (document.visibilityState === "visible") load();
+            setTimeout(refresh, interval);
+        };
+
+        load();
+        if (interval > 0) setTimeout(refresh, interval);
+
+        image.addEventListener("click", () => {
+            dialog.querySelector("img").src = image.src;
+            dialog.showModal();
+        });
+
+        dialog.addEventListener("click", () => dialog.close());
+    }
+}
+
+// Sorts the rows of a table by the column whose header was clicked, clicking
+// the same header again reverses the order
+function setupTables(root = document) {
+    const buttons = root.querySelectorAll("[data-table-sort]");
+
+    for (let i = 0; i < buttons.length; i++) {
+        const button = buttons[i];
+        const column = Number(button.dataset.tableSort);
+        const numeric = button.dataset.tableNumeric !== undefined;
+        const table = button.closest("table");
+
+        button.addEventListener("click", () => {
+            const order = button.dataset.tableSortOrder === "asc" ? "desc" : "asc";
+            const tbody = table.tBodies[0];
+            const rows = Array.from(tbody.rows).filter((row) => row.cells.length > column);
+
+            const valueOf = (row) => row.cells[column].dataset.sortValue;
+            const numberOf = (row) => valueOf(row) === "" ? NaN : Number(valueOf(row));
+            const compare = (a, b) => numeric
+                ? numberOf(a) - numberOf(b)
+                : valueOf(a).localeCompare(valueOf(b), undefined, { numeric: true, sensitivity: "base" });
+
+            rows.sort((a, b) => {
+                // same as when sorted by the server, values that aren't numbers
+                // go last in either order
+                if (numeric && isNaN(numberOf(a)) !== isNaN(numberOf(b))) {
+                    return isNaN(numberOf(a)) ? 1 : -1;
+                }
+
+                if (numeric && isNaN(numberOf(a))) {
+                    return 0;
+                }
+
+                return order === "asc" ? compare(a, b) : compare(b, a);
+            });
+
+            for (const header of table.querySelectorAll("[data-table-sort]")) {
+                delete header.dataset.tableSortOrder;
+            }
+
+            button.dataset.tableSortOrder = order;
+            tbody.append(...rows);
+        });
+    }
+}
+
 function setupTruncatedElementTitles() {
     const elements = document.querySelectorAll(".text-truncate, .single-line-titles .title, .text-truncate-2-lines, .text-truncate-3-lines");
 
@@ -668,8 +1041,6 @@ function setupTruncatedElementTitles() {
 }
 
 async function changeTheme(key, onChanged) {
-    const themeStyleElem = find("#theme-style");
-
     const response = await fetch(`${pageData.baseURL}/api/set-theme/${key}`, {
         method: "POST",
     });
@@ -678,7 +1049,15 @@ async function changeTheme(key, onChanged) {
         alert("Failed to set theme: " + response.statusText);
         return;
     }
+
+    await applyTheme(key, response);
+    typeof onChanged == "function" && onChanged();
+}
+
+async function applyTheme(key, response) {
+    const themeStyleElem = find("#theme-style");
     const newThemeStyle = await response.text();
+    const scheme = response.headers.get("X-Scheme");
 
     const tempStyle = elem("style")
         .html("* { transition: none !important; }")
@@ -686,11 +1065,38 @@ async function changeTheme(key, onChanged) {
 
     themeStyleElem.html(newThemeStyle);
     document.documentElement.setAttribute("data-theme", key);
-    document.documentElement.setAttribute("data-scheme", response.headers.get("X-Scheme"));
-    typeof onChanged == "function" && onChanged();
+    pageData.followsSystemScheme = scheme == "system";
+    if (pageData.followsSystemScheme) {
+        followSystemScheme();
+    } else {
+        document.documentElement.setAttribute("data-scheme", scheme);
+    }
+    scheduleThemeSwitch(parseInt(response.headers.get("X-Theme-Switches-At")));
     setTimeout(() => { tempStyle.remove(); }, 10);
 }
 
+let themeSwitchTimeout;
+
+// Switches between the presets of theme.auto when the sun rises or sets,
+// trying again a minute later if the server can't be reached at the time
+function scheduleThemeSwitch(at) {
+    clearTimeout(themeSwitchTimeout);
+    if (!at) return;
+
+    themeSwitchTimeout = setTimeout(async () => {
+        const response = await fetch(`${pageData.baseURL}/api/set-theme/auto`, {
+            method: "POST",
+        }).catch(() => null);
+
+        if (response === null || response.status != 200) {
+            scheduleThemeSwitch(Date.now() + 60 * 1000);
+            return;
+        }
+
+        applyTheme("auto", response);
+    }, Math.max(0, at - Date.now()));
+}
+
 function initThemePicker() {
     const themeChoicesInMobileNav = find(".mobile-navigation .theme-choices");
     if (!themeChoicesInMobileNav) return;
@@ -743,8 +1149,156 @@ function initThemePicker() {
     })
 }
 
+// Columns of mobile-first pages are laid out side by side on small screens and
+// scrolled between, either by swiping or through the navigation at the bottom,
+// and tapping the header of a widget collapses it
+function setupMobileFirstLayout() {
+    if (find(".layout-mobile-first") === null) {
+        return;
+    }
+
+    const columnsContainer = find(".page-columns");
+    const columns = columnsContainer.children;
+    const inputs = Array.from(findAll(".mobile-navigation-input"));
+    const smallScreen = window.matchMedia("(max-width: 1190px)");
+
+    const scrollToColumn = (index, behavior) => {
+        columnsContainer.scrollTo({ left: columns[index].offsetLeft - columns[0].offsetLeft, behavior });
+    };
+
+    const currentInput = inputs.find((input) => input.checked);
+    if (currentInput !== undefined) {
+        scrollToColumn(parseInt(currentInput.value), "instant");
+    }
+
+    for (let i = 0; i < inputs.length; i++) {
+        inputs[i].addEventListener("change", () => scrollToColumn(i, "smooth"));
+    }
+
+    columnsContainer.addEventListener("scroll", throttledDebounce(() => {
+        const index = Math.round(columnsContainer.scrollLeft / columnsContainer.clientWidth);
+
+        if (inputs[index] !== undefined && !inputs[index].checked) {
+            inputs[index].checked = true;
+        }
+    }, 10, 50));
+
+    const collapsed = pageData.preferences.collapsed;
+    const widgets = findAll(".page-columns > .page-column > .widget");
+    for (let i = 0; i < widgets.length; i++) {
+        if (collapsed.includes(Number(widgets[i].dataset.widgetId))) {
+            widgets[i].classList.add("widget-collapsed");
+        }
+    }
+
+    columnsContainer.addEventListener("click", (event) => {
+        if (!smallScreen.matches || event.target.closest("a, button, [data-popover-type]") !== null) {
+            return;
+        }
+
+        const header = event.target.closest(".page-column > .widget > .widget-header");
+        if (header === null) {
+            return;
+        }
+
+        const widget = header.parentElement;
+        const id = Number(widget.dataset.widgetId);
+
+        if (widget.classList.toggle("widget-collapsed")) {
+            collapsed.push(id);
+        } else {
+            collapsed.splice(collapsed.indexOf(id), 1);
+        }
+
+        savePagePreferences();
+    });
+}
+
+// Widgets that are directly within the page can be hidden when the page allows
+// it, with a button at the end of the page for bringing them all back
+function setupHiddenWidgets() {
+    const hidden = pageData.preferences.hidden;
+    const widgets = findAll(".head-widgets > .widget, .page-column > .widget");
+
+    for (let i = 0; i < widgets.length; i++) {
+        if (hidden.includes(Number(widgets[i].dataset.widgetId))) {
+            widgets[i].classList.add("widget-hidden");
+        }
+    }
+
+    if (pageData.allowHidingWidgets) {
+        setupWidgetHideButtons();
+    }
+
+    updateShowHiddenWidgetsButton();
+}
+
+function setupWidgetHideButtons(root = document) {
+    const headers = root.classList?.contains("widget")
+        ? [root.querySelector(":scope > .widget-header")].filter((header) => header !== null)
+        : root.querySelectorAll(":is(.head-widgets, .page-column) > .widget > .widget-header");
+
+    for (let i = 0; i < headers.length; i++) {
+        const widget = headers[i].parentElement;
+        if (!widget.parentElement?.matches(".head-widgets, .page-column")) {
+            continue;
+        }
+
+        elem("button")
+            .classes("widget-hide-button")
+            .attrs({ title: "Hide", "aria-label": "Hide widget" })
+            .html(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 20 20" fill="currentColor"><path fill-rule="evenodd" d="M3.28 2.22a.75.75 0 0 0-1.06 1.06l14.5 14.5a.75.75 0 1 0 1.06-1.06l-1.745-1.745a10.029 10.029 0 0 0 3.3-4.38 1.651 1.651 0 0 0 0-1.185A10.004 10.004 0 0 0 9.999 3a9.956 9.956 0 0 0-4.744 1.194L3.28 2.22ZM7.752 6.69l1.092 1.092a2.5 2.5 0 0 1 3.374 3.373l1.091 1.092a4 4 0 0 0-5.557-5.557Z" clip-rule="evenodd" /><path d="m10.748 13.93 2.523 2.523a9.987 9.987 0 0 1-3.27.547c-4.258 0-7.894-2.66-9.337-6.41a1.651 1.651 0 0 1 0-1.186A10.007 10.007 0 0 1 2.839 6.02L6.07 9.252a4 4 0 0 0 4.678 4.678Z" /></svg>`)
+            .on("click", (event) => {
+                event.stopPropagation();
+                widget.classList.add("widget-hidden");
+                pageData.preferences.hidden.push(Number(widget.dataset.widgetId));
+                savePagePreferences();
+                updateShowHiddenWidgetsButton();
+            })
+            .appendTo(headers[i]);
+    }
+}
+
+function updateShowHiddenWidgetsButton() {
+    const count = findAll(".widget-hidden").length;
+    let button = find(".show-hidden-widgets-button");
+
+    if (count == 0) {
+        button?.remove();
+        return;
+    }
+
+    if (button === null) {
+        button = elem("button")
+            .classes("show-hidden-widgets-button")
+            .on("click", () => {
+                const widgets = findAll(".widget-hidden");
+                for (let i = 0; i < widgets.length; i++) {
+                    widgets[i].classList.remove("widget-hidden");
+                }
+
+                pageData.preferences.hidden = [];
+                savePagePreferences();
+                updateShowHiddenWidgetsButton();
+            })
+            .appendTo(find("#page-content"));
+    }
+
+    button.text(`Show ${count} hidden widget${count == 1 ? "" : "s"}`);
+}
+
+// Kept for the user when logged in or for the browser otherwise
+function savePagePreferences() {
+    fetch(`${pageData.baseURL}/api/pages/${pageData.slug}/preferences`, {
+        method: "PUT",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(pageData.preferences),
+    }).catch((error) => console.error("Failed to save preferences:", error));
+}
+
 async function setupPage() {
     initThemePicker();
+    scheduleThemeSwitch(pageData.themeSwitchesAt);
 
     const pageElement = document.getElementById("page");
     const pageContentElement = document.getElementById("page-content");
@@ -757,17 +1311,28 @@ async function setupPage() {
         setupClocks()
         await setupCalendars();
         await setupTodos();
+        await setupSharedLists();
+        await setupNotes();
         setupCarousels();
         setupSearchBoxes();
+        setupExchangeRateConverters();
+        setupTables();
+        setupImageWidgets();
         setupCollapsibleLists();
         setupCollapsibleGrids();
         setupGroups();
         setupMasonries();
         setupDynamicRelativeTime();
         setupLazyImages();
+        setupWidgetRefreshButtons();
+        setupWidgetActions();
+        setupUpdatingWidgets();
+        setupMobileFirstLayout();
+        setupHiddenWidgets();
     } finally {
         pageElement.classList.add("content-ready");
         pageElement.setAttribute("aria-busy", "false");
+        contentReady = true;
 
         for (let i = 0; i < contentReadyCallbacks.length; i++) {
             contentReadyCallbacks[i]();
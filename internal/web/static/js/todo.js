@@ -2,14 +2,36 @@ import { elem, fragment } from "./templating.js";
 import { animateReposition } from "./animations.js";
 import { clamp, Vec2, toggleableEvents, throttledDebounce } from "./utils.js";
 
-const trashIconSvg = `<svg fill="currentColor" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16">
+export const trashIconSvg = `<svg fill="currentColor" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16">
   <path fill-rule="evenodd" d="M5 3.25V4H2.75a.75.75 0 0 0 0 1.5h.3l.815 8.15A1.5 1.5 0 0 0 5.357 15h5.285a1.5 1.5 0 0 0 1.493-1.35l.815-8.15h.3a.75.75 0 0 0 0-1.5H11v-.75A2.25 2.25 0 0 0 8.75 1h-1.5A2.25 2.25 0 0 0 5 3.25Zm2.25-.75a.75.75 0 0 0-.75.75V4h3v-.75a.75.75 0 0 0-.75-.75h-1.5ZM6.05 6a.75.75 0 0 1 .787.713l.275 5.5a.75.75 0 0 1-1.498.075l-.275-5.5A.75.75 0 0 1 6.05 6Zm3.9 0a.75.75 0 0 1 .712.787l-.275 5.5a.75.75 0 0 1-1.498-.075l.275-5.5a.75.75 0 0 1 .786-.711Z" clip-rule="evenodd" />
 </svg>`;
 
-export default function(element) {
+export default async function(element) {
+    const id = element.dataset.todoId;
+
+    if (element.dataset.todoSynced === undefined) {
+        element.swapWith(
+            Todo(loadFromLocalStorage(id), (data) => saveToLocalStorage(id, data))
+        );
+        return;
+    }
+
+    const endpoint = `${pageData.baseURL}/api/widgets/${element.closest(".widget").dataset.widgetId}/items`;
+    let items;
+
+    try {
+        const response = await fetch(endpoint);
+        if (!response.ok) throw new Error(`unexpected status code ${response.status}`);
+        items = await response.json();
+    } catch (error) {
+        console.error("Failed to load tasks:", error);
+        element.classes("color-negative").text("Could not load tasks");
+        return;
+    }
+
     element.swapWith(
-        Todo(element.dataset.todoId)
-    )
+        Todo(items, serverSaver(endpoint))
+    );
 }
 
 function itemAnim(height, entrance = true) {
@@ -45,10 +67,43 @@ function saveToLocalStorage(id, data) {
     localStorage.setItem(`todo-${id}`, JSON.stringify(data));
 }
 
+// Saves are sent one at a time and the ones made while another is being
+// sent get replaced by the latest one, since each of them has every task
+function serverSaver(endpoint) {
+    let pending = null;
+    let sending = false;
+
+    return async (data) => {
+        pending = data;
+        if (sending) return;
+        sending = true;
+
+        while (pending !== null) {
+            const body = JSON.stringify(pending);
+            pending = null;
+
+            try {
+                const response = await fetch(endpoint, { method: "PUT", body });
+                if (!response.ok) throw new Error(`unexpected status code ${response.status}`);
+            } catch (error) {
+                console.error("Failed to save tasks:", error);
+            }
+        }
+
+        sending = false;
+    };
+}
+
+export function newItemID() {
+    const bytes = crypto.getRandomValues(new Uint8Array(16));
+    return Array.from(bytes, b => b.toString(16).padStart(2, "0")).join("");
+}
+
 function Item(unserialize = {}, onUpdate, onDelete, onEscape, onDragStart) {
     let item, input, inputArea;
 
     const serializeable = {
+        id: unserialize.id || newItemID(),
         text: unserialize.text || "",
         checked: unserialize.checked || false
     };
@@ -101,7 +156,7 @@ function Item(unserialize = {}, onUpdate, onDelete, onEscape, onDragStart) {
     });
 }
 
-function Todo(id) {
+function Todo(initialItems, save) {
     let items, input, inputArea, inputContainer, lastAddedItem;
     let queuedForRemoval = 0;
     let reorderable;
@@ -116,9 +171,7 @@ function Todo(id) {
     const saveItems = () => {
         if (isDragging) return;
 
-        saveToLocalStorage(
-            id, items.children.map(item => item.component.serialize())
-        );
+        save(items.children.map(item => item.component.serialize()));
     };
 
     const onItemRepositioned = () => saveItems();
@@ -182,7 +235,7 @@ function Todo(id) {
     items = elem()
         .classes("todo-items")
         .append(
-            ...loadFromLocalStorage(id).map(data => newItem(data))
+            ...initialItems.map(data => newItem(data))
         );
 
     return fragment().append(
@@ -5,11 +5,52 @@ import (
 	"html/template"
 	"math"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
+var imageProxy atomic.Pointer[func(string) string]
+
+// Has the URLs of external images rewritten by the given function from then
+// on, nil stops rewriting them
+func SetImageProxy(proxy func(string) string) {
+	if proxy == nil {
+		imageProxy.Store(nil)
+		return
+	}
+
+	imageProxy.Store(&proxy)
+}
+
+// Returns the URL through which an external image should be loaded, which is
+// the URL itself unless the image proxy is enabled. The type of the value is
+// kept so that templates escape it the same way as before.
+func ProxiedImageURL(value any) any {
+	proxy := imageProxy.Load()
+	if proxy == nil {
+		return value
+	}
+
+	var rawURL string
+	switch value := value.(type) {
+	case string:
+		rawURL = value
+	case template.URL:
+		rawURL = string(value)
+	default:
+		return value
+	}
+
+	if !strings.HasPrefix(rawURL, "https://") && !strings.HasPrefix(rawURL, "http://") {
+		return value
+	}
+
+	return (*proxy)(rawURL)
+}
+
 var intl = message.NewPrinter(language.English)
 
 var GlobalTemplateFunctions = template.FuncMap{
@@ -34,6 +75,7 @@ var GlobalTemplateFunctions = template.FuncMap{
 		return intl.Sprintf("%."+strconv.Itoa(precision)+"f", price)
 	},
 	"dynamicRelativeTimeAttrs": dynamicRelativeTimeAttrs,
+	"proxiedImageURL":          ProxiedImageURL,
 	"formatServerMegabytes": func(mb uint64) template.HTML {
 		var value string
 		var label string
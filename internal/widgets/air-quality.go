@@ -0,0 +1,247 @@
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var airQualityWidgetTemplate = common.MustParseTemplate("air-quality.html", "widget-base.html")
+
+type airQualityWidget struct {
+	widgetBase   `yaml:",inline"`
+	Location     string `yaml:"location"`
+	ShowAreaName bool   `yaml:"show-area-name"`
+	HideLocation bool   `yaml:"hide-location"`
+	Index        string `yaml:"index"`
+	HidePollen   bool   `yaml:"hide-pollen"`
+
+	Place      *openMeteoPlaceResponseJson `yaml:"-"`
+	AirQuality *airQuality                 `yaml:"-"`
+}
+
+// Severity levels go from 0 for good to 5 for the worst, each of them has its
+// own color
+type airQualityReading struct {
+	Name     string
+	Value    float64
+	Severity int
+	Label    string
+}
+
+type airQuality struct {
+	Index      airQualityReading
+	Pollutants []airQualityReading
+	// Only available in Europe and during the season of each plant
+	Pollen []airQualityReading
+}
+
+func (widget *airQualityWidget) Initialize() error {
+	widget.withTitle("Air Quality").withCacheOnTheHour()
+
+	if widget.Location == "" {
+		return errors.New("location is required")
+	}
+
+	if widget.Index == "" {
+		widget.Index = "european"
+	} else if widget.Index != "european" && widget.Index != "us" {
+		return errors.New("index must be either european or us")
+	}
+
+	return nil
+}
+
+func (widget *airQualityWidget) Update(ctx context.Context) {
+	if widget.Place == nil {
+		place, err := fetchOpenMeteoPlaceFromName(widget.httpClient(false), widget.Location)
+		if err != nil {
+			widget.withError(err).scheduleEarlyUpdate()
+			return
+		}
+
+		widget.Place = place
+	}
+
+	airQuality, err := widget.fetchAirQuality(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.AirQuality = airQuality
+}
+
+func (widget *airQualityWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, airQualityWidgetTemplate)
+}
+
+type openMeteoAirQualityResponseJson struct {
+	// Values are null where the model doesn't cover the place
+	Current struct {
+		EuropeanAQI   *float64 `json:"european_aqi"`
+		USAQI         *float64 `json:"us_aqi"`
+		PM25          *float64 `json:"pm2_5"`
+		PM10          *float64 `json:"pm10"`
+		Ozone         *float64 `json:"ozone"`
+		AlderPollen   *float64 `json:"alder_pollen"`
+		BirchPollen   *float64 `json:"birch_pollen"`
+		GrassPollen   *float64 `json:"grass_pollen"`
+		MugwortPollen *float64 `json:"mugwort_pollen"`
+		OlivePollen   *float64 `json:"olive_pollen"`
+		RagweedPollen *float64 `json:"ragweed_pollen"`
+	} `json:"current"`
+}
+
+func (widget *airQualityWidget) fetchAirQuality(ctx context.Context) (*airQuality, error) {
+	query := url.Values{}
+	query.Add("latitude", fmt.Sprintf("%f", widget.Place.Latitude))
+	query.Add("longitude", fmt.Sprintf("%f", widget.Place.Longitude))
+	query.Add("timezone", widget.Place.Timezone)
+	query.Add("current", "european_aqi,us_aqi,pm2_5,pm10,ozone,alder_pollen,birch_pollen,grass_pollen,mugwort_pollen,olive_pollen,ragweed_pollen")
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", "https://air-quality-api.open-meteo.com/v1/air-quality?"+query.Encode(), nil)
+	response, err := fetch.DecodeJSON[openMeteoAirQualityResponseJson](widget.httpClient(false), request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	current := response.Current
+	result := &airQuality{}
+
+	if widget.Index == "us" {
+		if current.USAQI == nil {
+			return nil, fmt.Errorf("%w: no air quality data for this location", models.ErrNoContent)
+		}
+		result.Index = newAirQualityReading("US AQI", *current.USAQI, usAQILevels)
+	} else {
+		if current.EuropeanAQI == nil {
+			return nil, fmt.Errorf("%w: no air quality data for this location", models.ErrNoContent)
+		}
+		result.Index = newAirQualityReading("European AQI", *current.EuropeanAQI, europeanAQILevels)
+	}
+
+	for _, pollutant := range []struct {
+		name   string
+		value  *float64
+		levels []airQualityLevel
+	}{
+		{"PM2.5", current.PM25, pm25Levels},
+		{"PM10", current.PM10, pm10Levels},
+		{"Ozone", current.Ozone, ozoneLevels},
+	} {
+		if pollutant.value != nil {
+			result.Pollutants = append(result.Pollutants, newAirQualityReading(pollutant.name, *pollutant.value, pollutant.levels))
+		}
+	}
+
+	if widget.HidePollen {
+		return result, nil
+	}
+
+	for _, pollen := range []struct {
+		name  string
+		value *float64
+	}{
+		{"Alder", current.AlderPollen},
+		{"Birch", current.BirchPollen},
+		{"Grass", current.GrassPollen},
+		{"Mugwort", current.MugwortPollen},
+		{"Olive", current.OlivePollen},
+		{"Ragweed", current.RagweedPollen},
+	} {
+		if pollen.value != nil && math.Round(*pollen.value) > 0 {
+			result.Pollen = append(result.Pollen, newAirQualityReading(pollen.name, *pollen.value, pollenLevels))
+		}
+	}
+
+	return result, nil
+}
+
+// Readings below upTo have the severity of the level
+type airQualityLevel struct {
+	upTo  float64
+	label string
+}
+
+var europeanAQILevels = []airQualityLevel{
+	{20, "Good"},
+	{40, "Fair"},
+	{60, "Moderate"},
+	{80, "Poor"},
+	{100, "Very Poor"},
+	{math.Inf(1), "Extremely Poor"},
+}
+
+var usAQILevels = []airQualityLevel{
+	{51, "Good"},
+	{101, "Moderate"},
+	{151, "Unhealthy for Sensitive Groups"},
+	{201, "Unhealthy"},
+	{301, "Very Unhealthy"},
+	{math.Inf(1), "Hazardous"},
+}
+
+// In μg/m³, from the bands of the European AQI
+var pm25Levels = []airQualityLevel{
+	{10, "Good"},
+	{20, "Fair"},
+	{25, "Moderate"},
+	{50, "Poor"},
+	{75, "Very Poor"},
+	{math.Inf(1), "Extremely Poor"},
+}
+
+var pm10Levels = []airQualityLevel{
+	{20, "Good"},
+	{40, "Fair"},
+	{50, "Moderate"},
+	{100, "Poor"},
+	{150, "Very Poor"},
+	{math.Inf(1), "Extremely Poor"},
+}
+
+var ozoneLevels = []airQualityLevel{
+	{50, "Good"},
+	{100, "Fair"},
+	{130, "Moderate"},
+	{240, "Poor"},
+	{380, "Very Poor"},
+	{math.Inf(1), "Extremely Poor"},
+}
+
+// In grains/m³, the same scale is used for every plant since it's roughly
+// when people with allergies start to notice it that matters
+var pollenLevels = []airQualityLevel{
+	{10, "Low"},
+	{30, "Moderate"},
+	{100, "High"},
+	{300, "Very High"},
+	{1000, "Severe"},
+	{math.Inf(1), "Extreme"},
+}
+
+func newAirQualityReading(name string, value float64, levels []airQualityLevel) airQualityReading {
+	reading := airQualityReading{Name: name, Value: value}
+
+	for i, level := range levels {
+		if value < level.upTo {
+			reading.Severity = i
+			reading.Label = level.label
+			break
+		}
+	}
+
+	return reading
+}
+
+func (reading airQualityReading) FormattedValue() string {
+	return fmt.Sprintf("%.0f", reading.Value)
+}
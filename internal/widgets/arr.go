@@ -0,0 +1,385 @@
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var arrWidgetTemplate = common.MustParseTemplate("arr.html", "widget-base.html")
+
+type arrService struct {
+	name       string
+	apiVersion string
+	// query parameters that get the titles of what's in the calendar and queue
+	// included with the response instead of only their IDs
+	calendarIncludes string
+	queueIncludes    string
+}
+
+// Sonarr, Radarr and Lidarr share most of their API, so the same widget is used
+// for all of them depending on its type
+var arrServices = map[string]arrService{
+	"sonarr": {
+		name:             "Sonarr",
+		apiVersion:       "v3",
+		calendarIncludes: "includeSeries=true",
+		queueIncludes:    "includeSeries=true&includeEpisode=true",
+	},
+	"radarr": {
+		name:          "Radarr",
+		apiVersion:    "v3",
+		queueIncludes: "includeMovie=true",
+	},
+	"lidarr": {
+		name:             "Lidarr",
+		apiVersion:       "v1",
+		calendarIncludes: "includeArtist=true",
+		queueIncludes:    "includeArtist=true&includeAlbum=true",
+	},
+}
+
+const arrQueueLimit = 50
+
+type arrWidget struct {
+	widgetBase    `yaml:",inline"`
+	URL           string `yaml:"url"`
+	APIKey        string `yaml:"api-key"`
+	AllowInsecure bool   `yaml:"allow-insecure"`
+	Days          int    `yaml:"days"`
+	HideUpcoming  bool   `yaml:"hide-upcoming"`
+	HideQueue     bool   `yaml:"hide-queue"`
+	HideHealth    bool   `yaml:"hide-health"`
+	CollapseAfter int    `yaml:"collapse-after"`
+
+	service    arrService       `yaml:"-"`
+	Upcoming   []arrRelease     `yaml:"-"`
+	Queue      []arrQueueItem   `yaml:"-"`
+	QueueTotal int              `yaml:"-"`
+	Health     []arrHealthIssue `yaml:"-"`
+}
+
+type arrRelease struct {
+	Title      string
+	Subtitle   string
+	ReleasedAt time.Time
+	Downloaded bool
+}
+
+type arrQueueItem struct {
+	Title               string
+	Subtitle            string
+	Status              string
+	HasProblem          bool
+	Percent             int
+	EstimatedCompletion time.Time
+}
+
+type arrHealthIssue struct {
+	Message string
+	IsError bool
+	WikiURL string
+}
+
+func (widget *arrWidget) Initialize() error {
+	service, ok := arrServices[widget.Type]
+	if !ok {
+		return fmt.Errorf("unsupported service %s", widget.Type)
+	}
+	widget.service = service
+
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if widget.APIKey == "" {
+		return errors.New("api-key is required")
+	}
+
+	if widget.HideUpcoming && widget.HideQueue && widget.HideHealth {
+		return errors.New("at least one of upcoming releases, the queue or health has to be shown")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+	widget.withTitle(service.name).withTitleURL(widget.URL).withCacheDuration(5 * time.Minute)
+
+	if widget.Days <= 0 {
+		widget.Days = 7
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *arrWidget) Update(ctx context.Context) {
+	client := widget.httpClient(widget.AllowInsecure)
+	var requested int
+	var failed []string
+	var lastErr error
+
+	if !widget.HideHealth {
+		requested++
+		health, err := widget.fetchHealth(ctx, client)
+		if err != nil {
+			failed, lastErr = append(failed, "health"), err
+		} else {
+			widget.Health = health
+		}
+	}
+
+	if !widget.HideQueue {
+		requested++
+		queue, total, err := widget.fetchQueue(ctx, client)
+		if err != nil {
+			failed, lastErr = append(failed, "queue"), err
+		} else {
+			widget.Queue, widget.QueueTotal = queue, total
+		}
+	}
+
+	if !widget.HideUpcoming {
+		requested++
+		upcoming, err := widget.fetchUpcoming(ctx, client)
+		if err != nil {
+			failed, lastErr = append(failed, "upcoming releases"), err
+		} else {
+			widget.Upcoming = upcoming
+		}
+	}
+
+	var err error
+	if len(failed) == requested {
+		err = lastErr
+	} else if len(failed) > 0 {
+		err = fmt.Errorf("%w: could not get the %s: %v", models.ErrPartialContent, strings.Join(failed, " and "), lastErr)
+	}
+
+	widget.canContinueUpdateAfterHandlingErr(err)
+}
+
+func (widget *arrWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, arrWidgetTemplate)
+}
+
+func (widget *arrWidget) newRequest(ctx context.Context, path string, query string) *http.Request {
+	requestURL := widget.URL + "/api/" + widget.service.apiVersion + path
+	if query != "" {
+		requestURL += "?" + query
+	}
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+	request.Header.Set("X-Api-Key", widget.APIKey)
+
+	return request
+}
+
+type arrHealthJson struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	WikiURL string `json:"wikiUrl"`
+}
+
+func (widget *arrWidget) fetchHealth(ctx context.Context, client fetch.Doer) ([]arrHealthIssue, error) {
+	response, err := fetch.DecodeJSON[[]arrHealthJson](client, widget.newRequest(ctx, "/health", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]arrHealthIssue, 0, len(response))
+	for _, check := range response {
+		if check.Type != "warning" && check.Type != "error" {
+			continue
+		}
+
+		issues = append(issues, arrHealthIssue{
+			Message: check.Message,
+			IsError: check.Type == "error",
+			WikiURL: check.WikiURL,
+		})
+	}
+
+	return issues, nil
+}
+
+type arrQueueJson struct {
+	TotalRecords int `json:"totalRecords"`
+	Records      []struct {
+		Title                   string     `json:"title"`
+		Status                  string     `json:"status"`
+		TrackedDownloadStatus   string     `json:"trackedDownloadStatus"`
+		Size                    float64    `json:"size"`
+		SizeLeft                float64    `json:"sizeleft"`
+		EstimatedCompletionTime *time.Time `json:"estimatedCompletionTime"`
+		Series                  *struct {
+			Title string `json:"title"`
+		} `json:"series"`
+		Episode *struct {
+			SeasonNumber  int    `json:"seasonNumber"`
+			EpisodeNumber int    `json:"episodeNumber"`
+			Title         string `json:"title"`
+		} `json:"episode"`
+		Movie *struct {
+			Title string `json:"title"`
+			Year  int    `json:"year"`
+		} `json:"movie"`
+		Artist *struct {
+			ArtistName string `json:"artistName"`
+		} `json:"artist"`
+		Album *struct {
+			Title string `json:"title"`
+		} `json:"album"`
+	} `json:"records"`
+}
+
+func (widget *arrWidget) fetchQueue(ctx context.Context, client fetch.Doer) ([]arrQueueItem, int, error) {
+	query := "page=1&pageSize=" + strconv.Itoa(arrQueueLimit) + "&" + widget.service.queueIncludes
+	response, err := fetch.DecodeJSON[arrQueueJson](client, widget.newRequest(ctx, "/queue", query))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	queue := make([]arrQueueItem, 0, len(response.Records))
+	for _, record := range response.Records {
+		item := arrQueueItem{
+			Title:      record.Title,
+			Status:     strings.ToLower(record.Status),
+			HasProblem: record.TrackedDownloadStatus == "warning" || record.TrackedDownloadStatus == "error",
+		}
+
+		switch {
+		case record.Series != nil:
+			item.Title = record.Series.Title
+			if record.Episode != nil {
+				item.Subtitle = arrEpisodeNumber(record.Episode.SeasonNumber, record.Episode.EpisodeNumber)
+			}
+		case record.Movie != nil:
+			item.Title = record.Movie.Title
+			if record.Movie.Year > 0 {
+				item.Subtitle = strconv.Itoa(record.Movie.Year)
+			}
+		case record.Album != nil:
+			item.Title = record.Album.Title
+			if record.Artist != nil {
+				item.Subtitle = record.Artist.ArtistName
+			}
+		}
+
+		if record.Size > 0 {
+			item.Percent = int((record.Size - record.SizeLeft) / record.Size * 100)
+		}
+
+		if record.EstimatedCompletionTime != nil && item.Status == "downloading" {
+			item.EstimatedCompletion = *record.EstimatedCompletionTime
+		}
+
+		queue = append(queue, item)
+	}
+
+	return queue, response.TotalRecords, nil
+}
+
+type arrCalendarJson struct {
+	Title   string `json:"title"`
+	HasFile bool   `json:"hasFile"`
+	// Sonarr
+	SeasonNumber  int       `json:"seasonNumber"`
+	EpisodeNumber int       `json:"episodeNumber"`
+	AirDateUTC    time.Time `json:"airDateUtc"`
+	Series        *struct {
+		Title string `json:"title"`
+	} `json:"series"`
+	// Radarr
+	Year            int        `json:"year"`
+	InCinemas       *time.Time `json:"inCinemas"`
+	DigitalRelease  *time.Time `json:"digitalRelease"`
+	PhysicalRelease *time.Time `json:"physicalRelease"`
+	// Lidarr
+	ReleaseDate time.Time `json:"releaseDate"`
+	Artist      *struct {
+		ArtistName string `json:"artistName"`
+	} `json:"artist"`
+}
+
+func (widget *arrWidget) fetchUpcoming(ctx context.Context, client fetch.Doer) ([]arrRelease, error) {
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	end := start.AddDate(0, 0, widget.Days+1)
+
+	query := url.Values{}
+	query.Set("start", start.UTC().Format(time.RFC3339))
+	query.Set("end", end.UTC().Format(time.RFC3339))
+	encoded := query.Encode()
+	if widget.service.calendarIncludes != "" {
+		encoded += "&" + widget.service.calendarIncludes
+	}
+
+	response, err := fetch.DecodeJSON[[]arrCalendarJson](client, widget.newRequest(ctx, "/calendar", encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make([]arrRelease, 0, len(response))
+	for i := range response {
+		item := &response[i]
+		release := arrRelease{Title: item.Title, Downloaded: item.HasFile}
+
+		switch {
+		case item.Series != nil:
+			release.Title = item.Series.Title
+			release.Subtitle = arrEpisodeNumber(item.SeasonNumber, item.EpisodeNumber) + " · " + item.Title
+			release.ReleasedAt = item.AirDateUTC
+		case item.Artist != nil:
+			release.Subtitle = item.Artist.ArtistName
+			release.ReleasedAt = item.ReleaseDate
+		default:
+			// movies have several releases, the one shown is the first that
+			// falls within the range of the calendar
+			for _, date := range []struct {
+				kind string
+				at   *time.Time
+			}{
+				{"In cinemas", item.InCinemas},
+				{"Digital release", item.DigitalRelease},
+				{"Physical release", item.PhysicalRelease},
+			} {
+				if date.at == nil || date.at.Before(start) || !date.at.Before(end) {
+					continue
+				}
+				if release.ReleasedAt.IsZero() || date.at.Before(release.ReleasedAt) {
+					release.ReleasedAt = *date.at
+					release.Subtitle = date.kind
+				}
+			}
+		}
+
+		if release.ReleasedAt.IsZero() {
+			continue
+		}
+
+		releases = append(releases, release)
+	}
+
+	slices.SortStableFunc(releases, func(a, b arrRelease) int {
+		return a.ReleasedAt.Compare(b.ReleasedAt)
+	})
+
+	return releases, nil
+}
+
+func arrEpisodeNumber(season, episode int) string {
+	return fmt.Sprintf("S%02dE%02d", season, episode)
+}
@@ -0,0 +1,261 @@
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+)
+
+var astronomyWidgetTemplate = common.MustParseTemplate("astronomy.html", "widget-base.html")
+
+type astronomyWidget struct {
+	widgetBase `yaml:",inline"`
+	Latitude   *float64 `yaml:"latitude"`
+	Longitude  *float64 `yaml:"longitude"`
+	Timezone   string   `yaml:"timezone"`
+	HourFormat string   `yaml:"hour-format"`
+
+	location *time.Location `yaml:"-"`
+	Sun      astronomySun   `yaml:"-"`
+	Moon     astronomyMoon  `yaml:"-"`
+}
+
+type astronomySun struct {
+	// Empty during polar day and night
+	Sunrise           string
+	Sunset            string
+	MorningGoldenHour string
+	EveningGoldenHour string
+	DayLength         string
+	// Set when the sun doesn't rise or set at all
+	AlwaysUp   bool
+	AlwaysDown bool
+}
+
+type astronomyMoon struct {
+	Phase        string
+	Illumination int
+	NextFullMoon time.Time
+	NextNewMoon  time.Time
+	SvgLitPath   string
+	// The moon appears mirrored from the southern hemisphere
+	Mirrored bool
+}
+
+func (widget *astronomyWidget) Initialize() error {
+	widget.withTitle("Astronomy").withCacheOnTheHour()
+
+	if widget.Latitude == nil || widget.Longitude == nil {
+		return errors.New("latitude and longitude are required")
+	}
+
+	if *widget.Latitude < -90 || *widget.Latitude > 90 {
+		return errors.New("latitude must be between -90 and 90")
+	}
+
+	if *widget.Longitude < -180 || *widget.Longitude > 180 {
+		return errors.New("longitude must be between -180 and 180")
+	}
+
+	widget.location = time.Local
+	if widget.Timezone != "" {
+		location, err := time.LoadLocation(widget.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone '%s': %v", widget.Timezone, err)
+		}
+		widget.location = location
+	}
+
+	if widget.HourFormat == "" {
+		widget.HourFormat = "24h"
+	} else if widget.HourFormat != "12h" && widget.HourFormat != "24h" {
+		return errors.New("hour-format must be either 12h or 24h")
+	}
+
+	return nil
+}
+
+// Nothing gets fetched, everything is calculated from the coordinates
+func (widget *astronomyWidget) Update(ctx context.Context) {
+	now := time.Now().In(widget.location)
+
+	widget.Sun = widget.calculateSun(now)
+	widget.Moon = calculateMoon(now, *widget.Latitude < 0)
+
+	widget.canContinueUpdateAfterHandlingErr(nil)
+}
+
+func (widget *astronomyWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, astronomyWidgetTemplate)
+}
+
+func (widget *astronomyWidget) formatTime(t time.Time) string {
+	if widget.HourFormat == "12h" {
+		return t.In(widget.location).Format("3:04 PM")
+	}
+
+	return t.In(widget.location).Format("15:04")
+}
+
+const (
+	// Accounts for refraction and the size of the sun's disc
+	sunriseAltitude = -0.833
+	// Golden hour is when the sun is between these altitudes
+	goldenHourLowAltitude  = -4
+	goldenHourHighAltitude = 6
+)
+
+func (widget *astronomyWidget) calculateSun(now time.Time) astronomySun {
+	latitude, longitude := *widget.Latitude, *widget.Longitude
+	var sun astronomySun
+
+	sunrise, sunset, ok := sunTimesAtAltitude(now, latitude, longitude, sunriseAltitude)
+	if !ok {
+		sun.AlwaysUp = sunAltitudeAtNoon(now, latitude, longitude) > sunriseAltitude
+		sun.AlwaysDown = !sun.AlwaysUp
+		return sun
+	}
+
+	sun.Sunrise = widget.formatTime(sunrise)
+	sun.Sunset = widget.formatTime(sunset)
+
+	dayLength := sunset.Sub(sunrise).Round(time.Minute)
+	sun.DayLength = fmt.Sprintf("%dh %dm", int(dayLength.Hours()), int(dayLength.Minutes())%60)
+
+	goldenLowStart, goldenLowEnd, lowOk := sunTimesAtAltitude(now, latitude, longitude, goldenHourLowAltitude)
+	goldenHighStart, goldenHighEnd, highOk := sunTimesAtAltitude(now, latitude, longitude, goldenHourHighAltitude)
+
+	// near the poles the sun can stay within the golden hour altitudes all day
+	if lowOk && highOk {
+		sun.MorningGoldenHour = widget.formatTime(goldenLowStart) + " – " + widget.formatTime(goldenHighStart)
+		sun.EveningGoldenHour = widget.formatTime(goldenHighEnd) + " – " + widget.formatTime(goldenLowEnd)
+	}
+
+	return sun
+}
+
+func julianDay(t time.Time) float64 {
+	return float64(t.Unix())/86400 + 2440587.5
+}
+
+func timeFromJulianDay(jd float64) time.Time {
+	return time.Unix(int64(math.Round((jd-2440587.5)*86400)), 0)
+}
+
+func degreesToRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// Returns the julian day of the solar noon closest to the local noon of the
+// day and the declination of the sun at the time, based on
+// https://en.wikipedia.org/wiki/Sunrise_equation
+func solarNoon(day time.Time, longitude float64) (float64, float64) {
+	noon := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, day.Location())
+	n := math.Round(julianDay(noon) - 2451545.0 + longitude/360)
+	meanSolarTime := n - longitude/360
+
+	meanAnomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	m := degreesToRadians(meanAnomaly)
+	center := 1.9148*math.Sin(m) + 0.02*math.Sin(2*m) + 0.0003*math.Sin(3*m)
+	eclipticLongitude := degreesToRadians(math.Mod(meanAnomaly+center+180+102.9372, 360))
+
+	transit := 2451545.0 + meanSolarTime + 0.0053*math.Sin(m) - 0.0069*math.Sin(2*eclipticLongitude)
+	declination := math.Asin(math.Sin(eclipticLongitude) * math.Sin(degreesToRadians(23.4397)))
+
+	return transit, declination
+}
+
+// Returns when the sun passes the altitude in the morning and in the evening,
+// ok is false if it stays above or below it for the whole day
+func sunTimesAtAltitude(day time.Time, latitude, longitude, altitude float64) (time.Time, time.Time, bool) {
+	transit, declination := solarNoon(day, longitude)
+	phi := degreesToRadians(latitude)
+
+	cosHourAngle := (math.Sin(degreesToRadians(altitude)) - math.Sin(phi)*math.Sin(declination)) / (math.Cos(phi) * math.Cos(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+
+	return timeFromJulianDay(transit - hourAngle/360), timeFromJulianDay(transit + hourAngle/360), true
+}
+
+func sunAltitudeAtNoon(day time.Time, latitude, longitude float64) float64 {
+	_, declination := solarNoon(day, longitude)
+	return 90 - math.Abs(latitude-declination*180/math.Pi)
+}
+
+const (
+	synodicMonth = 29.530588853
+	// 2000-01-06 18:14 UTC
+	knownNewMoonJulianDay = 2451550.26
+)
+
+var moonPhaseNames = [8]string{
+	"New Moon",
+	"Waxing Crescent",
+	"First Quarter",
+	"Waxing Gibbous",
+	"Full Moon",
+	"Waning Gibbous",
+	"Last Quarter",
+	"Waning Crescent",
+}
+
+// Uses the average length of a lunar month, which puts the phases within a
+// day of when they actually happen
+func calculateMoon(now time.Time, southernHemisphere bool) astronomyMoon {
+	age := math.Mod(julianDay(now)-knownNewMoonJulianDay, synodicMonth)
+	if age < 0 {
+		age += synodicMonth
+	}
+	phase := age / synodicMonth
+
+	untilFullMoon := (0.5 - phase) * synodicMonth
+	if untilFullMoon < 0 {
+		untilFullMoon += synodicMonth
+	}
+
+	untilNewMoon := (1 - phase) * synodicMonth
+	day := float64(24 * time.Hour)
+
+	return astronomyMoon{
+		Phase:        moonPhaseNames[int(math.Floor(phase*8+0.5))%8],
+		Illumination: int(math.Round((1 - math.Cos(2*math.Pi*phase)) / 2 * 100)),
+		NextFullMoon: now.Add(time.Duration(untilFullMoon * day)),
+		NextNewMoon:  now.Add(time.Duration(untilNewMoon * day)),
+		SvgLitPath:   moonLitSvgPath(phase),
+		Mirrored:     southernHemisphere,
+	}
+}
+
+// The lit part of the moon as seen from the northern hemisphere, in a
+// 100x100 view box. It's made of half of the moon's outline on the lit side
+// and the terminator, which is half of an ellipse that gets narrower the
+// closer the moon is to being a quarter.
+func moonLitSvgPath(phase float64) string {
+	const radius = 45
+	terminatorRadius := radius * math.Abs(math.Cos(2*math.Pi*phase))
+	isCrescent := math.Cos(2*math.Pi*phase) > 0
+
+	var outlineSweep, terminatorSweep int
+	if phase < 0.5 {
+		// lit on the right, the terminator bulges right for crescents
+		outlineSweep = 1
+		terminatorSweep = common.Ternary(isCrescent, 0, 1)
+	} else {
+		outlineSweep = 0
+		terminatorSweep = common.Ternary(isCrescent, 1, 0)
+	}
+
+	return fmt.Sprintf(
+		"M 50,5 A %d %d 0 0 %d 50,95 A %.2f %d 0 0 %d 50,5 Z",
+		radius, radius, outlineSweep, terminatorRadius, radius, terminatorSweep,
+	)
+}
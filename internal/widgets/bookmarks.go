@@ -1,7 +1,10 @@
 package widgets
 
 import (
+	"context"
+	"fmt"
 	"html/template"
+	"time"
 
 	"github.com/limpdev/gander/internal/common"
 	"github.com/limpdev/gander/internal/models"
@@ -11,70 +14,158 @@ var bookmarksWidgetTemplate = common.MustParseTemplate("bookmarks.html", "widget
 
 type bookmarksWidget struct {
 	widgetBase `yaml:",inline"`
-	cachedHTML template.HTML `yaml:"-"`
-	Groups     []struct {
-		Title     string                `yaml:"title"`
-		Color     *models.HSLColorField `yaml:"color"`
-		SameTab   bool                  `yaml:"same-tab"`
-		HideArrow bool                  `yaml:"hide-arrow"`
-		Target    string                `yaml:"target"`
-		Links     []struct {
-			Title       string                 `yaml:"title"`
-			URL         string                 `yaml:"url"`
-			Description string                 `yaml:"description"`
-			Icon        models.CustomIconField `yaml:"icon"`
-			// we need a pointer to bool to know whether a value was provided,
-			// however there's no way to dereference a pointer in a template so
-			// {{ if not .SameTab }} would return true for any non-nil pointer
-			// which leaves us with no way of checking if the value is true or
-			// false, hence the duplicated fields below
-			SameTabRaw   *bool  `yaml:"same-tab"`
-			SameTab      bool   `yaml:"-"`
-			HideArrowRaw *bool  `yaml:"hide-arrow"`
-			HideArrow    bool   `yaml:"-"`
-			Target       string `yaml:"target"`
-		} `yaml:"links"`
-	} `yaml:"groups"`
+	cachedHTML template.HTML     `yaml:"-"`
+	Groups     []bookmarksGroup  `yaml:"groups"`
+	Discovery  *serviceDiscovery `yaml:"discovery"`
+
+	configuredGroups []bookmarksGroup `yaml:"-"`
+}
+
+type bookmarksGroup struct {
+	Title     string                `yaml:"title"`
+	Color     *models.HSLColorField `yaml:"color"`
+	SameTab   bool                  `yaml:"same-tab"`
+	HideArrow bool                  `yaml:"hide-arrow"`
+	Target    string                `yaml:"target"`
+	Links     []bookmarksLink       `yaml:"links"`
+}
+
+type bookmarksLink struct {
+	Title       string                 `yaml:"title"`
+	URL         string                 `yaml:"url"`
+	Description string                 `yaml:"description"`
+	Icon        models.CustomIconField `yaml:"icon"`
+	// we need a pointer to bool to know whether a value was provided,
+	// however there's no way to dereference a pointer in a template so
+	// {{ if not .SameTab }} would return true for any non-nil pointer
+	// which leaves us with no way of checking if the value is true or
+	// false, hence the duplicated fields below
+	SameTabRaw   *bool  `yaml:"same-tab"`
+	SameTab      bool   `yaml:"-"`
+	HideArrowRaw *bool  `yaml:"hide-arrow"`
+	HideArrow    bool   `yaml:"-"`
+	Target       string `yaml:"target"`
 }
 
 func (widget *bookmarksWidget) Initialize() error {
-	widget.withTitle("Bookmarks").withError(nil)
+	widget.withTitle("Bookmarks")
 
 	for g := range widget.Groups {
-		group := &widget.Groups[g]
-		for l := range group.Links {
-			link := &group.Links[l]
-			if link.SameTabRaw == nil {
-				link.SameTab = group.SameTab
-			} else {
-				link.SameTab = *link.SameTabRaw
-			}
+		widget.Groups[g].resolveLinkOptions()
+	}
 
-			if link.HideArrowRaw == nil {
-				link.HideArrow = group.HideArrow
-			} else {
-				link.HideArrow = *link.HideArrowRaw
-			}
+	if widget.Discovery == nil {
+		widget.withError(nil)
+		widget.cachedHTML = widget.renderTemplate(widget, bookmarksWidgetTemplate)
+		return nil
+	}
 
-			if link.Target == "" {
-				if group.Target != "" {
-					link.Target = group.Target
+	if err := widget.Discovery.initialize(); err != nil {
+		return err
+	}
+
+	widget.withCacheDuration(5 * time.Minute)
+	widget.configuredGroups = widget.Groups
+
+	return nil
+}
+
+func (group *bookmarksGroup) resolveLinkOptions() {
+	for l := range group.Links {
+		link := &group.Links[l]
+		if link.SameTabRaw == nil {
+			link.SameTab = group.SameTab
+		} else {
+			link.SameTab = *link.SameTabRaw
+		}
+
+		if link.HideArrowRaw == nil {
+			link.HideArrow = group.HideArrow
+		} else {
+			link.HideArrow = *link.HideArrowRaw
+		}
+
+		if link.Target == "" {
+			if group.Target != "" {
+				link.Target = group.Target
+			} else {
+				if link.SameTab {
+					link.Target = ""
 				} else {
-					if link.SameTab {
-						link.Target = ""
-					} else {
-						link.Target = "_blank"
-					}
+					link.Target = "_blank"
 				}
 			}
 		}
 	}
+}
 
-	widget.cachedHTML = widget.renderTemplate(widget, bookmarksWidgetTemplate)
+// Containers get discovered again as soon as any of them starts or stops,
+// Kubernetes objects only on schedule
+func (widget *bookmarksWidget) RequiresUpdate(now *time.Time) bool {
+	if widget.Discovery != nil && widget.Discovery.hasChanged() && widget.updateLock.TryRLock() {
+		widget.updateLock.RUnlock()
+		return true
+	}
 
-	return nil
+	return widget.widgetBase.RequiresUpdate(now)
+}
+
+// Discovered links are added to the group with the same title as their group
+// label, or to new groups after the ones from the config
+func (widget *bookmarksWidget) Update(ctx context.Context) {
+	services, err := widget.Discovery.services(ctx, true)
+	if err != nil && len(widget.configuredGroups) > 0 {
+		err = fmt.Errorf("%w: %v", models.ErrPartialContent, err)
+	} else if err != nil {
+		err = fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	groups := make([]bookmarksGroup, len(widget.configuredGroups))
+	groupIndex := make(map[string]int, len(groups))
+	for g := range widget.configuredGroups {
+		groups[g] = widget.configuredGroups[g]
+		groups[g].Links = append([]bookmarksLink(nil), groups[g].Links...)
+		groupIndex[groups[g].Title] = g
+	}
+
+	for _, service := range services {
+		g, exists := groupIndex[service.Group]
+		if !exists {
+			g = len(groups)
+			groupIndex[service.Group] = g
+			groups = append(groups, bookmarksGroup{Title: service.Group})
+		}
+
+		link := bookmarksLink{
+			Title:       service.Name,
+			URL:         service.URL,
+			Description: service.Description,
+			Icon:        service.Icon,
+		}
+
+		// otherwise the option of the group applies
+		if service.SameTab {
+			link.SameTabRaw = &service.SameTab
+		}
+
+		groups[g].Links = append(groups[g].Links, link)
+	}
+
+	for g := range groups {
+		groups[g].resolveLinkOptions()
+	}
+
+	widget.Groups = groups
 }
 
 func (widget *bookmarksWidget) Render() template.HTML {
-	return widget.cachedHTML
+	if widget.Discovery == nil {
+		return widget.cachedHTML
+	}
+
+	return widget.renderTemplate(widget, bookmarksWidgetTemplate)
 }
@@ -2,15 +2,25 @@ package widgets
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 )
 
 var changeDetectionWidgetTemplate = common.MustParseTemplate("change-detection.html", "widget-base.html")
@@ -23,6 +33,27 @@ type changeDetectionWidget struct {
 	Token            string                   `yaml:"token"`
 	Limit            int                      `yaml:"limit"`
 	CollapseAfter    int                      `yaml:"collapse-after"`
+	Pages            []changeDetectionPage    `yaml:"pages"`
+
+	useInstance bool                       `yaml:"-"`
+	pageStates  []changeDetectionPageState `yaml:"-"`
+}
+
+// Pages that get checked by the widget itself, without changedetection.io
+type changeDetectionPage struct {
+	URL      string `yaml:"url"`
+	Selector string `yaml:"selector"`
+	Title    string `yaml:"title"`
+
+	matcher  cascadia.Selector `yaml:"-"`
+	stateKey string            `yaml:"-"`
+}
+
+type changeDetectionPageState struct {
+	Hash        string    `json:"hash"`
+	LastChanged time.Time `json:"last_changed"`
+	Viewed      bool      `json:"viewed"`
+	loaded      bool
 }
 
 func (widget *changeDetectionWidget) Initialize() error {
@@ -36,26 +67,41 @@ func (widget *changeDetectionWidget) Initialize() error {
 		widget.CollapseAfter = 5
 	}
 
+	// only pages being set means changedetection.io isn't used
+	widget.useInstance = len(widget.Pages) == 0 || widget.InstanceURL != "" || widget.Token != "" || len(widget.WatchUUIDs) > 0
+
 	if widget.InstanceURL == "" {
 		widget.InstanceURL = "https://www.changedetection.io"
 	}
 
-	return nil
-}
+	for i := range widget.Pages {
+		page := &widget.Pages[i]
 
-func (widget *changeDetectionWidget) Update(ctx context.Context) {
-	if len(widget.WatchUUIDs) == 0 {
-		uuids, err := fetchWatchUUIDsFromChangeDetection(widget.InstanceURL, string(widget.Token))
+		if parsed, err := url.Parse(page.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("page url %q must be an http or https URL", page.URL)
+		}
 
-		if !widget.canContinueUpdateAfterHandlingErr(err) {
-			return
+		if page.Selector == "" {
+			page.Selector = "body"
 		}
 
-		widget.WatchUUIDs = uuids
+		matcher, err := cascadia.Compile(page.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector %q: %v", page.Selector, err)
+		}
+		page.matcher = matcher
+
+		id := sha256.Sum256([]byte(page.URL + "\n" + page.Selector))
+		page.stateKey = "change-detection-" + hex.EncodeToString(id[:8])
 	}
 
-	watches, err := fetchWatchesFromChangeDetection(widget.InstanceURL, widget.WatchUUIDs, string(widget.Token))
+	widget.pageStates = make([]changeDetectionPageState, len(widget.Pages))
+
+	return nil
+}
 
+func (widget *changeDetectionWidget) Update(ctx context.Context) {
+	watches, err := widget.fetchWatches(ctx)
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
 	}
@@ -71,12 +117,53 @@ func (widget *changeDetectionWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, changeDetectionWidgetTemplate)
 }
 
+// When watches from changedetection.io and pages are both used, either of
+// them failing still leaves the other to be shown
+func (widget *changeDetectionWidget) fetchWatches(ctx context.Context) (changeDetectionWatchList, error) {
+	var instanceWatches, pageWatches changeDetectionWatchList
+	var instanceErr, pagesErr error
+
+	if widget.useInstance {
+		instanceWatches, instanceErr = widget.fetchInstanceWatches()
+	}
+
+	if len(widget.Pages) > 0 {
+		pageWatches, pagesErr = widget.checkPages(ctx)
+	}
+
+	watches := append(instanceWatches, pageWatches...).sortByNewest()
+
+	err := errors.Join(instanceErr, pagesErr)
+	if err == nil || len(watches) == 0 || errors.Is(err, models.ErrPartialContent) {
+		return watches, err
+	}
+
+	return watches, fmt.Errorf("%w: %v", models.ErrPartialContent, err)
+}
+
+func (widget *changeDetectionWidget) fetchInstanceWatches() (changeDetectionWatchList, error) {
+	if len(widget.WatchUUIDs) == 0 {
+		uuids, err := fetchWatchUUIDsFromChangeDetection(widget.httpClient(false), widget.InstanceURL, string(widget.Token))
+		if err != nil {
+			return nil, err
+		}
+
+		widget.WatchUUIDs = uuids
+	}
+
+	return fetchWatchesFromChangeDetection(widget.httpClient(false), widget.InstanceURL, widget.WatchUUIDs, string(widget.Token))
+}
+
 type changeDetectionWatch struct {
 	Title        string
 	URL          string
 	LastChanged  time.Time
 	DiffURL      string
 	PreviousHash string
+	Viewed       bool
+	// The widget action which marks the watch as viewed, only pages checked
+	// by the widget have one
+	ViewedAction string
 }
 
 type changeDetectionWatchList []changeDetectionWatch
@@ -95,16 +182,18 @@ type changeDetectionResponseJson struct {
 	LastChanged  int64  `json:"last_changed"`
 	DateCreated  int64  `json:"date_created"`
 	PreviousHash string `json:"previous_md5"`
+	// Missing from older versions of changedetection.io
+	LastViewed *int64 `json:"last_viewed"`
 }
 
-func fetchWatchUUIDsFromChangeDetection(instanceURL string, token string) ([]string, error) {
+func fetchWatchUUIDsFromChangeDetection(client fetch.Doer, instanceURL string, token string) ([]string, error) {
 	request, _ := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/watch", instanceURL), nil)
 
 	if token != "" {
 		request.Header.Add("x-api-key", token)
 	}
 
-	uuidsMap, err := decodeJsonFromRequest[map[string]struct{}](defaultHTTPClient, request)
+	uuidsMap, err := fetch.DecodeJSON[map[string]struct{}](client, request)
 	if err != nil {
 		return nil, fmt.Errorf("could not fetch list of watch UUIDs: %v", err)
 	}
@@ -118,7 +207,7 @@ func fetchWatchUUIDsFromChangeDetection(instanceURL string, token string) ([]str
 	return uuids, nil
 }
 
-func fetchWatchesFromChangeDetection(instanceURL string, requestedWatchIDs []string, token string) (changeDetectionWatchList, error) {
+func fetchWatchesFromChangeDetection(client fetch.Doer, instanceURL string, requestedWatchIDs []string, token string) (changeDetectionWatchList, error) {
 	watches := make(changeDetectionWatchList, 0, len(requestedWatchIDs))
 
 	if len(requestedWatchIDs) == 0 {
@@ -137,7 +226,7 @@ func fetchWatchesFromChangeDetection(instanceURL string, requestedWatchIDs []str
 		requests[i] = request
 	}
 
-	task := decodeJsonFromRequestTask[changeDetectionResponseJson](defaultHTTPClient)
+	task := fetch.DecodeJSONTask[changeDetectionResponseJson](client)
 	job := newJob(task, requests).withWorkers(15)
 	responses, errs, err := workerPoolDo(job)
 	if err != nil {
@@ -158,6 +247,7 @@ func fetchWatchesFromChangeDetection(instanceURL string, requestedWatchIDs []str
 		watch := changeDetectionWatch{
 			URL:     watchJson.URL,
 			DiffURL: fmt.Sprintf("%s/diff/%s?from_version=%d", instanceURL, requestedWatchIDs[i], watchJson.LastChanged-1),
+			Viewed:  watchJson.LastViewed == nil || *watchJson.LastViewed >= watchJson.LastChanged,
 		}
 
 		if watchJson.LastChanged == 0 {
@@ -186,14 +276,189 @@ func fetchWatchesFromChangeDetection(instanceURL string, requestedWatchIDs []str
 	}
 
 	if len(watches) == 0 {
-		return nil, errNoContent
+		return nil, models.ErrNoContent
 	}
 
 	watches.sortByNewest()
 
 	if failed > 0 {
-		return watches, fmt.Errorf("%w: could not get %d watches", errPartialContent, failed)
+		return watches, fmt.Errorf("%w: could not get %d watches", models.ErrPartialContent, failed)
+	}
+
+	return watches, nil
+}
+
+const changeDetectionMaxPageSize = 5 << 20
+
+// Pages count as changed when the text within the elements matching their
+// selector is different from the last time they were checked. The first
+// check only records the text, so pages don't all show up as changed.
+func (widget *changeDetectionWidget) checkPages(ctx context.Context) (changeDetectionWatchList, error) {
+	client := widget.httpClient(false)
+	indexes := make([]int, len(widget.Pages))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	job := newJob(func(i int) (changeDetectionPageContent, error) {
+		return fetchChangeDetectionPage(ctx, client, &widget.Pages[i])
+	}, indexes)
+
+	contents, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	watches := make(changeDetectionWatchList, 0, len(widget.Pages))
+	var failed int
+
+	for i := range widget.Pages {
+		page := &widget.Pages[i]
+		state := widget.pageState(i)
+
+		if errs[i] != nil {
+			failed++
+			slog.Error("Failed to check page for changes", "url", page.URL, "error", errs[i])
+		} else if state.Hash != contents[i].hash {
+			state.Viewed = state.Hash == ""
+			state.Hash = contents[i].hash
+			state.LastChanged = time.Now()
+			widget.savePageState(i)
+		}
+
+		// pages that have never been fetched have nothing to show
+		if state.Hash == "" {
+			continue
+		}
+
+		title := page.Title
+		if title == "" {
+			title = common.Ternary(contents[i].title != "", contents[i].title, strings.TrimPrefix(strings.Trim(common.StripURLScheme(page.URL), "/"), "www."))
+		}
+
+		watches = append(watches, changeDetectionWatch{
+			Title:        title,
+			URL:          page.URL,
+			LastChanged:  state.LastChanged,
+			PreviousHash: state.Hash[:8],
+			Viewed:       state.Viewed,
+			ViewedAction: "viewed/" + strconv.Itoa(i),
+		})
+	}
+
+	if len(watches) == 0 && failed > 0 {
+		return nil, models.ErrNoContent
+	}
+
+	if failed > 0 {
+		return watches, fmt.Errorf("%w: could not check %d pages", models.ErrPartialContent, failed)
 	}
 
 	return watches, nil
 }
+
+// Loads the state of the page from the state store the first time it's
+// needed, so that changes get noticed across restarts
+func (widget *changeDetectionWidget) pageState(i int) *changeDetectionPageState {
+	state := &widget.pageStates[i]
+	if state.loaded {
+		return state
+	}
+
+	if widget.Providers != nil && widget.Providers.State != nil {
+		if err := widget.Providers.State.LoadWidgetState(widget.Pages[i].stateKey, state); err != nil {
+			slog.Error("Failed to load state of page", "url", widget.Pages[i].URL, "error", err)
+		}
+	}
+
+	state.loaded = true
+	return state
+}
+
+func (widget *changeDetectionWidget) savePageState(i int) {
+	if widget.Providers == nil || widget.Providers.State == nil {
+		return
+	}
+
+	if err := widget.Providers.State.SaveWidgetState(widget.Pages[i].stateKey, widget.pageStates[i]); err != nil {
+		slog.Error("Failed to save state of page", "url", widget.Pages[i].URL, "error", err)
+	}
+}
+
+func (widget *changeDetectionWidget) LocksOwnRequests() {}
+
+// Handles POST viewed/{index}, which marks the page as viewed
+func (widget *changeDetectionWidget) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	index, isViewed := strings.CutPrefix(r.PathValue("path"), "viewed/")
+	i, err := strconv.Atoi(index)
+	if !isViewed || err != nil || i < 0 || i >= len(widget.Pages) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	widget.updateLock.Lock()
+	widget.pageState(i).Viewed = true
+	widget.savePageState(i)
+
+	action := "viewed/" + index
+	for j := range widget.ChangeDetections {
+		if widget.ChangeDetections[j].ViewedAction == action {
+			widget.ChangeDetections[j].Viewed = true
+		}
+	}
+	widget.updateLock.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(widget.Render()))
+}
+
+type changeDetectionPageContent struct {
+	hash  string
+	title string
+}
+
+func fetchChangeDetectionPage(ctx context.Context, client *http.Client, page *changeDetectionPage) (changeDetectionPageContent, error) {
+	request, _ := http.NewRequestWithContext(ctx, "GET", page.URL, nil)
+	// some sites turn away clients that don't look like browsers
+	fetch.SetBrowserUserAgent(request)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return changeDetectionPageContent{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return changeDetectionPageContent{}, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	document, err := goquery.NewDocumentFromReader(io.LimitReader(response.Body, changeDetectionMaxPageSize))
+	if err != nil {
+		return changeDetectionPageContent{}, fmt.Errorf("parsing page: %v", err)
+	}
+
+	matches := document.FindMatcher(page.matcher)
+	if matches.Length() == 0 {
+		return changeDetectionPageContent{}, fmt.Errorf("selector %q didn't match anything", page.Selector)
+	}
+
+	// differences in whitespace usually come from how the page is generated
+	// rather than from its content changing
+	var text strings.Builder
+	matches.Each(func(_ int, selection *goquery.Selection) {
+		text.WriteString(strings.Join(strings.Fields(selection.Text()), " "))
+		text.WriteByte('\n')
+	})
+
+	hash := sha256.Sum256([]byte(text.String()))
+
+	return changeDetectionPageContent{
+		hash:  hex.EncodeToString(hash[:]),
+		title: strings.TrimSpace(document.Find("title").First().Text()),
+	}, nil
+}
@@ -0,0 +1,507 @@
+package widgets
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/chart"
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/tidwall/gjson"
+)
+
+var chartWidgetTemplate = common.MustParseTemplate("chart.html", "widget-base.html")
+
+const (
+	chartMaxResponseSize = 4 << 20
+	// The size of the view box of line and bar charts, which gets stretched
+	// to the width of the widget
+	chartViewBoxWidth  = 100
+	chartViewBoxHeight = 40
+)
+
+const (
+	chartFormatJSON       = "json"
+	chartFormatCSV        = "csv"
+	chartFormatPrometheus = "prometheus"
+)
+
+type chartWidget struct {
+	widgetBase    `yaml:",inline"`
+	Chart         string                      `yaml:"chart"`
+	URL           string                      `yaml:"url"`
+	AllowInsecure bool                        `yaml:"allow-insecure"`
+	Parameters    models.QueryParametersField `yaml:"parameters"`
+	Format        string                      `yaml:"format"`
+	Values        string                      `yaml:"values"`
+	Labels        string                      `yaml:"labels"`
+	Query         string                      `yaml:"query"`
+	Range         models.DurationField        `yaml:"range"`
+	Points        int                         `yaml:"points"`
+	Min           *float64                    `yaml:"min"`
+	Max           *float64                    `yaml:"max"`
+	Unit          string                      `yaml:"unit"`
+	Precision     *int                        `yaml:"precision"`
+	Thresholds    []chartThreshold            `yaml:"thresholds"`
+	DataSource    string                      `yaml:"data-source"`
+
+	Series *chartSeries `yaml:"-"`
+}
+
+type chartThreshold struct {
+	Value float64               `yaml:"value"`
+	Color *models.HSLColorField `yaml:"color"`
+	Label string                `yaml:"label"`
+}
+
+// Everything the template needs to draw the chart, the coordinates are those
+// of the view box while the positions of the labels are percentages of it
+type chartSeries struct {
+	Latest     string
+	Lowest     string
+	Highest    string
+	FirstLabel string
+	LastLabel  string
+	// The color of the highest threshold that the latest value has reached
+	LatestColor string
+
+	Ticks      []chartTick
+	Thresholds []chartThresholdLine
+
+	Points string
+	Area   string
+	Bars   []chart.Bar
+
+	GaugeTrack string
+	GaugeValue string
+	GaugeMin   string
+	GaugeMax   string
+}
+
+type chartTick struct {
+	Label string
+	Top   float64
+}
+
+type chartThresholdLine struct {
+	Label string
+	Color string
+	Y     float64
+	Top   float64
+}
+
+func (widget *chartWidget) Initialize() error {
+	widget.withTitle("Chart").withCacheDuration(5 * time.Minute)
+
+	if widget.Chart == "" {
+		widget.Chart = "line"
+	} else if widget.Chart != "line" && widget.Chart != "bar" && widget.Chart != "gauge" {
+		return errors.New("chart must be one of line, bar or gauge")
+	}
+
+	if widget.DataSource != "" && widget.URL != "" {
+		return errors.New("url and data-source can't be used together")
+	} else if widget.URL == "" && widget.DataSource == "" {
+		return errors.New("either url or data-source is required")
+	}
+
+	switch widget.Format {
+	case "", chartFormatJSON:
+		widget.Format = chartFormatJSON
+		if widget.Values == "" {
+			return errors.New("values is required when format is json")
+		}
+	case chartFormatCSV:
+		if widget.Values == "" {
+			return errors.New("values is required when format is csv")
+		}
+	case chartFormatPrometheus:
+		if widget.DataSource != "" {
+			return errors.New("data-source can't be used when format is prometheus")
+		}
+		if widget.Query == "" {
+			return errors.New("query is required when format is prometheus")
+		}
+		if widget.Labels != "" {
+			return errors.New("labels can't be used when format is prometheus, the times of the values are used instead")
+		}
+		if widget.Range <= 0 {
+			widget.Range = models.DurationField(24 * time.Hour)
+		}
+		widget.URL = strings.TrimRight(widget.URL, "/")
+	default:
+		return fmt.Errorf("format must be one of json, csv or prometheus, got %q", widget.Format)
+	}
+
+	if widget.Points <= 0 {
+		widget.Points = 60
+	}
+
+	if widget.Min != nil && widget.Max != nil && *widget.Min >= *widget.Max {
+		return errors.New("min must be lower than max")
+	}
+
+	if widget.Precision != nil && (*widget.Precision < 0 || *widget.Precision > 10) {
+		return errors.New("precision must be between 0 and 10")
+	}
+
+	slices.SortFunc(widget.Thresholds, func(a, b chartThreshold) int {
+		return cmp.Compare(a.Value, b.Value)
+	})
+
+	return nil
+}
+
+func (widget *chartWidget) Update(ctx context.Context) {
+	values, labels, err := widget.fetchValues(ctx)
+	if err == nil && len(values) == 0 {
+		err = fmt.Errorf("%w: there are no values to chart", models.ErrNoContent)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Series = widget.newSeries(values, labels)
+}
+
+func (widget *chartWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, chartWidgetTemplate)
+}
+
+func (widget *chartWidget) GetDataSourceName() string {
+	return widget.DataSource
+}
+
+func (widget *chartWidget) fetchValues(ctx context.Context) ([]float64, []string, error) {
+	if widget.Format == chartFormatPrometheus {
+		return widget.fetchPrometheusValues(ctx)
+	}
+
+	if widget.DataSource != "" {
+		body, err := dataSourceBody(ctx, widget.Providers, widget.DataSource)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+		}
+
+		return widget.parseValues(body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", widget.URL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	if len(widget.Parameters) > 0 {
+		request.URL.RawQuery = widget.Parameters.ToQueryString()
+	}
+
+	body, err := fetchChartResponse(widget.httpClient(widget.AllowInsecure), request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	return widget.parseValues(body)
+}
+
+func (widget *chartWidget) parseValues(body []byte) ([]float64, []string, error) {
+	if widget.Format == chartFormatCSV {
+		return widget.parseCSVValues(body)
+	}
+
+	return widget.parseJSONValues(body)
+}
+
+func fetchChartResponse(client *http.Client, request *http.Request) ([]byte, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, chartMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		truncatedBody, _ := common.LimitStringLength(string(body), 256)
+		return nil, fmt.Errorf("unexpected status code %d from %s, response: %s", response.StatusCode, request.URL, truncatedBody)
+	}
+
+	return body, nil
+}
+
+// The paths can point to an array of numbers or to a single one, which is
+// all that a gauge needs. Strings that hold numbers are accepted too since
+// plenty of APIs return numbers that way.
+func (widget *chartWidget) parseJSONValues(body []byte) ([]float64, []string, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, nil, fmt.Errorf("%w: response is not valid JSON", models.ErrNoContent)
+	}
+
+	result := gjson.GetBytes(body, widget.Values)
+	if !result.Exists() {
+		return nil, nil, fmt.Errorf("%w: values path %q matched nothing", models.ErrNoContent, widget.Values)
+	}
+
+	var values []float64
+	for _, item := range common.Ternary(result.IsArray(), result.Array(), []gjson.Result{result}) {
+		value, err := strconv.ParseFloat(strings.TrimSpace(item.String()), 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %q is not a number", models.ErrNoContent, item.String())
+		}
+		values = append(values, value)
+	}
+
+	var labels []string
+	if widget.Labels != "" {
+		for _, item := range gjson.GetBytes(body, widget.Labels).Array() {
+			labels = append(labels, item.String())
+		}
+	}
+
+	return values, labels, nil
+}
+
+// The first row holds the names of the columns, rows with a value that isn't
+// a number are skipped since exports commonly end with a row of totals
+func (widget *chartWidget) parseCSVValues(body []byte) ([]float64, []string, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: parsing CSV: %v", models.ErrNoContent, err)
+	}
+
+	if len(rows) < 2 {
+		return nil, nil, fmt.Errorf("%w: CSV has no rows besides the header", models.ErrNoContent)
+	}
+
+	valuesColumn := slices.Index(rows[0], widget.Values)
+	if valuesColumn == -1 {
+		return nil, nil, fmt.Errorf("%w: CSV has no column named %q", models.ErrNoContent, widget.Values)
+	}
+
+	labelsColumn := -1
+	if widget.Labels != "" {
+		if labelsColumn = slices.Index(rows[0], widget.Labels); labelsColumn == -1 {
+			return nil, nil, fmt.Errorf("%w: CSV has no column named %q", models.ErrNoContent, widget.Labels)
+		}
+	}
+
+	var values []float64
+	var labels []string
+	for _, row := range rows[1:] {
+		if valuesColumn >= len(row) {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(row[valuesColumn]), 64)
+		if err != nil {
+			continue
+		}
+
+		values = append(values, value)
+		if labelsColumn != -1 {
+			labels = append(labels, common.ItemAtIndexOrDefault(row, labelsColumn, ""))
+		}
+	}
+
+	return values, labels, nil
+}
+
+type prometheusRangeResponseJson struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		Result []struct {
+			// Pairs of a unix timestamp and the value as a string
+			Values [][2]any `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// Only the first series of the result is charted, queries that return more
+// than one should be aggregated with something like sum()
+func (widget *chartWidget) fetchPrometheusValues(ctx context.Context) ([]float64, []string, error) {
+	end := time.Now()
+	duration := time.Duration(widget.Range)
+	start := end.Add(-duration)
+	step := max(duration/time.Duration(widget.Points), time.Second)
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", widget.URL+"/api/v1/query_range", nil)
+	query := request.URL.Query()
+	for key, values := range widget.Parameters {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	query.Set("query", widget.Query)
+	query.Set("start", strconv.FormatInt(start.Unix(), 10))
+	query.Set("end", strconv.FormatInt(end.Unix(), 10))
+	query.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	request.URL.RawQuery = query.Encode()
+
+	response, err := fetch.DecodeJSON[prometheusRangeResponseJson](widget.httpClient(widget.AllowInsecure), request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	if response.Status != "success" {
+		return nil, nil, fmt.Errorf("%w: query failed: %s", models.ErrNoContent, response.Error)
+	}
+
+	if len(response.Data.Result) == 0 {
+		return nil, nil, fmt.Errorf("%w: query returned no series", models.ErrNoContent)
+	}
+
+	labelFormat := common.Ternary(duration >= 24*time.Hour, "Jan 2", "15:04")
+	series := response.Data.Result[0].Values
+	values := make([]float64, 0, len(series))
+	labels := make([]string, 0, len(series))
+
+	for _, pair := range series {
+		timestamp, _ := pair[0].(float64)
+		text, _ := pair[1].(string)
+
+		value, err := strconv.ParseFloat(text, 64)
+		// NaN and infinite values can't be drawn
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		values = append(values, value)
+		labels = append(labels, time.Unix(int64(timestamp), 0).Format(labelFormat))
+	}
+
+	return values, labels, nil
+}
+
+func (widget *chartWidget) newSeries(values []float64, labels []string) *chartSeries {
+	latest := values[len(values)-1]
+	series := &chartSeries{
+		Lowest:      widget.formatValue(slices.Min(values)),
+		Highest:     widget.formatValue(slices.Max(values)),
+		Latest:      widget.formatValue(latest),
+		LatestColor: widget.thresholdColor(latest),
+	}
+
+	if len(labels) == len(values) {
+		series.FirstLabel = labels[0]
+		series.LastLabel = labels[len(labels)-1]
+	}
+
+	if widget.Chart == "gauge" {
+		bounds := chart.Bounds{Min: derefOr(widget.Min, 0), Max: derefOr(widget.Max, 100)}
+
+		series.GaugeTrack = chart.GaugeArc(1)
+		series.GaugeValue = chart.GaugeArc(bounds.Fraction(latest))
+		series.GaugeMin = widget.formatValue(bounds.Min)
+		series.GaugeMax = widget.formatValue(bounds.Max)
+		return series
+	}
+
+	// thresholds stay in view even when the values are far from them
+	included := slices.Clone(values)
+	for _, threshold := range widget.Thresholds {
+		included = append(included, threshold.Value)
+	}
+
+	bounds, ticks := chart.NiceTicks(chart.BoundsOf(included, widget.Min, widget.Max), 4, widget.Min != nil, widget.Max != nil)
+	canvas := chart.Canvas{Width: chartViewBoxWidth, Height: chartViewBoxHeight, Bounds: bounds}
+	decimals := chart.Decimals((bounds.Max - bounds.Min) / float64(max(len(ticks)-1, 1)))
+
+	for _, tick := range ticks {
+		series.Ticks = append(series.Ticks, chartTick{
+			Label: widget.formatValueWithDecimals(tick, decimals),
+			Top:   canvas.Y(tick) / chartViewBoxHeight * 100,
+		})
+	}
+
+	for _, threshold := range widget.Thresholds {
+		if threshold.Value < bounds.Min || threshold.Value > bounds.Max {
+			continue
+		}
+
+		y := canvas.Y(threshold.Value)
+		series.Thresholds = append(series.Thresholds, chartThresholdLine{
+			Label: threshold.Label,
+			Color: thresholdCSSColor(threshold),
+			Y:     y,
+			Top:   y / chartViewBoxHeight * 100,
+		})
+	}
+
+	if widget.Chart == "bar" {
+		series.Bars = canvas.Bars(values, 0.2)
+	} else {
+		series.Points = canvas.Polyline(values)
+		series.Area = canvas.Area(values)
+	}
+
+	return series
+}
+
+func derefOr[T any](value *T, fallback T) T {
+	if value == nil {
+		return fallback
+	}
+
+	return *value
+}
+
+// Thresholds are sorted by their value, so the last one that's been reached
+// is the highest
+func (widget *chartWidget) thresholdColor(value float64) string {
+	color := ""
+	for _, threshold := range widget.Thresholds {
+		if value >= threshold.Value {
+			color = thresholdCSSColor(threshold)
+		}
+	}
+
+	return color
+}
+
+func thresholdCSSColor(threshold chartThreshold) string {
+	if threshold.Color == nil {
+		return "var(--color-negative)"
+	}
+
+	return threshold.Color.String()
+}
+
+// Without a precision, whole values get no decimals and the rest get as many
+// as it takes to show two significant digits of the ones below 10
+func (widget *chartWidget) formatValue(value float64) string {
+	decimals := 0
+	if widget.Precision == nil && value != math.Trunc(value) && math.Abs(value) < 10 {
+		decimals = min(chart.Decimals(math.Abs(value)/10), 6)
+	}
+
+	return widget.formatValueWithDecimals(value, decimals)
+}
+
+func (widget *chartWidget) formatValueWithDecimals(value float64, decimals int) string {
+	if widget.Precision != nil {
+		decimals = *widget.Precision
+	}
+
+	return strconv.FormatFloat(value, 'f', decimals, 64) + widget.Unit
+}
@@ -0,0 +1,316 @@
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/tidwall/gjson"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var commandWidgetTemplate = common.MustParseTemplate("command.html", "widget-base.html")
+
+const (
+	commandWidgetDefaultTimeout         = 10 * time.Second
+	commandWidgetDefaultMaxOutputLength = 10000
+)
+
+const (
+	commandFormatText = "text"
+	commandFormatJSON = "json"
+)
+
+type commandWidget struct {
+	widgetBase      `yaml:",inline"`
+	Command         string               `yaml:"command"`
+	SSH             *commandSSHConfig    `yaml:"ssh"`
+	Format          string               `yaml:"format"`
+	Template        string               `yaml:"template"`
+	Options         customAPIOptions     `yaml:"options"`
+	Timeout         models.DurationField `yaml:"timeout"`
+	MaxOutputLength int                  `yaml:"max-output-length"`
+
+	template     *template.Template
+	Output       string        `yaml:"-"`
+	Truncated    bool          `yaml:"-"`
+	CompiledHTML template.HTML `yaml:"-"`
+}
+
+type commandSSHConfig struct {
+	Host           string `yaml:"host"`
+	Port           uint16 `yaml:"port"`
+	User           string `yaml:"user"`
+	KeyFile        string `yaml:"key-file"`
+	KeyPassphrase  string `yaml:"key-passphrase"`
+	KnownHostsFile string `yaml:"known-hosts-file"`
+
+	config *ssh.ClientConfig
+}
+
+type commandTemplateData struct {
+	JSON    decoratedGJSONResult
+	Options customAPIOptions
+}
+
+func (widget *commandWidget) Initialize() error {
+	widget.withTitle("Command").withCacheDuration(5 * time.Minute)
+
+	if widget.Command == "" {
+		return errors.New("command is required")
+	}
+
+	// commands are run through a shell, so either the shell itself or exactly
+	// this command has to be allowed
+	if widget.SSH == nil && loader.CheckExecCommand("sh") != nil {
+		if err := loader.CheckExecCommand(widget.Command); err != nil {
+			return err
+		}
+	}
+
+	if widget.Format == "" {
+		widget.Format = commandFormatText
+	} else if widget.Format != commandFormatText && widget.Format != commandFormatJSON {
+		return fmt.Errorf("format must be either text or json, got %q", widget.Format)
+	}
+
+	if widget.Format == commandFormatJSON {
+		if widget.Template == "" {
+			return errors.New("template is required when format is json")
+		}
+
+		t, err := template.New("command").Funcs(customAPITemplateFuncs).Parse(widget.Template)
+		if err != nil {
+			return fmt.Errorf("parsing template: %v", err)
+		}
+
+		widget.template = t
+	} else if widget.Template != "" {
+		return errors.New("template can only be used when format is json")
+	}
+
+	if widget.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	} else if widget.Timeout == 0 {
+		widget.Timeout = models.DurationField(commandWidgetDefaultTimeout)
+	}
+
+	if widget.MaxOutputLength < 0 {
+		return errors.New("max-output-length can't be negative")
+	} else if widget.MaxOutputLength == 0 {
+		widget.MaxOutputLength = commandWidgetDefaultMaxOutputLength
+	}
+
+	if widget.SSH != nil {
+		if err := widget.SSH.initialize(time.Duration(widget.Timeout)); err != nil {
+			return fmt.Errorf("ssh: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (widget *commandWidget) Update(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(widget.Timeout))
+	defer cancel()
+
+	// a rune takes up at most 4 bytes, anything past that can't make it into
+	// the output and would only waste memory
+	stdout := &headBuffer{limit: widget.MaxOutputLength * 4}
+	stderr := &tailBuffer{limit: pluginWidgetMaxErrorOutputSize}
+
+	var err error
+	if widget.SSH != nil {
+		err = widget.SSH.run(ctx, widget.Command, stdout, stderr)
+	} else {
+		err = widget.runLocally(ctx, stdout, stderr)
+	}
+	widget.bytesFetched.Add(int64(len(stdout.data)))
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("command did not finish within %s", time.Duration(widget.Timeout))
+	} else if err != nil {
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			err = fmt.Errorf("%v: %s", err, output)
+		}
+	}
+
+	var output string
+	var truncated bool
+	var compiled template.HTML
+	if err == nil {
+		output, truncated = common.LimitStringLength(string(stdout.data), widget.MaxOutputLength)
+		truncated = truncated || stdout.discarded
+		compiled, err = widget.render(output, truncated)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Output = strings.TrimRight(output, "\n")
+	widget.Truncated = truncated
+	widget.CompiledHTML = compiled
+}
+
+func (widget *commandWidget) render(output string, truncated bool) (template.HTML, error) {
+	if widget.Format != commandFormatJSON {
+		return "", nil
+	}
+
+	if truncated {
+		return "", errors.New("output is longer than max-output-length")
+	}
+
+	if !gjson.Valid(output) {
+		return "", errors.New("output is not valid JSON")
+	}
+
+	rendered, err := common.ExecuteTemplateToString(widget.template, &commandTemplateData{
+		JSON:    decoratedGJSONResult{gjson.Parse(output)},
+		Options: widget.Options,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(rendered), nil
+}
+
+func (widget *commandWidget) runLocally(ctx context.Context, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", widget.Command)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = processEnvironment(nil)
+	isolatePluginProcess(cmd)
+	// children of the command can keep its output open after it gets killed
+	cmd.WaitDelay = time.Second
+
+	return cmd.Run()
+}
+
+func (widget *commandWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, commandWidgetTemplate)
+}
+
+func (config *commandSSHConfig) initialize(timeout time.Duration) error {
+	if config.Host == "" {
+		return errors.New("host is required")
+	}
+
+	if config.User == "" {
+		return errors.New("user is required")
+	}
+
+	if config.KeyFile == "" {
+		return errors.New("key-file is required")
+	}
+
+	if config.Port == 0 {
+		config.Port = 22
+	}
+
+	key, err := os.ReadFile(config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("reading key file: %v", err)
+	}
+
+	var signer ssh.Signer
+	if config.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(config.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing key file: %v", err)
+	}
+
+	if config.KnownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return errors.New("known-hosts-file is required when the home directory can't be determined")
+		}
+		config.KnownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	hostKeyCallback, err := knownhosts.New(config.KnownHostsFile)
+	if err != nil {
+		return fmt.Errorf("reading known hosts file: %v", err)
+	}
+
+	config.config = &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	}
+
+	return nil
+}
+
+func (config *commandSSHConfig) run(ctx context.Context, command string, stdout, stderr io.Writer) error {
+	address := net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port)))
+
+	conn, err := fetch.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+
+	// the handshake and the command itself don't take a context, closing the
+	// connection is what stops them once the context is done
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, address, config.config)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	client := ssh.NewClient(clientConn, channels, requests)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	return session.Run(command)
+}
+
+// Keeps only the first limit bytes written to it and discards the rest without
+// failing, so that the command can finish normally
+type headBuffer struct {
+	data      []byte
+	limit     int
+	discarded bool
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - len(b.data); remaining < len(p) {
+		b.data = append(b.data, p[:max(remaining, 0)]...)
+		b.discarded = true
+	} else {
+		b.data = append(b.data, p...)
+	}
+
+	return len(p), nil
+}
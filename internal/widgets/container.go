@@ -2,7 +2,6 @@ package widgets
 
 import (
 	"context"
-	"sync"
 	"time"
 
 	"github.com/limpdev/gander/internal/loader"
@@ -23,25 +22,12 @@ func (widget *containerWidgetBase) InitializeWidgets() error {
 	return nil
 }
 
-func (widget *containerWidgetBase) Update(ctx context.Context) {
-	var wg sync.WaitGroup
-	now := time.Now()
-
-	for w := range widget.Widgets {
-		widget := widget.Widgets[w]
-
-		if !widget.RequiresUpdate(&now) {
-			continue
-		}
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			widget.Update(ctx)
-		}()
-	}
+func (widget *containerWidgetBase) GetWidgets() models.Widgets {
+	return widget.Widgets
+}
 
-	wg.Wait()
+func (widget *containerWidgetBase) Update(ctx context.Context) {
+	models.UpdateOutdatedWidgets(ctx, widget.Widgets)
 }
 
 func (widget *containerWidgetBase) SetProviders(providers *models.WidgetProviders) {
@@ -11,14 +11,13 @@ import (
 	"log/slog"
 	"math"
 	"net/http"
-	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"github.com/limpdev/gander/internal/models"
 	"github.com/limpdev/gander/internal/web"
 	"github.com/tidwall/gjson"
@@ -30,7 +29,7 @@ var customAPIWidgetTemplate = common.MustParseTemplate("custom-api.html", "widge
 type CustomAPIRequest struct {
 	URL                string                      `yaml:"url"`
 	AllowInsecure      bool                        `yaml:"allow-insecure"`
-	Headers            map[string]string           `yaml:"headers"`
+	Headers            map[string]string           `yaml:"-"`
 	Parameters         models.QueryParametersField `yaml:"parameters"`
 	Method             string                      `yaml:"method"`
 	BodyType           string                      `yaml:"body-type"`
@@ -38,37 +37,88 @@ type CustomAPIRequest struct {
 	SkipJSONValidation bool                        `yaml:"skip-json-validation"`
 	bodyReader         io.ReadSeeker               `yaml:"-"`
 	httpRequest        *http.Request               `yaml:"-"`
+	client             fetch.Doer                  `yaml:"-"`
+	// Takes the place of the request when the widget uses a data source
+	dataSource *models.DataSource `yaml:"-"`
+}
+
+// The headers of the primary request are the ones of the widget, which aren't
+// sent with the subrequests since those usually go to other services
+type customAPISubrequest struct {
+	*CustomAPIRequest `yaml:",inline"`
+	Headers           map[string]string `yaml:"headers"`
 }
 
 type customAPIWidget struct {
 	widgetBase        `yaml:",inline"`
-	*CustomAPIRequest `yaml:",inline"`             // the primary request
-	Subrequests       map[string]*CustomAPIRequest `yaml:"subrequests"`
-	Options           customAPIOptions             `yaml:"options"`
-	Template          string                       `yaml:"template"`
-	Frameless         bool                         `yaml:"frameless"`
-	compiledTemplate  *template.Template           `yaml:"-"`
-	CompiledHTML      template.HTML                `yaml:"-"`
+	*CustomAPIRequest `yaml:",inline"`                // the primary request
+	Subrequests       map[string]*customAPISubrequest `yaml:"subrequests"`
+	Options           customAPIOptions                `yaml:"options"`
+	Template          string                          `yaml:"template"`
+	Frameless         bool                            `yaml:"frameless"`
+	AllowPrivate      bool                            `yaml:"allow-private-addresses"`
+	HTMLPolicy        string                          `yaml:"html-policy"`
+	DataSource        string                          `yaml:"data-source"`
+	subrequests       map[string]*CustomAPIRequest    `yaml:"-"`
+	templateClient    fetch.Doer                      `yaml:"-"`
+	compiledTemplate  *template.Template              `yaml:"-"`
+	CompiledHTML      template.HTML                   `yaml:"-"`
 }
 
 func (widget *customAPIWidget) Initialize() error {
 	widget.withTitle("Custom API").withCacheDuration(1 * time.Hour)
 
+	if widget.DataSource != "" {
+		if widget.CustomAPIRequest != nil && widget.URL != "" {
+			return errors.New("url and data-source can't be used together")
+		}
+		if widget.CustomAPIRequest == nil {
+			widget.CustomAPIRequest = &CustomAPIRequest{}
+		}
+	}
+
 	if err := widget.CustomAPIRequest.Initialize(); err != nil {
 		return fmt.Errorf("initializing primary request: %v", err)
 	}
 
-	for key := range widget.Subrequests {
-		if err := widget.Subrequests[key].Initialize(); err != nil {
+	widget.subrequests = make(map[string]*CustomAPIRequest, len(widget.Subrequests))
+	for key, subrequest := range widget.Subrequests {
+		var req *CustomAPIRequest
+		if subrequest != nil && subrequest.CustomAPIRequest != nil {
+			req = subrequest.CustomAPIRequest
+			req.Headers = subrequest.Headers
+		}
+
+		if err := req.Initialize(); err != nil {
 			return fmt.Errorf("initializing subrequest %q: %v", key, err)
 		}
+
+		widget.subrequests[key] = req
 	}
 
 	if widget.Template == "" {
 		return errors.New("template is required")
 	}
 
-	compiledTemplate, err := template.New("").Funcs(customAPITemplateFuncs).Parse(widget.Template)
+	if widget.HTMLPolicy == "" {
+		widget.HTMLPolicy = common.HTMLPolicyRelaxed
+	} else if err := common.ValidateHTMLPolicy(widget.HTMLPolicy); err != nil {
+		return err
+	}
+
+	compiledTemplate, err := template.New("").Funcs(customAPITemplateFuncs).Funcs(template.FuncMap{
+		"newRequest": func(url string) *CustomAPIRequest {
+			return &CustomAPIRequest{
+				URL:    url,
+				client: widget.templateClient,
+			}
+		},
+		// values from the API are escaped unless passed through safeHTML, which
+		// is where they get sanitized instead
+		"safeHTML": func(str string) template.HTML {
+			return common.SanitizeHTML(widget.HTMLPolicy, str)
+		},
+	}).Parse(widget.Template)
 	if err != nil {
 		return fmt.Errorf("parsing template: %w", err)
 	}
@@ -78,9 +128,39 @@ func (widget *customAPIWidget) Initialize() error {
 	return nil
 }
 
+func (widget *customAPIWidget) GetDataSourceName() string {
+	return widget.DataSource
+}
+
+// The clients and data sources depend on settings of the server, which are
+// only known after the widget gets initialized
+func (widget *customAPIWidget) setClients() {
+	if widget.DataSource != "" {
+		// references get checked when the config is loaded
+		widget.CustomAPIRequest.dataSource = widget.Providers.DataSources[widget.DataSource]
+	}
+
+	if widget.CustomAPIRequest != nil {
+		widget.CustomAPIRequest.client = widget.restrictToPublicAddresses(
+			widget.httpClient(widget.CustomAPIRequest.AllowInsecure), widget.AllowPrivate,
+		)
+	}
+
+	for _, req := range widget.subrequests {
+		if req != nil {
+			req.client = widget.restrictToPublicAddresses(widget.plainHTTPClient(req.AllowInsecure), widget.AllowPrivate)
+		}
+	}
+
+	// requests made from within the template get the same restrictions
+	widget.templateClient = widget.restrictToPublicAddresses(widget.plainHTTPClient(false), widget.AllowPrivate)
+}
+
 func (widget *customAPIWidget) Update(ctx context.Context) {
+	widget.setClients()
+
 	compiledHTML, err := fetchAndRenderCustomAPIRequest(
-		widget.CustomAPIRequest, widget.Subrequests, widget.Options, widget.compiledTemplate,
+		widget.CustomAPIRequest, widget.subrequests, widget.Options, widget.compiledTemplate,
 	)
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -232,6 +312,18 @@ func (data *customAPITemplateData) Subrequest(key string) *customAPIResponseData
 }
 
 func fetchCustomAPIResponse(ctx context.Context, req *CustomAPIRequest) (*customAPIResponseData, error) {
+	if req != nil && req.dataSource != nil {
+		body, err := req.dataSource.Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return &customAPIResponseData{
+			JSON:     decoratedGJSONResult{gjson.Parse(dataSourceString(body))},
+			Response: &http.Response{StatusCode: http.StatusOK, Header: http.Header{}},
+		}, nil
+	}
+
 	if req == nil || req.URL == "" {
 		return &customAPIResponseData{
 			JSON:     decoratedGJSONResult{gjson.Result{}},
@@ -243,7 +335,11 @@ func fetchCustomAPIResponse(ctx context.Context, req *CustomAPIRequest) (*custom
 		req.bodyReader.Seek(0, io.SeekStart)
 	}
 
-	client := common.Ternary(req.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
+	client := req.client
+	if client == nil {
+		client = common.Ternary[fetch.Doer](req.AllowInsecure, fetch.InsecureClient, fetch.Client)
+	}
+
 	resp, err := client.Do(req.httpRequest.WithContext(ctx))
 	if err != nil {
 		return nil, err
@@ -436,22 +532,6 @@ func customAPIDoMathOp[T int | float64](a, b T, op string) T {
 }
 
 var customAPITemplateFuncs = func() template.FuncMap {
-	var regexpCacheMu sync.Mutex
-	var regexpCache = make(map[string]*regexp.Regexp)
-
-	getCachedRegexp := func(pattern string) *regexp.Regexp {
-		regexpCacheMu.Lock()
-		defer regexpCacheMu.Unlock()
-
-		regex, exists := regexpCache[pattern]
-		if !exists {
-			regex = regexp.MustCompile(pattern)
-			regexpCache[pattern] = regex
-		}
-
-		return regex
-	}
-
 	doMathOpWithAny := func(a, b any, op string) any {
 		switch at := a.(type) {
 		case int:
@@ -502,78 +582,10 @@ var customAPITemplateFuncs = func() template.FuncMap {
 			}
 			return a % b
 		},
-		"now": func() time.Time {
-			return time.Now()
-		},
-		"offsetNow": func(offset string) time.Time {
-			d, err := time.ParseDuration(offset)
-			if err != nil {
-				return time.Now()
-			}
-			return time.Now().Add(d)
-		},
-		"duration": func(str string) time.Duration {
-			d, err := time.ParseDuration(str)
-			if err != nil {
-				return 0
-			}
-
-			return d
-		},
-		"parseTime": func(layout, value string) time.Time {
-			return customAPIFuncParseTimeInLocation(layout, value, time.UTC)
-		},
-		"formatTime": customAPIFuncFormatTime,
-		"parseLocalTime": func(layout, value string) time.Time {
-			return customAPIFuncParseTimeInLocation(layout, value, time.Local)
-		},
 		"toRelativeTime": common.DynamicRelativeTimeAttrs,
 		"parseRelativeTime": func(layout, value string) template.HTMLAttr {
 			// Shorthand to do both of the above with a single function call
-			return common.DynamicRelativeTimeAttrs(customAPIFuncParseTimeInLocation(layout, value, time.UTC))
-		},
-		"startOfDay": func(t time.Time) time.Time {
-			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
-		},
-		"endOfDay": func(t time.Time) time.Time {
-			return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, t.Location())
-		},
-		// The reason we flip the parameter order is so that you can chain multiple calls together like this:
-		// {{ .JSON.String "foo" | trimPrefix "bar" | doSomethingElse }}
-		// instead of doing this:
-		// {{ trimPrefix (.JSON.String "foo") "bar" | doSomethingElse }}
-		// since the piped value gets passed as the last argument to the function.
-		"trimPrefix": func(prefix, s string) string {
-			return strings.TrimPrefix(s, prefix)
-		},
-		"trimSuffix": func(suffix, s string) string {
-			return strings.TrimSuffix(s, suffix)
-		},
-		"trimSpace": strings.TrimSpace,
-		"replaceAll": func(old, new, s string) string {
-			return strings.ReplaceAll(s, old, new)
-		},
-		"replaceMatches": func(pattern, replacement, s string) string {
-			if s == "" {
-				return ""
-			}
-
-			return getCachedRegexp(pattern).ReplaceAllString(s, replacement)
-		},
-		"findMatch": func(pattern, s string) string {
-			if s == "" {
-				return ""
-			}
-
-			return getCachedRegexp(pattern).FindString(s)
-		},
-		"findSubmatch": func(pattern, s string) string {
-			if s == "" {
-				return ""
-			}
-
-			regex := getCachedRegexp(pattern)
-			return common.ItemAtIndexOrDefault(regex.FindStringSubmatch(s), 1, "")
+			return common.DynamicRelativeTimeAttrs(web.ParseTimeInLocation(layout, value, time.UTC))
 		},
 		"percentChange": common.PercentChange,
 		"sortByString": func(key, order string, results []decoratedGJSONResult) []decoratedGJSONResult {
@@ -611,8 +623,8 @@ var customAPITemplateFuncs = func() template.FuncMap {
 		},
 		"sortByTime": func(key, layout, order string, results []decoratedGJSONResult) []decoratedGJSONResult {
 			sort.Slice(results, func(a, b int) bool {
-				timeA := customAPIFuncParseTimeInLocation(layout, results[a].String(key), time.UTC)
-				timeB := customAPIFuncParseTimeInLocation(layout, results[b].String(key), time.UTC)
+				timeA := web.ParseTimeInLocation(layout, results[a].String(key), time.UTC)
+				timeB := web.ParseTimeInLocation(layout, results[b].String(key), time.UTC)
 
 				if order == "asc" {
 					return timeA.Before(timeB)
@@ -623,9 +635,6 @@ var customAPITemplateFuncs = func() template.FuncMap {
 
 			return results
 		},
-		"concat": func(items ...string) string {
-			return strings.Join(items, "")
-		},
 		"unique": func(key string, results []decoratedGJSONResult) []decoratedGJSONResult {
 			seen := make(map[string]struct{})
 			out := make([]decoratedGJSONResult, 0, len(results))
@@ -683,6 +692,13 @@ var customAPITemplateFuncs = func() template.FuncMap {
 		},
 	}
 
+	// values passed to safeHTML come from APIs, commands and webhooks rather
+	// than from the config, so they get sanitized rather than trusted as is.
+	// The custom API widget replaces it with one that uses its html-policy.
+	funcs["safeHTML"] = func(str string) template.HTML {
+		return common.SanitizeHTML(common.HTMLPolicyRelaxed, str)
+	}
+
 	for key, value := range web.GlobalTemplateFunctions {
 		if _, exists := funcs[key]; !exists {
 			funcs[key] = value
@@ -691,47 +707,3 @@ var customAPITemplateFuncs = func() template.FuncMap {
 
 	return funcs
 }()
-
-func customAPIFuncFormatTime(layout string, t time.Time) string {
-	switch strings.ToLower(layout) {
-	case "unix":
-		return strconv.FormatInt(t.Unix(), 10)
-	case "rfc3339":
-		layout = time.RFC3339
-	case "rfc3339nano":
-		layout = time.RFC3339Nano
-	case "datetime":
-		layout = time.DateTime
-	case "dateonly":
-		layout = time.DateOnly
-	}
-
-	return t.Format(layout)
-}
-
-func customAPIFuncParseTimeInLocation(layout, value string, loc *time.Location) time.Time {
-	switch strings.ToLower(layout) {
-	case "unix":
-		asInt, err := strconv.ParseInt(value, 10, 64)
-		if err != nil {
-			return time.Unix(0, 0)
-		}
-
-		return time.Unix(asInt, 0)
-	case "rfc3339":
-		layout = time.RFC3339
-	case "rfc3339nano":
-		layout = time.RFC3339Nano
-	case "datetime":
-		layout = time.DateTime
-	case "dateonly":
-		layout = time.DateOnly
-	}
-
-	parsed, err := time.ParseInLocation(layout, value, loc)
-	if err != nil {
-		return time.Unix(0, 0)
-	}
-
-	return parsed
-}
@@ -0,0 +1,142 @@
+package widgets
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/limpdev/gander/internal/models"
+)
+
+const (
+	discoverySourceDocker     = "docker"
+	discoverySourceKubernetes = "kubernetes"
+)
+
+// Labels of the containers and annotations of the Kubernetes objects that get
+// discovered, which also work with gander. in place of glance.
+const (
+	discoveryLabelURL         = "url"
+	discoveryLabelName        = "name"
+	discoveryLabelIcon        = "icon"
+	discoveryLabelDescription = "description"
+	discoveryLabelGroup       = "group"
+	discoveryLabelSameTab     = "same-tab"
+	discoveryLabelHide        = "hide"
+)
+
+// Fills in bookmarks and monitor widgets with the Docker containers or the
+// Kubernetes ingresses and routes that have a URL
+type serviceDiscovery struct {
+	Source     string   `yaml:"source"`
+	SockPath   string   `yaml:"sock-path"`
+	Kubeconfig string   `yaml:"kubeconfig"`
+	Context    string   `yaml:"context"`
+	Namespaces []string `yaml:"namespaces"`
+	Groups     []string `yaml:"groups"`
+
+	watcher     *dockerEventWatcher `yaml:"-"`
+	seenChanges atomic.Uint64       `yaml:"-"`
+}
+
+type discoveredService struct {
+	Name        string
+	URL         string
+	Icon        models.CustomIconField
+	Description string
+	Group       string
+	SameTab     bool
+}
+
+func (d *serviceDiscovery) initialize() error {
+	switch d.Source {
+	case "", discoverySourceDocker:
+		d.Source = discoverySourceDocker
+		if d.SockPath == "" {
+			d.SockPath = "/var/run/docker.sock"
+		}
+
+		d.watcher = watchDockerEvents(d.SockPath)
+	case discoverySourceKubernetes:
+		if d.Context != "" && d.Kubeconfig == "" {
+			d.Kubeconfig = defaultKubeconfigPath()
+		}
+	default:
+		return fmt.Errorf("unknown discovery source %q, must be one of %s, %s", d.Source, discoverySourceDocker, discoverySourceKubernetes)
+	}
+
+	return nil
+}
+
+// Whether containers were started or stopped since the services were last
+// fetched, in which case the widget updates without waiting for its schedule.
+// Kubernetes isn't watched, its objects only get looked up on schedule.
+func (d *serviceDiscovery) hasChanged() bool {
+	if d.watcher == nil {
+		return false
+	}
+
+	return d.watcher.changes.Load() != d.seenChanges.Load()
+}
+
+// Sorted by group and then by name, stopped containers are only included when
+// runningOnly is false
+func (d *serviceDiscovery) services(ctx context.Context, runningOnly bool) ([]discoveredService, error) {
+	var services []discoveredService
+	var err error
+
+	switch d.Source {
+	case discoverySourceKubernetes:
+		services, err = discoverKubernetesServices(ctx, d.Kubeconfig, d.Context, d.Namespaces)
+		if err != nil {
+			return nil, fmt.Errorf("discovering ingresses: %w", err)
+		}
+	default:
+		// changes that happen while fetching get picked up by the next update
+		d.seenChanges.Store(d.watcher.changes.Load())
+
+		services, err = discoverDockerServices(d.SockPath, runningOnly)
+		if err != nil {
+			return nil, fmt.Errorf("discovering containers: %w", err)
+		}
+	}
+
+	if len(d.Groups) > 0 {
+		services = slices.DeleteFunc(services, func(service discoveredService) bool {
+			return !slices.Contains(d.Groups, service.Group)
+		})
+	}
+
+	sort.SliceStable(services, func(a, b int) bool {
+		if services[a].Group != services[b].Group {
+			return services[a].Group < services[b].Group
+		}
+
+		return strings.ToLower(services[a].Name) < strings.ToLower(services[b].Name)
+	})
+
+	return services, nil
+}
+
+func discoveryLabel(labels map[string]string, name string) string {
+	if value := labels["glance."+name]; value != "" {
+		return value
+	}
+
+	return labels["gander."+name]
+}
+
+// Kubernetes objects are only discovered when they opt in by having at least
+// one of the labels as an annotation
+func hasDiscoveryLabels(labels map[string]string) bool {
+	for label := range labels {
+		if strings.HasPrefix(label, "glance.") || strings.HasPrefix(label, "gander.") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -16,6 +16,8 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 )
 
 var dnsStatsWidgetTemplate = common.MustParseTemplate("dns-stats.html", "widget-base.html")
@@ -63,6 +65,14 @@ func makeDNSWidgetTimeLabels(format string) [8]string {
 }
 
 func (widget *dnsStatsWidget) Initialize() error {
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if widget.Service == "" {
+		widget.Service = dnsServicePihole
+	}
+
 	titleURL := strings.TrimRight(widget.URL, "/")
 	switch widget.Service {
 	case dnsServicePihole, dnsServicePiholeV6:
@@ -89,19 +99,20 @@ func (widget *dnsStatsWidget) Initialize() error {
 func (widget *dnsStatsWidget) Update(ctx context.Context) {
 	var stats *dnsStats
 	var err error
+	client := widget.httpClient(widget.AllowInsecure)
 
 	switch widget.Service {
 	case dnsServiceAdguard:
-		stats, err = fetchAdguardStats(widget.URL, widget.AllowInsecure, widget.Username, widget.Password, widget.HideGraph)
+		stats, err = fetchAdguardStats(client, widget.URL, widget.Username, widget.Password, widget.HideGraph)
 	case dnsServicePihole:
-		stats, err = fetchPihole5Stats(widget.URL, widget.AllowInsecure, widget.Token, widget.HideGraph)
+		stats, err = fetchPihole5Stats(client, widget.URL, widget.Token, widget.HideGraph)
 	case dnsServiceTechnitium:
-		stats, err = fetchTechnitiumStats(widget.URL, widget.AllowInsecure, widget.Token, widget.HideGraph)
+		stats, err = fetchTechnitiumStats(client, widget.URL, widget.Token, widget.HideGraph)
 	case dnsServicePiholeV6:
 		var newSessionID string
 		stats, newSessionID, err = fetchPiholeStats(
+			client,
 			widget.URL,
-			widget.AllowInsecure,
 			widget.Password,
 			widget.piholeSessionID,
 			!widget.HideGraph,
@@ -125,30 +136,34 @@ func (widget *dnsStatsWidget) Update(ctx context.Context) {
 	widget.Stats = stats
 }
 
+func (widget *dnsStatsWidget) MarshalData() (any, error) {
+	return widget.Stats, nil
+}
+
 func (widget *dnsStatsWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, dnsStatsWidgetTemplate)
 }
 
 type dnsStats struct {
-	TotalQueries      int
-	BlockedQueries    int // we don't actually use this anywhere in templates, maybe remove it later?
-	BlockedPercent    int
-	ResponseTime      int
-	DomainsBlocked    int
-	Series            [dnsStatsBars]dnsStatsSeries
-	TopBlockedDomains []dnsStatsBlockedDomain
+	TotalQueries      int                          `json:"total_queries"`
+	BlockedQueries    int                          `json:"blocked_queries"` // we don't actually use this anywhere in templates, maybe remove it later?
+	BlockedPercent    int                          `json:"blocked_percent"`
+	ResponseTime      int                          `json:"response_time"`
+	DomainsBlocked    int                          `json:"domains_blocked"`
+	Series            [dnsStatsBars]dnsStatsSeries `json:"series"`
+	TopBlockedDomains []dnsStatsBlockedDomain      `json:"top_blocked_domains"`
 }
 
 type dnsStatsSeries struct {
-	Queries        int
-	Blocked        int
-	PercentTotal   int
-	PercentBlocked int
+	Queries        int `json:"queries"`
+	Blocked        int `json:"blocked"`
+	PercentTotal   int `json:"percent_total"`
+	PercentBlocked int `json:"percent_blocked"`
 }
 
 type dnsStatsBlockedDomain struct {
-	Domain         string
-	PercentBlocked int
+	Domain         string `json:"domain"`
+	PercentBlocked int    `json:"percent_blocked"`
 }
 
 type adguardStatsResponse struct {
@@ -160,7 +175,7 @@ type adguardStatsResponse struct {
 	TopBlockedDomains []map[string]int `json:"top_blocked_domains"`
 }
 
-func fetchAdguardStats(instanceURL string, allowInsecure bool, username, password string, noGraph bool) (*dnsStats, error) {
+func fetchAdguardStats(client fetch.Doer, instanceURL string, username, password string, noGraph bool) (*dnsStats, error) {
 	requestURL := strings.TrimRight(instanceURL, "/") + "/control/stats"
 
 	request, err := http.NewRequest("GET", requestURL, nil)
@@ -170,8 +185,7 @@ func fetchAdguardStats(instanceURL string, allowInsecure bool, username, passwor
 
 	request.SetBasicAuth(username, password)
 
-	var client = common.Ternary(allowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
-	responseJson, err := decodeJsonFromRequest[adguardStatsResponse](client, request)
+	responseJson, err := fetch.DecodeJSON[adguardStatsResponse](client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -313,7 +327,7 @@ func (p *pihole5TopBlockedDomains) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func fetchPihole5Stats(instanceURL string, allowInsecure bool, token string, noGraph bool) (*dnsStats, error) {
+func fetchPihole5Stats(client fetch.Doer, instanceURL string, token string, noGraph bool) (*dnsStats, error) {
 	if token == "" {
 		return nil, errors.New("missing API token")
 	}
@@ -326,8 +340,7 @@ func fetchPihole5Stats(instanceURL string, allowInsecure bool, token string, noG
 		return nil, err
 	}
 
-	var client = common.Ternary(allowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
-	responseJson, err := decodeJsonFromRequest[pihole5StatsResponse](client, request)
+	responseJson, err := fetch.DecodeJSON[pihole5StatsResponse](client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -412,15 +425,14 @@ func fetchPihole5Stats(instanceURL string, allowInsecure bool, token string, noG
 }
 
 func fetchPiholeStats(
+	client fetch.Doer,
 	instanceURL string,
-	allowInsecure bool,
 	password string,
 	sessionID string,
 	includeGraph bool,
 	includeTopDomains bool,
 ) (*dnsStats, string, error) {
 	instanceURL = strings.TrimRight(instanceURL, "/")
-	var client = common.Ternary(allowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
 
 	fetchNewSessionID := func() error {
 		newSessionID, err := fetchPiholeSessionID(instanceURL, client, password)
@@ -475,7 +487,7 @@ func fetchPiholeStats(
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		statsResponse, statsErr = decodeJsonFromRequest[statsResponseJson](client, statsRequest)
+		statsResponse, statsErr = fetch.DecodeJSON[statsResponseJson](client, statsRequest)
 		if statsErr != nil {
 			cancel()
 		}
@@ -499,7 +511,7 @@ func fetchPiholeStats(
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			seriesResponse, seriesErr = decodeJsonFromRequest[seriesResponseJson](client, seriesRequest)
+			seriesResponse, seriesErr = fetch.DecodeJSON[seriesResponseJson](client, seriesRequest)
 		}()
 	}
 
@@ -523,7 +535,7 @@ func fetchPiholeStats(
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			topDomainsResponse, topDomainsErr = decodeJsonFromRequest[topDomainsResponseJson](client, topDomainsRequest)
+			topDomainsResponse, topDomainsErr = fetch.DecodeJSON[topDomainsResponseJson](client, topDomainsRequest)
 		}()
 	}
 
@@ -614,10 +626,10 @@ func fetchPiholeStats(
 		stats.TopBlockedDomains = domains[:min(len(domains), 5)]
 	}
 
-	return stats, sessionID, common.Ternary(partialContent, errPartialContent, nil)
+	return stats, sessionID, common.Ternary(partialContent, models.ErrPartialContent, nil)
 }
 
-func fetchPiholeSessionID(instanceURL string, client *http.Client, password string) (string, error) {
+func fetchPiholeSessionID(instanceURL string, client fetch.Doer, password string) (string, error) {
 	requestBody := []byte(`{"password":"` + password + `"}`)
 
 	request, err := http.NewRequest("POST", instanceURL+"/api/auth", bytes.NewBuffer(requestBody))
@@ -665,7 +677,7 @@ func fetchPiholeSessionID(instanceURL string, client *http.Client, password stri
 	return jsonResponse.Session.SID, nil
 }
 
-func checkPiholeSessionIDIsValid(instanceURL string, client *http.Client, sessionID string) (bool, error) {
+func checkPiholeSessionIDIsValid(instanceURL string, client fetch.Doer, sessionID string) (bool, error) {
 	request, err := http.NewRequest("GET", instanceURL+"/api/auth", nil)
 	if err != nil {
 		return false, fmt.Errorf("creating session ID check request: %v", err)
@@ -706,7 +718,7 @@ type technitiumStatsResponse struct {
 	} `json:"response"`
 }
 
-func fetchTechnitiumStats(instanceUrl string, allowInsecure bool, token string, noGraph bool) (*dnsStats, error) {
+func fetchTechnitiumStats(client fetch.Doer, instanceUrl string, token string, noGraph bool) (*dnsStats, error) {
 	if token == "" {
 		return nil, errors.New("missing API token")
 	}
@@ -718,14 +730,7 @@ func fetchTechnitiumStats(instanceUrl string, allowInsecure bool, token string,
 		return nil, err
 	}
 
-	var client requestDoer
-	if !allowInsecure {
-		client = defaultHTTPClient
-	} else {
-		client = defaultInsecureHTTPClient
-	}
-
-	responseJson, err := decodeJsonFromRequest[technitiumStatsResponse](client, request)
+	responseJson, err := fetch.DecodeJSON[technitiumStatsResponse](client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"github.com/limpdev/gander/internal/models"
 )
 
@@ -281,20 +282,13 @@ func isDockerContainerHidden(container *dockerContainerJsonResponse, hideByDefau
 	return hideByDefault
 }
 
-func fetchDockerContainersFromSource(
-	source string,
-	category string,
-	runningOnly bool,
-	labelOverrides map[string]map[string]string,
-) ([]dockerContainerJsonResponse, error) {
-	var hostname string
-
-	var client *http.Client
+// The source is either the path of a socket or a tcp:// or http:// URL, the
+// returned hostname is where requests have to be sent to
+func newDockerClient(source string) (*http.Client, string, error) {
 	if strings.HasPrefix(source, "tcp://") || strings.HasPrefix(source, "http://") {
-		client = &http.Client{}
 		parsed, err := url.Parse(source)
 		if err != nil {
-			return nil, fmt.Errorf("parsing URL: %w", err)
+			return nil, "", fmt.Errorf("parsing URL: %w", err)
 		}
 
 		port := parsed.Port()
@@ -302,16 +296,33 @@ func fetchDockerContainersFromSource(
 			port = "80"
 		}
 
-		hostname = parsed.Hostname() + ":" + port
-	} else {
-		hostname = "docker"
-		client = &http.Client{
-			Transport: &http.Transport{
-				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-					return net.Dial("unix", source)
-				},
-			},
+		client := &http.Client{
+			Transport: &http.Transport{DialContext: fetch.DialContext},
 		}
+
+		return client, parsed.Hostname() + ":" + port, nil
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", source)
+			},
+		},
+	}
+
+	return client, "docker", nil
+}
+
+func fetchDockerContainersFromSource(
+	source string,
+	category string,
+	runningOnly bool,
+	labelOverrides map[string]map[string]string,
+) ([]dockerContainerJsonResponse, error) {
+	client, hostname, err := newDockerClient(source)
+	if err != nil {
+		return nil, err
 	}
 
 	fetchAll := common.Ternary(runningOnly, "false", "true")
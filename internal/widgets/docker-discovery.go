@@ -0,0 +1,214 @@
+package widgets
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var (
+	traefikRouterRuleLabelPattern = regexp.MustCompile(`^traefik\.http\.routers\.([^.]+)\.rule$`)
+	traefikHostRulePattern        = regexp.MustCompile("Host\\(`([^`]+)`")
+	traefikPathPrefixRulePattern  = regexp.MustCompile("PathPrefix\\(`([^`]+)`")
+)
+
+// The containers that have a URL, either from their labels or from the rule
+// of their Traefik router
+func discoverDockerServices(sockPath string, runningOnly bool) ([]discoveredService, error) {
+	containers, err := fetchDockerContainersFromSource(sockPath, "", runningOnly, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]discoveredService, 0, len(containers))
+	for i := range containers {
+		container := &containers[i]
+		labels := container.Labels
+
+		if common.StringToBool(discoveryLabel(labels, discoveryLabelHide)) {
+			continue
+		}
+
+		serviceURL := discoveryLabel(labels, discoveryLabelURL)
+		if serviceURL == "" {
+			serviceURL = traefikRouterURL(labels)
+		}
+
+		if serviceURL == "" {
+			continue
+		}
+
+		name := discoveryLabel(labels, discoveryLabelName)
+		if name == "" {
+			name = deriveDockerContainerName(container, true)
+		}
+
+		services = append(services, discoveredService{
+			Name:        name,
+			URL:         serviceURL,
+			Icon:        models.NewCustomIconField(discoveryLabel(labels, discoveryLabelIcon)),
+			Description: discoveryLabel(labels, discoveryLabelDescription),
+			Group:       discoveryLabel(labels, discoveryLabelGroup),
+			SameTab:     common.StringToBool(discoveryLabel(labels, discoveryLabelSameTab)),
+		})
+	}
+
+	return services, nil
+}
+
+// Built from the Host and PathPrefix of the first router with a Host rule,
+// routers with TLS enabled take precedence since they're what users end up on
+func traefikRouterURL(labels dockerContainerLabels) string {
+	if labels.getOrDefault("traefik.enable", "true") == "false" {
+		return ""
+	}
+
+	var routers []string
+	for label := range labels {
+		if matches := traefikRouterRuleLabelPattern.FindStringSubmatch(label); matches != nil {
+			routers = append(routers, matches[1])
+		}
+	}
+	sort.Strings(routers)
+
+	isSecure := func(router string) bool {
+		prefix := "traefik.http.routers." + router + "."
+		if common.StringToBool(labels.getOrDefault(prefix+"tls", "false")) || labels.getOrDefault(prefix+"tls.certresolver", "") != "" {
+			return true
+		}
+
+		entrypoints := strings.Split(labels.getOrDefault(prefix+"entrypoints", ""), ",")
+		return slices.Contains(entrypoints, "websecure") || slices.Contains(entrypoints, "https")
+	}
+
+	sort.SliceStable(routers, func(a, b int) bool {
+		return isSecure(routers[a]) && !isSecure(routers[b])
+	})
+
+	for _, router := range routers {
+		rule := labels["traefik.http.routers."+router+".rule"]
+		host := traefikHostRulePattern.FindStringSubmatch(rule)
+		if host == nil {
+			continue
+		}
+
+		routerURL := url.URL{Scheme: common.Ternary(isSecure(router), "https", "http"), Host: host[1]}
+		if path := traefikPathPrefixRulePattern.FindStringSubmatch(rule); path != nil {
+			routerURL.Path = path[1]
+		}
+
+		return routerURL.String()
+	}
+
+	return ""
+}
+
+// Counts the times containers were started or stopped, there's a single
+// watcher for each source that lives for as long as the process does
+type dockerEventWatcher struct {
+	changes atomic.Uint64
+}
+
+var (
+	dockerEventWatchersMu sync.Mutex
+	dockerEventWatchers   = make(map[string]*dockerEventWatcher)
+)
+
+const (
+	dockerEventsRetryInterval    = 10 * time.Second
+	dockerEventsMaxRetryInterval = 5 * time.Minute
+)
+
+func watchDockerEvents(source string) *dockerEventWatcher {
+	dockerEventWatchersMu.Lock()
+	defer dockerEventWatchersMu.Unlock()
+
+	if watcher, exists := dockerEventWatchers[source]; exists {
+		return watcher
+	}
+
+	watcher := &dockerEventWatcher{}
+	dockerEventWatchers[source] = watcher
+	go watcher.run(source)
+
+	return watcher
+}
+
+func (w *dockerEventWatcher) run(source string) {
+	retryInterval := dockerEventsRetryInterval
+
+	for {
+		startedAt := time.Now()
+		err := w.stream(source)
+
+		// a stream that lasted a while isn't a reason to wait longer next time
+		if time.Since(startedAt) > dockerEventsMaxRetryInterval {
+			retryInterval = dockerEventsRetryInterval
+		}
+
+		slog.Warn("Lost connection to Docker events, retrying", "source", source, "error", err, "in", retryInterval)
+		time.Sleep(retryInterval)
+		retryInterval = min(retryInterval*2, dockerEventsMaxRetryInterval)
+	}
+}
+
+func (w *dockerEventWatcher) stream(source string) error {
+	client, hostname, err := newDockerClient(source)
+	if err != nil {
+		return err
+	}
+
+	filters, _ := json.Marshal(map[string][]string{
+		"type":  {"container"},
+		"event": {"start", "die", "destroy", "pause", "unpause"},
+	})
+
+	request, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodGet,
+		"http://"+hostname+"/events?filters="+url.QueryEscape(string(filters)),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("non-200 response status: %s", response.Status)
+	}
+
+	// containers could have changed while disconnected
+	w.changes.Add(1)
+
+	// each event is a JSON object on a line of its own
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		w.changes.Add(1)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("stream ended")
+}
@@ -0,0 +1,648 @@
+package widgets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var downloadsWidgetTemplate = common.MustParseTemplate("downloads.html", "widget-base.html")
+
+const (
+	downloadsClientQbittorrent  = "qbittorrent"
+	downloadsClientTransmission = "transmission"
+	downloadsClientSabnzbd      = "sabnzbd"
+)
+
+type downloadsWidget struct {
+	widgetBase    `yaml:",inline"`
+	Client        string `yaml:"client"`
+	URL           string `yaml:"url"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+	APIKey        string `yaml:"api-key"`
+	AllowInsecure bool   `yaml:"allow-insecure"`
+	SpeedLimit    string `yaml:"speed-limit"`
+	CollapseAfter int    `yaml:"collapse-after"`
+
+	Stats *downloadsStats `yaml:"-"`
+	// The SID cookie of qBittorrent or the session ID of Transmission
+	sessionID string `yaml:"-"`
+}
+
+type downloadsStats struct {
+	DownloadSpeed string
+	UploadSpeed   string
+	HasUpload     bool
+	Completed     int
+	SpeedLimited  bool
+	Transfers     []downloadsTransfer
+}
+
+type downloadsTransfer struct {
+	Name                string
+	Percent             int
+	Speed               string
+	Status              string
+	IsActive            bool
+	HasProblem          bool
+	EstimatedCompletion time.Time
+}
+
+func (widget *downloadsWidget) Initialize() error {
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+
+	switch widget.Client {
+	case downloadsClientQbittorrent:
+		widget.withTitle("qBittorrent")
+	case downloadsClientTransmission:
+		widget.withTitle("Transmission")
+	case downloadsClientSabnzbd:
+		if widget.APIKey == "" {
+			return errors.New("api-key is required for SABnzbd")
+		}
+
+		if widget.SpeedLimit == "" {
+			widget.SpeedLimit = "50"
+		}
+		widget.SpeedLimit = strings.TrimSuffix(widget.SpeedLimit, "%")
+
+		widget.withTitle("SABnzbd")
+	default:
+		return fmt.Errorf("client must be one of %s, %s or %s", downloadsClientQbittorrent, downloadsClientTransmission, downloadsClientSabnzbd)
+	}
+
+	widget.withTitleURL(widget.URL).withCacheDuration(30 * time.Second)
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *downloadsWidget) Update(ctx context.Context) {
+	stats, err := widget.fetchStats(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Stats = stats
+}
+
+func (widget *downloadsWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, downloadsWidgetTemplate)
+}
+
+// The speed limit can only be changed when visitors have to log in since it
+// affects the client itself
+func (widget *downloadsWidget) CanToggleSpeedLimit() bool {
+	return widget.Providers != nil && widget.Providers.RequiresAuth
+}
+
+func (widget *downloadsWidget) LocksOwnRequests() {}
+
+// Handles POST speed-limit/toggle, which switches the alternative speed limits
+// of the client on or off and returns the widget rendered with its new state
+func (widget *downloadsWidget) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("path") != "speed-limit/toggle" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !widget.CanToggleSpeedLimit() {
+		http.Error(w, "changing the speed limit requires authentication to be enabled", http.StatusForbidden)
+		return
+	}
+
+	// the session ID could otherwise be changed by an update at the same time
+	widget.updateLock.Lock()
+	err := widget.toggleSpeedLimit(r.Context())
+	widget.updateLock.Unlock()
+
+	if err != nil {
+		slog.Error("Failed to toggle speed limit of download client", "client", widget.Client, "error", err)
+		http.Error(w, "could not toggle speed limit", http.StatusBadGateway)
+		return
+	}
+
+	models.UpdateWidget(r.Context(), widget)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(widget.Render()))
+}
+
+func (widget *downloadsWidget) fetchStats(ctx context.Context) (*downloadsStats, error) {
+	client := widget.httpClient(widget.AllowInsecure)
+
+	var stats *downloadsStats
+	var err error
+
+	switch widget.Client {
+	case downloadsClientQbittorrent:
+		stats, err = widget.fetchQbittorrentStats(ctx, client)
+	case downloadsClientTransmission:
+		stats, err = widget.fetchTransmissionStats(ctx, client)
+	case downloadsClientSabnzbd:
+		stats, err = widget.fetchSabnzbdStats(ctx, client)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the ones that are downloading go first, then the ones closest to being done
+	slices.SortStableFunc(stats.Transfers, func(a, b downloadsTransfer) int {
+		if a.IsActive != b.IsActive {
+			return common.Ternary(a.IsActive, -1, 1)
+		}
+
+		return b.Percent - a.Percent
+	})
+
+	return stats, nil
+}
+
+func (widget *downloadsWidget) toggleSpeedLimit(ctx context.Context) error {
+	client := widget.httpClient(widget.AllowInsecure)
+
+	switch widget.Client {
+	case downloadsClientQbittorrent:
+		_, err := widget.qbittorrentRequest(ctx, client, "POST", "/transfer/toggleSpeedLimitsMode", url.Values{})
+		return err
+	case downloadsClientTransmission:
+		var session struct {
+			AltSpeedEnabled bool `json:"alt-speed-enabled"`
+		}
+		if err := widget.transmissionCall(ctx, client, "session-get", map[string]any{"fields": []string{"alt-speed-enabled"}}, &session); err != nil {
+			return err
+		}
+
+		return widget.transmissionCall(ctx, client, "session-set", map[string]any{"alt-speed-enabled": !session.AltSpeedEnabled}, nil)
+	case downloadsClientSabnzbd:
+		queue, err := widget.fetchSabnzbdQueue(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		value := common.Ternary(sabnzbdIsSpeedLimited(queue.SpeedLimit), "100", widget.SpeedLimit)
+		_, err = fetch.DecodeJSON[json.RawMessage](client, widget.sabnzbdRequest(ctx, url.Values{
+			"mode":  {"config"},
+			"name":  {"speedlimit"},
+			"value": {value},
+		}))
+		return err
+	}
+
+	return nil
+}
+
+func formatDownloadsSpeed(bytesPerSecond float64) string {
+	switch {
+	case bytesPerSecond >= 1_000_000_000:
+		return strconv.FormatFloat(bytesPerSecond/1_000_000_000, 'f', 1, 64) + " GB/s"
+	case bytesPerSecond >= 1_000_000:
+		return strconv.FormatFloat(bytesPerSecond/1_000_000, 'f', 1, 64) + " MB/s"
+	case bytesPerSecond >= 1_000:
+		return strconv.FormatFloat(bytesPerSecond/1_000, 'f', 0, 64) + " KB/s"
+	}
+
+	return strconv.FormatFloat(bytesPerSecond, 'f', 0, 64) + " B/s"
+}
+
+func downloadsCompletionTime(secondsLeft int64) time.Time {
+	// clients use huge or negative values when they can't tell
+	if secondsLeft <= 0 || secondsLeft >= 100*24*60*60 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(time.Duration(secondsLeft) * time.Second)
+}
+
+// Sends the request with the SID cookie, logging in first if there's no
+// session yet or it expired. Without a username the client is expected to not
+// require logging in, such as when bypassing authentication for the subnet.
+func (widget *downloadsWidget) qbittorrentRequest(
+	ctx context.Context,
+	client fetch.Doer,
+	method string,
+	path string,
+	form url.Values,
+) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+
+		request, _ := http.NewRequestWithContext(ctx, method, widget.URL+"/api/v2"+path, body)
+		if form != nil {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if widget.sessionID != "" {
+			request.AddCookie(&http.Cookie{Name: "SID", Value: widget.sessionID})
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, err
+		}
+
+		responseBody, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if response.StatusCode == http.StatusForbidden && attempt == 0 && widget.Username != "" {
+			if err := widget.loginToQbittorrent(ctx, client); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status code %d from %s", response.StatusCode, request.URL)
+		}
+
+		return responseBody, nil
+	}
+}
+
+func (widget *downloadsWidget) loginToQbittorrent(ctx context.Context, client fetch.Doer) error {
+	form := url.Values{"username": {widget.Username}, "password": {widget.Password}}
+	request, _ := http.NewRequestWithContext(ctx, "POST", widget.URL+"/api/v2/auth/login", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("logging in: %w", err)
+	}
+	defer response.Body.Close()
+
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == "SID" {
+			widget.sessionID = cookie.Value
+			return nil
+		}
+	}
+
+	return fmt.Errorf("logging in: wrong username or password, or too many failed attempts (status code %d)", response.StatusCode)
+}
+
+type qbittorrentTorrentJson struct {
+	Name     string  `json:"name"`
+	Progress float64 `json:"progress"`
+	DLSpeed  float64 `json:"dlspeed"`
+	ETA      int64   `json:"eta"`
+	State    string  `json:"state"`
+}
+
+func (widget *downloadsWidget) fetchQbittorrentStats(ctx context.Context, client fetch.Doer) (*downloadsStats, error) {
+	body, err := widget.qbittorrentRequest(ctx, client, "GET", "/transfer/info", nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching transfer info: %w", err)
+	}
+
+	var info struct {
+		DLSpeed float64 `json:"dl_info_speed"`
+		UPSpeed float64 `json:"up_info_speed"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("parsing transfer info: %w", err)
+	}
+
+	limitsMode, err := widget.qbittorrentRequest(ctx, client, "GET", "/transfer/speedLimitsMode", nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching speed limits mode: %w", err)
+	}
+
+	body, err = widget.qbittorrentRequest(ctx, client, "GET", "/torrents/info", nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching torrents: %w", err)
+	}
+
+	var torrents []qbittorrentTorrentJson
+	if err := json.Unmarshal(body, &torrents); err != nil {
+		return nil, fmt.Errorf("parsing torrents: %w", err)
+	}
+
+	stats := &downloadsStats{
+		DownloadSpeed: formatDownloadsSpeed(info.DLSpeed),
+		UploadSpeed:   formatDownloadsSpeed(info.UPSpeed),
+		HasUpload:     true,
+		SpeedLimited:  strings.TrimSpace(string(limitsMode)) == "1",
+	}
+
+	for _, torrent := range torrents {
+		if torrent.Progress >= 1 {
+			stats.Completed++
+			continue
+		}
+
+		transfer := downloadsTransfer{
+			Name:    torrent.Name,
+			Percent: int(torrent.Progress * 100),
+			Speed:   formatDownloadsSpeed(torrent.DLSpeed),
+		}
+
+		switch torrent.State {
+		case "downloading", "forcedDL":
+			transfer.Status = "downloading"
+			transfer.IsActive = true
+			transfer.EstimatedCompletion = downloadsCompletionTime(torrent.ETA)
+		case "metaDL", "forcedMetaDL":
+			transfer.Status = "fetching metadata"
+			transfer.IsActive = true
+		case "stalledDL":
+			transfer.Status = "stalled"
+		case "pausedDL", "stoppedDL":
+			transfer.Status = "paused"
+		case "queuedDL":
+			transfer.Status = "queued"
+		case "checkingDL", "checkingResumeData", "moving":
+			transfer.Status = "checking"
+		case "error", "missingFiles":
+			transfer.Status = "error"
+			transfer.HasProblem = true
+		default:
+			transfer.Status = torrent.State
+		}
+
+		stats.Transfers = append(stats.Transfers, transfer)
+	}
+
+	return stats, nil
+}
+
+// Calls a method of the RPC API, getting a new session ID when Transmission
+// asks for one, which it does when the previous one expires
+func (widget *downloadsWidget) transmissionCall(
+	ctx context.Context,
+	client fetch.Doer,
+	method string,
+	arguments any,
+	result any,
+) error {
+	body, err := json.Marshal(map[string]any{"method": method, "arguments": arguments})
+	if err != nil {
+		return err
+	}
+
+	rpcURL := widget.URL
+	if !strings.HasSuffix(rpcURL, "/rpc") {
+		rpcURL += "/transmission/rpc"
+	}
+
+	for attempt := 0; ; attempt++ {
+		request, _ := http.NewRequestWithContext(ctx, "POST", rpcURL, bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Transmission-Session-Id", widget.sessionID)
+		if widget.Username != "" {
+			request.SetBasicAuth(widget.Username, widget.Password)
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+
+		responseBody, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if response.StatusCode == http.StatusConflict && attempt == 0 {
+			widget.sessionID = response.Header.Get("X-Transmission-Session-Id")
+			continue
+		}
+
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status code %d from %s", response.StatusCode, rpcURL)
+		}
+
+		var decoded struct {
+			Result    string          `json:"result"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(responseBody, &decoded); err != nil {
+			return fmt.Errorf("parsing response of %s: %w", method, err)
+		}
+
+		if decoded.Result != "success" {
+			return fmt.Errorf("%s failed: %s", method, decoded.Result)
+		}
+
+		if result == nil {
+			return nil
+		}
+
+		return json.Unmarshal(decoded.Arguments, result)
+	}
+}
+
+func (widget *downloadsWidget) fetchTransmissionStats(ctx context.Context, client fetch.Doer) (*downloadsStats, error) {
+	var sessionStats struct {
+		DownloadSpeed float64 `json:"downloadSpeed"`
+		UploadSpeed   float64 `json:"uploadSpeed"`
+	}
+	if err := widget.transmissionCall(ctx, client, "session-stats", nil, &sessionStats); err != nil {
+		return nil, fmt.Errorf("fetching session stats: %w", err)
+	}
+
+	var session struct {
+		AltSpeedEnabled bool `json:"alt-speed-enabled"`
+	}
+	if err := widget.transmissionCall(ctx, client, "session-get", map[string]any{"fields": []string{"alt-speed-enabled"}}, &session); err != nil {
+		return nil, fmt.Errorf("fetching session: %w", err)
+	}
+
+	var torrents struct {
+		Torrents []struct {
+			Name         string  `json:"name"`
+			PercentDone  float64 `json:"percentDone"`
+			RateDownload float64 `json:"rateDownload"`
+			ETA          int64   `json:"eta"`
+			Status       int     `json:"status"`
+			Error        int     `json:"error"`
+		} `json:"torrents"`
+	}
+	fields := []string{"name", "percentDone", "rateDownload", "eta", "status", "error"}
+	if err := widget.transmissionCall(ctx, client, "torrent-get", map[string]any{"fields": fields}, &torrents); err != nil {
+		return nil, fmt.Errorf("fetching torrents: %w", err)
+	}
+
+	stats := &downloadsStats{
+		DownloadSpeed: formatDownloadsSpeed(sessionStats.DownloadSpeed),
+		UploadSpeed:   formatDownloadsSpeed(sessionStats.UploadSpeed),
+		HasUpload:     true,
+		SpeedLimited:  session.AltSpeedEnabled,
+	}
+
+	for _, torrent := range torrents.Torrents {
+		if torrent.PercentDone >= 1 {
+			stats.Completed++
+			continue
+		}
+
+		transfer := downloadsTransfer{
+			Name:    torrent.Name,
+			Percent: int(torrent.PercentDone * 100),
+			Speed:   formatDownloadsSpeed(torrent.RateDownload),
+		}
+
+		switch {
+		case torrent.Error != 0:
+			transfer.Status = "error"
+			transfer.HasProblem = true
+		case torrent.Status == 0:
+			transfer.Status = "paused"
+		case torrent.Status == 1 || torrent.Status == 2:
+			transfer.Status = "checking"
+		case torrent.Status == 3:
+			transfer.Status = "queued"
+		default:
+			transfer.Status = "downloading"
+			transfer.IsActive = true
+			transfer.EstimatedCompletion = downloadsCompletionTime(torrent.ETA)
+		}
+
+		stats.Transfers = append(stats.Transfers, transfer)
+	}
+
+	return stats, nil
+}
+
+func (widget *downloadsWidget) sabnzbdRequest(ctx context.Context, query url.Values) *http.Request {
+	query.Set("output", "json")
+	query.Set("apikey", widget.APIKey)
+	request, _ := http.NewRequestWithContext(ctx, "GET", widget.URL+"/api?"+query.Encode(), nil)
+
+	return request
+}
+
+type sabnzbdQueueJson struct {
+	Paused     bool   `json:"paused"`
+	KBPerSec   string `json:"kbpersec"`
+	SpeedLimit string `json:"speedlimit"`
+	Slots      []struct {
+		Filename   string `json:"filename"`
+		Percentage string `json:"percentage"`
+		TimeLeft   string `json:"timeleft"`
+		Status     string `json:"status"`
+	} `json:"slots"`
+}
+
+func (widget *downloadsWidget) fetchSabnzbdQueue(ctx context.Context, client fetch.Doer) (*sabnzbdQueueJson, error) {
+	response, err := fetch.DecodeJSON[struct {
+		Queue sabnzbdQueueJson `json:"queue"`
+	}](client, widget.sabnzbdRequest(ctx, url.Values{"mode": {"queue"}}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &response.Queue, nil
+}
+
+// The speed limit is a percentage of the maximum line speed set in SABnzbd
+func sabnzbdIsSpeedLimited(speedLimit string) bool {
+	percent, err := strconv.Atoi(speedLimit)
+	return err == nil && percent > 0 && percent < 100
+}
+
+// Parses the time left of a job, formatted as h:mm:ss, optionally prefixed by
+// the days
+func sabnzbdParseTimeLeft(value string) int64 {
+	var seconds int64
+	multipliers := []int64{1, 60, 60 * 60, 24 * 60 * 60}
+	parts := strings.Split(value, ":")
+
+	for i := range min(len(parts), len(multipliers)) {
+		part, err := strconv.ParseInt(parts[len(parts)-1-i], 10, 64)
+		if err != nil {
+			return 0
+		}
+		seconds += part * multipliers[i]
+	}
+
+	return seconds
+}
+
+func (widget *downloadsWidget) fetchSabnzbdStats(ctx context.Context, client fetch.Doer) (*downloadsStats, error) {
+	queue, err := widget.fetchSabnzbdQueue(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("fetching queue: %w", err)
+	}
+
+	// the number of slots is the total regardless of the limit
+	historyRequest := func(failedOnly string) *http.Request {
+		return widget.sabnzbdRequest(ctx, url.Values{"mode": {"history"}, "limit": {"1"}, "failed_only": {failedOnly}})
+	}
+	type historyJson struct {
+		History struct {
+			Slots int `json:"noofslots"`
+		} `json:"history"`
+	}
+
+	history, err := fetch.DecodeJSON[historyJson](client, historyRequest("0"))
+	if err != nil {
+		return nil, fmt.Errorf("fetching history: %w", err)
+	}
+
+	failed, err := fetch.DecodeJSON[historyJson](client, historyRequest("1"))
+	if err != nil {
+		return nil, fmt.Errorf("fetching failed jobs: %w", err)
+	}
+
+	kbPerSecond, _ := strconv.ParseFloat(queue.KBPerSec, 64)
+	stats := &downloadsStats{
+		DownloadSpeed: formatDownloadsSpeed(kbPerSecond * 1024),
+		Completed:     history.History.Slots - failed.History.Slots,
+		SpeedLimited:  sabnzbdIsSpeedLimited(queue.SpeedLimit),
+	}
+
+	for _, slot := range queue.Slots {
+		percent, _ := strconv.Atoi(slot.Percentage)
+		transfer := downloadsTransfer{
+			Name:    slot.Filename,
+			Percent: percent,
+			Status:  strings.ToLower(slot.Status),
+		}
+
+		if transfer.Status == "downloading" && !queue.Paused {
+			transfer.IsActive = true
+			transfer.EstimatedCompletion = downloadsCompletionTime(sabnzbdParseTimeLeft(slot.TimeLeft))
+		} else if queue.Paused {
+			transfer.Status = "paused"
+		}
+
+		stats.Transfers = append(stats.Transfers, transfer)
+	}
+
+	return stats, nil
+}
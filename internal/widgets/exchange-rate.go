@@ -0,0 +1,216 @@
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var exchangeRateWidgetTemplate = common.MustParseTemplate("exchange-rate.html", "widget-base.html")
+
+const exchangeRateDefaultAPIURL = "https://api.frankfurter.dev/v1"
+
+var exchangeRateCurrencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+type exchangeRateWidget struct {
+	widgetBase    `yaml:",inline"`
+	Pairs         []string `yaml:"pairs"`
+	APIURL        string   `yaml:"api-url"`
+	ChartDays     int      `yaml:"chart-days"`
+	ShowConverter bool     `yaml:"converter"`
+
+	pairs []exchangeRatePair `yaml:"-"`
+	Rates []exchangeRate     `yaml:"-"`
+}
+
+type exchangeRatePair struct {
+	From string
+	To   string
+}
+
+type exchangeRate struct {
+	exchangeRatePair
+	Rate           float64
+	Date           time.Time
+	PercentChange  float64
+	SvgChartPoints string
+}
+
+func (widget *exchangeRateWidget) Initialize() error {
+	widget.withTitle("Exchange Rates").withCacheDuration(time.Hour)
+
+	if len(widget.Pairs) == 0 {
+		return errors.New("at least one pair is required")
+	}
+
+	widget.pairs = make([]exchangeRatePair, 0, len(widget.Pairs))
+	for _, pair := range widget.Pairs {
+		from, to, found := strings.Cut(strings.ToUpper(strings.TrimSpace(pair)), "/")
+		if !found || !exchangeRateCurrencyPattern.MatchString(from) || !exchangeRateCurrencyPattern.MatchString(to) {
+			return fmt.Errorf("pair %q must be two currency codes separated by a slash, such as USD/EUR", pair)
+		}
+
+		if from == to {
+			return fmt.Errorf("pair %q converts a currency to itself", pair)
+		}
+
+		widget.pairs = append(widget.pairs, exchangeRatePair{From: from, To: to})
+	}
+
+	if widget.APIURL == "" {
+		widget.APIURL = exchangeRateDefaultAPIURL
+	}
+	widget.APIURL = strings.TrimRight(widget.APIURL, "/")
+
+	if widget.ChartDays <= 0 {
+		widget.ChartDays = 30
+	}
+
+	return nil
+}
+
+func (widget *exchangeRateWidget) Update(ctx context.Context) {
+	rates, err := widget.fetchRates(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Rates = rates
+}
+
+func (widget *exchangeRateWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, exchangeRateWidgetTemplate)
+}
+
+// Rates are only published on working days, dates are the keys
+type exchangeRateSeriesJson struct {
+	Rates map[string]map[string]float64 `json:"rates"`
+}
+
+// Pairs with the same base currency are fetched together, the series of
+// rates for the chart also give the previous rate for the change
+func (widget *exchangeRateWidget) fetchRates(ctx context.Context) ([]exchangeRate, error) {
+	client := widget.httpClient(false)
+	start := time.Now().AddDate(0, 0, -widget.ChartDays).Format(time.DateOnly)
+
+	var bases []string
+	for _, pair := range widget.pairs {
+		if !slices.Contains(bases, pair.From) {
+			bases = append(bases, pair.From)
+		}
+	}
+
+	requests := make([]*http.Request, len(bases))
+	for i, base := range bases {
+		var symbols []string
+		for _, pair := range widget.pairs {
+			if pair.From == base && !slices.Contains(symbols, pair.To) {
+				symbols = append(symbols, pair.To)
+			}
+		}
+
+		query := url.Values{"base": {base}, "symbols": {strings.Join(symbols, ",")}}
+		requests[i], _ = http.NewRequestWithContext(ctx, "GET", widget.APIURL+"/"+start+"..?"+query.Encode(), nil)
+	}
+
+	job := newJob(fetch.DecodeJSONTask[exchangeRateSeriesJson](client), requests)
+	responses, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	for i := range bases {
+		if errs[i] != nil {
+			slog.Error("Failed to fetch exchange rates", "base", bases[i], "error", errs[i])
+		}
+	}
+
+	rates := make([]exchangeRate, 0, len(widget.pairs))
+	var failed int
+
+	for _, pair := range widget.pairs {
+		i := slices.Index(bases, pair.From)
+		if errs[i] != nil {
+			failed++
+			continue
+		}
+
+		dates := make([]string, 0, len(responses[i].Rates))
+		for date, rates := range responses[i].Rates {
+			if rates[pair.To] > 0 {
+				dates = append(dates, date)
+			}
+		}
+
+		if len(dates) == 0 {
+			failed++
+			slog.Error("Exchange rate response contains no rates", "pair", pair.From+"/"+pair.To)
+			continue
+		}
+
+		// the dates are formatted as YYYY-MM-DD so they sort chronologically
+		slices.Sort(dates)
+
+		history := make([]float64, len(dates))
+		for j, date := range dates {
+			history[j] = responses[i].Rates[date][pair.To]
+		}
+
+		date, _ := time.Parse(time.DateOnly, dates[len(dates)-1])
+		rate := exchangeRate{
+			exchangeRatePair: pair,
+			Rate:             history[len(history)-1],
+			Date:             date,
+			SvgChartPoints:   common.SvgPolylineCoordsFromYValues(100, 50, history),
+		}
+
+		if len(history) >= 2 {
+			rate.PercentChange = common.PercentChange(rate.Rate, history[len(history)-2])
+		}
+
+		rates = append(rates, rate)
+	}
+
+	if len(rates) == 0 {
+		return nil, models.ErrNoContent
+	}
+
+	if failed > 0 {
+		return rates, fmt.Errorf("%w: could not fetch rates for %d pairs", models.ErrPartialContent, failed)
+	}
+
+	return rates, nil
+}
+
+// Rates of currencies worth a lot less than the one they're converted from
+// would otherwise show up as 0.00
+func (rate exchangeRate) Precision() int {
+	switch {
+	case rate.Rate >= 100:
+		return 2
+	case rate.Rate >= 0.01:
+		return 4
+	default:
+		return 6
+	}
+}
+
+func (rate exchangeRate) Symbol() string {
+	if symbol, exists := currencyToSymbol[rate.To]; exists {
+		return symbol
+	}
+
+	return ""
+}
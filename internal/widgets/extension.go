@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"github.com/limpdev/gander/internal/models"
 )
 
@@ -25,10 +26,10 @@ type extensionWidget struct {
 	URL                 string                      `yaml:"url"`
 	FallbackContentType string                      `yaml:"fallback-content-type"`
 	Parameters          models.QueryParametersField `yaml:"parameters"`
-	Headers             map[string]string           `yaml:"headers"`
 	AllowHtml           bool                        `yaml:"allow-potentially-dangerous-html"`
+	HTMLPolicy          string                      `yaml:"html-policy"`
+	AllowPrivate        bool                        `yaml:"allow-private-addresses"`
 	Extension           extension                   `yaml:"-"`
-	cachedHTML          template.HTML               `yaml:"-"`
 }
 
 func (widget *extensionWidget) Initialize() error {
@@ -42,16 +43,27 @@ func (widget *extensionWidget) Initialize() error {
 		return fmt.Errorf("parsing URL: %v", err)
 	}
 
+	if widget.HTMLPolicy == "" {
+		widget.HTMLPolicy = common.HTMLPolicyStrict
+		if widget.AllowHtml {
+			widget.HTMLPolicy = common.HTMLPolicyUnsafe
+		}
+	} else if err := common.ValidateHTMLPolicy(widget.HTMLPolicy); err != nil {
+		return err
+	} else if widget.AllowHtml && widget.HTMLPolicy != common.HTMLPolicyUnsafe {
+		return fmt.Errorf("allow-potentially-dangerous-html can't be used with the %s html-policy", widget.HTMLPolicy)
+	}
+
 	return nil
 }
 
 func (widget *extensionWidget) Update(ctx context.Context) {
-	extension, err := fetchExtension(extensionRequestOptions{
+	client := widget.restrictToPublicAddresses(widget.httpClient(false), widget.AllowPrivate)
+	extension, err := fetchExtension(client, extensionRequestOptions{
 		URL:                 widget.URL,
 		FallbackContentType: widget.FallbackContentType,
 		Parameters:          widget.Parameters,
-		Headers:             widget.Headers,
-		AllowHtml:           widget.AllowHtml,
+		HTMLPolicy:          widget.HTMLPolicy,
 	})
 
 	widget.canContinueUpdateAfterHandlingErr(err)
@@ -65,12 +77,22 @@ func (widget *extensionWidget) Update(ctx context.Context) {
 	if widget.TitleURL == "" && extension.TitleURL != "" {
 		widget.TitleURL = extension.TitleURL
 	}
+}
 
-	widget.cachedHTML = widget.renderTemplate(widget, extensionWidgetTemplate)
+func (widget *extensionWidget) MarshalData() (any, error) {
+	return struct {
+		Title    string `json:"title,omitempty"`
+		TitleURL string `json:"title_url,omitempty"`
+		Content  string `json:"content"`
+	}{
+		Title:    widget.Extension.Title,
+		TitleURL: widget.Extension.TitleURL,
+		Content:  string(widget.Extension.Content),
+	}, nil
 }
 
 func (widget *extensionWidget) Render() template.HTML {
-	return widget.cachedHTML
+	return widget.renderTemplate(widget, extensionWidgetTemplate)
 }
 
 type extensionType int
@@ -95,8 +117,7 @@ type extensionRequestOptions struct {
 	URL                 string                      `yaml:"url"`
 	FallbackContentType string                      `yaml:"fallback-content-type"`
 	Parameters          models.QueryParametersField `yaml:"parameters"`
-	Headers             map[string]string           `yaml:"headers"`
-	AllowHtml           bool                        `yaml:"allow-potentially-dangerous-html"`
+	HTMLPolicy          string                      `yaml:"html-policy"`
 }
 
 type extension struct {
@@ -109,30 +130,22 @@ type extension struct {
 func convertExtensionContent(options extensionRequestOptions, content []byte, contentType extensionType) template.HTML {
 	switch contentType {
 	case extensionContentHTML:
-		if options.AllowHtml {
-			return template.HTML(content)
-		}
-
-		fallthrough
+		return common.SanitizeHTML(options.HTMLPolicy, string(content))
 	default:
 		return template.HTML("<pre>" + html.EscapeString(string(content)) + "</pre>")
 	}
 }
 
-func fetchExtension(options extensionRequestOptions) (extension, error) {
+func fetchExtension(client fetch.Doer, options extensionRequestOptions) (extension, error) {
 	request, _ := http.NewRequest("GET", options.URL, nil)
 	if len(options.Parameters) > 0 {
 		request.URL.RawQuery = options.Parameters.ToQueryString()
 	}
 
-	for key, value := range options.Headers {
-		request.Header.Add(key, value)
-	}
-
-	response, err := http.DefaultClient.Do(request)
+	response, err := client.Do(request)
 	if err != nil {
 		slog.Error("Failed fetching extension", "url", options.URL, "error", err)
-		return extension{}, fmt.Errorf("%w: request failed: %w", errNoContent, err)
+		return extension{}, fmt.Errorf("%w: request failed: %w", models.ErrNoContent, err)
 	}
 
 	defer response.Body.Close()
@@ -140,7 +153,18 @@ func fetchExtension(options extensionRequestOptions) (extension, error) {
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
 		slog.Error("Failed reading response body of extension", "url", options.URL, "error", err)
-		return extension{}, fmt.Errorf("%w: could not read body: %w", errNoContent, err)
+		return extension{}, fmt.Errorf("%w: could not read body: %w", models.ErrNoContent, err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		truncatedBody, _ := common.LimitStringLength(string(body), 256)
+		slog.Error("Extension returned unexpected status code", "url", options.URL, "status", response.StatusCode)
+		return extension{}, fmt.Errorf(
+			"%w: unexpected status code %d, response: %s",
+			models.ErrNoContent,
+			response.StatusCode,
+			truncatedBody,
+		)
 	}
 
 	extension := extension{}
@@ -0,0 +1,426 @@
+package widgets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var githubInboxWidgetTemplate = common.MustParseTemplate("github-inbox.html", "widget-base.html")
+
+const githubInboxPageSize = 50
+
+type githubInboxWidget struct {
+	widgetBase         `yaml:",inline"`
+	Token              string `yaml:"token"`
+	APIURL             string `yaml:"api-url"`
+	HideNotifications  bool   `yaml:"hide-notifications"`
+	HideReviewRequests bool   `yaml:"hide-review-requests"`
+	HideAssignedIssues bool   `yaml:"hide-assigned-issues"`
+	CollapseAfter      int    `yaml:"collapse-after"`
+
+	Notifications  []githubInboxRepository `yaml:"-"`
+	ReviewRequests []githubInboxRepository `yaml:"-"`
+	AssignedIssues []githubInboxRepository `yaml:"-"`
+}
+
+type githubInboxRepository struct {
+	Name  string
+	URL   string
+	Items []githubInboxItem
+}
+
+type githubInboxItem struct {
+	// Only set for notifications
+	ThreadID  string
+	Title     string
+	URL       string
+	Kind      string
+	Reason    string
+	UpdatedAt time.Time
+}
+
+func (widget *githubInboxWidget) Initialize() error {
+	if widget.Token == "" {
+		return errors.New("token is required")
+	}
+
+	if widget.HideNotifications && widget.HideReviewRequests && widget.HideAssignedIssues {
+		return errors.New("at least one of notifications, review requests or assigned issues has to be shown")
+	}
+
+	if widget.APIURL == "" {
+		widget.APIURL = "https://api.github.com"
+	}
+	widget.APIURL = strings.TrimRight(widget.APIURL, "/")
+
+	widget.withTitle("GitHub").withTitleURL("https://github.com/notifications").withCacheDuration(5 * time.Minute)
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *githubInboxWidget) Update(ctx context.Context) {
+	client := widget.httpClient(false)
+	var requested int
+	var failed []string
+	var lastErr error
+
+	if !widget.HideNotifications {
+		requested++
+		notifications, err := widget.fetchNotifications(ctx, client)
+		if err != nil {
+			failed, lastErr = append(failed, "notifications"), err
+		} else {
+			widget.Notifications = notifications
+		}
+	}
+
+	if !widget.HideReviewRequests {
+		requested++
+		reviewRequests, err := widget.search(ctx, client, "is:open is:pr review-requested:@me archived:false")
+		if err != nil {
+			failed, lastErr = append(failed, "review requests"), err
+		} else {
+			widget.ReviewRequests = reviewRequests
+		}
+	}
+
+	if !widget.HideAssignedIssues {
+		requested++
+		assignedIssues, err := widget.search(ctx, client, "is:open is:issue assignee:@me archived:false")
+		if err != nil {
+			failed, lastErr = append(failed, "assigned issues"), err
+		} else {
+			widget.AssignedIssues = assignedIssues
+		}
+	}
+
+	var err error
+	if len(failed) == requested {
+		err = lastErr
+	} else if len(failed) > 0 {
+		err = fmt.Errorf("%w: could not get the %s: %v", models.ErrPartialContent, strings.Join(failed, " and "), lastErr)
+	}
+
+	widget.canContinueUpdateAfterHandlingErr(err)
+}
+
+func (widget *githubInboxWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, githubInboxWidgetTemplate)
+}
+
+type githubInboxSection struct {
+	Title        string
+	Empty        string
+	Count        int
+	Repositories []githubInboxRepository
+	// Only notifications can be marked as read
+	MarkAsRead bool
+}
+
+func (widget *githubInboxWidget) Sections() []githubInboxSection {
+	sections := make([]githubInboxSection, 0, 3)
+
+	if !widget.HideNotifications {
+		sections = append(sections, githubInboxSection{
+			Title:        "Notifications",
+			Empty:        "No unread notifications.",
+			Repositories: widget.Notifications,
+			MarkAsRead:   widget.CanMarkAsRead(),
+		})
+	}
+
+	if !widget.HideReviewRequests {
+		sections = append(sections, githubInboxSection{
+			Title:        "Review requests",
+			Empty:        "No pull requests are waiting for your review.",
+			Repositories: widget.ReviewRequests,
+		})
+	}
+
+	if !widget.HideAssignedIssues {
+		sections = append(sections, githubInboxSection{
+			Title:        "Assigned issues",
+			Empty:        "No open issues are assigned to you.",
+			Repositories: widget.AssignedIssues,
+		})
+	}
+
+	for i := range sections {
+		for _, repo := range sections[i].Repositories {
+			sections[i].Count += len(repo.Items)
+		}
+	}
+
+	return sections
+}
+
+// Marking notifications as read changes them on GitHub itself, so it's only
+// offered when visitors have to log in
+func (widget *githubInboxWidget) CanMarkAsRead() bool {
+	return widget.Providers != nil && widget.Providers.RequiresAuth
+}
+
+func (widget *githubInboxWidget) LocksOwnRequests() {}
+
+// Handles POST read/{thread}, which marks a single notification as read, and
+// POST read-repository/{owner}/{repo}, which marks the shown notifications of
+// a repository as read. Both return the widget rendered without them.
+func (widget *githubInboxWidget) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	path := r.PathValue("path")
+	threadID, isThread := strings.CutPrefix(path, "read/")
+	repository, isRepository := strings.CutPrefix(path, "read-repository/")
+
+	if !isThread && !isRepository {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !widget.CanMarkAsRead() {
+		http.Error(w, "marking notifications as read requires authentication to be enabled", http.StatusForbidden)
+		return
+	}
+
+	widget.updateLock.RLock()
+	request, found := widget.newMarkAsReadRequest(r.Context(), threadID, repository)
+	widget.updateLock.RUnlock()
+
+	if !found {
+		http.Error(w, "notification not found", http.StatusNotFound)
+		return
+	}
+
+	if err := githubInboxDo(widget.httpClient(false), request); err != nil {
+		slog.Error("Failed to mark GitHub notifications as read", "path", path, "error", err)
+		http.Error(w, "could not mark as read", http.StatusBadGateway)
+		return
+	}
+
+	// GitHub can take a moment before they stop being listed as unread, so
+	// they get removed here rather than by updating the widget
+	widget.updateLock.Lock()
+	for i := range widget.Notifications {
+		repo := &widget.Notifications[i]
+		if isRepository && repo.Name == repository {
+			repo.Items = nil
+		} else if isThread {
+			repo.Items = slices.DeleteFunc(repo.Items, func(item githubInboxItem) bool {
+				return item.ThreadID == threadID
+			})
+		}
+	}
+	widget.Notifications = slices.DeleteFunc(widget.Notifications, func(repo githubInboxRepository) bool {
+		return len(repo.Items) == 0
+	})
+	widget.updateLock.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(widget.Render()))
+}
+
+// Only notifications that are shown can be marked as read, which must be
+// called while holding the update lock for reading
+func (widget *githubInboxWidget) newMarkAsReadRequest(ctx context.Context, threadID, repository string) (*http.Request, bool) {
+	for i := range widget.Notifications {
+		repo := &widget.Notifications[i]
+
+		if repository != "" {
+			if repo.Name != repository {
+				continue
+			}
+
+			// anything newer than what's shown stays unread
+			var lastReadAt time.Time
+			for _, item := range repo.Items {
+				lastReadAt = common.Ternary(item.UpdatedAt.After(lastReadAt), item.UpdatedAt, lastReadAt)
+			}
+
+			body, _ := json.Marshal(map[string]string{"last_read_at": lastReadAt.UTC().Format(time.RFC3339)})
+			return widget.newRequest(ctx, "PUT", "/repos/"+repo.Name+"/notifications", body), true
+		}
+
+		for _, item := range repo.Items {
+			if item.ThreadID == threadID {
+				return widget.newRequest(ctx, "PATCH", "/notifications/threads/"+url.PathEscape(threadID), nil), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func (widget *githubInboxWidget) newRequest(ctx context.Context, method, path string, body []byte) *http.Request {
+	request, _ := http.NewRequestWithContext(ctx, method, widget.APIURL+path, bytes.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+widget.Token)
+	request.Header.Set("Accept", "application/vnd.github+json")
+	request.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	return request
+}
+
+// For requests that don't respond with anything worth decoding
+func githubInboxDo(client fetch.Doer, request *http.Request) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d from %s", response.StatusCode, request.URL)
+	}
+
+	return nil
+}
+
+type githubNotificationJson struct {
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Subject   struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		Type  string `json:"type"`
+	} `json:"subject"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+}
+
+func (widget *githubInboxWidget) fetchNotifications(ctx context.Context, client fetch.Doer) ([]githubInboxRepository, error) {
+	request := widget.newRequest(ctx, "GET", "/notifications?per_page="+strconv.Itoa(githubInboxPageSize), nil)
+	response, err := fetch.DecodeJSON[[]githubNotificationJson](client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var repositories []githubInboxRepository
+	for i := range response {
+		notification := &response[i]
+		item := githubInboxItem{
+			ThreadID:  notification.ID,
+			Title:     notification.Subject.Title,
+			URL:       githubNotificationURL(notification),
+			Kind:      githubInboxKind(notification.Subject.Type),
+			Reason:    strings.ReplaceAll(notification.Reason, "_", " "),
+			UpdatedAt: notification.UpdatedAt,
+		}
+
+		repositories = githubInboxAddItem(repositories, notification.Repository.FullName, notification.Repository.HTMLURL, item)
+	}
+
+	return repositories, nil
+}
+
+// The subject only links to the API, the page on GitHub has to be pieced
+// together from the repository and the number at the end
+func githubNotificationURL(notification *githubNotificationJson) string {
+	repositoryURL := notification.Repository.HTMLURL
+	number := notification.Subject.URL[strings.LastIndex(notification.Subject.URL, "/")+1:]
+
+	switch notification.Subject.Type {
+	case "PullRequest":
+		return repositoryURL + "/pull/" + number
+	case "Issue":
+		return repositoryURL + "/issues/" + number
+	case "Discussion":
+		return repositoryURL + "/discussions"
+	case "Release":
+		return repositoryURL + "/releases"
+	case "CheckSuite", "WorkflowRun":
+		return repositoryURL + "/actions"
+	}
+
+	return repositoryURL
+}
+
+func githubInboxKind(subjectType string) string {
+	switch subjectType {
+	case "PullRequest":
+		return "PR"
+	case "CheckSuite", "WorkflowRun":
+		return "CI"
+	}
+
+	return subjectType
+}
+
+type githubInboxSearchJson struct {
+	Items []struct {
+		Title         string    `json:"title"`
+		HTMLURL       string    `json:"html_url"`
+		RepositoryURL string    `json:"repository_url"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		PullRequest   *struct{} `json:"pull_request"`
+	} `json:"items"`
+}
+
+func (widget *githubInboxWidget) search(ctx context.Context, client fetch.Doer, query string) ([]githubInboxRepository, error) {
+	parameters := url.Values{}
+	parameters.Set("q", query)
+	parameters.Set("sort", "updated")
+	parameters.Set("per_page", strconv.Itoa(githubInboxPageSize))
+
+	response, err := fetch.DecodeJSON[githubInboxSearchJson](client, widget.newRequest(ctx, "GET", "/search/issues?"+parameters.Encode(), nil))
+	if err != nil {
+		return nil, err
+	}
+
+	var repositories []githubInboxRepository
+	for _, result := range response.Items {
+		_, name, _ := strings.Cut(result.RepositoryURL, "/repos/")
+		repositoryURL := result.HTMLURL
+		if i := strings.LastIndex(repositoryURL, common.Ternary(result.PullRequest != nil, "/pull/", "/issues/")); i != -1 {
+			repositoryURL = repositoryURL[:i]
+		}
+
+		repositories = githubInboxAddItem(repositories, name, repositoryURL, githubInboxItem{
+			Title:     result.Title,
+			URL:       result.HTMLURL,
+			Kind:      common.Ternary(result.PullRequest != nil, "PR", "Issue"),
+			UpdatedAt: result.UpdatedAt,
+		})
+	}
+
+	return repositories, nil
+}
+
+// Both endpoints list the most recently updated first, so repositories end up
+// in the order of their latest item
+func githubInboxAddItem(repositories []githubInboxRepository, name, repositoryURL string, item githubInboxItem) []githubInboxRepository {
+	i := slices.IndexFunc(repositories, func(repo githubInboxRepository) bool { return repo.Name == name })
+	if i == -1 {
+		repositories = append(repositories, githubInboxRepository{Name: name, URL: repositoryURL})
+		i = len(repositories) - 1
+	}
+
+	repositories[i].Items = append(repositories[i].Items, item)
+
+	return repositories
+}
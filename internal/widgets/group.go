@@ -4,6 +4,11 @@ import (
 	"context"
 	"errors"
 	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
@@ -15,6 +20,8 @@ var groupWidgetTemplate = common.MustParseTemplate("group.html", "widget-base.ht
 type groupWidget struct {
 	widgetBase          `yaml:",inline"`
 	containerWidgetBase `yaml:",inline"`
+	LazyLoad            bool          `yaml:"lazy-load"`
+	loadedTabs          []atomic.Bool `yaml:"-"`
 }
 
 func (widget *groupWidget) Initialize() error {
@@ -35,11 +42,40 @@ func (widget *groupWidget) Initialize() error {
 		return err
 	}
 
+	// tabs get loaded by requests while the group is being updated in the
+	// background, which doesn't lock containers
+	widget.loadedTabs = make([]atomic.Bool, len(widget.Widgets))
+	for i := range widget.loadedTabs {
+		widget.loadedTabs[i].Store(!widget.LazyLoad || i == 0)
+	}
+
 	return nil
 }
 
 func (widget *groupWidget) Update(ctx context.Context) {
-	widget.containerWidgetBase.Update(ctx)
+	if !widget.LazyLoad {
+		widget.containerWidgetBase.Update(ctx)
+		return
+	}
+
+	var wg sync.WaitGroup
+	now := time.Now()
+
+	for i := range widget.Widgets {
+		child := widget.Widgets[i]
+
+		if !widget.loadedTabs[i].Load() || !child.RequiresUpdate(&now) {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			models.UpdateWidget(ctx, child)
+		}()
+	}
+
+	wg.Wait()
 }
 
 func (widget *groupWidget) SetProviders(providers *models.WidgetProviders) {
@@ -48,7 +84,48 @@ func (widget *groupWidget) SetProviders(providers *models.WidgetProviders) {
 }
 
 func (widget *groupWidget) RequiresUpdate(now *time.Time) bool {
-	return widget.containerWidgetBase.RequiresUpdate(now)
+	if !widget.LazyLoad {
+		return widget.containerWidgetBase.RequiresUpdate(now)
+	}
+
+	for i := range widget.Widgets {
+		if widget.loadedTabs[i].Load() && widget.Widgets[i].RequiresUpdate(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (widget *groupWidget) IsTabLoaded(index int) bool {
+	return widget.loadedTabs[index].Load()
+}
+
+// Handles GET tabs/{index}, which updates the tab's widget if needed and
+// returns its rendered contents. Used to load tabs when lazy-load is enabled.
+func (widget *groupWidget) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tab, found := strings.CutPrefix(r.PathValue("path"), "tabs/")
+	index, err := strconv.Atoi(tab)
+	if !found || err != nil || index < 0 || index >= len(widget.Widgets) {
+		http.Error(w, "tab not found", http.StatusNotFound)
+		return
+	}
+
+	widget.loadedTabs[index].Store(true)
+	child := widget.Widgets[index]
+
+	now := time.Now()
+	if child.RequiresUpdate(&now) {
+		models.UpdateWidget(r.Context(), child)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(child.Render()))
 }
 
 func (widget *groupWidget) Render() template.HTML {
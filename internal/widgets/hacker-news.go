@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 )
 
 type hackerNewsWidget struct {
@@ -46,7 +48,7 @@ func (widget *hackerNewsWidget) Initialize() error {
 }
 
 func (widget *hackerNewsWidget) Update(ctx context.Context) {
-	posts, err := fetchHackerNewsPosts(widget.SortBy, 40, widget.CommentsUrlTemplate)
+	posts, err := fetchHackerNewsPosts(widget.httpClient(false), widget.SortBy, 40, widget.CommentsUrlTemplate)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -77,17 +79,17 @@ type hackerNewsPostResponseJson struct {
 	TimePosted   int64  `json:"time"`
 }
 
-func fetchHackerNewsPostIds(sort string) ([]int, error) {
+func fetchHackerNewsPostIds(client fetch.Doer, sort string) ([]int, error) {
 	request, _ := http.NewRequest("GET", fmt.Sprintf("https://hacker-news.firebaseio.com/v0/%sstories.json", sort), nil)
-	response, err := decodeJsonFromRequest[[]int](defaultHTTPClient, request)
+	response, err := fetch.DecodeJSON[[]int](client, request)
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not fetch list of post IDs", errNoContent)
+		return nil, fmt.Errorf("%w: could not fetch list of post IDs", models.ErrNoContent)
 	}
 
 	return response, nil
 }
 
-func fetchHackerNewsPostsFromIds(postIds []int, commentsUrlTemplate string) (forumPostList, error) {
+func fetchHackerNewsPostsFromIds(client fetch.Doer, postIds []int, commentsUrlTemplate string) (forumPostList, error) {
 	requests := make([]*http.Request, len(postIds))
 
 	for i, id := range postIds {
@@ -95,7 +97,7 @@ func fetchHackerNewsPostsFromIds(postIds []int, commentsUrlTemplate string) (for
 		requests[i] = request
 	}
 
-	task := decodeJsonFromRequestTask[hackerNewsPostResponseJson](defaultHTTPClient)
+	task := fetch.DecodeJSONTask[hackerNewsPostResponseJson](client)
 	job := newJob(task, requests).withWorkers(30)
 	results, errs, err := workerPoolDo(job)
 	if err != nil {
@@ -130,18 +132,18 @@ func fetchHackerNewsPostsFromIds(postIds []int, commentsUrlTemplate string) (for
 	}
 
 	if len(posts) == 0 {
-		return nil, errNoContent
+		return nil, models.ErrNoContent
 	}
 
 	if len(posts) != len(postIds) {
-		return posts, fmt.Errorf("%w could not fetch some hacker news posts", errPartialContent)
+		return posts, fmt.Errorf("%w could not fetch some hacker news posts", models.ErrPartialContent)
 	}
 
 	return posts, nil
 }
 
-func fetchHackerNewsPosts(sort string, limit int, commentsUrlTemplate string) (forumPostList, error) {
-	postIds, err := fetchHackerNewsPostIds(sort)
+func fetchHackerNewsPosts(client fetch.Doer, sort string, limit int, commentsUrlTemplate string) (forumPostList, error) {
+	postIds, err := fetchHackerNewsPostIds(client, sort)
 	if err != nil {
 		return nil, err
 	}
@@ -150,5 +152,5 @@ func fetchHackerNewsPosts(sort string, limit int, commentsUrlTemplate string) (f
 		postIds = postIds[:limit]
 	}
 
-	return fetchHackerNewsPostsFromIds(postIds, commentsUrlTemplate)
+	return fetchHackerNewsPostsFromIds(client, postIds, commentsUrlTemplate)
 }
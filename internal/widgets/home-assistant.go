@@ -0,0 +1,334 @@
+package widgets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+var homeAssistantWidgetTemplate = common.MustParseTemplate("home-assistant.html", "widget-base.html")
+
+// Domains whose entities can be switched on and off through the toggle service
+var homeAssistantToggleableDomains = []string{"switch", "light", "fan", "input_boolean", "automation"}
+
+type homeAssistantWidget struct {
+	widgetBase    `yaml:",inline"`
+	URL           string                `yaml:"url"`
+	Token         string                `yaml:"token"`
+	AllowInsecure bool                  `yaml:"allow-insecure"`
+	Entities      []homeAssistantEntity `yaml:"entities"`
+}
+
+type homeAssistantEntity struct {
+	ID          string                 `yaml:"id"`
+	Name        string                 `yaml:"name"`
+	Icon        models.CustomIconField `yaml:"icon"`
+	AllowToggle bool                   `yaml:"allow-toggle"`
+
+	DisplayName string                 `yaml:"-"`
+	Available   bool                   `yaml:"-"`
+	Value       string                 `yaml:"-"`
+	Details     string                 `yaml:"-"`
+	IsOn        bool                   `yaml:"-"`
+	IsOff       bool                   `yaml:"-"`
+	LastChanged time.Time              `yaml:"-"`
+	StateIcon   models.CustomIconField `yaml:"-"`
+}
+
+// Entities can also be listed using only their ID
+func (entity *homeAssistantEntity) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&entity.ID)
+	}
+
+	type entityAlias homeAssistantEntity
+	return node.Decode((*entityAlias)(entity))
+}
+
+func (widget *homeAssistantWidget) Initialize() error {
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if widget.Token == "" {
+		return errors.New("token is required")
+	}
+
+	if len(widget.Entities) == 0 {
+		return errors.New("at least one entity is required")
+	}
+
+	for i := range widget.Entities {
+		entity := &widget.Entities[i]
+		domain, _, found := strings.Cut(entity.ID, ".")
+
+		if !found {
+			return fmt.Errorf("entity %q is not a valid entity ID, such as light.kitchen", entity.ID)
+		}
+
+		if entity.AllowToggle && !slices.Contains(homeAssistantToggleableDomains, domain) {
+			return fmt.Errorf("entity %s can not be toggled, only entities of %s can", entity.ID, strings.Join(homeAssistantToggleableDomains, ", "))
+		}
+
+		entity.DisplayName = common.Ternary(entity.Name != "", entity.Name, entity.ID)
+		entity.StateIcon = common.Ternary(entity.Icon.URL != "", entity.Icon, models.NewCustomIconField(homeAssistantDefaultIcon(domain, "")))
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+	widget.withTitle("Home Assistant").withTitleURL(widget.URL).withCacheDuration(1 * time.Minute)
+
+	return nil
+}
+
+func (widget *homeAssistantWidget) Update(ctx context.Context) {
+	requests := make([]*http.Request, len(widget.Entities))
+	for i := range widget.Entities {
+		requests[i] = widget.newRequest(ctx, "GET", "/api/states/"+url.PathEscape(widget.Entities[i].ID), nil)
+	}
+
+	task := fetch.DecodeJSONTask[homeAssistantStateJson](widget.httpClient(widget.AllowInsecure))
+	states, errs, err := workerPoolDo(newJob(task, requests))
+	if err == nil {
+		var failed []string
+
+		for i := range widget.Entities {
+			if errs[i] != nil {
+				failed = append(failed, widget.Entities[i].ID)
+				slog.Error("Failed to fetch Home Assistant entity", "entity", widget.Entities[i].ID, "error", errs[i])
+				widget.Entities[i].Available = false
+				widget.Entities[i].Value = "Error"
+				widget.Entities[i].Details = ""
+				continue
+			}
+
+			widget.Entities[i].setState(&states[i])
+		}
+
+		if len(failed) == len(widget.Entities) {
+			err = errors.New("could not get the state of any entity")
+		} else if len(failed) > 0 {
+			err = fmt.Errorf("%w: could not get the state of %s", models.ErrPartialContent, strings.Join(failed, ", "))
+		}
+	}
+
+	widget.canContinueUpdateAfterHandlingErr(err)
+}
+
+func (widget *homeAssistantWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, homeAssistantWidgetTemplate)
+}
+
+func (widget *homeAssistantWidget) LocksOwnRequests() {}
+
+// Handles POST toggle/{entity}, which toggles the entity if it allows it and
+// returns the widget rendered with its new state
+func (widget *homeAssistantWidget) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	entityID, found := strings.CutPrefix(r.PathValue("path"), "toggle/")
+	if !found {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	i := slices.IndexFunc(widget.Entities, func(entity homeAssistantEntity) bool {
+		return entity.ID == entityID && entity.AllowToggle
+	})
+	if i == -1 {
+		http.Error(w, "entity not found", http.StatusNotFound)
+		return
+	}
+
+	state, err := widget.toggle(r.Context(), entityID)
+	if err != nil {
+		slog.Error("Failed to toggle Home Assistant entity", "entity", entityID, "error", err)
+		http.Error(w, "could not toggle entity", http.StatusBadGateway)
+		return
+	}
+
+	// the widget could be in the middle of updating its entities
+	widget.updateLock.Lock()
+	widget.Entities[i].setState(state)
+	widget.updateLock.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(widget.Render()))
+}
+
+func (widget *homeAssistantWidget) toggle(ctx context.Context, entityID string) (*homeAssistantStateJson, error) {
+	client := widget.httpClient(widget.AllowInsecure)
+	domain, _, _ := strings.Cut(entityID, ".")
+	body, _ := json.Marshal(map[string]string{"entity_id": entityID})
+
+	changed, err := fetch.DecodeJSON[[]homeAssistantStateJson](
+		client,
+		widget.newRequest(ctx, "POST", "/api/services/"+domain+"/toggle", body),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if i := slices.IndexFunc(changed, func(state homeAssistantStateJson) bool { return state.EntityID == entityID }); i != -1 {
+		return &changed[i], nil
+	}
+
+	// the new state isn't always included, such as when it takes a moment for
+	// the device to respond
+	state, err := fetch.DecodeJSON[homeAssistantStateJson](
+		client,
+		widget.newRequest(ctx, "GET", "/api/states/"+url.PathEscape(entityID), nil),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func (widget *homeAssistantWidget) newRequest(ctx context.Context, method, path string, body []byte) *http.Request {
+	request, _ := http.NewRequestWithContext(ctx, method, widget.URL+path, bytes.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+widget.Token)
+	request.Header.Set("Content-Type", "application/json")
+
+	return request
+}
+
+type homeAssistantStateJson struct {
+	EntityID    string    `json:"entity_id"`
+	State       string    `json:"state"`
+	LastChanged time.Time `json:"last_changed"`
+	Attributes  struct {
+		FriendlyName       string   `json:"friendly_name"`
+		Icon               string   `json:"icon"`
+		DeviceClass        string   `json:"device_class"`
+		UnitOfMeasurement  string   `json:"unit_of_measurement"`
+		CurrentTemperature *float64 `json:"current_temperature"`
+		Temperature        *float64 `json:"temperature"`
+		HVACAction         string   `json:"hvac_action"`
+	} `json:"attributes"`
+}
+
+func (entity *homeAssistantEntity) setState(state *homeAssistantStateJson) {
+	domain, _, _ := strings.Cut(entity.ID, ".")
+	attributes := &state.Attributes
+
+	if entity.Name == "" && attributes.FriendlyName != "" {
+		entity.DisplayName = attributes.FriendlyName
+	}
+
+	if entity.Icon.URL == "" {
+		icon := attributes.Icon
+		if icon == "" {
+			icon = homeAssistantDefaultIcon(domain, attributes.DeviceClass)
+		}
+		entity.StateIcon = models.NewCustomIconField(icon)
+	} else {
+		entity.StateIcon = entity.Icon
+	}
+
+	entity.Available = state.State != "unavailable" && state.State != "unknown"
+	entity.IsOn = state.State == "on"
+	entity.IsOff = state.State == "off"
+	entity.LastChanged = state.LastChanged
+	entity.Details = ""
+
+	if !entity.Available {
+		entity.Value = common.Ternary(state.State == "unknown", "Unknown", "Unavailable")
+		return
+	}
+
+	switch domain {
+	case "climate":
+		entity.Value = homeAssistantFormatTemperature(attributes.CurrentTemperature)
+		action := common.Ternary(attributes.HVACAction != "", attributes.HVACAction, state.State)
+		if attributes.Temperature != nil && state.State != "off" {
+			entity.Details = action + " to " + homeAssistantFormatTemperature(attributes.Temperature)
+		} else {
+			entity.Details = action
+		}
+	case "binary_sensor":
+		entity.Value = homeAssistantBinarySensorValue(attributes.DeviceClass, entity.IsOn)
+	default:
+		if state.State == "on" || state.State == "off" {
+			entity.Value = common.Ternary(entity.IsOn, "On", "Off")
+		} else if attributes.UnitOfMeasurement != "" {
+			entity.Value = state.State + " " + attributes.UnitOfMeasurement
+		} else {
+			entity.Value = state.State
+		}
+	}
+}
+
+func homeAssistantFormatTemperature(temperature *float64) string {
+	if temperature == nil {
+		return "-"
+	}
+
+	return strconv.FormatFloat(*temperature, 'f', -1, 64) + "°"
+}
+
+func homeAssistantBinarySensorValue(deviceClass string, on bool) string {
+	switch deviceClass {
+	case "door", "window", "opening", "garage_door":
+		return common.Ternary(on, "Open", "Closed")
+	case "motion", "occupancy", "presence":
+		return common.Ternary(on, "Detected", "Clear")
+	case "moisture":
+		return common.Ternary(on, "Wet", "Dry")
+	case "problem":
+		return common.Ternary(on, "Problem", "OK")
+	}
+
+	return common.Ternary(on, "On", "Off")
+}
+
+// Used when neither the widget nor Home Assistant specify an icon for the entity
+func homeAssistantDefaultIcon(domain, deviceClass string) string {
+	switch domain {
+	case "light":
+		return "mdi:lightbulb"
+	case "switch", "input_boolean":
+		return "mdi:toggle-switch-variant"
+	case "fan":
+		return "mdi:fan"
+	case "climate":
+		return "mdi:thermostat"
+	case "automation":
+		return "mdi:robot"
+	case "binary_sensor":
+		return "mdi:radiobox-blank"
+	}
+
+	switch deviceClass {
+	case "temperature":
+		return "mdi:thermometer"
+	case "humidity":
+		return "mdi:water-percent"
+	case "battery":
+		return "mdi:battery"
+	case "power", "energy":
+		return "mdi:flash"
+	case "illuminance":
+		return "mdi:brightness-5"
+	}
+
+	return "mdi:eye"
+}
@@ -1,20 +1,138 @@
 package widgets
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/limpdev/gander/internal/web"
 )
 
+var htmlWidgetTemplate = common.MustParseTemplate("html.html", "widget-base.html")
+
 type htmlWidget struct {
 	widgetBase `yaml:",inline"`
-	Source     template.HTML `yaml:"source"`
+	Source     template.HTML  `yaml:"source"`
+	Data       map[string]any `yaml:"data"`
+	DataSource string         `yaml:"data-source"`
+
+	sourceTemplate *template.Template
+	Rendered       template.HTML `yaml:"-"`
 }
 
 func (widget *htmlWidget) Initialize() error {
+	if widget.DataSource != "" {
+		return widget.initializeWithDataSource()
+	}
+
 	widget.withTitle("").withError(nil)
 
+	if widget.Data == nil {
+		return nil
+	}
+
+	// the source is only treated as a template when there's data to render it
+	// with, otherwise existing configs that happen to contain {{ would break
+	t, err := template.New("html").Funcs(web.GlobalTemplateFunctions).Parse(string(widget.Source))
+	if err != nil {
+		return fmt.Errorf("parsing source template: %v", err)
+	}
+
+	rendered, err := common.ExecuteTemplateToString(t, widget.Data)
+	if err != nil {
+		return err
+	}
+
+	widget.Source = template.HTML(rendered)
+
 	return nil
 }
 
+// With a data source the source gets rendered again after every update, within
+// a regular widget so that errors and updates can be shown. The data source
+// keeps its own cache so checking it often doesn't refetch anything.
+func (widget *htmlWidget) initializeWithDataSource() error {
+	if widget.Data != nil {
+		return errors.New("data and data-source can't be used together")
+	}
+
+	t, err := template.New("html").Funcs(web.GlobalTemplateFunctions).Parse(string(widget.Source))
+	if err != nil {
+		return fmt.Errorf("parsing source template: %v", err)
+	}
+
+	widget.sourceTemplate = t
+	widget.withCacheDuration(time.Minute)
+
+	if widget.Title == "" {
+		widget.HideHeader = true
+	}
+
+	return nil
+}
+
+func (widget *htmlWidget) GetDataSourceName() string {
+	return widget.DataSource
+}
+
+func (widget *htmlWidget) Update(ctx context.Context) {
+	if widget.sourceTemplate == nil {
+		return
+	}
+
+	// references get checked when the config is loaded
+	data, err := widget.Providers.DataSources[widget.DataSource].Get(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	rendered, err := common.ExecuteTemplateToString(widget.sourceTemplate, data)
+	if err != nil {
+		widget.withError(fmt.Errorf("rendering source template: %v", err))
+		return
+	}
+
+	widget.Rendered = template.HTML(rendered)
+}
+
+func (widget *htmlWidget) GetCSPSources() map[string][]string {
+	return cspSourcesOfScripts(string(widget.Source))
+}
+
 func (widget *htmlWidget) Render() template.HTML {
+	if widget.sourceTemplate != nil {
+		return widget.renderTemplate(widget, htmlWidgetTemplate)
+	}
+
 	return widget.Source
 }
+
+// The data of sources with the json format gets decoded when fetched, widgets
+// that work with the raw document get it encoded again
+func dataSourceString(data any) string {
+	if text, ok := data.(string); ok {
+		return text
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+
+	return string(encoded)
+}
+
+func dataSourceBody(ctx context.Context, providers *models.WidgetProviders, name string) ([]byte, error) {
+	// references get checked when the config is loaded
+	data, err := providers.DataSources[name].Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(dataSourceString(data)), nil
+}
@@ -5,17 +5,40 @@ import (
 	"fmt"
 	"html/template"
 	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/limpdev/gander/internal/common"
 )
 
 var iframeWidgetTemplate = common.MustParseTemplate("iframe.html", "widget-base.html")
 
+var iframeSandboxTokens = []string{
+	"allow-downloads",
+	"allow-forms",
+	"allow-modals",
+	"allow-orientation-lock",
+	"allow-pointer-lock",
+	"allow-popups",
+	"allow-popups-to-escape-sandbox",
+	"allow-presentation",
+	"allow-same-origin",
+	"allow-scripts",
+	"allow-storage-access-by-user-activation",
+	"allow-top-navigation",
+	"allow-top-navigation-by-user-activation",
+	"allow-top-navigation-to-custom-protocols",
+}
+
 type iframeWidget struct {
-	widgetBase `yaml:",inline"`
-	cachedHTML template.HTML `yaml:"-"`
-	Source     string        `yaml:"source"`
-	Height     int           `yaml:"height"`
+	widgetBase   `yaml:",inline"`
+	cachedHTML   template.HTML `yaml:"-"`
+	Source       string        `yaml:"source"`
+	Height       int           `yaml:"height"`
+	Sandbox      bool          `yaml:"sandbox"`
+	SandboxAllow []string      `yaml:"sandbox-allow"`
+	LazyLoad     bool          `yaml:"lazy-load"`
+	SandboxValue string        `yaml:"-"`
 }
 
 func (widget *iframeWidget) Initialize() error {
@@ -29,17 +52,37 @@ func (widget *iframeWidget) Initialize() error {
 		return fmt.Errorf("parsing URL: %v", err)
 	}
 
-	if widget.Height == 50 {
+	if widget.Height == 0 {
 		widget.Height = 300
 	} else if widget.Height < 50 {
 		widget.Height = 50
 	}
 
+	for _, token := range widget.SandboxAllow {
+		if !slices.Contains(iframeSandboxTokens, token) {
+			return fmt.Errorf("unknown sandbox-allow value: %s", token)
+		}
+	}
+
+	if len(widget.SandboxAllow) > 0 {
+		widget.Sandbox = true
+		widget.SandboxValue = strings.Join(widget.SandboxAllow, " ")
+	}
+
 	widget.cachedHTML = widget.renderTemplate(widget, iframeWidgetTemplate)
 
 	return nil
 }
 
+func (widget *iframeWidget) GetCSPSources() map[string][]string {
+	origin := common.OriginOfURL(widget.Source)
+	if origin == "" {
+		return nil
+	}
+
+	return map[string][]string{"frame-src": {origin}}
+}
+
 func (widget *iframeWidget) Render() template.HTML {
 	return widget.cachedHTML
 }
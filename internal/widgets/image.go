@@ -0,0 +1,144 @@
+package widgets
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var imageWidgetTemplate = common.MustParseTemplate("image.html", "widget-base.html")
+
+const imageMaxSize = 10 << 20
+
+var imageAspectRatioPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*[:/]\s*(\d+(?:\.\d+)?)$`)
+
+type imageWidget struct {
+	widgetBase      `yaml:",inline"`
+	URL             string                `yaml:"url"`
+	AllowInsecure   bool                  `yaml:"allow-insecure"`
+	RefreshInterval *models.DurationField `yaml:"refresh-interval"`
+	AspectRatio     string                `yaml:"aspect-ratio"`
+	Alt             string                `yaml:"alt"`
+}
+
+func (widget *imageWidget) Initialize() error {
+	widget.withTitle("Image").withError(nil)
+
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if !strings.HasPrefix(widget.URL, "http://") && !strings.HasPrefix(widget.URL, "https://") {
+		return errors.New("url must start with http:// or https://")
+	}
+
+	// 0s turns refreshing off
+	if widget.RefreshInterval == nil {
+		interval := models.DurationField(time.Minute)
+		widget.RefreshInterval = &interval
+	}
+
+	if widget.AspectRatio != "" {
+		matches := imageAspectRatioPattern.FindStringSubmatch(widget.AspectRatio)
+		if matches == nil {
+			return errors.New("aspect-ratio must be two numbers separated by a colon, such as 16:9")
+		}
+
+		width, _ := strconv.ParseFloat(matches[1], 64)
+		height, _ := strconv.ParseFloat(matches[2], 64)
+		if width == 0 || height == 0 {
+			return errors.New("aspect-ratio can't have a side of 0")
+		}
+
+		widget.AspectRatio = matches[1] + " / " + matches[2]
+	}
+
+	return nil
+}
+
+func (widget *imageWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, imageWidgetTemplate)
+}
+
+// In milliseconds for the browser, 0 when the image doesn't get refreshed
+func (widget *imageWidget) RefreshIntervalMilliseconds() int64 {
+	return time.Duration(*widget.RefreshInterval).Milliseconds()
+}
+
+// Fetching the image can take a while, especially from cameras, so it doesn't
+// hold up the other widgets of the page
+func (widget *imageWidget) IsStreamingRequest(r *http.Request) bool {
+	return r.PathValue("path") == "image"
+}
+
+// Handles GET image, which responds with the image fetched from the URL so
+// that the headers it needs never reach the browser
+func (widget *imageWidget) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("path") != "image" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType, image, err := widget.fetchImage(r)
+	if err != nil {
+		slog.Error("Failed to fetch image", "url", widget.URL, "error", err)
+		http.Error(w, "could not fetch image", http.StatusBadGateway)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-Content-Type-Options", "nosniff")
+	// SVGs can contain scripts, which shouldn't run if the image gets opened directly
+	header.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Write(image)
+}
+
+func (widget *imageWidget) fetchImage(r *http.Request) (string, []byte, error) {
+	request, err := http.NewRequestWithContext(r.Context(), http.MethodGet, widget.URL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	response, err := widget.httpClient(widget.AllowInsecure).Do(request)
+	if err != nil {
+		return "", nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", nil, fmt.Errorf("response is not an image, its content type is %q", contentType)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(response.Body, imageMaxSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(image) > imageMaxSize {
+		return "", nil, fmt.Errorf("image is larger than %d bytes", imageMaxSize)
+	}
+
+	return contentType, image, nil
+}
@@ -0,0 +1,221 @@
+package widgets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+)
+
+type kubernetesDiscoveredObject struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+type kubernetesIngressListResponseJson struct {
+	Items []struct {
+		kubernetesDiscoveredObject
+		Spec struct {
+			TLS []struct {
+				Hosts []string `json:"hosts"`
+			} `json:"tls"`
+			Rules []struct {
+				Host string `json:"host"`
+				HTTP struct {
+					Paths []struct {
+						Path string `json:"path"`
+					} `json:"paths"`
+				} `json:"http"`
+			} `json:"rules"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+type kubernetesHTTPRouteListResponseJson struct {
+	Items []struct {
+		kubernetesDiscoveredObject
+		Spec struct {
+			Hostnames []string `json:"hostnames"`
+			Rules     []struct {
+				Matches []struct {
+					Path struct {
+						Value string `json:"value"`
+					} `json:"path"`
+				} `json:"matches"`
+			} `json:"rules"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+const kubernetesGatewayAPIPath = "/apis/gateway.networking.k8s.io/v1"
+
+// The ingresses and the HTTP routes of the Gateway API that have at least one
+// of the discovery annotations, routes are skipped when the Gateway API isn't
+// installed in the cluster
+func discoverKubernetesServices(ctx context.Context, kubeconfig, contextName string, namespaces []string) ([]discoveredService, error) {
+	client, err := newKubernetesClient(kubeconfig, contextName, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+
+	scopes := []string{""}
+	if len(namespaces) > 0 {
+		scopes = make([]string, len(namespaces))
+		for i := range namespaces {
+			scopes[i] = "/namespaces/" + url.PathEscape(namespaces[i])
+		}
+	}
+
+	hasGatewayAPI, err := kubernetesAPIAvailable(ctx, client, kubernetesGatewayAPIPath)
+	if err != nil {
+		return nil, fmt.Errorf("checking for the Gateway API: %w", err)
+	}
+
+	var services []discoveredService
+	for _, scope := range scopes {
+		ingresses, err := fetchKubernetesList[kubernetesIngressListResponseJson](ctx, client, "/apis/networking.k8s.io/v1"+scope+"/ingresses", nil)
+		if err != nil {
+			return nil, fmt.Errorf("fetching ingresses: %w", err)
+		}
+
+		for i := range ingresses.Items {
+			ingress := &ingresses.Items[i]
+
+			var serviceURL string
+			for _, rule := range ingress.Spec.Rules {
+				if rule.Host == "" || strings.HasPrefix(rule.Host, "*") {
+					continue
+				}
+
+				var secure bool
+				for _, tls := range ingress.Spec.TLS {
+					secure = secure || slices.Contains(tls.Hosts, rule.Host)
+				}
+
+				var path string
+				if len(rule.HTTP.Paths) > 0 {
+					path = rule.HTTP.Paths[0].Path
+				}
+
+				serviceURL = kubernetesHostURL(common.Ternary(secure, "https", "http"), rule.Host, path)
+				break
+			}
+
+			if service, ok := ingress.discoveredService(serviceURL); ok {
+				services = append(services, service)
+			}
+		}
+
+		if !hasGatewayAPI {
+			continue
+		}
+
+		routes, err := fetchKubernetesList[kubernetesHTTPRouteListResponseJson](ctx, client, kubernetesGatewayAPIPath+scope+"/httproutes", nil)
+		if err != nil {
+			return nil, fmt.Errorf("fetching HTTP routes: %w", err)
+		}
+
+		for i := range routes.Items {
+			route := &routes.Items[i]
+
+			var serviceURL string
+			for _, hostname := range route.Spec.Hostnames {
+				if strings.HasPrefix(hostname, "*") {
+					continue
+				}
+
+				var path string
+				if len(route.Spec.Rules) > 0 && len(route.Spec.Rules[0].Matches) > 0 {
+					path = route.Spec.Rules[0].Matches[0].Path.Value
+				}
+
+				// whether TLS is used is up to the listener of the gateway
+				serviceURL = kubernetesHostURL("https", hostname, path)
+				break
+			}
+
+			if service, ok := route.discoveredService(serviceURL); ok {
+				services = append(services, service)
+			}
+		}
+	}
+
+	return services, nil
+}
+
+// The URL from the annotations takes precedence over the one derived from the
+// hosts of the object, ok is false when the object shouldn't be discovered
+func (o *kubernetesDiscoveredObject) discoveredService(hostURL string) (discoveredService, bool) {
+	annotations := o.Metadata.Annotations
+
+	if !hasDiscoveryLabels(annotations) || common.StringToBool(discoveryLabel(annotations, discoveryLabelHide)) {
+		return discoveredService{}, false
+	}
+
+	serviceURL := discoveryLabel(annotations, discoveryLabelURL)
+	if serviceURL == "" {
+		serviceURL = hostURL
+	}
+
+	if serviceURL == "" {
+		return discoveredService{}, false
+	}
+
+	name := discoveryLabel(annotations, discoveryLabelName)
+	if name == "" {
+		name = o.Metadata.Name
+	}
+
+	return discoveredService{
+		Name:        name,
+		URL:         serviceURL,
+		Icon:        models.NewCustomIconField(discoveryLabel(annotations, discoveryLabelIcon)),
+		Description: discoveryLabel(annotations, discoveryLabelDescription),
+		Group:       discoveryLabel(annotations, discoveryLabelGroup),
+		SameTab:     common.StringToBool(discoveryLabel(annotations, discoveryLabelSameTab)),
+	}, true
+}
+
+func kubernetesHostURL(scheme, host, path string) string {
+	hostURL := url.URL{Scheme: scheme, Host: host}
+	if path != "/" {
+		hostURL.Path = path
+	}
+
+	return hostURL.String()
+}
+
+func kubernetesAPIAvailable(ctx context.Context, client *kubernetesClient, path string) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", client.server+path, nil)
+	if err != nil {
+		return false, err
+	}
+
+	if err := client.authorize(request); err != nil {
+		return false, err
+	}
+
+	response, err := client.http.Do(request)
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status code %d from %s", response.StatusCode, request.URL)
+	}
+}
@@ -0,0 +1,681 @@
+package widgets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+var kubernetesWidgetTemplate = common.MustParseTemplate("kubernetes.html", "widget-base.html")
+
+const (
+	kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// How long a pod can be pending or not ready before it counts as unhealthy,
+	// pods that are starting up normally would otherwise show up briefly
+	kubernetesPodGracePeriod = 2 * time.Minute
+)
+
+type kubernetesWidget struct {
+	widgetBase    `yaml:",inline"`
+	Kubeconfig    string            `yaml:"kubeconfig"`
+	Context       string            `yaml:"context"`
+	Namespaces    []string          `yaml:"namespaces"`
+	LabelSelector string            `yaml:"label-selector"`
+	NodeSelector  string            `yaml:"node-selector"`
+	HideNodes     bool              `yaml:"hide-nodes"`
+	CollapseAfter int               `yaml:"collapse-after"`
+	Cluster       kubernetesCluster `yaml:"-"`
+}
+
+func (widget *kubernetesWidget) Initialize() error {
+	widget.withTitle("Kubernetes").withCacheDuration(1 * time.Minute)
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	if widget.Context != "" && widget.Kubeconfig == "" {
+		widget.Kubeconfig = defaultKubeconfigPath()
+	}
+
+	return nil
+}
+
+func (widget *kubernetesWidget) Update(ctx context.Context) {
+	var cluster kubernetesCluster
+
+	client, err := newKubernetesClient(widget.Kubeconfig, widget.Context, time.Duration(widget.RequestTimeout))
+	if err == nil {
+		defer client.close()
+		client.http = fetch.WithByteCounter(client.http, &widget.bytesFetched)
+		cluster, err = fetchKubernetesCluster(ctx, client, widget.Namespaces, widget.LabelSelector, widget.NodeSelector, widget.HideNodes)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Cluster = cluster
+}
+
+func (widget *kubernetesWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, kubernetesWidgetTemplate)
+}
+
+type kubernetesCluster struct {
+	NodesShown         bool
+	Nodes              int
+	ReadyNodes         int
+	NotReadyNodes      []kubernetesNode
+	Pods               int
+	UnhealthyPods      int
+	Deployments        int
+	PendingDeployments int
+	// Only the namespaces that have something wrong with them
+	Namespaces []kubernetesNamespace
+}
+
+type kubernetesNode struct {
+	Name   string
+	Reason string
+}
+
+type kubernetesNamespace struct {
+	Name               string
+	UnhealthyPods      []kubernetesPod
+	PendingDeployments []kubernetesDeployment
+}
+
+type kubernetesPod struct {
+	Name     string
+	Reason   string
+	Restarts int
+}
+
+type kubernetesDeployment struct {
+	Name      string
+	Reason    string
+	Ready     int
+	Desired   int
+	UpToDate  int
+	Available int
+}
+
+type kubernetesCondition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+type kubernetesMetadata struct {
+	Name              string     `json:"name"`
+	Namespace         string     `json:"namespace"`
+	Generation        int64      `json:"generation"`
+	CreationTimestamp time.Time  `json:"creationTimestamp"`
+	DeletionTimestamp *time.Time `json:"deletionTimestamp"`
+}
+
+type kubernetesNodeListResponseJson struct {
+	Items []struct {
+		Metadata kubernetesMetadata `json:"metadata"`
+		Spec     struct {
+			Unschedulable bool `json:"unschedulable"`
+		} `json:"spec"`
+		Status struct {
+			Conditions []kubernetesCondition `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type kubernetesContainerStatus struct {
+	Ready        bool `json:"ready"`
+	RestartCount int  `json:"restartCount"`
+	State        struct {
+		Waiting *struct {
+			Reason string `json:"reason"`
+		} `json:"waiting"`
+		Terminated *struct {
+			Reason   string `json:"reason"`
+			ExitCode int    `json:"exitCode"`
+		} `json:"terminated"`
+	} `json:"state"`
+}
+
+type kubernetesPodListResponseJson struct {
+	Items []struct {
+		Metadata kubernetesMetadata `json:"metadata"`
+		Status   struct {
+			Phase                 string                      `json:"phase"`
+			Reason                string                      `json:"reason"`
+			Conditions            []kubernetesCondition       `json:"conditions"`
+			InitContainerStatuses []kubernetesContainerStatus `json:"initContainerStatuses"`
+			ContainerStatuses     []kubernetesContainerStatus `json:"containerStatuses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type kubernetesDeploymentListResponseJson struct {
+	Items []struct {
+		Metadata kubernetesMetadata `json:"metadata"`
+		Spec     struct {
+			Replicas *int `json:"replicas"`
+		} `json:"spec"`
+		Status struct {
+			ObservedGeneration int64                 `json:"observedGeneration"`
+			Replicas           int                   `json:"replicas"`
+			UpdatedReplicas    int                   `json:"updatedReplicas"`
+			ReadyReplicas      int                   `json:"readyReplicas"`
+			AvailableReplicas  int                   `json:"availableReplicas"`
+			Conditions         []kubernetesCondition `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+func findKubernetesCondition(conditions []kubernetesCondition, conditionType string) *kubernetesCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// Reasons for containers waiting that won't resolve on their own
+var kubernetesFailingWaitReasons = []string{
+	"CrashLoopBackOff",
+	"ImagePullBackOff",
+	"ErrImagePull",
+	"InvalidImageName",
+	"CreateContainerConfigError",
+	"CreateContainerError",
+	"RunContainerError",
+}
+
+// Returns why the pod is unhealthy, or an empty string if it isn't
+func kubernetesPodProblem(
+	phase, reason string,
+	conditions []kubernetesCondition,
+	containers []kubernetesContainerStatus,
+	createdAt time.Time,
+	now time.Time,
+) string {
+	for i := range containers {
+		if waiting := containers[i].State.Waiting; waiting != nil && slices.Contains(kubernetesFailingWaitReasons, waiting.Reason) {
+			return waiting.Reason
+		}
+	}
+
+	switch phase {
+	case "Succeeded":
+		return ""
+	case "Failed", "Unknown":
+		return common.Ternary(reason != "", reason, phase)
+	case "Pending":
+		if now.Sub(createdAt) < kubernetesPodGracePeriod {
+			return ""
+		}
+
+		if scheduled := findKubernetesCondition(conditions, "PodScheduled"); scheduled != nil && scheduled.Status == "False" {
+			return common.Ternary(scheduled.Reason != "", scheduled.Reason, "Unschedulable")
+		}
+
+		return "Pending"
+	}
+
+	for i := range containers {
+		if terminated := containers[i].State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return common.Ternary(terminated.Reason != "", terminated.Reason, "Error")
+		}
+	}
+
+	if ready := findKubernetesCondition(conditions, "Ready"); ready != nil && ready.Status != "True" &&
+		now.Sub(ready.LastTransitionTime) >= kubernetesPodGracePeriod {
+		return "NotReady"
+	}
+
+	return ""
+}
+
+func fetchKubernetesCluster(
+	ctx context.Context,
+	client *kubernetesClient,
+	namespaces []string,
+	labelSelector string,
+	nodeSelector string,
+	hideNodes bool,
+) (kubernetesCluster, error) {
+	cluster := kubernetesCluster{NodesShown: !hideNodes}
+	now := time.Now()
+
+	scopes := []string{""}
+	if len(namespaces) > 0 {
+		scopes = make([]string, len(namespaces))
+		for i := range namespaces {
+			scopes[i] = "/namespaces/" + url.PathEscape(namespaces[i])
+		}
+	}
+
+	query := url.Values{}
+	if labelSelector != "" {
+		query.Set("labelSelector", labelSelector)
+	}
+
+	byNamespace := make(map[string]*kubernetesNamespace)
+	namespaceNamed := func(name string) *kubernetesNamespace {
+		namespace, exists := byNamespace[name]
+		if !exists {
+			namespace = &kubernetesNamespace{Name: name}
+			byNamespace[name] = namespace
+		}
+
+		return namespace
+	}
+
+	for _, scope := range scopes {
+		pods, err := fetchKubernetesList[kubernetesPodListResponseJson](ctx, client, "/api/v1"+scope+"/pods", query)
+		if err != nil {
+			return cluster, fmt.Errorf("fetching pods: %w", err)
+		}
+
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			// pods that are being deleted are expected to be on their way out
+			if pod.Metadata.DeletionTimestamp != nil {
+				continue
+			}
+
+			cluster.Pods++
+
+			containers := slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses)
+			problem := kubernetesPodProblem(
+				pod.Status.Phase,
+				pod.Status.Reason,
+				pod.Status.Conditions,
+				containers,
+				pod.Metadata.CreationTimestamp,
+				now,
+			)
+			if problem == "" {
+				continue
+			}
+
+			restarts := 0
+			for c := range containers {
+				restarts += containers[c].RestartCount
+			}
+
+			cluster.UnhealthyPods++
+			namespace := namespaceNamed(pod.Metadata.Namespace)
+			namespace.UnhealthyPods = append(namespace.UnhealthyPods, kubernetesPod{
+				Name:     pod.Metadata.Name,
+				Reason:   problem,
+				Restarts: restarts,
+			})
+		}
+
+		deployments, err := fetchKubernetesList[kubernetesDeploymentListResponseJson](ctx, client, "/apis/apps/v1"+scope+"/deployments", query)
+		if err != nil {
+			return cluster, fmt.Errorf("fetching deployments: %w", err)
+		}
+
+		for i := range deployments.Items {
+			deployment := &deployments.Items[i]
+			status := &deployment.Status
+			desired := 1
+			if deployment.Spec.Replicas != nil {
+				desired = *deployment.Spec.Replicas
+			}
+
+			cluster.Deployments++
+
+			var reason string
+			if progressing := findKubernetesCondition(status.Conditions, "Progressing"); progressing != nil &&
+				progressing.Reason == "ProgressDeadlineExceeded" {
+				reason = "Stalled"
+			} else if status.ObservedGeneration < deployment.Metadata.Generation ||
+				status.UpdatedReplicas < desired ||
+				status.Replicas > status.UpdatedReplicas {
+				reason = "Rolling out"
+			} else if status.AvailableReplicas < desired {
+				reason = "Unavailable"
+			} else {
+				continue
+			}
+
+			cluster.PendingDeployments++
+			namespace := namespaceNamed(deployment.Metadata.Namespace)
+			namespace.PendingDeployments = append(namespace.PendingDeployments, kubernetesDeployment{
+				Name:      deployment.Metadata.Name,
+				Reason:    reason,
+				Ready:     status.ReadyReplicas,
+				Desired:   desired,
+				UpToDate:  status.UpdatedReplicas,
+				Available: status.AvailableReplicas,
+			})
+		}
+	}
+
+	cluster.Namespaces = make([]kubernetesNamespace, 0, len(byNamespace))
+	for _, name := range slices.Sorted(maps.Keys(byNamespace)) {
+		cluster.Namespaces = append(cluster.Namespaces, *byNamespace[name])
+	}
+
+	if hideNodes {
+		return cluster, nil
+	}
+
+	nodeQuery := url.Values{}
+	if nodeSelector != "" {
+		nodeQuery.Set("labelSelector", nodeSelector)
+	}
+
+	nodes, err := fetchKubernetesList[kubernetesNodeListResponseJson](ctx, client, "/api/v1/nodes", nodeQuery)
+	if err != nil {
+		// commonly not allowed for accounts that are limited to a few namespaces
+		cluster.NodesShown = false
+		return cluster, fmt.Errorf("%w: fetching nodes: %v", models.ErrPartialContent, err)
+	}
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		cluster.Nodes++
+
+		ready := findKubernetesCondition(node.Status.Conditions, "Ready")
+		switch {
+		case ready == nil || ready.Status != "True":
+			cluster.NotReadyNodes = append(cluster.NotReadyNodes, kubernetesNode{Name: node.Metadata.Name, Reason: "NotReady"})
+		case node.Spec.Unschedulable:
+			cluster.ReadyNodes++
+			cluster.NotReadyNodes = append(cluster.NotReadyNodes, kubernetesNode{Name: node.Metadata.Name, Reason: "Cordoned"})
+		default:
+			cluster.ReadyNodes++
+		}
+	}
+
+	return cluster, nil
+}
+
+func fetchKubernetesList[T any](ctx context.Context, client *kubernetesClient, path string, query url.Values) (T, error) {
+	var result T
+
+	request, err := http.NewRequestWithContext(ctx, "GET", client.server+path, nil)
+	if err != nil {
+		return result, err
+	}
+	request.URL.RawQuery = query.Encode()
+
+	if err := client.authorize(request); err != nil {
+		return result, err
+	}
+
+	return fetch.DecodeJSON[T](client.http, request)
+}
+
+type kubernetesClient struct {
+	server    string
+	http      *http.Client
+	transport *http.Transport
+	// Read on every request since service account tokens get rotated
+	tokenFile string
+	token     string
+	username  string
+	password  string
+}
+
+func (c *kubernetesClient) authorize(request *http.Request) error {
+	token := c.token
+	if c.tokenFile != "" {
+		contents, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return fmt.Errorf("reading token: %w", err)
+		}
+		token = strings.TrimSpace(string(contents))
+	}
+
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	} else if c.username != "" {
+		request.SetBasicAuth(c.username, c.password)
+	}
+
+	return nil
+}
+
+func (c *kubernetesClient) close() {
+	c.transport.CloseIdleConnections()
+}
+
+func defaultKubeconfigPath() string {
+	if path := os.Getenv("KUBECONFIG"); path != "" {
+		// only the first of multiple files is used
+		return filepath.SplitList(path)[0]
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".kube", "config")
+}
+
+// Uses the credentials of the service account when running within a cluster
+// and no kubeconfig was given, otherwise the kubeconfig from its usual place
+func newKubernetesClient(kubeconfigPath, contextName string, timeout time.Duration) (*kubernetesClient, error) {
+	client := &kubernetesClient{}
+	tlsConfig := &tls.Config{}
+
+	if host := os.Getenv("KUBERNETES_SERVICE_HOST"); kubeconfigPath == "" && host != "" {
+		client.server = "https://" + net.JoinHostPort(host, os.Getenv("KUBERNETES_SERVICE_PORT"))
+		client.tokenFile = filepath.Join(kubernetesServiceAccountDir, "token")
+
+		ca, err := os.ReadFile(filepath.Join(kubernetesServiceAccountDir, "ca.crt"))
+		if err != nil {
+			return nil, fmt.Errorf("reading certificate authority of service account: %w", err)
+		}
+
+		if tlsConfig.RootCAs, err = kubernetesCertPool(ca); err != nil {
+			return nil, err
+		}
+	} else {
+		if kubeconfigPath == "" {
+			kubeconfigPath = defaultKubeconfigPath()
+		}
+
+		if err := client.loadKubeconfig(kubeconfigPath, contextName, tlsConfig); err != nil {
+			return nil, fmt.Errorf("loading kubeconfig: %w", err)
+		}
+	}
+
+	client.transport = &http.Transport{
+		TLSClientConfig: tlsConfig,
+		Proxy:           http.ProxyFromEnvironment,
+		DialContext:     fetch.DialContext,
+	}
+	client.http = &http.Client{
+		Transport: client.transport,
+		Timeout:   common.Ternary(timeout > 0, timeout, common.DefaultClientTimeout),
+	}
+
+	return client, nil
+}
+
+type kubeconfigFile struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			TLSServerName            string `yaml:"tls-server-name"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string    `yaml:"token"`
+			TokenFile             string    `yaml:"tokenFile"`
+			ClientCertificate     string    `yaml:"client-certificate"`
+			ClientCertificateData string    `yaml:"client-certificate-data"`
+			ClientKey             string    `yaml:"client-key"`
+			ClientKeyData         string    `yaml:"client-key-data"`
+			Username              string    `yaml:"username"`
+			Password              string    `yaml:"password"`
+			Exec                  yaml.Node `yaml:"exec"`
+			AuthProvider          yaml.Node `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+func (c *kubernetesClient) loadKubeconfig(path, contextName string, tlsConfig *tls.Config) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var kubeconfig kubeconfigFile
+	if err := yaml.Unmarshal(contents, &kubeconfig); err != nil {
+		return err
+	}
+
+	if contextName == "" {
+		contextName = kubeconfig.CurrentContext
+	}
+
+	var cluster, user string
+	contextFound := false
+	for i := range kubeconfig.Contexts {
+		if kubeconfig.Contexts[i].Name == contextName {
+			cluster, user = kubeconfig.Contexts[i].Context.Cluster, kubeconfig.Contexts[i].Context.User
+			contextFound = true
+			break
+		}
+	}
+	if !contextFound {
+		return fmt.Errorf("context %q not found", contextName)
+	}
+
+	// relative paths within the kubeconfig are relative to the kubeconfig itself
+	dir := filepath.Dir(path)
+	readFileOrData := func(file, data string) ([]byte, error) {
+		if data != "" {
+			return base64.StdEncoding.DecodeString(data)
+		}
+
+		if file == "" {
+			return nil, nil
+		}
+
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+
+		return os.ReadFile(file)
+	}
+
+	clusterFound := false
+	for i := range kubeconfig.Clusters {
+		if kubeconfig.Clusters[i].Name != cluster {
+			continue
+		}
+
+		config := &kubeconfig.Clusters[i].Cluster
+		clusterFound = true
+		c.server = strings.TrimRight(config.Server, "/")
+		tlsConfig.ServerName = config.TLSServerName
+		tlsConfig.InsecureSkipVerify = config.InsecureSkipTLSVerify
+
+		ca, err := readFileOrData(config.CertificateAuthority, config.CertificateAuthorityData)
+		if err != nil {
+			return fmt.Errorf("reading certificate authority of cluster %s: %w", cluster, err)
+		}
+
+		if ca != nil {
+			if tlsConfig.RootCAs, err = kubernetesCertPool(ca); err != nil {
+				return err
+			}
+		}
+	}
+	if !clusterFound {
+		return fmt.Errorf("cluster %q of context %q not found", cluster, contextName)
+	}
+
+	for i := range kubeconfig.Users {
+		if kubeconfig.Users[i].Name != user {
+			continue
+		}
+
+		credentials := &kubeconfig.Users[i].User
+		if !credentials.Exec.IsZero() || !credentials.AuthProvider.IsZero() {
+			return fmt.Errorf("user %s authenticates through a plugin, which isn't supported, use a token or a client certificate instead", user)
+		}
+
+		c.token, c.username, c.password = credentials.Token, credentials.Username, credentials.Password
+		if credentials.TokenFile != "" {
+			c.tokenFile = common.Ternary(filepath.IsAbs(credentials.TokenFile), credentials.TokenFile, filepath.Join(dir, credentials.TokenFile))
+		}
+
+		cert, err := readFileOrData(credentials.ClientCertificate, credentials.ClientCertificateData)
+		if err != nil {
+			return fmt.Errorf("reading client certificate of user %s: %w", user, err)
+		}
+
+		key, err := readFileOrData(credentials.ClientKey, credentials.ClientKeyData)
+		if err != nil {
+			return fmt.Errorf("reading client key of user %s: %w", user, err)
+		}
+
+		if cert != nil || key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return fmt.Errorf("client certificate of user %s: %w", user, err)
+			}
+
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+
+	if c.server == "" {
+		return errors.New("cluster has no server")
+	}
+
+	return nil
+}
+
+func kubernetesCertPool(pem []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("certificate authority contains no valid certificates")
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,350 @@
+package widgets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var listWidgetTemplate = common.MustParseTemplate("list.html", "widget-base.html")
+
+const (
+	listMaxRequestBodySize = 64 << 10
+	listMaxItemLength      = 500
+	listMaxItems           = 500
+	// Proxies tend to close connections that have been quiet for a while
+	listKeepAliveInterval = 30 * time.Second
+)
+
+type listWidget struct {
+	widgetBase   `yaml:",inline"`
+	ListID       string   `yaml:"id"`
+	Editors      []string `yaml:"editors"`
+	EditorGroups []string `yaml:"editor-groups"`
+
+	stateKey string `yaml:"-"`
+}
+
+type listItem struct {
+	ID      string `json:"id"`
+	Text    string `json:"text"`
+	Checked bool   `json:"checked"`
+	AddedBy string `json:"added_by,omitempty"`
+}
+
+func (widget *listWidget) Initialize() error {
+	widget.withTitle("List").withError(nil)
+
+	id := sha256.Sum256([]byte(widget.ListID))
+	widget.stateKey = "list-" + hex.EncodeToString(id[:8])
+
+	return nil
+}
+
+func (widget *listWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, listWidgetTemplate)
+}
+
+func (widget *listWidget) GetEditors() ([]string, []string) {
+	return widget.Editors, widget.EditorGroups
+}
+
+func (widget *listWidget) IsStreamingRequest(r *http.Request) bool {
+	return r.PathValue("path") == "events"
+}
+
+// Without authentication everyone who can see the list can also change it
+func (widget *listWidget) canEdit(r *http.Request) bool {
+	username, user := models.WidgetRequestUser(r)
+	if username == "" {
+		return widget.Providers != nil && !widget.Providers.RequiresAuth
+	}
+
+	return models.IsUserAllowed(username, user, widget.Editors, widget.EditorGroups)
+}
+
+// Handles
+//
+//	GET items, which returns the items of the list along with whether the user can change them
+//	GET events, a stream of server-sent events with the items whenever they change
+//	POST items, which adds the item in the body
+//	PATCH items/{id}, which checks or unchecks the item
+//	DELETE items/{id}, which removes the item
+//	POST clear-checked, which removes every checked item
+//
+// Changes respond with the items of the list once they've been made
+func (widget *listWidget) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	path := r.PathValue("path")
+	list := sharedListByKey(widget.stateKey)
+
+	if err := list.load(widget.Providers); err != nil {
+		slog.Error("Failed to load list", "id", widget.ListID, "error", err)
+		http.Error(w, "could not load list", http.StatusInternalServerError)
+		return
+	}
+
+	if path == "events" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		list.stream(w, r)
+		return
+	}
+
+	if path == "items" && r.Method == http.MethodGet {
+		writeListJSON(w, map[string]any{
+			"items":    list.snapshot(),
+			"can_edit": widget.canEdit(r),
+		})
+		return
+	}
+
+	if !widget.canEdit(r) {
+		http.Error(w, "you can't change this list", http.StatusForbidden)
+		return
+	}
+
+	var err error
+	itemID, isItemPath := strings.CutPrefix(path, "items/")
+
+	switch {
+	case path == "items" && r.Method == http.MethodPost:
+		var item listItem
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, listMaxRequestBodySize)).Decode(&item); err != nil {
+			http.Error(w, "invalid item", http.StatusBadRequest)
+			return
+		}
+
+		item.Text = strings.TrimSpace(item.Text)
+		if item.Text == "" || utf8.RuneCountInString(item.Text) > listMaxItemLength {
+			http.Error(w, fmt.Sprintf("items must be between 1 and %d characters long", listMaxItemLength), http.StatusBadRequest)
+			return
+		}
+
+		item.ID = newTodoItemID(item.ID)
+		item.AddedBy, _ = models.WidgetRequestUser(r)
+		err = list.change(widget.Providers, func(items []listItem) ([]listItem, error) {
+			if len(items) >= listMaxItems {
+				return nil, errListFull
+			}
+
+			// retried requests shouldn't add the same item twice
+			if slices.ContainsFunc(items, func(existing listItem) bool { return existing.ID == item.ID }) {
+				return items, nil
+			}
+
+			return append(items, item), nil
+		})
+	case isItemPath && r.Method == http.MethodPatch:
+		var change struct {
+			Checked bool `json:"checked"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, listMaxRequestBodySize)).Decode(&change); err != nil {
+			http.Error(w, "invalid change", http.StatusBadRequest)
+			return
+		}
+
+		err = list.change(widget.Providers, func(items []listItem) ([]listItem, error) {
+			for i := range items {
+				if items[i].ID == itemID {
+					items[i].Checked = change.Checked
+				}
+			}
+
+			return items, nil
+		})
+	case isItemPath && r.Method == http.MethodDelete:
+		err = list.change(widget.Providers, func(items []listItem) ([]listItem, error) {
+			return slices.DeleteFunc(items, func(item listItem) bool { return item.ID == itemID }), nil
+		})
+	case path == "clear-checked" && r.Method == http.MethodPost:
+		err = list.change(widget.Providers, func(items []listItem) ([]listItem, error) {
+			return slices.DeleteFunc(items, func(item listItem) bool { return item.Checked }), nil
+		})
+	case path == "items" || isItemPath || path == "clear-checked":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, errListFull) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		slog.Error("Failed to save list", "id", widget.ListID, "error", err)
+		http.Error(w, "could not save list", http.StatusInternalServerError)
+		return
+	}
+
+	writeListJSON(w, map[string]any{"items": list.snapshot()})
+}
+
+func writeListJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+var errListFull = fmt.Errorf("lists can have at most %d items", listMaxItems)
+
+// Widgets with the same ID share their list, including ones on different
+// pages and ones from before the config got reloaded, so lists are kept
+// outside of the widgets
+var (
+	sharedListsLock sync.Mutex
+	sharedLists     = make(map[string]*sharedList)
+)
+
+type sharedList struct {
+	mu          sync.Mutex
+	key         string
+	loaded      bool
+	items       []listItem
+	subscribers map[chan []listItem]struct{}
+}
+
+func sharedListByKey(key string) *sharedList {
+	sharedListsLock.Lock()
+	defer sharedListsLock.Unlock()
+
+	list, exists := sharedLists[key]
+	if !exists {
+		list = &sharedList{key: key, subscribers: make(map[chan []listItem]struct{})}
+		sharedLists[key] = list
+	}
+
+	return list
+}
+
+// The items are only read from the state store once, after which every
+// change to them goes through the list
+func (list *sharedList) load(providers *models.WidgetProviders) error {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	if list.loaded {
+		return nil
+	}
+
+	if providers != nil && providers.State != nil {
+		if err := providers.State.LoadWidgetState(list.key, &list.items); err != nil {
+			return err
+		}
+	}
+
+	list.loaded = true
+	return nil
+}
+
+func (list *sharedList) snapshot() []listItem {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	return slices.Clone(common.Ternary(list.items == nil, []listItem{}, list.items))
+}
+
+// Saves the items returned by apply and sends them to everyone subscribed to
+// the list, apply gets a copy of the items so it's free to modify them
+func (list *sharedList) change(providers *models.WidgetProviders, apply func([]listItem) ([]listItem, error)) error {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	items, err := apply(slices.Clone(list.items))
+	if err != nil {
+		return err
+	}
+
+	if providers != nil && providers.State != nil {
+		if err := providers.State.SaveWidgetState(list.key, items); err != nil {
+			return err
+		}
+	}
+
+	list.items = items
+
+	for subscriber := range list.subscribers {
+		// subscribers only care about the latest items, so ones that haven't
+		// gotten to the previous change yet get this one instead
+		select {
+		case <-subscriber:
+		default:
+		}
+		subscriber <- slices.Clone(items)
+	}
+
+	return nil
+}
+
+func (list *sharedList) subscribe() (chan []listItem, func()) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	subscriber := make(chan []listItem, 1)
+	subscriber <- slices.Clone(common.Ternary(list.items == nil, []listItem{}, list.items))
+	list.subscribers[subscriber] = struct{}{}
+
+	return subscriber, func() {
+		list.mu.Lock()
+		delete(list.subscribers, subscriber)
+		list.mu.Unlock()
+	}
+}
+
+// Sends the items as soon as the stream starts, so that clients which got
+// reconnected catch up on what they missed, and then again after each change
+func (list *sharedList) stream(w http.ResponseWriter, r *http.Request) {
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// stops nginx from buffering the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	updates, unsubscribe := list.subscribe()
+	defer unsubscribe()
+
+	keepAlive := time.NewTicker(listKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-r.Context().Done():
+			return
+		case items := <-updates:
+			data, _ := json.Marshal(items)
+			_, err = fmt.Fprintf(w, "event: items\ndata: %s\n\n", data)
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		}
+
+		if err == nil {
+			err = controller.Flush()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
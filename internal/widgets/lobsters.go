@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 )
 
 type lobstersWidget struct {
@@ -47,7 +49,7 @@ func (widget *lobstersWidget) Initialize() error {
 }
 
 func (widget *lobstersWidget) Update(ctx context.Context) {
-	posts, err := fetchLobstersPosts(widget.CustomURL, widget.InstanceURL, widget.SortBy, widget.Tags)
+	posts, err := fetchLobstersPosts(widget.httpClient(false), widget.CustomURL, widget.InstanceURL, widget.SortBy, widget.Tags)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -76,13 +78,13 @@ type lobstersPostResponseJson struct {
 
 type lobstersFeedResponseJson []lobstersPostResponseJson
 
-func fetchLobstersPostsFromFeed(feedUrl string) (forumPostList, error) {
+func fetchLobstersPostsFromFeed(client fetch.Doer, feedUrl string) (forumPostList, error) {
 	request, err := http.NewRequest("GET", feedUrl, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	feed, err := decodeJsonFromRequest[lobstersFeedResponseJson](defaultHTTPClient, request)
+	feed, err := fetch.DecodeJSON[lobstersFeedResponseJson](client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -105,13 +107,13 @@ func fetchLobstersPostsFromFeed(feedUrl string) (forumPostList, error) {
 	}
 
 	if len(posts) == 0 {
-		return nil, errNoContent
+		return nil, models.ErrNoContent
 	}
 
 	return posts, nil
 }
 
-func fetchLobstersPosts(customURL string, instanceURL string, sortBy string, tags []string) (forumPostList, error) {
+func fetchLobstersPosts(client fetch.Doer, customURL string, instanceURL string, sortBy string, tags []string) (forumPostList, error) {
 	var feedUrl string
 
 	if customURL != "" {
@@ -137,7 +139,7 @@ func fetchLobstersPosts(customURL string, instanceURL string, sortBy string, tag
 		}
 	}
 
-	posts, err := fetchLobstersPostsFromFeed(feedUrl)
+	posts, err := fetchLobstersPostsFromFeed(client, feedUrl)
 	if err != nil {
 		return nil, err
 	}
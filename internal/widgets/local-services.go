@@ -0,0 +1,642 @@
+package widgets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var localServicesWidgetTemplate = common.MustParseTemplate("local-services.html", "widget-base.html")
+
+const (
+	localServicesProtocolMDNS = "mdns"
+	localServicesProtocolSSDP = "ssdp"
+)
+
+var (
+	mdnsAddress = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	ssdpAddress = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+)
+
+const mdnsServicesEnumerationName = "_services._dns-sd._udp.local."
+
+// What the more common service types get shown as, those that describe the
+// device rather than a service it offers are left out
+var mdnsServiceTypeLabels = map[string]string{
+	"_ipp._tcp":             "Printer",
+	"_ipps._tcp":            "Printer",
+	"_printer._tcp":         "Printer",
+	"_pdl-datastream._tcp":  "Printer",
+	"_scanner._tcp":         "Scanner",
+	"_uscan._tcp":           "Scanner",
+	"_uscans._tcp":          "Scanner",
+	"_googlecast._tcp":      "Chromecast",
+	"_airplay._tcp":         "AirPlay",
+	"_raop._tcp":            "AirPlay audio",
+	"_spotify-connect._tcp": "Spotify Connect",
+	"_daap._tcp":            "Music library",
+	"_smb._tcp":             "SMB",
+	"_afpovertcp._tcp":      "AFP",
+	"_nfs._tcp":             "NFS",
+	"_adisk._tcp":           "Time Machine",
+	"_ssh._tcp":             "SSH",
+	"_sftp-ssh._tcp":        "SFTP",
+	"_http._tcp":            "Web",
+	"_https._tcp":           "Web",
+	"_hap._tcp":             "HomeKit",
+	"_matter._tcp":          "Matter",
+	"_home-assistant._tcp":  "Home Assistant",
+	"_mqtt._tcp":            "MQTT",
+	"_workstation._tcp":     "Workstation",
+	"_device-info._tcp":     "",
+	"_companion-link._tcp":  "",
+	"_sleep-proxy._udp":     "",
+}
+
+var ssdpDeviceTypeLabels = map[string]string{
+	"MediaRenderer":         "Media renderer",
+	"MediaServer":           "Media server",
+	"InternetGatewayDevice": "Router",
+	"WANDevice":             "Router",
+	"Printer":               "Printer",
+	"Scanner":               "Scanner",
+	"HVAC_System":           "Thermostat",
+	"DimmableLight":         "Light",
+	"BinaryLight":           "Light",
+	"Basic":                 "UPnP",
+}
+
+type localServicesWidget struct {
+	widgetBase     `yaml:",inline"`
+	Protocols      []string             `yaml:"protocols"`
+	Types          []string             `yaml:"types"`
+	BrowseDuration models.DurationField `yaml:"browse-duration"`
+	CollapseAfter  int                  `yaml:"collapse-after"`
+	Devices        []localDevice        `yaml:"-"`
+
+	mdnsTypes []string `yaml:"-"`
+	ssdpTypes []string `yaml:"-"`
+}
+
+// Services are grouped by the address of the device offering them
+type localDevice struct {
+	Name     string
+	Address  string
+	URL      string
+	Model    string
+	Services []string
+}
+
+func (widget *localServicesWidget) Initialize() error {
+	widget.withTitle("Local Services").withCacheDuration(5 * time.Minute)
+
+	if len(widget.Protocols) == 0 {
+		widget.Protocols = []string{localServicesProtocolMDNS, localServicesProtocolSSDP}
+	}
+
+	for _, protocol := range widget.Protocols {
+		if protocol != localServicesProtocolMDNS && protocol != localServicesProtocolSSDP {
+			return fmt.Errorf("protocol must be either %s or %s, got %q", localServicesProtocolMDNS, localServicesProtocolSSDP, protocol)
+		}
+	}
+
+	// service types of mDNS start with an underscore, unlike device types of SSDP
+	for _, t := range widget.Types {
+		if strings.HasPrefix(t, "_") {
+			widget.mdnsTypes = append(widget.mdnsTypes, normalizeMDNSServiceType(t))
+		} else {
+			widget.ssdpTypes = append(widget.ssdpTypes, t)
+		}
+	}
+
+	if widget.BrowseDuration <= 0 {
+		widget.BrowseDuration = models.DurationField(3 * time.Second)
+	} else if widget.BrowseDuration > models.DurationField(30*time.Second) {
+		return errors.New("browse-duration can't be longer than 30s")
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *localServicesWidget) Update(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(widget.BrowseDuration))
+	defer cancel()
+
+	var mdnsServices []mdnsService
+	var ssdpDevices []ssdpDevice
+	var mdnsErr, ssdpErr error
+	var wg sync.WaitGroup
+
+	if widget.browses(localServicesProtocolMDNS, widget.mdnsTypes) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mdnsServices, mdnsErr = browseMDNS(ctx, widget.mdnsTypes)
+		}()
+	}
+
+	if widget.browses(localServicesProtocolSSDP, widget.ssdpTypes) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ssdpDevices, ssdpErr = searchSSDP(ctx, widget.httpClient(false), widget.ssdpTypes)
+		}()
+	}
+
+	wg.Wait()
+
+	err := errors.Join(mdnsErr, ssdpErr)
+	if err != nil && len(mdnsServices)+len(ssdpDevices) > 0 {
+		err = fmt.Errorf("%w: %v", models.ErrPartialContent, err)
+	} else if err != nil {
+		err = fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Devices = groupLocalServices(mdnsServices, ssdpDevices)
+}
+
+// A protocol none of the listed types belong to has nothing to look for
+func (widget *localServicesWidget) browses(protocol string, types []string) bool {
+	return slices.Contains(widget.Protocols, protocol) && (len(widget.Types) == 0 || len(types) > 0)
+}
+
+func (widget *localServicesWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, localServicesWidgetTemplate)
+}
+
+func groupLocalServices(mdnsServices []mdnsService, ssdpDevices []ssdpDevice) []localDevice {
+	var devices []*localDevice
+	byAddress := make(map[string]*localDevice)
+	deviceAt := func(address, name string) *localDevice {
+		device, exists := byAddress[address]
+		if !exists {
+			device = &localDevice{Name: name, Address: address}
+			byAddress[address] = device
+			devices = append(devices, device)
+		}
+
+		return device
+	}
+
+	for i := range mdnsServices {
+		service := &mdnsServices[i]
+		device := deviceAt(service.Address, service.Instance)
+
+		if service.Label == "" {
+			continue
+		}
+
+		if !slices.Contains(device.Services, service.Label) {
+			device.Services = append(device.Services, service.Label)
+		}
+
+		if device.URL == "" && service.URL != "" {
+			device.URL = service.URL
+		}
+	}
+
+	for i := range ssdpDevices {
+		ssdp := &ssdpDevices[i]
+		device := deviceAt(ssdp.Address, ssdp.Name)
+
+		if device.Model == "" {
+			device.Model = ssdp.Model
+		}
+
+		if device.URL == "" {
+			device.URL = ssdp.URL
+		}
+
+		if !slices.Contains(device.Services, ssdp.Label) {
+			device.Services = append(device.Services, ssdp.Label)
+		}
+	}
+
+	result := make([]localDevice, 0, len(devices))
+	for _, device := range devices {
+		// devices that only advertise the services that aren't shown
+		if len(device.Services) == 0 {
+			continue
+		}
+
+		result = append(result, *device)
+	}
+
+	sort.SliceStable(result, func(a, b int) bool {
+		return strings.ToLower(result[a].Name) < strings.ToLower(result[b].Name)
+	})
+
+	return result
+}
+
+// _ipp._tcp.local. and _ipp._tcp both become _ipp._tcp
+func normalizeMDNSServiceType(serviceType string) string {
+	serviceType = strings.ToLower(strings.TrimSuffix(serviceType, "."))
+	return strings.TrimSuffix(serviceType, ".local")
+}
+
+func mdnsServiceTypeLabel(serviceType string) string {
+	if label, exists := mdnsServiceTypeLabels[serviceType]; exists {
+		return label
+	}
+
+	name, _, _ := strings.Cut(serviceType, ".")
+	return strings.TrimPrefix(name, "_")
+}
+
+type mdnsService struct {
+	Instance string
+	Type     string
+	Label    string
+	Address  string
+	URL      string
+}
+
+type mdnsServiceRecord struct {
+	target string
+	port   uint16
+}
+
+// Keeps track of what's been learnt from the responses so far, so that what's
+// still missing can be asked for while browsing
+type mdnsBrowser struct {
+	conn    *net.UDPConn
+	wanted  []string
+	queried map[string]bool
+
+	types     map[string]bool
+	instances map[string]string
+	services  map[string]mdnsServiceRecord
+	texts     map[string][]string
+	addresses map[string]net.IP
+	// the address of whoever responded, used when the target of a service
+	// doesn't get resolved
+	responders map[string]net.IP
+}
+
+// Queries are sent from a port other than 5353, which gets responders to reply
+// directly rather than to the whole network, so there's no need to join the
+// multicast group or to share the port with another responder on the host.
+// With no types given, the types that are advertised get enumerated first.
+func browseMDNS(ctx context.Context, types []string) ([]mdnsService, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, fmt.Errorf("mdns: %w", err)
+	}
+	defer conn.Close()
+
+	browser := &mdnsBrowser{
+		conn:       conn,
+		wanted:     types,
+		queried:    make(map[string]bool),
+		types:      make(map[string]bool),
+		instances:  make(map[string]string),
+		services:   make(map[string]mdnsServiceRecord),
+		texts:      make(map[string][]string),
+		addresses:  make(map[string]net.IP),
+		responders: make(map[string]net.IP),
+	}
+
+	if len(types) == 0 {
+		err = browser.query(mdnsServicesEnumerationName, dnsmessage.TypePTR)
+	} else {
+		for _, serviceType := range types {
+			browser.types[serviceType] = true
+			if err = browser.query(serviceType+".local.", dnsmessage.TypePTR); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("mdns: %w", err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+
+	buffer := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			// the deadline being reached is how browsing ends
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+
+			return nil, fmt.Errorf("mdns: %w", err)
+		}
+
+		var message dnsmessage.Message
+		if message.Unpack(buffer[:n]) != nil {
+			continue
+		}
+
+		browser.handle(&message, from.IP)
+	}
+
+	return browser.results(), nil
+}
+
+func (b *mdnsBrowser) query(name string, queryType dnsmessage.Type) error {
+	key := strings.ToLower(name) + "/" + queryType.String()
+	if b.queried[key] {
+		return nil
+	}
+	b.queried[key] = true
+
+	questionName, err := dnsmessage.NewName(name)
+	if err != nil {
+		return err
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	builder.StartQuestions()
+	builder.Question(dnsmessage.Question{Name: questionName, Type: queryType, Class: dnsmessage.ClassINET})
+	message, err := builder.Finish()
+	if err != nil {
+		return err
+	}
+
+	_, err = b.conn.WriteToUDP(message, mdnsAddress)
+	return err
+}
+
+func (b *mdnsBrowser) handle(message *dnsmessage.Message, from net.IP) {
+	for _, record := range slices.Concat(message.Answers, message.Additionals) {
+		name := strings.ToLower(record.Header.Name.String())
+
+		switch body := record.Body.(type) {
+		case *dnsmessage.PTRResource:
+			target := body.PTR.String()
+
+			if name == mdnsServicesEnumerationName {
+				serviceType := normalizeMDNSServiceType(target)
+				if len(b.wanted) == 0 && !b.types[serviceType] {
+					b.types[serviceType] = true
+					b.query(serviceType+".local.", dnsmessage.TypePTR)
+				}
+				continue
+			}
+
+			if b.types[normalizeMDNSServiceType(name)] {
+				b.instances[strings.ToLower(target)] = target
+				b.responders[strings.ToLower(target)] = from
+			}
+		case *dnsmessage.SRVResource:
+			b.services[name] = mdnsServiceRecord{target: strings.ToLower(body.Target.String()), port: body.Port}
+		case *dnsmessage.TXTResource:
+			b.texts[name] = body.TXT
+		case *dnsmessage.AResource:
+			b.addresses[name] = net.IP(body.A[:])
+		}
+	}
+
+	// what wasn't included in the response gets asked for
+	for instance, fullName := range b.instances {
+		service, exists := b.services[instance]
+		if !exists {
+			b.query(fullName, dnsmessage.TypeSRV)
+			b.query(fullName, dnsmessage.TypeTXT)
+			continue
+		}
+
+		if _, exists := b.addresses[service.target]; !exists {
+			b.query(service.target, dnsmessage.TypeA)
+		}
+	}
+}
+
+func (b *mdnsBrowser) results() []mdnsService {
+	var results []mdnsService
+
+	for instance, fullName := range b.instances {
+		service, exists := b.services[instance]
+		if !exists {
+			continue
+		}
+
+		address := b.addresses[service.target]
+		if address == nil {
+			address = b.responders[instance]
+		}
+
+		var serviceType string
+		for t := range b.types {
+			if strings.HasSuffix(instance, "."+t+".local.") {
+				serviceType = t
+				break
+			}
+		}
+
+		if serviceType == "" {
+			continue
+		}
+
+		result := mdnsService{
+			// the case of the type might differ from the one that was asked for
+			Instance: fullName[:len(fullName)-len("."+serviceType+".local.")],
+			Type:     serviceType,
+			Label:    mdnsServiceTypeLabel(serviceType),
+			Address:  address.String(),
+		}
+
+		if serviceType == "_http._tcp" || serviceType == "_https._tcp" {
+			serviceURL := url.URL{
+				Scheme: strings.TrimPrefix(strings.TrimSuffix(serviceType, "._tcp"), "_"),
+				Host:   net.JoinHostPort(result.Address, strconv.Itoa(int(service.port))),
+				Path:   parseMDNSText(b.texts[instance])["path"],
+			}
+			result.URL = serviceURL.String()
+		}
+
+		results = append(results, result)
+	}
+
+	// so that the name of a device comes from the same service every time
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Address != results[b].Address {
+			return results[a].Address < results[b].Address
+		}
+
+		return results[a].Instance < results[b].Instance
+	})
+
+	return results
+}
+
+func parseMDNSText(entries []string) map[string]string {
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key, value, _ := strings.Cut(entry, "=")
+		values[strings.ToLower(key)] = value
+	}
+
+	return values
+}
+
+type ssdpDevice struct {
+	Name    string
+	Label   string
+	Address string
+	URL     string
+	Model   string
+}
+
+type upnpDeviceDescriptionXml struct {
+	URLBase string `xml:"URLBase"`
+	Device  struct {
+		DeviceType      string `xml:"deviceType"`
+		FriendlyName    string `xml:"friendlyName"`
+		Manufacturer    string `xml:"manufacturer"`
+		ModelName       string `xml:"modelName"`
+		PresentationURL string `xml:"presentationURL"`
+	} `xml:"device"`
+}
+
+// Looks for root devices and fetches their descriptions for a name, types are
+// matched against the name of the device type, such as MediaRenderer
+func searchSSDP(ctx context.Context, client *http.Client, types []string) ([]ssdpDevice, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, fmt.Errorf("ssdp: %w", err)
+	}
+	defer conn.Close()
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: upnp:rootdevice\r\n\r\n"
+
+	if _, err := conn.WriteToUDP([]byte(search), ssdpAddress); err != nil {
+		return nil, fmt.Errorf("ssdp: %w", err)
+	}
+
+	// leave time for the descriptions to be fetched
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline.Add(-time.Until(deadline) / 3))
+
+	var locations []string
+	buffer := make([]byte, 4096)
+	for {
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+
+			return nil, fmt.Errorf("ssdp: %w", err)
+		}
+
+		response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buffer[:n])), nil)
+		if err != nil {
+			continue
+		}
+
+		location := response.Header.Get("Location")
+		if location != "" && !slices.Contains(locations, location) {
+			locations = append(locations, location)
+		}
+	}
+
+	requests := make([]*http.Request, 0, len(locations))
+	for _, location := range locations {
+		request, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+		if err != nil {
+			continue
+		}
+		requests = append(requests, request)
+	}
+
+	descriptions, errs, err := workerPoolDo(newJob(fetch.DecodeXMLTask[upnpDeviceDescriptionXml](client), requests))
+	if err != nil {
+		return nil, fmt.Errorf("ssdp: %w", err)
+	}
+
+	var devices []ssdpDevice
+	for i := range descriptions {
+		// devices that don't describe themselves in time are skipped
+		if errs[i] != nil {
+			continue
+		}
+
+		description := &descriptions[i].Device
+		location := requests[i].URL
+
+		deviceType := upnpDeviceTypeName(description.DeviceType)
+		if len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool {
+			return strings.EqualFold(t, deviceType)
+		}) {
+			continue
+		}
+
+		device := ssdpDevice{
+			Name:    description.FriendlyName,
+			Label:   deviceType,
+			Address: location.Hostname(),
+			Model:   strings.TrimSpace(description.Manufacturer + " " + description.ModelName),
+		}
+
+		if label, exists := ssdpDeviceTypeLabels[deviceType]; exists {
+			device.Label = label
+		}
+
+		if device.Name == "" {
+			device.Name = device.Address
+		}
+
+		if description.PresentationURL != "" {
+			base := location
+			if descriptions[i].URLBase != "" {
+				if parsed, err := url.Parse(descriptions[i].URLBase); err == nil {
+					base = parsed
+				}
+			}
+
+			if presentation, err := base.Parse(description.PresentationURL); err == nil && (presentation.Scheme == "http" || presentation.Scheme == "https") {
+				device.URL = presentation.String()
+			}
+		}
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// urn:schemas-upnp-org:device:MediaRenderer:1 becomes MediaRenderer
+func upnpDeviceTypeName(deviceType string) string {
+	parts := strings.Split(deviceType, ":")
+	if len(parts) < 2 {
+		return deviceType
+	}
+
+	return parts[len(parts)-2]
+}
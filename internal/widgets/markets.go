@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 )
 
 var marketsWidgetTemplate = common.MustParseTemplate("markets.html", "widget-base.html")
@@ -23,7 +25,16 @@ type marketsWidget struct {
 	ChartLinkTemplate  string          `yaml:"chart-link-template"`
 	SymbolLinkTemplate string          `yaml:"symbol-link-template"`
 	Sort               string          `yaml:"sort-by"`
+	Provider           string          `yaml:"provider"`
 	Markets            marketList      `yaml:"-"`
+
+	provider marketsProvider `yaml:"-"`
+}
+
+// Markets that couldn't be fetched are left out of the list, along with a
+// partial content error
+type marketsProvider interface {
+	fetchMarkets(client fetch.Doer, requests []marketRequest) (marketList, error)
 }
 
 func (widget *marketsWidget) Initialize() error {
@@ -46,11 +57,17 @@ func (widget *marketsWidget) Initialize() error {
 		}
 	}
 
+	provider, err := marketsProviders.get(widget.Provider)
+	if err != nil {
+		return err
+	}
+	widget.provider = provider
+
 	return nil
 }
 
 func (widget *marketsWidget) Update(ctx context.Context) {
-	markets, err := fetchMarketsDataFromYahoo(widget.MarketRequests)
+	markets, err := widget.provider.fetchMarkets(widget.httpClient(false), widget.MarketRequests)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -123,19 +140,21 @@ type marketResponseJson struct {
 // TODO: allow changing chart time frame
 const marketChartDays = 21
 
-func fetchMarketsDataFromYahoo(marketRequests []marketRequest) (marketList, error) {
+type yahooMarketsProvider struct{}
+
+func (*yahooMarketsProvider) fetchMarkets(client fetch.Doer, marketRequests []marketRequest) (marketList, error) {
 	requests := make([]*http.Request, 0, len(marketRequests))
 
 	for i := range marketRequests {
 		request, _ := http.NewRequest("GET", fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?range=1mo&interval=1d", marketRequests[i].Symbol), nil)
-		setBrowserUserAgentHeader(request)
+		fetch.SetBrowserUserAgent(request)
 		requests = append(requests, request)
 	}
 
-	job := newJob(decodeJsonFromRequestTask[marketResponseJson](defaultHTTPClient), requests)
+	job := newJob(fetch.DecodeJSONTask[marketResponseJson](client), requests)
 	responses, errs, err := workerPoolDo(job)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
 	}
 
 	markets := make(marketList, 0, len(responses))
@@ -194,11 +213,11 @@ func fetchMarketsDataFromYahoo(marketRequests []marketRequest) (marketList, erro
 	}
 
 	if len(markets) == 0 {
-		return nil, errNoContent
+		return nil, models.ErrNoContent
 	}
 
 	if failed > 0 {
-		return markets, fmt.Errorf("%w: could not fetch data for %d market(s)", errPartialContent, failed)
+		return markets, fmt.Errorf("%w: could not fetch data for %d market(s)", models.ErrPartialContent, failed)
 	}
 
 	return markets, nil
@@ -3,6 +3,7 @@ package widgets
 import (
 	"context"
 	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"slices"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"github.com/limpdev/gander/internal/models"
 )
 
@@ -19,38 +21,92 @@ var (
 )
 
 type monitorWidget struct {
-	widgetBase `yaml:",inline"`
-	Sites      []struct {
-		*SiteStatusRequest `yaml:",inline"`
-		Status             *siteStatus            `yaml:"-"`
-		URL                string                 `yaml:"-"`
-		ErrorURL           string                 `yaml:"error-url"`
-		Title              string                 `yaml:"title"`
-		Icon               models.CustomIconField `yaml:"icon"`
-		SameTab            bool                   `yaml:"same-tab"`
-		StatusText         string                 `yaml:"-"`
-		StatusStyle        string                 `yaml:"-"`
-		AltStatusCodes     []int                  `yaml:"alt-status-codes"`
-	} `yaml:"sites"`
-	Style           string `yaml:"style"`
-	ShowFailingOnly bool   `yaml:"show-failing-only"`
-	HasFailing      bool   `yaml:"-"`
+	widgetBase      `yaml:",inline"`
+	Sites           []monitorSite     `yaml:"sites"`
+	Style           string            `yaml:"style"`
+	ShowFailingOnly bool              `yaml:"show-failing-only"`
+	Discovery       *serviceDiscovery `yaml:"discovery"`
+	HasFailing      bool              `yaml:"-"`
+
+	configuredSites []monitorSite `yaml:"-"`
+}
+
+type monitorSite struct {
+	*SiteStatusRequest `yaml:",inline"`
+	Status             *siteStatus            `yaml:"-"`
+	URL                string                 `yaml:"-"`
+	ErrorURL           string                 `yaml:"error-url"`
+	Title              string                 `yaml:"title"`
+	Icon               models.CustomIconField `yaml:"icon"`
+	SameTab            bool                   `yaml:"same-tab"`
+	StatusText         string                 `yaml:"-"`
+	StatusStyle        string                 `yaml:"-"`
+	AltStatusCodes     []int                  `yaml:"alt-status-codes"`
 }
 
 func (widget *monitorWidget) Initialize() error {
 	widget.withTitle("Monitor").withCacheDuration(5 * time.Minute)
 
+	if widget.Discovery != nil {
+		if err := widget.Discovery.initialize(); err != nil {
+			return err
+		}
+
+		widget.configuredSites = widget.Sites
+	}
+
+	return nil
+}
+
+// Containers get discovered again as soon as any of them starts or stops,
+// Kubernetes objects only on schedule
+func (widget *monitorWidget) RequiresUpdate(now *time.Time) bool {
+	if widget.Discovery != nil && widget.Discovery.hasChanged() && widget.updateLock.TryRLock() {
+		widget.updateLock.RUnlock()
+		return true
+	}
+
+	return widget.widgetBase.RequiresUpdate(now)
+}
+
+// Stopped containers are kept so that they show up as failing, discovered
+// sites come after the ones from the config
+func (widget *monitorWidget) discoverSites(ctx context.Context) error {
+	services, err := widget.Discovery.services(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	sites := slices.Clone(widget.configuredSites)
+	for _, service := range services {
+		sites = append(sites, monitorSite{
+			SiteStatusRequest: &SiteStatusRequest{DefaultURL: service.URL},
+			Title:             service.Name,
+			Icon:              service.Icon,
+			SameTab:           service.SameTab,
+		})
+	}
+
+	widget.Sites = sites
 	return nil
 }
 
 func (widget *monitorWidget) Update(ctx context.Context) {
+	var discoveryErr error
+	if widget.Discovery != nil {
+		discoveryErr = widget.discoverSites(ctx)
+	}
+
 	requests := make([]*SiteStatusRequest, len(widget.Sites))
 
 	for i := range widget.Sites {
 		requests[i] = widget.Sites[i].SiteStatusRequest
 	}
 
-	statuses, err := fetchStatusForSites(requests)
+	statuses, err := fetchStatusForSites(widget.httpClient, requests)
+	if err == nil && discoveryErr != nil {
+		err = fmt.Errorf("%w: %v", common.Ternary(len(widget.Sites) > 0, models.ErrPartialContent, models.ErrNoContent), discoveryErr)
+	}
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -122,10 +178,7 @@ type SiteStatusRequest struct {
 	CheckURL      string               `yaml:"check-url"`
 	AllowInsecure bool                 `yaml:"allow-insecure"`
 	Timeout       models.DurationField `yaml:"timeout"`
-	BasicAuth     struct {
-		Username string `yaml:"username"`
-		Password string `yaml:"password"`
-	} `yaml:"basic-auth"`
+	BasicAuth     fetch.BasicAuth      `yaml:"basic-auth"`
 }
 
 type siteStatus struct {
@@ -135,7 +188,13 @@ type siteStatus struct {
 	Error        error
 }
 
-func fetchSiteStatusTask(statusRequest *SiteStatusRequest) (siteStatus, error) {
+func fetchSiteStatusTask(clientFor func(allowInsecure bool) *http.Client) func(*SiteStatusRequest) (siteStatus, error) {
+	return func(statusRequest *SiteStatusRequest) (siteStatus, error) {
+		return fetchSiteStatus(clientFor(statusRequest.AllowInsecure), statusRequest)
+	}
+}
+
+func fetchSiteStatus(client fetch.Doer, statusRequest *SiteStatusRequest) (siteStatus, error) {
 	var url string
 	if statusRequest.CheckURL != "" {
 		url = statusRequest.CheckURL
@@ -159,13 +218,7 @@ func fetchSiteStatusTask(statusRequest *SiteStatusRequest) (siteStatus, error) {
 	}
 
 	requestSentAt := time.Now()
-	var response *http.Response
-
-	if !statusRequest.AllowInsecure {
-		response, err = defaultHTTPClient.Do(request)
-	} else {
-		response, err = defaultInsecureHTTPClient.Do(request)
-	}
+	response, err := client.Do(request)
 
 	status := siteStatus{ResponseTime: time.Since(requestSentAt)}
 
@@ -185,8 +238,8 @@ func fetchSiteStatusTask(statusRequest *SiteStatusRequest) (siteStatus, error) {
 	return status, nil
 }
 
-func fetchStatusForSites(requests []*SiteStatusRequest) ([]siteStatus, error) {
-	job := newJob(fetchSiteStatusTask, requests).withWorkers(20)
+func fetchStatusForSites(clientFor func(allowInsecure bool) *http.Client, requests []*SiteStatusRequest) ([]siteStatus, error) {
+	job := newJob(fetchSiteStatusTask(clientFor), requests).withWorkers(20)
 	results, _, err := workerPoolDo(job)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,317 @@
+package widgets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/yuin/goldmark"
+	goldmarkextension "github.com/yuin/goldmark/extension"
+)
+
+var notesWidgetTemplate = common.MustParseTemplate("notes.html", "widget-base.html")
+
+const notesMaxFileSize = 1 << 20
+
+// Raw HTML within the markdown gets left out and links with schemes such as
+// javascript: get emptied, since that's what goldmark does unless told not to
+var notesMarkdown = goldmark.New(goldmark.WithExtensions(goldmarkextension.GFM))
+
+type notesWidget struct {
+	widgetBase   `yaml:",inline"`
+	Source       string   `yaml:"source"`
+	File         string   `yaml:"file"`
+	Editable     bool     `yaml:"editable"`
+	Editors      []string `yaml:"editors"`
+	EditorGroups []string `yaml:"editor-groups"`
+
+	path          string        `yaml:"-"`
+	loadedVersion atomic.Uint64 `yaml:"-"`
+	Rendered      template.HTML `yaml:"-"`
+}
+
+func (widget *notesWidget) Initialize() error {
+	widget.withTitle("Notes")
+
+	if (widget.Source == "") == (widget.File == "") {
+		return errors.New("exactly one of source or file is required")
+	}
+
+	if widget.Source != "" {
+		if widget.Editable {
+			return errors.New("only notes from a file can be editable")
+		}
+
+		rendered, err := renderNotesMarkdown([]byte(widget.Source))
+		if err != nil {
+			return err
+		}
+
+		widget.Rendered = rendered
+		widget.withError(nil)
+		return nil
+	}
+
+	if !widget.Editable && (len(widget.Editors) > 0 || len(widget.EditorGroups) > 0) {
+		return errors.New("editors and editor-groups can only be set when editable is true")
+	}
+
+	path, err := filepath.Abs(widget.File)
+	if err != nil {
+		return fmt.Errorf("resolving path of file: %v", err)
+	}
+	widget.path = path
+
+	// in case the file is on a filesystem where changes can't be watched,
+	// such as some network shares, it still gets read again every so often
+	widget.withCacheDuration(5 * time.Minute)
+	watchNotesFile(path)
+
+	return nil
+}
+
+// Also updates when the file has changed since it was last read
+func (widget *notesWidget) RequiresUpdate(now *time.Time) bool {
+	if widget.path != "" && notesFileVersion(widget.path) != widget.loadedVersion.Load() {
+		// already updating
+		if !widget.updateLock.TryRLock() {
+			return false
+		}
+		widget.updateLock.RUnlock()
+
+		return true
+	}
+
+	return widget.widgetBase.RequiresUpdate(now)
+}
+
+func (widget *notesWidget) Update(ctx context.Context) {
+	if widget.path == "" {
+		return
+	}
+
+	// taken before reading so that a change made while reading still causes
+	// another update
+	version := notesFileVersion(widget.path)
+	rendered, err := widget.readFile()
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.loadedVersion.Store(version)
+	widget.Rendered = rendered
+}
+
+func (widget *notesWidget) readFile() (template.HTML, error) {
+	source, err := readNotesFile(widget.path)
+	if err != nil {
+		return "", err
+	}
+
+	return renderNotesMarkdown(source)
+}
+
+func (widget *notesWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, notesWidgetTemplate)
+}
+
+func (widget *notesWidget) GetEditors() ([]string, []string) {
+	return widget.Editors, widget.EditorGroups
+}
+
+// Editing changes a file on disk, so it's only offered when visitors have to
+// log in
+func (widget *notesWidget) CanEdit() bool {
+	return widget.Editable && widget.Providers != nil && widget.Providers.RequiresAuth
+}
+
+func (widget *notesWidget) LocksOwnRequests() {}
+
+// Handles GET source, which returns the markdown of the file, and PUT source,
+// which replaces it with the body and returns the widget rendered with it
+func (widget *notesWidget) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("path") != "source" || !widget.CanEdit() {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username, user := models.WidgetRequestUser(r)
+	if !models.IsUserAllowed(username, user, widget.Editors, widget.EditorGroups) {
+		http.Error(w, "you can't edit these notes", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		source, err := readNotesFile(widget.path)
+		if err != nil {
+			slog.Error("Failed to read notes", "file", widget.path, "error", err)
+			http.Error(w, "could not read notes", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(source)
+		return
+	}
+
+	source, err := io.ReadAll(http.MaxBytesReader(w, r.Body, notesMaxFileSize))
+	if err != nil {
+		http.Error(w, "notes are too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	widget.updateLock.Lock()
+	err = writeNotesFile(widget.path, source)
+	if err == nil {
+		var rendered template.HTML
+		rendered, err = renderNotesMarkdown(source)
+		widget.Rendered = rendered
+		widget.withError(err)
+	}
+	widget.updateLock.Unlock()
+
+	if err != nil {
+		slog.Error("Failed to save notes", "file", widget.path, "error", err)
+		http.Error(w, "could not save notes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(widget.Render()))
+}
+
+func renderNotesMarkdown(source []byte) (template.HTML, error) {
+	var rendered bytes.Buffer
+	if err := notesMarkdown.Convert(source, &rendered); err != nil {
+		return "", fmt.Errorf("rendering markdown: %v", err)
+	}
+
+	return template.HTML(rendered.String()), nil
+}
+
+func readNotesFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	source, err := io.ReadAll(io.LimitReader(file, notesMaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(source) > notesMaxFileSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", notesMaxFileSize)
+	}
+
+	return source, nil
+}
+
+// Written to a temporary file first so that a crash can't leave a partially
+// written file behind, the permissions of the file are kept
+func writeNotesFile(path string, source []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, source, mode); err != nil {
+		return err
+	}
+
+	return os.Rename(temporaryPath, path)
+}
+
+// The files of all notes widgets are watched by a single watcher, which keeps
+// count of how many times each of them has changed. Directories are watched
+// rather than the files themselves since editors commonly save by replacing
+// the file, which a watch on the file wouldn't survive.
+var notesFileWatcher struct {
+	sync.Mutex
+	watcher  *fsnotify.Watcher
+	dirs     map[string]bool
+	versions map[string]uint64
+}
+
+func watchNotesFile(path string) {
+	w := &notesFileWatcher
+	w.Lock()
+	defer w.Unlock()
+
+	if w.watcher == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			slog.Warn("Could not watch files of notes, changes to them will show up within 5 minutes", "error", err)
+			return
+		}
+
+		w.watcher = watcher
+		w.dirs = make(map[string]bool)
+		w.versions = make(map[string]uint64)
+		go handleNotesFileEvents(watcher)
+	}
+
+	dir := filepath.Dir(path)
+	if w.dirs[dir] {
+		return
+	}
+
+	if err := w.watcher.Add(dir); err != nil {
+		slog.Warn("Could not watch directory of notes, changes to them will show up within 5 minutes", "dir", dir, "error", err)
+		return
+	}
+
+	w.dirs[dir] = true
+}
+
+func handleNotesFileEvents(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, isOpen := <-watcher.Events:
+			if !isOpen {
+				return
+			}
+
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+
+			notesFileWatcher.Lock()
+			notesFileWatcher.versions[filepath.Clean(event.Name)]++
+			notesFileWatcher.Unlock()
+		case err, isOpen := <-watcher.Errors:
+			if !isOpen {
+				return
+			}
+			slog.Error("Error watching files of notes", "error", err)
+		}
+	}
+}
+
+func notesFileVersion(path string) uint64 {
+	notesFileWatcher.Lock()
+	defer notesFileWatcher.Unlock()
+
+	return notesFileWatcher.versions[path]
+}
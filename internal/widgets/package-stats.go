@@ -0,0 +1,251 @@
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var packageStatsWidgetTemplate = common.MustParseTemplate("package-stats.html", "widget-base.html")
+
+type packageStatsWidget struct {
+	widgetBase    `yaml:",inline"`
+	Packages      []string `yaml:"packages"`
+	SortBy        string   `yaml:"sort-by"`
+	CollapseAfter int      `yaml:"collapse-after"`
+
+	packages []packageStatsSource `yaml:"-"`
+	Stats    []packageStats       `yaml:"-"`
+}
+
+type packageStatsSource struct {
+	registry string
+	name     string
+}
+
+type packageStats struct {
+	Name     string
+	Registry string
+	URL      string
+	Version  string
+	// Downloads within the period, which depends on what the registry offers
+	Downloads       int
+	DownloadsPeriod string
+}
+
+// Fetches the latest version and the recent downloads of a package
+type packageStatsFetcher func(ctx context.Context, client *http.Client, name string) (packageStats, error)
+
+var packageStatsRegistries = map[string]packageStatsFetcher{
+	"npm":    fetchNpmPackageStats,
+	"pypi":   fetchPyPIPackageStats,
+	"crates": fetchCratesPackageStats,
+}
+
+func (widget *packageStatsWidget) Initialize() error {
+	widget.withTitle("Packages").withCacheDuration(6 * time.Hour)
+
+	if len(widget.Packages) == 0 {
+		return errors.New("at least one package is required")
+	}
+
+	widget.packages = make([]packageStatsSource, 0, len(widget.Packages))
+	for _, pkg := range widget.Packages {
+		registry, name, found := strings.Cut(pkg, ":")
+		registry = strings.ToLower(strings.TrimSpace(registry))
+		name = strings.TrimSpace(name)
+
+		if !found || name == "" {
+			return fmt.Errorf("package %q must be a registry and a name separated by a colon, such as npm:react", pkg)
+		}
+
+		if _, exists := packageStatsRegistries[registry]; !exists {
+			return fmt.Errorf("unknown registry %q in %q, must be one of npm, pypi or crates", registry, pkg)
+		}
+
+		widget.packages = append(widget.packages, packageStatsSource{registry: registry, name: name})
+	}
+
+	if widget.SortBy != "" && widget.SortBy != "downloads" {
+		return errors.New("sort-by must be downloads when set")
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *packageStatsWidget) Update(ctx context.Context) {
+	stats, err := widget.fetchStats(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Stats = stats
+}
+
+func (widget *packageStatsWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, packageStatsWidgetTemplate)
+}
+
+func (widget *packageStatsWidget) fetchStats(ctx context.Context) ([]packageStats, error) {
+	client := widget.httpClient(false)
+
+	job := newJob(func(source packageStatsSource) (packageStats, error) {
+		return packageStatsRegistries[source.registry](ctx, client, source.name)
+	}, widget.packages)
+
+	results, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	stats := make([]packageStats, 0, len(results))
+	var failed int
+
+	for i := range results {
+		if errs[i] != nil {
+			failed++
+			slog.Error("Failed to fetch package stats", "registry", widget.packages[i].registry, "package", widget.packages[i].name, "error", errs[i])
+			continue
+		}
+
+		stats = append(stats, results[i])
+	}
+
+	if len(stats) == 0 {
+		return nil, models.ErrNoContent
+	}
+
+	if widget.SortBy == "downloads" {
+		slices.SortStableFunc(stats, func(a, b packageStats) int {
+			return b.Downloads - a.Downloads
+		})
+	}
+
+	if failed > 0 {
+		return stats, fmt.Errorf("%w: could not fetch stats of %d packages", models.ErrPartialContent, failed)
+	}
+
+	return stats, nil
+}
+
+type npmLatestResponseJson struct {
+	Version string `json:"version"`
+}
+
+type npmDownloadsResponseJson struct {
+	Downloads int `json:"downloads"`
+}
+
+// Scoped packages keep the slash between the scope and the name
+func fetchNpmPackageStats(ctx context.Context, client *http.Client, name string) (packageStats, error) {
+	path := strings.Replace(url.PathEscape(name), "%2F", "/", 1)
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", "https://registry.npmjs.org/"+path+"/latest", nil)
+	latest, err := fetch.DecodeJSON[npmLatestResponseJson](client, request)
+	if err != nil {
+		return packageStats{}, fmt.Errorf("fetching latest version: %v", err)
+	}
+
+	request, _ = http.NewRequestWithContext(ctx, "GET", "https://api.npmjs.org/downloads/point/last-week/"+path, nil)
+	downloads, err := fetch.DecodeJSON[npmDownloadsResponseJson](client, request)
+	if err != nil {
+		return packageStats{}, fmt.Errorf("fetching downloads: %v", err)
+	}
+
+	return packageStats{
+		Name:            name,
+		Registry:        "npm",
+		URL:             "https://www.npmjs.com/package/" + path,
+		Version:         latest.Version,
+		Downloads:       downloads.Downloads,
+		DownloadsPeriod: "week",
+	}, nil
+}
+
+type pypiPackageResponseJson struct {
+	Info struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"info"`
+}
+
+type pypiStatsRecentResponseJson struct {
+	Data struct {
+		LastWeek int `json:"last_week"`
+	} `json:"data"`
+}
+
+// PyPI doesn't count downloads itself, they're taken from pypistats.org
+func fetchPyPIPackageStats(ctx context.Context, client *http.Client, name string) (packageStats, error) {
+	path := url.PathEscape(name)
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", "https://pypi.org/pypi/"+path+"/json", nil)
+	pkg, err := fetch.DecodeJSON[pypiPackageResponseJson](client, request)
+	if err != nil {
+		return packageStats{}, fmt.Errorf("fetching latest version: %v", err)
+	}
+
+	// pypistats only accepts the normalized name of the package
+	normalized := strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(name))
+	request, _ = http.NewRequestWithContext(ctx, "GET", "https://pypistats.org/api/packages/"+url.PathEscape(normalized)+"/recent", nil)
+	downloads, err := fetch.DecodeJSON[pypiStatsRecentResponseJson](client, request)
+	if err != nil {
+		return packageStats{}, fmt.Errorf("fetching downloads: %v", err)
+	}
+
+	return packageStats{
+		Name:            common.Ternary(pkg.Info.Name != "", pkg.Info.Name, name),
+		Registry:        "PyPI",
+		URL:             "https://pypi.org/project/" + path + "/",
+		Version:         pkg.Info.Version,
+		Downloads:       downloads.Data.LastWeek,
+		DownloadsPeriod: "week",
+	}, nil
+}
+
+type cratesCrateResponseJson struct {
+	Crate struct {
+		Name             string `json:"name"`
+		MaxStableVersion string `json:"max_stable_version"`
+		NewestVersion    string `json:"newest_version"`
+		RecentDownloads  int    `json:"recent_downloads"`
+	} `json:"crate"`
+}
+
+// crates.io only has the downloads of the last 90 days, without having to
+// add up the downloads of each version for every day
+func fetchCratesPackageStats(ctx context.Context, client *http.Client, name string) (packageStats, error) {
+	path := url.PathEscape(name)
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", "https://crates.io/api/v1/crates/"+path, nil)
+	response, err := fetch.DecodeJSON[cratesCrateResponseJson](client, request)
+	if err != nil {
+		return packageStats{}, err
+	}
+
+	crate := response.Crate
+
+	return packageStats{
+		Name:            common.Ternary(crate.Name != "", crate.Name, name),
+		Registry:        "crates.io",
+		URL:             "https://crates.io/crates/" + path,
+		Version:         common.Ternary(crate.MaxStableVersion != "", crate.MaxStableVersion, crate.NewestVersion),
+		Downloads:       crate.RecentDownloads,
+		DownloadsPeriod: "90 days",
+	}, nil
+}
@@ -0,0 +1,7 @@
+//go:build windows || plan9
+
+package widgets
+
+import "os/exec"
+
+func isolatePluginProcess(*exec.Cmd) {}
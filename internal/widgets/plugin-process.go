@@ -0,0 +1,17 @@
+//go:build !windows && !plan9
+
+package widgets
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Runs the plugin in a process group of its own so that anything it started
+// gets killed along with it when it times out
+func isolatePluginProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,268 @@
+package widgets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/loader"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/limpdev/gander/internal/web"
+	"gopkg.in/yaml.v3"
+)
+
+var pluginWidgetTemplate = common.MustParseTemplate("plugin.html", "widget-base.html")
+
+const (
+	pluginWidgetDefaultTimeout       = 10 * time.Second
+	pluginWidgetDefaultMaxOutputSize = 1024 * 1024
+	// Only the end of stderr gets shown in errors, which is where the reason
+	// for failing usually is
+	pluginWidgetMaxErrorOutputSize = 512
+)
+
+const (
+	pluginFormatHTML = "html"
+	pluginFormatJSON = "json"
+)
+
+var errPluginOutputTooLarge = errors.New("output is larger than max-output-size")
+
+type pluginWidget struct {
+	widgetBase    `yaml:",inline"`
+	Command       string               `yaml:"command"`
+	Args          []string             `yaml:"args"`
+	Env           map[string]string    `yaml:"env"`
+	Options       map[string]any       `yaml:"options"`
+	Format        string               `yaml:"format"`
+	Template      string               `yaml:"template"`
+	Timeout       models.DurationField `yaml:"timeout"`
+	MaxOutputSize int                  `yaml:"max-output-size"`
+
+	template *template.Template
+	config   json.RawMessage
+	Content  template.HTML `yaml:"-"`
+}
+
+// Sent to the plugin on stdin, config being the whole config of the widget
+type pluginRequest struct {
+	ID      uint64          `json:"id"`
+	Type    string          `json:"type"`
+	Title   string          `json:"title"`
+	Options map[string]any  `json:"options"`
+	Config  json.RawMessage `json:"config"`
+}
+
+// Keeps the config the widget was decoded from so that plugins can have
+// properties of their own besides options
+func (widget *pluginWidget) UnmarshalYAML(node *yaml.Node) error {
+	type pluginWidgetAlias pluginWidget
+	if err := node.Decode((*pluginWidgetAlias)(widget)); err != nil {
+		return err
+	}
+
+	var config map[string]any
+	if err := node.Decode(&config); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("line %d: encoding the config of the plugin: %v", node.Line, err)
+	}
+
+	widget.config = encoded
+
+	return nil
+}
+
+func (widget *pluginWidget) Initialize() error {
+	widget.withTitle("Plugin").withCacheDuration(5 * time.Minute)
+
+	if widget.Command == "" {
+		return errors.New("command is required")
+	}
+
+	if err := loader.CheckExecCommand(widget.Command); err != nil {
+		return err
+	}
+
+	if widget.Format == "" {
+		widget.Format = pluginFormatHTML
+	} else if widget.Format != pluginFormatHTML && widget.Format != pluginFormatJSON {
+		return fmt.Errorf("format must be either html or json, got %q", widget.Format)
+	}
+
+	if widget.Format == pluginFormatJSON {
+		if widget.Template == "" {
+			return errors.New("template is required when format is json")
+		}
+
+		t, err := template.New("plugin").Funcs(web.GlobalTemplateFunctions).Parse(widget.Template)
+		if err != nil {
+			return fmt.Errorf("parsing template: %v", err)
+		}
+
+		widget.template = t
+	} else if widget.Template != "" {
+		return errors.New("template can only be used when format is json")
+	}
+
+	if widget.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	} else if widget.Timeout == 0 {
+		widget.Timeout = models.DurationField(pluginWidgetDefaultTimeout)
+	}
+
+	if widget.MaxOutputSize < 0 {
+		return errors.New("max-output-size can't be negative")
+	} else if widget.MaxOutputSize == 0 {
+		widget.MaxOutputSize = pluginWidgetDefaultMaxOutputSize
+	}
+
+	return nil
+}
+
+func (widget *pluginWidget) Update(ctx context.Context) {
+	content, err := widget.run(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Content = content
+}
+
+func (widget *pluginWidget) run(ctx context.Context) (template.HTML, error) {
+	request, err := json.Marshal(pluginRequest{
+		ID:      widget.GetID(),
+		Type:    widget.GetType(),
+		Title:   widget.Title,
+		Options: widget.Options,
+		Config:  widget.config,
+	})
+	if err != nil {
+		return "", fmt.Errorf("encoding request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(widget.Timeout))
+	defer cancel()
+
+	stdout := &limitedBuffer{limit: widget.MaxOutputSize, exceeded: cancel}
+	stderr := &tailBuffer{limit: pluginWidgetMaxErrorOutputSize}
+
+	cmd := exec.CommandContext(ctx, widget.Command, widget.Args...)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = processEnvironment(widget.Env)
+	isolatePluginProcess(cmd)
+	// children of the plugin can keep its output open after it gets killed
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	widget.bytesFetched.Add(int64(stdout.buffer.Len()))
+
+	switch {
+	case stdout.overflowed:
+		return "", errPluginOutputTooLarge
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "", fmt.Errorf("plugin did not finish within %s", time.Duration(widget.Timeout))
+	case err != nil:
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			return "", fmt.Errorf("%v: %s", err, output)
+		}
+		return "", err
+	}
+
+	if widget.Format == pluginFormatHTML {
+		return template.HTML(stdout.buffer.String()), nil
+	}
+
+	var data any
+	if err := json.Unmarshal(stdout.buffer.Bytes(), &data); err != nil {
+		return "", fmt.Errorf("decoding output: %v", err)
+	}
+
+	rendered, err := common.ExecuteTemplateToString(widget.template, data)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(rendered), nil
+}
+
+// Plugins and commands don't inherit the environment of the server since it
+// can contain secrets that they have no business knowing about
+func processEnvironment(extra map[string]string) []string {
+	env := make([]string, 0, len(extra)+2)
+
+	for _, name := range []string{"PATH", "HOME"} {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	for name, value := range extra {
+		env = append(env, name+"="+value)
+	}
+
+	return env
+}
+
+func (widget *pluginWidget) MarshalData() (any, error) {
+	return struct {
+		Content string `json:"content"`
+	}{
+		Content: string(widget.Content),
+	}, nil
+}
+
+func (widget *pluginWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, pluginWidgetTemplate)
+}
+
+// Stops accepting writes once the limit is reached and calls exceeded so that
+// the process writing to it can be stopped rather than left blocked on a pipe
+type limitedBuffer struct {
+	buffer     bytes.Buffer
+	limit      int
+	overflowed bool
+	exceeded   func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buffer.Len()+len(p) > b.limit {
+		b.overflowed = true
+		b.exceeded()
+		return 0, errPluginOutputTooLarge
+	}
+
+	return b.buffer.Write(p)
+}
+
+// Keeps only the last limit bytes written to it
+type tailBuffer struct {
+	data  []byte
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = b.data[len(b.data)-b.limit:]
+	}
+
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
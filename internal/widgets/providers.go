@@ -0,0 +1,78 @@
+package widgets
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Where the data of the widgets that get it from third-party APIs comes from,
+// other backends can be added here without the widgets or their templates
+// having to change. Providers hold no state of their own, anything they need
+// such as API keys is a property of the widget.
+var (
+	weatherProviders = newProviderRegistry[weatherProvider]("weather", "open-meteo")
+	marketsProviders = newProviderRegistry[marketsProvider]("markets", "yahoo")
+	sportsProviders  = newProviderRegistry[sportsProviderFunc]("sports", sportsProviderESPN)
+	searchProviders  = newProviderRegistry[searchProvider]("search", "duckduckgo")
+)
+
+func init() {
+	weatherProviders.register("open-meteo", &openMeteoWeatherProvider{})
+	weatherProviders.register(weatherProviderOpenWeatherMap, &openWeatherMapProvider{})
+
+	marketsProviders.register("yahoo", &yahooMarketsProvider{})
+
+	sportsProviders.register(sportsProviderESPN, fetchESPNMatches)
+	sportsProviders.register(sportsProviderTheSportsDB, fetchTheSportsDBMatches)
+
+	searchProviders.register("duckduckgo", searchEngine("https://duckduckgo.com/?q={QUERY}"))
+	searchProviders.register("google", searchEngine("https://www.google.com/search?q={QUERY}"))
+	searchProviders.register("bing", searchEngine("https://www.bing.com/search?q={QUERY}"))
+	searchProviders.register("perplexity", searchEngine("https://www.perplexity.ai/search?q={QUERY}"))
+	searchProviders.register("kagi", searchEngine("https://kagi.com/search?q={QUERY}"))
+	searchProviders.register("startpage", searchEngine("https://www.startpage.com/search?q={QUERY}"))
+}
+
+type providerRegistry[T any] struct {
+	kind      string
+	fallback  string
+	providers map[string]T
+}
+
+func newProviderRegistry[T any](kind, fallback string) *providerRegistry[T] {
+	return &providerRegistry[T]{
+		kind:      kind,
+		fallback:  fallback,
+		providers: make(map[string]T),
+	}
+}
+
+func (r *providerRegistry[T]) register(name string, provider T) {
+	if _, exists := r.providers[name]; exists {
+		panic(fmt.Sprintf("%s provider %s is already registered", r.kind, name))
+	}
+
+	r.providers[name] = provider
+}
+
+func (r *providerRegistry[T]) has(name string) bool {
+	_, exists := r.providers[name]
+	return exists
+}
+
+// An empty name gets the default provider
+func (r *providerRegistry[T]) get(name string) (T, error) {
+	if name == "" {
+		name = r.fallback
+	}
+
+	provider, exists := r.providers[name]
+	if !exists {
+		names := slices.Sorted(maps.Keys(r.providers))
+		return provider, fmt.Errorf("unknown %s provider %q, must be one of %s", r.kind, name, strings.Join(names, ", "))
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,253 @@
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var proxmoxWidgetTemplate = common.MustParseTemplate("proxmox.html", "widget-base.html")
+
+type proxmoxWidget struct {
+	widgetBase    `yaml:",inline"`
+	URL           string        `yaml:"url"`
+	TokenID       string        `yaml:"token-id"`
+	TokenSecret   string        `yaml:"token-secret"`
+	AllowInsecure bool          `yaml:"allow-insecure"`
+	Nodes         []string      `yaml:"nodes"`
+	HideGuests    bool          `yaml:"hide-guests"`
+	HideStopped   bool          `yaml:"hide-stopped"`
+	HideUpdates   bool          `yaml:"hide-updates"`
+	CollapseAfter int           `yaml:"collapse-after"`
+	Cluster       []proxmoxNode `yaml:"-"`
+}
+
+func (widget *proxmoxWidget) Initialize() error {
+	if widget.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if widget.TokenID == "" || widget.TokenSecret == "" {
+		return errors.New("token-id and token-secret are required")
+	}
+
+	widget.URL = strings.TrimRight(widget.URL, "/")
+	widget.withTitle("Proxmox").withTitleURL(widget.URL).withCacheDuration(1 * time.Minute)
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *proxmoxWidget) Update(ctx context.Context) {
+	nodes, err := fetchProxmoxCluster(
+		ctx,
+		widget.httpClient(widget.AllowInsecure),
+		widget.URL,
+		widget.TokenID+"="+widget.TokenSecret,
+		widget.Nodes,
+		!widget.HideGuests,
+		widget.HideStopped,
+		!widget.HideUpdates,
+	)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Cluster = nodes
+}
+
+func (widget *proxmoxWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, proxmoxWidgetTemplate)
+}
+
+type proxmoxNode struct {
+	Name          string
+	Online        bool
+	BootTime      time.Time
+	CPUPercent    int
+	MemoryPercent int
+	MemoryUsedMB  uint64
+	MemoryTotalMB uint64
+	// -1 when the updates couldn't be checked or weren't asked for
+	Updates int
+	Guests  []proxmoxGuest
+}
+
+// A VM or a container
+type proxmoxGuest struct {
+	ID            int
+	Name          string
+	Type          string
+	Status        string
+	Running       bool
+	CPUPercent    int
+	MemoryPercent int
+	MemoryUsedMB  uint64
+	MemoryTotalMB uint64
+}
+
+type proxmoxResponseJson[T any] struct {
+	Data T `json:"data"`
+}
+
+type proxmoxNodeJson struct {
+	Node   string  `json:"node"`
+	Status string  `json:"status"`
+	CPU    float64 `json:"cpu"`
+	Mem    uint64  `json:"mem"`
+	MaxMem uint64  `json:"maxmem"`
+	Uptime int64   `json:"uptime"`
+}
+
+type proxmoxGuestJson struct {
+	VMID     int     `json:"vmid"`
+	Name     string  `json:"name"`
+	Node     string  `json:"node"`
+	Type     string  `json:"type"`
+	Status   string  `json:"status"`
+	Template int     `json:"template"`
+	CPU      float64 `json:"cpu"`
+	Mem      uint64  `json:"mem"`
+	MaxMem   uint64  `json:"maxmem"`
+}
+
+func proxmoxPercent(used, total uint64) int {
+	if total == 0 {
+		return 0
+	}
+
+	return int(float64(used) / float64(total) * 100)
+}
+
+func fetchProxmoxCluster(
+	ctx context.Context,
+	client fetch.Doer,
+	instanceURL string,
+	token string,
+	nodeFilter []string,
+	withGuests bool,
+	hideStopped bool,
+	withUpdates bool,
+) ([]proxmoxNode, error) {
+	newRequest := func(path string) *http.Request {
+		request, _ := http.NewRequestWithContext(ctx, "GET", instanceURL+"/api2/json"+path, nil)
+		request.Header.Set("Authorization", "PVEAPIToken="+token)
+		return request
+	}
+
+	nodesResponse, err := fetch.DecodeJSON[proxmoxResponseJson[[]proxmoxNodeJson]](client, newRequest("/nodes"))
+	if err != nil {
+		return nil, fmt.Errorf("fetching nodes: %w", err)
+	}
+
+	now := time.Now()
+	nodes := make([]proxmoxNode, 0, len(nodesResponse.Data))
+	for _, node := range nodesResponse.Data {
+		if len(nodeFilter) > 0 && !slices.Contains(nodeFilter, node.Node) {
+			continue
+		}
+
+		nodes = append(nodes, proxmoxNode{
+			Name:          node.Node,
+			Online:        node.Status == "online",
+			BootTime:      now.Add(-time.Duration(node.Uptime) * time.Second),
+			CPUPercent:    int(node.CPU * 100),
+			MemoryPercent: proxmoxPercent(node.Mem, node.MaxMem),
+			MemoryUsedMB:  node.Mem / 1024 / 1024,
+			MemoryTotalMB: node.MaxMem / 1024 / 1024,
+			Updates:       -1,
+		})
+	}
+
+	if len(nodes) == 0 {
+		return nil, errors.New("no nodes found")
+	}
+
+	slices.SortFunc(nodes, func(a, b proxmoxNode) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var failed []string
+
+	if withGuests {
+		guests, err := fetch.DecodeJSON[proxmoxResponseJson[[]proxmoxGuestJson]](client, newRequest("/cluster/resources?type=vm"))
+		if err != nil {
+			return nil, fmt.Errorf("fetching VMs and containers: %w", err)
+		}
+
+		slices.SortFunc(guests.Data, func(a, b proxmoxGuestJson) int {
+			return a.VMID - b.VMID
+		})
+
+		for _, guest := range guests.Data {
+			if guest.Template == 1 || (hideStopped && guest.Status != "running") {
+				continue
+			}
+
+			n := slices.IndexFunc(nodes, func(node proxmoxNode) bool { return node.Name == guest.Node })
+			if n == -1 {
+				continue
+			}
+
+			nodes[n].Guests = append(nodes[n].Guests, proxmoxGuest{
+				ID:            guest.VMID,
+				Name:          common.Ternary(guest.Name != "", guest.Name, fmt.Sprintf("%d", guest.VMID)),
+				Type:          common.Ternary(guest.Type == "lxc", "LXC", "VM"),
+				Status:        guest.Status,
+				Running:       guest.Status == "running",
+				CPUPercent:    int(guest.CPU * 100),
+				MemoryPercent: proxmoxPercent(guest.Mem, guest.MaxMem),
+				MemoryUsedMB:  guest.Mem / 1024 / 1024,
+				MemoryTotalMB: guest.MaxMem / 1024 / 1024,
+			})
+		}
+	}
+
+	if withUpdates {
+		var requests []*http.Request
+		var indexes []int
+
+		for n := range nodes {
+			if nodes[n].Online {
+				requests = append(requests, newRequest("/nodes/"+url.PathEscape(nodes[n].Name)+"/apt/update"))
+				indexes = append(indexes, n)
+			}
+		}
+
+		task := fetch.DecodeJSONTask[proxmoxResponseJson[[]struct{}]](client)
+		responses, errs, err := workerPoolDo(newJob(task, requests))
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range responses {
+			if errs[i] != nil {
+				failed = append(failed, nodes[indexes[i]].Name)
+				slog.Error("Failed to fetch updates of Proxmox node", "node", nodes[indexes[i]].Name, "error", errs[i])
+				continue
+			}
+
+			nodes[indexes[i]].Updates = len(responses[i].Data)
+		}
+	}
+
+	if len(failed) > 0 {
+		return nodes, fmt.Errorf("%w: could not get the updates of %s", models.ErrPartialContent, strings.Join(failed, ", "))
+	}
+
+	return nodes, nil
+}
@@ -8,11 +8,13 @@ import (
 	"html/template"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"github.com/limpdev/gander/internal/models"
 )
 
@@ -23,20 +25,21 @@ var (
 
 type redditWidget struct {
 	widgetBase          `yaml:",inline"`
-	Posts               forumPostList            `yaml:"-"`
-	Subreddit           string                   `yaml:"subreddit"`
-	Proxy               models.ProxyOptionsField `yaml:"proxy"`
-	Style               string                   `yaml:"style"`
-	ShowThumbnails      bool                     `yaml:"show-thumbnails"`
-	ShowFlairs          bool                     `yaml:"show-flairs"`
-	SortBy              string                   `yaml:"sort-by"`
-	TopPeriod           string                   `yaml:"top-period"`
-	Search              string                   `yaml:"search"`
-	ExtraSortBy         string                   `yaml:"extra-sort-by"`
-	CommentsURLTemplate string                   `yaml:"comments-url-template"`
-	Limit               int                      `yaml:"limit"`
-	CollapseAfter       int                      `yaml:"collapse-after"`
-	RequestURLTemplate  string                   `yaml:"request-url-template"`
+	Posts               forumPostList  `yaml:"-"`
+	Subreddit           string         `yaml:"subreddit"`
+	Style               string         `yaml:"style"`
+	ShowThumbnails      bool           `yaml:"show-thumbnails"`
+	ShowFlairs          bool           `yaml:"show-flairs"`
+	Flairs              []string       `yaml:"flairs"`
+	SortBy              string         `yaml:"sort-by"`
+	TopPeriod           string         `yaml:"top-period"`
+	Search              string         `yaml:"search"`
+	ExtraSortBy         string         `yaml:"extra-sort-by"`
+	CommentsURLTemplate string         `yaml:"comments-url-template"`
+	Limit               int            `yaml:"limit"`
+	CollapseAfter       int            `yaml:"collapse-after"`
+	RequestURLTemplate  string         `yaml:"request-url-template"`
+	Transform           *itemTransform `yaml:"transform"`
 
 	AppAuth struct {
 		Name   string `yaml:"name"`
@@ -91,7 +94,7 @@ func (widget *redditWidget) Initialize() error {
 		withTitleURL("https://www.reddit.com/r/" + widget.Subreddit + "/").
 		withCacheDuration(30 * time.Minute)
 
-	return nil
+	return widget.Transform.initialize(forumPost{})
 }
 
 func (widget *redditWidget) Update(ctx context.Context) {
@@ -100,6 +103,10 @@ func (widget *redditWidget) Update(ctx context.Context) {
 		return
 	}
 
+	if posts, err = transformItems(widget.Transform, posts); err != nil {
+		widget.withNotice(err)
+	}
+
 	if len(posts) > widget.Limit {
 		posts = posts[:widget.Limit]
 	}
@@ -109,9 +116,29 @@ func (widget *redditWidget) Update(ctx context.Context) {
 		posts.sortByEngagement()
 	}
 
+	// the first fetch only establishes which posts are already there
+	if widget.Posts != nil {
+		for i := range posts {
+			if slices.ContainsFunc(widget.Posts, func(p forumPost) bool { return p.DiscussionUrl == posts[i].DiscussionUrl }) {
+				continue
+			}
+
+			widget.notify(models.WidgetEvent{
+				Type:    models.WidgetEventNewPost,
+				Title:   "New post in r/" + widget.Subreddit,
+				Message: posts[i].Title,
+				URL:     posts[i].DiscussionUrl,
+			})
+		}
+	}
+
 	widget.Posts = posts
 }
 
+func (widget *redditWidget) MarshalData() (any, error) {
+	return widget.Posts, nil
+}
+
 func (widget *redditWidget) Render() template.HTML {
 	if widget.Style == "horizontal-cards" {
 		return widget.renderTemplate(widget, redditWidgetHorizontalCardsTemplate)
@@ -161,7 +188,7 @@ func (widget *redditWidget) parseCustomCommentsURL(subreddit, postId, postPath s
 }
 
 func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
-	var client requestDoer = defaultHTTPClient
+	var client fetch.Doer = widget.httpClient(false)
 	var baseURL string
 	var requestURL string
 	var headers http.Header
@@ -171,7 +198,7 @@ func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
 	if !app.enabled {
 		baseURL = "https://www.reddit.com"
 		headers = http.Header{
-			"User-Agent": []string{getBrowserUserAgentHeader()},
+			"User-Agent": []string{fetch.BrowserUserAgent()},
 		}
 	} else {
 		baseURL = "https://oauth.reddit.com"
@@ -205,8 +232,6 @@ func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
 
 	if widget.RequestURLTemplate != "" {
 		requestURL = strings.ReplaceAll(widget.RequestURLTemplate, "{REQUEST-URL}", requestURL)
-	} else if widget.Proxy.Client != nil {
-		client = widget.Proxy.Client
 	}
 
 	request, err := http.NewRequest("GET", requestURL, nil)
@@ -215,7 +240,7 @@ func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
 	}
 	request.Header = headers
 
-	responseJson, err := decodeJsonFromRequest[subredditResponseJson](client, request)
+	responseJson, err := fetch.DecodeJSON[subredditResponseJson](client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -233,6 +258,12 @@ func (widget *redditWidget) fetchSubredditPosts() (forumPostList, error) {
 			continue
 		}
 
+		if len(widget.Flairs) > 0 && !slices.ContainsFunc(widget.Flairs, func(flair string) bool {
+			return strings.EqualFold(flair, post.Flair)
+		}) {
+			continue
+		}
+
 		var commentsUrl string
 
 		if widget.CommentsURLTemplate == "" {
@@ -300,8 +331,8 @@ func (widget *redditWidget) fetchNewAppAccessToken() error {
 		ExpiresIn   int    `json:"expires_in"`
 	}
 
-	client := common.Ternary(widget.Proxy.Client != nil, widget.Proxy.Client, defaultHTTPClient)
-	response, err := decodeJsonFromRequest[tokenResponse](client, req)
+	client := widget.httpClient(false)
+	response, err := fetch.DecodeJSON[tokenResponse](client, req)
 	if err != nil {
 		return err
 	}
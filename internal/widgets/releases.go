@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 	"gopkg.in/yaml.v3"
 )
 
@@ -54,7 +56,7 @@ func (widget *releasesWidget) Initialize() error {
 }
 
 func (widget *releasesWidget) Update(ctx context.Context) {
-	releases, err := fetchLatestReleases(widget.Repositories)
+	releases, err := fetchLatestReleases(widget.httpClient(false), widget.Repositories)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -154,8 +156,8 @@ func (r *releaseRequest) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
-func fetchLatestReleases(requests []*releaseRequest) (appReleaseList, error) {
-	job := newJob(fetchLatestReleaseTask, requests).withWorkers(20)
+func fetchLatestReleases(client fetch.Doer, requests []*releaseRequest) (appReleaseList, error) {
+	job := newJob(fetchLatestReleaseTask(client), requests).withWorkers(20)
 	results, errs, err := workerPoolDo(job)
 	if err != nil {
 		return nil, err
@@ -176,28 +178,34 @@ func fetchLatestReleases(requests []*releaseRequest) (appReleaseList, error) {
 	}
 
 	if failed == len(requests) {
-		return nil, errNoContent
+		return nil, models.ErrNoContent
 	}
 
 	releases.sortByNewest()
 
 	if failed > 0 {
-		return releases, fmt.Errorf("%w: could not get %d releases", errPartialContent, failed)
+		return releases, fmt.Errorf("%w: could not get %d releases", models.ErrPartialContent, failed)
 	}
 
 	return releases, nil
 }
 
-func fetchLatestReleaseTask(request *releaseRequest) (*appRelease, error) {
+func fetchLatestReleaseTask(client fetch.Doer) func(*releaseRequest) (*appRelease, error) {
+	return func(request *releaseRequest) (*appRelease, error) {
+		return fetchLatestRelease(client, request)
+	}
+}
+
+func fetchLatestRelease(client fetch.Doer, request *releaseRequest) (*appRelease, error) {
 	switch request.source {
 	case releaseSourceCodeberg:
-		return fetchLatestCodebergRelease(request)
+		return fetchLatestCodebergRelease(client, request)
 	case releaseSourceGithub:
-		return fetchLatestGithubRelease(request)
+		return fetchLatestGithubRelease(client, request)
 	case releaseSourceGitlab:
-		return fetchLatestGitLabRelease(request)
+		return fetchLatestGitLabRelease(client, request)
 	case releaseSourceDockerHub:
-		return fetchLatestDockerHubRelease(request)
+		return fetchLatestDockerHubRelease(client, request)
 	}
 
 	return nil, errors.New("unsupported source")
@@ -212,7 +220,7 @@ type githubReleaseResponseJson struct {
 	} `json:"reactions"`
 }
 
-func fetchLatestGithubRelease(request *releaseRequest) (*appRelease, error) {
+func fetchLatestGithubRelease(client fetch.Doer, request *releaseRequest) (*appRelease, error) {
 	var requestURL string
 	if !request.IncludePreleases {
 		requestURL = fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", request.Repository)
@@ -232,12 +240,12 @@ func fetchLatestGithubRelease(request *releaseRequest) (*appRelease, error) {
 	var response githubReleaseResponseJson
 
 	if !request.IncludePreleases {
-		response, err = decodeJsonFromRequest[githubReleaseResponseJson](defaultHTTPClient, httpRequest)
+		response, err = fetch.DecodeJSON[githubReleaseResponseJson](client, httpRequest)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		responses, err := decodeJsonFromRequest[[]githubReleaseResponseJson](defaultHTTPClient, httpRequest)
+		responses, err := fetch.DecodeJSON[[]githubReleaseResponseJson](client, httpRequest)
 		if err != nil {
 			return nil, err
 		}
@@ -273,7 +281,7 @@ const dockerHubRepoTagURLFormat = "https://hub.docker.com/r/%s/tags?name=%s"
 const dockerHubTagsURLFormat = "https://hub.docker.com/v2/namespaces/%s/repositories/%s/tags"
 const dockerHubSpecificTagURLFormat = "https://hub.docker.com/v2/namespaces/%s/repositories/%s/tags/%s"
 
-func fetchLatestDockerHubRelease(request *releaseRequest) (*appRelease, error) {
+func fetchLatestDockerHubRelease(client fetch.Doer, request *releaseRequest) (*appRelease, error) {
 	nameParts := strings.Split(request.Repository, "/")
 
 	if len(nameParts) > 2 {
@@ -303,7 +311,7 @@ func fetchLatestDockerHubRelease(request *releaseRequest) (*appRelease, error) {
 	var tag *dockerHubRepositoryTagResponse
 
 	if len(tagParts) == 1 {
-		response, err := decodeJsonFromRequest[dockerHubRepositoryTagsResponse](defaultHTTPClient, httpRequest)
+		response, err := fetch.DecodeJSON[dockerHubRepositoryTagsResponse](client, httpRequest)
 		if err != nil {
 			return nil, err
 		}
@@ -314,7 +322,7 @@ func fetchLatestDockerHubRelease(request *releaseRequest) (*appRelease, error) {
 
 		tag = &response.Results[0]
 	} else {
-		response, err := decodeJsonFromRequest[dockerHubRepositoryTagResponse](defaultHTTPClient, httpRequest)
+		response, err := fetch.DecodeJSON[dockerHubRepositoryTagResponse](client, httpRequest)
 		if err != nil {
 			return nil, err
 		}
@@ -357,7 +365,7 @@ type gitlabReleaseResponseJson struct {
 	} `json:"_links"`
 }
 
-func fetchLatestGitLabRelease(request *releaseRequest) (*appRelease, error) {
+func fetchLatestGitLabRelease(client fetch.Doer, request *releaseRequest) (*appRelease, error) {
 	httpRequest, err := http.NewRequest(
 		"GET",
 		fmt.Sprintf(
@@ -374,7 +382,7 @@ func fetchLatestGitLabRelease(request *releaseRequest) (*appRelease, error) {
 		httpRequest.Header.Add("PRIVATE-TOKEN", *request.token)
 	}
 
-	response, err := decodeJsonFromRequest[gitlabReleaseResponseJson](defaultHTTPClient, httpRequest)
+	response, err := fetch.DecodeJSON[gitlabReleaseResponseJson](client, httpRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -394,7 +402,7 @@ type codebergReleaseResponseJson struct {
 	HtmlUrl     string `json:"html_url"`
 }
 
-func fetchLatestCodebergRelease(request *releaseRequest) (*appRelease, error) {
+func fetchLatestCodebergRelease(client fetch.Doer, request *releaseRequest) (*appRelease, error) {
 	httpRequest, err := http.NewRequest(
 		"GET",
 		fmt.Sprintf(
@@ -407,7 +415,7 @@ func fetchLatestCodebergRelease(request *releaseRequest) (*appRelease, error) {
 		return nil, err
 	}
 
-	response, err := decodeJsonFromRequest[codebergReleaseResponseJson](defaultHTTPClient, httpRequest)
+	response, err := fetch.DecodeJSON[codebergReleaseResponseJson](client, httpRequest)
 	if err != nil {
 		return nil, err
 	}
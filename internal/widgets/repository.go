@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 )
 
 var repositoryWidgetTemplate = common.MustParseTemplate("repository.html", "widget-base.html")
@@ -44,6 +46,7 @@ func (widget *repositoryWidget) Initialize() error {
 
 func (widget *repositoryWidget) Update(ctx context.Context) {
 	details, err := fetchRepositoryDetailsFromGithub(
+		widget.httpClient(false),
 		widget.RequestedRepository,
 		string(widget.Token),
 		widget.PullRequestsLimit,
@@ -113,10 +116,10 @@ type gitHubCommitResponseJson struct {
 	} `json:"commit"`
 }
 
-func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, maxIssues int, maxCommits int) (repository, error) {
+func fetchRepositoryDetailsFromGithub(client fetch.Doer, repo string, token string, maxPRs int, maxIssues int, maxCommits int) (repository, error) {
 	repositoryRequest, err := http.NewRequest("GET", fmt.Sprintf("https://api.github.com/repos/%s", repo), nil)
 	if err != nil {
-		return repository{}, fmt.Errorf("%w: could not create request with repository: %v", errNoContent, err)
+		return repository{}, fmt.Errorf("%w: could not create request with repository: %v", models.ErrNoContent, err)
 	}
 
 	PRsRequest, _ := http.NewRequest("GET", fmt.Sprintf("https://api.github.com/search/issues?q=is:pr+is:open+repo:%s&per_page=%d", repo, maxPRs), nil)
@@ -144,14 +147,14 @@ func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, max
 	wg.Add(1)
 	go (func() {
 		defer wg.Done()
-		repositoryResponse, detailsErr = decodeJsonFromRequest[githubRepositoryResponseJson](defaultHTTPClient, repositoryRequest)
+		repositoryResponse, detailsErr = fetch.DecodeJSON[githubRepositoryResponseJson](client, repositoryRequest)
 	})()
 
 	if maxPRs > 0 {
 		wg.Add(1)
 		go (func() {
 			defer wg.Done()
-			PRsResponse, PRsErr = decodeJsonFromRequest[githubTicketResponseJson](defaultHTTPClient, PRsRequest)
+			PRsResponse, PRsErr = fetch.DecodeJSON[githubTicketResponseJson](client, PRsRequest)
 		})()
 	}
 
@@ -159,7 +162,7 @@ func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, max
 		wg.Add(1)
 		go (func() {
 			defer wg.Done()
-			issuesResponse, issuesErr = decodeJsonFromRequest[githubTicketResponseJson](defaultHTTPClient, issuesRequest)
+			issuesResponse, issuesErr = fetch.DecodeJSON[githubTicketResponseJson](client, issuesRequest)
 		})()
 	}
 
@@ -167,14 +170,14 @@ func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, max
 		wg.Add(1)
 		go (func() {
 			defer wg.Done()
-			commitsResponse, CommitsErr = decodeJsonFromRequest[[]gitHubCommitResponseJson](defaultHTTPClient, CommitsRequest)
+			commitsResponse, CommitsErr = fetch.DecodeJSON[[]gitHubCommitResponseJson](client, CommitsRequest)
 		})()
 	}
 
 	wg.Wait()
 
 	if detailsErr != nil {
-		return repository{}, fmt.Errorf("%w: could not get repository details: %s", errNoContent, detailsErr)
+		return repository{}, fmt.Errorf("%w: could not get repository details: %s", models.ErrNoContent, detailsErr)
 	}
 
 	details := repository{
@@ -190,7 +193,7 @@ func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, max
 
 	if maxPRs > 0 {
 		if PRsErr != nil {
-			err = fmt.Errorf("%w: could not get PRs: %s", errPartialContent, PRsErr)
+			err = fmt.Errorf("%w: could not get PRs: %s", models.ErrPartialContent, PRsErr)
 		} else {
 			details.OpenPullRequests = PRsResponse.Count
 
@@ -207,7 +210,7 @@ func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, max
 	if maxIssues > 0 {
 		if issuesErr != nil {
 			// TODO: fix, overwriting the previous error
-			err = fmt.Errorf("%w: could not get issues: %s", errPartialContent, issuesErr)
+			err = fmt.Errorf("%w: could not get issues: %s", models.ErrPartialContent, issuesErr)
 		} else {
 			details.OpenIssues = issuesResponse.Count
 
@@ -223,7 +226,7 @@ func fetchRepositoryDetailsFromGithub(repo string, token string, maxPRs int, max
 
 	if maxCommits > 0 {
 		if CommitsErr != nil {
-			err = fmt.Errorf("%w: could not get commits: %s", errPartialContent, CommitsErr)
+			err = fmt.Errorf("%w: could not get commits: %s", models.ErrPartialContent, CommitsErr)
 		} else {
 			for i := range commitsResponse {
 				details.Commits = append(details.Commits, githubCommitDetails{
@@ -9,13 +9,15 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
-	"regexp"
+	"os"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/limpdev/gander/internal/opml"
 	"github.com/mmcdole/gofeed"
 	gofeedext "github.com/mmcdole/gofeed/extensions"
 )
@@ -32,6 +34,7 @@ var feedParser = gofeed.NewParser()
 type rssWidget struct {
 	widgetBase       `yaml:",inline"`
 	FeedRequests     []rssFeedRequest `yaml:"feeds"`
+	OPML             string           `yaml:"opml"`
 	Style            string           `yaml:"style"`
 	ThumbnailHeight  float64          `yaml:"thumbnail-height"`
 	CardHeight       float64          `yaml:"card-height"`
@@ -39,6 +42,8 @@ type rssWidget struct {
 	CollapseAfter    int              `yaml:"collapse-after"`
 	SingleLineTitles bool             `yaml:"single-line-titles"`
 	PreserveOrder    bool             `yaml:"preserve-order"`
+	HTMLPolicy       string           `yaml:"html-policy"`
+	Transform        *itemTransform   `yaml:"transform"`
 
 	Items          rssFeedItemList `yaml:"-"`
 	NoItemsMessage string          `yaml:"-"`
@@ -66,18 +71,71 @@ func (widget *rssWidget) Initialize() error {
 		widget.CardHeight = 0
 	}
 
+	if widget.OPML != "" {
+		if err := widget.addFeedsFromOPML(); err != nil {
+			return fmt.Errorf("opml %s: %w", widget.OPML, err)
+		}
+	}
+
+	if widget.HTMLPolicy == "" {
+		widget.HTMLPolicy = common.HTMLPolicyStrict
+	} else if err := common.ValidateHTMLPolicy(widget.HTMLPolicy); err != nil {
+		return err
+	}
+
 	if widget.Style == "detailed-list" {
 		for i := range widget.FeedRequests {
 			widget.FeedRequests[i].IsDetailed = true
+			widget.FeedRequests[i].htmlPolicy = widget.HTMLPolicy
 		}
 	}
 
 	widget.NoItemsMessage = "No items were returned from the feeds."
 	widget.cachedFeeds = make(map[string]*cachedRSSFeed)
 
+	return widget.Transform.initialize(rssFeedItem{})
+}
+
+// Feeds that are also listed under feeds are skipped so that their options,
+// such as headers, can be set there
+func (widget *rssWidget) addFeedsFromOPML() error {
+	file, err := os.Open(widget.OPML)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	feeds, err := opml.Parse(file)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]struct{}, len(widget.FeedRequests)+len(feeds))
+	for i := range widget.FeedRequests {
+		seen[widget.FeedRequests[i].URL] = struct{}{}
+	}
+
+	for _, feed := range feeds {
+		if _, exists := seen[feed.URL]; exists {
+			continue
+		}
+
+		seen[feed.URL] = struct{}{}
+		widget.FeedRequests = append(widget.FeedRequests, rssFeedRequest{URL: feed.URL, Title: feed.Title})
+	}
+
 	return nil
 }
 
+func (widget *rssWidget) GetFeeds() []models.Feed {
+	feeds := make([]models.Feed, len(widget.FeedRequests))
+	for i := range widget.FeedRequests {
+		feeds[i] = models.Feed{Title: widget.FeedRequests[i].Title, URL: widget.FeedRequests[i].URL}
+	}
+
+	return feeds
+}
+
 func (widget *rssWidget) Update(ctx context.Context) {
 	items, err := widget.fetchItemsFromFeeds()
 
@@ -89,6 +147,10 @@ func (widget *rssWidget) Update(ctx context.Context) {
 		items.sortByNewest()
 	}
 
+	if items, err = transformItems(widget.Transform, items); err != nil {
+		widget.withNotice(err)
+	}
+
 	if len(items) > widget.Limit {
 		items = items[:widget.Limit]
 	}
@@ -126,7 +188,9 @@ type rssFeedItem struct {
 	ImageURL    string
 	Categories  []string
 	Description string
-	PublishedAt time.Time
+	// Only set when the HTML of the description is kept
+	DescriptionHTML template.HTML
+	PublishedAt     time.Time
 }
 
 type rssFeedRequest struct {
@@ -138,6 +202,7 @@ type rssFeedRequest struct {
 	ItemLinkPrefix  string            `yaml:"item-link-prefix"`
 	Headers         map[string]string `yaml:"headers"`
 	IsDetailed      bool              `yaml:"-"`
+	htmlPolicy      string
 }
 
 type rssFeedItemList []rssFeedItem
@@ -156,7 +221,7 @@ func (widget *rssWidget) fetchItemsFromFeeds() (rssFeedItemList, error) {
 	job := newJob(widget.fetchItemsFromFeedTask, requests).withWorkers(30)
 	feeds, errs, err := workerPoolDo(job)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
 	}
 
 	failed := 0
@@ -180,11 +245,11 @@ func (widget *rssWidget) fetchItemsFromFeeds() (rssFeedItemList, error) {
 	}
 
 	if failed == len(requests) {
-		return nil, errNoContent
+		return nil, models.ErrNoContent
 	}
 
 	if failed > 0 {
-		return entries, fmt.Errorf("%w: missing %d RSS feeds", errPartialContent, failed)
+		return entries, fmt.Errorf("%w: missing %d RSS feeds", models.ErrPartialContent, failed)
 	}
 
 	return entries, nil
@@ -196,8 +261,6 @@ func (widget *rssWidget) fetchItemsFromFeedTask(request rssFeedRequest) ([]rssFe
 		return nil, err
 	}
 
-	req.Header.Add("User-Agent", glanceUserAgentString)
-
 	widget.cachedFeedsMutex.Lock()
 	cache, isCached := widget.cachedFeeds[request.URL]
 	if isCached {
@@ -214,7 +277,7 @@ func (widget *rssWidget) fetchItemsFromFeedTask(request rssFeedRequest) ([]rssFe
 		req.Header.Set(key, value)
 	}
 
-	resp, err := defaultHTTPClient.Do(req)
+	resp, err := widget.httpClient(false).Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -283,6 +346,10 @@ func (widget *rssWidget) fetchItemsFromFeedTask(request rssFeedRequest) ([]rssFe
 		if request.IsDetailed {
 			if !request.HideDescription && item.Description != "" && item.Title != "" {
 				rssItem.Description = shortenFeedDescriptionLen(item.Description, 200)
+
+				if request.htmlPolicy != common.HTMLPolicyStrict {
+					rssItem.DescriptionHTML = common.SanitizeHTML(request.htmlPolicy, item.Description)
+				}
 			}
 
 			if !request.HideCategories {
@@ -374,18 +441,14 @@ func recursiveFindThumbnailInExtensions(extensions map[string][]gofeedext.Extens
 	return ""
 }
 
-var htmlTagsWithAttributesPattern = regexp.MustCompile(`<\/?[a-zA-Z0-9-]+ *(?:[a-zA-Z-]+=(?:"|').*?(?:"|') ?)* *\/?>`)
-
 func sanitizeFeedDescription(description string) string {
 	if description == "" {
 		return ""
 	}
 
-	description = strings.ReplaceAll(description, "\n", " ")
-	description = htmlTagsWithAttributesPattern.ReplaceAllString(description, "")
+	description = common.HTMLToText(description)
 	description = common.SequentialWhitespacePattern.ReplaceAllString(description, " ")
 	description = strings.TrimSpace(description)
-	description = html.UnescapeString(description)
 
 	return description
 }
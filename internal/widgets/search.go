@@ -3,6 +3,7 @@ package widgets
 import (
 	"fmt"
 	"html/template"
+	"slices"
 	"strings"
 
 	"github.com/limpdev/gander/internal/common"
@@ -33,37 +34,54 @@ func convertSearchUrl(url string) string {
 	return strings.ReplaceAll(url, "{QUERY}", "!QUERY!")
 }
 
-var searchEngines = map[string]string{
-	"duckduckgo": "https://duckduckgo.com/?q={QUERY}",
-	"google":     "https://www.google.com/search?q={QUERY}",
-	"bing":       "https://www.bing.com/search?q={QUERY}",
-	"perplexity": "https://www.perplexity.ai/search?q={QUERY}",
-	"kagi":       "https://kagi.com/search?q={QUERY}",
-	"startpage":  "https://www.startpage.com/search?q={QUERY}",
+// Where the search gets sent to, with {QUERY} in place of what was typed
+type searchProvider interface {
+	queryURL() string
+}
+
+type searchEngine string
+
+func (e searchEngine) queryURL() string {
+	return string(e)
 }
 
 func (widget *searchWidget) Initialize() error {
 	widget.withTitle("Search").withError(nil)
 
-	if widget.SearchEngine == "" {
-		widget.SearchEngine = "duckduckgo"
-	}
-
 	if widget.Placeholder == "" {
 		widget.Placeholder = "Type here to search…"
 	}
 
-	if url, ok := searchEngines[widget.SearchEngine]; ok {
-		widget.SearchEngine = url
+	if widget.Target == "" {
+		widget.Target = "_blank"
+	} else if !slices.Contains([]string{"_blank", "_self", "_parent", "_top"}, widget.Target) {
+		return fmt.Errorf("target must be one of _blank, _self, _parent or _top, got %s", widget.Target)
+	}
+
+	// anything other than the name of a provider is the URL of a custom engine
+	if widget.SearchEngine == "" || searchProviders.has(widget.SearchEngine) {
+		provider, err := searchProviders.get(widget.SearchEngine)
+		if err != nil {
+			return err
+		}
+
+		widget.SearchEngine = provider.queryURL()
 	}
 
 	widget.SearchEngine = convertSearchUrl(widget.SearchEngine)
 
+	shortcuts := make(map[string]struct{}, len(widget.Bangs))
+
 	for i := range widget.Bangs {
 		if widget.Bangs[i].Shortcut == "" {
 			return fmt.Errorf("search bang #%d has no shortcut", i+1)
 		}
 
+		if _, exists := shortcuts[widget.Bangs[i].Shortcut]; exists {
+			return fmt.Errorf("search bang #%d has a duplicate shortcut: %s", i+1, widget.Bangs[i].Shortcut)
+		}
+		shortcuts[widget.Bangs[i].Shortcut] = struct{}{}
+
 		if widget.Bangs[i].URL == "" {
 			return fmt.Errorf("search bang #%d has no URL", i+1)
 		}
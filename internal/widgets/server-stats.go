@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"github.com/limpdev/gander/internal/models"
 	"github.com/limpdev/gander/pkg/sysinfo"
 )
@@ -53,7 +54,7 @@ func (widget *serverStatsWidget) Update(ctx context.Context) {
 
 			if len(errs) > 0 {
 				for i := range errs {
-					slog.Warn("Getting system info: " + errs[i].Error())
+					slog.Warn("Getting system info", "error", errs[i])
 				}
 			}
 
@@ -63,9 +64,9 @@ func (widget *serverStatsWidget) Update(ctx context.Context) {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				info, err := fetchRemoteServerInfo(serv)
+				info, err := fetchRemoteServerInfo(widget.httpClient(false), serv)
 				if err != nil {
-					slog.Warn("Getting remote system info: " + err.Error())
+					slog.Warn("Getting remote system info", "url", serv.URL, "error", err)
 					serv.IsReachable = false
 					serv.Info = &sysinfo.SystemInfo{
 						Hostname: "Unnamed server #" + strconv.Itoa(i+1),
@@ -101,7 +102,7 @@ type serverStatsRequest struct {
 	// Provider                   string              `yaml:"provider"`
 }
 
-func fetchRemoteServerInfo(infoReq *serverStatsRequest) (*sysinfo.SystemInfo, error) {
+func fetchRemoteServerInfo(client fetch.Doer, infoReq *serverStatsRequest) (*sysinfo.SystemInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(infoReq.Timeout))
 	defer cancel()
 
@@ -110,7 +111,7 @@ func fetchRemoteServerInfo(infoReq *serverStatsRequest) (*sysinfo.SystemInfo, er
 		request.Header.Set("Authorization", "Bearer "+infoReq.Token)
 	}
 
-	info, err := decodeJsonFromRequest[*sysinfo.SystemInfo](defaultHTTPClient, request)
+	info, err := fetch.DecodeJSON[*sysinfo.SystemInfo](client, request)
 	if err != nil {
 		return nil, err
 	}
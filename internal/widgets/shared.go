@@ -14,17 +14,17 @@ const twitchGqlClientId = "kimne78kx3ncx6brgo4mv6wki5h1ko"
 var forumPostsTemplate = common.MustParseTemplate("forum-posts.html", "widget-base.html")
 
 type forumPost struct {
-	Title           string
-	DiscussionUrl   string
-	TargetUrl       string
-	TargetUrlDomain string
-	ThumbnailUrl    string
-	CommentCount    int
-	Score           int
-	Engagement      float64
-	TimePosted      time.Time
-	Tags            []string
-	IsCrosspost     bool
+	Title           string    `json:"title"`
+	DiscussionUrl   string    `json:"discussion_url"`
+	TargetUrl       string    `json:"target_url,omitempty"`
+	TargetUrlDomain string    `json:"target_url_domain,omitempty"`
+	ThumbnailUrl    string    `json:"thumbnail_url,omitempty"`
+	CommentCount    int       `json:"comment_count"`
+	Score           int       `json:"score"`
+	Engagement      float64   `json:"engagement"`
+	TimePosted      time.Time `json:"time_posted"`
+	Tags            []string  `json:"tags,omitempty"`
+	IsCrosspost     bool      `json:"is_crosspost"`
 }
 
 type forumPostList []forumPost
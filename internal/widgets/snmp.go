@@ -0,0 +1,411 @@
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var snmpWidgetTemplate = common.MustParseTemplate("snmp.html", "widget-base.html")
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"md5":    gosnmp.MD5,
+	"sha":    gosnmp.SHA,
+	"sha224": gosnmp.SHA224,
+	"sha256": gosnmp.SHA256,
+	"sha384": gosnmp.SHA384,
+	"sha512": gosnmp.SHA512,
+}
+
+var snmpPrivacyProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"des":     gosnmp.DES,
+	"aes":     gosnmp.AES,
+	"aes192":  gosnmp.AES192,
+	"aes256":  gosnmp.AES256,
+	"aes192c": gosnmp.AES192C,
+	"aes256c": gosnmp.AES256C,
+}
+
+const (
+	snmpFormatNumber   = "number"
+	snmpFormatBytes    = "bytes"
+	snmpFormatDuration = "duration"
+	snmpFormatText     = "text"
+)
+
+const (
+	snmpStatusWarning     = "warning"
+	snmpStatusCritical    = "critical"
+	snmpStatusUnavailable = "unavailable"
+)
+
+type snmpWidget struct {
+	widgetBase      `yaml:",inline"`
+	Host            string      `yaml:"host"`
+	Port            uint16      `yaml:"port"`
+	Version         string      `yaml:"version"`
+	Community       string      `yaml:"community"`
+	Username        string      `yaml:"username"`
+	AuthProtocol    string      `yaml:"auth-protocol"`
+	AuthPassword    string      `yaml:"auth-password"`
+	PrivacyProtocol string      `yaml:"privacy-protocol"`
+	PrivacyPassword string      `yaml:"privacy-password"`
+	Values          []snmpValue `yaml:"values"`
+
+	timeout            time.Duration                 `yaml:"-"`
+	securityParameters *gosnmp.UsmSecurityParameters `yaml:"-"`
+	msgFlags           gosnmp.SnmpV3MsgFlags         `yaml:"-"`
+}
+
+type snmpValue struct {
+	Name          string   `yaml:"name"`
+	OID           string   `yaml:"oid"`
+	MaxOID        string   `yaml:"max-oid"`
+	Format        string   `yaml:"format"`
+	Unit          string   `yaml:"unit"`
+	Scale         float64  `yaml:"scale"`
+	WarnAbove     *float64 `yaml:"warn-above"`
+	CriticalAbove *float64 `yaml:"critical-above"`
+	WarnBelow     *float64 `yaml:"warn-below"`
+	CriticalBelow *float64 `yaml:"critical-below"`
+
+	Text   string `yaml:"-"`
+	Status string `yaml:"-"`
+	// Only set when max-oid is, -1 otherwise
+	Percent int `yaml:"-"`
+}
+
+func (widget *snmpWidget) Initialize() error {
+	if widget.Host == "" {
+		return errors.New("host is required")
+	}
+
+	if len(widget.Values) == 0 {
+		return errors.New("at least one value is required")
+	}
+
+	widget.withTitle(widget.Host).withCacheDuration(1 * time.Minute)
+
+	if widget.Port == 0 {
+		widget.Port = 161
+	}
+
+	widget.timeout = time.Duration(widget.RequestTimeout)
+	if widget.timeout <= 0 {
+		widget.timeout = common.DefaultClientTimeout
+	}
+
+	switch widget.Version {
+	case "":
+		widget.Version = "2c"
+		fallthrough
+	case "2c":
+		if widget.Community == "" {
+			widget.Community = "public"
+		}
+	case "3":
+		params, flags, err := widget.v3SecurityParameters()
+		if err != nil {
+			return err
+		}
+		widget.securityParameters, widget.msgFlags = params, flags
+	default:
+		return fmt.Errorf("version must be either 2c or 3, got %q", widget.Version)
+	}
+
+	for i := range widget.Values {
+		value := &widget.Values[i]
+
+		if value.OID == "" {
+			return fmt.Errorf("value #%d has no oid", i+1)
+		}
+
+		if value.Name == "" {
+			value.Name = value.OID
+		}
+
+		value.OID = "." + strings.TrimPrefix(value.OID, ".")
+		if value.MaxOID != "" {
+			value.MaxOID = "." + strings.TrimPrefix(value.MaxOID, ".")
+		}
+
+		switch value.Format {
+		case "":
+			value.Format = snmpFormatNumber
+		case snmpFormatNumber, snmpFormatBytes, snmpFormatDuration, snmpFormatText:
+		default:
+			return fmt.Errorf("format of %s must be one of number, bytes, duration or text, got %q", value.Name, value.Format)
+		}
+
+		if value.MaxOID != "" && value.Format != snmpFormatNumber {
+			return fmt.Errorf("max-oid of %s can only be used when the format is number", value.Name)
+		}
+
+		if value.Scale == 0 {
+			value.Scale = 1
+		}
+
+		value.Percent = -1
+	}
+
+	return nil
+}
+
+func (widget *snmpWidget) v3SecurityParameters() (*gosnmp.UsmSecurityParameters, gosnmp.SnmpV3MsgFlags, error) {
+	if widget.Username == "" {
+		return nil, 0, errors.New("username is required when using version 3")
+	}
+
+	params := &gosnmp.UsmSecurityParameters{
+		UserName:                 widget.Username,
+		AuthenticationProtocol:   gosnmp.NoAuth,
+		PrivacyProtocol:          gosnmp.NoPriv,
+		AuthenticationPassphrase: widget.AuthPassword,
+		PrivacyPassphrase:        widget.PrivacyPassword,
+	}
+	flags := gosnmp.NoAuthNoPriv
+
+	if widget.AuthProtocol != "" {
+		protocol, ok := snmpAuthProtocols[strings.ToLower(widget.AuthProtocol)]
+		if !ok {
+			return nil, 0, fmt.Errorf("unsupported auth-protocol %q", widget.AuthProtocol)
+		}
+		if widget.AuthPassword == "" {
+			return nil, 0, errors.New("auth-password is required when auth-protocol is set")
+		}
+		params.AuthenticationProtocol = protocol
+		flags = gosnmp.AuthNoPriv
+	}
+
+	if widget.PrivacyProtocol != "" {
+		if widget.AuthProtocol == "" {
+			return nil, 0, errors.New("privacy-protocol can only be used along with auth-protocol")
+		}
+		protocol, ok := snmpPrivacyProtocols[strings.ToLower(widget.PrivacyProtocol)]
+		if !ok {
+			return nil, 0, fmt.Errorf("unsupported privacy-protocol %q", widget.PrivacyProtocol)
+		}
+		if widget.PrivacyPassword == "" {
+			return nil, 0, errors.New("privacy-password is required when privacy-protocol is set")
+		}
+		params.PrivacyProtocol = protocol
+		flags = gosnmp.AuthPriv
+	}
+
+	return params, flags, nil
+}
+
+func (widget *snmpWidget) Update(ctx context.Context) {
+	oids := make([]string, 0, len(widget.Values))
+	for i := range widget.Values {
+		oids = append(oids, widget.Values[i].OID)
+		if widget.Values[i].MaxOID != "" {
+			oids = append(oids, widget.Values[i].MaxOID)
+		}
+	}
+
+	variables, err := widget.get(ctx, oids)
+	if err == nil {
+		var missing []string
+
+		for i := range widget.Values {
+			value := &widget.Values[i]
+			if !value.set(variables) {
+				missing = append(missing, value.Name)
+			}
+		}
+
+		if len(missing) == len(widget.Values) {
+			err = errors.New("none of the values are available")
+		} else if len(missing) > 0 {
+			err = fmt.Errorf("%w: %s not available", models.ErrPartialContent, strings.Join(missing, ", "))
+		}
+	}
+
+	widget.canContinueUpdateAfterHandlingErr(err)
+}
+
+func (widget *snmpWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, snmpWidgetTemplate)
+}
+
+// Devices only accept so many OIDs per request, so they get split up
+func (widget *snmpWidget) get(ctx context.Context, oids []string) (map[string]gosnmp.SnmpPDU, error) {
+	client := &gosnmp.GoSNMP{
+		Target:  widget.Host,
+		Port:    widget.Port,
+		Context: ctx,
+		Timeout: widget.timeout,
+		Retries: 1,
+		MaxOids: gosnmp.MaxOids,
+	}
+
+	if widget.Version == "3" {
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.MsgFlags = widget.msgFlags
+		// the client keeps track of the engine of the device in there
+		client.SecurityParameters = widget.securityParameters.Copy()
+	} else {
+		client.Version = gosnmp.Version2c
+		client.Community = widget.Community
+	}
+
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("connecting to %s: %v", net.JoinHostPort(widget.Host, strconv.Itoa(int(widget.Port))), err)
+	}
+	defer client.Conn.Close()
+
+	variables := make(map[string]gosnmp.SnmpPDU, len(oids))
+	for start := 0; start < len(oids); start += client.MaxOids {
+		packet, err := client.Get(oids[start:min(start+client.MaxOids, len(oids))])
+		if err != nil {
+			return nil, err
+		}
+
+		if packet.Error != gosnmp.NoError {
+			return nil, fmt.Errorf("device responded with %s", packet.Error)
+		}
+
+		for _, variable := range packet.Variables {
+			variables[variable.Name] = variable
+		}
+	}
+
+	return variables, nil
+}
+
+// Reports whether the value was available
+func (value *snmpValue) set(variables map[string]gosnmp.SnmpPDU) bool {
+	value.Status = ""
+	value.Percent = -1
+
+	variable, ok := variables[value.OID]
+	if !ok || snmpIsMissing(variable.Type) {
+		value.Text = "-"
+		value.Status = snmpStatusUnavailable
+		return false
+	}
+
+	number, numeric := snmpNumber(variable)
+
+	if value.Format == snmpFormatText || !numeric {
+		value.Text = snmpText(variable)
+		return true
+	}
+
+	number *= value.Scale
+
+	if value.MaxOID != "" {
+		maxVariable, ok := variables[value.MaxOID]
+		if maxNumber, numeric := snmpNumber(maxVariable); ok && numeric && maxNumber > 0 {
+			number = number / (maxNumber * value.Scale) * 100
+			value.Percent = int(math.Round(min(max(number, 0), 100)))
+			value.Text = strconv.Itoa(value.Percent) + "%"
+		} else {
+			value.Text = "-"
+			value.Status = snmpStatusUnavailable
+			return false
+		}
+	} else {
+		switch value.Format {
+		case snmpFormatBytes:
+			value.Text = snmpFormatByteCount(number)
+		case snmpFormatDuration:
+			// uptimes and the like are sent as hundredths of a second
+			if variable.Type == gosnmp.TimeTicks {
+				number /= 100
+			}
+			value.Text = snmpFormatSeconds(number)
+		default:
+			value.Text = strconv.FormatFloat(math.Round(number*100)/100, 'f', -1, 64)
+			if value.Unit != "" {
+				value.Text += " " + value.Unit
+			}
+		}
+	}
+
+	switch {
+	case value.CriticalAbove != nil && number > *value.CriticalAbove,
+		value.CriticalBelow != nil && number < *value.CriticalBelow:
+		value.Status = snmpStatusCritical
+	case value.WarnAbove != nil && number > *value.WarnAbove,
+		value.WarnBelow != nil && number < *value.WarnBelow:
+		value.Status = snmpStatusWarning
+	}
+
+	return true
+}
+
+func snmpIsMissing(kind gosnmp.Asn1BER) bool {
+	return kind == gosnmp.NoSuchObject || kind == gosnmp.NoSuchInstance || kind == gosnmp.EndOfMibView || kind == gosnmp.Null
+}
+
+func snmpNumber(variable gosnmp.SnmpPDU) (float64, bool) {
+	switch variable.Type {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Counter64, gosnmp.Uinteger32:
+		number, _ := gosnmp.ToBigInt(variable.Value).Float64()
+		return number, true
+	case gosnmp.OpaqueFloat:
+		number, ok := variable.Value.(float32)
+		return float64(number), ok
+	case gosnmp.OpaqueDouble:
+		number, ok := variable.Value.(float64)
+		return number, ok
+	case gosnmp.OctetString:
+		// some devices, such as UPSes, send numbers as strings
+		number, err := strconv.ParseFloat(strings.TrimSpace(string(variable.Value.([]byte))), 64)
+		return number, err == nil
+	}
+
+	return 0, false
+}
+
+func snmpText(variable gosnmp.SnmpPDU) string {
+	switch value := variable.Value.(type) {
+	case []byte:
+		return strings.TrimSpace(string(value))
+	case string:
+		return value
+	}
+
+	return fmt.Sprint(variable.Value)
+}
+
+func snmpFormatByteCount(bytes float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	unit := 0
+
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+
+	return strconv.FormatFloat(bytes, 'f', common.Ternary(unit == 0, 0, 1), 64) + " " + units[unit]
+}
+
+func snmpFormatSeconds(seconds float64) string {
+	duration := time.Duration(seconds) * time.Second
+	days := int(duration.Hours()) / 24
+	hours := int(duration.Hours()) % 24
+	minutes := int(duration.Minutes()) % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+
+	return fmt.Sprintf("%dm", minutes)
+}
@@ -0,0 +1,284 @@
+package widgets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var speedtestWidgetTemplate = common.MustParseTemplate("speedtest.html", "widget-base.html")
+
+const (
+	speedtestDefaultTestServer     = "https://speed.cloudflare.com"
+	speedtestDefaultRequestTimeout = time.Minute
+	speedtestLatencySamples        = 5
+)
+
+type speedtestWidget struct {
+	widgetBase    `yaml:",inline"`
+	URL           string `yaml:"url"`
+	APIToken      string `yaml:"api-token"`
+	AllowInsecure bool   `yaml:"allow-insecure"`
+	TestServer    string `yaml:"test-server"`
+	DownloadSize  int    `yaml:"download-size"`
+	UploadSize    int    `yaml:"upload-size"`
+	HistoryLength int    `yaml:"history-length"`
+
+	stateKey      string            `yaml:"-"`
+	historyLoaded bool              `yaml:"-"`
+	History       []speedtestResult `yaml:"-"`
+	Latest        *speedtestResult  `yaml:"-"`
+	DownloadChart string            `yaml:"-"`
+	UploadChart   string            `yaml:"-"`
+}
+
+type speedtestResult struct {
+	// Only set for results from speedtest-tracker, used to tell whether the
+	// latest result is a new one
+	ID   int       `json:"id,omitempty"`
+	Time time.Time `json:"time"`
+	// In Mbps
+	Download float64 `json:"download"`
+	Upload   float64 `json:"upload"`
+	// In milliseconds
+	Ping float64 `json:"ping"`
+}
+
+func (widget *speedtestWidget) Initialize() error {
+	if widget.URL != "" {
+		if widget.APIToken == "" {
+			return errors.New("api-token is required when using speedtest-tracker")
+		}
+
+		widget.URL = strings.TrimRight(widget.URL, "/")
+		widget.withTitle("Speedtest").withTitleURL(widget.URL).withCacheDuration(5 * time.Minute)
+	} else {
+		if widget.TestServer == "" {
+			widget.TestServer = speedtestDefaultTestServer
+		}
+
+		widget.TestServer = strings.TrimRight(widget.TestServer, "/")
+		widget.withTitle("Speedtest").withCacheDuration(1 * time.Hour)
+
+		if widget.DownloadSize <= 0 {
+			widget.DownloadSize = 25
+		}
+
+		if widget.UploadSize <= 0 {
+			widget.UploadSize = 10
+		}
+
+		// the default timeout is meant for API requests rather than for
+		// transferring tens of megabytes over a slow connection
+		if widget.RequestTimeout == 0 {
+			widget.RequestTimeout = models.DurationField(speedtestDefaultRequestTimeout)
+		}
+	}
+
+	if widget.HistoryLength <= 0 {
+		widget.HistoryLength = 24
+	}
+
+	// tests against the same source share their history, even across pages
+	source := sha256.Sum256([]byte(widget.URL + "\n" + widget.TestServer))
+	widget.stateKey = "speedtest-" + hex.EncodeToString(source[:8])
+
+	return nil
+}
+
+func (widget *speedtestWidget) Update(ctx context.Context) {
+	widget.loadHistory()
+
+	client := widget.httpClient(widget.AllowInsecure)
+
+	var result speedtestResult
+	var err error
+	if widget.URL != "" {
+		result, err = fetchSpeedtestTrackerLatest(ctx, client, widget.URL, widget.APIToken)
+	} else {
+		result, err = runSpeedtest(ctx, client, widget.TestServer, widget.DownloadSize, widget.UploadSize)
+	}
+
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	if result.ID == 0 || len(widget.History) == 0 || widget.History[len(widget.History)-1].ID != result.ID {
+		widget.History = append(widget.History, result)
+		if len(widget.History) > widget.HistoryLength {
+			widget.History = slices.Delete(widget.History, 0, len(widget.History)-widget.HistoryLength)
+		}
+
+		widget.saveHistory()
+	}
+
+	widget.setCharts()
+}
+
+func (widget *speedtestWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, speedtestWidgetTemplate)
+}
+
+func (widget *speedtestWidget) loadHistory() {
+	if widget.historyLoaded || widget.Providers == nil || widget.Providers.State == nil {
+		return
+	}
+	widget.historyLoaded = true
+
+	if err := widget.Providers.State.LoadWidgetState(widget.stateKey, &widget.History); err != nil {
+		slog.Error("Failed to load speedtest history", "error", err)
+		return
+	}
+
+	if len(widget.History) > widget.HistoryLength {
+		widget.History = widget.History[len(widget.History)-widget.HistoryLength:]
+	}
+
+	widget.setCharts()
+}
+
+func (widget *speedtestWidget) saveHistory() {
+	if widget.Providers == nil || widget.Providers.State == nil {
+		return
+	}
+
+	if err := widget.Providers.State.SaveWidgetState(widget.stateKey, widget.History); err != nil {
+		slog.Error("Failed to save speedtest history", "error", err)
+	}
+}
+
+func (widget *speedtestWidget) setCharts() {
+	if len(widget.History) == 0 {
+		return
+	}
+
+	widget.Latest = &widget.History[len(widget.History)-1]
+
+	downloads := make([]float64, len(widget.History))
+	uploads := make([]float64, len(widget.History))
+	for i := range widget.History {
+		downloads[i] = widget.History[i].Download
+		uploads[i] = widget.History[i].Upload
+	}
+
+	widget.DownloadChart = common.SvgPolylineCoordsFromYValues(100, 30, downloads)
+	widget.UploadChart = common.SvgPolylineCoordsFromYValues(100, 30, uploads)
+}
+
+type speedtestTrackerResultJson struct {
+	Data struct {
+		ID           int     `json:"id"`
+		Ping         float64 `json:"ping"`
+		DownloadBits float64 `json:"download_bits"`
+		UploadBits   float64 `json:"upload_bits"`
+		CreatedAt    string  `json:"created_at"`
+	} `json:"data"`
+}
+
+func fetchSpeedtestTrackerLatest(ctx context.Context, client fetch.Doer, instanceURL, token string) (speedtestResult, error) {
+	request, _ := http.NewRequestWithContext(ctx, "GET", instanceURL+"/api/v1/results/latest", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Accept", "application/json")
+
+	response, err := fetch.DecodeJSON[speedtestTrackerResultJson](client, request)
+	if err != nil {
+		return speedtestResult{}, err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, response.Data.CreatedAt)
+	if err != nil {
+		createdAt, err = time.ParseInLocation(time.DateTime, response.Data.CreatedAt, time.Local)
+		if err != nil {
+			return speedtestResult{}, fmt.Errorf("parsing time of result: %v", err)
+		}
+	}
+
+	return speedtestResult{
+		ID:       response.Data.ID,
+		Time:     createdAt,
+		Download: response.Data.DownloadBits / 1_000_000,
+		Upload:   response.Data.UploadBits / 1_000_000,
+		Ping:     response.Data.Ping,
+	}, nil
+}
+
+// Measures against a server that implements the endpoints of speed.cloudflare.com,
+// sizes are in megabytes
+func runSpeedtest(ctx context.Context, client fetch.Doer, server string, downloadSize, uploadSize int) (speedtestResult, error) {
+	result := speedtestResult{Time: time.Now()}
+
+	// the lowest of several samples, the first one also includes setting up the
+	// connection, which the rest reuse
+	for range speedtestLatencySamples {
+		elapsed, err := speedtestTimeRequest(ctx, client, "GET", server+"/__down?bytes=0", nil)
+		if err != nil {
+			return result, fmt.Errorf("measuring latency: %v", err)
+		}
+
+		if ms := float64(elapsed.Microseconds()) / 1000; result.Ping == 0 || ms < result.Ping {
+			result.Ping = ms
+		}
+	}
+
+	downloadBytes := downloadSize * 1_000_000
+	elapsed, err := speedtestTimeRequest(ctx, client, "GET", server+"/__down?bytes="+strconv.Itoa(downloadBytes), nil)
+	if err != nil {
+		return result, fmt.Errorf("measuring download: %v", err)
+	}
+	result.Download = speedtestMbps(downloadBytes, elapsed)
+
+	uploadBytes := uploadSize * 1_000_000
+	elapsed, err = speedtestTimeRequest(ctx, client, "POST", server+"/__up", make([]byte, uploadBytes))
+	if err != nil {
+		return result, fmt.Errorf("measuring upload: %v", err)
+	}
+	result.Upload = speedtestMbps(uploadBytes, elapsed)
+
+	return result, nil
+}
+
+func speedtestTimeRequest(ctx context.Context, client fetch.Doer, method, url string, body []byte) (time.Duration, error) {
+	request, _ := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	start := time.Now()
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if _, err := io.Copy(io.Discard, response.Body); err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code %d from %s", response.StatusCode, request.URL.Host)
+	}
+
+	return elapsed, nil
+}
+
+func speedtestMbps(bytes int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(bytes) * 8 / elapsed.Seconds() / 1_000_000
+}
@@ -2,7 +2,12 @@ package widgets
 
 import (
 	"context"
+	"fmt"
 	"html/template"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
@@ -14,7 +19,9 @@ var splitColumnWidgetTemplate = common.MustParseTemplate("split-column.html", "w
 type splitColumnWidget struct {
 	widgetBase          `yaml:",inline"`
 	containerWidgetBase `yaml:",inline"`
-	MaxColumns          int `yaml:"max-columns"`
+	MaxColumns          int         `yaml:"max-columns"`
+	ColumnsAt           map[int]int `yaml:"columns-at"`
+	ColumnsAtCSS        string      `yaml:"-"`
 }
 
 func (widget *splitColumnWidget) Initialize() error {
@@ -28,6 +35,28 @@ func (widget *splitColumnWidget) Initialize() error {
 		widget.MaxColumns = 2
 	}
 
+	breakpoints := slices.Sorted(maps.Keys(widget.ColumnsAt))
+	slices.Reverse(breakpoints)
+	columnsAt := make([]string, 0, len(breakpoints))
+
+	for _, breakpoint := range breakpoints {
+		columns := widget.ColumnsAt[breakpoint]
+
+		if breakpoint <= 0 {
+			return fmt.Errorf("columns-at: breakpoint must be a positive width, got %d", breakpoint)
+		}
+
+		if columns < 1 {
+			return fmt.Errorf("columns-at: number of columns at %d must be at least 1, got %d", breakpoint, columns)
+		}
+
+		columnsAt = append(columnsAt, strconv.Itoa(breakpoint)+" "+strconv.Itoa(columns))
+	}
+
+	if len(columnsAt) > 0 {
+		widget.ColumnsAtCSS = "--masonry-columns-at: " + strings.Join(columnsAt, ", ") + ";"
+	}
+
 	return nil
 }
 
@@ -0,0 +1,529 @@
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var sportsWidgetTemplate = common.MustParseTemplate("sports.html", "widget-base.html")
+
+const (
+	sportsProviderESPN        = "espn"
+	sportsProviderTheSportsDB = "thesportsdb"
+	// How often the widget updates while there's a match going on
+	sportsLiveCacheDuration = time.Minute
+)
+
+// Fetches the matches of a league that start between from and to, leagues
+// are in whatever format the provider uses to identify them
+type sportsProviderFunc func(ctx context.Context, client *http.Client, widget *sportsWidget, league string, from, to time.Time) ([]sportsMatch, error)
+
+type sportsWidget struct {
+	widgetBase    `yaml:",inline"`
+	Provider      string   `yaml:"provider"`
+	APIKey        string   `yaml:"api-key"`
+	Leagues       []string `yaml:"leagues"`
+	Teams         []string `yaml:"teams"`
+	Timezone      string   `yaml:"timezone"`
+	HourFormat    string   `yaml:"hour-format"`
+	Days          int      `yaml:"days"`
+	Limit         int      `yaml:"limit"`
+	CollapseAfter int      `yaml:"collapse-after"`
+
+	location *time.Location     `yaml:"-"`
+	provider sportsProviderFunc `yaml:"-"`
+	Matches  []sportsMatch      `yaml:"-"`
+}
+
+type sportsMatchState int
+
+const (
+	sportsMatchScheduled sportsMatchState = iota
+	sportsMatchLive
+	sportsMatchFinished
+)
+
+type sportsMatch struct {
+	League string
+	Start  time.Time
+	State  sportsMatchState
+	// What the provider says about the match, such as the minute it's in,
+	// only set for scheduled matches when they've been called off
+	Status string
+	Home   sportsTeam
+	Away   sportsTeam
+
+	// Set once the matches have been fetched, in the timezone of the widget
+	FormattedTime string
+	// 1 when a followed team won, -1 when it lost and 0 otherwise
+	FollowedResult int
+}
+
+type sportsTeam struct {
+	Name         string
+	Abbreviation string
+	Logo         string
+	Score        string
+	Winner       bool
+	Followed     bool
+	// Set for the losing team once the match is over
+	Dimmed bool
+}
+
+func (widget *sportsWidget) Initialize() error {
+	widget.withTitle("Sports").withCacheDuration(15 * time.Minute)
+
+	if widget.Provider == "" {
+		widget.Provider = sportsProviderESPN
+	}
+
+	provider, err := sportsProviders.get(widget.Provider)
+	if err != nil {
+		return err
+	}
+	widget.provider = provider
+
+	if len(widget.Leagues) == 0 {
+		return errors.New("at least one league is required")
+	}
+
+	for _, league := range widget.Leagues {
+		if widget.Provider == sportsProviderESPN && !espnLeaguePattern.MatchString(league) {
+			return fmt.Errorf("league %q must be a sport and a league separated by a slash, such as soccer/eng.1", league)
+		}
+
+		if widget.Provider == sportsProviderTheSportsDB && !theSportsDBLeaguePattern.MatchString(league) {
+			return fmt.Errorf("league %q must be the numeric ID of the league, such as 4328", league)
+		}
+	}
+
+	if widget.APIKey != "" && widget.Provider != sportsProviderTheSportsDB {
+		return errors.New("api-key can only be used with thesportsdb")
+	}
+
+	if widget.APIKey == "" {
+		// the free key, which is rate limited and only returns some of the matches
+		widget.APIKey = "123"
+	}
+
+	widget.location = time.Local
+	if widget.Timezone != "" {
+		location, err := time.LoadLocation(widget.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone '%s': %v", widget.Timezone, err)
+		}
+		widget.location = location
+	}
+
+	if widget.HourFormat == "" {
+		widget.HourFormat = "24h"
+	} else if widget.HourFormat != "12h" && widget.HourFormat != "24h" {
+		return errors.New("hour-format must be either 12h or 24h")
+	}
+
+	if widget.Days <= 0 {
+		widget.Days = 7
+	}
+
+	if widget.Limit <= 0 {
+		widget.Limit = 15
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	return nil
+}
+
+func (widget *sportsWidget) Update(ctx context.Context) {
+	matches, err := widget.fetchMatches(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Matches = matches
+
+	// scores of live matches would otherwise be out of date for most of
+	// the match
+	if slices.ContainsFunc(matches, func(match sportsMatch) bool { return match.State == sportsMatchLive }) {
+		if next := time.Now().Add(sportsLiveCacheDuration); next.Before(widget.nextUpdate) {
+			widget.nextUpdate = next
+		}
+	}
+}
+
+func (widget *sportsWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, sportsWidgetTemplate)
+}
+
+func (widget *sportsWidget) fetchMatches(ctx context.Context) ([]sportsMatch, error) {
+	client := widget.httpClient(false)
+	now := time.Now()
+	from, to := now.AddDate(0, 0, -widget.Days), now.AddDate(0, 0, widget.Days)
+
+	job := newJob(func(league string) ([]sportsMatch, error) {
+		return widget.provider(ctx, client, widget, league, from, to)
+	}, widget.Leagues)
+
+	results, errs, err := workerPoolDo(job)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	var matches []sportsMatch
+	var failed int
+
+	for i := range results {
+		if errs[i] != nil {
+			failed++
+			slog.Error("Failed to fetch matches", "provider", widget.Provider, "league", widget.Leagues[i], "error", errs[i])
+			continue
+		}
+
+		for _, match := range results[i] {
+			if match.Start.Before(from) || match.Start.After(to) {
+				continue
+			}
+
+			if len(widget.Teams) > 0 {
+				match.Home.Followed = widget.isFollowed(match.Home)
+				match.Away.Followed = widget.isFollowed(match.Away)
+
+				if !match.Home.Followed && !match.Away.Followed {
+					continue
+				}
+			}
+
+			matches = append(matches, match)
+		}
+	}
+
+	if failed == len(widget.Leagues) {
+		return nil, models.ErrNoContent
+	}
+
+	sortSportsMatches(matches)
+
+	if len(matches) > widget.Limit {
+		matches = matches[:widget.Limit]
+	}
+
+	for i := range matches {
+		matches[i].FormattedTime = widget.formatMatchTime(&matches[i], now)
+		matches[i].FollowedResult = matches[i].followedResult()
+
+		if matches[i].State == sportsMatchFinished {
+			matches[i].Home.Dimmed = matches[i].Away.Winner
+			matches[i].Away.Dimmed = matches[i].Home.Winner
+		}
+	}
+
+	if failed > 0 {
+		return matches, fmt.Errorf("%w: could not fetch matches of %d leagues", models.ErrPartialContent, failed)
+	}
+
+	return matches, nil
+}
+
+func (widget *sportsWidget) isFollowed(team sportsTeam) bool {
+	for _, followed := range widget.Teams {
+		if strings.EqualFold(followed, team.Name) || (team.Abbreviation != "" && strings.EqualFold(followed, team.Abbreviation)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Live matches come first, followed by the upcoming ones starting with the
+// soonest and then the results starting with the most recent
+func sortSportsMatches(matches []sportsMatch) {
+	order := func(state sportsMatchState) int {
+		switch state {
+		case sportsMatchLive:
+			return 0
+		case sportsMatchScheduled:
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b sportsMatch) int {
+		if order(a.State) != order(b.State) {
+			return order(a.State) - order(b.State)
+		}
+
+		if a.State == sportsMatchFinished {
+			return b.Start.Compare(a.Start)
+		}
+
+		return a.Start.Compare(b.Start)
+	})
+}
+
+func (widget *sportsWidget) formatMatchTime(match *sportsMatch, now time.Time) string {
+	start := match.Start.In(widget.location)
+	today := now.In(widget.location)
+
+	var day string
+	switch {
+	case sameDay(start, today):
+		day = "Today"
+	case sameDay(start, today.AddDate(0, 0, 1)):
+		day = "Tomorrow"
+	case sameDay(start, today.AddDate(0, 0, -1)):
+		day = "Yesterday"
+	default:
+		day = start.Format("Mon, Jan 2")
+	}
+
+	if match.State == sportsMatchFinished {
+		return day
+	}
+
+	if widget.HourFormat == "12h" {
+		return day + ", " + start.Format("3:04 PM")
+	}
+
+	return day + ", " + start.Format("15:04")
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+func (match *sportsMatch) followedResult() int {
+	if match.State != sportsMatchFinished {
+		return 0
+	}
+
+	switch {
+	case match.Home.Followed && match.Home.Winner, match.Away.Followed && match.Away.Winner:
+		return 1
+	case match.Home.Followed && match.Away.Winner, match.Away.Followed && match.Home.Winner:
+		return -1
+	}
+
+	return 0
+}
+
+func (match *sportsMatch) Teams() []sportsTeam {
+	return []sportsTeam{match.Home, match.Away}
+}
+
+func (match *sportsMatch) IsLive() bool {
+	return match.State == sportsMatchLive
+}
+
+func (match *sportsMatch) HasScore() bool {
+	return match.State != sportsMatchScheduled && match.Home.Score != "" && match.Away.Score != ""
+}
+
+var espnLeaguePattern = regexp.MustCompile(`^[a-z-]+/[a-z0-9.-]+$`)
+
+type espnScoreboardResponseJson struct {
+	Leagues []struct {
+		Abbreviation string `json:"abbreviation"`
+		Name         string `json:"name"`
+	} `json:"leagues"`
+	Events []struct {
+		Date         string `json:"date"`
+		Competitions []struct {
+			Competitors []struct {
+				HomeAway string `json:"homeAway"`
+				Score    string `json:"score"`
+				Winner   bool   `json:"winner"`
+				Team     struct {
+					DisplayName  string `json:"displayName"`
+					Abbreviation string `json:"abbreviation"`
+					Logo         string `json:"logo"`
+				} `json:"team"`
+			} `json:"competitors"`
+		} `json:"competitions"`
+		Status struct {
+			Type struct {
+				Name string `json:"name"`
+				// pre, in or post
+				State       string `json:"state"`
+				ShortDetail string `json:"shortDetail"`
+			} `json:"type"`
+		} `json:"status"`
+	} `json:"events"`
+}
+
+const espnAPIURL = "https://site.api.espn.com/apis/site/v2/sports"
+
+func fetchESPNMatches(ctx context.Context, client *http.Client, _ *sportsWidget, league string, from, to time.Time) ([]sportsMatch, error) {
+	query := url.Values{"dates": {from.UTC().Format("20060102") + "-" + to.UTC().Format("20060102")}}
+	request, _ := http.NewRequestWithContext(ctx, "GET", espnAPIURL+"/"+league+"/scoreboard?"+query.Encode(), nil)
+
+	response, err := fetch.DecodeJSON[espnScoreboardResponseJson](client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	leagueName := league
+	if len(response.Leagues) > 0 {
+		leagueName = common.Ternary(response.Leagues[0].Abbreviation != "", response.Leagues[0].Abbreviation, response.Leagues[0].Name)
+	}
+
+	matches := make([]sportsMatch, 0, len(response.Events))
+	for _, event := range response.Events {
+		if len(event.Competitions) == 0 || len(event.Competitions[0].Competitors) != 2 {
+			continue
+		}
+
+		// dates usually leave out the seconds
+		start, err := time.Parse("2006-01-02T15:04Z07:00", event.Date)
+		if err != nil {
+			if start, err = time.Parse(time.RFC3339, event.Date); err != nil {
+				continue
+			}
+		}
+
+		match := sportsMatch{
+			League: leagueName,
+			Start:  start,
+			Status: event.Status.Type.ShortDetail,
+		}
+
+		switch event.Status.Type.State {
+		case "in":
+			match.State = sportsMatchLive
+		case "post":
+			match.State = sportsMatchFinished
+		default:
+			match.State = sportsMatchScheduled
+
+			switch event.Status.Type.Name {
+			case "STATUS_POSTPONED", "STATUS_CANCELED", "STATUS_SUSPENDED":
+			default:
+				// the details of scheduled matches are their start time
+				match.Status = ""
+			}
+		}
+
+		for _, competitor := range event.Competitions[0].Competitors {
+			team := sportsTeam{
+				Name:         competitor.Team.DisplayName,
+				Abbreviation: competitor.Team.Abbreviation,
+				Logo:         competitor.Team.Logo,
+				Score:        competitor.Score,
+				Winner:       competitor.Winner,
+			}
+
+			if competitor.HomeAway == "home" {
+				match.Home = team
+			} else {
+				match.Away = team
+			}
+		}
+
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+var theSportsDBLeaguePattern = regexp.MustCompile(`^[0-9]+$`)
+
+type theSportsDBEventsResponseJson struct {
+	// null when the league has no events
+	Events []theSportsDBEventJson `json:"events"`
+}
+
+type theSportsDBEventJson struct {
+	League    string `json:"strLeague"`
+	Timestamp string `json:"strTimestamp"`
+	Status    string `json:"strStatus"`
+	HomeTeam  string `json:"strHomeTeam"`
+	AwayTeam  string `json:"strAwayTeam"`
+	HomeScore string `json:"intHomeScore"`
+	AwayScore string `json:"intAwayScore"`
+	HomeBadge string `json:"strHomeTeamBadge"`
+	AwayBadge string `json:"strAwayTeamBadge"`
+}
+
+const theSportsDBAPIURL = "https://www.thesportsdb.com/api/v1/json"
+
+// The past and next events of the league are fetched separately, neither of
+// them can be limited to a range of dates
+func fetchTheSportsDBMatches(ctx context.Context, client *http.Client, widget *sportsWidget, league string, _, _ time.Time) ([]sportsMatch, error) {
+	var events []theSportsDBEventJson
+
+	for _, endpoint := range []string{"eventspastleague.php", "eventsnextleague.php"} {
+		request, _ := http.NewRequestWithContext(ctx, "GET", theSportsDBAPIURL+"/"+url.PathEscape(widget.APIKey)+"/"+endpoint+"?id="+league, nil)
+
+		response, err := fetch.DecodeJSON[theSportsDBEventsResponseJson](client, request)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, response.Events...)
+	}
+
+	matches := make([]sportsMatch, 0, len(events))
+	for _, event := range events {
+		// timestamps are in UTC but don't say so
+		start, err := time.Parse("2006-01-02T15:04:05", event.Timestamp)
+		if err != nil {
+			continue
+		}
+
+		match := sportsMatch{
+			League: event.League,
+			Start:  start,
+			Status: event.Status,
+			Home:   sportsTeam{Name: event.HomeTeam, Logo: event.HomeBadge, Score: event.HomeScore},
+			Away:   sportsTeam{Name: event.AwayTeam, Logo: event.AwayBadge, Score: event.AwayScore},
+		}
+
+		switch event.Status {
+		case "FT", "AET", "PEN", "AOT", "Match Finished":
+			match.State = sportsMatchFinished
+		case "PST", "CANC", "ABD", "Postponed", "Cancelled", "Abandoned":
+			match.State = sportsMatchScheduled
+		case "", "NS", "Not Started", "TBD":
+			match.State = sportsMatchScheduled
+			match.Status = ""
+		default:
+			// events that haven't started yet are sometimes missing their
+			// status, in which case they don't have scores either
+			if event.HomeScore == "" || event.AwayScore == "" {
+				match.State = sportsMatchScheduled
+				match.Status = ""
+			} else {
+				match.State = sportsMatchLive
+			}
+		}
+
+		if match.State == sportsMatchFinished {
+			var home, away int
+			_, errHome := fmt.Sscan(event.HomeScore, &home)
+			_, errAway := fmt.Sscan(event.AwayScore, &away)
+			if errHome == nil && errAway == nil {
+				match.Home.Winner = home > away
+				match.Away.Winner = away > home
+			}
+		}
+
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
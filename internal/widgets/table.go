@@ -0,0 +1,455 @@
+package widgets
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/tidwall/gjson"
+)
+
+var tableWidgetTemplate = common.MustParseTemplate("table.html", "widget-base.html")
+
+const tableMaxSourceSize = 4 << 20
+
+const (
+	tableFormatText   = "text"
+	tableFormatNumber = "number"
+	tableFormatDate   = "date"
+	tableFormatLink   = "link"
+)
+
+// Tried in order when a date column doesn't have an input format
+var tableDateLayouts = []string{time.RFC3339, time.DateTime, time.DateOnly}
+
+type tableWidget struct {
+	widgetBase    `yaml:",inline"`
+	URL           string                      `yaml:"url"`
+	File          string                      `yaml:"file"`
+	AllowInsecure bool                        `yaml:"allow-insecure"`
+	Parameters    models.QueryParametersField `yaml:"parameters"`
+	Format        string                      `yaml:"format"`
+	Rows          string                      `yaml:"rows"`
+	Columns       []tableColumn               `yaml:"columns"`
+	SortBy        string                      `yaml:"sort-by"`
+	SortOrder     string                      `yaml:"sort-order"`
+	Limit         int                         `yaml:"limit"`
+
+	sortColumn int          `yaml:"-"`
+	Table      *tableResult `yaml:"-"`
+}
+
+type tableColumn struct {
+	Field        string `yaml:"field"`
+	Title        string `yaml:"title"`
+	Format       string `yaml:"format"`
+	Precision    int    `yaml:"precision"`
+	InputFormat  string `yaml:"input-format"`
+	OutputFormat string `yaml:"output-format"`
+	// The field with the text of links, which otherwise show the URL
+	Text string `yaml:"text"`
+}
+
+type tableResult struct {
+	Columns []tableColumn
+	Rows    [][]tableCell
+	// How many rows there were before the limit was applied
+	TotalRows int
+	// -1 when the rows are in the order of the source
+	SortColumn int
+	SortOrder  string
+}
+
+type tableCell struct {
+	Text      string
+	URL       string
+	Number    float64
+	IsNumber  bool
+	Time      time.Time
+	IsTime    bool
+	Relative  bool
+	Precision int
+	// What the browser sorts by, numbers and dates are compared numerically
+	SortValue string
+}
+
+func (widget *tableWidget) Initialize() error {
+	widget.withTitle("Table").withCacheDuration(time.Hour)
+
+	if (widget.URL == "") == (widget.File == "") {
+		return errors.New("exactly one of url or file is required")
+	}
+
+	if widget.Format == "" {
+		source := common.Ternary(widget.URL != "", widget.URL, widget.File)
+		path, _, _ := strings.Cut(source, "?")
+		widget.Format = common.Ternary(strings.HasSuffix(strings.ToLower(path), ".csv"), "csv", "json")
+	} else if widget.Format != "csv" && widget.Format != "json" {
+		return errors.New("format must be either csv or json")
+	}
+
+	if widget.Rows != "" && widget.Format != "json" {
+		return errors.New("rows can only be used when format is json")
+	}
+
+	for i := range widget.Columns {
+		column := &widget.Columns[i]
+
+		if column.Field == "" {
+			return fmt.Errorf("column %d has no field", i+1)
+		}
+
+		if column.Title == "" {
+			column.Title = column.Field
+		}
+
+		switch column.Format {
+		case "":
+			column.Format = tableFormatText
+		case tableFormatText, tableFormatNumber, tableFormatLink:
+		case tableFormatDate:
+			if column.OutputFormat == "" {
+				column.OutputFormat = "Jan 2, 2006"
+			}
+		default:
+			return fmt.Errorf("format of column %s must be one of text, number, date or link", column.Field)
+		}
+
+		if column.Text != "" && column.Format != tableFormatLink {
+			return fmt.Errorf("text of column %s can only be used when its format is link", column.Field)
+		}
+	}
+
+	widget.sortColumn = -1
+	if widget.SortBy != "" {
+		widget.sortColumn = slices.IndexFunc(widget.Columns, func(column tableColumn) bool {
+			return column.Field == widget.SortBy
+		})
+
+		if widget.sortColumn == -1 {
+			return fmt.Errorf("sort-by must be the field of one of the columns, got %q", widget.SortBy)
+		}
+	}
+
+	if widget.SortOrder == "" {
+		widget.SortOrder = "asc"
+	} else if widget.SortOrder != "asc" && widget.SortOrder != "desc" {
+		return errors.New("sort-order must be either asc or desc")
+	}
+
+	if widget.Limit <= 0 {
+		widget.Limit = 25
+	}
+
+	return nil
+}
+
+func (widget *tableWidget) Update(ctx context.Context) {
+	table, err := widget.fetchTable(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Table = table
+}
+
+func (widget *tableWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, tableWidgetTemplate)
+}
+
+func (widget *tableWidget) fetchTable(ctx context.Context) (*tableResult, error) {
+	source, err := widget.readSource(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	// the configured columns are looked up along with the fields of the text
+	// of links, the rest of the fields are left out
+	var fields []string
+	for _, column := range widget.Columns {
+		fields = append(fields, column.Field)
+		if column.Text != "" {
+			fields = append(fields, column.Text)
+		}
+	}
+
+	var rows [][]string
+	if widget.Format == "csv" {
+		fields, rows, err = parseTableCSV(source, fields)
+	} else {
+		fields, rows, err = parseTableJSON(source, widget.Rows, fields)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	return widget.newTable(fields, rows), nil
+}
+
+func (widget *tableWidget) readSource(ctx context.Context) ([]byte, error) {
+	if widget.File != "" {
+		file, err := os.Open(filepath.Clean(widget.File))
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		return io.ReadAll(io.LimitReader(file, tableMaxSourceSize))
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", widget.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(widget.Parameters) > 0 {
+		request.URL.RawQuery = widget.Parameters.ToQueryString()
+	}
+
+	response, err := widget.httpClient(widget.AllowInsecure).Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, tableMaxSourceSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		truncatedBody, _ := common.LimitStringLength(string(body), 256)
+		return nil, fmt.Errorf("unexpected status code %d from %s, response: %s", response.StatusCode, request.URL, truncatedBody)
+	}
+
+	return body, nil
+}
+
+// Returns the values of the rows in the order of the fields, which are those
+// of the columns or all of them when no columns are configured
+func parseTableCSV(source []byte, fields []string) ([]string, [][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(source))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing CSV: %v", err)
+	}
+
+	if len(records) == 0 {
+		return nil, nil, errors.New("CSV is empty")
+	}
+
+	header := records[0]
+	if len(fields) == 0 {
+		fields = header
+	}
+
+	indexes := make([]int, len(fields))
+	for i, field := range fields {
+		if indexes[i] = slices.Index(header, field); indexes[i] == -1 {
+			return nil, nil, fmt.Errorf("CSV has no column named %q", field)
+		}
+	}
+
+	rows := make([][]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make([]string, len(fields))
+		for i, index := range indexes {
+			row[i] = common.ItemAtIndexOrDefault(record, index, "")
+		}
+		rows = append(rows, row)
+	}
+
+	return fields, rows, nil
+}
+
+// Fields are gjson paths within each row, so nested values can be used as
+// columns too
+func parseTableJSON(source []byte, rowsPath string, fields []string) ([]string, [][]string, error) {
+	if !gjson.ValidBytes(source) {
+		return nil, nil, errors.New("response is not valid JSON")
+	}
+
+	result := gjson.ParseBytes(source)
+	if rowsPath != "" {
+		result = result.Get(rowsPath)
+		if !result.IsArray() {
+			return nil, nil, fmt.Errorf("rows path %q doesn't point to an array", rowsPath)
+		}
+	} else if !result.IsArray() {
+		return nil, nil, errors.New("JSON is not an array, set rows to the path of one")
+	}
+
+	items := result.Array()
+
+	// without columns, the keys of the first row are used in the order that
+	// they appear in
+	if len(fields) == 0 && len(items) > 0 {
+		items[0].ForEach(func(key, _ gjson.Result) bool {
+			fields = append(fields, key.String())
+			return true
+		})
+	}
+
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		row := make([]string, len(fields))
+		for i, field := range fields {
+			row[i] = item.Get(field).String()
+		}
+		rows = append(rows, row)
+	}
+
+	return fields, rows, nil
+}
+
+func (widget *tableWidget) newTable(fields []string, rows [][]string) *tableResult {
+	columns := widget.Columns
+	if len(columns) == 0 {
+		columns = make([]tableColumn, len(fields))
+		for i, field := range fields {
+			columns[i] = tableColumn{Field: field, Title: field, Format: tableFormatText}
+		}
+	}
+
+	table := &tableResult{
+		Columns:    columns,
+		TotalRows:  len(rows),
+		SortColumn: widget.sortColumn,
+		SortOrder:  widget.SortOrder,
+	}
+	table.Rows = make([][]tableCell, len(rows))
+
+	for i, row := range rows {
+		table.Rows[i] = make([]tableCell, len(columns))
+		for j := range columns {
+			value := row[slices.Index(fields, columns[j].Field)]
+			text := ""
+			if columns[j].Text != "" {
+				text = row[slices.Index(fields, columns[j].Text)]
+			}
+
+			table.Rows[i][j] = columns[j].newCell(value, text)
+		}
+	}
+
+	if widget.sortColumn != -1 {
+		slices.SortStableFunc(table.Rows, func(a, b []tableCell) int {
+			first, second := a[widget.sortColumn], b[widget.sortColumn]
+
+			// values that couldn't be parsed go last in either order
+			if first.isParsed() != second.isParsed() {
+				return common.Ternary(first.isParsed(), -1, 1)
+			}
+
+			order := compareTableCells(first, second)
+			return common.Ternary(widget.SortOrder == "desc", -order, order)
+		})
+	}
+
+	if len(table.Rows) > widget.Limit {
+		table.Rows = table.Rows[:widget.Limit]
+	}
+
+	return table
+}
+
+// Values that can't be read in the format of the column are shown as they
+// are rather than failing the whole table
+func (column *tableColumn) newCell(value, text string) tableCell {
+	cell := tableCell{Text: value, SortValue: value}
+
+	switch column.Format {
+	case tableFormatNumber:
+		number, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(value), ",", ""), 64)
+		if err != nil {
+			break
+		}
+
+		cell.Number = number
+		cell.IsNumber = true
+		cell.Precision = column.Precision
+		cell.SortValue = strconv.FormatFloat(number, 'f', -1, 64)
+	case tableFormatDate:
+		parsed, ok := parseTableDate(strings.TrimSpace(value), column.InputFormat)
+		if !ok {
+			break
+		}
+
+		cell.Time = parsed
+		cell.IsTime = true
+		cell.Relative = column.OutputFormat == "relative"
+		cell.Text = common.Ternary(cell.Relative, "", parsed.Format(column.OutputFormat))
+		cell.SortValue = strconv.FormatInt(parsed.Unix(), 10)
+	case tableFormatLink:
+		cell.URL = value
+		if text != "" {
+			cell.Text = text
+			cell.SortValue = text
+		}
+	}
+
+	return cell
+}
+
+func (column tableColumn) IsNumeric() bool {
+	return column.Format == tableFormatNumber || column.Format == tableFormatDate
+}
+
+// Without a layout, common layouts are tried along with unix timestamps in
+// seconds or milliseconds
+func parseTableDate(value, layout string) (time.Time, bool) {
+	if layout != "" {
+		parsed, err := time.Parse(layout, value)
+		return parsed, err == nil
+	}
+
+	for _, layout := range tableDateLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if timestamp > 1e11 {
+		return time.UnixMilli(timestamp), true
+	}
+
+	return time.Unix(timestamp, 0), true
+}
+
+func (cell tableCell) isParsed() bool {
+	return cell.IsNumber || cell.IsTime
+}
+
+func compareTableCells(a, b tableCell) int {
+	switch {
+	case a.IsNumber && b.IsNumber:
+		return cmp.Compare(a.Number, b.Number)
+	case a.IsTime && b.IsTime:
+		return a.Time.Compare(b.Time)
+	default:
+		return cmp.Compare(strings.ToLower(a.SortValue), strings.ToLower(b.SortValue))
+	}
+}
@@ -1,26 +1,590 @@
 package widgets
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/limpdev/gander/internal/common"
 )
 
 var todoWidgetTemplate = common.MustParseTemplate("todo.html", "widget-base.html")
 
+const (
+	todoStorageLocal  = "local"
+	todoStorageServer = "server"
+	todoStorageCalDAV = "caldav"
+)
+
+const todoMaxRequestBodySize = 1 << 20
+
+// New tasks get their ID from the browser, which also ends up in the URL of
+// the task when it's stored through CalDAV
+var todoNewItemIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// Lists with the same ID can be on multiple pages, so changes to them are
+// made one at a time rather than one at a time per page
+var todoStorageLock sync.Mutex
+
 type todoWidget struct {
 	widgetBase `yaml:",inline"`
-	cachedHTML template.HTML `yaml:"-"`
-	TodoID     string        `yaml:"id"`
+	cachedHTML template.HTML     `yaml:"-"`
+	renderOnce sync.Once         `yaml:"-"`
+	TodoID     string            `yaml:"id"`
+	Storage    string            `yaml:"storage"`
+	CalDAV     *todoCalDAVConfig `yaml:"caldav"`
+
+	stateKey string `yaml:"-"`
+}
+
+type todoCalDAVConfig struct {
+	URL           string `yaml:"url"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+	AllowInsecure bool   `yaml:"allow-insecure"`
+}
+
+type todoItem struct {
+	ID      string `json:"id"`
+	Text    string `json:"text"`
+	Checked bool   `json:"checked"`
 }
 
 func (widget *todoWidget) Initialize() error {
 	widget.withTitle("To-do").withError(nil)
 
-	widget.cachedHTML = widget.renderTemplate(widget, todoWidgetTemplate)
+	switch widget.Storage {
+	case "", todoStorageLocal:
+		widget.Storage = todoStorageLocal
+	case todoStorageServer:
+		id := sha256.Sum256([]byte(widget.TodoID))
+		widget.stateKey = "todo-" + hex.EncodeToString(id[:8])
+	case todoStorageCalDAV:
+		if widget.CalDAV == nil || widget.CalDAV.URL == "" {
+			return errors.New("caldav.url is required when storage is caldav")
+		}
+
+		// hrefs of new tasks are resolved against it
+		if !strings.HasSuffix(widget.CalDAV.URL, "/") {
+			widget.CalDAV.URL += "/"
+		}
+	default:
+		return fmt.Errorf("storage must be one of local, server or caldav, got %q", widget.Storage)
+	}
+
+	if widget.CalDAV != nil && widget.Storage != todoStorageCalDAV {
+		return errors.New("caldav can only be used when storage is caldav")
+	}
+
 	return nil
 }
 
+// Rendered on first use rather than when initializing since whether the
+// tasks can be synced depends on the providers
 func (widget *todoWidget) Render() template.HTML {
+	widget.renderOnce.Do(func() {
+		if widget.IsSynced() && !widget.CanSync() {
+			widget.withError(errors.New("storing tasks outside of the browser requires authentication to be enabled"))
+			widget.ContentAvailable = false
+		}
+
+		widget.cachedHTML = widget.renderTemplate(widget, todoWidgetTemplate)
+	})
+
 	return widget.cachedHTML
 }
+
+func (widget *todoWidget) IsSynced() bool {
+	return widget.Storage != todoStorageLocal
+}
+
+// Anyone who could see the list would otherwise be able to change it, and
+// in the case of CalDAV change the calendar behind it
+func (widget *todoWidget) CanSync() bool {
+	return widget.Providers != nil && widget.Providers.RequiresAuth
+}
+
+// Handles GET items, which returns the tasks of the list as JSON, and PUT
+// items, which replaces them with the ones in the body and returns them
+func (widget *todoWidget) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("path") != "items" || !widget.IsSynced() {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !widget.CanSync() {
+		http.Error(w, "syncing tasks requires authentication to be enabled", http.StatusForbidden)
+		return
+	}
+
+	var items []todoItem
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, todoMaxRequestBodySize)).Decode(&items); err != nil {
+			http.Error(w, "invalid list of tasks", http.StatusBadRequest)
+			return
+		}
+	}
+
+	todoStorageLock.Lock()
+	var err error
+	if r.Method == http.MethodGet {
+		items, err = widget.loadItems(r.Context())
+	} else {
+		items, err = widget.saveItems(r.Context(), items)
+	}
+	todoStorageLock.Unlock()
+
+	if err != nil {
+		slog.Error("Failed to sync tasks", "storage", widget.Storage, "id", widget.TodoID, "error", err)
+		http.Error(w, "could not sync tasks", http.StatusBadGateway)
+		return
+	}
+
+	if items == nil {
+		items = []todoItem{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func (widget *todoWidget) loadItems(ctx context.Context) ([]todoItem, error) {
+	if widget.Storage == todoStorageCalDAV {
+		tasks, err := widget.fetchCalDAVTasks(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		items := make([]todoItem, len(tasks))
+		for i := range tasks {
+			items[i] = tasks[i].item
+		}
+
+		return items, nil
+	}
+
+	var items []todoItem
+	if err := widget.Providers.State.LoadWidgetState(widget.stateKey, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (widget *todoWidget) saveItems(ctx context.Context, items []todoItem) ([]todoItem, error) {
+	seen := make(map[string]bool, len(items))
+	items = slices.DeleteFunc(items, func(item todoItem) bool {
+		duplicate := seen[item.ID]
+		seen[item.ID] = true
+		return item.ID != "" && duplicate
+	})
+
+	if widget.Storage == todoStorageCalDAV {
+		return widget.saveCalDAVTasks(ctx, items)
+	}
+
+	current, err := widget.loadItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		if !slices.ContainsFunc(current, func(item todoItem) bool { return item.ID == items[i].ID }) {
+			items[i].ID = newTodoItemID(items[i].ID)
+		}
+	}
+
+	if err := widget.Providers.State.SaveWidgetState(widget.stateKey, items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Keeps the ID that the browser picked for a new task as long as it's safe
+// to use
+func newTodoItemID(requested string) string {
+	if todoNewItemIDPattern.MatchString(requested) {
+		return requested
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+type todoCalDAVTask struct {
+	href  string
+	etag  string
+	order int
+	// The unfolded lines of the calendar object, kept so that properties
+	// which the widget doesn't know about survive changes to the task
+	lines []string
+	item  todoItem
+}
+
+type todoCalDAVMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ETag         string `xml:"getetag"`
+				CalendarData string `xml:"calendar-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+const todoCalDAVQuery = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop>
+    <d:getetag/>
+    <c:calendar-data/>
+  </d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VTODO"/>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`
+
+func (widget *todoWidget) calDAVRequest(ctx context.Context, method, href string, body []byte, headers map[string]string) (*http.Response, error) {
+	base, _ := url.Parse(widget.CalDAV.URL)
+	target, err := base.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	if widget.CalDAV.Username != "" || widget.CalDAV.Password != "" {
+		request.SetBasicAuth(widget.CalDAV.Username, widget.CalDAV.Password)
+	}
+
+	return widget.httpClient(widget.CalDAV.AllowInsecure).Do(request)
+}
+
+// Tasks come sorted the same way as in Apple's Reminders, which is also what
+// most other clients use to keep track of the order of tasks
+func (widget *todoWidget) fetchCalDAVTasks(ctx context.Context) ([]todoCalDAVTask, error) {
+	response, err := widget.calDAVRequest(ctx, "REPORT", "", []byte(todoCalDAVQuery), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusMultiStatus {
+		truncatedBody, _ := common.LimitStringLength(string(body), 256)
+		return nil, fmt.Errorf("unexpected status code %d from %s, response: %s", response.StatusCode, response.Request.URL.Host, truncatedBody)
+	}
+
+	var multistatus todoCalDAVMultistatus
+	if err := xml.Unmarshal(body, &multistatus); err != nil {
+		return nil, fmt.Errorf("parsing response: %v", err)
+	}
+
+	tasks := make([]todoCalDAVTask, 0, len(multistatus.Responses))
+	for _, response := range multistatus.Responses {
+		for _, propstat := range response.Propstat {
+			if !strings.Contains(propstat.Status, " 200 ") || propstat.Prop.CalendarData == "" {
+				continue
+			}
+
+			task, ok := parseCalDAVTask(propstat.Prop.CalendarData)
+			if !ok {
+				continue
+			}
+
+			task.href = response.Href
+			task.etag = propstat.Prop.ETag
+			tasks = append(tasks, task)
+		}
+	}
+
+	slices.SortStableFunc(tasks, func(a, b todoCalDAVTask) int {
+		return a.order - b.order
+	})
+
+	return tasks, nil
+}
+
+// Creates the tasks that are new, updates the ones that changed and deletes
+// the ones that are no longer in the list
+func (widget *todoWidget) saveCalDAVTasks(ctx context.Context, items []todoItem) ([]todoItem, error) {
+	tasks, err := widget.fetchCalDAVTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]*todoCalDAVTask, len(tasks))
+	for i := range tasks {
+		existing[tasks[i].item.ID] = &tasks[i]
+	}
+
+	now := time.Now().UTC().Format(icalDateTimeFormat)
+
+	for i := range items {
+		item := &items[i]
+		task, exists := existing[item.ID]
+
+		if exists {
+			delete(existing, item.ID)
+
+			if task.item.Text == item.Text && task.item.Checked == item.Checked && task.order == i {
+				continue
+			}
+		} else {
+			item.ID = newTodoItemID(item.ID)
+			task = &todoCalDAVTask{
+				href: url.PathEscape(item.ID) + ".ics",
+				lines: []string{
+					"BEGIN:VCALENDAR",
+					"VERSION:2.0",
+					"PRODID:-//Gander//To-do//EN",
+					"BEGIN:VTODO",
+					"UID:" + item.ID,
+					"CREATED:" + now,
+					"END:VTODO",
+					"END:VCALENDAR",
+				},
+			}
+		}
+
+		lines := task.lines
+		lines = setICalProperty(lines, "SUMMARY", escapeICalText(item.Text))
+		lines = setICalProperty(lines, "STATUS", common.Ternary(item.Checked, "COMPLETED", "NEEDS-ACTION"))
+		if item.Checked != task.item.Checked || !exists {
+			lines = setICalProperty(lines, "COMPLETED", common.Ternary(item.Checked, now, ""))
+			lines = setICalProperty(lines, "PERCENT-COMPLETE", common.Ternary(item.Checked, "100", ""))
+		}
+		lines = setICalProperty(lines, "X-APPLE-SORT-ORDER", strconv.Itoa(i))
+		lines = setICalProperty(lines, "DTSTAMP", now)
+		lines = setICalProperty(lines, "LAST-MODIFIED", now)
+
+		body := []byte(foldICalLines(lines))
+		if err := widget.calDAVWrite(ctx, "PUT", task.href, task.etag, body); err != nil {
+			return nil, fmt.Errorf("saving task: %v", err)
+		}
+	}
+
+	for _, task := range existing {
+		if err := widget.calDAVWrite(ctx, "DELETE", task.href, task.etag, nil); err != nil {
+			return nil, fmt.Errorf("deleting task: %v", err)
+		}
+	}
+
+	return items, nil
+}
+
+// An empty etag means that the task is new, in which case it must not
+// overwrite one that already exists
+func (widget *todoWidget) calDAVWrite(ctx context.Context, method, href, etag string, body []byte) error {
+	headers := map[string]string{"If-Match": etag}
+	if etag == "" {
+		headers = map[string]string{"If-None-Match": "*"}
+	}
+
+	if body != nil {
+		headers["Content-Type"] = "text/calendar; charset=utf-8"
+	}
+
+	response, err := widget.calDAVRequest(ctx, method, href, body, headers)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	// a task that's already gone doesn't need deleting
+	if method == "DELETE" && response.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d from %s", response.StatusCode, response.Request.URL.Host)
+	}
+
+	return nil
+}
+
+const icalDateTimeFormat = "20060102T150405Z"
+
+// Only the first task of a calendar object is used, the rest of them would
+// be instances of a recurring task
+func parseCalDAVTask(data string) (todoCalDAVTask, bool) {
+	// long lines are folded by breaking them up and starting the rest of
+	// them with a space or a tab
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	task := todoCalDAVTask{order: -1}
+	inTask, foundTask := false, false
+
+	for line := range strings.SplitSeq(data, "\n") {
+		if line == "" {
+			continue
+		}
+		task.lines = append(task.lines, line)
+
+		switch {
+		case line == "BEGIN:VTODO":
+			inTask = !foundTask
+			foundTask = true
+			continue
+		case line == "END:VTODO":
+			inTask = false
+			continue
+		case !inTask:
+			continue
+		}
+
+		name, value := icalProperty(line)
+		switch name {
+		case "UID":
+			task.item.ID = value
+		case "SUMMARY":
+			task.item.Text = unescapeICalText(value)
+		case "STATUS":
+			task.item.Checked = value == "COMPLETED"
+		case "X-APPLE-SORT-ORDER":
+			if order, err := strconv.Atoi(value); err == nil {
+				task.order = order
+			}
+		}
+	}
+
+	return task, foundTask && task.item.ID != ""
+}
+
+// Splits a content line such as "SUMMARY;LANGUAGE=en:Buy milk" into its name
+// and value, parameters are dropped
+func icalProperty(line string) (string, string) {
+	quoted := false
+
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ':' && !quoted:
+			name, _, _ := strings.Cut(line[:i], ";")
+			return strings.ToUpper(name), line[i+1:]
+		}
+	}
+
+	return "", ""
+}
+
+// Replaces the property within the first task of the calendar object or adds
+// it when it's not there, an empty value removes it
+func setICalProperty(lines []string, name, value string) []string {
+	inTask, replaced := false, false
+
+	for i := 0; i < len(lines); i++ {
+		switch {
+		case lines[i] == "BEGIN:VTODO":
+			inTask = true
+			continue
+		case lines[i] == "END:VTODO":
+			if inTask && !replaced && value != "" {
+				lines = slices.Insert(lines, i, name+":"+value)
+			}
+			return lines
+		case !inTask:
+			continue
+		}
+
+		if property, _ := icalProperty(lines[i]); property != name {
+			continue
+		}
+
+		if value == "" || replaced {
+			lines = slices.Delete(lines, i, i+1)
+			i--
+			continue
+		}
+
+		lines[i] = name + ":" + value
+		replaced = true
+	}
+
+	return lines
+}
+
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escapeICalText(text string) string {
+	return icalTextEscaper.Replace(text)
+}
+
+var icalTextUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func unescapeICalText(text string) string {
+	return icalTextUnescaper.Replace(text)
+}
+
+// Lines can be at most 75 bytes long, the rest of them continue on the next
+// line after a space
+func foldICalLines(lines []string) string {
+	var folded strings.Builder
+
+	for _, line := range lines {
+		limit := 75
+		for len(line) > limit {
+			cut := limit
+			// multi-byte characters can't be split up
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+
+			folded.WriteString(line[:cut])
+			folded.WriteString("\r\n ")
+			line = line[cut:]
+			limit = 74
+		}
+
+		folded.WriteString(line)
+		folded.WriteString("\r\n")
+	}
+
+	return folded.String()
+}
@@ -0,0 +1,214 @@
+package widgets
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Filters, rewrites and sorts the items fetched by a widget using expressions
+// that have the fields of the item in scope, see https://expr-lang.org
+type itemTransform struct {
+	Filter    string            `yaml:"filter"`
+	Set       map[string]string `yaml:"set"`
+	SortBy    string            `yaml:"sort-by"`
+	SortOrder string            `yaml:"sort-order"`
+
+	filter *vm.Program
+	set    map[string]*vm.Program
+	sortBy *vm.Program
+}
+
+// Compiles the expressions against the type of item, which must be a struct,
+// so that references to fields that don't exist fail when the config loads
+func (t *itemTransform) initialize(item any) error {
+	if t == nil {
+		return nil
+	}
+
+	var err error
+
+	if t.Filter != "" {
+		if t.filter, err = expr.Compile(t.Filter, expr.Env(item), expr.AsBool()); err != nil {
+			return fmt.Errorf("transform filter: %v", err)
+		}
+	}
+
+	itemType := reflect.TypeOf(item)
+	t.set = make(map[string]*vm.Program, len(t.Set))
+	for name, source := range t.Set {
+		field, ok := itemType.FieldByName(name)
+		if !ok || !field.IsExported() {
+			return fmt.Errorf("transform set: items have no %s field", name)
+		}
+
+		options := []expr.Option{expr.Env(item)}
+		switch field.Type.Kind() {
+		case reflect.String:
+			options = append(options, expr.AsKind(reflect.String))
+		case reflect.Bool:
+			options = append(options, expr.AsBool())
+		case reflect.Int:
+			options = append(options, expr.AsInt())
+		case reflect.Float64:
+			options = append(options, expr.AsFloat64())
+		}
+
+		if t.set[name], err = expr.Compile(source, options...); err != nil {
+			return fmt.Errorf("transform set %s: %v", name, err)
+		}
+	}
+
+	if t.SortBy != "" {
+		if t.sortBy, err = expr.Compile(t.SortBy, expr.Env(item)); err != nil {
+			return fmt.Errorf("transform sort-by: %v", err)
+		}
+	}
+
+	if t.SortOrder == "" {
+		t.SortOrder = "asc"
+	} else if t.SortOrder != "asc" && t.SortOrder != "desc" {
+		return fmt.Errorf("transform sort-order must be either asc or desc, got %q", t.SortOrder)
+	}
+
+	return nil
+}
+
+// Returns the items unchanged along with an error if any of the expressions
+// fail, so that a mistake in the transform doesn't leave the widget empty
+func transformItems[T any](t *itemTransform, items []T) ([]T, error) {
+	if t == nil || len(items) == 0 {
+		return items, nil
+	}
+
+	transformed := make([]T, 0, len(items))
+
+	for i := range items {
+		item := items[i]
+
+		if t.filter != nil {
+			keep, err := expr.Run(t.filter, item)
+			if err != nil {
+				return items, fmt.Errorf("transform filter: %v", err)
+			}
+			if !keep.(bool) {
+				continue
+			}
+		}
+
+		if len(t.set) > 0 {
+			// expressions see the fields as they were before any of them got set
+			original := item
+			value := reflect.ValueOf(&item).Elem()
+
+			for name, program := range t.set {
+				result, err := expr.Run(program, original)
+				if err != nil {
+					return items, fmt.Errorf("transform set %s: %v", name, err)
+				}
+
+				field := value.FieldByName(name)
+				resultValue := reflect.ValueOf(result)
+				if !resultValue.IsValid() || !resultValue.Type().AssignableTo(field.Type()) {
+					return items, fmt.Errorf("transform set %s: can't set a %s field to %T", name, field.Type(), result)
+				}
+
+				field.Set(resultValue)
+			}
+		}
+
+		transformed = append(transformed, item)
+	}
+
+	if t.sortBy == nil {
+		return transformed, nil
+	}
+
+	keys := make([]any, len(transformed))
+	for i := range transformed {
+		key, err := expr.Run(t.sortBy, transformed[i])
+		if err != nil {
+			return items, fmt.Errorf("transform sort-by: %v", err)
+		}
+		keys[i] = key
+	}
+
+	indices := make([]int, len(transformed))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	var sortErr error
+	slices.SortStableFunc(indices, func(a, b int) int {
+		result, err := compareSortKeys(keys[a], keys[b])
+		if err != nil {
+			sortErr = err
+		}
+		if t.SortOrder == "desc" {
+			return -result
+		}
+		return result
+	})
+	if sortErr != nil {
+		return items, fmt.Errorf("transform sort-by: %v", sortErr)
+	}
+
+	sorted := make([]T, len(transformed))
+	for i, index := range indices {
+		sorted[i] = transformed[index]
+	}
+
+	return sorted, nil
+}
+
+func compareSortKeys(a, b any) (int, error) {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return cmp.Compare(a, b), nil
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b), nil
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			// false sorts before true
+			return cmp.Compare(boolToInt(a), boolToInt(b)), nil
+		}
+	default:
+		if a, ok := sortKeyToNumber(a); ok {
+			if b, ok := sortKeyToNumber(b); ok {
+				return cmp.Compare(a, b), nil
+			}
+		}
+	}
+
+	return 0, errors.New("expression must result in values of the same type, which can be text, numbers, booleans or times")
+}
+
+func sortKeyToNumber(value any) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+
+	return 0, false
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -3,6 +3,7 @@ package widgets
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
@@ -12,6 +13,8 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 )
 
 var twitchChannelsWidgetTemplate = common.MustParseTemplate("twitch-channels.html", "widget-base.html")
@@ -22,9 +25,14 @@ type twitchChannelsWidget struct {
 	Channels        []twitchChannel `yaml:"-"`
 	CollapseAfter   int             `yaml:"collapse-after"`
 	SortBy          string          `yaml:"sort-by"`
+	Transform       *itemTransform  `yaml:"transform"`
 }
 
 func (widget *twitchChannelsWidget) Initialize() error {
+	if len(widget.ChannelsRequest) == 0 {
+		return errors.New("at least one channel is required")
+	}
+
 	widget.
 		withTitle("Twitch Channels").
 		withTitleURL("https://www.twitch.tv/directory/following").
@@ -34,15 +42,15 @@ func (widget *twitchChannelsWidget) Initialize() error {
 		widget.CollapseAfter = 5
 	}
 
-	if widget.SortBy != "viewers" && widget.SortBy != "live" {
+	if widget.SortBy != "viewers" && widget.SortBy != "live" && widget.SortBy != "name" {
 		widget.SortBy = "viewers"
 	}
 
-	return nil
+	return widget.Transform.initialize(twitchChannel{})
 }
 
 func (widget *twitchChannelsWidget) Update(ctx context.Context) {
-	channels, err := fetchChannelsFromTwitch(widget.ChannelsRequest)
+	channels, err := fetchChannelsFromTwitch(widget.httpClient(false), widget.ChannelsRequest)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -52,26 +60,67 @@ func (widget *twitchChannelsWidget) Update(ctx context.Context) {
 		channels.sortByViewers()
 	} else if widget.SortBy == "live" {
 		channels.sortByLive()
+	} else if widget.SortBy == "name" {
+		channels.sortByName()
+	}
+
+	if channels, err = transformItems(widget.Transform, channels); err != nil {
+		widget.withNotice(err)
 	}
 
+	widget.notifyOfChannelsGoingLive(channels)
 	widget.Channels = channels
 }
 
+// Only channels that were known to be offline count, so that nothing gets
+// sent for the channels that were already live when the server started
+func (widget *twitchChannelsWidget) notifyOfChannelsGoingLive(channels twitchChannelList) {
+	wasLive := make(map[string]bool, len(widget.Channels))
+	for i := range widget.Channels {
+		if widget.Channels[i].Exists {
+			wasLive[widget.Channels[i].Login] = widget.Channels[i].IsLive
+		}
+	}
+
+	for i := range channels {
+		channel := &channels[i]
+		if live, known := wasLive[channel.Login]; !known || live || !channel.IsLive {
+			continue
+		}
+
+		message := channel.StreamTitle
+		if channel.Category != "" {
+			message += " (" + channel.Category + ")"
+		}
+
+		widget.notify(models.WidgetEvent{
+			Type:    models.WidgetEventStreamLive,
+			Title:   channel.Name + " is live",
+			Message: message,
+			URL:     "https://twitch.tv/" + channel.Login,
+		})
+	}
+}
+
+func (widget *twitchChannelsWidget) MarshalData() (any, error) {
+	return widget.Channels, nil
+}
+
 func (widget *twitchChannelsWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, twitchChannelsWidgetTemplate)
 }
 
 type twitchChannel struct {
-	Login        string
-	Exists       bool
-	Name         string
-	StreamTitle  string
-	AvatarUrl    string
-	IsLive       bool
-	LiveSince    time.Time
-	Category     string
-	CategorySlug string
-	ViewersCount int
+	Login        string    `json:"login"`
+	Exists       bool      `json:"exists"`
+	Name         string    `json:"name"`
+	StreamTitle  string    `json:"stream_title,omitempty"`
+	AvatarUrl    string    `json:"avatar_url"`
+	IsLive       bool      `json:"is_live"`
+	LiveSince    time.Time `json:"live_since,omitzero"`
+	Category     string    `json:"category,omitempty"`
+	CategorySlug string    `json:"category_slug,omitempty"`
+	ViewersCount int       `json:"viewers_count"`
 }
 
 type twitchChannelList []twitchChannel
@@ -88,6 +137,12 @@ func (channels twitchChannelList) sortByLive() {
 	})
 }
 
+func (channels twitchChannelList) sortByName() {
+	sort.SliceStable(channels, func(i, j int) bool {
+		return strings.ToLower(channels[i].Name) < strings.ToLower(channels[j].Name)
+	})
+}
+
 type twitchOperationResponse struct {
 	Data       json.RawMessage
 	Extensions struct {
@@ -132,7 +187,13 @@ const twitchChannelStatusOperationRequestBody = `[
 // what the limit is for max operations per request and batch operations in
 // multiple requests if number of channels exceeds allowed limit.
 
-func fetchChannelFromTwitchTask(channel string) (twitchChannel, error) {
+func fetchChannelFromTwitchTask(client fetch.Doer) func(string) (twitchChannel, error) {
+	return func(channel string) (twitchChannel, error) {
+		return fetchChannelFromTwitch(client, channel)
+	}
+}
+
+func fetchChannelFromTwitch(client fetch.Doer, channel string) (twitchChannel, error) {
 	result := twitchChannel{
 		Login: strings.ToLower(channel),
 	}
@@ -141,7 +202,7 @@ func fetchChannelFromTwitchTask(channel string) (twitchChannel, error) {
 	request, _ := http.NewRequest("POST", twitchGqlEndpoint, reader)
 	request.Header.Add("Client-ID", twitchGqlClientId)
 
-	response, err := decodeJsonFromRequest[[]twitchOperationResponse](defaultHTTPClient, request)
+	response, err := fetch.DecodeJSON[[]twitchOperationResponse](client, request)
 	if err != nil {
 		return result, err
 	}
@@ -207,10 +268,10 @@ func fetchChannelFromTwitchTask(channel string) (twitchChannel, error) {
 	return result, nil
 }
 
-func fetchChannelsFromTwitch(channelLogins []string) (twitchChannelList, error) {
+func fetchChannelsFromTwitch(client fetch.Doer, channelLogins []string) (twitchChannelList, error) {
 	result := make(twitchChannelList, 0, len(channelLogins))
 
-	job := newJob(fetchChannelFromTwitchTask, channelLogins).withWorkers(10)
+	job := newJob(fetchChannelFromTwitchTask(client), channelLogins).withWorkers(10)
 	channels, errs, err := workerPoolDo(job)
 	if err != nil {
 		return result, err
@@ -229,11 +290,11 @@ func fetchChannelsFromTwitch(channelLogins []string) (twitchChannelList, error)
 	}
 
 	if failed == len(channelLogins) {
-		return result, errNoContent
+		return result, models.ErrNoContent
 	}
 
 	if failed > 0 {
-		return result, fmt.Errorf("%w: failed to fetch %d channels", errPartialContent, failed)
+		return result, fmt.Errorf("%w: failed to fetch %d channels", models.ErrPartialContent, failed)
 	}
 
 	return result, nil
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 )
 
 var twitchGamesWidgetTemplate = common.MustParseTemplate("twitch-games-list.html", "widget-base.html")
@@ -41,7 +42,7 @@ func (widget *twitchGamesWidget) Initialize() error {
 }
 
 func (widget *twitchGamesWidget) Update(ctx context.Context) {
-	categories, err := fetchTopGamesFromTwitch(widget.Exclude, widget.Limit)
+	categories, err := fetchTopGamesFromTwitch(widget.httpClient(false), widget.Exclude, widget.Limit)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -50,6 +51,38 @@ func (widget *twitchGamesWidget) Update(ctx context.Context) {
 	widget.Categories = categories
 }
 
+// The JSON tags of categories match the Twitch API they're decoded from
+func (widget *twitchGamesWidget) MarshalData() (any, error) {
+	type exportedCategory struct {
+		Slug         string   `json:"slug"`
+		Name         string   `json:"name"`
+		AvatarUrl    string   `json:"avatar_url"`
+		ViewersCount int      `json:"viewers_count"`
+		Tags         []string `json:"tags"`
+		IsNew        bool     `json:"is_new"`
+	}
+
+	categories := make([]exportedCategory, len(widget.Categories))
+	for i := range widget.Categories {
+		category := &widget.Categories[i]
+		tags := make([]string, len(category.Tags))
+		for t := range category.Tags {
+			tags[t] = category.Tags[t].Name
+		}
+
+		categories[i] = exportedCategory{
+			Slug:         category.Slug,
+			Name:         category.Name,
+			AvatarUrl:    category.AvatarUrl,
+			ViewersCount: category.ViewersCount,
+			Tags:         tags,
+			IsNew:        category.IsNew,
+		}
+	}
+
+	return categories, nil
+}
+
 func (widget *twitchGamesWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, twitchGamesWidgetTemplate)
 }
@@ -80,11 +113,11 @@ const twitchDirectoriesOperationRequestBody = `[
 {"operationName": "BrowsePage_AllDirectories","variables": {"limit": %d,"options": {"sort": "VIEWER_COUNT","tags": []}},"extensions": {"persistedQuery": {"version": 1,"sha256Hash": "2f67f71ba89f3c0ed26a141ec00da1defecb2303595f5cda4298169549783d9e"}}}
 ]`
 
-func fetchTopGamesFromTwitch(exclude []string, limit int) ([]twitchCategory, error) {
+func fetchTopGamesFromTwitch(client fetch.Doer, exclude []string, limit int) ([]twitchCategory, error) {
 	reader := strings.NewReader(fmt.Sprintf(twitchDirectoriesOperationRequestBody, len(exclude)+limit))
 	request, _ := http.NewRequest("POST", twitchGqlEndpoint, reader)
 	request.Header.Add("Client-ID", twitchGqlClientId)
-	response, err := decodeJsonFromRequest[[]twitchDirectoriesOperationResponse](defaultHTTPClient, request)
+	response, err := fetch.DecodeJSON[[]twitchDirectoriesOperationResponse](client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,419 @@
+package widgets
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+var upsWidgetTemplate = common.MustParseTemplate("ups.html", "widget-base.html")
+
+const (
+	upsProtocolNUT     = "nut"
+	upsProtocolApcupsd = "apcupsd"
+)
+
+type upsWidget struct {
+	widgetBase `yaml:",inline"`
+	Protocol   string `yaml:"protocol"`
+	Host       string `yaml:"host"`
+	Port       uint16 `yaml:"port"`
+	Name       string `yaml:"name"`
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+
+	UPS *upsStatus `yaml:"-"`
+}
+
+type upsStatus struct {
+	Model      string
+	OnBattery  bool
+	LowBattery bool
+	Charging   bool
+	// -1 when the UPS doesn't report them
+	Charge     int
+	Load       int
+	Runtime    time.Duration
+	HasRuntime bool
+	Voltage    float64
+}
+
+func (widget *upsWidget) Initialize() error {
+	if widget.Host == "" {
+		return errors.New("host is required")
+	}
+
+	switch widget.Protocol {
+	case "", upsProtocolNUT:
+		widget.Protocol = upsProtocolNUT
+		if widget.Port == 0 {
+			widget.Port = 3493
+		}
+	case upsProtocolApcupsd:
+		if widget.Port == 0 {
+			widget.Port = 3551
+		}
+		if widget.Name != "" || widget.Username != "" {
+			return errors.New("name, username and password can only be used with nut")
+		}
+	default:
+		return fmt.Errorf("protocol must be either nut or apcupsd, got %q", widget.Protocol)
+	}
+
+	if (widget.Username == "") != (widget.Password == "") {
+		return errors.New("username and password have to be set together")
+	}
+
+	widget.withTitle("UPS").withCacheDuration(30 * time.Second)
+
+	return nil
+}
+
+func (widget *upsWidget) Update(ctx context.Context) {
+	status, err := widget.fetchStatus(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.notifyPowerChanges(widget.UPS, status)
+	widget.UPS = status
+}
+
+func (widget *upsWidget) fetchStatus(ctx context.Context) (*upsStatus, error) {
+	timeout := time.Duration(widget.RequestTimeout)
+	if timeout <= 0 {
+		timeout = common.DefaultClientTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := fetch.DialContext(ctx, "tcp", net.JoinHostPort(widget.Host, strconv.Itoa(int(widget.Port))))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if widget.Protocol == upsProtocolNUT {
+		return fetchNUTStatus(conn, widget.Name, widget.Username, widget.Password)
+	}
+
+	return fetchApcupsdStatus(conn)
+}
+
+// Nothing is sent after the first update since there's nothing to compare to
+func (widget *upsWidget) notifyPowerChanges(previous, current *upsStatus) {
+	if previous == nil {
+		return
+	}
+
+	name := common.Ternary(current.Model != "", current.Model, widget.Title)
+
+	switch {
+	case current.LowBattery && !previous.LowBattery:
+		widget.notify(models.WidgetEvent{
+			Type:    models.WidgetEventUPSLowBattery,
+			Title:   name + " is low on battery",
+			Message: upsBatteryMessage(current),
+		})
+	case current.OnBattery && !previous.OnBattery:
+		widget.notify(models.WidgetEvent{
+			Type:    models.WidgetEventUPSOnBattery,
+			Title:   name + " is on battery",
+			Message: upsBatteryMessage(current),
+		})
+	case !current.OnBattery && previous.OnBattery:
+		widget.notify(models.WidgetEvent{
+			Type:    models.WidgetEventUPSOnLine,
+			Title:   name + " is back on line power",
+			Message: upsBatteryMessage(current),
+		})
+	}
+}
+
+func upsBatteryMessage(status *upsStatus) string {
+	var parts []string
+
+	if status.Charge >= 0 {
+		parts = append(parts, strconv.Itoa(status.Charge)+"% charge")
+	}
+
+	if status.HasRuntime {
+		parts = append(parts, formatUPSRuntime(status.Runtime)+" of runtime left")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func (widget *upsWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, upsWidgetTemplate)
+}
+
+func (status *upsStatus) FormattedRuntime() string {
+	return formatUPSRuntime(status.Runtime)
+}
+
+func formatUPSRuntime(runtime time.Duration) string {
+	hours := int(runtime.Hours())
+	minutes := int(runtime.Minutes()) % 60
+
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+
+	return fmt.Sprintf("%dm", minutes)
+}
+
+func newUPSStatus() *upsStatus {
+	return &upsStatus{Charge: -1, Load: -1}
+}
+
+// Uses the text protocol of upsd, which answers one line per command
+func fetchNUTStatus(conn net.Conn, name, username, password string) (*upsStatus, error) {
+	reader := bufio.NewReader(conn)
+
+	command := func(line string) (string, error) {
+		if _, err := io.WriteString(conn, line+"\n"); err != nil {
+			return "", err
+		}
+
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		response = strings.TrimRight(response, "\r\n")
+
+		if reason, isErr := strings.CutPrefix(response, "ERR "); isErr {
+			return "", fmt.Errorf("upsd responded with %s", reason)
+		}
+
+		return response, nil
+	}
+
+	// lists are sent as BEGIN LIST, a line per item and END LIST
+	list := func(line string) ([][]string, error) {
+		if _, err := command(line); err != nil {
+			return nil, err
+		}
+
+		var items [][]string
+		for {
+			response, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+
+			fields := nutFields(strings.TrimRight(response, "\r\n"))
+			if len(fields) > 0 && fields[0] == "END" {
+				return items, nil
+			}
+
+			items = append(items, fields)
+		}
+	}
+
+	if username != "" {
+		if _, err := command("USERNAME " + username); err != nil {
+			return nil, err
+		}
+		if _, err := command("PASSWORD " + password); err != nil {
+			return nil, err
+		}
+	}
+
+	if name == "" {
+		upses, err := list("LIST UPS")
+		if err != nil {
+			return nil, err
+		}
+
+		if len(upses) == 0 || len(upses[0]) < 2 {
+			return nil, errors.New("upsd has no UPS")
+		}
+
+		name = upses[0][1]
+	}
+
+	variables, err := list("LIST VAR " + name)
+	if err != nil {
+		return nil, err
+	}
+
+	// not waiting for the response since the connection gets closed anyway
+	io.WriteString(conn, "LOGOUT\n")
+
+	values := make(map[string]string, len(variables))
+	for _, variable := range variables {
+		// VAR <ups> <name> "<value>"
+		if len(variable) == 4 && variable[0] == "VAR" {
+			values[variable[2]] = variable[3]
+		}
+	}
+
+	status := newUPSStatus()
+	status.Model = strings.TrimSpace(values["device.mfr"] + " " + common.Ternary(values["device.model"] != "", values["device.model"], values["ups.model"]))
+
+	flags := strings.Fields(values["ups.status"])
+	for _, flag := range flags {
+		switch flag {
+		case "OB":
+			status.OnBattery = true
+		case "LB":
+			status.LowBattery = true
+		case "CHRG":
+			status.Charging = true
+		}
+	}
+
+	if charge, err := strconv.ParseFloat(values["battery.charge"], 64); err == nil {
+		status.Charge = int(charge)
+	}
+
+	if load, err := strconv.ParseFloat(values["ups.load"], 64); err == nil {
+		status.Load = int(load)
+	}
+
+	if runtime, err := strconv.ParseFloat(values["battery.runtime"], 64); err == nil {
+		status.Runtime = time.Duration(runtime) * time.Second
+		status.HasRuntime = true
+	}
+
+	if voltage, err := strconv.ParseFloat(values["input.voltage"], 64); err == nil {
+		status.Voltage = voltage
+	}
+
+	return status, nil
+}
+
+// Splits a line of upsd's response into its fields, where quoted values can
+// contain spaces and escaped quotes
+func nutFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	quoted, escaped, inField := false, false, false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			inField = true
+		case r == ' ' && !quoted:
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if inField {
+		fields = append(fields, field.String())
+	}
+
+	return fields
+}
+
+// Uses the network information server of apcupsd, where messages in both
+// directions are prefixed with their length as a 16 bit integer
+func fetchApcupsdStatus(conn net.Conn) (*upsStatus, error) {
+	request := []byte{0, 6, 's', 't', 'a', 't', 'u', 's'}
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	values := make(map[string]string)
+
+	for {
+		var length uint16
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+
+		// the status ends with an empty message
+		if length == 0 {
+			break
+		}
+
+		line := make([]byte, length)
+		if _, err := io.ReadFull(reader, line); err != nil {
+			return nil, err
+		}
+
+		// such as "BCHARGE  : 100.0 Percent"
+		key, value, found := strings.Cut(string(line), ":")
+		if found {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, errors.New("apcupsd sent an empty status")
+	}
+
+	status := newUPSStatus()
+	status.Model = values["MODEL"]
+
+	for _, flag := range strings.Fields(values["STATUS"]) {
+		switch flag {
+		case "ONBATT":
+			status.OnBattery = true
+		case "LOWBATT":
+			status.LowBattery = true
+		}
+	}
+
+	// values are followed by their unit
+	number := func(key string) (float64, bool) {
+		fields := strings.Fields(values[key])
+		if len(fields) == 0 {
+			return 0, false
+		}
+
+		value, err := strconv.ParseFloat(fields[0], 64)
+		return value, err == nil
+	}
+
+	if charge, ok := number("BCHARGE"); ok {
+		status.Charge = int(charge)
+		status.Charging = !status.OnBattery && charge < 100
+	}
+
+	if load, ok := number("LOADPCT"); ok {
+		status.Load = int(load)
+	}
+
+	if minutes, ok := number("TIMELEFT"); ok {
+		status.Runtime = time.Duration(minutes * float64(time.Minute))
+		status.HasRuntime = true
+	}
+
+	if voltage, ok := number("LINEV"); ok {
+		status.Voltage = voltage
+	}
+
+	return status, nil
+}
@@ -2,141 +2,9 @@ package widgets
 
 import (
 	"context"
-	"crypto/tls"
-	"encoding/json"
-	"encoding/xml"
-	"errors"
-	"fmt"
-	"io"
-	"math/rand/v2"
-	"net/http"
-	"strconv"
 	"sync"
-	"sync/atomic"
-
-	"github.com/limpdev/gander/internal/common"
-)
-
-var (
-	errNoContent      = errors.New("failed to retrieve any content")
-	errPartialContent = errors.New("failed to retrieve some of the content")
 )
 
-var defaultHTTPClient = &http.Client{
-	Transport: &http.Transport{
-		MaxIdleConnsPerHost: 10,
-		Proxy:               http.ProxyFromEnvironment,
-	},
-	Timeout: common.DefaultClientTimeout,
-}
-
-var defaultInsecureHTTPClient = &http.Client{
-	Timeout: common.DefaultClientTimeout,
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		Proxy:           http.ProxyFromEnvironment,
-	},
-}
-
-type requestDoer interface {
-	Do(*http.Request) (*http.Response, error)
-}
-
-var glanceUserAgentString = "Gander/" + common.BuildVersion + " +https://github.com/limpdev/gander"
-var userAgentPersistentVersion atomic.Int32
-
-func getBrowserUserAgentHeader() string {
-	if rand.IntN(2000) == 0 {
-		userAgentPersistentVersion.Store(rand.Int32N(5))
-	}
-
-	version := strconv.Itoa(130 + int(userAgentPersistentVersion.Load()))
-	return "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:" + version + ".0) Gecko/20100101 Firefox/" + version + ".0"
-}
-
-func setBrowserUserAgentHeader(request *http.Request) {
-	request.Header.Set("User-Agent", getBrowserUserAgentHeader())
-}
-
-func decodeJsonFromRequest[T any](client requestDoer, request *http.Request) (T, error) {
-	var result T
-
-	response, err := client.Do(request)
-	if err != nil {
-		return result, err
-	}
-	defer response.Body.Close()
-
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return result, err
-	}
-
-	if response.StatusCode != http.StatusOK {
-		truncatedBody, _ := common.LimitStringLength(string(body), 256)
-
-		return result, fmt.Errorf(
-			"unexpected status code %d from %s, response: %s",
-			response.StatusCode,
-			request.URL,
-			truncatedBody,
-		)
-	}
-
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return result, err
-	}
-
-	return result, nil
-}
-
-func decodeJsonFromRequestTask[T any](client requestDoer) func(*http.Request) (T, error) {
-	return func(request *http.Request) (T, error) {
-		return decodeJsonFromRequest[T](client, request)
-	}
-}
-
-// TODO: tidy up, these are a copy of the above but with a line changed
-func decodeXmlFromRequest[T any](client requestDoer, request *http.Request) (T, error) {
-	var result T
-
-	response, err := client.Do(request)
-	if err != nil {
-		return result, err
-	}
-	defer response.Body.Close()
-
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return result, err
-	}
-
-	if response.StatusCode != http.StatusOK {
-		truncatedBody, _ := common.LimitStringLength(string(body), 256)
-
-		return result, fmt.Errorf(
-			"unexpected status code %d for %s, response: %s",
-			response.StatusCode,
-			request.URL,
-			truncatedBody,
-		)
-	}
-
-	err = xml.Unmarshal(body, &result)
-	if err != nil {
-		return result, err
-	}
-
-	return result, nil
-}
-
-func decodeXmlFromRequestTask[T any](client requestDoer) func(*http.Request) (T, error) {
-	return func(request *http.Request) (T, error) {
-		return decodeXmlFromRequest[T](client, request)
-	}
-}
-
 type workerPoolTask[I any, O any] struct {
 	index  int
 	input  I
@@ -2,16 +2,20 @@ package widgets
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 )
 
 const videosWidgetPlaylistPrefix = "playlist:"
@@ -24,18 +28,23 @@ var (
 
 type videosWidget struct {
 	widgetBase        `yaml:",inline"`
-	Videos            videoList `yaml:"-"`
-	VideoUrlTemplate  string    `yaml:"video-url-template"`
-	Style             string    `yaml:"style"`
-	CollapseAfter     int       `yaml:"collapse-after"`
-	CollapseAfterRows int       `yaml:"collapse-after-rows"`
-	Channels          []string  `yaml:"channels"`
-	Playlists         []string  `yaml:"playlists"`
-	Limit             int       `yaml:"limit"`
-	IncludeShorts     bool      `yaml:"include-shorts"`
+	Videos            videoList      `yaml:"-"`
+	VideoUrlTemplate  string         `yaml:"video-url-template"`
+	Style             string         `yaml:"style"`
+	CollapseAfter     int            `yaml:"collapse-after"`
+	CollapseAfterRows int            `yaml:"collapse-after-rows"`
+	Channels          []string       `yaml:"channels"`
+	Playlists         []string       `yaml:"playlists"`
+	Limit             int            `yaml:"limit"`
+	IncludeShorts     bool           `yaml:"include-shorts"`
+	Transform         *itemTransform `yaml:"transform"`
 }
 
 func (widget *videosWidget) Initialize() error {
+	if len(widget.Channels) == 0 && len(widget.Playlists) == 0 {
+		return errors.New("at least one channel or playlist is required")
+	}
+
 	widget.withTitle("Videos").withCacheDuration(time.Hour)
 
 	if widget.Limit <= 0 {
@@ -50,6 +59,10 @@ func (widget *videosWidget) Initialize() error {
 		widget.CollapseAfter = 7
 	}
 
+	if err := widget.Transform.initialize(video{}); err != nil {
+		return err
+	}
+
 	// A bit cheeky, but from a user's perspective it makes more sense when channels and
 	// playlists are separate things rather than specifying a list of channels and some of
 	// them awkwardly have a "playlist:" prefix
@@ -66,19 +79,58 @@ func (widget *videosWidget) Initialize() error {
 }
 
 func (widget *videosWidget) Update(ctx context.Context) {
-	videos, err := fetchYoutubeChannelUploads(widget.Channels, widget.VideoUrlTemplate, widget.IncludeShorts)
+	videos, err := fetchYoutubeChannelUploads(widget.httpClient(false), widget.Channels, widget.VideoUrlTemplate, widget.IncludeShorts)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
 	}
 
+	if videos, err = transformItems(widget.Transform, videos); err != nil {
+		widget.withNotice(err)
+	}
+
 	if len(videos) > widget.Limit {
 		videos = videos[:widget.Limit]
 	}
 
+	widget.notifyOfNewVideos(videos)
 	widget.Videos = videos
 }
 
+// The first fetch only establishes what's already been posted, and videos that
+// are older than everything that was shown before, such as those of a channel
+// that previously failed to load, don't count as new
+func (widget *videosWidget) notifyOfNewVideos(videos videoList) {
+	if len(widget.Videos) == 0 {
+		return
+	}
+
+	oldest := widget.Videos[0].TimePosted
+	for i := range widget.Videos {
+		if widget.Videos[i].TimePosted.Before(oldest) {
+			oldest = widget.Videos[i].TimePosted
+		}
+	}
+
+	for i := range videos {
+		if !videos[i].TimePosted.After(oldest) ||
+			slices.ContainsFunc(widget.Videos, func(v video) bool { return v.Url == videos[i].Url }) {
+			continue
+		}
+
+		widget.notify(models.WidgetEvent{
+			Type:    models.WidgetEventNewVideo,
+			Title:   "New video from " + videos[i].Author,
+			Message: videos[i].Title,
+			URL:     videos[i].Url,
+		})
+	}
+}
+
+func (widget *videosWidget) MarshalData() (any, error) {
+	return widget.Videos, nil
+}
+
 func (widget *videosWidget) Render() template.HTML {
 	var template *template.Template
 
@@ -122,12 +174,12 @@ func parseYoutubeFeedTime(t string) time.Time {
 }
 
 type video struct {
-	ThumbnailUrl string
-	Title        string
-	Url          string
-	Author       string
-	AuthorUrl    string
-	TimePosted   time.Time
+	ThumbnailUrl string    `json:"thumbnail_url"`
+	Title        string    `json:"title"`
+	Url          string    `json:"url"`
+	Author       string    `json:"author"`
+	AuthorUrl    string    `json:"author_url"`
+	TimePosted   time.Time `json:"time_posted"`
 }
 
 type videoList []video
@@ -140,7 +192,7 @@ func (v videoList) sortByNewest() videoList {
 	return v
 }
 
-func fetchYoutubeChannelUploads(channelOrPlaylistIDs []string, videoUrlTemplate string, includeShorts bool) (videoList, error) {
+func fetchYoutubeChannelUploads(client fetch.Doer, channelOrPlaylistIDs []string, videoUrlTemplate string, includeShorts bool) (videoList, error) {
 	requests := make([]*http.Request, 0, len(channelOrPlaylistIDs))
 
 	for i := range channelOrPlaylistIDs {
@@ -159,10 +211,10 @@ func fetchYoutubeChannelUploads(channelOrPlaylistIDs []string, videoUrlTemplate
 		requests = append(requests, request)
 	}
 
-	job := newJob(decodeXmlFromRequestTask[youtubeFeedResponseXml](defaultHTTPClient), requests).withWorkers(30)
+	job := newJob(fetch.DecodeXMLTask[youtubeFeedResponseXml](client), requests).withWorkers(30)
 	responses, errs, err := workerPoolDo(job)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
 	}
 
 	videos := make(videoList, 0, len(channelOrPlaylistIDs)*15)
@@ -205,13 +257,13 @@ func fetchYoutubeChannelUploads(channelOrPlaylistIDs []string, videoUrlTemplate
 	}
 
 	if len(videos) == 0 {
-		return nil, errNoContent
+		return nil, models.ErrNoContent
 	}
 
 	videos.sortByNewest()
 
 	if failed > 0 {
-		return videos, fmt.Errorf("%w: missing videos from %d channels", errPartialContent, failed)
+		return videos, fmt.Errorf("%w: missing videos from %d channels", models.ErrPartialContent, failed)
 	}
 
 	return videos, nil
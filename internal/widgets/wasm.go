@@ -0,0 +1,384 @@
+package widgets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/models"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+var wasmWidgetTemplate = common.MustParseTemplate("wasm.html", "widget-base.html")
+
+// Shared by the runtimes of all widgets so that widgets using the same module
+// and reloads of the config don't compile it again
+var wasmCompilationCache = wazero.NewCompilationCache()
+
+const (
+	wasmWidgetDefaultTimeout   = 10 * time.Second
+	wasmWidgetDefaultMaxMemory = 64
+	wasmWidgetMaxResponseSize  = 8 * 1024 * 1024
+	wasmWidgetMaxCacheEntries  = 256
+	wasmPageSize               = 64 * 1024
+)
+
+const (
+	wasmExportAlloc  = "gander_alloc"
+	wasmExportUpdate = "gander_update"
+)
+
+// Runs a WebAssembly module on every update. The module has no access to the
+// filesystem or the environment, can only make GET requests to the hosts that
+// it's allowed to and can keep values between updates through a cache that's
+// limited to the widget.
+type wasmWidget struct {
+	widgetBase   `yaml:",inline"`
+	Module       string               `yaml:"module"`
+	Options      map[string]any       `yaml:"options"`
+	AllowedHosts []string             `yaml:"allowed-hosts"`
+	Timeout      models.DurationField `yaml:"timeout"`
+	// In megabytes
+	MaxMemory int `yaml:"max-memory"`
+
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	cache    map[string]wasmCacheEntry
+	// Set by the module through the fail host function during an update
+	failure error
+	Content template.HTML `yaml:"-"`
+}
+
+type wasmCacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (widget *wasmWidget) Initialize() error {
+	widget.withTitle("WASM").withCacheDuration(5 * time.Minute)
+	widget.widgetBase.WIP = true
+
+	if widget.Module == "" {
+		return errors.New("module is required")
+	}
+
+	if widget.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	} else if widget.Timeout == 0 {
+		widget.Timeout = models.DurationField(wasmWidgetDefaultTimeout)
+	}
+
+	if widget.MaxMemory < 0 {
+		return errors.New("max-memory can't be negative")
+	} else if widget.MaxMemory == 0 {
+		widget.MaxMemory = wasmWidgetDefaultMaxMemory
+	}
+
+	if _, err := os.Stat(widget.Module); err != nil {
+		return fmt.Errorf("reading module: %v", err)
+	}
+
+	ctx := context.Background()
+	widget.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(widget.MaxMemory*1024*1024/wasmPageSize)).
+		WithCloseOnContextDone(true).
+		WithCompilationCache(wasmCompilationCache),
+	)
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, widget.runtime); err != nil {
+		return fmt.Errorf("instantiating WASI: %v", err)
+	}
+
+	if err := widget.instantiateHostModule(ctx); err != nil {
+		return fmt.Errorf("instantiating host functions: %v", err)
+	}
+
+	widget.cache = make(map[string]wasmCacheEntry)
+
+	return nil
+}
+
+// Compiling can take seconds for large modules, so it happens during the
+// first update rather than holding up startup
+func (widget *wasmWidget) compile(ctx context.Context) error {
+	binary, err := os.ReadFile(widget.Module)
+	if err != nil {
+		return fmt.Errorf("reading module: %v", err)
+	}
+
+	compiled, err := widget.runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return fmt.Errorf("compiling module: %v", err)
+	}
+
+	for _, name := range []string{wasmExportAlloc, wasmExportUpdate} {
+		if _, ok := compiled.ExportedFunctions()[name]; !ok {
+			return fmt.Errorf("module does not export %s", name)
+		}
+	}
+
+	widget.compiled = compiled
+
+	return nil
+}
+
+func (widget *wasmWidget) Update(ctx context.Context) {
+	content, err := widget.run(ctx)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	widget.Content = content
+}
+
+func (widget *wasmWidget) run(ctx context.Context) (template.HTML, error) {
+	if widget.compiled == nil {
+		if err := widget.compile(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	request, err := json.Marshal(pluginRequest{
+		ID:      widget.GetID(),
+		Type:    widget.GetType(),
+		Title:   widget.Title,
+		Options: widget.Options,
+	})
+	if err != nil {
+		return "", fmt.Errorf("encoding request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(widget.Timeout))
+	defer cancel()
+
+	// every update gets a fresh instance so that nothing leaks between them
+	// other than what the module put in the cache
+	module, err := widget.runtime.InstantiateModule(ctx, widget.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"),
+	)
+	if err != nil {
+		return "", fmt.Errorf("instantiating module: %v", err)
+	}
+	defer module.Close(context.Background())
+
+	widget.failure = nil
+
+	input, err := writeToWasmMemory(ctx, module, request)
+	if err != nil {
+		return "", err
+	}
+
+	results, err := module.ExportedFunction(wasmExportUpdate).Call(ctx, input, uint64(len(request)))
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("module did not finish within %s", time.Duration(widget.Timeout))
+	} else if err != nil {
+		return "", fmt.Errorf("calling %s: %v", wasmExportUpdate, err)
+	}
+
+	if widget.failure != nil {
+		return "", widget.failure
+	}
+
+	output, ok := readWasmMemory(module, results[0])
+	if !ok {
+		return "", fmt.Errorf("%s returned an out of bounds result", wasmExportUpdate)
+	}
+
+	return template.HTML(output), nil
+}
+
+// Host functions get imported from the "gander" module. Strings and byte
+// slices are passed as a pointer and a length, results as a single value with
+// the pointer in the upper 32 bits and the length in the lower 32, where 0
+// means that there's no result.
+func (widget *wasmWidget) instantiateHostModule(ctx context.Context) error {
+	_, err := widget.runtime.NewHostModuleBuilder("gander").
+		NewFunctionBuilder().WithFunc(widget.hostHTTPGet).Export("http_get").
+		NewFunctionBuilder().WithFunc(widget.hostCacheGet).Export("cache_get").
+		NewFunctionBuilder().WithFunc(widget.hostCacheSet).Export("cache_set").
+		NewFunctionBuilder().WithFunc(widget.hostFail).Export("fail").
+		NewFunctionBuilder().WithFunc(widget.hostLog).Export("log").
+		Instantiate(ctx)
+
+	return err
+}
+
+func (widget *wasmWidget) hostHTTPGet(ctx context.Context, module api.Module, urlPtr, urlLen uint32) uint64 {
+	rawURL, ok := module.Memory().Read(urlPtr, urlLen)
+	if !ok {
+		return 0
+	}
+
+	body, err := widget.httpGet(ctx, string(rawURL))
+	if err != nil {
+		slog.Warn("WASM module request failed", "widget", widget.GetID(), "url", string(rawURL), "error", err)
+		return 0
+	}
+
+	result, err := writeToWasmMemory(ctx, module, body)
+	if err != nil {
+		return 0
+	}
+
+	return result<<32 | uint64(len(body))
+}
+
+func (widget *wasmWidget) httpGet(ctx context.Context, rawURL string) ([]byte, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, errors.New("only http and https URLs can be requested")
+	}
+
+	if !slices.Contains(widget.AllowedHosts, parsed.Hostname()) {
+		return nil, fmt.Errorf("host %s is not in allowed-hosts", parsed.Hostname())
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := widget.httpClient(false).Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, wasmWidgetMaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > wasmWidgetMaxResponseSize {
+		return nil, errors.New("response is too large")
+	}
+
+	return body, nil
+}
+
+func (widget *wasmWidget) hostCacheGet(ctx context.Context, module api.Module, keyPtr, keyLen uint32) uint64 {
+	key, ok := module.Memory().Read(keyPtr, keyLen)
+	if !ok {
+		return 0
+	}
+
+	entry, exists := widget.cache[string(key)]
+	if !exists || time.Now().After(entry.expires) {
+		return 0
+	}
+
+	result, err := writeToWasmMemory(ctx, module, entry.value)
+	if err != nil {
+		return 0
+	}
+
+	return result<<32 | uint64(len(entry.value))
+}
+
+func (widget *wasmWidget) hostCacheSet(_ context.Context, module api.Module, keyPtr, keyLen, valuePtr, valueLen, ttlSeconds uint32) {
+	key, ok := module.Memory().Read(keyPtr, keyLen)
+	if !ok {
+		return
+	}
+
+	value, ok := module.Memory().Read(valuePtr, valueLen)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if _, exists := widget.cache[string(key)]; !exists && len(widget.cache) >= wasmWidgetMaxCacheEntries {
+		for k, entry := range widget.cache {
+			if now.After(entry.expires) {
+				delete(widget.cache, k)
+			}
+		}
+
+		if len(widget.cache) >= wasmWidgetMaxCacheEntries {
+			return
+		}
+	}
+
+	widget.cache[string(key)] = wasmCacheEntry{
+		// memory reads are views into the module's memory, which goes away
+		// along with the instance
+		value:   slices.Clone(value),
+		expires: now.Add(time.Duration(ttlSeconds) * time.Second),
+	}
+}
+
+func (widget *wasmWidget) hostFail(_ context.Context, module api.Module, messagePtr, messageLen uint32) {
+	message, ok := module.Memory().Read(messagePtr, messageLen)
+	if !ok {
+		message = []byte("module failed")
+	}
+
+	widget.failure = errors.New(string(message))
+}
+
+func (widget *wasmWidget) hostLog(_ context.Context, module api.Module, messagePtr, messageLen uint32) {
+	if message, ok := module.Memory().Read(messagePtr, messageLen); ok {
+		slog.Info("WASM module", "widget", widget.GetID(), "message", string(message))
+	}
+}
+
+func (widget *wasmWidget) MarshalData() (any, error) {
+	return struct {
+		Content string `json:"content"`
+	}{
+		Content: string(widget.Content),
+	}, nil
+}
+
+func (widget *wasmWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, wasmWidgetTemplate)
+}
+
+// Copies data into memory allocated by the module and returns its address
+func writeToWasmMemory(ctx context.Context, module api.Module, data []byte) (uint64, error) {
+	results, err := module.ExportedFunction(wasmExportAlloc).Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("calling %s: %v", wasmExportAlloc, err)
+	}
+
+	ptr := uint32(results[0])
+	if !module.Memory().Write(ptr, data) {
+		return 0, fmt.Errorf("%s returned an out of bounds address", wasmExportAlloc)
+	}
+
+	return uint64(ptr), nil
+}
+
+func readWasmMemory(module api.Module, packed uint64) ([]byte, bool) {
+	if packed == 0 {
+		return nil, true
+	}
+
+	data, ok := module.Memory().Read(uint32(packed>>32), uint32(packed))
+	if !ok {
+		return nil, false
+	}
+
+	return slices.Clone(data), true
+}
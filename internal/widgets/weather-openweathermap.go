@@ -0,0 +1,135 @@
+package widgets
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+const weatherProviderOpenWeatherMap = "openweathermap"
+
+type openWeatherMapProvider struct{}
+
+type openWeatherMapResponseJson struct {
+	Current struct {
+		Sunrise   int64   `json:"sunrise"`
+		Sunset    int64   `json:"sunset"`
+		Temp      float64 `json:"temp"`
+		FeelsLike float64 `json:"feels_like"`
+		Weather   []struct {
+			ID int `json:"id"`
+		} `json:"weather"`
+	} `json:"current"`
+	Hourly []struct {
+		Dt   int64   `json:"dt"`
+		Temp float64 `json:"temp"`
+		Pop  float64 `json:"pop"`
+	} `json:"hourly"`
+}
+
+// Uses the One Call API, which only forecasts from the current hour onwards,
+// so the hours of the day that have passed get the forecast for tomorrow
+func (*openWeatherMapProvider) fetchWeather(client fetch.Doer, widget *weatherWidget) (*weather, error) {
+	place := widget.Place
+	query := url.Values{}
+	query.Set("lat", fmt.Sprintf("%f", place.Latitude))
+	query.Set("lon", fmt.Sprintf("%f", place.Longitude))
+	query.Set("exclude", "minutely,daily,alerts")
+	query.Set("units", widget.Units)
+	query.Set("appid", widget.APIKey)
+
+	request, _ := http.NewRequest("GET", "https://api.openweathermap.org/data/3.0/onecall?"+query.Encode(), nil)
+	responseJson, err := fetch.DecodeJSON[openWeatherMapResponseJson](client, request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
+	}
+
+	hourly := make(map[int64]int, len(responseJson.Hourly))
+	for i := range responseJson.Hourly {
+		hourly[responseJson.Hourly[i].Dt] = i
+	}
+
+	now := time.Now().In(place.location)
+	temperatures := make([]float64, 0, 24)
+	precipitationProbabilities := make([]int, 0, 24)
+
+	for hour := range 24 {
+		at := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, place.location)
+
+		i, exists := hourly[at.Unix()]
+		if !exists {
+			i, exists = hourly[at.AddDate(0, 0, 1).Unix()]
+		}
+
+		if !exists {
+			break
+		}
+
+		temperatures = append(temperatures, responseJson.Hourly[i].Temp)
+		precipitationProbabilities = append(precipitationProbabilities, int(math.Round(responseJson.Hourly[i].Pop*100)))
+	}
+
+	var condition int
+	if len(responseJson.Current.Weather) > 0 {
+		condition = responseJson.Current.Weather[0].ID
+	}
+
+	currentColumn := now.Hour() / 2
+	sunsetColumn := (time.Unix(responseJson.Current.Sunset, 0).In(place.location).Hour() - 1) / 2
+
+	return &weather{
+		Temperature:         int(responseJson.Current.Temp),
+		ApparentTemperature: int(responseJson.Current.FeelsLike),
+		WeatherCode:         openWeatherMapConditionToWeatherCode(condition),
+		CurrentColumn:       currentColumn,
+		SunriseColumn:       time.Unix(responseJson.Current.Sunrise, 0).In(place.location).Hour() / 2,
+		SunsetColumn:        max(sunsetColumn, 0),
+		Columns:             weatherColumnsFromHourly(temperatures, precipitationProbabilities, responseJson.Current.Temp, currentColumn),
+	}, nil
+}
+
+// Converts the condition codes of OpenWeatherMap to the WMO codes that Open
+// Meteo uses, which is what the widget knows how to describe
+func openWeatherMapConditionToWeatherCode(condition int) int {
+	switch {
+	case condition >= 200 && condition < 300:
+		return 95
+	case condition >= 300 && condition < 400:
+		return 53
+	case condition == 500:
+		return 61
+	case condition == 501:
+		return 63
+	case condition >= 502 && condition <= 504:
+		return 65
+	case condition == 511:
+		return 66
+	case condition == 520 || condition == 521:
+		return 80
+	case condition == 522 || condition == 531:
+		return 82
+	case condition == 600 || (condition >= 611 && condition <= 616):
+		return 71
+	case condition == 601:
+		return 73
+	case condition == 602:
+		return 75
+	case condition >= 620 && condition < 700:
+		return 85
+	case condition >= 700 && condition < 800:
+		return 45
+	case condition == 801:
+		return 1
+	case condition == 802:
+		return 2
+	case condition == 803 || condition == 804:
+		return 3
+	default:
+		return 0
+	}
+}
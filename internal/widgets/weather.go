@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
 
 	_ "time/tzdata"
 )
@@ -26,9 +28,19 @@ type weatherWidget struct {
 	HideLocation bool                        `yaml:"hide-location"`
 	HourFormat   string                      `yaml:"hour-format"`
 	Units        string                      `yaml:"units"`
+	Provider     string                      `yaml:"provider"`
+	APIKey       string                      `yaml:"api-key"`
 	Place        *openMeteoPlaceResponseJson `yaml:"-"`
 	Weather      *weather                    `yaml:"-"`
 	TimeLabels   [12]string                  `yaml:"-"`
+
+	provider weatherProvider `yaml:"-"`
+}
+
+// Places are always looked up through Open Meteo, providers only need to
+// fetch the weather of the place of the widget
+type weatherProvider interface {
+	fetchWeather(client fetch.Doer, widget *weatherWidget) (*weather, error)
 }
 
 var timeLabels12h = [12]string{"2am", "4am", "6am", "8am", "10am", "12pm", "2pm", "4pm", "6pm", "8pm", "10pm", "12am"}
@@ -55,12 +67,24 @@ func (widget *weatherWidget) Initialize() error {
 		return errors.New("units must be either metric or imperial")
 	}
 
+	provider, err := weatherProviders.get(widget.Provider)
+	if err != nil {
+		return err
+	}
+	widget.provider = provider
+
+	if widget.Provider == weatherProviderOpenWeatherMap && widget.APIKey == "" {
+		return errors.New("api-key is required with openweathermap")
+	} else if widget.Provider != weatherProviderOpenWeatherMap && widget.APIKey != "" {
+		return errors.New("api-key can only be used with openweathermap")
+	}
+
 	return nil
 }
 
 func (widget *weatherWidget) Update(ctx context.Context) {
 	if widget.Place == nil {
-		place, err := fetchOpenMeteoPlaceFromName(widget.Location)
+		place, err := fetchOpenMeteoPlaceFromName(widget.httpClient(false), widget.Location)
 		if err != nil {
 			widget.withError(err).scheduleEarlyUpdate()
 			return
@@ -69,7 +93,7 @@ func (widget *weatherWidget) Update(ctx context.Context) {
 		widget.Place = place
 	}
 
-	weather, err := fetchWeatherForOpenMeteoPlace(widget.Place, widget.Units)
+	weather, err := widget.provider.fetchWeather(widget.httpClient(false), widget)
 
 	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
@@ -78,6 +102,14 @@ func (widget *weatherWidget) Update(ctx context.Context) {
 	widget.Weather = weather
 }
 
+func (widget *weatherWidget) GetCoordinates() (float64, float64, bool) {
+	if widget.Place == nil {
+		return 0, 0, false
+	}
+
+	return widget.Place.Latitude, widget.Place.Longitude, true
+}
+
 func (widget *weatherWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, weatherWidgetTemplate)
 }
@@ -170,11 +202,11 @@ func parsePlaceName(name string) (string, string) {
 	return parts[0] + ", " + expandCountryAbbreviations(parts[2]), strings.TrimSpace(parts[1])
 }
 
-func fetchOpenMeteoPlaceFromName(location string) (*openMeteoPlaceResponseJson, error) {
+func fetchOpenMeteoPlaceFromName(client fetch.Doer, location string) (*openMeteoPlaceResponseJson, error) {
 	location, area := parsePlaceName(location)
 	requestUrl := fmt.Sprintf("https://geocoding-api.open-meteo.com/v1/search?name=%s&count=20&language=en&format=json", url.QueryEscape(location))
 	request, _ := http.NewRequest("GET", requestUrl, nil)
-	responseJson, err := decodeJsonFromRequest[openMeteoPlacesResponseJson](defaultHTTPClient, request)
+	responseJson, err := fetch.DecodeJSON[openMeteoPlacesResponseJson](client, request)
 	if err != nil {
 		return nil, fmt.Errorf("fetching places data: %v", err)
 	}
@@ -212,7 +244,10 @@ func fetchOpenMeteoPlaceFromName(location string) (*openMeteoPlaceResponseJson,
 	return place, nil
 }
 
-func fetchWeatherForOpenMeteoPlace(place *openMeteoPlaceResponseJson, units string) (*weather, error) {
+type openMeteoWeatherProvider struct{}
+
+func (*openMeteoWeatherProvider) fetchWeather(client fetch.Doer, widget *weatherWidget) (*weather, error) {
+	place, units := widget.Place, widget.Units
 	query := url.Values{}
 	var temperatureUnit string
 
@@ -234,66 +269,74 @@ func fetchWeatherForOpenMeteoPlace(place *openMeteoPlaceResponseJson, units stri
 
 	requestUrl := "https://api.open-meteo.com/v1/forecast?" + query.Encode()
 	request, _ := http.NewRequest("GET", requestUrl, nil)
-	responseJson, err := decodeJsonFromRequest[openMeteoWeatherResponseJson](defaultHTTPClient, request)
+	responseJson, err := fetch.DecodeJSON[openMeteoWeatherResponseJson](client, request)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", errNoContent, err)
+		return nil, fmt.Errorf("%w: %v", models.ErrNoContent, err)
 	}
 
 	now := time.Now().In(place.location)
-	bars := make([]weatherColumn, 0, 24)
-	currentBar := now.Hour() / 2
-	sunriseBar := (time.Unix(int64(responseJson.Daily.Sunrise[0]), 0).In(place.location).Hour()) / 2
-	sunsetBar := (time.Unix(int64(responseJson.Daily.Sunset[0]), 0).In(place.location).Hour() - 1) / 2
+	currentColumn := now.Hour() / 2
+	sunsetColumn := (time.Unix(int64(responseJson.Daily.Sunset[0]), 0).In(place.location).Hour() - 1) / 2
 
-	if sunsetBar < 0 {
-		sunsetBar = 0
-	}
+	return &weather{
+		Temperature:         int(responseJson.Current.Temperature),
+		ApparentTemperature: int(responseJson.Current.ApparentTemperature),
+		WeatherCode:         responseJson.Current.WeatherCode,
+		CurrentColumn:       currentColumn,
+		SunriseColumn:       (time.Unix(int64(responseJson.Daily.Sunrise[0]), 0).In(place.location).Hour()) / 2,
+		SunsetColumn:        max(sunsetColumn, 0),
+		Columns: weatherColumnsFromHourly(
+			responseJson.Hourly.Temperature,
+			responseJson.Hourly.PrecipitationProbability,
+			responseJson.Current.Temperature,
+			currentColumn,
+		),
+	}, nil
+}
 
-	if len(responseJson.Hourly.Temperature) == 24 {
-		temperatures := make([]int, 12)
-		precipitations := make([]bool, 12)
+// Averages the 24 hourly values of a day into columns of 2 hours each, the
+// current column gets the current temperature instead
+func weatherColumnsFromHourly(temperatures []float64, precipitationProbabilities []int, currentTemperature float64, currentColumn int) []weatherColumn {
+	if len(temperatures) != 24 || len(precipitationProbabilities) != 24 {
+		return nil
+	}
 
-		t := responseJson.Hourly.Temperature
-		p := responseJson.Hourly.PrecipitationProbability
+	columnTemperatures := make([]int, 12)
+	precipitations := make([]bool, 12)
 
-		for i := 0; i < 24; i += 2 {
-			if i/2 == currentBar {
-				temperatures[i/2] = int(responseJson.Current.Temperature)
-			} else {
-				temperatures[i/2] = int(math.Round((t[i] + t[i+1]) / 2))
-			}
+	t := temperatures
+	p := precipitationProbabilities
 
-			precipitations[i/2] = (p[i]+p[i+1])/2 > 75
+	for i := 0; i < 24; i += 2 {
+		if i/2 == currentColumn {
+			columnTemperatures[i/2] = int(currentTemperature)
+		} else {
+			columnTemperatures[i/2] = int(math.Round((t[i] + t[i+1]) / 2))
 		}
 
-		minT := slices.Min(temperatures)
-		maxT := slices.Max(temperatures)
+		precipitations[i/2] = (p[i]+p[i+1])/2 > 75
+	}
 
-		temperaturesRange := float64(maxT - minT)
+	minT := slices.Min(columnTemperatures)
+	maxT := slices.Max(columnTemperatures)
 
-		for i := 0; i < 12; i++ {
-			bars = append(bars, weatherColumn{
-				Temperature:      temperatures[i],
-				HasPrecipitation: precipitations[i],
-			})
+	temperaturesRange := float64(maxT - minT)
+	columns := make([]weatherColumn, 0, 12)
 
-			if temperaturesRange > 0 {
-				bars[i].Scale = float64(temperatures[i]-minT) / temperaturesRange
-			} else {
-				bars[i].Scale = 1
-			}
+	for i := 0; i < 12; i++ {
+		columns = append(columns, weatherColumn{
+			Temperature:      columnTemperatures[i],
+			HasPrecipitation: precipitations[i],
+		})
+
+		if temperaturesRange > 0 {
+			columns[i].Scale = float64(columnTemperatures[i]-minT) / temperaturesRange
+		} else {
+			columns[i].Scale = 1
 		}
 	}
 
-	return &weather{
-		Temperature:         int(responseJson.Current.Temperature),
-		ApparentTemperature: int(responseJson.Current.ApparentTemperature),
-		WeatherCode:         responseJson.Current.WeatherCode,
-		CurrentColumn:       currentBar,
-		SunriseColumn:       sunriseBar,
-		SunsetColumn:        sunsetBar,
-		Columns:             bars,
-	}, nil
+	return columns
 }
 
 var weatherCodeTable = map[int]string{
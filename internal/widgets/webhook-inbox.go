@@ -0,0 +1,210 @@
+package widgets
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/limpdev/gander/internal/common"
+	"github.com/tidwall/gjson"
+)
+
+var webhookInboxWidgetTemplate = common.MustParseTemplate("webhook-inbox.html", "widget-base.html")
+
+const webhookInboxMaxPayloadSize = 64 << 10
+
+// The name is part of the URL of the webhook and of the key of its state
+var webhookInboxNamePattern = regexp.MustCompile(`^[a-z0-9-]{1,64}$`)
+
+type webhookInboxWidget struct {
+	widgetBase    `yaml:",inline"`
+	Name          string `yaml:"name"`
+	Token         string `yaml:"token"`
+	Limit         int    `yaml:"limit"`
+	CollapseAfter int    `yaml:"collapse-after"`
+	Template      string `yaml:"template"`
+
+	compiledTemplate *template.Template  `yaml:"-"`
+	loadEventsOnce   sync.Once           `yaml:"-"`
+	Events           []webhookInboxEvent `yaml:"-"`
+}
+
+// Newest first, the payload is kept as it was received so that changing the
+// template also changes how the events that were already received look
+type webhookInboxEvent struct {
+	ReceivedAt time.Time       `json:"received_at"`
+	Payload    json.RawMessage `json:"payload"`
+
+	Rendered template.HTML `json:"-"`
+}
+
+type webhookInboxTemplateData struct {
+	JSON       decoratedGJSONResult
+	ReceivedAt time.Time
+}
+
+func (widget *webhookInboxWidget) Initialize() error {
+	widget.withTitle("Webhook Inbox").withError(nil)
+
+	if !webhookInboxNamePattern.MatchString(widget.Name) {
+		return errors.New("name is required and can only contain lowercase letters, digits and dashes")
+	}
+
+	if widget.Token == "" {
+		return errors.New("token is required")
+	}
+
+	if widget.Limit <= 0 {
+		widget.Limit = 10
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
+	}
+
+	if widget.Template != "" {
+		compiledTemplate, err := template.New("").Funcs(customAPITemplateFuncs).Parse(widget.Template)
+		if err != nil {
+			return fmt.Errorf("parsing template: %w", err)
+		}
+
+		widget.compiledTemplate = compiledTemplate
+	}
+
+	return nil
+}
+
+// Events are loaded on first use rather than when initializing since the
+// state store is one of the providers
+func (widget *webhookInboxWidget) Render() template.HTML {
+	widget.loadEventsOnce.Do(widget.loadEvents)
+	return widget.renderTemplate(widget, webhookInboxWidgetTemplate)
+}
+
+func (widget *webhookInboxWidget) URL() string {
+	return "/api/webhooks/" + widget.Name
+}
+
+func (widget *webhookInboxWidget) GetWebhookName() string {
+	return widget.Name
+}
+
+// The token can be sent either as a bearer token or, for services that only
+// let you set the URL of a webhook, as the token parameter of the query
+func (widget *webhookInboxWidget) isAuthorized(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		token = r.URL.Query().Get("token")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(widget.Token)) == 1
+}
+
+// Handles POST /api/webhooks/{name}, which adds the JSON in the body as the
+// newest event and drops the oldest ones past the limit
+func (widget *webhookInboxWidget) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	if !widget.isAuthorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookInboxMaxPayloadSize))
+	if err != nil {
+		http.Error(w, "payload is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !json.Valid(payload) {
+		http.Error(w, "payload must be JSON", http.StatusBadRequest)
+		return
+	}
+
+	widget.loadEventsOnce.Do(widget.loadEvents)
+
+	event := webhookInboxEvent{ReceivedAt: time.Now(), Payload: payload}
+	event.Rendered = widget.renderEvent(&event)
+
+	widget.updateLock.Lock()
+	widget.Events = append([]webhookInboxEvent{event}, widget.Events[:min(len(widget.Events), widget.Limit-1)]...)
+	err = widget.saveEvents()
+	widget.updateLock.Unlock()
+
+	if err != nil {
+		slog.Error("Failed to save webhook events", "name", widget.Name, "error", err)
+		http.Error(w, "could not save event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (widget *webhookInboxWidget) stateKey() string {
+	return "webhook-inbox-" + widget.Name
+}
+
+func (widget *webhookInboxWidget) loadEvents() {
+	if widget.Providers == nil || widget.Providers.State == nil {
+		return
+	}
+
+	var events []webhookInboxEvent
+	if err := widget.Providers.State.LoadWidgetState(widget.stateKey(), &events); err != nil {
+		slog.Error("Failed to load webhook events", "name", widget.Name, "error", err)
+		return
+	}
+
+	// the limit can be lowered between restarts
+	events = events[:min(len(events), widget.Limit)]
+	for i := range events {
+		events[i].Rendered = widget.renderEvent(&events[i])
+	}
+
+	widget.updateLock.Lock()
+	widget.Events = events
+	widget.updateLock.Unlock()
+}
+
+func (widget *webhookInboxWidget) saveEvents() error {
+	if widget.Providers == nil || widget.Providers.State == nil {
+		return nil
+	}
+
+	return widget.Providers.State.SaveWidgetState(widget.stateKey(), widget.Events)
+}
+
+// Without a template the payload is shown as indented JSON. Errors of the
+// template are shown in place of the event rather than failing the widget,
+// since a single payload without the expected fields shouldn't hide the rest.
+func (widget *webhookInboxWidget) renderEvent(event *webhookInboxEvent) template.HTML {
+	if widget.compiledTemplate == nil {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, event.Payload, "", "  "); err != nil {
+			indented.Reset()
+			indented.Write(event.Payload)
+		}
+
+		return template.HTML(`<pre class="webhook-inbox-payload">` + template.HTMLEscapeString(indented.String()) + `</pre>`)
+	}
+
+	data := webhookInboxTemplateData{
+		JSON:       decoratedGJSONResult{gjson.ParseBytes(event.Payload)},
+		ReceivedAt: event.ReceivedAt,
+	}
+
+	var rendered bytes.Buffer
+	if err := widget.compiledTemplate.Execute(&rendered, &data); err != nil {
+		return template.HTML(`<div class="color-negative">` + template.HTMLEscapeString(err.Error()) + `</div>`)
+	}
+
+	return template.HTML(rendered.String())
+}
@@ -4,140 +4,79 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"html/template"
 	"log/slog"
 	"math"
+	"math/rand/v2"
 	"net/http"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"gopkg.in/yaml.v3"
-
+	"github.com/limpdev/gander/internal/common"
+	"github.com/limpdev/gander/internal/fetch"
 	"github.com/limpdev/gander/internal/models"
 )
 
-var widgetIDCounter atomic.Uint64
-
-func newWidget(widgetType string) (Widget, error) {
-	if widgetType == "" {
-		return nil, errors.New("widget 'type' property is empty or not specified")
-	}
-
-	var w Widget
-
-	switch widgetType {
-	case "calendar":
-		w = &calendarWidget{}
-	case "calendar-legacy":
-		w = &oldCalendarWidget{}
-	case "clock":
-		w = &clockWidget{}
-	case "weather":
-		w = &weatherWidget{}
-	case "bookmarks":
-		w = &bookmarksWidget{}
-	case "iframe":
-		w = &iframeWidget{}
-	case "html":
-		w = &htmlWidget{}
-	case "hacker-news":
-		w = &hackerNewsWidget{}
-	case "releases":
-		w = &releasesWidget{}
-	case "videos":
-		w = &videosWidget{}
-	case "markets", "stocks":
-		w = &marketsWidget{}
-	case "reddit":
-		w = &redditWidget{}
-	case "rss":
-		w = &rssWidget{}
-	case "monitor":
-		w = &monitorWidget{}
-	case "twitch-top-games":
-		w = &twitchGamesWidget{}
-	case "twitch-channels":
-		w = &twitchChannelsWidget{}
-	case "lobsters":
-		w = &lobstersWidget{}
-	case "change-detection":
-		w = &changeDetectionWidget{}
-	case "repository":
-		w = &repositoryWidget{}
-	case "search":
-		w = &searchWidget{}
-	case "extension":
-		w = &extensionWidget{}
-	case "group":
-		w = &groupWidget{}
-	case "dns-stats":
-		w = &dnsStatsWidget{}
-	case "split-column":
-		w = &splitColumnWidget{}
-	case "custom-api":
-		w = &customAPIWidget{}
-	case "docker-containers":
-		w = &dockerContainersWidget{}
-	case "server-stats":
-		w = &serverStatsWidget{}
-	case "to-do":
-		w = &todoWidget{}
-	default:
-		return nil, fmt.Errorf("unknown widget type: %s", widgetType)
-	}
-
-	w.SetID(widgetIDCounter.Add(1))
-
-	return w, nil
-}
-
-type Widgets []Widget
-
-func (w *Widgets) UnmarshalYAML(node *yaml.Node) error {
-	var nodes []yaml.Node
-
-	if err := node.Decode(&nodes); err != nil {
-		return err
-	}
-
-	for _, node := range nodes {
-		meta := struct {
-			Type string `yaml:"type"`
-		}{}
-
-		if err := node.Decode(&meta); err != nil {
-			return err
-		}
-
-		widget, err := newWidget(meta.Type)
-		if err != nil {
-			return fmt.Errorf("line %d: %w", node.Line, err)
-		}
-
-		if err = node.Decode(widget); err != nil {
-			return err
-		}
-
-		*w = append(*w, widget)
+// The config loader can't import this package, so widgets get registered with
+// the models package which is what gets used when unmarshaling the config.
+func init() {
+	models.RegisterWidget("calendar", func() models.Widget { return &calendarWidget{} })
+	models.RegisterWidget("calendar-legacy", func() models.Widget { return &oldCalendarWidget{} })
+	models.RegisterWidget("clock", func() models.Widget { return &clockWidget{} })
+	models.RegisterWidget("bookmarks", func() models.Widget { return &bookmarksWidget{} })
+	models.RegisterWidget("hacker-news", func() models.Widget { return &hackerNewsWidget{} })
+	models.RegisterWidget("lobsters", func() models.Widget { return &lobstersWidget{} })
+	models.RegisterWidget("releases", func() models.Widget { return &releasesWidget{} })
+	models.RegisterWidget("repository", func() models.Widget { return &repositoryWidget{} })
+	models.RegisterWidget("markets", func() models.Widget { return &marketsWidget{} })
+	models.RegisterWidget("stocks", func() models.Widget { return &marketsWidget{} })
+	models.RegisterWidget("monitor", func() models.Widget { return &monitorWidget{} })
+	models.RegisterWidget("custom-api", func() models.Widget { return &customAPIWidget{} })
+	models.RegisterWidget("docker-containers", func() models.Widget { return &dockerContainersWidget{} })
+	models.RegisterWidget("server-stats", func() models.Widget { return &serverStatsWidget{} })
+	models.RegisterWidget("rss", func() models.Widget { return &rssWidget{} })
+	models.RegisterWidget("reddit", func() models.Widget { return &redditWidget{} })
+	models.RegisterWidget("videos", func() models.Widget { return &videosWidget{} })
+	models.RegisterWidget("twitch-channels", func() models.Widget { return &twitchChannelsWidget{} })
+	models.RegisterWidget("twitch-top-games", func() models.Widget { return &twitchGamesWidget{} })
+	models.RegisterWidget("dns-stats", func() models.Widget { return &dnsStatsWidget{} })
+	models.RegisterWidget("extension", func() models.Widget { return &extensionWidget{} })
+	models.RegisterWidget("plugin", func() models.Widget { return &pluginWidget{} })
+	models.RegisterWidget("command", func() models.Widget { return &commandWidget{} })
+	models.RegisterWidget("speedtest", func() models.Widget { return &speedtestWidget{} })
+	models.RegisterWidget("snmp", func() models.Widget { return &snmpWidget{} })
+	models.RegisterWidget("ups", func() models.Widget { return &upsWidget{} })
+	models.RegisterWidget("github-inbox", func() models.Widget { return &githubInboxWidget{} })
+	models.RegisterWidget("to-do", func() models.Widget { return &todoWidget{} })
+	models.RegisterWidget("list", func() models.Widget { return &listWidget{} })
+	models.RegisterWidget("notes", func() models.Widget { return &notesWidget{} })
+	models.RegisterWidget("exchange-rate", func() models.Widget { return &exchangeRateWidget{} })
+	models.RegisterWidget("sports", func() models.Widget { return &sportsWidget{} })
+	models.RegisterWidget("air-quality", func() models.Widget { return &airQualityWidget{} })
+	models.RegisterWidget("astronomy", func() models.Widget { return &astronomyWidget{} })
+	models.RegisterWidget("package-stats", func() models.Widget { return &packageStatsWidget{} })
+	models.RegisterWidget("change-detection", func() models.Widget { return &changeDetectionWidget{} })
+	models.RegisterWidget("webhook-inbox", func() models.Widget { return &webhookInboxWidget{} })
+	models.RegisterWidget("chart", func() models.Widget { return &chartWidget{} })
+	models.RegisterWidget("table", func() models.Widget { return &tableWidget{} })
+	models.RegisterWidget("image", func() models.Widget { return &imageWidget{} })
+	models.RegisterWidget("wasm", func() models.Widget { return &wasmWidget{} })
+	models.RegisterWidget("iframe", func() models.Widget { return &iframeWidget{} })
+	models.RegisterWidget("html", func() models.Widget { return &htmlWidget{} })
+	models.RegisterWidget("search", func() models.Widget { return &searchWidget{} })
+	models.RegisterWidget("split-column", func() models.Widget { return &splitColumnWidget{} })
+	models.RegisterWidget("group", func() models.Widget { return &groupWidget{} })
+	models.RegisterWidget("weather", func() models.Widget { return &weatherWidget{} })
+	models.RegisterWidget("kubernetes", func() models.Widget { return &kubernetesWidget{} })
+	models.RegisterWidget("local-services", func() models.Widget { return &localServicesWidget{} })
+	models.RegisterWidget("proxmox", func() models.Widget { return &proxmoxWidget{} })
+	models.RegisterWidget("home-assistant", func() models.Widget { return &homeAssistantWidget{} })
+	models.RegisterWidget("downloads", func() models.Widget { return &downloadsWidget{} })
+	for service := range arrServices {
+		models.RegisterWidget(service, func() models.Widget { return &arrWidget{} })
 	}
-
-	return nil
-}
-
-type Widget interface {
-	// These need to be exported because they get called in templates
-	Render() template.HTML
-	GetType() string
-	GetID() uint64
-
-	Initialize() error
-	RequiresUpdate(*time.Time) bool
-	SetProviders(*models.WidgetProviders)
-	Update(context.Context)
-	SetID(uint64)
-	HandleRequest(w http.ResponseWriter, r *http.Request)
-	SetHideHeader(bool)
 }
 
 type cacheType int
@@ -149,23 +88,41 @@ const (
 )
 
 type widgetBase struct {
-	ID                  uint64                  `yaml:"-"`
-	Providers           *models.WidgetProviders `yaml:"-"`
-	Type                string                  `yaml:"type"`
-	Title               string                  `yaml:"title"`
-	TitleURL            string                  `yaml:"title-url"`
-	HideHeader          bool                    `yaml:"hide-header"`
-	CSSClass            string                  `yaml:"css-class"`
-	CustomCacheDuration models.DurationField    `yaml:"cache"`
-	ContentAvailable    bool                    `yaml:"-"`
-	WIP                 bool                    `yaml:"-"`
-	Error               error                   `yaml:"-"`
-	Notice              error                   `yaml:"-"`
-	templateBuffer      bytes.Buffer            `yaml:"-"`
-	cacheDuration       time.Duration           `yaml:"-"`
-	cacheType           cacheType               `yaml:"-"`
-	nextUpdate          time.Time               `yaml:"-"`
-	updateRetriedTimes  int                     `yaml:"-"`
+	ID                  uint64                     `yaml:"-"`
+	Providers           *models.WidgetProviders    `yaml:"-"`
+	Type                string                     `yaml:"type"`
+	Title               string                     `yaml:"title"`
+	TitleURL            string                     `yaml:"title-url"`
+	HideHeader          bool                       `yaml:"hide-header"`
+	CSSClass            string                     `yaml:"css-class"`
+	CustomCacheDuration models.DurationField       `yaml:"cache"`
+	RequestTimeout      models.DurationField       `yaml:"request-timeout"`
+	Retries             int                        `yaml:"retries"`
+	RetryBackoff        models.DurationField       `yaml:"retry-backoff"`
+	Headers             map[string]string          `yaml:"headers"`
+	BasicAuth           *fetch.BasicAuth           `yaml:"basic-auth"`
+	Proxy               models.ProxyOptionsField   `yaml:"proxy"`
+	MaxResponseSize     int                        `yaml:"max-response-size"`
+	UpdateSchedule      models.UpdateScheduleField `yaml:"update-schedule"`
+	AllowedUsers        []string                   `yaml:"allowed-users"`
+	AllowedGroups       []string                   `yaml:"allowed-groups"`
+	ContentAvailable    bool                       `yaml:"-"`
+	WIP                 bool                       `yaml:"-"`
+	Error               error                      `yaml:"-"`
+	Notice              error                      `yaml:"-"`
+	templateBuffer      bytes.Buffer               `yaml:"-"`
+	cacheDuration       time.Duration              `yaml:"-"`
+	cacheType           cacheType                  `yaml:"-"`
+	nextUpdate          time.Time                  `yaml:"-"`
+	lastUpdate          time.Time                  `yaml:"-"`
+	updateLock          sync.RWMutex               `yaml:"-"`
+	renderLock          sync.Mutex                 `yaml:"-"`
+	lastRendered        template.HTML              `yaml:"-"`
+	bytesFetched        atomic.Int64               `yaml:"-"`
+	updateMetrics       models.WidgetUpdateMetrics `yaml:"-"`
+	fingerprint         string                     `yaml:"-"`
+	sourceLine          int                        `yaml:"-"`
+	updateRetriedTimes  int                        `yaml:"-"`
 }
 
 // widgetProviders moved to models package as WidgetProviders
@@ -175,17 +132,42 @@ func (w *widgetBase) RequiresUpdate(now *time.Time) bool {
 		return false
 	}
 
+	// already updating
+	if !w.updateLock.TryRLock() {
+		return false
+	}
+	defer w.updateLock.RUnlock()
+
 	if w.nextUpdate.IsZero() {
 		return true
 	}
 
-	return now.After(w.nextUpdate)
+	if !now.After(w.nextUpdate) {
+		return false
+	}
+
+	// outside of the schedule, widgets keep showing what they last fetched
+	// until the next time they're allowed to update
+	return w.updateSchedule().Allows(*now)
+}
+
+func (w *widgetBase) updateSchedule() models.UpdateScheduleField {
+	if len(w.UpdateSchedule) > 0 || w.Providers == nil {
+		return w.UpdateSchedule
+	}
+
+	return w.Providers.UpdateSchedule
 }
 
 func (w *widgetBase) IsWIP() bool {
 	return w.WIP
 }
 
+// Widgets that never update on their own have nothing to refresh
+func (w *widgetBase) CanRefresh() bool {
+	return w.cacheType != cacheTypeInfinite
+}
+
 func (w *widgetBase) Update(ctx context.Context) {
 
 }
@@ -198,6 +180,50 @@ func (w *widgetBase) SetID(id uint64) {
 	w.ID = id
 }
 
+func (w *widgetBase) GetError() error {
+	return w.Error
+}
+
+func (w *widgetBase) GetNotice() error {
+	return w.Notice
+}
+
+func (w *widgetBase) GetLastUpdate() time.Time {
+	return w.lastUpdate
+}
+
+func (w *widgetBase) SetFingerprint(fingerprint string) {
+	w.fingerprint = fingerprint
+}
+
+func (w *widgetBase) GetFingerprint() string {
+	return w.fingerprint
+}
+
+func (w *widgetBase) SetSourceLine(line int) {
+	w.sourceLine = line
+}
+
+func (w *widgetBase) GetSourceLine() int {
+	return w.sourceLine
+}
+
+func (w *widgetBase) GetAllowedUsers() []string {
+	return w.AllowedUsers
+}
+
+func (w *widgetBase) GetAllowedGroups() []string {
+	return w.AllowedGroups
+}
+
+func (w *widgetBase) GetTitle() string {
+	return w.Title
+}
+
+func (w *widgetBase) GetTitleURL() string {
+	return w.TitleURL
+}
+
 func (w *widgetBase) SetHideHeader(value bool) {
 	w.HideHeader = value
 }
@@ -214,7 +240,51 @@ func (w *widgetBase) SetProviders(providers *models.WidgetProviders) {
 	w.Providers = providers
 }
 
+func (w *widgetBase) RecordUpdate(duration time.Duration) {
+	metrics := &w.updateMetrics
+	metrics.Updates++
+	metrics.LastDuration = duration
+	metrics.LastBytesFetched = w.bytesFetched.Swap(0)
+	metrics.TotalBytesFetched += metrics.LastBytesFetched
+
+	if w.Error == nil {
+		metrics.SuccessStreak++
+		metrics.FailureStreak = 0
+	} else {
+		metrics.FailureStreak++
+		metrics.SuccessStreak = 0
+	}
+}
+
+func (w *widgetBase) GetUpdateMetrics() models.WidgetUpdateMetrics {
+	return w.updateMetrics
+}
+
+func (w *widgetBase) GetUpdateLock() *sync.RWMutex {
+	return &w.updateLock
+}
+
+var widgetUpdatingTemplate = common.MustParseTemplate("widget-updating.html")
+
+// While a widget updates, its fields can be halfway through being changed, so
+// the HTML it was last rendered to gets shown instead
+// The widget can get rendered for several requests at once, such as for a page
+// and for a request that the widget handled, which take turns since they share
+// the buffer and what was last rendered
 func (w *widgetBase) renderTemplate(data any, t *template.Template) template.HTML {
+	w.renderLock.Lock()
+	defer w.renderLock.Unlock()
+
+	if !w.updateLock.TryRLock() {
+		return w.renderWhileUpdating()
+	}
+	defer w.updateLock.RUnlock()
+
+	if !w.ContentAvailable && w.lastUpdate.IsZero() && w.cacheType != cacheTypeInfinite {
+		return w.renderWhileUpdating()
+	}
+
+	t = common.OverriddenTemplate(t)
 	w.templateBuffer.Reset()
 	err := t.Execute(&w.templateBuffer, data)
 	if err != nil {
@@ -237,7 +307,23 @@ func (w *widgetBase) renderTemplate(data any, t *template.Template) template.HTM
 		}
 	}
 
-	return template.HTML(w.templateBuffer.String())
+	w.lastRendered = template.HTML(w.templateBuffer.String())
+	return w.lastRendered
+}
+
+// Only uses the fields that don't change when updating, the title isn't one of
+// them since some widgets get it from what they fetch
+func (w *widgetBase) renderWhileUpdating() template.HTML {
+	if w.lastRendered != "" {
+		return template.HTML(strings.Replace(string(w.lastRendered), `class="widget `, `class="widget widget-updating `, 1))
+	}
+
+	var buffer bytes.Buffer
+	if err := common.OverriddenTemplate(widgetUpdatingTemplate).Execute(&buffer, w); err != nil {
+		slog.Error("Failed to render updating widget", "error", err)
+	}
+
+	return template.HTML(buffer.String())
 }
 
 func (w *widgetBase) withTitle(title string) *widgetBase {
@@ -268,6 +354,65 @@ func (w *widgetBase) withCacheDuration(duration time.Duration) *widgetBase {
 	return w
 }
 
+// Returns the client that widgets must use for their requests, which respects
+// the request-timeout property, measures what they fetch and sends the headers
+// and basic auth of the widget along with every request
+func (w *widgetBase) httpClient(allowInsecure bool) *http.Client {
+	return fetch.WithHeaders(w.plainHTTPClient(allowInsecure), w.Headers, w.BasicAuth)
+}
+
+// For requests that go to other services than the one the headers of the
+// widget are meant for
+func (w *widgetBase) plainHTTPClient(allowInsecure bool) *http.Client {
+	timeout := time.Duration(w.RequestTimeout)
+
+	var client *http.Client
+	if proxy := w.proxy(); proxy != nil {
+		client = proxy.NewClient(timeout, allowInsecure)
+	} else {
+		client = fetch.NewClient(timeout, allowInsecure)
+	}
+
+	client = fetch.WithMaxResponseSize(client, int64(w.maxResponseSize())<<20)
+	return fetch.WithByteCounter(client, &w.bytesFetched)
+}
+
+// In megabytes, 0 when the default of the fetch package applies
+func (w *widgetBase) maxResponseSize() int {
+	if w.MaxResponseSize > 0 || w.Providers == nil {
+		return w.MaxResponseSize
+	}
+
+	return w.Providers.MaxResponseSize
+}
+
+// For the widgets whose URLs are the most likely to come from configs written
+// by someone else, which can't reach the local network unless allowed to
+func (w *widgetBase) restrictToPublicAddresses(client *http.Client, allowPrivate bool) *http.Client {
+	if allowPrivate || w.Providers != nil && w.Providers.AllowPrivateAddresses {
+		return client
+	}
+
+	return fetch.WithoutPrivateAddresses(client)
+}
+
+// Nil when requests shouldn't go through a proxy
+func (w *widgetBase) proxy() *models.ProxyOptionsField {
+	if w.Proxy.Disabled {
+		return nil
+	}
+
+	if w.Proxy.Client != nil {
+		return &w.Proxy
+	}
+
+	if w.Providers != nil && w.Providers.DefaultProxy != nil && w.Providers.DefaultProxy.Client != nil {
+		return w.Providers.DefaultProxy
+	}
+
+	return nil
+}
+
 func (w *widgetBase) withCacheOnTheHour() *widgetBase {
 	w.cacheType = cacheTypeOnTheHour
 
@@ -291,30 +436,50 @@ func (w *widgetBase) withError(err error) *widgetBase {
 }
 
 func (w *widgetBase) canContinueUpdateAfterHandlingErr(err error) bool {
-	// TODO: needs covering more edge cases.
-	// if there's partial content and we update early there's a chance
-	// the early update returns even less content than the initial update.
-	// need some kind of mechanism that tells us whether we should update early
-	// or not depending on the number of things that failed during the initial
-	// and subsequent update and how they failed - ie whether it was server
-	// error (like gateway timeout, do retry early) or client error (like
-	// hitting a rate limit, don't retry early). will require reworking a
-	// good amount of code in the feed package and probably having a custom
-	// error type that holds more information because screw wrapping errors.
-	// alternatively have a resource cache and only refetch the failed resources,
-	// then rebuild the widget.
-
-	if err != nil {
-		w.scheduleEarlyUpdate()
+	// Errors that wrap models.ErrPartialContent mean that some of the sources
+	// failed while the rest were fetched, in which case the widget shows what
+	// it got along with the error as a notice. It isn't updated early since
+	// there's a chance the early update returns even less content than this
+	// one, the failed sources are likely to be failing for a while (such as
+	// when hitting a rate limit) and retrying would fetch the working ones
+	// again as well.
+
+	// Updates that got canceled, such as refreshes whose client went away,
+	// say nothing about the sources so the widget keeps what it had
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
 
-		if !errors.Is(err, errPartialContent) {
-			w.withError(err)
-			w.withNotice(nil)
-			return false
+	w.lastUpdate = time.Now()
+
+	hadError := w.Error != nil
+	defer func() {
+		if !hadError && w.Error != nil {
+			w.notify(models.WidgetEvent{
+				Type:    models.WidgetEventFailed,
+				Title:   w.Title + " failed to update",
+				Message: w.Error.Error(),
+			})
+		} else if hadError && w.Error == nil {
+			w.notify(models.WidgetEvent{
+				Type:    models.WidgetEventRecovered,
+				Title:   w.Title + " is working again",
+				Message: "The widget updated successfully after having failed",
+			})
 		}
+	}()
+
+	if err != nil && !errors.Is(err, models.ErrPartialContent) {
+		w.scheduleEarlyUpdate()
+		w.withError(err)
+		w.withNotice(nil)
+		return false
+	}
 
+	if err != nil {
 		w.withError(nil)
 		w.withNotice(err)
+		w.scheduleNextUpdate()
 		return true
 	}
 
@@ -324,22 +489,52 @@ func (w *widgetBase) canContinueUpdateAfterHandlingErr(err error) bool {
 	return true
 }
 
+// Sends the event to the configured notifications, if there are any
+func (w *widgetBase) notify(event models.WidgetEvent) {
+	if w.Providers == nil || w.Providers.Notify == nil {
+		return
+	}
+
+	event.WidgetID = w.ID
+	event.WidgetType = w.Type
+	event.WidgetTitle = w.Title
+	event.Time = time.Now()
+
+	w.Providers.Notify(event)
+}
+
 func (w *widgetBase) getNextUpdateTime() time.Time {
 	now := time.Now()
 
 	if w.cacheType == cacheTypeDuration {
-		return now.Add(w.cacheDuration)
+		return now.Add(w.cacheDuration + updateJitter(w.cacheDuration/10))
 	}
 
 	if w.cacheType == cacheTypeOnTheHour {
 		return now.Add(time.Duration(
 			((60-now.Minute())*60)-now.Second(),
-		) * time.Second)
+		)*time.Second + updateJitter(maxOnTheHourUpdateJitter))
 	}
 
 	return time.Time{}
 }
 
+const (
+	maxUpdateJitter          = 5 * time.Minute
+	maxOnTheHourUpdateJitter = 30 * time.Second
+)
+
+// Spreads out the updates of widgets that were last updated at the same time
+// so that they don't all hit their upstream APIs at once again
+func updateJitter(max time.Duration) time.Duration {
+	max = min(max, maxUpdateJitter)
+	if max <= 0 {
+		return 0
+	}
+
+	return rand.N(max)
+}
+
 func (w *widgetBase) scheduleNextUpdate() *widgetBase {
 	w.nextUpdate = w.getNextUpdateTime()
 	w.updateRetriedTimes = 0
@@ -347,16 +542,31 @@ func (w *widgetBase) scheduleNextUpdate() *widgetBase {
 	return w
 }
 
+const (
+	defaultWidgetRetries      = 5
+	defaultWidgetRetryBackoff = time.Minute
+)
+
 func (w *widgetBase) scheduleEarlyUpdate() *widgetBase {
 	w.updateRetriedTimes++
 
-	if w.updateRetriedTimes > 5 {
-		w.updateRetriedTimes = 5
+	retries := w.Retries
+	if retries == 0 || retries < -1 {
+		retries = defaultWidgetRetries
 	}
 
-	nextEarlyUpdate := time.Now().Add(time.Duration(math.Pow(float64(w.updateRetriedTimes), 2)) * time.Minute)
 	nextUsualUpdate := w.getNextUpdateTime()
 
+	// once all of the retries have failed, the widget only gets updated on
+	// its usual schedule until an update succeeds
+	if retries == -1 || w.updateRetriedTimes > retries {
+		w.nextUpdate = nextUsualUpdate
+		return w
+	}
+
+	backoff := common.Ternary(w.RetryBackoff > 0, time.Duration(w.RetryBackoff), defaultWidgetRetryBackoff)
+	nextEarlyUpdate := time.Now().Add(time.Duration(math.Pow(float64(w.updateRetriedTimes), 2)) * backoff)
+
 	if nextEarlyUpdate.After(nextUsualUpdate) {
 		w.nextUpdate = nextUsualUpdate
 	} else {
@@ -365,3 +575,13 @@ func (w *widgetBase) scheduleEarlyUpdate() *widgetBase {
 
 	return w
 }
+
+// Content gets inserted into the page by setting innerHTML, which doesn't
+// run script tags but does run inline event handlers
+func cspSourcesOfScripts(html string) map[string][]string {
+	if _, hasInline := common.ScriptSourcesOfHTML(html); hasInline {
+		return map[string][]string{"script-src": {"'unsafe-inline'"}}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package widgets
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/limpdev/gander/internal/fetch"
+	"github.com/limpdev/gander/internal/models"
+)
+
+func TestCustomAPIPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tests := []struct {
+		name               string
+		widgetAllows       bool
+		serverAllows       bool
+		expectPrivateError bool
+	}{
+		{"blocked by default", false, false, true},
+		{"allowed by the widget", true, false, false},
+		{"allowed by the server", false, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			widget := &customAPIWidget{
+				CustomAPIRequest: &CustomAPIRequest{URL: server.URL},
+				AllowPrivate:     test.widgetAllows,
+				subrequests: map[string]*CustomAPIRequest{
+					"other": {URL: server.URL},
+				},
+			}
+			widget.Providers = &models.WidgetProviders{AllowPrivateAddresses: test.serverAllows}
+			widget.setClients()
+
+			clients := map[string]fetch.Doer{
+				"request":    widget.CustomAPIRequest.client,
+				"subrequest": widget.subrequests["other"].client,
+				"template":   widget.templateClient,
+			}
+
+			for name, client := range clients {
+				request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+				response, err := client.Do(request)
+				if err == nil {
+					response.Body.Close()
+				}
+
+				if blocked := errors.Is(err, fetch.ErrPrivateAddress); blocked != test.expectPrivateError {
+					t.Errorf("%s: got error %v, expected the private address to be blocked: %v", name, err, test.expectPrivateError)
+				}
+				if !test.expectPrivateError && err != nil {
+					t.Errorf("%s: expected the request to succeed, got %v", name, err)
+				}
+			}
+		})
+	}
+}